@@ -10,7 +10,7 @@ esac
 mkdir -p "$TESTGROUND_HOME" && cd "$TESTGROUND_HOME"
 
 docker pull iptestground/testground:edge
-docker pull iptestground/sync-service:edge
+docker pull iptestground/sync-service:v0.3.0
 docker pull iptestground/sidecar:edge
 
 # At the moment this is the fastest way to get a pre-built testground binary.
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/testground/testground/pkg/cmd"
+	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/logging"
 
 	"github.com/urfave/cli/v2"
@@ -24,6 +25,10 @@ func main() {
 	app.HideVersion = true
 	app.Before = func(c *cli.Context) error {
 		configureLogging(c)
+		// configuration is loaded by each command; pass the profile on.
+		if p := c.String("profile"); p != "" {
+			return os.Setenv(config.EnvTestgroundProfile, p)
+		}
 		return nil
 	}
 
@@ -0,0 +1,20 @@
+package api
+
+import "context"
+
+// authenticatedUserKey carries the user a request to the daemon authenticated
+// as, in its context.
+type authenticatedUserKey struct{}
+
+// WithAuthenticatedUser returns a context carrying the user the request it
+// belongs to authenticated as, with one of the user_tokens of the daemon.
+func WithAuthenticatedUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, authenticatedUserKey{}, user)
+}
+
+// AuthenticatedUser returns the user a request authenticated as; empty if it
+// didn't authenticate with the token of a user.
+func AuthenticatedUser(ctx context.Context) string {
+	user, _ := ctx.Value(authenticatedUserKey{}).(string)
+	return user
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticatedUser(t *testing.T) {
+	require.Empty(t, AuthenticatedUser(context.Background()))
+	require.Equal(t, "alice", AuthenticatedUser(WithAuthenticatedUser(context.Background(), "alice")))
+}
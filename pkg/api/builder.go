@@ -2,7 +2,11 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/rpc"
@@ -54,6 +58,69 @@ type BuildInput struct {
 	// BuildConfig is the configuration of the build job sourced from the test
 	// plan manifest, coalesced with any user-provided overrides.
 	BuildConfig interface{}
+
+	// Metadata describes the task this build is part of.
+	Metadata BuildMetadata
+}
+
+// BuildMetadata describes the task a build is part of. Builders render the
+// build args and image labels of their configuration as templates of it,
+// e.g. "{{.TaskID}}", so that images can be traced back to their task.
+type BuildMetadata struct {
+	// TaskID is the ID of the build task, or of the run task for builds
+	// performed as part of a run.
+	TaskID string
+	// BuildID is the ID of the build, which docker builders tag images with.
+	BuildID string
+
+	// Plan and Case are the test plan and case of the composition built.
+	Plan string
+	Case string
+
+	// User, Repo, Branch and Commit identify who, and what commit, created
+	// the task, if known.
+	User   string
+	Repo   string
+	Branch string
+	Commit string
+}
+
+// Render renders a template against the metadata. Strings without actions
+// are returned as is.
+func (m *BuildMetadata) Render(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %w", s, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, m); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", s, err)
+	}
+	return b.String(), nil
+}
+
+// RenderAll renders every value of a map of templates, such as build args or
+// image labels, into a new map. Nil values are preserved.
+func (m *BuildMetadata) RenderAll(in map[string]*string) (map[string]*string, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(map[string]*string, len(in))
+	for k, v := range in {
+		if v == nil {
+			out[k] = nil
+			continue
+		}
+		r, err := m.Render(*v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		out[k] = &r
+	}
+	return out, nil
 }
 
 // BuildOutput encapsulates the output from a build action.
@@ -69,6 +136,44 @@ type BuildOutput struct {
 	// containing the collapsed transitive upstream dependency set of this
 	// build.
 	Dependencies map[string]string
+
+	// Provenance records how this artifact was produced. It is populated by
+	// the engine, not by builders.
+	Provenance *Provenance
+}
+
+// Provenance records how a build artifact was produced, so that runners can
+// check that they only execute artifacts built by a trusted daemon.
+type Provenance struct {
+	// ArtifactPath is the artifact this record describes.
+	ArtifactPath string `json:"artifact_path"`
+
+	// ArtifactDigest is the digest of the contents of the artifact: the ID of
+	// docker images, or the sha256 of files.
+	ArtifactDigest string `json:"artifact_digest"`
+
+	// BuilderID is the ID of the builder that produced the artifact.
+	BuilderID string `json:"builder_id"`
+
+	// TestPlan is the name of the test plan that was built.
+	TestPlan string `json:"plan"`
+
+	// SourceHash is the hex-encoded SHA-256 digest of the sources the
+	// artifact was built from. Sources are only hashed when the build pins
+	// them, or when provenance records are signed.
+	SourceHash string `json:"source_hash,omitempty"`
+
+	// BuildConfig is the coalesced builder configuration.
+	BuildConfig interface{} `json:"build_config"`
+
+	// Dependencies is the resolved upstream dependency set, if known.
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+
+	// DaemonVersion is the git commit of the daemon that built the artifact.
+	DaemonVersion string `json:"daemon_version"`
+
+	// BuiltAt is the time at which the build completed.
+	BuiltAt time.Time `json:"built_at"`
 }
 
 // DependencyTarget encapsulates the target and version of a dependency.
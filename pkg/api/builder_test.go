@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMetadataRender(t *testing.T) {
+	meta := &BuildMetadata{
+		TaskID: "c60i0d2llu6a7gha3ef0",
+		Plan:   "network",
+		Case:   "ping-pong",
+		Commit: "4b825dc642cb6eb9a060e54bf8d69288fbee4904",
+	}
+
+	s, err := meta.Render("{{.Plan}}/{{.Case}}@{{.Commit}}")
+	require.NoError(t, err)
+	require.Equal(t, "network/ping-pong@4b825dc642cb6eb9a060e54bf8d69288fbee4904", s)
+
+	// strings without actions are left as they are.
+	s, err = meta.Render("plain {value}")
+	require.NoError(t, err)
+	require.Equal(t, "plain {value}", s)
+
+	_, err = meta.Render("{{.Sha}}")
+	require.Error(t, err)
+	_, err = meta.Render("{{.Plan")
+	require.Error(t, err)
+
+	task, plain := "{{.TaskID}}", "1"
+	args, err := meta.RenderAll(map[string]*string{"TASK": &task, "PLAIN": &plain, "UNSET": nil})
+	require.NoError(t, err)
+	require.Equal(t, "c60i0d2llu6a7gha3ef0", *args["TASK"])
+	require.Equal(t, "1", *args["PLAIN"])
+	require.Nil(t, args["UNSET"])
+	require.Equal(t, "{{.TaskID}}", task)
+
+	args, err = meta.RenderAll(nil)
+	require.NoError(t, err)
+	require.Nil(t, args)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Churn is a churn schedule of a composition: every Every, a number of
+// instances of Group, picked at random, are killed and replaced by fresh
+// instances with the same sequence numbers. The number of instances is either
+// Count, or Fraction of the instances of the group, rounded up.
+type Churn struct {
+	Group    string  `toml:"group" json:"group"`
+	Every    string  `toml:"every" json:"every"`
+	Count    int     `toml:"count" json:"count,omitempty"`
+	Fraction float64 `toml:"fraction" json:"fraction,omitempty"`
+}
+
+// Interval parses Every.
+func (c Churn) Interval() (time.Duration, error) {
+	d, err := time.ParseDuration(c.Every)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid churn interval of group %s: %q", c.Group, c.Every)
+	}
+	return d, nil
+}
+
+// Size returns how many instances of a group of n instances are churned at a
+// time.
+func (c Churn) Size(n int) int {
+	size := c.Count
+	if c.Fraction > 0 {
+		size = int(math.Ceil(c.Fraction * float64(n)))
+	}
+	if size > n {
+		size = n
+	}
+	return size
+}
+
+// Validate checks a churn schedule against the groups of a run, and their
+// number of instances.
+func (c Churn) Validate(groups map[string]int) error {
+	if _, ok := groups[c.Group]; !ok {
+		return fmt.Errorf("churn schedule references unknown group: %s", c.Group)
+	}
+	if _, err := c.Interval(); err != nil {
+		return err
+	}
+	switch {
+	case c.Count != 0 && c.Fraction != 0:
+		return fmt.Errorf("churn schedule of group %s sets both a count and a fraction", c.Group)
+	case c.Count < 0, c.Fraction < 0, c.Fraction > 1:
+		return fmt.Errorf("invalid churn size of group %s", c.Group)
+	case c.Count == 0 && c.Fraction == 0:
+		return fmt.Errorf("churn schedule of group %s sets neither a count nor a fraction", c.Group)
+	}
+	return nil
+}
+
+// ChurnEvent records the instances of a group replaced by a churn schedule.
+// The events of a run are published to its instances through its key/value
+// store, under ChurnEventsKey, as a JSON array.
+type ChurnEvent struct {
+	Time      time.Time `json:"time"`
+	Group     string    `json:"group"`
+	Instances []int     `json:"instances"`
+}
+
+// ChurnEventsKey is the key of the key/value store of a run under which its
+// churn events are published.
+const ChurnEventsKey = "testground.churn"
+
+// Churner is the interface to be implemented by a runner that can replace the
+// instances of an ongoing run, to execute the churn schedules of
+// compositions.
+type Churner interface {
+	// ReplaceInstances kills instances of a run, and starts fresh ones in
+	// their stead, with the same group and sequence numbers. The run goes on
+	// as if the replaced instances had never existed; only the outcomes of
+	// their replacements count.
+	ReplaceInstances(ctx context.Context, in *ChurnInput, ow *rpc.OutputWriter) error
+}
+
+// ChurnInput identifies the instances of a run to replace.
+type ChurnInput struct {
+	// EnvConfig is the env configuration of the engine. Not a pointer to force
+	// a copy.
+	EnvConfig config.EnvConfig
+	RunID     string
+
+	// RunnerConfig is the configuration of the runner, coalesced with the env
+	// configuration.
+	RunnerConfig interface{}
+
+	// Group is the group of the instances, and Instances their sequence
+	// numbers within the group.
+	Group     string
+	Instances []int
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChurn(t *testing.T) {
+	groups := map[string]int{"peers": 50}
+
+	c := Churn{Group: "peers", Every: "30s", Fraction: 0.02}
+	require.NoError(t, c.Validate(groups))
+	require.Equal(t, 1, c.Size(50))
+	require.Equal(t, 2, c.Size(51))
+
+	c = Churn{Group: "peers", Every: "30s", Count: 5}
+	require.NoError(t, c.Validate(groups))
+	require.Equal(t, 5, c.Size(50))
+	require.Equal(t, 3, c.Size(3))
+
+	require.Error(t, Churn{Group: "seeds", Every: "30s", Count: 1}.Validate(groups))
+	require.Error(t, Churn{Group: "peers", Every: "soon", Count: 1}.Validate(groups))
+	require.Error(t, Churn{Group: "peers", Every: "30s"}.Validate(groups))
+	require.Error(t, Churn{Group: "peers", Every: "30s", Count: 1, Fraction: 0.1}.Validate(groups))
+	require.Error(t, Churn{Group: "peers", Every: "30s", Fraction: 1.5}.Validate(groups))
+}
@@ -31,9 +31,17 @@ type Composition struct {
 }
 
 type Global struct {
-	// Plan is the test plan we want to run.
+	// Plan is the test plan we want to run. Plans published to the plan
+	// registry of the daemon are referenced as <name>@<version>.
 	Plan string `toml:"plan" json:"plan" validate:"required"`
 
+	// PlanSource, if set, is where the daemon fetches the source of the test
+	// plan from, instead of it being uploaded from $TESTGROUND_HOME/plans. It
+	// can be a git repository, as git+<url>[//<dir>][?ref=<ref>], or an OCI
+	// image containing the plan, as oci://<image>[//<dir>] (default dir:
+	// /plan).
+	PlanSource string `toml:"plan_source" json:"plan_source"`
+
 	// Case is the test case we want to run.
 	Case string `toml:"case" json:"case" validate:"required"`
 
@@ -72,6 +80,71 @@ type Global struct {
 
 	// DisableMetrics is used to disable metrics batching.
 	DisableMetrics bool `toml:"disable_metrics" json:"disable_metrics"`
+
+	// Stagger, if set, spreads the start of instances over time instead of
+	// starting them all at once. cluster:swarm doesn't support it.
+	Stagger *Stagger `toml:"stagger" json:"stagger"`
+
+	// Seed seeds the randomness of the run: instances get it in the
+	// TEST_RUN_SEED environment variable, and churn schedules pick the
+	// instances they replace with it. When zero, the daemon picks a seed and
+	// records it in the composition of the run, so that any run can be
+	// replayed.
+	Seed int64 `toml:"seed" json:"seed"`
+
+	// StoreWriter is the group whose instances can write to the key/value
+	// store of the run, e.g. a leader minting values at the start of the
+	// run. All instances can read it.
+	StoreWriter string `toml:"store_writer" json:"store_writer"`
+
+	// Roles are claimed by instances at startup, through the daemon; see
+	// ClaimRoleRequest.
+	Roles Roles `toml:"roles" json:"roles"`
+
+	// Churn are the churn schedules of the run, executed by runners that
+	// support it.
+	Churn []Churn `toml:"churn" json:"churn"`
+
+	// Thresholds are the performance gates of the run, evaluated against
+	// the metrics it recorded once it completes. The outcome of the run is a
+	// failure if any is violated.
+	Thresholds []Threshold `toml:"thresholds" json:"thresholds"`
+
+	// Persistent runs are not bound by the task timeout of the daemon; they
+	// last until their instances are done, or they're killed. They are meant
+	// as long-lived environments, e.g. a baseline network that other runs
+	// attach to. Since each holds a worker of the daemon, the daemon caps how
+	// many it runs at once, see max_persistent_runs.
+	Persistent bool `toml:"persistent" json:"persistent"`
+
+	// AttachTo is the ID of an ongoing run whose network the instances of
+	// this run join, e.g. to run a short workload against a persistent
+	// baseline network without bootstrapping one. Both runs must use the same
+	// runner, and the runner must support attaching runs. The TestSubnet of
+	// the instances is then a block of the network reserved to this run, from
+	// whose start they should derive their data addresses.
+	AttachTo string `toml:"attach_to" json:"attach_to"`
+
+	// Snapshot saves the state of the instances of the run once they're
+	// bootstrapped, or restores them to a saved state.
+	Snapshot *Snapshot `toml:"snapshot" json:"snapshot"`
+}
+
+// PlanVersion splits a reference to a published plan, of the form
+// <name>@<version>, into its name and version. The version is empty for plans
+// that are not published ones.
+func (g Global) PlanVersion() (name, version string) {
+	if i := strings.LastIndex(g.Plan, "@"); i >= 0 {
+		return g.Plan[:i], g.Plan[i+1:]
+	}
+	return g.Plan, ""
+}
+
+// RemotePlan returns whether the plan is fetched by the daemon, from a plan
+// source or the plan registry, rather than uploaded by the client.
+func (g Global) RemotePlan() bool {
+	_, version := g.PlanVersion()
+	return g.PlanSource != "" || version != ""
 }
 
 type Metadata struct {
@@ -85,6 +158,99 @@ type Metadata struct {
 type Resources struct {
 	Memory string `toml:"memory" json:"memory"`
 	CPU    string `toml:"cpu" json:"cpu"`
+
+	// MemorySwap is the total of memory and swap each instance may use, e.g.
+	// "2Gi", or "-1" for unlimited swap. It requires Memory to be set, and
+	// is only supported by local:docker.
+	MemorySwap string `toml:"memory_swap" json:"memory_swap" mapstructure:"memory_swap"`
+
+	// OOMKillDisable keeps the kernel OOM killer from killing instances
+	// exceeding their memory; they are paused until memory is freed instead.
+	// On local:docker, it requires Memory to be set, and enforces it.
+	// On cluster:k8s, pods get the Guaranteed QoS class, which the OOM killer
+	// picks last.
+	OOMKillDisable bool `toml:"oom_kill_disable" json:"oom_kill_disable" mapstructure:"oom_kill_disable"`
+
+	// OOMScoreAdj tunes the preference of the OOM killer for instances, from
+	// -1000 (never) to 1000 (first). On cluster:k8s, negative values give pods
+	// the Guaranteed QoS class.
+	OOMScoreAdj int `toml:"oom_score_adj" json:"oom_score_adj" mapstructure:"oom_score_adj"`
+}
+
+const (
+	// MountTypeVolume is a volume private to each instance, which outlives
+	// restarts of the instance, but not the run.
+	MountTypeVolume = "volume"
+	// MountTypeBind is a path of the host, which runners only mount when
+	// allowed by their configuration.
+	MountTypeBind = "bind"
+	// MountTypeTmpfs is an in-memory filesystem, private to each instance.
+	MountTypeTmpfs = "tmpfs"
+)
+
+const (
+	// SeccompDefault applies the default seccomp profile of the runtime.
+	SeccompDefault = "default"
+	// SeccompUnconfined disables seccomp filtering.
+	SeccompUnconfined = "unconfined"
+)
+
+// Security is the security context of the instances of a group. Runners only
+// grant what the daemon allows.
+type Security struct {
+	// CapAdd are the Linux capabilities added to the instances, e.g.
+	// "NET_ADMIN".
+	CapAdd []string `toml:"cap_add" json:"cap_add" mapstructure:"cap_add"`
+
+	// Privileged runs the instances in privileged containers.
+	Privileged bool `toml:"privileged" json:"privileged"`
+
+	// Seccomp is the seccomp profile of the instances: "default" or
+	// "unconfined" (default: "default").
+	Seccomp string `toml:"seccomp" json:"seccomp"`
+}
+
+// Capabilities returns the capabilities to add, normalized to upper case and
+// without their CAP_ prefix, e.g. "NET_ADMIN".
+func (s Security) Capabilities() []string {
+	ret := make([]string, 0, len(s.CapAdd))
+	for _, c := range s.CapAdd {
+		ret = append(ret, strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), "CAP_"))
+	}
+	return ret
+}
+
+// Placement constrains the nodes the instances of a group are scheduled on,
+// relative to each other and to the instances of other groups of the run.
+type Placement struct {
+	// AvoidGroups are the IDs of the groups of the run whose instances must
+	// not share a node with the instances of this group.
+	AvoidGroups []string `toml:"avoid_groups" json:"avoid_groups" mapstructure:"avoid_groups"`
+
+	// InstancesPerNode is the exact number of instances of this group on
+	// every node they are scheduled on. The number of instances of the group
+	// must be a multiple of it (default: unconstrained).
+	InstancesPerNode int `toml:"instances_per_node" json:"instances_per_node" mapstructure:"instances_per_node"`
+}
+
+// Mount is a filesystem mounted into every instance of a group.
+type Mount struct {
+	// Type is the type of the mount: "volume", "bind" or "tmpfs".
+	Type string `toml:"type" json:"type"`
+
+	// Source is the name of the volume, or the path of the host to bind. It
+	// is ignored for tmpfs mounts.
+	Source string `toml:"source" json:"source"`
+
+	// Target is the absolute path the mount is mounted at in the instances.
+	Target string `toml:"target" json:"target"`
+
+	// ReadOnly mounts the filesystem read-only.
+	ReadOnly bool `toml:"read_only" json:"read_only" mapstructure:"read_only"`
+
+	// Size caps the size of tmpfs mounts, in human-readable units, e.g.
+	// "512MiB" (default: unlimited).
+	Size string `toml:"size" json:"size"`
 }
 
 type Group struct {
@@ -103,6 +269,16 @@ type Group struct {
 	// Resources requested for each pod from the Kubernetes cluster
 	Resources Resources `toml:"resources" json:"resources"`
 
+	// Mounts are the filesystems mounted into each instance of this group.
+	Mounts []Mount `toml:"mounts" json:"mounts"`
+
+	// Security is the security context of each instance of this group.
+	Security Security `toml:"security" json:"security"`
+
+	// Placement constrains the nodes the instances of this group are
+	// scheduled on.
+	Placement Placement `toml:"placement" json:"placement"`
+
 	// Instances defines the number of instances that belong to this group.
 	Instances Instances `toml:"instances" json:"instances"`
 
@@ -143,6 +319,17 @@ type CompositionRunGroup struct {
 	// Resources requested for each pod from the Kubernetes cluster
 	Resources Resources `toml:"resources" json:"resources"`
 
+	// Mounts are the filesystems mounted into each instance of this group.
+	// They default to the mounts of the group.
+	Mounts []Mount `toml:"mounts" json:"mounts"`
+
+	// Security is the security context of each instance of this group.
+	Security Security `toml:"security" json:"security"`
+
+	// Placement constrains the nodes the instances of this group are
+	// scheduled on. Groups to avoid are referred to by their IDs in the run.
+	Placement Placement `toml:"placement" json:"placement"`
+
 	// Instances defines the number of instances that belong to this group.
 	Instances Instances `toml:"instances" json:"instances"`
 
@@ -463,6 +650,9 @@ func (g *Group) DefaultRunGroup() (*CompositionRunGroup) {
 		ID:         g.ID,
 		GroupID:    g.ID,
 		Resources:  g.Resources,
+		Mounts:     g.Mounts,
+		Security:   g.Security,
+		Placement:  g.Placement,
 		Instances:  g.Instances,
 		TestParams: g.Run.TestParams,
 		Profiles:   g.Run.Profiles,
@@ -475,6 +665,20 @@ func (r *CompositionRunGroup) merge(other *Group) (error) {
 		return err
 	}
 
+	if len(r.Mounts) == 0 {
+		r.Mounts = other.Mounts
+	}
+
+	err = mergo.Merge(&r.Security, other.Security)
+	if err != nil {
+		return err
+	}
+
+	err = mergo.Merge(&r.Placement, other.Placement)
+	if err != nil {
+		return err
+	}
+
 	err = mergo.Merge(&r.Instances, other.Instances)
 	if err != nil {
 		return err
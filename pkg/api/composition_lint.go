@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// LintTotalInstances flags total_instances that differ from the sum of
+	// the instances of the groups.
+	LintTotalInstances = "total-instances"
+	// LintMissingResources flags groups without resources on cluster
+	// runners, whose instances then compete for the nodes.
+	LintMissingResources = "missing-resources"
+	// LintMissingBuildConfig flags groups whose builder has no build
+	// configuration, neither in the composition nor in the plan manifest.
+	LintMissingBuildConfig = "missing-build-config"
+	// LintUnknownParam flags test params the test case doesn't declare, and
+	// which instances therefore most likely ignore.
+	LintUnknownParam = "unknown-param"
+	// LintEmptyTemplateValue flags template actions that render as empty
+	// strings, e.g. unset environment variables.
+	LintEmptyTemplateValue = "empty-template-value"
+)
+
+// LintIssue is an anti-pattern found in a composition: something that is
+// valid, but most likely not what the author meant.
+type LintIssue struct {
+	// Rule is the anti-pattern, e.g. LintTotalInstances.
+	Rule string `json:"rule"`
+
+	// Message explains where the anti-pattern was found.
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Rule, i.Message)
+}
+
+// Lint checks this composition for common anti-patterns. The manifest of the
+// test plan, if not nil, is used to check builders and test params against.
+//
+// Unlike validation, linting doesn't fail; it returns the issues found, if
+// any.
+func (c Composition) Lint(manifest *TestPlanManifest) []LintIssue {
+	generated := len(c.Runs) == 0
+	c = *c.GenerateDefaultRun()
+
+	var issues []LintIssue
+	report := func(rule, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// total instances.
+	for _, r := range c.Runs {
+		total := r.TotalInstances
+		if total == 0 {
+			total = c.Global.TotalInstances
+		}
+		if total == 0 {
+			continue
+		}
+		var sum uint
+		for _, g := range r.Groups {
+			inst := g.Instances
+			if inst.Count == 0 && inst.Percentage == 0 {
+				if grp, err := c.GetGroup(g.EffectiveGroupId()); err == nil {
+					inst = grp.Instances
+				}
+			}
+			if inst.Count > 0 {
+				sum += inst.Count
+			} else {
+				sum += uint(math.Round(inst.Percentage * float64(total)))
+			}
+		}
+		if sum != total {
+			report(LintTotalInstances, "run %s: total_instances is %d, but its groups add up to %d", r.ID, total, sum)
+		}
+	}
+
+	// resources on cluster runners.
+	if strings.HasPrefix(c.Global.Runner, "cluster:") {
+		for _, r := range c.Runs {
+			for _, g := range r.Groups {
+				res := g.Resources
+				if grp, err := c.GetGroup(g.EffectiveGroupId()); err == nil {
+					if res.Memory == "" {
+						res.Memory = grp.Resources.Memory
+					}
+					if res.CPU == "" {
+						res.CPU = grp.Resources.CPU
+					}
+				}
+				var missing []string
+				if res.Memory == "" {
+					missing = append(missing, "memory")
+				}
+				if res.CPU == "" {
+					missing = append(missing, "cpu")
+				}
+				if len(missing) > 0 {
+					report(LintMissingResources, "group %s:%s requests no %s on runner %s", r.ID, g.ID, strings.Join(missing, " or "), c.Global.Runner)
+				}
+			}
+		}
+	}
+
+	if manifest == nil {
+		return issues
+	}
+
+	// build configuration.
+	for _, g := range c.Groups {
+		builder := g.Builder
+		if builder == "" {
+			builder = c.Global.Builder
+		}
+		switch {
+		case builder == "":
+			// a validation error.
+		case !manifest.HasBuilder(builder):
+			report(LintMissingBuildConfig, "group %s uses builder %s, which the plan manifest has no build_config for", g.ID, builder)
+		case len(g.BuildConfig) == 0 && len(c.Global.BuildConfig) == 0 && len(manifest.Builders[builder]) == 0:
+			report(LintMissingBuildConfig, "group %s uses builder %s with no build_config, neither in the composition nor in the plan manifest", g.ID, builder)
+		}
+	}
+
+	// test params.
+	_, tcase, ok := manifest.TestCaseByName(c.Global.Case)
+	if !ok {
+		return issues
+	}
+	unknown := func(where string, params map[string]string) {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			if _, ok := tcase.Parameters[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			report(LintUnknownParam, "test param %s of %s is not declared by test case %s", name, where, tcase.Name)
+		}
+	}
+	if c.Global.Run != nil {
+		unknown("global run", c.Global.Run.TestParams)
+	}
+	for _, g := range c.Groups {
+		unknown("group "+g.ID, g.Run.TestParams)
+	}
+	if generated {
+		// the default run only carries the params of the groups.
+		return issues
+	}
+	for _, r := range c.Runs {
+		unknown("run "+r.ID, r.TestParams)
+		for _, g := range r.Groups {
+			unknown("group "+r.ID+":"+g.ID, g.TestParams)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/config"
+)
+
+func lintRules(issues []LintIssue) []string {
+	rules := make([]string, 0, len(issues))
+	for _, i := range issues {
+		rules = append(rules, i.Rule)
+	}
+	return rules
+}
+
+func TestLintComposition(t *testing.T) {
+	manifest := &TestPlanManifest{
+		Name:     "network",
+		Builders: map[string]config.ConfigMap{"docker:go": {"go_version": "1.16"}, "docker:generic": {}},
+		TestCases: []*TestCase{
+			{Name: "ping-pong", Parameters: map[string]Parameter{"latency": {Type: "int"}}},
+		},
+	}
+
+	c := Composition{
+		Global: Global{
+			Plan:           "network",
+			Case:           "ping-pong",
+			Builder:        "docker:go",
+			Runner:         "cluster:k8s",
+			TotalInstances: 10,
+			Run:            &RunParams{TestParams: map[string]string{"latency": "10", "latnecy": "10"}},
+		},
+		Groups: Groups{
+			{ID: "a", Instances: Instances{Count: 4}, Resources: Resources{Memory: "1Gi", CPU: "1"}},
+			{ID: "b", Instances: Instances{Count: 4}, Resources: Resources{Memory: "1Gi"}},
+			{ID: "c", Builder: "docker:generic", Instances: Instances{Count: 1}, Resources: Resources{Memory: "1Gi", CPU: "1"}},
+		},
+	}
+
+	issues := c.Lint(manifest)
+	require.Equal(t, []string{
+		LintTotalInstances,
+		LintMissingResources,
+		LintMissingBuildConfig,
+		LintUnknownParam,
+	}, lintRules(issues))
+	require.Contains(t, issues[0].Message, "add up to 9")
+	require.Contains(t, issues[1].Message, "default:b requests no cpu")
+	require.Contains(t, issues[2].Message, "group c")
+	require.Contains(t, issues[3].Message, "latnecy")
+
+	// without a manifest, only the composition itself is checked.
+	require.Len(t, c.Lint(nil), 2)
+
+	// nothing to flag.
+	c.Global.TotalInstances = 0
+	c.Global.Runner = "local:docker"
+	c.Global.Run = nil
+	c.Groups = c.Groups[:2]
+	require.Empty(t, c.Lint(manifest))
+}
+
+func TestLintCompositionTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "composition.toml")
+	tpl := `[global]
+plan = "{{ .Env.PLAN }}"
+case = "{{ .Env.CASE }}"
+{{ with .Env.BUILDER }}builder = "{{ . }}"{{ end }}
+{{ if .Env.RUNNER }}runner = "{{ .Env.RUNNER }}"{{ end }}
+{{ if not .Env.SEED }}{{ else }}seed = {{ .Env.SEED }}{{ end }}
+{{ if .Env.RUNNER }}{{ else }}runner = "{{ .Env.FALLBACK }}"{{ end }}
+`
+	require.NoError(t, os.WriteFile(path, []byte(tpl), 0644))
+
+	issues, err := LintCompositionTemplate(path, &CompositionTemplateData{Env: map[string]string{"PLAN": "network"}})
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	require.Equal(t, LintEmptyTemplateValue, issues[0].Rule)
+	require.Contains(t, issues[0].Message, "line 3")
+	require.Contains(t, issues[0].Message, ".Env.CASE")
+
+	// fields are only optional where they're guarded.
+	require.Contains(t, issues[1].Message, ".Env.FALLBACK")
+}
@@ -130,6 +130,11 @@ func (c Composition) PrepareForRun(manifest *TestPlanManifest) (*Composition, er
 		return nil, fmt.Errorf("test case %s not found in plan %s", c.Global.Case, manifest.Name)
 	}
 
+	// validate the stagger, if any.
+	if _, err := c.Global.Stagger.StartDelays(1); err != nil {
+		return nil, err
+	}
+
 	// Require a runner in the manifest.
 	if manifest.Runners == nil || len(manifest.Runners) == 0 {
 		return nil, fmt.Errorf("plan supports no runners; review the manifest")
@@ -277,5 +282,19 @@ func (g CompositionRunGroup) PrepareForRun(manifest *TestPlanManifest, compositi
 		return nil, err
 	}
 
+	// Validate test params against the parameters declared by the test case,
+	// so that instances don't fail parsing them at runtime.
+	_, tcase, _ := manifest.TestCaseByName(composition.Global.Case)
+	params := make(map[string]string, len(g.TestParams))
+	for name, v := range g.TestParams {
+		if p, ok := tcase.Parameters[name]; ok {
+			if v, err = p.Coerce(v); err != nil {
+				return nil, fmt.Errorf("group %s: invalid test param %s: %w", g.ID, name, err)
+			}
+		}
+		params[name] = v
+	}
+	g.TestParams = params
+
 	return &g, nil
 }
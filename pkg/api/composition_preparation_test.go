@@ -559,3 +559,57 @@ func TestRunConfigTrickleDown(t *testing.T) {
 	require.EqualValues(t, map[string]string{"test_param_global": "overriden_by_run", "test_param_group": "overriden_by_run", "test_param_runs": "overriden_by_run", "test_param_run": "test_param_run"}, ret.Runs[1].Groups[2].TestParams)
 
 }
+
+func TestPrepareForRunValidatesTestParams(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:           "foo_plan",
+			Case:           "foo_case",
+			TotalInstances: 1,
+			Builder:        "docker:go",
+			Runner:         "local:docker",
+		},
+		Groups: []*Group{
+			{
+				ID:        "peers",
+				Instances: Instances{Count: 1},
+				Run: RunParams{
+					TestParams: map[string]string{
+						"count": "ten",
+					},
+				},
+			},
+		},
+	}
+
+	manifest := &TestPlanManifest{
+		Name: "foo_plan",
+		Builders: map[string]config.ConfigMap{
+			"docker:go": {},
+		},
+		Runners: map[string]config.ConfigMap{
+			"local:docker": {},
+		},
+		TestCases: []*TestCase{
+			{
+				Name:      "foo_case",
+				Instances: InstanceConstraints{Minimum: 1, Maximum: 100},
+				Parameters: map[string]Parameter{
+					"count": {
+						Type:    "int",
+						Default: int64(1),
+					},
+				},
+			},
+		},
+	}
+
+	_, err := c.PrepareForRun(manifest)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "group peers: invalid test param count")
+
+	c.Groups[0].Run.TestParams["count"] = " 10"
+	ret, err := c.PrepareForRun(manifest)
+	require.NoError(t, err)
+	require.EqualValues(t, "10", ret.Runs[0].Groups[0].TestParams["count"])
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/BurntSushi/toml"
+)
+
+// CompositionTemplateData is the data compositions are rendered with, when
+// they are processed as templates.
+type CompositionTemplateData struct {
+	Env map[string]string
+
+	// Root, if set, is the directory resources must be loaded from.
+	Root string
+}
+
+// compositionTemplateFuncs returns the functions available to the composition
+// template at path.
+func compositionTemplateFuncs(path string, input *CompositionTemplateData) template.FuncMap {
+	templateDir := filepath.Dir(path)
+
+	return template.FuncMap{
+		"pick": func(v map[string]interface{}, key string) map[string]interface{} {
+			x := map[string]interface{}{key: v[key]}
+			return x
+		},
+		"toml": func(v interface{}) (string, error) {
+			var buf bytes.Buffer
+			if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+		"withEnv": func(value map[string]interface{}) map[string]interface{} {
+			result := map[string]interface{}{}
+			for k, v := range value {
+				result[k] = v
+			}
+			result["Env"] = input.Env
+			return result
+		},
+		"split": func(xs string) []string {
+			return strings.Split(xs, ",")
+		},
+		"atoi": func(s string) (int, error) {
+			return strconv.Atoi(s)
+		},
+		"load_resource": func(p string) (map[string]interface{}, error) {
+			// NOTE: on the client, we do not worry about path that are leaving the template folders, or going
+			//		 through symlinks. Templates rendered by the daemon are confined to their Root.
+			fullPath := filepath.Join(templateDir, p)
+			if input.Root != "" {
+				resolved, err := filepath.EvalSymlinks(fullPath)
+				if err != nil {
+					return nil, err
+				}
+				if rel, err := filepath.Rel(input.Root, resolved); err != nil || strings.HasPrefix(rel, "..") {
+					return nil, fmt.Errorf("load_resource %s failed: outside of %s", p, input.Root)
+				}
+			}
+
+			data, err := os.ReadFile(fullPath)
+			if err != nil {
+				return nil, err
+			}
+
+			var result map[string]interface{}
+			if _, err := toml.Decode(string(data), &result); err != nil {
+				return nil, fmt.Errorf("load_resource %s failed: %w", p, err)
+			}
+
+			return result, nil
+		},
+	}
+}
+
+// CompileCompositionTemplate renders the composition template at path.
+func CompileCompositionTemplate(path string, input *CompositionTemplateData) (*bytes.Buffer, error) {
+	fdata, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse and run the composition as a template
+	tpl, err := template.New("tpl").Funcs(compositionTemplateFuncs(path, input)).Parse(string(fdata))
+	if err != nil {
+		return nil, err
+	}
+	buff := &bytes.Buffer{}
+	err = tpl.Execute(buff, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return buff, nil
+}
+
+// LoadComposition renders the composition template at path with the supplied
+// environment, and decodes it.
+func LoadComposition(path string, data *CompositionTemplateData) (*Composition, error) {
+	buff, err := CompileCompositionTemplate(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process composition template: %w", err)
+	}
+
+	comp := new(Composition)
+	if _, err = toml.Decode(buff.String(), comp); err != nil {
+		return nil, fmt.Errorf("failed to process composition file: %w", err)
+	}
+
+	return comp.GenerateDefaultRun(), nil
+}
+
+// LintCompositionTemplate checks the composition template at path for actions
+// that render as empty strings with the supplied data, e.g. unset environment
+// variables. Only the actions evaluated against the top-level data are
+// checked, as those in range and with blocks depend on their iteration.
+// Fields are optional within the if blocks they guard, e.g. .Env.FOO within
+// {{ if .Env.FOO }}, and within the else blocks of {{ if not .Env.FOO }}.
+func LintCompositionTemplate(path string, input *CompositionTemplateData) ([]LintIssue, error) {
+	fdata, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := compositionTemplateFuncs(path, input)
+	tpl, err := template.New("tpl").Funcs(funcs).Parse(string(fdata))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		issues []LintIssue
+		walk   func(n parse.Node, guarded map[string]bool)
+	)
+	walk = func(n parse.Node, guarded map[string]bool) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, guarded)
+			}
+		case *parse.IfNode:
+			then, els := ifGuards(n.Pipe)
+			walk(n.List, withGuards(guarded, then))
+			walk(n.ElseList, withGuards(guarded, els))
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				// assignments render nothing.
+				return
+			}
+			for _, f := range pipeFields(n.Pipe) {
+				if guarded[f] {
+					return
+				}
+			}
+			// evaluate the action on its own; actions that can't be, e.g.
+			// because they refer to variables, are skipped.
+			action, err := template.New("action").Funcs(funcs).Parse(n.String())
+			if err != nil {
+				return
+			}
+			var buf bytes.Buffer
+			if err := action.Execute(&buf, input); err != nil {
+				return
+			}
+			if v := strings.TrimSpace(buf.String()); v == "" || v == "<no value>" {
+				issues = append(issues, LintIssue{
+					Rule:    LintEmptyTemplateValue,
+					Message: fmt.Sprintf("line %d: %s renders as an empty string", n.Line, n),
+				})
+			}
+		}
+	}
+	walk(tpl.Tree.Root, nil)
+
+	return issues, nil
+}
+
+// ifGuards returns the fields an if condition guards: those that are set
+// within its block, e.g. for {{ if .A }} or {{ if and .A .B }}, and those
+// that are set within its else block, for {{ if not .A }}.
+func ifGuards(pipe *parse.PipeNode) (then, els []string) {
+	if len(pipe.Cmds) != 1 {
+		return nil, nil
+	}
+	args := pipe.Cmds[0].Args
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if id, ok := args[0].(*parse.IdentifierNode); ok && len(args) > 1 {
+		switch id.Ident {
+		case "and":
+			return argFields(args[1:]), nil
+		case "not":
+			return nil, argFields(args[1:])
+		}
+		return nil, nil
+	}
+	return argFields(args), nil
+}
+
+// pipeFields returns the fields, and the chains of fields, in the commands
+// of a pipeline.
+func pipeFields(pipe *parse.PipeNode) []string {
+	var fields []string
+	for _, c := range pipe.Cmds {
+		fields = append(fields, argFields(c.Args)...)
+	}
+	return fields
+}
+
+func argFields(args []parse.Node) []string {
+	var fields []string
+	for _, a := range args {
+		switch a := a.(type) {
+		case *parse.FieldNode, *parse.ChainNode:
+			fields = append(fields, a.String())
+		case *parse.PipeNode:
+			fields = append(fields, pipeFields(a)...)
+		}
+	}
+	return fields
+}
+
+func withGuards(guarded map[string]bool, fields []string) map[string]bool {
+	if len(fields) == 0 {
+		return guarded
+	}
+	m := make(map[string]bool, len(guarded)+len(fields))
+	for f := range guarded {
+		m[f] = true
+	}
+	for _, f := range fields {
+		m[f] = true
+	}
+	return m
+}
@@ -588,3 +588,81 @@ func TestMarshalIsIdempotent(t *testing.T) {
 	require.Equal(t, c, &composition)
 	require.Equal(t, uint(4), composition.Runs[1].TotalInstances)
 }
+
+func TestValidateMounts(t *testing.T) {
+	newComposition := func(mounts ...Mount) *Composition {
+		return &Composition{
+			Global: Global{
+				Plan:    "foo_plan",
+				Case:    "foo_case",
+				Builder: "docker:go",
+				Runner:  "local:docker",
+			},
+			Groups: []*Group{
+				{ID: "a", Instances: Instances{Count: 1}, Mounts: mounts},
+			},
+		}
+	}
+
+	c := newComposition(
+		Mount{Type: MountTypeVolume, Source: "state", Target: "/state"},
+		Mount{Type: MountTypeTmpfs, Target: "/scratch", Size: "512MiB"},
+		Mount{Type: MountTypeBind, Source: "/data", Target: "/data", ReadOnly: true},
+	).GenerateDefaultRun()
+	require.NoError(t, c.ValidateForRun())
+	require.Len(t, c.Runs[0].Groups[0].Mounts, 3)
+
+	for _, m := range [][]Mount{
+		{{Type: MountTypeVolume, Target: "/state"}},
+		{{Type: MountTypeVolume, Source: "state", Target: "state"}},
+		{{Type: MountTypeBind, Source: "data", Target: "/data"}},
+		{{Type: MountTypeVolume, Source: "state", Target: "/state", Size: "1GiB"}},
+		{{Type: MountTypeTmpfs, Target: "/scratch", Size: "-1"}},
+		{{Type: "nfs", Source: "server:/", Target: "/nfs"}},
+		{{Type: MountTypeTmpfs, Target: "/scratch"}, {Type: MountTypeTmpfs, Target: "/scratch/"}},
+	} {
+		c := newComposition(m...).GenerateDefaultRun()
+		require.Error(t, c.ValidateForRun(), m)
+	}
+}
+
+func TestValidateSecurity(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:    "foo_plan",
+			Case:    "foo_case",
+			Builder: "docker:go",
+			Runner:  "local:docker",
+		},
+		Groups: []*Group{
+			{ID: "a", Instances: Instances{Count: 1}, Security: Security{CapAdd: []string{"NET_ADMIN"}, Seccomp: SeccompUnconfined}},
+		},
+	}
+	c = c.GenerateDefaultRun()
+	require.NoError(t, c.ValidateForRun())
+	require.Equal(t, []string{"NET_ADMIN"}, c.Runs[0].Groups[0].Security.CapAdd)
+
+	c.Groups[0].Security.Seccomp = "permissive"
+	require.Error(t, c.ValidateForRun())
+}
+
+func TestValidatePlacement(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:    "foo_plan",
+			Case:    "foo_case",
+			Builder: "docker:go",
+			Runner:  "cluster:k8s",
+		},
+		Groups: []*Group{
+			{ID: "a", Instances: Instances{Count: 2}, Placement: Placement{AvoidGroups: []string{"b"}, InstancesPerNode: 2}},
+			{ID: "b", Instances: Instances{Count: 1}},
+		},
+	}
+	c = c.GenerateDefaultRun()
+	require.NoError(t, c.ValidateForRun())
+	require.Equal(t, 2, c.Runs[0].Groups[0].Placement.InstancesPerNode)
+
+	c.Runs[0].Groups[0].Placement.AvoidGroups = []string{"c"}
+	require.Error(t, c.ValidateForRun())
+}
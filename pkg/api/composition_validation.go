@@ -2,7 +2,9 @@ package api
 
 import (
 	"fmt"
+	"path"
 
+	"github.com/docker/go-units"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -29,6 +31,16 @@ func (gs Groups) Validate(c *Composition) error {
 		}
 	}
 
+	// Validate mounts
+	for _, g := range gs {
+		if err := validateMounts(g.Mounts); err != nil {
+			return fmt.Errorf("group %s has an invalid mount: %w", g.ID, err)
+		}
+		if err := g.Security.Validate(); err != nil {
+			return fmt.Errorf("group %s has an invalid security context: %w", g.ID, err)
+		}
+	}
+
 	return nil
 }
 
@@ -60,6 +72,18 @@ func (rs Runs) Validate(c *Composition) error {
 			}
 			m[x.ID] = true
 		}
+
+		for _, x := range r.Groups {
+			if err := validateMounts(x.Mounts); err != nil {
+				return fmt.Errorf("group %s:%s has an invalid mount: %w", r.ID, x.ID, err)
+			}
+			if err := x.Security.Validate(); err != nil {
+				return fmt.Errorf("group %s:%s has an invalid security context: %w", r.ID, x.ID, err)
+			}
+			if err := x.Placement.validate(r); err != nil {
+				return fmt.Errorf("group %s:%s has invalid placement constraints: %w", r.ID, x.ID, err)
+			}
+		}
 	}
 
 	// Recalculate instance counts
@@ -96,6 +120,27 @@ func (c *Composition) ValidateForRun() error {
 		return err
 	}
 
+	if len(c.Global.Thresholds) > 0 {
+		if c.Global.DisableMetrics {
+			return fmt.Errorf("thresholds can't be checked with disable_metrics set, as the run records no metrics")
+		}
+
+		groups := make(map[string]struct{}, len(c.Groups))
+		for _, g := range c.Groups {
+			groups[g.ID] = struct{}{}
+		}
+		for _, r := range c.Runs {
+			for _, g := range r.Groups {
+				groups[g.ID] = struct{}{}
+			}
+		}
+		for _, t := range c.Global.Thresholds {
+			if err := t.Validate(groups); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Validate groups.
 	if err := c.Groups.Validate(c); err != nil {
 		return err
@@ -121,3 +166,92 @@ func ValidateInstances(sl validator.StructLevel) {
 	sl.ReportError(instances.Count, "count", "Count", "count_or_percentage", "")
 	sl.ReportError(instances.Percentage, "percentage", "Percentage", "count_or_percentage", "")
 }
+
+// Validate validates that the security context is well-formed. Whether it
+// may be granted is up to the daemon.
+func (s Security) Validate() error {
+	for _, c := range s.Capabilities() {
+		if c == "" {
+			return fmt.Errorf("empty capability")
+		}
+	}
+
+	switch s.Seccomp {
+	case "", SeccompDefault, SeccompUnconfined:
+	default:
+		return fmt.Errorf("unknown seccomp profile %q; expected %q or %q", s.Seccomp, SeccompDefault, SeccompUnconfined)
+	}
+	return nil
+}
+
+// validate validates that the placement constraints of a group refer to
+// groups of the run.
+func (p Placement) validate(r *Run) error {
+	if p.InstancesPerNode < 0 {
+		return fmt.Errorf("negative number of instances per node")
+	}
+	for _, id := range p.AvoidGroups {
+		found := false
+		for _, g := range r.Groups {
+			found = found || g.ID == id
+		}
+		if !found {
+			return fmt.Errorf("avoided group %s is not part of the run", id)
+		}
+	}
+	return nil
+}
+
+// Validate validates that the mount is well-formed. Whether bind mounts are
+// allowed is up to runners.
+func (m Mount) Validate() error {
+	if !path.IsAbs(m.Target) {
+		return fmt.Errorf("target %q is not an absolute path", m.Target)
+	}
+
+	switch m.Type {
+	case MountTypeVolume, MountTypeBind:
+		if m.Source == "" {
+			return fmt.Errorf("%s mount at %s is missing a source", m.Type, m.Target)
+		}
+		if m.Type == MountTypeBind && !path.IsAbs(m.Source) {
+			return fmt.Errorf("bind mount source %q is not an absolute path", m.Source)
+		}
+		if m.Size != "" {
+			return fmt.Errorf("%s mount at %s can't have a size; only tmpfs mounts can", m.Type, m.Target)
+		}
+	case MountTypeTmpfs:
+		if _, err := m.SizeBytes(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type %q of mount at %s; expected %q, %q or %q", m.Type, m.Target, MountTypeVolume, MountTypeBind, MountTypeTmpfs)
+	}
+	return nil
+}
+
+// SizeBytes returns the size of a tmpfs mount in bytes, or 0 if unlimited.
+func (m Mount) SizeBytes() (int64, error) {
+	if m.Size == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(m.Size)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q of mount at %s", m.Size, m.Target)
+	}
+	return size, nil
+}
+
+func validateMounts(mounts []Mount) error {
+	targets := make(map[string]struct{}, len(mounts))
+	for _, m := range mounts {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		if _, ok := targets[path.Clean(m.Target)]; ok {
+			return fmt.Errorf("duplicate mount target %s", m.Target)
+		}
+		targets[path.Clean(m.Target)] = struct{}{}
+	}
+	return nil
+}
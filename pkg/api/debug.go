@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/testground/testground/pkg/config"
+)
+
+// Debugger is the interface to be implemented by a runner that gives access
+// to the live instances of its runs, so that wedged instances can be
+// inspected.
+type Debugger interface {
+	// DebugShell starts an interactive shell in an instance, and returns a
+	// stream attached to its terminal. The shell exits when the stream is
+	// closed.
+	DebugShell(ctx context.Context, in *DebugInput) (io.ReadWriteCloser, error)
+
+	// DebugDial opens a TCP connection to a port of an instance.
+	DebugDial(ctx context.Context, in *DebugInput, port int) (net.Conn, error)
+}
+
+// DebugInput identifies the instance of a run to debug.
+type DebugInput struct {
+	// EnvConfig is the env configuration of the engine. Not a pointer to force
+	// a copy.
+	EnvConfig config.EnvConfig
+	RunID     string
+
+	// RunnerConfig is the configuration of the runner, coalesced with the env
+	// configuration.
+	RunnerConfig interface{}
+
+	// GroupID is the group of the instance. It can be omitted when a single
+	// group of the run has an instance with the given index.
+	GroupID string
+
+	// Instance is the index of the instance within its group.
+	Instance int
+
+	// Rows and Cols are the initial size of the terminal of shells, if known.
+	Rows uint
+	Cols uint
+}
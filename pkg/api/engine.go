@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"io"
+	"os"
 	"time"
 
 	"github.com/testground/testground/pkg/config"
@@ -48,6 +49,9 @@ type TasksFilters struct {
 
 type Engine interface {
 	TasksManager
+	TaskScheduler
+	PlanRegistry
+	RunStore
 
 	BuilderByName(name string) (Builder, bool)
 	RunnerByName(name string) (Runner, bool)
@@ -55,13 +59,23 @@ type Engine interface {
 	ListBuilders() map[string]Builder
 	ListRunners() map[string]Runner
 
-	QueueBuild(request *BuildRequest, sources *UnpackedSources) (string, error)
-	QueueRun(request *RunRequest, sources *UnpackedSources) (string, error)
+	QueueBuild(ctx context.Context, request *BuildRequest, sources *UnpackedSources) (string, error)
+	QueueRun(ctx context.Context, request *RunRequest, sources *UnpackedSources) (string, error)
+	QueueTrigger(ctx context.Context, request *TriggerRequest, dir string) (string, error)
 
 	DoBuildPurge(ctx context.Context, builder, plan string, ow *rpc.OutputWriter) error
-	DoCollectOutputs(ctx context.Context, runID string, ow *rpc.OutputWriter) error
+	DoCollectOutputs(ctx context.Context, req *OutputsRequest, ow *rpc.OutputWriter) error
 	DoTerminate(ctx context.Context, ctype ComponentType, ref string, ow *rpc.OutputWriter) error
 	DoHealthcheck(ctx context.Context, runner string, fix bool, ow *rpc.OutputWriter) (*HealthcheckReport, error)
+	DoInfraUpgrade(ctx context.Context, runner string, ow *rpc.OutputWriter) (*HealthcheckReport, error)
+	DoDebug(ctx context.Context, req *DebugRequest) (io.ReadWriteCloser, error)
+	DoPauseRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error
+	DoResumeRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error
+	DoScaleRun(ctx context.Context, req *ScaleRunRequest, ow *rpc.OutputWriter) error
+
+	DescribeRun(runID string) (*RunRecord, error)
+	Stats(req *StatsRequest) ([]CaseStats, error)
+	SweepReport(sweep string) (*SweepReport, error)
 
 	EnvConfig() config.EnvConfig
 	Context() context.Context
@@ -70,7 +84,91 @@ type Engine interface {
 type TasksManager interface {
 	Tasks(filters TasksFilters) ([]task.Task, error)
 	GetTask(id string) (*task.Task, error)
+	EstimateTask(tsk *task.Task) (*task.Estimate, error)
 	Kill(taskId string) error
 	DeleteTask(taskId string) error
 	Logs(ctx context.Context, taskId string, follow bool, cancel bool, w io.Writer) (*task.Task, error)
+	BuildLogs(ctx context.Context, taskId string, follow bool, cancel bool, w io.Writer) (*task.Task, error)
+}
+
+// Events reported by remote workers about the tasks they process.
+const (
+	WorkerEventStarted  = "started"
+	WorkerEventProgress = "progress"
+	WorkerEventFinished = "finished"
+	// WorkerEventHeartbeat only checks whether the task has been killed.
+	WorkerEventHeartbeat = "heartbeat"
+)
+
+// WorkerLeaseHeader carries the token of the claim of a remote worker on a
+// task: the scheduler returns it with the claimed task, and the worker
+// presents it on its reports and logs.
+const WorkerLeaseHeader = "X-Testground-Lease"
+
+// WorkerUpdateResponse is the response to the report of a remote worker.
+type WorkerUpdateResponse struct {
+	Killed bool `json:"killed"`
+}
+
+// TaskScheduler shares the queue of a daemon with the workers of other
+// daemons, which claim tasks from it and report their progress back.
+type TaskScheduler interface {
+	// ClaimTask takes the next task off the queue, on behalf of a remote
+	// worker, and returns it with the token of the worker's lease on it. It
+	// returns nil if the queue is empty.
+	ClaimTask() (tsk *task.Task, lease string, err error)
+	// TaskSources writes the sources of a claimed task as a gzipped tarball.
+	TaskSources(taskID string, w io.Writer) error
+	// ReportTask records the state of a task processed by a remote worker
+	// holding the lease, and returns whether the task has been killed.
+	ReportTask(event string, lease string, tsk *task.Task) (killed bool, err error)
+	// AppendTaskLog appends the log output of a remote worker holding the
+	// lease to the log of a task.
+	AppendTaskLog(taskID string, lease string, r io.Reader) error
+}
+
+// RunStore is a key/value store scoped to each ongoing run, for dynamic
+// values that don't fit test params. Instances reach it through the daemon.
+type RunStore interface {
+	// RunValues returns the values stored for a run.
+	RunValues(runID string) (map[string]string, error)
+	// SetRunValue stores a value for a run.
+	SetRunValue(runID, key, value string) error
+	// RunStoreAccess returns whether token grants the instances of a run
+	// access to its store, and whether that access includes writes.
+	RunStoreAccess(runID, token string) (ok, write bool)
+	// AbortRun tears down an ongoing run at the request of one of its
+	// instances. Only the first abort of a run is recorded.
+	AbortRun(runID string, req *AbortRunRequest) error
+	// ClaimRole hands one of the roles of an ongoing run to an instance.
+	ClaimRole(runID string, req *ClaimRoleRequest) (*ClaimRoleResponse, error)
+	// PutRunObject stores an object in the object store of an ongoing run,
+	// replacing any object with the same key.
+	PutRunObject(runID, key string, r io.Reader) error
+	// OpenRunObject opens an object of the object store of an ongoing run.
+	OpenRunObject(runID, key string) (*os.File, error)
+}
+
+// PublishedPlan is a version of a test plan published to the plan registry.
+type PublishedPlan struct {
+	Name        string           `json:"name"`
+	Version     string           `json:"version"`
+	PublishedAt time.Time        `json:"published_at"`
+	PublishedBy CreatedBy        `json:"published_by"`
+	SourceHash  string           `json:"source_hash"`
+	Manifest    TestPlanManifest `json:"manifest"`
+}
+
+// PlanRegistry is the shared catalogue of versioned test plans of a daemon.
+// Compositions reference published plans as <name>@<version>.
+type PlanRegistry interface {
+	// PublishPlan publishes the plan in sources, under the name in its
+	// manifest. Published versions are immutable.
+	PublishPlan(request *PublishPlanRequest, sources *UnpackedSources) (*PublishedPlan, error)
+	// PublishedPlans lists the published versions of a plan, or of all plans
+	// if name is empty.
+	PublishedPlans(name string) ([]*PublishedPlan, error)
+	// PublishedPlan returns a published version of a plan; version can be
+	// "latest".
+	PublishedPlan(name, version string) (*PublishedPlan, error)
 }
@@ -14,6 +14,14 @@ type Healthchecker interface {
 	Healthcheck(ctx context.Context, engine Engine, ow *rpc.OutputWriter, fix bool) (*HealthcheckReport, error)
 }
 
+// InfraUpgrader is the interface to be implemented by a runner that manages
+// the versions of its infrastructure containers. Healthchecks only report
+// containers running other images than the ones pinned in the configuration;
+// UpgradeInfra replaces them, and reports it like a healthcheck with fixes.
+type InfraUpgrader interface {
+	UpgradeInfra(ctx context.Context, engine Engine, ow *rpc.OutputWriter) (*HealthcheckReport, error)
+}
+
 // HealthcheckStatus is an enum that represents
 type HealthcheckStatus string
 
@@ -32,6 +40,9 @@ var (
 	// HealthcheckStatusUnnecessary indicates that a check or fix was not
 	// needed.
 	HealthcheckStatusUnnecessary = HealthcheckStatus("unnecessary")
+	// HealthcheckStatusRolledBack indicates that a fix was applied, then
+	// undone because a later fix failed.
+	HealthcheckStatusRolledBack = HealthcheckStatus("rolled-back")
 )
 
 // HealthcheckItem represents an entry in a HealthcheckReport. It is used to
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultHookTimeout bounds the execution of hooks that don't set a timeout.
+const DefaultHookTimeout = 30 * time.Minute
+
+// Hooks are containers run by the daemon around the build and the run of a
+// test plan, so that the preparation and the analysis specific to a plan live
+// with the plan.
+type Hooks struct {
+	// PreBuild runs before every build of the plan, with the build context
+	// mounted at /src and the plan as working directory, at /src/plan. Files
+	// it writes there are part of the build; it failing fails the build.
+	PreBuild *Hook `toml:"pre_build"`
+
+	// PostRun runs over the outputs of every run of the plan, once it
+	// finished, mounted read-only at /outputs. Files it writes to /analysis
+	// (e.g. plots, summaries) are collected along with the outputs of the
+	// run. It failing doesn't fail the run.
+	PostRun *Hook `toml:"post_run"`
+}
+
+// Hook is a container run by the daemon.
+type Hook struct {
+	// Image is the image of the container.
+	Image string `toml:"image"`
+	// Command overrides the command of the image, if set.
+	Command []string `toml:"command"`
+	// Env is set on the container, in addition to the variables describing
+	// the plan, build or run the hook runs for.
+	Env map[string]string `toml:"env"`
+	// Timeout bounds the execution of the hook; it defaults to
+	// DefaultHookTimeout.
+	Timeout string `toml:"timeout"`
+}
+
+// Validate validates the hook.
+func (h *Hook) Validate() error {
+	if h.Image == "" {
+		return errors.New("hook has no image")
+	}
+	if _, err := h.ParseTimeout(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseTimeout returns the timeout of the hook.
+func (h *Hook) ParseTimeout() (time.Duration, error) {
+	if h.Timeout == "" {
+		return DefaultHookTimeout, nil
+	}
+	d, err := time.ParseDuration(h.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid hook timeout: %q", h.Timeout)
+	}
+	return d, nil
+}
+
+// EnvList returns the environment of the hook, with vars added to the
+// variables it declares, in the KEY=VALUE form, sorted. The variables the
+// hook declares take precedence.
+func (h *Hook) EnvList(vars map[string]string) []string {
+	env := make(map[string]string, len(vars)+len(h.Env))
+	for k, v := range vars {
+		env[k] = v
+	}
+	for k, v := range h.Env {
+		env[k] = v
+	}
+
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Validate validates the hooks declared.
+func (h Hooks) Validate() error {
+	if h.PreBuild != nil {
+		if err := h.PreBuild.Validate(); err != nil {
+			return fmt.Errorf("invalid pre-build hook: %w", err)
+		}
+	}
+	if h.PostRun != nil {
+		if err := h.PostRun.Validate(); err != nil {
+			return fmt.Errorf("invalid post-run hook: %w", err)
+		}
+	}
+	return nil
+}
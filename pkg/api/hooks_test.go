@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooksValidate(t *testing.T) {
+	require.NoError(t, Hooks{}.Validate())
+
+	hooks := Hooks{
+		PreBuild: &Hook{Image: "alpine:3.15", Command: []string{"./generate.sh"}},
+		PostRun:  &Hook{Image: "python:3.10", Timeout: "5m"},
+	}
+	require.NoError(t, hooks.Validate())
+
+	d, err := hooks.PreBuild.ParseTimeout()
+	require.NoError(t, err)
+	require.Equal(t, DefaultHookTimeout, d)
+	d, err = hooks.PostRun.ParseTimeout()
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, d)
+
+	hooks.PostRun.Timeout = "-1s"
+	require.Error(t, hooks.Validate())
+	hooks.PostRun.Timeout = ""
+	hooks.PreBuild.Image = ""
+	require.Error(t, hooks.Validate())
+}
+
+func TestHookEnvList(t *testing.T) {
+	hook := &Hook{Image: "python:3.10", Env: map[string]string{"PLOTS": "svg", "TEST_CASE": "override"}}
+	env := hook.EnvList(map[string]string{"TEST_PLAN": "network", "TEST_CASE": "ping-pong"})
+	require.Equal(t, []string{"PLOTS=svg", "TEST_CASE=override", "TEST_PLAN=network"}, env)
+}
@@ -2,12 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/testground/testground/pkg/config"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mitchellh/go-wordwrap"
 )
 
@@ -24,6 +29,10 @@ type TestPlanManifest struct {
 	//
 	// It's a mapping of builder => directories.
 	ExtraSources map[string][]string `toml:"extra_sources"`
+
+	// Hooks are containers run by the daemon before the builds and after the
+	// runs of the plan.
+	Hooks Hooks `toml:"hooks"`
 }
 
 // TestCase represents a configuration for a test case known by the system.
@@ -32,14 +41,150 @@ type TestCase struct {
 	Instances InstanceConstraints
 	// Parameters that can be passed to this test case.
 	Parameters map[string]Parameter `toml:"params"`
+	// Services are the services of the daemon the instances of this test
+	// case use, among ServiceAbort and ServiceObjects. Daemons that don't
+	// serve instances reject its runs, rather than failing them midway.
+	Services []string `toml:"services"`
 }
 
+const (
+	// ServiceAbort lets instances abort their run; see AbortURL.
+	ServiceAbort = "abort"
+	// ServiceObjects is the object store of runs; see ObjectsURL.
+	ServiceObjects = "objects"
+)
+
 // Parameter is metadata about a test case parameter.
 type Parameter struct {
 	Type        string
 	Description string `toml:"desc"`
 	Unit        string
 	Default     interface{}
+
+	// Enum, if set, restricts the parameter to these values.
+	Enum []interface{} `toml:"enum"`
+	// Min and Max bound the values of numeric parameters (int, float and
+	// size), inclusively.
+	Min interface{} `toml:"min"`
+	Max interface{} `toml:"max"`
+}
+
+// Coerce validates a value of this parameter against its declared type, enum
+// and range, and returns it in the form the SDK parses. Values of unknown
+// types are only checked against the enum.
+func (p Parameter) Coerce(v string) (string, error) {
+	// parameters without a value nor a default are passed as null.
+	if v == "null" && p.Default == nil {
+		return v, nil
+	}
+
+	var (
+		num *float64
+		err error
+		typ = strings.ToLower(p.Type)
+	)
+	switch {
+	case typ == "int" || typ == "integer":
+		var i int
+		if i, err = strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			v, num = strconv.Itoa(i), floatPtr(float64(i))
+		}
+	case typ == "float" || typ == "number":
+		var f float64
+		if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			v, num = strings.TrimSpace(v), floatPtr(f)
+		}
+	case typ == "bool" || typ == "boolean":
+		var b bool
+		if b, err = strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			v = strconv.FormatBool(b)
+		}
+	case typ == "size":
+		var n uint64
+		if n, err = humanize.ParseBytes(v); err == nil {
+			num = floatPtr(float64(n))
+		}
+	case typ == "duration":
+		_, err = time.ParseDuration(strings.TrimSpace(v))
+		v = strings.TrimSpace(v)
+	case typ == "json":
+		if !json.Valid([]byte(v)) {
+			err = errors.New("invalid json")
+		}
+	case strings.HasPrefix(typ, "[]"):
+		var a []interface{}
+		err = json.Unmarshal([]byte(v), &a)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid %s", v, p.Type)
+	}
+
+	if len(p.Enum) > 0 {
+		var allowed []string
+		for _, e := range p.Enum {
+			s, err := paramValueString(e)
+			if err != nil {
+				return "", err
+			}
+			allowed = append(allowed, s)
+		}
+		if !stringIn(v, allowed) {
+			return "", fmt.Errorf("%q is not one of %v", v, allowed)
+		}
+	}
+
+	if num != nil {
+		if min, ok := toFloat(p.Min); ok && *num < min {
+			return "", fmt.Errorf("%s is lower than the minimum, %v", v, p.Min)
+		}
+		if max, ok := toFloat(p.Max); ok && *num > max {
+			return "", fmt.Errorf("%s is greater than the maximum, %v", v, p.Max)
+		}
+	}
+	return v, nil
+}
+
+// paramValueString returns the string form of a parameter value from a
+// manifest, as passed to instances.
+func paramValueString(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		// sizes can be bounded in human form, e.g. "1MiB".
+		if b, err := humanize.ParseBytes(n); err == nil {
+			return float64(b), true
+		}
+	}
+	return 0, false
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func stringIn(s string, list []string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
 }
 
 // InstanceConstraints expresses how many instances this test case can run.
@@ -68,16 +213,11 @@ func (tp *TestPlanManifest) defaultParameters(testcaseName string) (map[string]s
 	// TODO: the typing system here is broken. Rethink.
 	defaultsTestParams := make(map[string]string, len(tc.Parameters))
 	for n, v := range tc.Parameters {
-		switch dv := v.Default.(type) {
-		case string:
-			defaultsTestParams[n] = dv
-		default:
-			data, err := json.Marshal(v.Default)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse test case parameter; ignoring; name=%s, value=%v, err=%w", n, v, err)
-			}
-			defaultsTestParams[n] = string(data)
+		dv, err := paramValueString(v.Default)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse test case parameter; ignoring; name=%s, value=%v, err=%w", n, v, err)
 		}
+		defaultsTestParams[n] = dv
 	}
 
 	return defaultsTestParams, nil
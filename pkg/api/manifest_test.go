@@ -22,3 +22,40 @@ func TestManifestHasBuilder(t *testing.T) {
 	require.False(t, m.HasBuilder("docker:rust"))
 	require.False(t, m.HasBuilder("anything"))
 }
+
+func TestParameterCoerce(t *testing.T) {
+	intp := Parameter{Type: "int", Default: int64(1), Min: int64(1), Max: int64(10)}
+	v, err := intp.Coerce(" 5 ")
+	require.NoError(t, err)
+	require.Equal(t, "5", v)
+
+	_, err = intp.Coerce("five")
+	require.Error(t, err)
+	_, err = intp.Coerce("11")
+	require.Error(t, err)
+
+	boolp := Parameter{Type: "bool"}
+	v, err = boolp.Coerce("True")
+	require.NoError(t, err)
+	require.Equal(t, "true", v)
+
+	sizep := Parameter{Type: "size", Default: "1KiB", Max: "1MiB"}
+	_, err = sizep.Coerce("512KiB")
+	require.NoError(t, err)
+	_, err = sizep.Coerce("2MiB")
+	require.Error(t, err)
+
+	enump := Parameter{Type: "string", Default: "tcp", Enum: []interface{}{"tcp", "quic"}}
+	_, err = enump.Coerce("quic")
+	require.NoError(t, err)
+	_, err = enump.Coerce("udp")
+	require.Error(t, err)
+
+	_, err = Parameter{Type: "json", Default: "{}"}.Coerce("{")
+	require.Error(t, err)
+
+	// unset parameters without a default are left alone.
+	v, err = Parameter{Type: "int"}.Coerce("null")
+	require.NoError(t, err)
+	require.Equal(t, "null", v)
+}
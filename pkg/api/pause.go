@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Pauser is the interface to be implemented by a runner that can suspend the
+// instances of an ongoing run, and resume them later on where they stopped.
+//
+// Only the instances are suspended. The infrastructure they share with other
+// runs, i.e. the sidecar and the sync service, keeps running, and so do the
+// network changes the sidecar applies on behalf of instances. Churn and infra
+// chaos are held until the run is resumed. cluster:k8s doesn't implement it.
+type Pauser interface {
+	// PauseRun suspends all the instances of a run. Pausing a paused run is a
+	// no-op.
+	PauseRun(ctx context.Context, in *PauseInput, ow *rpc.OutputWriter) error
+
+	// ResumeRun resumes all the suspended instances of a run.
+	ResumeRun(ctx context.Context, in *PauseInput, ow *rpc.OutputWriter) error
+}
+
+// PauseInput identifies the run to pause or resume.
+type PauseInput struct {
+	// EnvConfig is the env configuration of the engine. Not a pointer to force
+	// a copy.
+	EnvConfig config.EnvConfig
+	RunID     string
+
+	// RunnerConfig is the configuration of the runner, coalesced with the env
+	// configuration.
+	RunnerConfig interface{}
+}
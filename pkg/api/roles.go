@@ -0,0 +1,44 @@
+package api
+
+import "fmt"
+
+// Role is a role that instances of a run claim at startup, e.g. to decide
+// which of them bootstrap the network, instead of deriving it from their
+// sequence numbers.
+type Role struct {
+	Name string `toml:"name" json:"name"`
+	// Count is the number of instances that take the role.
+	Count int `toml:"count" json:"count"`
+}
+
+// Roles are the roles of a run, in the order they're handed out: the first
+// instances to claim a role take the first one, until its count is reached.
+type Roles []Role
+
+// Validate checks that roles have unique names and positive counts, and that
+// there are enough of them for the given number of instances.
+func (rs Roles) Validate(instances int) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(rs))
+	total := 0
+	for _, r := range rs {
+		if r.Name == "" {
+			return fmt.Errorf("role with no name")
+		}
+		if _, ok := seen[r.Name]; ok {
+			return fmt.Errorf("role names not unique; found duplicate: %s", r.Name)
+		}
+		seen[r.Name] = struct{}{}
+		if r.Count <= 0 {
+			return fmt.Errorf("invalid count of role %s: %d", r.Name, r.Count)
+		}
+		total += r.Count
+	}
+	if total < instances {
+		return fmt.Errorf("roles cover %d instances, but the run has %d", total, instances)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolesValidate(t *testing.T) {
+	var rs Roles
+	require.NoError(t, rs.Validate(10))
+
+	rs = Roles{{Name: "bootstrapper", Count: 5}, {Name: "provider", Count: 50}, {Name: "seeker", Count: 445}}
+	require.NoError(t, rs.Validate(500))
+	require.Error(t, rs.Validate(501))
+
+	rs = Roles{{Name: "seeker", Count: 5}, {Name: "seeker", Count: 5}}
+	require.Error(t, rs.Validate(10))
+
+	rs = Roles{{Name: "seeker", Count: 0}}
+	require.Error(t, rs.Validate(0))
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/testground/testground/pkg/task"
 )
@@ -21,6 +22,13 @@ type BuildRequest struct {
 	Composition Composition      `json:"composition"`
 	Manifest    TestPlanManifest `json:"manifest"`
 	CreatedBy   CreatedBy        `json:"created_by"`
+
+	// SourceHash, if set, is the source hash the build sources are expected
+	// to have; the build fails if they differ.
+	SourceHash string `json:"source_hash,omitempty"`
+
+	// NotifyURL, if set, receives a JSON notification when the task ends.
+	NotifyURL string `json:"notify_url,omitempty"`
 }
 
 // RunRequest is the request struct for the `run` function.
@@ -31,6 +39,21 @@ type RunRequest struct {
 	Composition Composition      `json:"composition"`
 	Manifest    TestPlanManifest `json:"manifest"`
 	CreatedBy   CreatedBy        `json:"created_by"`
+
+	// SourceHash, if set, is the source hash the sources of the groups being
+	// built are expected to have; the build fails if they differ.
+	SourceHash string `json:"source_hash,omitempty"`
+
+	// ArtifactDigests, if set, pins artifacts to their digest, indexed by
+	// artifact path; the run fails if an artifact no longer matches.
+	ArtifactDigests map[string]string `json:"artifact_digests,omitempty"`
+
+	// NotifyURL, if set, receives a JSON notification when the task ends.
+	NotifyURL string `json:"notify_url,omitempty"`
+
+	// Sweep, if set, links the run to the other runs of the same sweep, see
+	// SweepReport.
+	Sweep string `json:"sweep,omitempty"`
 }
 
 type CreatedBy task.CreatedBy
@@ -38,6 +61,34 @@ type CreatedBy task.CreatedBy
 type OutputsRequest struct {
 	Runner string `json:"runner"`
 	RunID  string `json:"run_id"`
+	// Dedup stores identical output files once in the archive.
+	Dedup bool `json:"dedup,omitempty"`
+	// Filter restricts the outputs collected, if set.
+	Filter *OutputsFilter `json:"filter,omitempty"`
+	// Preview reports the number and size of the files that would be
+	// collected, without collecting them.
+	Preview bool `json:"preview,omitempty"`
+	// Compression is the format the archive is compressed with, gzip or
+	// zstd (default: gzip), at CompressionLevel, from 1, the fastest, to 9,
+	// the smallest (default: that of the format).
+	Compression      string `json:"compression,omitempty"`
+	CompressionLevel int    `json:"compression_level,omitempty"`
+}
+
+// OutputsFilter selects the output files of a run to collect. Files must pass
+// every criterion that is set.
+type OutputsFilter struct {
+	// Groups are the groups whose outputs are collected. Files of the run
+	// that belong to no instance are left out when set.
+	Groups []string `json:"groups,omitempty"`
+	// Instances are the sequence numbers of the instances of each group
+	// whose outputs are collected, as ranges, e.g. "0-4,7".
+	Instances string `json:"instances,omitempty"`
+	// Globs are patterns of the paths of the files collected, relative to
+	// the outputs directory of their instance, or to that of the run for
+	// files that belong to no instance, e.g. "metrics/*". A pattern that
+	// matches a directory selects all the files under it.
+	Globs []string `json:"globs,omitempty"`
 }
 
 type TerminateRequest struct {
@@ -50,6 +101,12 @@ type HealthcheckRequest struct {
 	Fix    bool   `json:"fix"`
 }
 
+// InfraUpgradeRequest asks for the infrastructure containers of a runner to
+// be upgraded to the images pinned in the configuration of the daemon.
+type InfraUpgradeRequest struct {
+	Runner string `json:"runner"`
+}
+
 type BuildPurgeRequest struct {
 	Builder  string `json:"builder"`
 	Testplan string `json:"testplan"`
@@ -61,13 +118,140 @@ type StatusRequest struct {
 	TaskID string `json:"task_id"`
 }
 
+type DescribeRunRequest struct {
+	RunID string `json:"run_id"`
+}
+
+// StatsRequest requests statistics on the runs that completed since a point
+// in time, optionally of a single test plan or test case.
+type StatsRequest struct {
+	TestPlan string    `json:"plan,omitempty"`
+	TestCase string    `json:"case,omitempty"`
+	Since    time.Time `json:"since"`
+	// Window is the width of the windows of the trends; the whole span is a
+	// single window if zero.
+	Window time.Duration `json:"window"`
+	// Metrics are the names of metrics recorded by the runs on the results
+	// stream, whose values are aggregated by window too.
+	Metrics []string `json:"metrics,omitempty"`
+}
+
+// SweepReportRequest requests the report of a sweep.
+type SweepReportRequest struct {
+	Sweep string `json:"sweep"`
+}
+
+// TriggerRequest requests the daemon to check out a test plan from a GitHub
+// repository, render a composition from it, and build and run it.
+type TriggerRequest struct {
+	// Repo is the repository, in owner/name form.
+	Repo string `json:"repo"`
+	// Ref is the commit, branch or tag to check out.
+	Ref string `json:"ref"`
+	// Branch is the branch that triggered the run, if any.
+	Branch string `json:"branch,omitempty"`
+	// Plan is the directory of the test plan in the repository.
+	Plan string `json:"plan"`
+	// Composition is the path of the composition template in the repository.
+	Composition string `json:"composition"`
+	// RunID is the composition run to execute; it can be omitted if the
+	// composition contains a single run.
+	RunID string `json:"run_id,omitempty"`
+	// Env is made available to the composition template, in addition to the
+	// GITHUB_REPOSITORY, GITHUB_SHA and GITHUB_REF_NAME variables.
+	Env map[string]string `json:"env,omitempty"`
+
+	User      string `json:"user,omitempty"`
+	Priority  int    `json:"priority"`
+	NotifyURL string `json:"notify_url,omitempty"`
+}
+
+// PublishPlanRequest publishes the uploaded test plan to the plan registry of
+// the daemon, under the name in its manifest and the supplied version.
+type PublishPlanRequest struct {
+	Version   string    `json:"version"`
+	CreatedBy CreatedBy `json:"created_by"`
+}
+
+// PlansRequest lists the plans published to the plan registry; all of them,
+// or the versions of Plan.
+type PlansRequest struct {
+	Plan string `json:"plan,omitempty"`
+}
+
+// PlanInfoRequest describes a version of a published plan. Version can be
+// "latest".
+type PlanInfoRequest struct {
+	Plan    string `json:"plan"`
+	Version string `json:"version"`
+}
+
+// SetRunValueRequest sets a value in the key/value store of an ongoing run.
+type SetRunValueRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// AbortRunRequest tears down an ongoing run on behalf of one of its
+// instances, recording the reason in the result of its task. Instances send
+// it through runenv.Abort.
+type AbortRunRequest struct {
+	GroupID  string `json:"group_id,omitempty"`
+	Instance int    `json:"instance"`
+	Reason   string `json:"reason"`
+}
+
+// ClaimRoleRequest claims one of the roles of a run for an instance, which is
+// identified by its group and sequence number within the group. Claims are
+// idempotent: an instance that claims again gets the same role. Instances send
+// it through the SDK at startup.
+type ClaimRoleRequest struct {
+	GroupID  string `json:"group_id"`
+	Instance int    `json:"instance"`
+}
+
+// DebugRequest attaches to a live instance of a run: to a shell started in
+// it, or to one of its ports if Port is set.
+type DebugRequest struct {
+	RunID string `json:"run_id"`
+	// Group is the group of the instance, and Instance its index in the
+	// group. Group can be omitted if the index is unambiguous.
+	Group    string `json:"group,omitempty"`
+	Instance int    `json:"instance"`
+	Port     int    `json:"port,omitempty"`
+	// Rows and Cols are the size of the terminal of the shell.
+	Rows uint `json:"rows,omitempty"`
+	Cols uint `json:"cols,omitempty"`
+}
+
+// PauseRunRequest pauses or resumes the instances of an ongoing run.
+type PauseRunRequest struct {
+	RunID string `json:"run_id"`
+}
+
+// ScaleRunRequest resizes a group of an ongoing run to Instances.
+type ScaleRunRequest struct {
+	RunID     string `json:"run_id"`
+	Group     string `json:"group"`
+	Instances int    `json:"instances"`
+}
+
 type CancelRequest struct {
 	TaskID string `json:"task_id"`
 }
 
+// Phases of a task whose logs can be requested separately.
+const (
+	// LogsPhaseBuild selects the complete builder output of a task.
+	LogsPhaseBuild = "build"
+)
+
 type LogsRequest struct {
 	TaskID string `json:"task_id"`
 	Follow bool   `json:"follow"`
+	// Phase selects the logs of a single phase of the task, e.g.
+	// LogsPhaseBuild. When empty, the full task log is returned.
+	Phase string `json:"phase,omitempty"`
 	// CancelWithContext indicates if the task should be cancelled
 	// on context cancellation.
 	CancelWithContext bool `json:"cancel_with_context"`
@@ -92,3 +276,50 @@ type HealthcheckResponse = HealthcheckReport
 type StatusResponse = task.Task
 
 type LogsResponse = task.Task
+
+type DescribeRunResponse = RunRecord
+
+type StatsResponse = []CaseStats
+
+type SweepReportResponse = SweepReport
+
+type PublishPlanResponse = PublishedPlan
+
+type PlansResponse = []PublishedPlan
+
+type PlanInfoResponse = PublishedPlan
+
+type DatasetsResponse = []Dataset
+
+// ClaimRoleResponse is the role claimed by an instance.
+type ClaimRoleResponse struct {
+	Role string `json:"role"`
+}
+
+// TimeResponse is the time of the daemon, against which instances measure the
+// offset of their clock the way NTP does.
+type TimeResponse struct {
+	// Received is when the daemon received the request, and Sent when it
+	// sent the response.
+	Received time.Time `json:"received"`
+	Sent     time.Time `json:"sent"`
+}
+
+// ClockOffset returns the offset of the clock of the daemon against the local
+// clock, and the round-trip delay of the exchange, given when the request was
+// sent and the response received on the local clock.
+func (r *TimeResponse) ClockOffset(sent, received time.Time) (offset, delay time.Duration) {
+	offset = (r.Received.Sub(sent) + r.Sent.Sub(received)) / 2
+	delay = received.Sub(sent) - r.Sent.Sub(r.Received)
+	return offset, delay
+}
+
+// Dataset describes a dataset served to test instances by the daemon.
+type Dataset struct {
+	Name string `json:"name"`
+	// Source is the URL the dataset is fetched from, if any.
+	Source string `json:"source,omitempty"`
+	// Cached is whether the dataset is available locally, and Size its size.
+	Cached bool  `json:"cached"`
+	Size   int64 `json:"size,omitempty"`
+}
@@ -2,10 +2,13 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
 )
 
 // Runner is the interface to be implemented by all runners. A runner takes a
@@ -58,8 +61,107 @@ type RunInput struct {
 	// DisableMetrics disables metrics batching.
 	DisableMetrics bool
 
+	// Seed seeds the randomness of the instances, and of the runner.
+	Seed int64
+
 	// Groups enumerates the groups participating in this run.
 	Groups []*RunGroup
+
+	// StartDelays are the delays after which runners start each instance,
+	// relative to the start of the first one. Instances are ordered by group,
+	// then by their index within the group. Empty if instances are not
+	// staggered.
+	StartDelays []time.Duration
+
+	// Store is how instances reach the key/value store of the run; nil if
+	// the store is not exposed to instances.
+	Store *RunStoreEndpoint
+
+	// AttachTo is the ID of an ongoing run whose network the instances join,
+	// if any.
+	AttachTo string
+
+	// Snapshot is the snapshot the state of the instances is saved to, or
+	// restored from; nil if none.
+	Snapshot *Snapshot
+
+	// Phases is notified as the run goes through its phases; nil if they're
+	// not being tracked.
+	Phases PhaseReporter
+}
+
+// Attacher is the interface to be implemented by a runner whose runs can
+// attach to the network of another of its ongoing runs.
+type Attacher interface {
+	// CheckAttach returns an error if runs can't attach to the given run,
+	// e.g. because its network is gone.
+	CheckAttach(ctx context.Context, runID string) error
+}
+
+// PhaseReporter records the phases a run goes through, so that they're visible
+// in the state of its task.
+type PhaseReporter interface {
+	// EnterPhase ends the current phase of the run, and starts the supplied
+	// one.
+	EnterPhase(phase task.Phase)
+}
+
+// RunStoreEndpoint is where, and with which tokens, the instances of a run
+// access its key/value store.
+type RunStoreEndpoint struct {
+	// URL is the URL of the store of the run.
+	URL string
+	// ReadToken is handed to every instance, and WriteToken to the instances
+	// of WriterGroup only.
+	ReadToken   string
+	WriteToken  string
+	WriterGroup string
+	// DatasetsURL is the URL datasets are fetched from, with either token.
+	DatasetsURL string
+	// ClockURL is the URL instances measure the offset of their clock
+	// against, see TimeResponse.
+	ClockURL string
+	// AbortURL is the URL instances POST an AbortRunRequest to, with either
+	// token, to tear down the whole run.
+	AbortURL string
+	// RolesURL is the URL instances POST a ClaimRoleRequest to, with either
+	// token, to claim one of the roles of the run.
+	RolesURL string
+	// ObjectsURL is the URL under which instances PUT and GET the objects
+	// of the run by key, with either token, to exchange data too bulky for
+	// the sync service. Objects are discarded when the run ends.
+	ObjectsURL string
+}
+
+// RunAbort records why an instance aborted its run.
+type RunAbort struct {
+	GroupID  string `json:"group_id,omitempty" mapstructure:"group_id"`
+	Instance int    `json:"instance"`
+	Reason   string `json:"reason"`
+}
+
+func (a *RunAbort) String() string {
+	if a.GroupID == "" {
+		return fmt.Sprintf("run aborted by instance %d: %s", a.Instance, a.Reason)
+	}
+	return fmt.Sprintf("run aborted by instance %d of group %s: %s", a.Instance, a.GroupID, a.Reason)
+}
+
+// StartDelay returns the delay after which to start the i-th instance of the
+// run.
+func (r *RunInput) StartDelay(i int) time.Duration {
+	if i < len(r.StartDelays) {
+		return r.StartDelays[i]
+	}
+	return 0
+}
+
+// EnterPhase reports that the run has entered the supplied phase, if phases
+// are being tracked.
+func (r *RunInput) EnterPhase(phase task.Phase) {
+	if r.Phases != nil {
+		r.Phases.EnterPhase(phase)
+	}
 }
 
 type RunGroup struct {
@@ -72,6 +174,16 @@ type RunGroup struct {
 	// Resources for per instance in this group
 	Resources Resources
 
+	// Mounts are the filesystems mounted into each instance in this group.
+	Mounts []Mount
+
+	// Security is the security context of each instance in this group.
+	Security Security
+
+	// Placement constrains the nodes the instances of this group are
+	// scheduled on.
+	Placement Placement
+
 	// ArtifactPath can be a docker image ID or an executable path; it's
 	// runner-dependent.
 	ArtifactPath string
@@ -101,6 +213,60 @@ type RunOutput struct {
 	Result interface{}
 }
 
+// RunRecord is an immutable record of everything that went into a run, kept
+// so that its results can be audited and reproduced long after the fact.
+type RunRecord struct {
+	RunID string `json:"run_id"`
+
+	// Composition is the fully rendered composition the run was scheduled
+	// with.
+	Composition Composition `json:"composition"`
+
+	// CompositionRun is the ID of the composition run that was executed.
+	CompositionRun string `json:"composition_run"`
+
+	// Runner is the ID of the runner, and RunnerConfig its coalesced
+	// configuration.
+	Runner       string      `json:"runner"`
+	RunnerConfig interface{} `json:"runner_config"`
+
+	// Artifacts are the artifacts of the run, indexed by group ID.
+	Artifacts map[string]RecordedArtifact `json:"artifacts"`
+
+	DaemonVersion string    `json:"daemon_version"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Placement is where each instance of the run was scheduled. It is only
+	// known once the run is done, so it is kept next to the record, outside
+	// of its signature.
+	Placement []InstancePlacement `json:"placement,omitempty"`
+}
+
+// InstancePlacement is where an instance of a run was scheduled.
+type InstancePlacement struct {
+	Group    string `json:"group"`
+	Instance int    `json:"instance"`
+
+	// Host is the docker host, or the kubernetes node, the instance ran on.
+	Host string `json:"host"`
+
+	// Zone is the availability zone of the host, when known.
+	Zone string `json:"zone,omitempty"`
+}
+
+// RecordedArtifact is an artifact of a run, resolved to its digest.
+type RecordedArtifact struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+
+	// SDKVersion is the version of the sdk-go module the artifact was built
+	// against, when known.
+	SDKVersion string `json:"sdk_version,omitempty"`
+
+	// Provenance is the provenance record of the artifact, when one exists.
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
 type CollectionInput struct {
 	// EnvConfig is the env configuration of the engine. Not a pointer to force
 	// a copy.
@@ -111,6 +277,20 @@ type CollectionInput struct {
 	// RunnerConfig is the configuration of the runner sourced from the test
 	// plan manifest, coalesced with any user-provided overrides.
 	RunnerConfig interface{}
+
+	// Dedup stores the contents of identical output files once in the
+	// archive; see runner.RehydrateOutputs.
+	Dedup bool
+
+	// Filter restricts the outputs collected, if set, and Preview reports
+	// what would be collected instead of collecting it.
+	Filter  *OutputsFilter
+	Preview bool
+
+	// Compression and CompressionLevel select how the archive is compressed;
+	// see OutputsRequest.
+	Compression      string
+	CompressionLevel int
 }
 
 // Terminatable is the interface to be implemented by a runner that can be
@@ -118,3 +298,17 @@ type CollectionInput struct {
 type Terminatable interface {
 	TerminateAll(context.Context, *rpc.OutputWriter) error
 }
+
+// Reconciler is the interface to be implemented by a runner that can clean up
+// the resources of a run it lost track of, e.g. a run interrupted by a restart
+// of the daemon.
+type Reconciler interface {
+	CleanupRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error
+}
+
+// OutputsLocator is the interface to be implemented by a runner that keeps the
+// outputs of runs on the disk of the daemon, so that they can be archived.
+type OutputsLocator interface {
+	// RunOutputsDir returns the directory holding the outputs of a run.
+	RunOutputsDir(cfg *config.EnvConfig, plan, runID string) string
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Scaler is the interface to be implemented by a runner that can resize the
+// groups of an ongoing run.
+type Scaler interface {
+	// ScaleGroup resizes a group of a run. New instances take the sequence
+	// numbers that follow those of the group, and the instances with the
+	// highest sequence numbers are the ones removed. The outcomes of removed
+	// instances don't count.
+	ScaleGroup(ctx context.Context, in *ScaleInput, ow *rpc.OutputWriter) error
+}
+
+// ScaleInput identifies the group of a run to resize.
+type ScaleInput struct {
+	// EnvConfig is the env configuration of the engine. Not a pointer to force
+	// a copy.
+	EnvConfig config.EnvConfig
+	RunID     string
+
+	// RunnerConfig is the configuration of the runner, coalesced with the env
+	// configuration.
+	RunnerConfig interface{}
+
+	// Group is resized to Instances.
+	Group     string
+	Instances int
+}
+
+// ScaleEvent is broadcast to the instances of a run on the sync service when
+// one of its groups is resized.
+type ScaleEvent struct {
+	Group string `json:"group"`
+	// Instances is the new size of the group, and TotalInstances the new
+	// number of instances of the run.
+	Instances      int `json:"instances"`
+	TotalInstances int `json:"total_instances"`
+}
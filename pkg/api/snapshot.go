@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/testground/testground/pkg/config"
+)
+
+// Snapshot saves and restores the state of the instances of a run, e.g. that
+// of a bootstrapped network, so that later runs can start from it instead of
+// bootstrapping again.
+//
+// Snapshots are app-level: every instance gets a directory, in which it
+// exports its state once it reaches its checkpoint, and from which it imports
+// it when the run restores a snapshot. Instances find the directory through
+// the TEST_SNAPSHOT_PATH environment variable, and TEST_SNAPSHOT_RESTORED is
+// set when it holds a restored state.
+type Snapshot struct {
+	// Save is the name under which the state of the instances is saved when
+	// the run succeeds, replacing any previous snapshot of that name.
+	Save string `toml:"save" json:"save"`
+
+	// Restore is the name of the snapshot restored into the instances before
+	// they start. The instances of the run are matched to those of the
+	// snapshot by group and sequence number.
+	Restore string `toml:"restore" json:"restore"`
+}
+
+var snapshotName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Validate checks the names of the snapshots, which are used as directory
+// names.
+func (s *Snapshot) Validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, name := range []string{s.Save, s.Restore} {
+		if name != "" && !snapshotName.MatchString(name) {
+			return fmt.Errorf("invalid snapshot name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Snapshotter is the interface to be implemented by a runner that can save
+// and restore the state of instances.
+type Snapshotter interface {
+	// CheckSnapshot returns an error if the runner can't honor a snapshot,
+	// e.g. because the snapshot to restore doesn't exist.
+	CheckSnapshot(env *config.EnvConfig, s *Snapshot) error
+}
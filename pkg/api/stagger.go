@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stagger modes.
+const (
+	// StaggerLinear starts instances at a constant rate, the last one after
+	// Duration.
+	StaggerLinear = "linear"
+	// StaggerBatch starts BatchSize instances every Interval.
+	StaggerBatch = "batch"
+	// StaggerCurve starts instances following a custom ramp-up Curve.
+	StaggerCurve = "curve"
+)
+
+// Stagger describes how the start of the instances of a run is spread over
+// time, e.g. to study join dynamics, or to spare the sync service a thundering
+// herd when the run starts.
+type Stagger struct {
+	// Mode is one of "linear", "batch" or "curve".
+	Mode string `toml:"mode" json:"mode"`
+
+	// Duration is the time it takes a linear ramp to start all instances.
+	Duration string `toml:"duration" json:"duration"`
+
+	// BatchSize instances are started every Interval by batch ramps.
+	BatchSize int    `toml:"batch_size" json:"batch_size"`
+	Interval  string `toml:"interval" json:"interval"`
+
+	// Curve is the ramp of curve mode, as points of the form
+	// "<percentage>@<offset>"; e.g. ["10%@0s", "50%@30s", "100%@60s"] starts
+	// a tenth of the instances immediately, and half of them within 30s. Start
+	// times between two points are interpolated linearly. The last point must
+	// be at 100%.
+	Curve []string `toml:"curve" json:"curve"`
+}
+
+// StartDelays calculates the delays after which each of n instances is
+// started. It returns nil if the stagger is nil.
+func (s *Stagger) StartDelays(n int) ([]time.Duration, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	delays := make([]time.Duration, n)
+	switch s.Mode {
+	case StaggerLinear:
+		d, err := time.ParseDuration(s.Duration)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid stagger duration: %q", s.Duration)
+		}
+		for i := 1; i < n; i++ {
+			delays[i] = time.Duration(int64(d) * int64(i) / int64(n-1))
+		}
+
+	case StaggerBatch:
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid stagger interval: %q", s.Interval)
+		}
+		if s.BatchSize <= 0 {
+			return nil, fmt.Errorf("invalid stagger batch size: %d", s.BatchSize)
+		}
+		for i := range delays {
+			delays[i] = d * time.Duration(i/s.BatchSize)
+		}
+
+	case StaggerCurve:
+		points, err := parseStaggerCurve(s.Curve)
+		if err != nil {
+			return nil, err
+		}
+		for i := range delays {
+			delays[i] = points.at(100 * float64(i+1) / float64(n))
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown stagger mode: %q; expected linear, batch or curve", s.Mode)
+	}
+	return delays, nil
+}
+
+type staggerPoint struct {
+	percentage float64
+	offset     time.Duration
+}
+
+type staggerCurve []staggerPoint
+
+func parseStaggerCurve(curve []string) (staggerCurve, error) {
+	if len(curve) == 0 {
+		return nil, fmt.Errorf("stagger curve has no points")
+	}
+
+	var (
+		points = staggerCurve{{}}
+		prev   = points[0]
+	)
+	for _, c := range curve {
+		parts := strings.SplitN(c, "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stagger curve point %q; expected <percentage>@<offset>", c)
+		}
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[0]), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentage in stagger curve point %q", c)
+		}
+		off, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in stagger curve point %q", c)
+		}
+		if pct <= prev.percentage || pct > 100 || off < prev.offset {
+			return nil, fmt.Errorf("stagger curve point %q out of order; percentages and offsets must increase", c)
+		}
+		prev = staggerPoint{percentage: pct, offset: off}
+		points = append(points, prev)
+	}
+	if prev.percentage != 100 {
+		return nil, fmt.Errorf("stagger curve must end at 100%%")
+	}
+	return points, nil
+}
+
+// at interpolates the offset at which the given percentage of instances has
+// started.
+func (c staggerCurve) at(pct float64) time.Duration {
+	for i := 1; i < len(c); i++ {
+		a, b := c[i-1], c[i]
+		if pct <= b.percentage {
+			frac := (pct - a.percentage) / (b.percentage - a.percentage)
+			return a.offset + time.Duration(frac*float64(b.offset-a.offset))
+		}
+	}
+	return c[len(c)-1].offset
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaggerStartDelays(t *testing.T) {
+	var s *Stagger
+	delays, err := s.StartDelays(3)
+	require.NoError(t, err)
+	require.Nil(t, delays)
+
+	s = &Stagger{Mode: StaggerLinear, Duration: "10s"}
+	delays, err = s.StartDelays(3)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{0, 5 * time.Second, 10 * time.Second}, delays)
+
+	s = &Stagger{Mode: StaggerBatch, BatchSize: 2, Interval: "1m"}
+	delays, err = s.StartDelays(5)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{0, 0, time.Minute, time.Minute, 2 * time.Minute}, delays)
+
+	s = &Stagger{Mode: StaggerCurve, Curve: []string{"50%@0s", "100%@10s"}}
+	delays, err = s.StartDelays(4)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{0, 0, 5 * time.Second, 10 * time.Second}, delays)
+}
+
+func TestStaggerInvalid(t *testing.T) {
+	for _, s := range []*Stagger{
+		{Mode: "exponential"},
+		{Mode: StaggerLinear},
+		{Mode: StaggerBatch, Interval: "1s"},
+		{Mode: StaggerCurve},
+		{Mode: StaggerCurve, Curve: []string{"50%@10s"}},
+		{Mode: StaggerCurve, Curve: []string{"50%@10s", "100%@5s"}},
+		{Mode: StaggerCurve, Curve: []string{"100%"}},
+	} {
+		_, err := s.StartDelays(10)
+		require.Error(t, err, "mode %s", s.Mode)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import "time"
+
+// CaseStats summarizes the runs of a test case that completed over a span of
+// time, and how they trend across the windows of that span.
+type CaseStats struct {
+	Plan    string      `json:"plan"`
+	Case    string      `json:"case"`
+	Summary WindowStats `json:"summary"`
+	// Trend breaks the span down into consecutive windows, oldest first.
+	// Windows without runs are included, so that gaps are visible.
+	Trend []WindowStats `json:"trend"`
+}
+
+// WindowStats are the statistics of the runs of a test case that completed
+// within a window of time.
+type WindowStats struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Runs      int `json:"runs"`
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+	Canceled  int `json:"canceled"`
+	// PassRate is the fraction of the runs that weren't canceled which
+	// succeeded.
+	PassRate float64 `json:"pass_rate"`
+
+	// The durations are the times runs spent processing, including builds.
+	MeanDuration   time.Duration `json:"mean_duration"`
+	MedianDuration time.Duration `json:"median_duration"`
+	P95Duration    time.Duration `json:"p95_duration"`
+
+	// Instances is the total number of instances of the runs, and
+	// InstancePassRate the fraction of them that reported success.
+	Instances        int     `json:"instances"`
+	InstancePassRate float64 `json:"instance_pass_rate"`
+	// Crashes is the number of instances that crashed or were killed.
+	Crashes int `json:"crashes"`
+
+	// Metrics aggregate the values of the requested metrics, in the order
+	// they were requested.
+	Metrics []MetricStats `json:"metrics,omitempty"`
+}
+
+// MetricStats aggregates the values a metric took in the runs of a window,
+// across their groups.
+type MetricStats struct {
+	Metric string `json:"metric"`
+	// Runs is the number of runs that recorded the metric, and Count the
+	// number of values they recorded.
+	Runs  int     `json:"runs"`
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	// P95 is the mean of the 95th percentiles of the groups of the runs.
+	P95 float64 `json:"p95"`
+}
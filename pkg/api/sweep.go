@@ -0,0 +1,51 @@
+package api
+
+import (
+	"time"
+
+	"github.com/testground/testground/pkg/task"
+)
+
+// SweepReport joins the runs of a sweep: the runs of a composition, each with
+// its own test parameters, submitted together under the same sweep ID.
+type SweepReport struct {
+	ID   string `json:"id"`
+	Plan string `json:"plan"`
+	Case string `json:"case"`
+	// Runs are the runs of the sweep, in the order they were queued.
+	Runs []SweepRun `json:"runs"`
+}
+
+// SweepRun is the outcome of a run of a sweep, for its parameter combination.
+type SweepRun struct {
+	// RunID is the ID of the run in the composition, and TaskID the ID of
+	// the task that ran it.
+	RunID  string `json:"run_id"`
+	TaskID string `json:"task_id"`
+
+	// Params are the test parameters of the run; those of a single group
+	// are prefixed with the ID of the group, e.g. "peers.latency".
+	Params map[string]string `json:"params"`
+
+	State   task.State   `json:"state"`
+	Outcome task.Outcome `json:"outcome,omitempty"`
+	Error   string       `json:"error,omitempty"`
+
+	Instances   int           `json:"instances"`
+	InstancesOk int           `json:"instances_ok"`
+	Duration    time.Duration `json:"duration"`
+
+	// Metrics are the measurements the run recorded on the results stream,
+	// aggregated by group.
+	Metrics []SweepMetric `json:"metrics,omitempty"`
+}
+
+// SweepMetric aggregates the values of a measurement recorded by a group of a
+// run.
+type SweepMetric struct {
+	Metric string  `json:"metric"`
+	Group  string  `json:"group"`
+	Count  int64   `json:"count"`
+	Mean   float64 `json:"mean"`
+	P95    float64 `json:"p95"`
+}
@@ -0,0 +1,90 @@
+package api
+
+import "fmt"
+
+// Statistics of the values of a measurement that thresholds can bound.
+const (
+	StatCount = "count"
+	StatMean  = "mean"
+	StatMin   = "min"
+	StatMax   = "max"
+	StatP95   = "p95"
+)
+
+// Threshold is a performance gate of a composition: once a run completes, a
+// statistic of a measurement it recorded on the results stream, aggregated
+// over each group, is compared to a baseline. The run fails if the statistic
+// is above Max times the baseline, or below Min times the baseline.
+//
+// The baseline is either a fixed value, Baseline, or the same statistic as
+// recorded by a golden run, BaselineRun.
+type Threshold struct {
+	// Metric is the name of the measurement, as recorded by the test plan,
+	// e.g. "lookup-latency".
+	Metric string `toml:"metric" json:"metric"`
+	// Group restricts the threshold to a group; all groups that recorded the
+	// measurement are checked if empty.
+	Group string `toml:"group" json:"group,omitempty"`
+	// Stat is the statistic bounded: count, mean, min, max or p95, the
+	// default.
+	Stat string `toml:"stat" json:"stat,omitempty"`
+
+	Baseline    float64 `toml:"baseline" json:"baseline,omitempty"`
+	BaselineRun string  `toml:"baseline_run" json:"baseline_run,omitempty"`
+
+	// Max and Min are the tolerances, as ratios of the baseline, e.g. 1.2
+	// for at most 20% above it. Zero disables the bound.
+	Max float64 `toml:"max" json:"max,omitempty"`
+	Min float64 `toml:"min" json:"min,omitempty"`
+}
+
+// Statistic returns the statistic bounded by the threshold.
+func (t Threshold) Statistic() string {
+	if t.Stat == "" {
+		return StatP95
+	}
+	return t.Stat
+}
+
+// Validate checks a threshold against the groups of a composition.
+func (t Threshold) Validate(groups map[string]struct{}) error {
+	if t.Metric == "" {
+		return fmt.Errorf("threshold sets no metric")
+	}
+	if t.Group != "" {
+		if _, ok := groups[t.Group]; !ok {
+			return fmt.Errorf("threshold of %s references unknown group: %s", t.Metric, t.Group)
+		}
+	}
+	switch t.Statistic() {
+	case StatCount, StatMean, StatMin, StatMax, StatP95:
+	default:
+		return fmt.Errorf("threshold of %s has unknown stat: %s", t.Metric, t.Stat)
+	}
+	switch {
+	case t.Baseline != 0 && t.BaselineRun != "":
+		return fmt.Errorf("threshold of %s sets both a baseline and a baseline run", t.Metric)
+	case t.Baseline == 0 && t.BaselineRun == "":
+		return fmt.Errorf("threshold of %s sets neither a baseline nor a baseline run", t.Metric)
+	case t.Max < 0, t.Min < 0:
+		return fmt.Errorf("threshold of %s has negative tolerances", t.Metric)
+	case t.Max == 0 && t.Min == 0:
+		return fmt.Errorf("threshold of %s sets neither a max nor a min", t.Metric)
+	case t.Max != 0 && t.Min > t.Max:
+		return fmt.Errorf("threshold of %s has a min above its max", t.Metric)
+	}
+	return nil
+}
+
+// ThresholdCheck is the outcome of a threshold, for a group of a run.
+type ThresholdCheck struct {
+	Metric      string  `json:"metric"`
+	Measurement string  `json:"measurement,omitempty"`
+	Group       string  `json:"group,omitempty"`
+	Stat        string  `json:"stat"`
+	Value       float64 `json:"value"`
+	Baseline    float64 `json:"baseline"`
+	Passed      bool    `json:"passed"`
+	// Message explains why the check failed.
+	Message string `json:"message,omitempty"`
+}
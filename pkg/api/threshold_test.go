@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreshold(t *testing.T) {
+	groups := map[string]struct{}{"peers": {}}
+
+	th := Threshold{Metric: "lookup-latency", Baseline: 100, Max: 1.2}
+	require.NoError(t, th.Validate(groups))
+	require.Equal(t, StatP95, th.Statistic())
+
+	require.NoError(t, Threshold{Metric: "throughput", Group: "peers", Stat: StatMean, BaselineRun: "abc", Min: 0.9}.Validate(groups))
+
+	require.Error(t, Threshold{Baseline: 100, Max: 1.2}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Group: "seeds", Baseline: 100, Max: 1.2}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Stat: "p99", Baseline: 100, Max: 1.2}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Max: 1.2}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Baseline: 100, BaselineRun: "abc", Max: 1.2}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Baseline: 100}.Validate(groups))
+	require.Error(t, Threshold{Metric: "m", Baseline: 100, Min: 1.5, Max: 1.2}.Validate(groups))
+}
+
+func TestThresholdsRequireMetrics(t *testing.T) {
+	c := &Composition{
+		Global: Global{
+			Plan:       "foo_plan",
+			Case:       "foo_case",
+			Builder:    "docker:go",
+			Runner:     "local:docker",
+			Thresholds: []Threshold{{Metric: "lookup-latency", Baseline: 100, Max: 1.2}},
+		},
+		Groups: []*Group{{ID: "peers", Instances: Instances{Count: 1}}},
+	}
+	c = c.GenerateDefaultRun()
+	require.NoError(t, c.ValidateForRun())
+
+	c.Global.DisableMetrics = true
+	require.Error(t, c.ValidateForRun())
+}
@@ -22,8 +22,9 @@ var ECR = &ecrsvc{}
 
 type ecrsvc struct{}
 
-// newService creates a new ECR backend service stub.
-func (*ecrsvc) newService(cfg config.AWSConfig) (*ecr.ECR, error) {
+// newSession creates an AWS session with the supplied region and credentials,
+// falling back to the defaults of the SDK for those not set.
+func newSession(cfg config.AWSConfig) (*session.Session, error) {
 	config := aws.NewConfig()
 	if cfg.Region != "" {
 		config = config.WithRegion(cfg.Region)
@@ -33,7 +34,12 @@ func (*ecrsvc) newService(cfg config.AWSConfig) (*ecr.ECR, error) {
 		creds := credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, "")
 		config = config.WithCredentials(creds)
 	}
-	sess, err := session.NewSession(config)
+	return session.NewSession(config)
+}
+
+// newService creates a new ECR backend service stub.
+func (*ecrsvc) newService(cfg config.AWSConfig) (*ecr.ECR, error) {
+	sess, err := newSession(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,213 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/testground/testground/pkg/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3 is a singleton object to namespace S3 operations.
+var S3 = &s3svc{}
+
+type s3svc struct{}
+
+// Upload writes the contents of r to an object.
+func (*s3svc) Upload(cfg config.AWSConfig, bucket, key string, r io.Reader) error {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3manager.NewUploader(sess).Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	return err
+}
+
+// Download writes the contents of an object to w. Objects in archival storage
+// classes must be restored first, see Restore.
+func (*s3svc) Download(cfg config.AWSConfig, bucket, key string, w io.WriterAt) error {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3manager.NewDownloader(sess).Download(w, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Delete removes an object.
+func (*s3svc) Delete(cfg config.AWSConfig, bucket, key string) error {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3.New(sess).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// maxCopySize is the size of the largest object S3 copies in a single
+// request; larger ones are copied in parts.
+const maxCopySize = 5 << 30
+
+// copyPartSize is the size of the parts of multipart copies. At 10000 parts,
+// it covers the largest objects S3 stores.
+const copyPartSize = 512 << 20
+
+// Transition moves an object to another storage class, by copying it onto
+// itself.
+func (*s3svc) Transition(cfg config.AWSConfig, bucket, key, class string) error {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+
+	source := aws.String(url.PathEscape(bucket + "/" + key))
+	if size := aws.Int64Value(head.ContentLength); size > maxCopySize {
+		return copyParts(svc, bucket, key, class, source, head)
+	}
+
+	_, err = svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        source,
+		StorageClass:      aws.String(class),
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+	})
+	return err
+}
+
+// copyParts copies an object too large for CopyObject onto itself, into
+// another storage class, with a multipart upload. Its metadata is carried
+// over, as multipart uploads don't copy it.
+func copyParts(svc *s3.S3, bucket, key, class string, source *string, head *s3.HeadObjectOutput) (err error) {
+	upload, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		StorageClass:    aws.String(class),
+		Metadata:        head.Metadata,
+		ContentType:     head.ContentType,
+		ContentEncoding: head.ContentEncoding,
+	})
+	if err != nil {
+		return err
+	}
+
+	// abort the upload if it fails, so that its parts don't linger.
+	defer func() {
+		if err != nil {
+			_, _ = svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      aws.String(key),
+				UploadId: upload.UploadId,
+			})
+		}
+	}()
+
+	size := aws.Int64Value(head.ContentLength)
+	parts := make([]*s3.CompletedPart, 0, (size+copyPartSize-1)/copyPartSize)
+	for start := int64(0); start < size; start += copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		num := aws.Int64(int64(len(parts) + 1))
+
+		var res *s3.UploadPartCopyOutput
+		res, err = svc.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			UploadId:          upload.UploadId,
+			PartNumber:        num,
+			CopySource:        source,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			CopySourceIfMatch: head.ETag,
+		})
+		if err != nil {
+			return fmt.Errorf("s3: failed to copy part %d of %s: %w", *num, key, err)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: res.CopyPartResult.ETag, PartNumber: num})
+	}
+
+	_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+// Restore makes an object in an archival storage class readable for the
+// supplied number of days, and returns whether it is. Restores take hours;
+// calling Restore again while one is in progress only checks on it.
+func (*s3svc) Restore(cfg config.AWSConfig, bucket, key string, days int) (ready bool, err error) {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return false, err
+	}
+	svc := s3.New(sess)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch aws.StringValue(head.StorageClass) {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+	default:
+		// readable as is.
+		return true, nil
+	}
+
+	// Restore is set once a restore was requested, e.g.
+	// ongoing-request="false", expiry-date="..." once it completed.
+	if r := aws.StringValue(head.Restore); r != "" {
+		return strings.Contains(r, `ongoing-request="false"`), nil
+	}
+
+	_, err = svc.RestoreObject(&s3.RestoreObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(int64(days)),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(s3.TierStandard)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RestoreAlreadyInProgress" {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("s3: failed to restore %s: %w", key, err)
+	}
+	return false, nil
+}
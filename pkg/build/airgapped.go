@@ -0,0 +1,153 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/healthcheck"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// DefaultGoRuntimeImage is the runtime image used by the docker:go builder
+// when none is configured. It must match the default in GoDockerfileTemplate.
+const DefaultGoRuntimeImage = "busybox:1.35.0-glibc"
+
+// mirrorImage rewrites an image reference so that it's pulled from the
+// supplied mirror registry. References that already point to the mirror are
+// returned unchanged.
+func mirrorImage(registry string, image string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	if strings.HasPrefix(image, registry+"/") {
+		return image
+	}
+	return registry + "/" + image
+}
+
+// AirGappedBuilders are the builders that honour air-gapped mode. Other
+// builders fetch their dependencies from the Internet, and are rejected when
+// air-gapped mode is enabled.
+var AirGappedBuilders = []string{"docker:go", "exec:go"}
+
+// CheckAirGapped errors if builder can't be used under the air-gapped
+// configuration ag.
+func CheckAirGapped(builder string, ag config.AirGappedConfig) error {
+	if !ag.Enabled {
+		return nil
+	}
+	for _, b := range AirGappedBuilders {
+		if b == builder {
+			return nil
+		}
+	}
+	return fmt.Errorf("builder %s is not supported in air-gapped mode; supported builders: %s", builder, strings.Join(AirGappedBuilders, ", "))
+}
+
+// goSumDB returns the checksum database to verify modules against in
+// air-gapped mode: the configured mirror, or none at all.
+func goSumDB(ag config.AirGappedConfig) string {
+	if ag.GoSumDB == "" {
+		return "off"
+	}
+	return ag.GoSumDB
+}
+
+// applyAirGapped rewrites a docker:go build configuration so that the build
+// doesn't reach out to the Internet: base images are pulled from the mirror
+// registry, modules are fetched from the internal go proxy only, and verified
+// against the checksum database mirror, if any.
+func applyAirGapped(cfg *DockerGoBuilderConfig, ag config.AirGappedConfig) error {
+	if !ag.Enabled {
+		return nil
+	}
+	if ag.Registry == "" || ag.GoProxyURL == "" {
+		return fmt.Errorf("air-gapped mode requires both a mirror registry and a go proxy url")
+	}
+
+	baseImage := cfg.BuildBaseImage
+	if baseImage == "" {
+		baseImage = DefaultGoBuildBaseImage
+	}
+	runtimeImage := cfg.RuntimeImage
+	if runtimeImage == "" {
+		runtimeImage = DefaultGoRuntimeImage
+	}
+
+	cfg.BuildBaseImage = mirrorImage(ag.Registry, baseImage)
+	cfg.RuntimeImage = mirrorImage(ag.Registry, runtimeImage)
+	cfg.GoProxyMode = "remote"
+	cfg.GoProxyURL = ag.GoProxyURL
+	cfg.GoSumDB = goSumDB(ag)
+	return nil
+}
+
+// airGappedGoEnv appends the environment variables that confine the go
+// toolchain to the internal go proxy and checksum database mirror in
+// air-gapped mode.
+func airGappedGoEnv(env []string, ag config.AirGappedConfig) ([]string, error) {
+	if !ag.Enabled {
+		return env, nil
+	}
+	if ag.GoProxyURL == "" {
+		return nil, fmt.Errorf("air-gapped mode requires a go proxy url")
+	}
+	return append(env, "GOPROXY="+ag.GoProxyURL, "GOSUMDB="+goSumDB(ag)), nil
+}
+
+// airGappedHealthcheck enlists checks verifying that the mirror registry and
+// the go proxy used in air-gapped mode are reachable. It enlists nothing when
+// air-gapped mode is disabled.
+func airGappedHealthcheck(ctx context.Context, hh *healthcheck.Helper, ag config.AirGappedConfig) {
+	if !ag.Enabled {
+		return
+	}
+
+	registry := hostPort(strings.SplitN(ag.Registry, "/", 2)[0], "443")
+	hh.Enlist("airgapped-registry",
+		healthcheck.DialableCheckerWithOpts(ctx, "tcp", registry, dialOpts(registry)),
+		healthcheck.RequiresManualFixing(),
+	)
+
+	if u, err := url.Parse(ag.GoProxyURL); err == nil && u.Host != "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		goproxy := hostPort(u.Host, port)
+		hh.Enlist("airgapped-goproxy",
+			healthcheck.DialableCheckerWithOpts(ctx, "tcp", goproxy, dialOpts(goproxy)),
+			healthcheck.RequiresManualFixing(),
+		)
+	}
+}
+
+// dialOpts returns the options to probe an air-gapped mirror, verifying the
+// TLS handshake of mirrors served on port 443.
+func dialOpts(addr string) healthcheck.DialOpts {
+	_, port, _ := net.SplitHostPort(addr)
+	return healthcheck.DialOpts{
+		Timeout:     5 * time.Second,
+		RetryWindow: 10 * time.Second,
+		TLS:         port == "443",
+	}
+}
+
+// hostPort appends the default port to addr if it doesn't carry one.
+func hostPort(addr string, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, port)
+}
+
+// Healthcheck verifies the build dependencies of the docker:go builder.
+func (b *DockerGoBuilder) Healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool) (*api.HealthcheckReport, error) {
+	hh := &healthcheck.Helper{}
+	airGappedHealthcheck(ctx, hh, engine.EnvConfig().AirGapped)
+	return hh.RunChecks(ctx, fix)
+}
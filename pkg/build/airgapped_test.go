@@ -0,0 +1,90 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestApplyAirGapped(t *testing.T) {
+	ag := config.AirGappedConfig{
+		Enabled:    true,
+		Registry:   "mirror.lab:5000",
+		GoProxyURL: "http://goproxy.lab",
+	}
+
+	cfg := &DockerGoBuilderConfig{
+		GoProxyMode:  "local",
+		RuntimeImage: "mirror.lab:5000/alpine:3",
+	}
+	if err := applyAirGapped(cfg, ag); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.BuildBaseImage != "mirror.lab:5000/"+DefaultGoBuildBaseImage {
+		t.Errorf("unexpected build base image: %s", cfg.BuildBaseImage)
+	}
+	if cfg.RuntimeImage != "mirror.lab:5000/alpine:3" {
+		t.Errorf("runtime image already on the mirror should be unchanged, got: %s", cfg.RuntimeImage)
+	}
+	if cfg.GoProxyMode != "remote" || cfg.GoProxyURL != ag.GoProxyURL {
+		t.Errorf("unexpected go proxy settings: %s %s", cfg.GoProxyMode, cfg.GoProxyURL)
+	}
+	if cfg.GoSumDB != "off" {
+		t.Errorf("checksum database should be off without a mirror, got: %s", cfg.GoSumDB)
+	}
+
+	// a checksum database mirror is used when configured.
+	ag.GoSumDB = "sum.golang.org https://sumdb.lab"
+	cfg = &DockerGoBuilderConfig{}
+	if err := applyAirGapped(cfg, ag); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GoSumDB != ag.GoSumDB {
+		t.Errorf("unexpected checksum database: %s", cfg.GoSumDB)
+	}
+
+	// disabled mode leaves the configuration untouched.
+	cfg = &DockerGoBuilderConfig{}
+	if err := applyAirGapped(cfg, config.AirGappedConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BuildBaseImage != "" || cfg.GoProxyMode != "" {
+		t.Errorf("configuration should be untouched when air-gapped mode is disabled")
+	}
+
+	// incomplete configuration is rejected.
+	if err := applyAirGapped(&DockerGoBuilderConfig{}, config.AirGappedConfig{Enabled: true}); err == nil {
+		t.Errorf("expected error with incomplete air-gapped configuration")
+	}
+}
+
+func TestAirGappedGoEnv(t *testing.T) {
+	ag := config.AirGappedConfig{Enabled: true, GoProxyURL: "http://goproxy.lab"}
+
+	env, err := airGappedGoEnv(nil, ag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 2 || env[0] != "GOPROXY=http://goproxy.lab" || env[1] != "GOSUMDB=off" {
+		t.Errorf("unexpected env: %v", env)
+	}
+}
+
+func TestCheckAirGapped(t *testing.T) {
+	ag := config.AirGappedConfig{Enabled: true}
+
+	for _, b := range []string{"docker:go", "exec:go"} {
+		if err := CheckAirGapped(b, ag); err != nil {
+			t.Errorf("expected %s to be supported: %s", b, err)
+		}
+	}
+	for _, b := range []string{"docker:generic", "docker:node"} {
+		if err := CheckAirGapped(b, ag); err == nil {
+			t.Errorf("expected %s to be rejected", b)
+		}
+		if err := CheckAirGapped(b, config.AirGappedConfig{}); err != nil {
+			t.Errorf("expected %s to be accepted when air-gapped mode is disabled: %s", b, err)
+		}
+	}
+}
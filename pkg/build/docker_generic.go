@@ -3,9 +3,10 @@ package build
 import (
 	"context"
 	"fmt"
-	"path"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/testground/testground/pkg/api"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/otiai10/copy"
 )
 
 var (
@@ -28,6 +30,36 @@ type DockerGenericBuilderConfig struct {
 	// Custom base path where we find the test source
 	Path      string             `toml:"path" default:"./"`
 	BuildArgs map[string]*string `toml:"build_args"` // ok if nil
+
+	// Labels are set on the image. Labels and build args are templates of
+	// the metadata of the build, see api.BuildMetadata; e.g.
+	// "{{.Commit}}".
+	Labels map[string]string `toml:"labels"`
+
+	// Dockerfile is the path of the Dockerfile, relative to Path.
+	Dockerfile string `toml:"dockerfile" default:"Dockerfile"`
+
+	// Context is the directory, relative to the root of the plan, sent to
+	// docker as the build context. By default, the context is the directory
+	// holding the plan under ./plan, the sdk under ./sdk, and the extra
+	// sources under ./extra. The Dockerfile must be inside the context.
+	Context string `toml:"context"`
+
+	// Includes are copied into the build context before building, e.g.
+	// shared libraries living outside of the plan, shipped as extra sources.
+	Includes []DockerGenericInclude `toml:"includes"`
+}
+
+// DockerGenericInclude copies a directory or file of the build sources into
+// the build context.
+type DockerGenericInclude struct {
+	// Source is the path to copy, relative to the directory holding the
+	// plan under ./plan, the sdk under ./sdk, and the extra sources under
+	// ./extra/<name of the directory>.
+	Source string `toml:"source"`
+	// Target is the path to copy Source to, relative to the build context.
+	// It defaults to the base name of Source.
+	Target string `toml:"target"`
 }
 
 // Build builds a testplan written in Go and outputs a Docker container.
@@ -47,26 +79,38 @@ func (b *DockerGenericBuilder) Build(ctx context.Context, in *api.BuildInput, ow
 		return nil, err
 	}
 
-	planPath := cfg.Path
-	basePathForPlan := path.Join("/plan", planPath)
+	buildCtx, dockerfile, err := genericBuildContext(basesrc, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	buildArgs, err := in.Metadata.RenderAll(cfg.BuildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build arg: %w", err)
+	}
+	labels, err := imageLabels(&in.Metadata, cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
 
-	if cfg.BuildArgs == nil {
-		cfg.BuildArgs = make(map[string]*string)
+	if buildArgs == nil {
+		buildArgs = make(map[string]*string)
 	}
 
-	if _, ok = cfg.BuildArgs["PLAN_PATH"]; !ok {
-		cfg.BuildArgs["PLAN_PATH"] = &cfg.Path
+	if _, ok = buildArgs["PLAN_PATH"]; !ok {
+		buildArgs["PLAN_PATH"] = &cfg.Path
 	}
 
 	opts := types.ImageBuildOptions{
 		Tags:        []string{in.BuildID},
-		BuildArgs:   cfg.BuildArgs,
+		BuildArgs:   buildArgs,
+		Labels:      labels,
 		NetworkMode: "host",
-		Dockerfile:  filepath.Join(basePathForPlan, "Dockerfile"),
+		Dockerfile:  dockerfile,
 	}
 
 	imageOpts := docker.BuildImageOpts{
-		BuildCtx:  basesrc,
+		BuildCtx:  buildCtx,
 		BuildOpts: &opts,
 	}
 
@@ -101,6 +145,77 @@ func (b *DockerGenericBuilder) Build(ctx context.Context, in *api.BuildInput, ow
 	return out, err
 }
 
+// genericBuildContext returns the build context of a docker:generic build,
+// with the includes of the configuration copied into it, and the path of the
+// Dockerfile within it.
+func genericBuildContext(basesrc string, cfg *DockerGenericBuilderConfig) (buildCtx string, dockerfile string, err error) {
+	plandir := filepath.Join(basesrc, "plan")
+
+	buildCtx = basesrc
+	if cfg.Context != "" {
+		if buildCtx, err = subPath(plandir, cfg.Context); err != nil {
+			return "", "", fmt.Errorf("invalid build context: %w", err)
+		}
+		if fi, err := os.Stat(buildCtx); err != nil || !fi.IsDir() {
+			return "", "", fmt.Errorf("build context %s is not a directory of the plan", cfg.Context)
+		}
+	}
+
+	name := cfg.Dockerfile
+	if name == "" {
+		name = "Dockerfile"
+	}
+	dfpath, err := subPath(plandir, filepath.Join(cfg.Path, name))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid dockerfile: %w", err)
+	}
+	if dockerfile, err = filepath.Rel(buildCtx, dfpath); err != nil || !isLocal(dockerfile) {
+		return "", "", fmt.Errorf("dockerfile %s is outside of the build context", filepath.Join(cfg.Path, name))
+	}
+
+	for _, inc := range cfg.Includes {
+		src, err := subPath(basesrc, inc.Source)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid include source: %w", err)
+		}
+		target := inc.Target
+		if target == "" {
+			target = filepath.Base(src)
+		}
+		dst, err := subPath(buildCtx, target)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid include target: %w", err)
+		}
+		if _, err := os.Stat(src); err != nil {
+			return "", "", fmt.Errorf("include %s not found in the build sources; is it shipped as an extra source?", inc.Source)
+		}
+		if _, err := os.Stat(dst); err == nil {
+			return "", "", fmt.Errorf("include target %s already exists in the build context", target)
+		}
+		if err := copy.Copy(src, dst); err != nil {
+			return "", "", fmt.Errorf("failed to copy include %s into the build context: %w", inc.Source, err)
+		}
+	}
+
+	return buildCtx, dockerfile, nil
+}
+
+// subPath joins rel to root, refusing paths that would escape it.
+func subPath(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%s is not a relative path", rel)
+	}
+	if p := filepath.Clean(rel); !isLocal(p) {
+		return "", fmt.Errorf("%s escapes %s", rel, root)
+	}
+	return filepath.Join(root, rel), nil
+}
+
+// isLocal reports whether a clean, relative path stays within its root.
+func isLocal(p string) bool {
+	return p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
 func (*DockerGenericBuilder) ID() string {
 	return "docker:generic"
 }
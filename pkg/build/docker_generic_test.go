@@ -0,0 +1,61 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericBuildContext(t *testing.T) {
+	basesrc := t.TempDir()
+	for _, f := range []string{
+		"plan/services/node/Dockerfile",
+		"plan/services/node/build/Dockerfile.ci",
+		"extra/libs/shared/lib.go",
+	} {
+		p := filepath.Join(basesrc, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(f), 0644))
+	}
+
+	// the default layout.
+	buildCtx, dockerfile, err := genericBuildContext(basesrc, &DockerGenericBuilderConfig{Path: "services/node"})
+	require.NoError(t, err)
+	require.Equal(t, basesrc, buildCtx)
+	require.Equal(t, filepath.Join("plan", "services", "node", "Dockerfile"), dockerfile)
+
+	// a context subdirectory, with an alternative Dockerfile and includes.
+	cfg := &DockerGenericBuilderConfig{
+		Path:       "services/node",
+		Dockerfile: "build/Dockerfile.ci",
+		Context:    "services",
+		Includes: []DockerGenericInclude{
+			{Source: "extra/libs/shared"},
+			{Source: "extra/libs", Target: "vendor/libs"},
+		},
+	}
+	buildCtx, dockerfile, err = genericBuildContext(basesrc, cfg)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(basesrc, "plan", "services"), buildCtx)
+	require.Equal(t, filepath.Join("node", "build", "Dockerfile.ci"), dockerfile)
+	require.FileExists(t, filepath.Join(buildCtx, "shared", "lib.go"))
+	require.FileExists(t, filepath.Join(buildCtx, "vendor", "libs", "shared", "lib.go"))
+
+	// includes never overwrite the context.
+	_, _, err = genericBuildContext(basesrc, cfg)
+	require.Error(t, err)
+
+	for name, cfg := range map[string]*DockerGenericBuilderConfig{
+		"dockerfile outside of the context": {Path: "services/node", Context: "services/node/build"},
+		"context escaping the plan":         {Context: "../extra"},
+		"missing context":                   {Context: "nope"},
+		"missing include":                   {Path: "services/node", Includes: []DockerGenericInclude{{Source: "extra/nope"}}},
+		"include escaping the context":      {Path: "services/node", Includes: []DockerGenericInclude{{Source: "extra/libs", Target: "../libs"}}},
+		"absolute include":                  {Path: "services/node", Includes: []DockerGenericInclude{{Source: "/etc"}}},
+	} {
+		_, _, err := genericBuildContext(basesrc, cfg)
+		require.Error(t, err, name)
+	}
+}
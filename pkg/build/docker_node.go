@@ -55,6 +55,11 @@ func (d DockerNodeBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rp
 		cfg.BaseImage = DefaultNodeBuildBaseImage
 	}
 
+	labels, err := imageLabels(&in.Metadata, cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
+
 	// build args
 	var args = map[string]*string{
 		"BASE_IMAGE": &cfg.BaseImage,
@@ -63,6 +68,7 @@ func (d DockerNodeBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rp
 	opts := types.ImageBuildOptions{
 		Tags:        []string{in.BuildID},
 		BuildArgs:   args,
+		Labels:      labels,
 		NetworkMode: "host",
 	}
 
@@ -113,6 +119,10 @@ func (d DockerNodeBuilder) ConfigType() reflect.Type {
 type DockerNodeBuilderConfig struct {
 	Enabled   bool
 	BaseImage string `toml:"base_image"`
+
+	// Labels are set on the image, rendered as templates of the metadata of
+	// the build, see api.BuildMetadata.
+	Labels map[string]string `toml:"labels"`
 }
 
 const NodeDockerfileTemplate = `
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 
 	"github.com/testground/testground/pkg/api"
@@ -26,6 +27,32 @@ type ExecGoBuilderConfig struct {
 	ModulePath string `toml:"module_path"`
 	ExecPkg    string `toml:"exec_pkg"`
 	FreshGomod bool   `toml:"fresh_gomod"`
+
+	// GoProxy, GoNoSumDB, GoPrivate and GoFlags are passed to the go
+	// toolchain as the GOPROXY, GONOSUMDB, GOPRIVATE and GOFLAGS env vars
+	// respectively. Unset values are inherited from the daemon's environment.
+	GoProxy   string `toml:"go_proxy"`
+	GoNoSumDB string `toml:"go_nosumdb"`
+	GoPrivate string `toml:"go_private"`
+	GoFlags   string `toml:"go_flags"`
+
+	// RunTests runs TestCommand against the plan source before building it,
+	// failing the build if the tests fail.
+	RunTests bool `toml:"run_tests"`
+
+	// TestCommand is the shell command that RunTests executes, from the plan
+	// directory. Defaults to DefaultTestCommand.
+	TestCommand string `toml:"test_command"`
+
+	// Cgo configures cgo. Plans requiring it declare it in the manifest,
+	// under [builders."exec:go".cgo].
+	Cgo ExecGoCgoConfig `toml:"cgo"`
+
+	// SystemPackages are the system packages the plan requires, by their
+	// pkg-config names, and SystemCommands the executables it requires.
+	// They're verified on the daemon host before building.
+	SystemPackages []string `toml:"system_packages"`
+	SystemCommands []string `toml:"system_commands"`
 }
 
 // Build builds a testplan written in Go and outputs an executable.
@@ -44,6 +71,23 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 		path = filepath.Join(in.EnvConfig.Dirs().Work(), bin)
 	)
 
+	// Windows only runs executables with the right extension.
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+
+	// env is the environment of all go commands we invoke.
+	env, err := airGappedGoEnv(cfg.goEnv(os.Environ()), in.EnvConfig.AirGapped)
+	if err != nil {
+		return nil, err
+	}
+	env = cfg.Cgo.env(env)
+
+	// Verify the system dependencies of the plan before building it.
+	if err := systemPreflight(ctx, cfg, env, ow); err != nil {
+		return nil, err
+	}
+
 	if cfg.FreshGomod {
 		for _, f := range []string{"go.mod", "go.sum"} {
 			file := filepath.Join(plansrc, f)
@@ -57,6 +101,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 		// Initialize a fresh go.mod file.
 		cmd := exec.CommandContext(ctx, "go", "mod", "init", cfg.ModulePath)
 		cmd.Dir = plansrc
+		cmd.Env = env
 		out, _ := cmd.CombinedOutput()
 		if !strings.Contains(string(out), "creating new go.mod") {
 			return nil, fmt.Errorf("unable to create go.mod; %s", out)
@@ -82,6 +127,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 		// Write replace directives.
 		cmd := exec.CommandContext(ctx, "go", append([]string{"mod", "edit"}, replaces...)...)
 		cmd.Dir = plansrc
+		cmd.Env = env
 		if err := cmd.Run(); err != nil {
 			out, _ := cmd.CombinedOutput()
 			return nil, fmt.Errorf("unable to add replace directives to go.mod; %w; output: %s", err, string(out))
@@ -91,11 +137,26 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 	// go mod tidy
 	cmd := exec.CommandContext(ctx, "go", "mod", "tidy")
 	cmd.Dir = plansrc
+	cmd.Env = env
 	if err := cmd.Run(); err != nil {
 		out, _ := cmd.CombinedOutput()
 		return nil, fmt.Errorf("unable to go mod tidy in build; %w; output: %s", err, string(out))
 	}
 
+	// Run the plan's tests, if requested.
+	if cfg.RunTests {
+		testCmd := testCommand(cfg.TestCommand)
+		ow.Infow("running plan tests before build", "command", testCmd)
+
+		cmd = shellCommand(ctx, testCmd)
+		cmd.Dir = plansrc
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			ow.Errorf("plan tests failed: %s", string(out))
+			return nil, fmt.Errorf("plan tests failed; %w", err)
+		}
+	}
+
 	// Calculate the arguments to go build.
 	// go build -o <output_path> [-tags <comma-separated tags>] <exec_pkg>
 	var args = []string{"build", "-gcflags=all=-N -l", "-o", path}
@@ -108,6 +169,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 	// Execute the build.
 	cmd = exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = plansrc
+	cmd.Env = env
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		ow.Errorf("go build failed: %s", string(out))
@@ -116,6 +178,7 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 
 	cmd = exec.CommandContext(ctx, "go", "list", "-m", "all")
 	cmd.Dir = plansrc
+	cmd.Env = env
 	out, err = cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("unable to list module dependencies; %w", err)
@@ -127,6 +190,33 @@ func (b *ExecGoBuilder) Build(ctx context.Context, in *api.BuildInput, ow *rpc.O
 	}, nil
 }
 
+// DefaultTestCommand is the command that go builders run to test the plan
+// before building it, when requested and no command is configured.
+const DefaultTestCommand = "go test ./..."
+
+// testCommand returns the configured test command, or the default one.
+func testCommand(cmd string) string {
+	if strings.TrimSpace(cmd) == "" {
+		return DefaultTestCommand
+	}
+	return cmd
+}
+
+// goEnv appends the configured go toolchain env vars to env.
+func (c *ExecGoBuilderConfig) goEnv(env []string) []string {
+	for k, v := range map[string]string{
+		"GOPROXY":   c.GoProxy,
+		"GONOSUMDB": c.GoNoSumDB,
+		"GOPRIVATE": c.GoPrivate,
+		"GOFLAGS":   c.GoFlags,
+	} {
+		if v != "" {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
+}
+
 func (*ExecGoBuilder) ID() string {
 	return "exec:go"
 }
@@ -138,3 +228,12 @@ func (*ExecGoBuilder) ConfigType() reflect.Type {
 func (*ExecGoBuilder) Purge(ctx context.Context, testplan string, ow *rpc.OutputWriter) error {
 	return fmt.Errorf("purge not implemented for exec:go")
 }
+
+// shellCommand returns a command running cmdline with the shell of the
+// platform.
+func shellCommand(ctx context.Context, cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", cmdline)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", cmdline)
+}
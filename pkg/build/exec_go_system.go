@@ -0,0 +1,147 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/healthcheck"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// ExecGoCgoConfig configures cgo for exec:go builds.
+type ExecGoCgoConfig struct {
+	// Enabled builds the plan with CGO_ENABLED=1, once a C compiler was
+	// found. Otherwise, CGO_ENABLED is inherited from the daemon.
+	Enabled bool `toml:"enabled"`
+	// CC is the C compiler; it defaults to the one of the go toolchain.
+	CC string `toml:"cc"`
+	// CFlags and LDFlags are passed to the go toolchain as the CGO_CFLAGS
+	// and CGO_LDFLAGS env vars respectively.
+	CFlags  string `toml:"cflags"`
+	LDFlags string `toml:"ldflags"`
+}
+
+// env appends the cgo env vars to env.
+func (c *ExecGoCgoConfig) env(env []string) []string {
+	if !c.Enabled {
+		return env
+	}
+	env = append(env, "CGO_ENABLED=1")
+	for k, v := range map[string]string{
+		"CC":          c.CC,
+		"CGO_CFLAGS":  c.CFlags,
+		"CGO_LDFLAGS": c.LDFlags,
+	} {
+		if v != "" {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
+}
+
+// compiler returns the C compiler cgo builds with.
+func (c *ExecGoCgoConfig) compiler(ctx context.Context, env []string) (string, error) {
+	cc := c.CC
+	if cc == "" {
+		cmd := exec.CommandContext(ctx, "go", "env", "CC")
+		cmd.Env = env
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine the C compiler of the go toolchain; %w", err)
+		}
+		cc = string(out)
+	}
+	if fields := strings.Fields(cc); len(fields) > 0 {
+		return fields[0], nil
+	}
+	return "", fmt.Errorf("no C compiler configured")
+}
+
+// systemHealthcheck enlists checks verifying that the C compiler, the system
+// packages and the commands an exec:go build requires are present on the
+// daemon host.
+func systemHealthcheck(ctx context.Context, hh *healthcheck.Helper, cfg *ExecGoBuilderConfig, env []string) error {
+	if cfg.Cgo.Enabled {
+		cc, err := cfg.Cgo.compiler(ctx, env)
+		if err != nil {
+			return err
+		}
+		hh.Enlist("cgo-compiler", healthcheck.CheckExecutable(cc), nil)
+	}
+
+	if len(cfg.SystemPackages) > 0 {
+		hh.Enlist("pkg-config", healthcheck.CheckExecutable("pkg-config"), nil)
+	}
+	for _, pkg := range cfg.SystemPackages {
+		name := "system-package:" + pkg
+		hh.Enlist(name, healthcheck.CheckCommandStatus(ctx, "pkg-config", "--exists", pkg), nil)
+		hh.DependsOn(name, "pkg-config")
+	}
+
+	for _, cmd := range cfg.SystemCommands {
+		hh.Enlist("system-command:"+cmd, healthcheck.CheckExecutable(cmd), nil)
+	}
+	return nil
+}
+
+// systemPreflight verifies the system dependencies of an exec:go build
+// before building, so that missing ones are reported upfront, rather than as
+// link failures halfway through the build.
+func systemPreflight(ctx context.Context, cfg *ExecGoBuilderConfig, env []string, ow *rpc.OutputWriter) error {
+	hh := &healthcheck.Helper{}
+	if err := systemHealthcheck(ctx, hh, cfg, env); err != nil {
+		return err
+	}
+
+	report, err := hh.RunChecks(ctx, false)
+	if err != nil {
+		return err
+	}
+	if err := systemPreflightError(report); err != nil {
+		return err
+	}
+	if len(report.Checks) > 0 {
+		ow.Infow("verified system dependencies", "checks", len(report.Checks))
+	}
+	return nil
+}
+
+// systemPreflightError returns an error describing the system dependencies
+// found missing by a preflight, and how to provide them, or nil if none is.
+func systemPreflightError(report *api.HealthcheckReport) error {
+	var missing []string
+	for _, c := range report.Checks {
+		if c.Status == api.HealthcheckStatusOK {
+			continue
+		}
+
+		var hint string
+		switch kind, name := splitCheckName(c.Name); kind {
+		case "cgo-compiler":
+			hint = "install a C compiler on the daemon host, or set cgo.cc to the compiler to use"
+		case "pkg-config":
+			hint = "install pkg-config on the daemon host, to locate system packages"
+		case "system-package":
+			hint = fmt.Sprintf("install the development package providing %s.pc on the daemon host, or add the directory of %s.pc to PKG_CONFIG_PATH", name, name)
+		case "system-command":
+			hint = fmt.Sprintf("install %s on the daemon host, or add its directory to PATH", name)
+		}
+		missing = append(missing, fmt.Sprintf("  - %s: %s\n    %s", c.Name, c.Message, hint))
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("missing system dependencies declared by the plan for exec:go:\n%s", strings.Join(missing, "\n"))
+}
+
+// splitCheckName splits the name of a preflight check into its kind and the
+// dependency it checks, if any.
+func splitCheckName(name string) (kind, dep string) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
@@ -0,0 +1,39 @@
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func TestExecGoCgoEnv(t *testing.T) {
+	cfg := ExecGoCgoConfig{CFlags: "-O2"}
+	require.Equal(t, []string{"PATH=/bin"}, cfg.env([]string{"PATH=/bin"}))
+
+	cfg.Enabled = true
+	env := cfg.env([]string{"PATH=/bin"})
+	require.ElementsMatch(t, []string{"PATH=/bin", "CGO_ENABLED=1", "CGO_CFLAGS=-O2"}, env)
+}
+
+func TestSystemPreflight(t *testing.T) {
+	ctx := context.Background()
+
+	err := systemPreflight(ctx, &ExecGoBuilderConfig{}, nil, rpc.Discard())
+	require.NoError(t, err)
+
+	err = systemPreflight(ctx, &ExecGoBuilderConfig{SystemCommands: []string{"go"}}, nil, rpc.Discard())
+	require.NoError(t, err)
+
+	cfg := &ExecGoBuilderConfig{
+		Cgo:            ExecGoCgoConfig{Enabled: true, CC: "tg-missing-cc"},
+		SystemCommands: []string{"go", "tg-missing-command"},
+	}
+	err = systemPreflight(ctx, cfg, nil, rpc.Discard())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cgo-compiler: tg-missing-cc not found in PATH.")
+	require.Contains(t, err.Error(), "install tg-missing-command on the daemon host")
+	require.NotContains(t, err.Error(), "system-command:go")
+}
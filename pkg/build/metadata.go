@@ -0,0 +1,24 @@
+package build
+
+import (
+	"fmt"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// imageLabels renders the image labels of a builder configuration as
+// templates of the metadata of the build.
+func imageLabels(meta *api.BuildMetadata, labels map[string]string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		r, err := meta.Render(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image label %s: %w", k, err)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
@@ -84,7 +84,7 @@ func TestBuildSelector(t *testing.T) {
 				PlanDir: plandir,
 			}
 
-			id, err := engine.QueueBuild(&api.BuildRequest{
+			id, err := engine.QueueBuild(context.Background(), &api.BuildRequest{
 				Priority:    0,
 				Composition: *comp,
 				Manifest:    *manifest,
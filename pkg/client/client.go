@@ -13,10 +13,12 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	copy "github.com/otiai10/copy"
 	ignore "github.com/sabhiram/go-gitignore"
@@ -306,6 +308,39 @@ func (c *Client) Terminate(ctx context.Context, r *api.TerminateRequest) (io.Rea
 	return c.request(ctx, "POST", "/terminate", bytes.NewReader(body.Bytes()))
 }
 
+// PauseRun sends a `run pause` request to the daemon.
+func (c *Client) PauseRun(ctx context.Context, r *api.PauseRunRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/runs/pause", bytes.NewReader(body.Bytes()))
+}
+
+// ResumeRun sends a `run resume` request to the daemon.
+func (c *Client) ResumeRun(ctx context.Context, r *api.PauseRunRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/runs/resume", bytes.NewReader(body.Bytes()))
+}
+
+// ScaleRun sends a `scale` request to the daemon.
+func (c *Client) ScaleRun(ctx context.Context, r *api.ScaleRunRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/runs/scale", bytes.NewReader(body.Bytes()))
+}
+
 // Healthcheck sends a `healthcheck` request to the daemon.
 func (c *Client) Healthcheck(ctx context.Context, r *api.HealthcheckRequest) (io.ReadCloser, error) {
 	var body bytes.Buffer
@@ -317,6 +352,18 @@ func (c *Client) Healthcheck(ctx context.Context, r *api.HealthcheckRequest) (io
 	return c.request(ctx, "POST", "/healthcheck", bytes.NewReader(body.Bytes()))
 }
 
+// InfraUpgrade sends an `infra/upgrade` request to the daemon. The response
+// is parsed like a healthcheck response, with ParseHealthcheckResponse.
+func (c *Client) InfraUpgrade(ctx context.Context, r *api.InfraUpgradeRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/infra/upgrade", bytes.NewReader(body.Bytes()))
+}
+
 // BuildPurge sends a `build/purge` request to the daemon.
 func (c *Client) BuildPurge(ctx context.Context, r *api.BuildPurgeRequest) (io.ReadCloser, error) {
 	var body bytes.Buffer
@@ -348,6 +395,154 @@ func (c *Client) Status(ctx context.Context, r *api.StatusRequest) (io.ReadClose
 	return c.request(ctx, "POST", "/status", bytes.NewReader(body.Bytes()))
 }
 
+func (c *Client) DescribeRun(ctx context.Context, r *api.DescribeRunRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/describe", bytes.NewReader(body.Bytes()))
+}
+
+// Stats sends a `stats` request to the daemon.
+func (c *Client) Stats(ctx context.Context, r *api.StatsRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/stats", bytes.NewReader(body.Bytes()))
+}
+
+// SweepReport sends a `sweeps/report` request to the daemon.
+func (c *Client) SweepReport(ctx context.Context, r *api.SweepReportRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/sweeps/report", bytes.NewReader(body.Bytes()))
+}
+
+// PublishPlan publishes the test plan at plandir to the plan registry of the
+// daemon.
+func (c *Client) PublishPlan(ctx context.Context, r *api.PublishPlanRequest, plandir string) (io.ReadCloser, error) {
+	return c.runBuild(ctx, r, "/plans/publish", plandir, "", nil)
+}
+
+func (c *Client) Plans(ctx context.Context, r *api.PlansRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/plans", bytes.NewReader(body.Bytes()))
+}
+
+func (c *Client) PlanInfo(ctx context.Context, r *api.PlanInfoRequest) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.request(ctx, "POST", "/plans/info", bytes.NewReader(body.Bytes()))
+}
+
+// RunValues returns the values in the key/value store of an ongoing run.
+func (c *Client) RunValues(ctx context.Context, runID string) (map[string]string, error) {
+	rc, err := c.request(ctx, "GET", "/runs/store?run_id="+url.QueryEscape(runID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var values map[string]string
+	if err := json.NewDecoder(rc).Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SetRunValue sets a value in the key/value store of an ongoing run.
+func (c *Client) SetRunValue(ctx context.Context, runID string, r *api.SetRunValueRequest) error {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return err
+	}
+
+	rc, err := c.request(ctx, "POST", "/runs/store?run_id="+url.QueryEscape(runID), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+// AbortRun tears down an ongoing run, recording the reason in the result of
+// its task.
+func (c *Client) AbortRun(ctx context.Context, runID string, r *api.AbortRunRequest) error {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(r)
+	if err != nil {
+		return err
+	}
+
+	rc, err := c.request(ctx, "POST", "/runs/abort?run_id="+url.QueryEscape(runID), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+// Datasets lists the datasets served to test instances by the daemon.
+func (c *Client) Datasets(ctx context.Context) (api.DatasetsResponse, error) {
+	rc, err := c.request(ctx, "GET", "/datasets", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var res api.DatasetsResponse
+	if err := json.NewDecoder(rc).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ClockOffset measures the offset of the clock of the daemon against the
+// local clock over a number of exchanges, and returns the one with the lowest
+// round-trip delay, like NTP does, along with that delay.
+func (c *Client) ClockOffset(ctx context.Context, samples int) (offset, delay time.Duration, err error) {
+	delay = -1
+	for i := 0; i < samples; i++ {
+		sent := time.Now()
+		rc, err := c.request(ctx, "GET", "/time", nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		var res api.TimeResponse
+		err = json.NewDecoder(rc).Decode(&res)
+		received := time.Now()
+		_ = rc.Close()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if o, d := res.ClockOffset(sent, received); delay < 0 || d < delay {
+			offset, delay = o, d
+		}
+	}
+	if delay < 0 {
+		return 0, 0, errors.New("no clock samples")
+	}
+	return offset, delay, nil
+}
+
 func (c *Client) Cancel(ctx context.Context, r *api.CancelRequest) (io.ReadCloser, error) {
 	var body bytes.Buffer
 	err := json.NewEncoder(&body).Encode(r)
@@ -368,10 +563,18 @@ func (c *Client) Logs(ctx context.Context, r *api.LogsRequest) (io.ReadCloser, e
 	return c.request(ctx, "POST", "/logs", bytes.NewReader(body.Bytes()))
 }
 
+// parseGeneric decodes the chunks of a response, writing the output of the
+// daemon to progress. A nil progress discards the output, and the banners
+// printed between the sections of the response.
 func parseGeneric(r io.ReadCloser, progress io.Writer, fnBinary, fnResult func(interface{}) error) error {
 	var chunk rpc.Chunk
 	var once sync.Once
 
+	quiet := progress == nil
+	if quiet {
+		progress = ioutil.Discard
+	}
+
 	for dec := json.NewDecoder(r); ; {
 		err := dec.Decode(&chunk)
 		if err != nil {
@@ -380,9 +583,11 @@ func parseGeneric(r io.ReadCloser, progress io.Writer, fnBinary, fnResult func(i
 
 		switch chunk.Type {
 		case rpc.ChunkTypeProgress:
-			once.Do(func() {
-				fmt.Println(aurora.Bold(aurora.Cyan("\n>>> Server output:\n")))
-			})
+			if !quiet {
+				once.Do(func() {
+					fmt.Println(aurora.Bold(aurora.Cyan("\n>>> Server output:\n")))
+				})
+			}
 
 			line, err := decodeProgress(chunk.Payload)
 			if err != nil {
@@ -395,11 +600,15 @@ func parseGeneric(r io.ReadCloser, progress io.Writer, fnBinary, fnResult func(i
 			}
 
 		case rpc.ChunkTypeError:
-			fmt.Println(aurora.Bold(aurora.BrightRed("\n>>> Error:\n")))
+			if !quiet {
+				fmt.Println(aurora.Bold(aurora.BrightRed("\n>>> Error:\n")))
+			}
 			return errors.New(chunk.Error.Msg)
 
 		case rpc.ChunkTypeResult:
-			fmt.Println(aurora.Bold(aurora.BrightGreen("\n>>> Result:\n")))
+			if !quiet {
+				fmt.Println(aurora.Bold(aurora.BrightGreen("\n>>> Result:\n")))
+			}
 			return fnResult(chunk.Payload)
 
 		case rpc.ChunkTypeBinary:
@@ -520,6 +729,31 @@ func ParseTerminateRequest(r io.ReadCloser, progress io.Writer) error {
 	)
 }
 
+// ParsePauseRunResponse parses a response from a 'run pause' or 'run resume'
+// call
+func ParsePauseRunResponse(r io.ReadCloser, progress io.Writer) error {
+	return parseGeneric(
+		r,
+		progress,
+		nil,
+		func(result interface{}) error {
+			return nil
+		},
+	)
+}
+
+// ParseScaleRunResponse parses a response from a 'scale' call
+func ParseScaleRunResponse(r io.ReadCloser, progress io.Writer) error {
+	return parseGeneric(
+		r,
+		progress,
+		nil,
+		func(result interface{}) error {
+			return nil
+		},
+	)
+}
+
 // ParseHealthcheckResponse parses a response from a 'healthcheck' call
 func ParseHealthcheckResponse(r io.ReadCloser, progress io.Writer) (api.HealthcheckResponse, error) {
 	var resp api.HealthcheckResponse
@@ -558,6 +792,90 @@ func ParseStatusResponse(r io.ReadCloser, progress io.Writer) (api.StatusRespons
 	return resp, err
 }
 
+// ParseStatsResponse parses a response from a 'stats' call
+func ParseStatsResponse(r io.ReadCloser, progress io.Writer) (api.StatsResponse, error) {
+	var resp api.StatsResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParseSweepReportResponse parses a response from a 'sweep report' call
+func ParseSweepReportResponse(r io.ReadCloser, progress io.Writer) (api.SweepReportResponse, error) {
+	var resp api.SweepReportResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParseDescribeRunResponse parses a response from a 'describe' call
+func ParseDescribeRunResponse(r io.ReadCloser, progress io.Writer) (api.DescribeRunResponse, error) {
+	var resp api.DescribeRunResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParsePublishPlanResponse parses a response from a 'plan publish' call
+func ParsePublishPlanResponse(r io.ReadCloser, progress io.Writer) (api.PublishPlanResponse, error) {
+	var resp api.PublishPlanResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParsePlansResponse parses a response from a 'plans' call
+func ParsePlansResponse(r io.ReadCloser, progress io.Writer) (api.PlansResponse, error) {
+	var resp api.PlansResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParsePlanInfoResponse parses a response from a 'plan info' call
+func ParsePlanInfoResponse(r io.ReadCloser, progress io.Writer) (api.PlanInfoResponse, error) {
+	var resp api.PlanInfoResponse
+	err := parseGeneric(
+		r,
+		progress,
+		nil,
+		parseMarshalAndUnmarshal(&resp),
+	)
+	return resp, err
+}
+
+// ParseCancelResponse parses a response from a 'cancel' call
+func ParseCancelResponse(r io.ReadCloser, progress io.Writer) error {
+	return parseGeneric(
+		r,
+		progress,
+		nil,
+		func(result interface{}) error {
+			return nil
+		},
+	)
+}
+
 // ParseLogsRequest parses a response from a 'logs' call
 func ParseLogsRequest(w io.Writer, r io.ReadCloser) (api.LogsResponse, error) {
 	var resp api.LogsResponse
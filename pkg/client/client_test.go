@@ -1,11 +1,19 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
 )
 
 const (
@@ -58,3 +66,24 @@ func TestFilteredDirectoryWithIgnore(t *testing.T) {
 		require.NoFileExists(t, filepath.Join(dir, file))
 	}
 }
+
+func TestClockOffset(t *testing.T) {
+	// the clock of the daemon is 2s ahead.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := api.TimeResponse{Received: time.Now().Add(2 * time.Second)}
+		res.Sent = time.Now().Add(2 * time.Second)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	cfg := &config.EnvConfig{}
+	cfg.Client.Endpoint = srv.URL
+	c := New(cfg)
+	defer c.Close()
+
+	offset, delay, err := c.ClockOffset(context.Background(), 3)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, int64(delay), int64(0))
+	require.InDelta(t, float64(2*time.Second), float64(offset), float64(delay+time.Millisecond))
+}
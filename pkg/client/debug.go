@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// DebugUpgrade is the protocol debug connections are upgraded to: a raw byte
+// stream to the instance.
+const DebugUpgrade = "tcp"
+
+// Debug attaches to a live instance of a run, through the daemon: to the
+// terminal of a shell started in the instance, or to one of its ports if
+// r.Port is set. Closing the returned connection ends the session.
+func (c *Client) Debug(ctx context.Context, r *api.DebugRequest) (net.Conn, error) {
+	u, err := url.Parse(c.endpoint + "/debug")
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("run_id", r.RunID)
+	q.Set("instance", strconv.Itoa(r.Instance))
+	if r.Group != "" {
+		q.Set("group", r.Group)
+	}
+	if r.Port > 0 {
+		q.Set("port", strconv.Itoa(r.Port))
+	}
+	if r.Rows > 0 && r.Cols > 0 {
+		q.Set("rows", strconv.FormatUint(uint64(r.Rows), 10))
+		q.Set("cols", strconv.FormatUint(uint64(r.Cols), 10))
+	}
+	u.RawQuery = q.Encode()
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+
+	// the connection is handed over to the caller; stop watching ctx then.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", DebugUpgrade)
+	if token := strings.TrimSpace(c.cfg.Client.Token); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected status code received: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return BufferedConn(conn, br), nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// BufferedConn returns conn, reading through r first, which buffers data
+// already read from conn.
+func BufferedConn(conn net.Conn, r *bufio.Reader) net.Conn {
+	return &bufferedConn{Conn: conn, r: r}
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// Splice copies data between a and b in both directions until both are
+// drained, and closes them. The end of each direction is signalled to the
+// other side by closing its write half, where supported.
+func Splice(a, b io.ReadWriteCloser) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	pipe := func(dst, src io.ReadWriteCloser) {
+		defer wg.Done()
+
+		_, err := io.Copy(dst, src)
+		cw, ok := dst.(interface{ CloseWrite() error })
+		if err != nil || !ok {
+			// without half-closes, the first direction to end ends both.
+			_ = a.Close()
+			_ = b.Close()
+			return
+		}
+		_ = cw.CloseWrite()
+	}
+
+	go pipe(a, b)
+	go pipe(b, a)
+	wg.Wait()
+
+	_ = a.Close()
+	_ = b.Close()
+}
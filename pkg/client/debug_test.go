@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestDebugSplicesUpgradedConnection(t *testing.T) {
+	// the instance echoes what it receives, once its input is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		instance, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, _ := ioutil.ReadAll(instance)
+		_, _ = instance.Write(b)
+		_ = instance.Close()
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("run_id") != "abc" || r.URL.Query().Get("port") != "6060" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		peer, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", DebugUpgrade)
+		_ = buf.Flush()
+		Splice(BufferedConn(conn, buf.Reader), peer)
+	}))
+	defer srv.Close()
+
+	cfg := &config.EnvConfig{}
+	cfg.Client.Endpoint = srv.URL
+	cl := New(cfg)
+
+	conn, err := cl.Debug(context.Background(), &api.DebugRequest{RunID: "abc", Port: 6060})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(interface{ CloseWrite() error }).CloseWrite())
+
+	b, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+}
+
+func TestDebugReportsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "runner local:exec does not support debugging", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	cfg := &config.EnvConfig{}
+	cfg.Client.Endpoint = srv.URL
+	cl := New(cfg)
+
+	_, err := cl.Debug(context.Background(), &api.DebugRequest{RunID: "abc"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not support debugging")
+}
@@ -8,4 +8,8 @@
 //
 // Currently all commands to Testground, but the `daemon` command, are
 // client-side commands.
+//
+// Programs can drive a daemon through the same client, instead of invoking
+// the CLI and scraping its output: BuildPlan, RunPlan, TaskStatus, TaskLogs,
+// WaitTask, CollectRunOutputs and CancelTask return typed results.
 package client
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+// The methods below pair a request to the daemon with the parsing of its
+// response, for programs that drive Testground without the CLI. The output
+// of the daemon is written to progress, which may be nil to discard it.
+
+// BuildPlan builds a test plan, and returns the ID of the build task.
+func (c *Client) BuildPlan(ctx context.Context, r *api.BuildRequest, plandir, sdkdir string, extraSrcs []string, progress io.Writer) (string, error) {
+	resp, err := c.Build(ctx, r, plandir, sdkdir, extraSrcs)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+
+	return ParseBuildResponse(resp, progress)
+}
+
+// RunPlan schedules a run of a test plan, and returns the ID of the run task.
+// Use WaitTask to wait for the run to end.
+func (c *Client) RunPlan(ctx context.Context, r *api.RunRequest, plandir, sdkdir string, extraSrcs []string, progress io.Writer) (string, error) {
+	resp, err := c.Run(ctx, r, plandir, sdkdir, extraSrcs)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+
+	return ParseRunResponse(resp, progress)
+}
+
+// TaskStatus returns the current state of a task.
+func (c *Client) TaskStatus(ctx context.Context, taskID string) (*task.Task, error) {
+	resp, err := c.Status(ctx, &api.StatusRequest{TaskID: taskID})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	tsk, err := ParseStatusResponse(resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tsk, nil
+}
+
+// TaskLogs writes the logs of a task to w, and returns the task. With follow,
+// it waits for the task to end, streaming its logs as they are written.
+func (c *Client) TaskLogs(ctx context.Context, taskID string, follow bool, w io.Writer) (*task.Task, error) {
+	resp, err := c.Logs(ctx, &api.LogsRequest{TaskID: taskID, Follow: follow})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	tsk, err := ParseLogsRequest(w, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &tsk, nil
+}
+
+// WaitTask waits for a task to complete or be canceled, and returns it. The
+// logs of the task are written to logs, which may be nil. Canceling ctx stops
+// waiting, but leaves the task running.
+func (c *Client) WaitTask(ctx context.Context, taskID string, logs io.Writer) (*task.Task, error) {
+	tsk, err := c.TaskLogs(ctx, taskID, true, logs)
+	if err != nil {
+		return nil, err
+	}
+	if s := tsk.State().State; s != task.StateComplete && s != task.StateCanceled {
+		return nil, fmt.Errorf("task %s did not end; state: %s", taskID, s)
+	}
+	return tsk, nil
+}
+
+// CollectRunOutputs writes the outputs archive of a run to w. It returns
+// false if the run has no outputs.
+func (c *Client) CollectRunOutputs(ctx context.Context, r *api.OutputsRequest, w io.Writer, progress io.Writer) (bool, error) {
+	resp, err := c.CollectOutputs(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Close()
+
+	res, err := ParseCollectResponse(resp, w, progress)
+	if err != nil {
+		return false, err
+	}
+	return res.Exists, nil
+}
+
+// CancelTask cancels a task in progress.
+func (c *Client) CancelTask(ctx context.Context, taskID string) error {
+	resp, err := c.Cancel(ctx, &api.CancelRequest{TaskID: taskID})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	return ParseCancelResponse(resp, nil)
+}
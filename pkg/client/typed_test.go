@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestTypedMethods(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
+		ow := rpc.NewOutputWriter(w, r)
+		_, _ = ow.WriteProgress([]byte("instance output\n"))
+		ow.WriteResult(&task.Task{
+			ID:     "abc",
+			States: []task.DatedState{{Created: time.Now(), State: task.StateComplete}},
+		})
+	})
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		ow := rpc.NewOutputWriter(w, r)
+		ow.WriteError("unknown task", "task_id", "xyz")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := &config.EnvConfig{}
+	cfg.Client.Endpoint = srv.URL
+	c := New(cfg)
+	defer c.Close()
+
+	var logs bytes.Buffer
+	tsk, err := c.WaitTask(context.Background(), "abc", &logs)
+	require.NoError(t, err)
+	require.Equal(t, "abc", tsk.ID)
+	require.Equal(t, task.StateComplete, tsk.State().State)
+	require.Equal(t, "instance output\n", logs.String())
+
+	require.Error(t, c.CancelTask(context.Background(), "xyz"))
+}
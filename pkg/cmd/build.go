@@ -49,6 +49,10 @@ var BuildCommand = cli.Command{
 					Name:  "wait",
 					Usage: "wait for the task to complete",
 				},
+				&cli.StringFlag{
+					Name:  "notify-url",
+					Usage: "POST a JSON notification to `URL` when the task ends, if the daemon allows it (see notify_urls)",
+				},
 			},
 		},
 		&cli.Command{
@@ -62,10 +66,9 @@ var BuildCommand = cli.Command{
 					Usage: "set a build config parameter",
 				},
 				&cli.StringFlag{
-					Name:     "builder",
-					Aliases:  []string{"b"},
-					Usage:    "specifies the builder to use; values include: 'docker:go', 'exec:go'",
-					Required: true,
+					Name:    "builder",
+					Aliases: []string{"b"},
+					Usage:   "specifies the builder to use; values include: 'docker:go', 'exec:go' (default: the builder of the client configuration or profile)",
 				},
 				&cli.StringSliceFlag{
 					Name:    "dep",
@@ -82,10 +85,18 @@ var BuildCommand = cli.Command{
 					Usage:    "specifies the plan to run",
 					Required: true,
 				},
+				&cli.StringFlag{
+					Name:  "plan-source",
+					Usage: "have the daemon fetch the plan from `SOURCE`: git+<url>[//<dir>][?ref=<ref>] or oci://<image>[//<dir>]",
+				},
 				&cli.BoolFlag{
 					Name:  "wait",
 					Usage: "Wait for the task to complete",
 				},
+				&cli.StringFlag{
+					Name:  "notify-url",
+					Usage: "POST a JSON notification to `URL` when the task ends, if the daemon allows it (see notify_urls)",
+				},
 			},
 		},
 		&cli.Command{
@@ -123,6 +134,10 @@ func buildCompositionCmd(c *cli.Context) (err error) {
 		return fmt.Errorf("failed to load composition file: %w", err)
 	}
 
+	if err = applyClientDefaults(comp); err != nil {
+		return err
+	}
+
 	if err = comp.ValidateForBuild(); err != nil {
 		return fmt.Errorf("invalid composition file: %w", err)
 	}
@@ -161,11 +176,25 @@ func build(c *cli.Context, comp *api.Composition) error {
 	ctx, cancel := context.WithCancel(ProcessContext())
 	defer cancel()
 
-	// Resolve the test plan and its manifest.
-	var manifest *api.TestPlanManifest
-	planDir, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
-	if err != nil {
-		return fmt.Errorf("failed to resolve test plan: %w", err)
+	// Resolve the test plan and its manifest; plans with a plan source, or
+	// published to the plan registry, are fetched and prepared by the daemon.
+	var (
+		manifest = new(api.TestPlanManifest)
+		planDir  string
+	)
+	if !comp.Global.RemotePlan() {
+		planDir, manifest, err = resolveTestPlan(cfg, comp.Global.Plan)
+		if err != nil {
+			return fmt.Errorf("failed to resolve test plan: %w", err)
+		}
+		logging.S().Infof("test plan source at: %s", planDir)
+
+		comp, err = comp.PrepareForBuild(manifest)
+		if err != nil {
+			return err
+		}
+	} else {
+		logging.S().Infof("test plan source at: %s", comp.Global.PlanSource)
 	}
 
 	var (
@@ -173,19 +202,13 @@ func build(c *cli.Context, comp *api.Composition) error {
 		sdkDir  string
 	)
 
-	logging.S().Infof("test plan source at: %s", planDir)
-
-	comp, err = comp.PrepareForBuild(manifest)
-	if err != nil {
-		return err
-	}
-
 	req := &api.BuildRequest{
 		Composition: *comp,
 		Manifest:    *manifest,
 		CreatedBy: api.CreatedBy{
 			User: cfg.Client.User,
 		},
+		NotifyURL: c.String("notify-url"),
 	}
 
 	if wait {
@@ -10,6 +10,7 @@ import (
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/runner"
 
 	"github.com/urfave/cli/v2"
 )
@@ -32,6 +33,39 @@ var CollectCommand = cli.Command{
 			Aliases: []string{"o"},
 			Usage:   "write the output archive to `FILENAME`",
 		},
+		&cli.BoolFlag{
+			Name:  "dedup",
+			Usage: "store identical output files once in the archive; use --extract to restore them",
+		},
+		&cli.StringFlag{
+			Name:  "extract",
+			Usage: "extract the archive into `DIR`, restoring deduplicated files",
+		},
+		&cli.StringSliceFlag{
+			Name:  "group",
+			Usage: "only collect the outputs of the instances of `GROUP`; can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "instance",
+			Usage: "only collect the outputs of the instances in `RANGES` of each group, e.g. 0-4,7",
+		},
+		&cli.StringSliceFlag{
+			Name:  "glob",
+			Usage: "only collect the files matching `PATTERN`, relative to the outputs of their instance, e.g. 'metrics/*'; can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "compression",
+			Usage: "compress the archive with `FORMAT`: gzip or zstd; zstd is much faster on large outputs",
+			Value: runner.OutputsCompressionGzip,
+		},
+		&cli.IntFlag{
+			Name:  "compression-level",
+			Usage: "compression `LEVEL`, from 1, the fastest, to 9, the smallest (default: that of the format)",
+		},
+		&cli.BoolFlag{
+			Name:  "preview",
+			Usage: "report the number and size of the files that would be collected, by group, without collecting them",
+		},
 	},
 }
 
@@ -43,10 +77,14 @@ func collectCommand(c *cli.Context) error {
 		return errors.New("missing run id")
 	}
 
+	if err := runner.CheckOutputsCompression(c.String("compression"), c.Int("compression-level")); err != nil {
+		return err
+	}
+
 	var (
-		id     = c.Args().First()
-		runner = c.String("runner")
-		output = id + ".tgz"
+		id       = c.Args().First()
+		runnerID = c.String("runner")
+		output   = id + runner.OutputsArchiveExt(c.String("compression"))
 	)
 
 	if o := c.String("output"); o != "" {
@@ -58,15 +96,46 @@ func collectCommand(c *cli.Context) error {
 		return err
 	}
 
-	return collect(ctx, cl, c.App.Writer, runner, id, output)
-}
-
-func collect(ctx context.Context, cl *client.Client, stdout io.Writer, runner string, runid string, outputFile string) error {
 	req := &api.OutputsRequest{
-		Runner: runner,
-		RunID:  runid,
+		Runner:  runnerID,
+		RunID:   id,
+		Dedup:   c.Bool("dedup"),
+		Preview: c.Bool("preview"),
+
+		Compression:      c.String("compression"),
+		CompressionLevel: c.Int("compression-level"),
+	}
+	if c.IsSet("group") || c.IsSet("instance") || c.IsSet("glob") {
+		req.Filter = &api.OutputsFilter{
+			Groups:    c.StringSlice("group"),
+			Instances: c.String("instance"),
+			Globs:     c.StringSlice("glob"),
+		}
+	}
+
+	if req.Preview {
+		return collectPreview(ctx, cl, c.App.Writer, req)
+	}
+
+	if err := collect(ctx, cl, c.App.Writer, req, output); err != nil {
+		return err
 	}
 
+	if _, err := os.Stat(output); err != nil {
+		// the run was not found.
+		return nil
+	}
+
+	if dir := c.String("extract"); dir != "" {
+		if err := runner.ExtractOutputs(output, dir); err != nil {
+			return fmt.Errorf("failed to extract outputs: %w", err)
+		}
+		logging.S().Infof("extracted outputs to: %s", dir)
+	}
+	return nil
+}
+
+func collect(ctx context.Context, cl *client.Client, stdout io.Writer, req *api.OutputsRequest, outputFile string) error {
 	resp, err := cl.CollectOutputs(ctx, req)
 	if err != nil {
 		if err == context.Canceled {
@@ -91,7 +160,7 @@ func collect(ctx context.Context, cl *client.Client, stdout io.Writer, runner st
 	}
 
 	if !cr.Exists {
-		logging.S().Errorw("no such testplan run", "run_id", runid, "runner", runner)
+		logging.S().Errorw("no such testplan run", "run_id", req.RunID, "runner", req.Runner)
 
 		return os.Remove(outputFile)
 	}
@@ -99,3 +168,24 @@ func collect(ctx context.Context, cl *client.Client, stdout io.Writer, runner st
 	logging.S().Infof("created file: %s", outputFile)
 	return nil
 }
+
+// collectPreview prints what collecting the outputs of a run would archive.
+func collectPreview(ctx context.Context, cl *client.Client, stdout io.Writer, req *api.OutputsRequest) error {
+	resp, err := cl.CollectOutputs(ctx, req)
+	if err != nil {
+		if err == context.Canceled {
+			return fmt.Errorf("interrupted")
+		}
+		return err
+	}
+	defer resp.Close()
+
+	cr, err := client.ParseCollectResponse(resp, io.Discard, stdout)
+	if err != nil {
+		return err
+	}
+	if !cr.Exists {
+		logging.S().Errorw("no such testplan run", "run_id", req.RunID, "runner", req.Runner)
+	}
+	return nil
+}
@@ -37,6 +37,7 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	var (
 		// Global struct
 		plan           = c.String("plan")
+		planSource     = c.String("plan-source")
 		testcase       = c.String("testcase")
 		instances      = c.Uint("instances")
 		builder        = c.String("builder")
@@ -56,6 +57,7 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	comp := &api.Composition{
 		Global: api.Global{
 			Plan:           plan,
+			PlanSource:     planSource,
 			Case:           testcase,
 			Builder:        builder,
 			Runner:         runner,
@@ -115,6 +117,10 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 		comp.Groups[0].Build.Dependencies = append(comp.Groups[0].Build.Dependencies, dep)
 	}
 
+	if err = applyClientDefaults(comp); err != nil {
+		return nil, err
+	}
+
 	comp = comp.GenerateDefaultRun()
 
 	// Validate the composition before returning it.
@@ -130,6 +136,48 @@ func createSingletonComposition(c *cli.Context) (*api.Composition, error) {
 	return comp, err
 }
 
+// applyClientDefaults sets the runner and the builder of a composition that
+// doesn't set them to the defaults of the client configuration, and adds the
+// builder configuration of the selected profile, if any, to the groups.
+// Values set by the composition take precedence.
+func applyClientDefaults(comp *api.Composition) error {
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		return err
+	}
+
+	if comp.Global.Runner == "" {
+		comp.Global.Runner = cfg.Client.Runner
+	}
+	if comp.Global.Builder == "" {
+		comp.Global.Builder = cfg.Client.Builder
+	}
+
+	if cfg.Profile == "" {
+		return nil
+	}
+	profile := cfg.Profiles[cfg.Profile]
+	for _, g := range comp.Groups {
+		builder := g.Builder
+		if builder == "" {
+			builder = comp.Global.Builder
+		}
+		for k, v := range profile.Builders[builder] {
+			if _, ok := comp.Global.BuildConfig[k]; ok {
+				continue
+			}
+			if _, ok := g.BuildConfig[k]; ok {
+				continue
+			}
+			if g.BuildConfig == nil {
+				g.BuildConfig = make(map[string]interface{})
+			}
+			g.BuildConfig[k] = v
+		}
+	}
+	return nil
+}
+
 // resolveTestPlan resolves a test plan, returning its root directory and its
 // parsed manifest.
 func resolveTestPlan(cfg *config.EnvConfig, name string) (string, *api.TestPlanManifest, error) {
@@ -157,6 +205,23 @@ func resolveTestPlan(cfg *config.EnvConfig, name string) (string, *api.TestPlanM
 	return path, plan, nil
 }
 
+// resolveExtraSources returns the extra sources the manifest of a test plan
+// declares for a builder, contextualized to the directory of the plan.
+func resolveExtraSources(manifest *api.TestPlanManifest, builder, planDir string) ([]string, error) {
+	extraSrcs := manifest.ExtraSources[strings.Replace(builder, ":", "_", -1)]
+	for i, dir := range extraSrcs {
+		if !filepath.IsAbs(dir) {
+			// follow any symlinks in the plan dir.
+			evalPlanDir, err := filepath.EvalSymlinks(planDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to follow symlinks in plan dir: %w", err)
+			}
+			extraSrcs[i] = filepath.Clean(filepath.Join(evalPlanDir, dir))
+		}
+	}
+	return extraSrcs, nil
+}
+
 // resolveSDK resolves the root directory of an SDK.
 func resolveSDK(cfg *config.EnvConfig, path string) (string, error) {
 	baseDir := cfg.Dirs().SDKs()
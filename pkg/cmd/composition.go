@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/logging"
+)
+
+// CompositionCommand is the specification of the `composition` command.
+var CompositionCommand = cli.Command{
+	Name:  "composition",
+	Usage: "work with compositions",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:  "lint",
+			Usage: "check a composition for common anti-patterns",
+			Description: "Flags what is valid in a composition, but most likely a mistake: total_instances that differ from " +
+				"the sum of the groups, groups without resources on cluster runners, builders without build_config, " +
+				"test params the test case doesn't declare, and template actions that render as empty strings.\n" +
+				"Builders and test params are checked against the manifest of the plan in $TESTGROUND_HOME/plans, if found.",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "file",
+					Aliases:  []string{"f"},
+					Usage:    "path to a `COMPOSITION`",
+					Required: true,
+				},
+			},
+			Action: lintCompositionCommand,
+		},
+	},
+}
+
+func lintCompositionCommand(c *cli.Context) error {
+	file := c.String("file")
+
+	data := &compositionData{Env: compositionEnv()}
+
+	issues, err := api.LintCompositionTemplate(file, data)
+	if err != nil {
+		return fmt.Errorf("failed to process composition template: %w", err)
+	}
+
+	comp, err := api.LoadComposition(file, data)
+	if err != nil {
+		return err
+	}
+
+	// check builders and test params against the manifest, unless the plan
+	// is fetched by the daemon.
+	var manifest *api.TestPlanManifest
+	if !comp.Global.RemotePlan() {
+		cfg := &config.EnvConfig{}
+		if err := cfg.Load(); err != nil {
+			return err
+		}
+		if _, manifest, err = resolveTestPlan(cfg, comp.Global.Plan); err != nil {
+			logging.S().Warnw("not checking builders and test params", "err", err)
+		}
+	}
+
+	issues = append(issues, comp.Lint(manifest)...)
+	if len(issues) == 0 {
+		fmt.Fprintln(c.App.Writer, "no issues found")
+		return nil
+	}
+
+	for _, i := range issues {
+		fmt.Fprintln(c.App.Writer, i)
+	}
+	return fmt.Errorf("found %d issue(s) in %s", len(issues), file)
+}
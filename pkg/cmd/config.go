@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/engine"
+)
+
+// ConfigCommand is the specification of the `config` command.
+var ConfigCommand = cli.Command{
+	Name:  "config",
+	Usage: "check and upgrade the .env.toml configuration",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:  "validate",
+			Usage: "validate .env.toml against the configuration schema",
+			Description: "Reports the keys of .env.toml that testground doesn't know, and where they likely belong, " +
+				"including those in the configuration of builders and runners.",
+			Action: validateConfigCommand,
+		},
+		&cli.Command{
+			Name:  "migrate",
+			Usage: "upgrade .env.toml from older layouts to the current one",
+			Description: "Moves the keys of older layouts of .env.toml to where they belong now. The original file is " +
+				"kept as .env.toml.bak. Comments are not preserved.",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the upgraded configuration instead of writing it",
+				},
+			},
+			Action: migrateConfigCommand,
+		},
+	},
+}
+
+func validateConfigCommand(c *cli.Context) error {
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		return err
+	}
+	if err := engine.CheckEnvConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.Writer, "%s is valid\n", cfg.Dirs().EnvFile())
+	return nil
+}
+
+func migrateConfigCommand(c *cli.Context) error {
+	// the configuration can't be loaded before it's migrated.
+	cfg := &config.EnvConfig{}
+	if err := cfg.EnsureMinimalConfig(); err != nil {
+		return err
+	}
+	f := cfg.Dirs().EnvFile()
+
+	orig, err := os.ReadFile(f)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(orig), &raw); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f, err)
+	}
+
+	changes := config.Migrate(raw)
+	if len(changes) == 0 {
+		fmt.Fprintf(c.App.Writer, "%s is up to date\n", f)
+		return nil
+	}
+	for _, ch := range changes {
+		fmt.Fprintln(c.App.Writer, ch)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+
+	if c.Bool("dry-run") {
+		fmt.Fprintln(c.App.Writer)
+		_, err := c.App.Writer.Write(buf.Bytes())
+		return err
+	}
+
+	if err := os.WriteFile(f+".bak", orig, 0600); err != nil {
+		return fmt.Errorf("failed to back up configuration: %w", err)
+	}
+	if err := os.WriteFile(f, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "upgraded %s; the original is at %s.bak\n", f, f)
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/daemon"
+	"github.com/testground/testground/pkg/engine"
 	"github.com/testground/testground/pkg/logging"
 
 	"github.com/urfave/cli/v2"
@@ -27,6 +28,9 @@ func daemonCommand(c *cli.Context) error {
 	if err := cfg.Load(); err != nil {
 		return err
 	}
+	if err := engine.CheckEnvConfig(cfg); err != nil {
+		return err
+	}
 
 	srv, err := daemon.New(cfg)
 	if err != nil {
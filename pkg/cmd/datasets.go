@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+)
+
+var DatasetsCommand = cli.Command{
+	Name:   "datasets",
+	Usage:  "list the datasets served to test instances by the daemon",
+	Action: datasetsCommand,
+}
+
+func datasetsCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	list, err := cl.Datasets(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "NAME\tCACHED\tSIZE\tSOURCE")
+
+	for _, d := range list {
+		size := "-"
+		if d.Cached {
+			size = humanize.IBytes(uint64(d.Size))
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", d.Name, d.Cached, size, d.Source)
+	}
+
+	return w.Flush()
+}
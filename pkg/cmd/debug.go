@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/logging"
+)
+
+var DebugCommand = cli.Command{
+	Name:      "debug",
+	Usage:     "open a shell in a live instance of a run, or forward one of its ports",
+	UsageText: "testground debug --run <id> --instance <n> [--shell | --port-forward [local:]remote]",
+	Action:    debugCommand,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "run",
+			Usage:    "the run id",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "group",
+			Usage: "the group of the instance; only needed if several groups have an instance with the given index",
+		},
+		&cli.IntFlag{
+			Name:  "instance",
+			Usage: "the index of the instance within its group",
+		},
+		&cli.BoolFlag{
+			Name:  "shell",
+			Usage: "open a shell in the instance (default)",
+		},
+		&cli.StringFlag{
+			Name:  "port-forward",
+			Usage: "forward a local port to a port of the instance, e.g. 6060 or 8080:6060",
+		},
+	},
+}
+
+func debugCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	if c.Bool("shell") && c.IsSet("port-forward") {
+		return errors.New("--shell and --port-forward are mutually exclusive")
+	}
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	req := &api.DebugRequest{
+		RunID:    c.String("run"),
+		Group:    c.String("group"),
+		Instance: c.Int("instance"),
+	}
+
+	if pf := c.String("port-forward"); pf != "" {
+		local, remote, err := parsePortForward(pf)
+		if err != nil {
+			return err
+		}
+		req.Port = remote
+		return debugPortForward(ctx, cl, req, local)
+	}
+	return debugShell(ctx, cl, req)
+}
+
+// parsePortForward parses a [local:]remote port specification.
+func parsePortForward(s string) (local, remote int, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	ports := make([]int, len(parts))
+	for i, p := range parts {
+		if ports[i], err = strconv.Atoi(p); err != nil || ports[i] <= 0 || ports[i] > 65535 {
+			return 0, 0, fmt.Errorf("invalid port forward: %s", s)
+		}
+	}
+	return ports[0], ports[len(ports)-1], nil
+}
+
+func debugShell(ctx context.Context, cl *client.Client, req *api.DebugRequest) error {
+	fd, isTerm := term.GetFdInfo(os.Stdin)
+	if isTerm {
+		if ws, err := term.GetWinsize(fd); err == nil {
+			req.Rows, req.Cols = uint(ws.Height), uint(ws.Width)
+		}
+	}
+
+	conn, err := cl.Debug(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if isTerm {
+		state, err := term.SetRawTerminal(fd)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = term.RestoreTerminal(fd, state) }()
+	}
+
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+
+	// the session ends when the shell exits.
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
+
+func debugPortForward(ctx context.Context, cl *client.Client, req *api.DebugRequest, port int) error {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	logging.S().Infof("forwarding %s to port %d of instance %d of run %s; press Ctrl+C to stop", l.Addr(), req.Port, req.Instance, req.RunID)
+
+	for {
+		local, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			remote, err := cl.Debug(ctx, req)
+			if err != nil {
+				logging.S().Warnw("failed to forward connection", "err", err)
+				_ = local.Close()
+				return
+			}
+			client.Splice(local, remote)
+		}()
+	}
+}
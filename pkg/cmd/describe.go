@@ -1,32 +1,45 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/config"
 )
 
 // DescribeCommand is the specification of the `describe` command.
 var DescribeCommand = cli.Command{
-	Name:        "describe",
-	Usage:       "describe a test plan",
-	Description: "Loads the test plan manifest from $TESTGROUND_HOME/plans/<plan>, and explains its contents",
+	Name:      "describe",
+	Usage:     "describe a test plan, or the record of a run",
+	ArgsUsage: "[<run-id>]",
+	Description: "With --plan, loads the test plan manifest from $TESTGROUND_HOME/plans/<plan>, and explains its contents.\n" +
+		"With a run ID, prints the immutable record of that run, as kept by the daemon.",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:     "plan",
-			Aliases:  []string{"p"},
-			Usage:    "describe plan with name `NAME`",
-			Required: true,
+			Name:    "plan",
+			Aliases: []string{"p"},
+			Usage:   "describe plan with name `NAME`",
 		},
 	},
 	Action: describeCommand,
 }
 
 func describeCommand(c *cli.Context) error {
+	if runID := c.Args().First(); runID != "" {
+		return describeRun(c, runID)
+	}
+
 	plan := c.String("plan")
+	if plan == "" {
+		return errors.New("either a run ID or --plan must be supplied")
+	}
 
 	cfg := &config.EnvConfig{}
 	if err := cfg.Load(); err != nil {
@@ -49,3 +62,31 @@ func describeCommand(c *cli.Context) error {
 
 	return nil
 }
+
+func describeRun(c *cli.Context, runID string) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.DescribeRun(ctx, &api.DescribeRunRequest{RunID: runID})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	rec, err := client.ParseDescribeRunResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, string(b))
+	return nil
+}
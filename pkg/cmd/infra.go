@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+var InfraCommand = cli.Command{
+	Name:  "infra",
+	Usage: "manage the infrastructure containers of a runner",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:   "upgrade",
+			Usage:  "replace the infrastructure containers running other images than the ones pinned in [daemon.infra.images]",
+			Action: infraUpgradeCommand,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "runner",
+					Usage:    "specifies the runner to upgrade; values include: 'local:exec', 'local:docker'",
+					Required: true,
+				},
+			},
+		},
+	},
+}
+
+func infraUpgradeCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	runner := c.String("runner")
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.InfraUpgrade(ctx, &api.InfraUpgradeRequest{Runner: runner})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	resp, err := client.ParseHealthcheckResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("finished upgrading runner %s\n", runner)
+	fmt.Println(resp.String())
+
+	if !resp.FixesSucceeded() {
+		return fmt.Errorf("upgrade failed")
+	}
+	return nil
+}
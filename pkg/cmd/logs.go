@@ -24,6 +24,10 @@ var LogsCommand = cli.Command{
 			Aliases: []string{"f"},
 			Usage:   "stream the logs until the task completes",
 		},
+		&cli.StringFlag{
+			Name:  "phase",
+			Usage: "only get the logs of a phase of the task; supported: 'build'",
+		},
 	},
 }
 
@@ -39,6 +43,7 @@ func logsCommand(c *cli.Context) error {
 	r, err := cl.Logs(ctx, &api.LogsRequest{
 		TaskID: c.String("task"),
 		Follow: c.Bool("follow"),
+		Phase:  c.String("phase"),
 	})
 	if err != nil {
 		return err
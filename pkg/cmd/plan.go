@@ -107,7 +107,47 @@ var PlanCommand = cli.Command{
 					Name:  "testcases",
 					Usage: "display testcases",
 				},
+				&cli.BoolFlag{
+					Name:  "registry",
+					Usage: "enumerate the plans published to the plan registry of the daemon instead",
+				},
+			},
+		},
+		&cli.Command{
+			Name:  "publish",
+			Usage: "publish a plan from $TESTGROUND_HOME to the plan registry of the daemon, so that compositions can reference it as <name>@<version>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "plan",
+					Aliases:  []string{"p"},
+					Usage:    "specifies the plan to publish",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "version",
+					Usage:    "publish the plan as version `VERSION`; versions can't be overwritten",
+					Required: true,
+				},
 			},
+			Action: publishCommand,
+		},
+		&cli.Command{
+			Name:  "info",
+			Usage: "describe a plan published to the plan registry of the daemon",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "plan",
+					Aliases:  []string{"p"},
+					Usage:    "specifies the published plan",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "version",
+					Usage: "describe version `VERSION` of the plan",
+					Value: "latest",
+				},
+			},
+			Action: infoCommand,
 		},
 	},
 }
@@ -293,6 +333,10 @@ func rmCommand(c *cli.Context) error {
 }
 
 func listCommand(c *cli.Context) error {
+	if c.Bool("registry") {
+		return listRegistryCommand(c)
+	}
+
 	cfg := &config.EnvConfig{}
 	if err := cfg.Load(); err != nil {
 		return err
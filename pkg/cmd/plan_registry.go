@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+func publishCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, cfg, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	planDir, _, err := resolveTestPlan(cfg, c.String("plan"))
+	if err != nil {
+		return fmt.Errorf("failed to resolve test plan: %w", err)
+	}
+
+	r, err := cl.PublishPlan(ctx, &api.PublishPlanRequest{
+		Version:   c.String("version"),
+		CreatedBy: api.CreatedBy{User: cfg.Client.User},
+	}, planDir)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	plan, err := client.ParsePublishPlanResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(c.App.Writer, "published %s@%s (source hash: %s)\n", plan.Name, plan.Version, plan.SourceHash)
+	return nil
+}
+
+func listRegistryCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.Plans(ctx, &api.PlansRequest{})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	plans, err := client.ParsePlansResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.App.Writer, 1, 1, 1, ' ', 0)
+	defer tw.Flush()
+
+	for _, p := range plans {
+		ref := p.Name + "@" + p.Version
+		if c.Bool("testcases") {
+			for _, tc := range p.Manifest.TestCases {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\n", ref, tc.Name)
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", ref, p.PublishedAt.Format(time.RFC3339), p.PublishedBy.User)
+	}
+	return nil
+}
+
+func infoCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.PlanInfo(ctx, &api.PlanInfoRequest{Plan: c.String("plan"), Version: c.String("version")})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	plan, err := client.ParsePlanInfoResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	w := c.App.Writer
+	_, _ = fmt.Fprintf(w, "Version %s, published at %s by %s.\n", plan.Version, plan.PublishedAt.Format(time.RFC3339), plan.PublishedBy.User)
+	_, _ = fmt.Fprintf(w, "Source hash: %s\n\n", plan.SourceHash)
+
+	plan.Manifest.Describe(w)
+	_, _ = fmt.Fprint(w, "TEST CASES:\n----------\n\n")
+	for _, tc := range plan.Manifest.TestCases {
+		tc.Describe(w)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/logging"
+)
+
+// ReproduceCommand is the specification of the `reproduce` command.
+var ReproduceCommand = cli.Command{
+	Name:      "reproduce",
+	Usage:     "re-run a previous run, exactly as it was recorded",
+	ArgsUsage: "<run-id>",
+	Description: "Re-submits the composition recorded for a run, pinning every artifact to its recorded digest.\n" +
+		"With --rebuild, the artifacts are rebuilt from the local plan sources instead, which must match the recorded source hash.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "rebuild",
+			Usage: "rebuild the artifacts from the plan sources, instead of reusing the recorded ones",
+		},
+		&cli.StringFlag{
+			Name:  "link-sdk",
+			Usage: "when rebuilding, link the test plan with the SDK at `DIR`",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "wait for the task to complete",
+		},
+		&cli.BoolFlag{
+			Name:  "collect",
+			Usage: "collect assets at the end of the run phase; without --collect-file, it writes to <run_id>.tgz",
+		},
+		&cli.StringFlag{
+			Name:    "collect-file",
+			Aliases: []string{"o"},
+			Usage:   "write the collection output archive to `FILENAME`",
+		},
+		&cli.StringFlag{
+			Name:    ResultFileOpt,
+			Aliases: []string{"O"},
+			Usage:   "write the results csv `FILENAME`",
+		},
+		&cli.StringFlag{
+			Name:  "notify-url",
+			Usage: "POST a JSON notification to `URL` when the task ends, if the daemon allows it (see notify_urls)",
+		},
+	},
+	Action: reproduceCommand,
+}
+
+func reproduceCommand(c *cli.Context) error {
+	runID := c.Args().First()
+	if runID == "" {
+		return errors.New("missing run ID")
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.DescribeRun(ctx, &api.DescribeRunRequest{RunID: runID})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	rec, err := client.ParseDescribeRunResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	comp, pins, err := reproducibleComposition(&rec, c.Bool("rebuild"))
+	if err != nil {
+		return err
+	}
+
+	logging.S().Infow("reproducing run", "run_id", rec.RunID, "composition_run", comp.Runs[0].ID, "rebuild", c.Bool("rebuild"))
+	return runPinned(c, comp, pins)
+}
+
+// reproducibleComposition returns the composition to submit in order to
+// reproduce a recorded run, along with the pins the daemon must enforce.
+func reproducibleComposition(rec *api.RunRecord, rebuild bool) (*api.Composition, runPins, error) {
+	var pins runPins
+
+	compRun := rec.CompositionRun
+	if compRun == "" {
+		// records predating composition runs being recorded.
+		if len(rec.Composition.Runs) != 1 {
+			return nil, pins, fmt.Errorf("record of run %s does not specify which composition run was executed", rec.RunID)
+		}
+		compRun = rec.Composition.Runs[0].ID
+	}
+
+	comp, err := rec.Composition.FrameForRuns(compRun)
+	if err != nil {
+		return nil, pins, err
+	}
+
+	if !rebuild {
+		pins.ArtifactDigests = make(map[string]string, len(rec.Artifacts))
+		for _, a := range rec.Artifacts {
+			if a.Digest != "" {
+				pins.ArtifactDigests[a.Path] = a.Digest
+			}
+		}
+		return comp, pins, nil
+	}
+
+	// all artifacts of a run are built from the same sources, so they must
+	// agree on the source hash.
+	for id, a := range rec.Artifacts {
+		if a.Provenance == nil || a.Provenance.SourceHash == "" {
+			continue
+		}
+		if pins.SourceHash != "" && pins.SourceHash != a.Provenance.SourceHash {
+			return nil, pins, fmt.Errorf("artifacts of run %s were built from different sources; cannot rebuild group %s", rec.RunID, id)
+		}
+		pins.SourceHash = a.Provenance.SourceHash
+	}
+	if pins.SourceHash == "" {
+		logging.S().Warnw("run record has no source hash; rebuilt artifacts cannot be checked against the recorded sources", "run_id", rec.RunID)
+	}
+
+	for _, g := range comp.Groups {
+		g.Run.Artifact = ""
+	}
+	return comp, pins, nil
+}
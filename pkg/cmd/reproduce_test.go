@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func recordedRun() *api.RunRecord {
+	return &api.RunRecord{
+		RunID: "abc",
+		Composition: api.Composition{
+			Groups: api.Groups{
+				{ID: "a", Run: api.RunParams{Artifact: "img-a"}},
+				{ID: "b", Run: api.RunParams{Artifact: "img-b"}},
+			},
+			Runs: api.Runs{
+				{ID: "first", Groups: api.CompositionRunGroups{{ID: "a"}}},
+				{ID: "second", Groups: api.CompositionRunGroups{{ID: "b"}}},
+			},
+		},
+		CompositionRun: "second",
+		Artifacts: map[string]api.RecordedArtifact{
+			"b": {Path: "img-b", Digest: "sha256:bbb", Provenance: &api.Provenance{SourceHash: "1234"}},
+		},
+	}
+}
+
+func TestReproducibleCompositionPinsArtifacts(t *testing.T) {
+	comp, pins, err := reproducibleComposition(recordedRun(), false)
+	require.NoError(t, err)
+
+	require.Len(t, comp.Runs, 1)
+	require.Equal(t, "second", comp.Runs[0].ID)
+	require.Len(t, comp.Groups, 1)
+	require.Equal(t, "img-b", comp.Groups[0].Run.Artifact)
+	require.Equal(t, map[string]string{"img-b": "sha256:bbb"}, pins.ArtifactDigests)
+	require.Empty(t, pins.SourceHash)
+}
+
+func TestReproducibleCompositionRebuild(t *testing.T) {
+	comp, pins, err := reproducibleComposition(recordedRun(), true)
+	require.NoError(t, err)
+
+	require.Empty(t, comp.Groups[0].Run.Artifact)
+	require.Equal(t, "1234", pins.SourceHash)
+	require.Empty(t, pins.ArtifactDigests)
+}
+
+func TestReproducibleCompositionAmbiguousRun(t *testing.T) {
+	rec := recordedRun()
+	rec.CompositionRun = ""
+
+	_, _, err := reproducibleComposition(rec, false)
+	require.Error(t, err)
+}
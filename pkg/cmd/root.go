@@ -4,20 +4,31 @@ import (
 	"sort"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/config"
 )
 
 // RootCommands collects all subcommands of the testground CLI.
 var RootCommands = cli.CommandsByName{
 	&RunCommand,
+	&ReproduceCommand,
 	&PlanCommand,
 	&BuildCommand,
+	&CompositionCommand,
+	&ConfigCommand,
 	&DescribeCommand,
+	&ScaleCommand,
 	&SidecarCommand,
 	&DaemonCommand,
 	&CollectCommand,
+	&DebugCommand,
 	&TerminateCommand,
 	&HealthcheckCommand,
+	&InfraCommand,
 	&TasksCommand,
+	&StatsCommand,
+	&SweepCommand,
+	&DatasetsCommand,
 	&StatusCommand,
 	&LogsCommand,
 	&VersionCommand,
@@ -40,4 +51,9 @@ var RootFlags = []cli.Flag{
 		Name:  "endpoint",
 		Usage: "set the daemon endpoint `URI` (overrides .env.toml)",
 	},
+	&cli.StringFlag{
+		Name:    "profile",
+		Usage:   "apply the settings of profile `NAME` of .env.toml",
+		EnvVars: []string{config.EnvTestgroundProfile},
+	},
 }
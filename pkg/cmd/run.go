@@ -7,10 +7,10 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/rs/xid"
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/data"
@@ -70,6 +70,10 @@ var RunCommand = cli.Command{
 					Name:  "metadata-commit",
 					Usage: "commit that triggered this run",
 				},
+				&cli.Int64Flag{
+					Name:  "seed",
+					Usage: "seed the randomness of the run with `SEED`, e.g. to replay a run; overrides the seed of the composition (default: a random seed)",
+				},
 			),
 		},
 		&cli.Command{
@@ -96,10 +100,9 @@ var RunCommand = cli.Command{
 					DefaultText: "none",
 				},
 				&cli.StringFlag{
-					Name:     "runner",
-					Aliases:  []string{"r"},
-					Usage:    "runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s'",
-					Required: true,
+					Name:    "runner",
+					Aliases: []string{"r"},
+					Usage:   "runner to use; values include: 'local:exec', 'local:docker', 'cluster:k8s' (default: the runner of the client configuration or profile)",
 				},
 				&cli.StringSliceFlag{
 					Name:  "run-cfg",
@@ -137,8 +140,16 @@ var RunCommand = cli.Command{
 					Name:  "disable-metrics",
 					Usage: "disable metrics batching",
 				},
+				&cli.Int64Flag{
+					Name:  "seed",
+					Usage: "seed the randomness of the run with `SEED`, e.g. to replay a run (default: a random seed)",
+				},
 			),
 		},
+		runStoreCommand,
+		runPauseCommand,
+		runResumeCommand,
+		runCapacityCommand,
 	},
 }
 
@@ -154,6 +165,10 @@ func runCompositionCmd(c *cli.Context) (err error) {
 		return fmt.Errorf("failed to load composition file: %w", err)
 	}
 
+	if err = applyClientDefaults(comp); err != nil {
+		return err
+	}
+
 	if err = comp.ValidateForRun(); err != nil {
 		return fmt.Errorf("invalid composition file: %w", err)
 	}
@@ -176,6 +191,17 @@ func runSingleCmd(c *cli.Context) (err error) {
 }
 
 func run(c *cli.Context, comp *api.Composition) (err error) {
+	return runPinned(c, comp, runPins{})
+}
+
+// runPins pins the sources and artifacts of a run to known digests; the daemon
+// refuses to run if they differ.
+type runPins struct {
+	SourceHash      string
+	ArtifactDigests map[string]string
+}
+
+func runPinned(c *cli.Context, comp *api.Composition, pins runPins) (err error) {
 	cl, cfg, err := setupClient(c)
 	if err != nil {
 		return err
@@ -184,10 +210,22 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 	ctx, cancel := context.WithCancel(ProcessContext())
 	defer cancel()
 
-	// Resolve the test plan and its manifest.
-	planDir, manifest, err := resolveTestPlan(cfg, comp.Global.Plan)
-	if err != nil {
-		return fmt.Errorf("failed to resolve test plan: %w", err)
+	if c.IsSet("seed") {
+		comp.Global.Seed = c.Int64("seed")
+	}
+
+	// Resolve the test plan and its manifest; plans with a plan source, or
+	// published to the plan registry, are fetched by the daemon, which fills
+	// in the manifest.
+	var (
+		manifest = new(api.TestPlanManifest)
+		planDir  string
+	)
+	if !comp.Global.RemotePlan() {
+		planDir, manifest, err = resolveTestPlan(cfg, comp.Global.Plan)
+		if err != nil {
+			return fmt.Errorf("failed to resolve test plan: %w", err)
+		}
 	}
 
 	// Retrieve the run ids to use.
@@ -232,19 +270,8 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 			}
 			logging.S().Infof("linking with sdk at: %s", sdkDir)
 		}
-		// if there are extra sources to include for this builder, contextualize
-		// them to the plan's dir.
-		builder := strings.Replace(comp.Global.Builder, ":", "_", -1)
-		extraSrcs = manifest.ExtraSources[builder]
-		for i, dir := range extraSrcs {
-			if !filepath.IsAbs(dir) {
-				// follow any symlinks in the plan dir.
-				evalPlanDir, err := filepath.EvalSymlinks(planDir)
-				if err != nil {
-					return fmt.Errorf("failed to follow symlinks in plan dir: %w", err)
-				}
-				extraSrcs[i] = filepath.Clean(filepath.Join(evalPlanDir, dir))
-			}
+		if extraSrcs, err = resolveExtraSources(manifest, comp.Global.Builder, planDir); err != nil {
+			return err
 		}
 	} else {
 		planDir = ""
@@ -262,6 +289,14 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 		priority = 1
 	}
 
+	// The runs of a composition with several runs form a sweep, which the
+	// daemon reports on as a whole.
+	var sweep string
+	if isMultiple {
+		sweep = xid.New().String()
+		logging.S().Infof("runs are part of sweep: %s; see `testground sweep report %s`", sweep, sweep)
+	}
+
 	// Compute compositionTarget
 	compositionTarget := ""
 
@@ -292,6 +327,10 @@ func run(c *cli.Context, comp *api.Composition) (err error) {
 				Branch: c.String("metadata-branch"),
 				Commit: c.String("metadata-commit"),
 			},
+			SourceHash:      pins.SourceHash,
+			ArtifactDigests: pins.ArtifactDigests,
+			NotifyURL:       c.String("notify-url"),
+			Sweep:           sweep,
 		},
 		planDir:           planDir,
 		sdkDir:            sdkDir,
@@ -505,7 +544,8 @@ func (m *MultiRunStrategy) CurrentCollectedPath(taskId string) string {
 
 func (m *MultiRunStrategy) Collect(ctx context.Context, cl *client.Client, taskId string) error {
 	if m.isCollecting {
-		err := collect(ctx, cl, m.Stdout, m.Composition.Global.Runner, taskId, m.CurrentCollectedPath(taskId))
+		req := &api.OutputsRequest{Runner: m.Composition.Global.Runner, RunID: taskId}
+		err := collect(ctx, cl, m.Stdout, req, m.CurrentCollectedPath(taskId))
 
 		if err != nil {
 			return cli.Exit(err.Error(), 3)
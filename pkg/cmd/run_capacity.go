@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// runCapacityCommand runs a composition repeatedly, at growing instance
+// counts, to find the largest scale it sustains.
+var runCapacityCommand = &cli.Command{
+	Name:  "capacity",
+	Usage: "find the largest number of instances a composition sustains, by running it at growing scales",
+	Description: "Runs a run of a composition repeatedly, setting the instance count of the scaled groups to each scale tried,\n" +
+		"until a run fails: it errors (e.g. timeouts, resource exhaustion), or more than --max-failed of its instances fail.\n" +
+		"Scales are tried by binary search between --min and --max, or from --min up by --step.\n" +
+		"The artifacts built by the first run are reused by the next ones.",
+	Action: runCapacityCmd,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Aliases:  []string{"f"},
+			Usage:    "path to a `COMPOSITION`",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "link-sdk",
+			Usage: linkSdkUsage,
+		},
+		&cli.BoolFlag{
+			Name:    "ignore-artifacts",
+			Aliases: []string{"i"},
+			Usage:   "ignore any build artifacts present in the composition file",
+		},
+		&cli.StringFlag{
+			Name:  "run-id",
+			Usage: "run of the composition to scale (default: its only run)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "group",
+			Usage: "group of the run to scale; repeatable (default: all groups)",
+		},
+		&cli.UintFlag{
+			Name:  "min",
+			Usage: "smallest instance count to try",
+			Value: 1,
+		},
+		&cli.UintFlag{
+			Name:     "max",
+			Usage:    "largest instance count to try",
+			Required: true,
+		},
+		&cli.UintFlag{
+			Name:  "step",
+			Usage: "try instance counts from --min up by `STEP`, instead of searching them",
+		},
+		&cli.UintFlag{
+			Name:  "precision",
+			Usage: "stop the search once the largest passing and the smallest failing counts are at most `N` apart",
+			Value: 1,
+		},
+		&cli.Float64Flag{
+			Name:  "max-failed",
+			Usage: "fraction of the instances of a run that may fail, e.g. 0.05",
+		},
+	},
+}
+
+func runCapacityCmd(c *cli.Context) error {
+	var (
+		min, max  = c.Uint("min"), c.Uint("max")
+		maxFailed = c.Float64("max-failed")
+	)
+	switch {
+	case min == 0 || max < min:
+		return fmt.Errorf("invalid scales: --min %d, --max %d", min, max)
+	case maxFailed < 0 || maxFailed >= 1:
+		return fmt.Errorf("invalid --max-failed: %g", maxFailed)
+	}
+
+	comp, err := loadComposition(c.String("file"))
+	if err != nil {
+		return fmt.Errorf("failed to load composition file: %w", err)
+	}
+	if err = applyClientDefaults(comp); err != nil {
+		return err
+	}
+	if err = comp.ValidateForRun(); err != nil {
+		return fmt.Errorf("invalid composition file: %w", err)
+	}
+
+	runID := c.String("run-id")
+	if runID == "" {
+		if len(comp.Runs) != 1 {
+			return errors.New("the composition has several runs; pick one with --run-id")
+		}
+		runID = comp.Runs[0].ID
+	}
+	// check the groups to scale once, before running anything.
+	if err := scaleRun(comp, runID, c.StringSlice("group"), min); err != nil {
+		return err
+	}
+
+	cl, cfg, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	var (
+		manifest  = new(api.TestPlanManifest)
+		planDir   string
+		sdkDir    string
+		extraSrcs []string
+		buildIdx  []int
+	)
+	for i, grp := range comp.Groups {
+		if grp.Run.Artifact == "" || c.Bool("ignore-artifacts") {
+			buildIdx = append(buildIdx, i)
+		}
+	}
+	if len(buildIdx) > 0 && !comp.Global.RemotePlan() {
+		if planDir, manifest, err = resolveTestPlan(cfg, comp.Global.Plan); err != nil {
+			return fmt.Errorf("failed to resolve test plan: %w", err)
+		}
+		if sdk := c.String("link-sdk"); sdk != "" {
+			if sdkDir, err = resolveSDK(cfg, sdk); err != nil {
+				return fmt.Errorf("failed to resolve linked SDK directory: %w", err)
+			}
+		}
+		if extraSrcs, err = resolveExtraSources(manifest, comp.Global.Builder, planDir); err != nil {
+			return err
+		}
+	}
+
+	search := newCapacitySearch(min, max, c.Uint("step"), c.Uint("precision"))
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "INSTANCES\tTASK\tPASSED\tREASON")
+
+	for {
+		n, ok := search.next()
+		if !ok {
+			break
+		}
+		if err := scaleRun(comp, runID, c.StringSlice("group"), n); err != nil {
+			return err
+		}
+
+		req := &api.RunRequest{
+			BuildGroups: buildIdx,
+			Priority:    1,
+			RunIds:      []string{runID},
+			Composition: *comp,
+			Manifest:    *manifest,
+			CreatedBy:   api.CreatedBy{User: cfg.Client.User},
+		}
+		logging.S().Infow("trying scale", "instances", n)
+
+		tsk, err := runCapacityAttempt(ctx, cl, req, planDir, sdkDir, extraSrcs, c)
+		if err != nil {
+			return err
+		}
+
+		// reuse the artifacts of the first run.
+		if len(buildIdx) > 0 {
+			var effective api.Composition
+			if err := mapstructure.Decode(tsk.Composition, &effective); err != nil {
+				return err
+			}
+			for _, g := range effective.Groups {
+				if g.Run.Artifact == "" {
+					return fmt.Errorf("the run at %d instances ended before its artifacts were built: %s", n, tsk.Error)
+				}
+			}
+			comp, buildIdx, planDir, sdkDir, extraSrcs = &effective, nil, "", "", nil
+		}
+
+		passed, reason := capacityPassed(tsk, maxFailed)
+		search.record(n, passed)
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", n, tsk.ID, passed, reason)
+	}
+	_ = w.Flush()
+
+	if best, ok := search.result(); ok {
+		fmt.Fprintf(c.App.Writer, "max sustainable scale: %d instances\n", best)
+		return nil
+	}
+	return cli.Exit(fmt.Sprintf("no scale sustained, down to %d instances", min), 1)
+}
+
+// runCapacityAttempt runs a scale of a capacity search, and waits for it to
+// end. The run is canceled if the search is interrupted.
+func runCapacityAttempt(ctx context.Context, cl *client.Client, req *api.RunRequest, planDir, sdkDir string, extraSrcs []string, c *cli.Context) (*task.Task, error) {
+	id, err := cl.RunPlan(ctx, req, planDir, sdkDir, extraSrcs, c.App.Writer)
+	if err != nil {
+		return nil, err
+	}
+
+	tsk, err := cl.WaitTask(ctx, id, c.App.Writer)
+	if err != nil {
+		if ctx.Err() != nil {
+			_ = cl.CancelTask(context.Background(), id)
+		}
+		return nil, err
+	}
+	return tsk, nil
+}
+
+// scaleRun sets the instance count of groups of a run of a composition to n;
+// all its groups if none are given.
+func scaleRun(comp *api.Composition, runID string, groups []string, n uint) error {
+	var target *api.Run
+	for _, r := range comp.Runs {
+		if r.ID == runID {
+			target = r
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("unknown run: %s", runID)
+	}
+
+	scaled := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		scaled[g] = false
+	}
+	for _, g := range target.Groups {
+		if g.Instances.Percentage > 0 {
+			return fmt.Errorf("group %s of run %s is sized by percentage; size it by count to search capacity", g.ID, runID)
+		}
+		if _, ok := scaled[g.ID]; ok || len(groups) == 0 {
+			g.Instances.Count = n
+			scaled[g.ID] = true
+		}
+	}
+	for g, ok := range scaled {
+		if !ok {
+			return fmt.Errorf("unknown group of run %s: %s", runID, g)
+		}
+	}
+
+	// recomputed from the counts of the groups.
+	target.TotalInstances = 0
+	return nil
+}
+
+// capacityPassed returns whether a run sustained its scale: it completed
+// without error, and at most maxFailed of its instances failed. Otherwise, it
+// returns why not.
+func capacityPassed(tsk *task.Task, maxFailed float64) (bool, string) {
+	// runs that errored are canceled too; their error says why.
+	switch {
+	case tsk.Error != "":
+		return false, tsk.Error
+	case tsk.IsCanceled():
+		return false, "canceled"
+	}
+
+	res := data.DecodeRunnerResult(tsk.Result)
+	if res.Reason != "" {
+		return false, res.Reason
+	}
+	var ok, total int
+	for _, o := range res.Outcomes {
+		ok, total = ok+o.Ok, total+o.Total
+	}
+	if total == 0 {
+		if !data.IsOutcomeSuccess(res.Outcome) {
+			return false, fmt.Sprintf("outcome: %s", res.Outcome)
+		}
+		return true, ""
+	}
+	if failed := total - ok; float64(failed) > maxFailed*float64(total) {
+		return false, fmt.Sprintf("%d of %d instances failed", failed, total)
+	}
+	return true, ""
+}
+
+// capacitySearch schedules the instance counts tried by a capacity search:
+// from min up by step when step is set, or by binary search between min and
+// max otherwise, until the largest passing and the smallest failing counts
+// are at most precision apart.
+type capacitySearch struct {
+	min, max        uint
+	step, precision uint
+
+	// good is the largest count that passed, or min-1; bad is the smallest
+	// count that failed, or max+1.
+	good, bad uint
+}
+
+func newCapacitySearch(min, max, step, precision uint) *capacitySearch {
+	if precision == 0 {
+		precision = 1
+	}
+	return &capacitySearch{
+		min:       min,
+		max:       max,
+		step:      step,
+		precision: precision,
+		good:      min - 1,
+		bad:       max + 1,
+	}
+}
+
+// next returns the next count to try, or false once the search is over.
+func (s *capacitySearch) next() (uint, bool) {
+	if s.step == 0 {
+		if s.bad-s.good <= s.precision {
+			return 0, false
+		}
+		return s.good + (s.bad-s.good)/2, true
+	}
+
+	if s.bad <= s.max || s.good == s.max {
+		return 0, false
+	}
+	n := s.good + s.step
+	if s.good < s.min {
+		n = s.min
+	}
+	if n > s.max {
+		n = s.max
+	}
+	return n, true
+}
+
+// record records the outcome of the run at n instances.
+func (s *capacitySearch) record(n uint, passed bool) {
+	switch {
+	case passed && n > s.good:
+		s.good = n
+	case !passed && n < s.bad:
+		s.bad = n
+	}
+}
+
+// result returns the largest count that passed, if any.
+func (s *capacitySearch) result() (uint, bool) {
+	return s.good, s.good >= s.min
+}
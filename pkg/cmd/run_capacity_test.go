@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// searchCapacity runs a capacity search against a composition that sustains
+// at most capacity instances, and returns the counts tried.
+func searchCapacity(s *capacitySearch, capacity uint) []uint {
+	var tried []uint
+	for {
+		n, ok := s.next()
+		if !ok {
+			return tried
+		}
+		tried = append(tried, n)
+		s.record(n, n <= capacity)
+	}
+}
+
+func TestCapacitySearchBinary(t *testing.T) {
+	s := newCapacitySearch(1, 100, 0, 1)
+	tried := searchCapacity(s, 37)
+	best, ok := s.result()
+	require.True(t, ok)
+	require.EqualValues(t, 37, best)
+	require.LessOrEqual(t, len(tried), 7)
+
+	// with a precision of 10 instances, the search stops earlier.
+	s = newCapacitySearch(1, 100, 0, 10)
+	searchCapacity(s, 37)
+	best, ok = s.result()
+	require.True(t, ok)
+	require.True(t, best <= 37 && best > 27)
+
+	// nothing passes.
+	s = newCapacitySearch(10, 100, 0, 1)
+	searchCapacity(s, 5)
+	_, ok = s.result()
+	require.False(t, ok)
+}
+
+func TestCapacitySearchStep(t *testing.T) {
+	s := newCapacitySearch(10, 55, 10, 1)
+	require.Equal(t, []uint{10, 20, 30, 40}, searchCapacity(s, 35))
+	best, _ := s.result()
+	require.EqualValues(t, 30, best)
+
+	// the last step is capped at max.
+	s = newCapacitySearch(10, 55, 10, 1)
+	require.Equal(t, []uint{10, 20, 30, 40, 50, 55}, searchCapacity(s, 100))
+	best, _ = s.result()
+	require.EqualValues(t, 55, best)
+}
+
+func TestScaleRun(t *testing.T) {
+	comp := &api.Composition{
+		Runs: api.Runs{{
+			ID:             "default",
+			TotalInstances: 3,
+			Groups: api.CompositionRunGroups{
+				{ID: "bootstrap", Instances: api.Instances{Count: 1}},
+				{ID: "peers", Instances: api.Instances{Count: 2}},
+			},
+		}},
+	}
+
+	require.NoError(t, scaleRun(comp, "default", []string{"peers"}, 50))
+	require.EqualValues(t, 1, comp.Runs[0].Groups[0].Instances.Count)
+	require.EqualValues(t, 50, comp.Runs[0].Groups[1].Instances.Count)
+	require.Zero(t, comp.Runs[0].TotalInstances)
+
+	require.NoError(t, scaleRun(comp, "default", nil, 8))
+	require.EqualValues(t, 8, comp.Runs[0].Groups[0].Instances.Count)
+
+	require.Error(t, scaleRun(comp, "default", []string{"unknown"}, 8))
+	require.Error(t, scaleRun(comp, "other", nil, 8))
+
+	comp.Runs[0].Groups[0].Instances = api.Instances{Percentage: 0.5}
+	require.Error(t, scaleRun(comp, "default", []string{"peers"}, 8))
+}
+
+func TestCapacityPassed(t *testing.T) {
+	result := func(ok, total int) *runner.Result {
+		return &runner.Result{
+			Outcome:  task.OutcomeFailure,
+			Outcomes: map[string]*runner.GroupOutcome{"peers": {Ok: ok, Total: total}},
+		}
+	}
+
+	complete := []task.DatedState{{State: task.StateComplete, Created: time.Now()}}
+
+	passed, _ := capacityPassed(&task.Task{States: complete, Result: result(100, 100)}, 0)
+	require.True(t, passed)
+
+	passed, reason := capacityPassed(&task.Task{States: complete, Result: result(97, 100)}, 0)
+	require.False(t, passed)
+	require.Equal(t, "3 of 100 instances failed", reason)
+
+	passed, _ = capacityPassed(&task.Task{States: complete, Result: result(97, 100)}, 0.05)
+	require.True(t, passed)
+
+	canceled := []task.DatedState{{State: task.StateCanceled, Created: time.Now()}}
+
+	// runs that errored are canceled, with their error.
+	passed, reason = capacityPassed(&task.Task{States: canceled, Error: "context deadline exceeded", Result: result(100, 100)}, 0.05)
+	require.False(t, passed)
+	require.Equal(t, "context deadline exceeded", reason)
+
+	passed, reason = capacityPassed(&task.Task{States: canceled, Result: result(100, 100)}, 0.05)
+	require.False(t, passed)
+	require.Equal(t, "canceled", reason)
+
+	// runs failed by the daemon once their instances completed.
+	failed := result(100, 100)
+	failed.Reason = "1 of 1 threshold checks failed"
+	passed, reason = capacityPassed(&task.Task{States: complete, Result: failed}, 0.05)
+	require.False(t, passed)
+	require.Equal(t, "1 of 1 threshold checks failed", reason)
+}
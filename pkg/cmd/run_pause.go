@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+// runPauseCommand suspends the instances of an ongoing run.
+var runPauseCommand = &cli.Command{
+	Name:      "pause",
+	Usage:     "suspend all the instances of an ongoing run, without aborting it; the task timeout stops counting while paused, but the sidecar, the sync service and infra chaos keep going. Not supported by cluster:k8s",
+	ArgsUsage: "<run-id>",
+	Action: func(c *cli.Context) error {
+		return pauseRunCommand(c, (*client.Client).PauseRun)
+	},
+}
+
+// runResumeCommand resumes the instances of a paused run.
+var runResumeCommand = &cli.Command{
+	Name:      "resume",
+	Usage:     "resume the instances of a paused run",
+	ArgsUsage: "<run-id>",
+	Action: func(c *cli.Context) error {
+		return pauseRunCommand(c, (*client.Client).ResumeRun)
+	},
+}
+
+func pauseRunCommand(c *cli.Context, do func(*client.Client, context.Context, *api.PauseRunRequest) (io.ReadCloser, error)) error {
+	if c.NArg() != 1 {
+		return errors.New("expected the ID of a run")
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := do(cl, ctx, &api.PauseRunRequest{RunID: c.Args().First()})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return client.ParsePauseRunResponse(r, c.App.Writer)
+}
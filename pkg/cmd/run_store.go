@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// runStoreCommand reads and writes the key/value store of an ongoing run.
+var runStoreCommand = &cli.Command{
+	Name:  "store",
+	Usage: "read or write the key/value store shared by the instances of an ongoing run",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:      "get",
+			Usage:     "print the values stored for a run, or the value of a key, as JSON",
+			ArgsUsage: "[key]",
+			Action:    runStoreGetCommand,
+			Flags: cli.FlagsByName{
+				&cli.StringFlag{
+					Name:     "run",
+					Usage:    "`ID` of the run",
+					Required: true,
+				},
+			},
+		},
+		&cli.Command{
+			Name:      "set",
+			Usage:     "set a value in the store of a run",
+			ArgsUsage: "<key> <value>",
+			Action:    runStoreSetCommand,
+			Flags: cli.FlagsByName{
+				&cli.StringFlag{
+					Name:     "run",
+					Usage:    "`ID` of the run",
+					Required: true,
+				},
+			},
+		},
+	},
+}
+
+func runStoreGetCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	values, err := cl.RunValues(ctx, c.String("run"))
+	if err != nil {
+		return err
+	}
+
+	var out interface{} = values
+	if key := c.Args().First(); key != "" {
+		v, ok := values[key]
+		if !ok {
+			return fmt.Errorf("key %s not set", key)
+		}
+		out = v
+	}
+
+	enc := json.NewEncoder(c.App.Writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func runStoreSetCommand(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("expected a key and a value")
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	return cl.SetRunValue(ctx, c.String("run"), &api.SetRunValueRequest{
+		Key:   c.Args().Get(0),
+		Value: c.Args().Get(1),
+	})
+}
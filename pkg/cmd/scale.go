@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+var ScaleCommand = cli.Command{
+	Name:      "scale",
+	Usage:     "grow or shrink a group of an ongoing run; instances learn the new size through the sync service",
+	UsageText: "testground scale --run <id> --group <group> --to <n>",
+	Action:    scaleCommand,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "run",
+			Usage:    "the run id",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "group",
+			Usage:    "the group to scale",
+			Required: true,
+		},
+		&cli.IntFlag{
+			Name:     "to",
+			Usage:    "the new number of instances of the group",
+			Required: true,
+		},
+	},
+}
+
+func scaleCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.ScaleRun(ctx, &api.ScaleRunRequest{
+		RunID:     c.String("run"),
+		Group:     c.String("group"),
+		Instances: c.Int("to"),
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return client.ParseScaleRunResponse(r, c.App.Writer)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+// StatsCommand is the specification of the `stats` command.
+var StatsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "summarize the outcomes, durations and metrics of past runs, by test case",
+	Description: "Summarizes the runs that completed on the daemon over the last --since, by test case: their pass rate, " +
+		"the pass rate of their instances, crashes, durations, and the values of the metrics named by --metric. With " +
+		"--window, also prints how they trended over consecutive windows of that width.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "plan",
+			Aliases: []string{"p"},
+			Usage:   "only summarize runs of test plan `NAME`",
+		},
+		&cli.StringFlag{
+			Name:    "testcase",
+			Aliases: []string{"t"},
+			Usage:   "only summarize runs of test case `NAME`",
+		},
+		&cli.DurationFlag{
+			Name:  "since",
+			Value: 30 * 24 * time.Hour,
+			Usage: "summarize the runs that completed within `DURATION`",
+		},
+		&cli.DurationFlag{
+			Name:  "window",
+			Usage: "break the statistics down into windows of `DURATION`",
+		},
+		&cli.StringSliceFlag{
+			Name:  "metric",
+			Usage: "also summarize the values of metric `NAME`, recorded by the runs on the results stream; can be repeated",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the statistics as JSON",
+		},
+	},
+	Action: statsCommand,
+}
+
+func statsCommand(c *cli.Context) error {
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	req := &api.StatsRequest{
+		TestPlan: c.String("plan"),
+		TestCase: c.String("testcase"),
+		Since:    time.Now().Add(-c.Duration("since")),
+		Window:   c.Duration("window"),
+		Metrics:  c.StringSlice("metric"),
+	}
+
+	r, err := cl.Stats(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	stats, err := client.ParseStatsResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.App.Writer, string(b))
+		return nil
+	}
+
+	if len(stats) == 0 {
+		fmt.Fprintln(c.App.Writer, "no runs completed in this span")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TEST PLAN\tTEST CASE\tFROM\tRUNS\tPASS RATE\tINSTANCES OK\tCRASHES\tMEDIAN\tP95")
+	for _, cs := range stats {
+		printWindowStats(w, cs.Plan, cs.Case, cs.Summary)
+		if req.Window > 0 {
+			for _, ws := range cs.Trend {
+				printWindowStats(w, "", "", ws)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil || len(req.Metrics) == 0 {
+		return err
+	}
+
+	fmt.Fprintln(c.App.Writer)
+	w = tabwriter.NewWriter(c.App.Writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TEST PLAN\tTEST CASE\tFROM\tMETRIC\tRUNS\tMEAN\tMIN\tMAX\tP95")
+	for _, cs := range stats {
+		printMetricStats(w, cs.Plan, cs.Case, cs.Summary)
+		if req.Window > 0 {
+			for _, ws := range cs.Trend {
+				printMetricStats(w, "", "", ws)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func printWindowStats(w *tabwriter.Writer, plan, tcase string, ws api.WindowStats) {
+	if ws.Runs == 0 {
+		fmt.Fprintf(w, "%s\t%s\t%s\t0\t-\t-\t-\t-\t-\n", plan, tcase, ws.Start.Local().Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f%%\t%.0f%%\t%d\t%s\t%s\n",
+		plan, tcase, ws.Start.Local().Format(time.RFC3339), ws.Runs, ws.PassRate*100, ws.InstancePassRate*100,
+		ws.Crashes, ws.MedianDuration, ws.P95Duration)
+}
+
+func printMetricStats(w *tabwriter.Writer, plan, tcase string, ws api.WindowStats) {
+	for _, ms := range ws.Metrics {
+		from := ws.Start.Local().Format(time.RFC3339)
+		if ms.Runs == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t0\t-\t-\t-\t-\n", plan, tcase, from, ms.Metric)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%g\t%g\t%g\t%g\n", plan, tcase, from, ms.Metric, ms.Runs, ms.Mean, ms.Min, ms.Max, ms.P95)
+		}
+		plan, tcase = "", ""
+	}
+}
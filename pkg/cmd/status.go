@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/client"
@@ -88,4 +89,41 @@ func printTask(tsk task.Task) {
 	fmt.Printf("Status:\t\t%s\n", tsk.State().State)
 	fmt.Printf("Outcome:\t%s\n", outcomeStr)
 	fmt.Printf("Last update:\t%s\n", tsk.State().Created)
+
+	if est := tsk.Estimate; est != nil {
+		fmt.Printf("Progress:\t%.0f%% (%s remaining, estimated from %d runs)\n", est.Progress*100, est.Remaining, est.Samples)
+	}
+
+	for _, b := range tsk.Builds {
+		line := fmt.Sprintf("%s (%s): %s", strings.Join(b.Groups, ","), b.Builder, b.State)
+		switch {
+		case b.Error != "":
+			line += fmt.Sprintf(" (%s)", b.Error)
+		case b.Artifact != "":
+			line += fmt.Sprintf(" (%s)", b.Artifact)
+		}
+		fmt.Printf("Build:\t\t%s\n", line)
+	}
+
+	for _, p := range tsk.Phases {
+		line := fmt.Sprintf("%s (%s)", p.Phase, p.Took())
+		if p.Ended.IsZero() {
+			line = fmt.Sprintf("%s (%s, in progress)", p.Phase, p.Took())
+		}
+		fmt.Printf("Phase:\t\t%s\n", line)
+	}
+
+	if tsk.Type == task.TypeRun && tsk.Result != nil {
+		res := data.DecodeRunnerResult(tsk.Result)
+		if a := res.Abort; a != nil {
+			fmt.Printf("Aborted:\t%s[%d]: %s\n", a.GroupID, a.Instance, a.Reason)
+		}
+		for _, c := range res.Crashes {
+			line := fmt.Sprintf("%s[%d]: %s", c.Group, c.Instance, c.Reason)
+			if len(c.Dumps) > 0 {
+				line += fmt.Sprintf(" (%s)", strings.Join(c.Dumps, ", "))
+			}
+			fmt.Printf("Crash:\t\t%s\n", line)
+		}
+	}
 }
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+)
+
+// SweepCommand is the specification of the `sweep` command.
+var SweepCommand = cli.Command{
+	Name:  "sweep",
+	Usage: "inspect sweeps: the runs of a composition with several runs, submitted together",
+	Subcommands: cli.Commands{
+		&cli.Command{
+			Name:      "report",
+			Usage:     "report the outcomes and metrics of the runs of a sweep, by parameter combination",
+			ArgsUsage: "<sweep-id>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "csv",
+					Usage: "write the report to `FILENAME` as CSV, a row per run; - for stdout",
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the report as JSON",
+				},
+			},
+			Action: sweepReportCommand,
+		},
+	},
+}
+
+func sweepReportCommand(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("expected the ID of a sweep")
+	}
+
+	ctx, cancel := context.WithCancel(ProcessContext())
+	defer cancel()
+
+	cl, _, err := setupClient(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := cl.SweepReport(ctx, &api.SweepReportRequest{Sweep: c.Args().First()})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	report, err := client.ParseSweepReportResponse(r, c.App.Writer)
+	if err != nil {
+		return err
+	}
+
+	switch file := c.String("csv"); {
+	case file == "-":
+		return writeSweepCSV(c.App.Writer, &report)
+	case file != "":
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		if err := writeSweepCSV(f, &report); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	case c.Bool("json"):
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.App.Writer, string(b))
+		return nil
+	}
+
+	fmt.Fprintf(c.App.Writer, "sweep %s of %s/%s: %d runs\n\n", report.ID, report.Plan, report.Case, len(report.Runs))
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "RUN\tTASK\tPARAMS\tOUTCOME\tINSTANCES OK\tDURATION")
+	for _, run := range report.Runs {
+		outcome := string(run.Outcome)
+		if outcome == "" {
+			outcome = string(run.State)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", run.RunID, run.TaskID, formatParams(run.Params), outcome, run.InstancesOk, run.Instances, run.Duration)
+		for _, m := range run.Metrics {
+			fmt.Fprintf(w, "\t\t  %s [%s]\tmean %g\tp95 %g\t\n", m.Metric, m.Group, m.Mean, m.P95)
+		}
+	}
+	return w.Flush()
+}
+
+// formatParams formats test parameters as k=v pairs, sorted by key.
+func formatParams(params map[string]string) string {
+	pairs := make([]string, 0, len(params))
+	for k, v := range params {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// writeSweepCSV writes a sweep report as CSV, a row per run: its IDs, a column
+// per test parameter, its outcome, and the mean and p95 of each metric, by
+// group.
+func writeSweepCSV(w io.Writer, report *api.SweepReport) error {
+	type metricKey struct{ metric, group string }
+
+	var (
+		params  []string
+		metrics []metricKey
+		seenP   = make(map[string]bool)
+		seenM   = make(map[metricKey]bool)
+	)
+	for _, run := range report.Runs {
+		for k := range run.Params {
+			if !seenP[k] {
+				seenP[k] = true
+				params = append(params, k)
+			}
+		}
+		for _, m := range run.Metrics {
+			if k := (metricKey{m.Metric, m.Group}); !seenM[k] {
+				seenM[k] = true
+				metrics = append(metrics, k)
+			}
+		}
+	}
+	sort.Strings(params)
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].metric != metrics[j].metric {
+			return metrics[i].metric < metrics[j].metric
+		}
+		return metrics[i].group < metrics[j].group
+	})
+
+	header := []string{"run_id", "task_id"}
+	header = append(header, params...)
+	header = append(header, "state", "outcome", "instances", "instances_ok", "duration_seconds", "error")
+	for _, m := range metrics {
+		header = append(header, m.metric+"."+m.group+".mean", m.metric+"."+m.group+".p95")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, run := range report.Runs {
+		row := []string{run.RunID, run.TaskID}
+		for _, p := range params {
+			row = append(row, run.Params[p])
+		}
+		row = append(row,
+			string(run.State),
+			string(run.Outcome),
+			strconv.Itoa(run.Instances),
+			strconv.Itoa(run.InstancesOk),
+			strconv.FormatFloat(run.Duration.Seconds(), 'f', -1, 64),
+			run.Error,
+		)
+
+		values := make(map[metricKey]api.SweepMetric, len(run.Metrics))
+		for _, m := range run.Metrics {
+			values[metricKey{m.Metric, m.Group}] = m
+		}
+		for _, k := range metrics {
+			if m, ok := values[k]; ok {
+				row = append(row, strconv.FormatFloat(m.Mean, 'g', -1, 64), strconv.FormatFloat(m.P95, 'g', -1, 64))
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestWriteSweepCSV(t *testing.T) {
+	report := &api.SweepReport{
+		ID: "c60i0d2llu6a7gha3ee0",
+		Runs: []api.SweepRun{
+			{
+				RunID:       "fast",
+				TaskID:      "c60i0d2llu6a7gha3ef0",
+				Params:      map[string]string{"latency": "10ms"},
+				State:       task.StateComplete,
+				Outcome:     task.OutcomeSuccess,
+				Instances:   10,
+				InstancesOk: 10,
+				Duration:    90 * time.Second,
+				Metrics:     []api.SweepMetric{{Metric: "rtt", Group: "peers", Mean: 12, P95: 20.5}},
+			},
+			{
+				RunID:  "slow",
+				TaskID: "c60i0d2llu6a7gha3eg0",
+				Params: map[string]string{"latency": "50ms", "peers.size": "1KiB"},
+				State:  task.StateScheduled,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeSweepCSV(&buf, report))
+	require.Equal(t, "run_id,task_id,latency,peers.size,state,outcome,instances,instances_ok,duration_seconds,error,rtt.peers.mean,rtt.peers.p95\n"+
+		"fast,c60i0d2llu6a7gha3ef0,10ms,,complete,success,10,10,90,,12,20.5\n"+
+		"slow,c60i0d2llu6a7gha3eg0,50ms,1KiB,scheduled,,0,0,0,,,\n", buf.String())
+}
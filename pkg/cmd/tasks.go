@@ -51,7 +51,11 @@ func tasksCommand(c *cli.Context) error {
 	fmt.Fprintln(w, "ID\tDATE\tTEST PLAN\tTEST CASE\tDURATION\tSTATE\tTYPE")
 
 	for _, tsk := range tsks {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tsk.ID, tsk.Created().String(), tsk.Plan, tsk.Case, tsk.Took(), tsk.State().State, tsk.Type)
+		state := string(tsk.State().State)
+		if p := tsk.Phase(); p != nil && tsk.State().State == task.StateProcessing {
+			state += " (" + string(p.Phase) + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tsk.ID, tsk.Created().String(), tsk.Plan, tsk.Case, tsk.Took(), state, tsk.Type)
 	}
 
 	w.Flush()
@@ -10,6 +10,11 @@ func (d Directories) Home() string {
 	return d.home
 }
 
+// EnvFile is the path of the .env.toml configuration file.
+func (d Directories) EnvFile() string {
+	return filepath.Join(d.home, ".env.toml")
+}
+
 func (d Directories) Plans() string {
 	return filepath.Join(d.home, "plans")
 }
@@ -29,3 +34,23 @@ func (d Directories) Outputs() string {
 func (d Directories) Daemon() string {
 	return filepath.Join(d.home, "data", "daemon")
 }
+
+func (d Directories) Datasets() string {
+	return filepath.Join(d.home, "data", "datasets")
+}
+
+func (d Directories) Prometheus() string {
+	return filepath.Join(d.home, "data", "prometheus")
+}
+
+// Snapshots is where the snapshots of the state of instances are kept, see
+// api.Snapshot.
+func (d Directories) Snapshots() string {
+	return filepath.Join(d.home, "data", "snapshots")
+}
+
+// RunObjects is where the objects instances put into the object stores of
+// ongoing runs are kept, one directory per run.
+func (d Directories) RunObjects() string {
+	return filepath.Join(d.home, "data", "objects")
+}
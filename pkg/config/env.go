@@ -17,6 +17,14 @@ type EnvConfig struct {
 	Runners   map[string]ConfigMap `toml:"runners"`
 	Daemon    DaemonConfig         `toml:"daemon"`
 	Client    ClientConfig         `toml:"client"`
+	AirGapped AirGappedConfig      `toml:"airgapped"`
+
+	// Profile is the profile applied when none is selected with --profile.
+	Profile string `toml:"profile"`
+
+	// Profiles are named bundles of settings, overriding the rest of the
+	// configuration when selected, e.g. "laptop" or "prod-cluster".
+	Profiles map[string]ProfileConfig `toml:"profiles"`
 }
 
 func (e EnvConfig) Dirs() Directories {
@@ -35,14 +43,232 @@ type DockerHubConfig struct {
 	AccessToken string `toml:"access_token"`
 }
 
+// AirGappedConfig configures the offline mode, for environments without
+// Internet egress. When enabled, builders pull base images from Registry, a
+// mirror of Docker Hub, and fetch Go modules exclusively from GoProxyURL.
+// Modules are verified against GoSumDB, a mirror of the checksum database,
+// or not at all if it's empty. Only the docker:go and exec:go builders
+// support this mode.
+type AirGappedConfig struct {
+	Enabled    bool   `toml:"enabled"`
+	Registry   string `toml:"registry"`
+	GoProxyURL string `toml:"go_proxy_url"`
+	GoSumDB    string `toml:"go_sumdb"`
+}
+
 type DaemonConfig struct {
-	Listen                string          `toml:"listen"`
-	Scheduler             SchedulerConfig `toml:"scheduler"`
-	Tokens                []string        `toml:"tokens"`
-	SlackWebhookURL       string          `toml:"slack_webhook_url"`
-	GithubRepoStatusToken string          `toml:"github_repo_status_token"`
-	RootURL               string          `toml:"root_url"`
-	InfluxDBEndpoint      string          `toml:"influxdb_endpoint"`
+	Listen                string               `toml:"listen"`
+	Scheduler             SchedulerConfig      `toml:"scheduler"`
+	Tokens                []string             `toml:"tokens"`
+	SlackWebhookURL       string               `toml:"slack_webhook_url"`
+	GithubRepoStatusToken string               `toml:"github_repo_status_token"`
+	RootURL               string               `toml:"root_url"`
+	InfluxDBEndpoint      string               `toml:"influxdb_endpoint"`
+	Provenance            ProvenanceConfig     `toml:"provenance"`
+	Notifications         []NotificationConfig `toml:"notifications"`
+	GithubApp             GithubAppConfig      `toml:"github_app"`
+
+	// UserTokens are the tokens of named users, by user, accepted along with
+	// Tokens. Requests made with them act as their user, see Limits.
+	UserTokens map[string][]string `toml:"user_tokens"`
+
+	// NotifyURLs are the URLs the webhooks tasks request with notify_url
+	// may point to, or under, e.g. "https://ci.example.com/hooks/". Tasks
+	// requesting other webhooks are rejected; if empty, all are.
+	NotifyURLs []string `toml:"notify_urls"`
+
+	// InstanceEndpoint is the URL test instances reach the daemon at. The
+	// key/value store and the datasets of runs are only exposed to instances
+	// when it is set; runs with roles, or test cases using the services of
+	// the daemon, are rejected without it.
+	InstanceEndpoint string `toml:"instance_endpoint"`
+
+	// RunObjectsQuotaMiB caps the size of the object store of each run, in
+	// MiB; defaults to 1024.
+	RunObjectsQuotaMiB int `toml:"run_objects_quota_mib"`
+
+	// Datasets maps names of datasets to the URLs they are fetched from, e.g.
+	// S3 or IPFS gateway URLs. They are downloaded into the datasets directory
+	// on first use; datasets placed there directly need no entry.
+	Datasets map[string]string `toml:"datasets"`
+
+	// Limits are guardrails on the runs the daemon accepts. Every limit
+	// matching the runner and the authenticated user of a run applies to it.
+	Limits []LimitsConfig `toml:"limits"`
+
+	// Infra pins the versions of the infrastructure containers of the local
+	// runners.
+	Infra InfraConfig `toml:"infra"`
+
+	// Security bounds the security context compositions may request for
+	// their instances. By default, nothing beyond the defaults of the
+	// runners is granted.
+	Security SecurityConfig `toml:"security"`
+
+	// Analytics configures the export of completed runs to an analytical
+	// store.
+	Analytics AnalyticsConfig `toml:"analytics"`
+
+	// Archive moves the outputs of old runs off the local disk, to S3.
+	Archive ArchiveConfig `toml:"archive"`
+}
+
+// RunObjectsQuota returns the quota of the object store of each run, in
+// bytes.
+func (d DaemonConfig) RunObjectsQuota() int64 {
+	mib := d.RunObjectsQuotaMiB
+	if mib <= 0 {
+		mib = DefaultRunObjectsQuotaMiB
+	}
+	return int64(mib) << 20
+}
+
+// DefaultInfraImages are the images of the infrastructure containers of the
+// local runners, by component, unless pinned otherwise. Third-party images are
+// pinned to releases; the sidecar is built from the sources of the daemon, see
+// `make docker-sidecar`. Images can be pinned by digest too, e.g.
+// "library/redis:7.0.5@sha256:<digest>".
+var DefaultInfraImages = map[string]string{
+	"grafana":      "bitnami/grafana:8.5.3",
+	"redis":        "library/redis:7.0.5",
+	"sync-service": "iptestground/sync-service:v0.3.0",
+	"influxdb":     "library/influxdb:1.8.10",
+	"prometheus":   "prom/prometheus:v2.37.0",
+	"sidecar":      "iptestground/sidecar:edge",
+}
+
+// InfraConfig pins the images of infrastructure containers. Healthchecks
+// report containers running other images than the pinned ones, compared by
+// image ID, and `testground infra upgrade` replaces them.
+type InfraConfig struct {
+	// Images maps components (see DefaultInfraImages) to image references.
+	Images map[string]string `toml:"images"`
+}
+
+// Image returns the image pinned for a component, or its default.
+func (c InfraConfig) Image(component string) string {
+	if img := c.Images[component]; img != "" {
+		return img
+	}
+	return DefaultInfraImages[component]
+}
+
+// LimitsConfig caps the size and duration of runs, so that a typo in a
+// composition can't take down the cluster. Zero values mean no limit.
+type LimitsConfig struct {
+	// Runner and User restrict the limit to the runs of a runner, and to the
+	// runs created with the tokens of a user, see user_tokens; the user that
+	// clients claim doesn't count. Empty values match all runs.
+	Runner string `toml:"runner"`
+	User   string `toml:"user"`
+
+	// MaxInstances is the maximum number of instances of a run; larger runs
+	// are rejected.
+	MaxInstances int `toml:"max_instances"`
+
+	// MaxDuration is the maximum duration of a run, e.g. "1h"; runs are
+	// canceled when it elapses.
+	MaxDuration string `toml:"max_duration"`
+
+	// MaxConcurrentInstances is the maximum number of instances of all the
+	// matching runs in progress at once, e.g. pods on a cluster. Runs wait
+	// until they fit, and are rejected if they never can.
+	MaxConcurrentInstances int `toml:"max_concurrent_instances"`
+}
+
+// SecurityConfig is the allow-list of the security settings groups may
+// request.
+type SecurityConfig struct {
+	// AllowedCapabilities are the Linux capabilities groups may add, e.g.
+	// "NET_ADMIN".
+	AllowedCapabilities []string `toml:"allowed_capabilities"`
+
+	// AllowPrivileged allows groups to run privileged instances.
+	AllowPrivileged bool `toml:"allow_privileged"`
+
+	// AllowUnconfined allows groups to disable seccomp filtering.
+	AllowUnconfined bool `toml:"allow_unconfined"`
+}
+
+// AnalyticsConfig configures the export of the metadata and the aggregated
+// metrics of completed runs to ClickHouse, through its HTTP interface. Leaving
+// ClickHouseURL empty disables it.
+type AnalyticsConfig struct {
+	// ClickHouseURL is the URL of the HTTP interface of ClickHouse, e.g.
+	// http://clickhouse:8123.
+	ClickHouseURL string `toml:"clickhouse_url"`
+
+	// Database is the database the tables are created in; defaults to
+	// "testground".
+	Database string `toml:"database"`
+
+	// User and Password authenticate with ClickHouse, if set.
+	User     string `toml:"user"`
+	Password string `toml:"password"`
+
+	// DisableMetrics only exports the metadata of runs, without aggregating
+	// their metrics from InfluxDB.
+	DisableMetrics bool `toml:"disable_metrics"`
+}
+
+// ArchiveConfig configures the retention tiers of the outputs of runs kept on
+// the local disk of the daemon: they stay there (hot) for HotDays after the
+// run completes, are then archived to S3 (warm), and moved to ColdStorageClass
+// (cold) WarmDays later. Archived outputs are restored when they are
+// collected. Leaving Bucket empty keeps outputs on disk.
+type ArchiveConfig struct {
+	// Bucket and Prefix locate the archives in S3; an archive is stored
+	// under <prefix>/<plan>/<run id>.tgz. S3 is reached with the credentials
+	// of the aws section.
+	Bucket string `toml:"bucket"`
+	Prefix string `toml:"prefix"`
+
+	// ColdStorageClass is the storage class of cold archives; defaults to
+	// GLACIER.
+	ColdStorageClass string `toml:"cold_storage_class"`
+
+	// RestoreDays is how long S3 keeps the copy of a cold archive restored
+	// for collection; defaults to 7.
+	RestoreDays int `toml:"restore_days"`
+
+	// ArchivePolicy is the default policy, for plans without one in Plans.
+	ArchivePolicy
+
+	// Plans maps test plans to their policies. Unset fields of a policy
+	// fall back to the default policy.
+	Plans map[string]ArchivePolicy `toml:"plans"`
+}
+
+// ArchivePolicy decides how long the outputs of runs stay in each tier.
+type ArchivePolicy struct {
+	// HotDays is the number of days outputs stay on disk; defaults to 30.
+	// Outputs restored from an archive are dropped from disk again after as
+	// many days.
+	HotDays int `toml:"hot_days"`
+
+	// WarmDays is the number of days archives stay in the standard storage
+	// class before they are moved to cold storage. Zero keeps them warm.
+	WarmDays int `toml:"warm_days"`
+}
+
+// Policy returns the archive policy of a test plan.
+func (c ArchiveConfig) Policy(plan string) ArchivePolicy {
+	p := c.ArchivePolicy
+	if pp, ok := c.Plans[plan]; ok {
+		if pp.HotDays != 0 {
+			p.HotDays = pp.HotDays
+		}
+		if pp.WarmDays != 0 {
+			p.WarmDays = pp.WarmDays
+		}
+	}
+	if p.HotDays <= 0 {
+		p.HotDays = 30
+	}
+	if p.WarmDays < 0 {
+		p.WarmDays = 0
+	}
+	return p
 }
 
 type SchedulerConfig struct {
@@ -50,12 +276,108 @@ type SchedulerConfig struct {
 	QueueSize      int    `toml:"queue_size"`
 	TaskRepoType   string `toml:"task_repo_type"`
 	TaskTimeoutMin int    `toml:"task_timeout_min"`
+
+	// Remote is the endpoint of the daemon the workers of this daemon pull
+	// tasks from, instead of from its own queue. RemoteToken is the token to
+	// authenticate with it.
+	Remote      string `toml:"remote"`
+	RemoteToken string `toml:"remote_token"`
+
+	// WorkspaceRetention decides which task workspaces are kept once tasks
+	// finish: "none" (the default), "failed" or "all".
+	WorkspaceRetention string `toml:"workspace_retention"`
+
+	// MaxPersistentRuns caps the persistent runs the daemon queues or runs at
+	// once, since each holds a worker until it's killed. It defaults to, and
+	// can't exceed, one less than Workers, so that a worker is always left
+	// for other tasks.
+	MaxPersistentRuns int `toml:"max_persistent_runs"`
+}
+
+// ProvenanceConfig configures the signing of the provenance records of build
+// artifacts, and their verification before runs. Keys are cosign key paths;
+// leaving them empty disables signing and verification respectively.
+type ProvenanceConfig struct {
+	SignKey   string `toml:"sign_key"`
+	VerifyKey string `toml:"verify_key"`
+}
+
+// NotificationConfig configures a target that is notified of task state
+// transitions.
+type NotificationConfig struct {
+	// Type is the kind of target: "slack", "webhook" or "email".
+	Type string `toml:"type"`
+
+	// URL is the Slack incoming webhook URL, or the URL to POST the JSON
+	// notification to.
+	URL string `toml:"url"`
+
+	// On lists the events to notify of: "processing", "complete" (every
+	// terminal state), or "failure" (terminal states other than success).
+	// Defaults to "complete".
+	On []string `toml:"on"`
+
+	// Users restricts notifications to the tasks created by these users; if
+	// empty, tasks from all users are notified.
+	Users []string `toml:"users"`
+
+	// SMTP settings of email targets. Authentication is only attempted if a
+	// username is supplied.
+	SMTPAddr     string   `toml:"smtp_addr"`
+	SMTPUser     string   `toml:"smtp_user"`
+	SMTPPassword string   `toml:"smtp_password"`
+	From         string   `toml:"from"`
+	To           []string `toml:"to"`
+}
+
+// GithubAppConfig configures the GitHub App the daemon authenticates as to
+// report the tasks created by CI as check runs, and to comment a summary on
+// the pull requests of their commit. Leaving AppID empty disables it.
+type GithubAppConfig struct {
+	AppID          int64  `toml:"app_id"`
+	InstallationID int64  `toml:"installation_id"`
+	PrivateKeyPath string `toml:"private_key_path"`
+
+	// APIURL is the base URL of the GitHub API; defaults to
+	// https://api.github.com.
+	APIURL string `toml:"api_url"`
+
+	// DisableComments disables the summary comments on pull requests.
+	DisableComments bool `toml:"disable_comments"`
 }
 
 type ClientConfig struct {
 	Endpoint string `toml:"endpoint"`
 	Token    string `toml:"token"`
 	User     string `toml:"user"`
+
+	// Runner and Builder are the defaults of compositions and single runs
+	// that don't set one.
+	Runner  string `toml:"runner"`
+	Builder string `toml:"builder"`
+}
+
+// ProfileConfig bundles the settings of an environment, e.g. a laptop or a
+// cluster, so that switching between them is a matter of --profile rather
+// than of swapping .env.toml files. Values set in a profile override the rest
+// of the configuration; empty ones leave it untouched.
+type ProfileConfig struct {
+	// Endpoint, Token and User override the client configuration.
+	Endpoint string `toml:"endpoint"`
+	Token    string `toml:"token"`
+	User     string `toml:"user"`
+
+	// Runner and Builder are the defaults of compositions that don't set one.
+	Runner  string `toml:"runner"`
+	Builder string `toml:"builder"`
+
+	// Builders are the default configurations of builders, by builder. They
+	// are merged over the [builders] of the configuration, and sent along
+	// with the compositions of the client.
+	Builders map[string]ConfigMap `toml:"builders"`
+
+	// AWSRegion overrides the AWS region.
+	AWSRegion string `toml:"aws_region"`
 }
 
 // Common config flags kept here to avoid magic strings
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/adrg/xdg"
@@ -13,6 +16,10 @@ import (
 const (
 	EnvTestgroundHomeDir = "TESTGROUND_HOME"
 
+	// EnvTestgroundProfile selects the profile to apply, overriding the
+	// profile set in .env.toml.
+	EnvTestgroundProfile = "TESTGROUND_PROFILE"
+
 	// DefaultListenAddr is a host:port value, where we set up an HTTP endpoint.
 	// In the future we will support an HTTPS mode.
 	DefaultListenAddr = "localhost:8042"
@@ -27,6 +34,9 @@ const (
 	DefaultWorkers = 2
 
 	DefaultQueueSize = 100
+
+	// DefaultRunObjectsQuotaMiB is the quota of the object store of each run.
+	DefaultRunObjectsQuotaMiB = 1024
 )
 
 func (e *EnvConfig) Load() error {
@@ -36,17 +46,77 @@ func (e *EnvConfig) Load() error {
 	}
 
 	// parse the .env.toml file, if it exists.
-	f := filepath.Join(e.dirs.Home(), ".env.toml")
+	f := e.dirs.EnvFile()
 	if _, err := os.Stat(f); err == nil {
+		// refuse outdated layouts, whose keys would be silently ignored.
+		var raw map[string]interface{}
+		if _, err := toml.DecodeFile(f, &raw); err != nil {
+			return fmt.Errorf("found .env.toml at %s, but failed to parse: %w", f, err)
+		}
+		if changes := Migrate(raw); len(changes) > 0 {
+			return fmt.Errorf("found .env.toml at %s, but it uses an outdated layout (%s); "+
+				"run `testground config migrate` to upgrade it", f, strings.Join(changes, "; "))
+		}
+
 		// try to load the optional .env.toml file
-		_, err = toml.DecodeFile(f, e)
+		md, err := toml.DecodeFile(f, e)
 		if err != nil {
 			return fmt.Errorf("found .env.toml at %s, but failed to parse: %w", f, err)
 		}
+		if err := checkUndecoded(f, md, reflect.TypeOf(e).Elem()); err != nil {
+			return err
+		}
 		logging.S().Infof(".env.toml loaded from: %s", f)
 	} else {
 		logging.S().Infof("no .env.toml found at %s; running with defaults", f)
 	}
+
+	if v, ok := os.LookupEnv(EnvTestgroundProfile); ok {
+		e.Profile = v
+	}
+	if e.Profile != "" {
+		if err := e.ApplyProfile(e.Profile); err != nil {
+			return err
+		}
+		logging.S().Infof("using profile: %s", e.Profile)
+	}
+	return nil
+}
+
+// ApplyProfile overrides the configuration with the settings of a profile.
+func (e *EnvConfig) ApplyProfile(name string) error {
+	p, ok := e.Profiles[name]
+	if !ok {
+		known := make([]string, 0, len(e.Profiles))
+		for k := range e.Profiles {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown profile %q; known profiles: %v", name, known)
+	}
+
+	e.Client.Endpoint = defaultString(p.Endpoint, e.Client.Endpoint)
+	e.Client.Token = defaultString(p.Token, e.Client.Token)
+	e.Client.User = defaultString(p.User, e.Client.User)
+	e.Client.Runner = defaultString(p.Runner, e.Client.Runner)
+	e.Client.Builder = defaultString(p.Builder, e.Client.Builder)
+	e.AWS.Region = defaultString(p.AWSRegion, e.AWS.Region)
+
+	for b, cfg := range p.Builders {
+		if e.Builders == nil {
+			e.Builders = make(map[string]ConfigMap)
+		}
+		merged := make(ConfigMap, len(e.Builders[b])+len(cfg))
+		for k, v := range e.Builders[b] {
+			merged[k] = v
+		}
+		for k, v := range cfg {
+			merged[k] = v
+		}
+		e.Builders[b] = merged
+	}
+
+	e.Profile = name
 	return nil
 }
 
@@ -109,6 +179,7 @@ func (e *EnvConfig) EnsureMinimalConfig() error {
 		e.dirs.SDKs(),
 		e.dirs.Work(),
 		e.dirs.Daemon(),
+		e.dirs.Prometheus(),
 	} {
 		if err := ensureDir(d); err != nil {
 			return fmt.Errorf("failed to check/create directory %s: %w", d, err)
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// legacySchedulerKeys are the keys of the scheduler that used to live in the
+// [daemon] table, before [daemon.scheduler].
+var legacySchedulerKeys = []string{"workers", "queue_size", "task_timeout_min", "task_repo_type"}
+
+// Migrate upgrades a raw configuration, as decoded from .env.toml, from older
+// layouts to the current one, in place. It returns a description of each
+// change made; none if the configuration is up to date.
+//
+// It moves:
+//
+//   - the scheduler settings of [daemon] to [daemon.scheduler].
+//   - the tables of runners and builders at the top level to [runners] and
+//     [builders].
+//   - the tables of runners under [builders] to [runners], and vice versa.
+func Migrate(raw map[string]interface{}) []string {
+	var changes []string
+
+	// scheduler settings.
+	if daemon, ok := raw["daemon"].(map[string]interface{}); ok {
+		for _, k := range legacySchedulerKeys {
+			v, ok := daemon[k]
+			if !ok {
+				continue
+			}
+			scheduler := subtable(daemon, "scheduler")
+			if _, ok := scheduler[k]; !ok {
+				scheduler[k] = v
+			}
+			delete(daemon, k)
+			changes = append(changes, fmt.Sprintf("moved daemon.%[1]s to daemon.scheduler.%[1]s", k))
+		}
+	}
+
+	// tables of runners and builders.
+	for _, k := range sortedKeys(raw) {
+		tbl, ok := raw[k].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case isRunnerID(k):
+			mergeTable(subtable(raw, "runners"), k, tbl)
+			delete(raw, k)
+			changes = append(changes, fmt.Sprintf("moved [%[1]q] to [runners.%[1]q]", k))
+		case isBuilderID(k):
+			mergeTable(subtable(raw, "builders"), k, tbl)
+			delete(raw, k)
+			changes = append(changes, fmt.Sprintf("moved [%[1]q] to [builders.%[1]q]", k))
+		}
+	}
+	for _, move := range []struct {
+		from, to string
+		is       func(string) bool
+	}{
+		{"builders", "runners", isRunnerID},
+		{"runners", "builders", isBuilderID},
+	} {
+		from, ok := raw[move.from].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, k := range sortedKeys(from) {
+			tbl, ok := from[k].(map[string]interface{})
+			if !ok || !move.is(k) {
+				continue
+			}
+			mergeTable(subtable(raw, move.to), k, tbl)
+			delete(from, k)
+			changes = append(changes, fmt.Sprintf("moved [%[1]s.%[3]q] to [%[2]s.%[3]q]", move.from, move.to, k))
+		}
+	}
+
+	return changes
+}
+
+// isRunnerID returns whether a table name is the ID of a runner, e.g.
+// local:docker.
+func isRunnerID(k string) bool {
+	return strings.HasPrefix(k, "local:") || strings.HasPrefix(k, "cluster:")
+}
+
+// isBuilderID returns whether a table name is the ID of a builder, e.g.
+// docker:go.
+func isBuilderID(k string) bool {
+	return strings.HasPrefix(k, "docker:") || strings.HasPrefix(k, "exec:")
+}
+
+// subtable returns the table at key k of a table, creating it if needed.
+func subtable(tbl map[string]interface{}, k string) map[string]interface{} {
+	sub, ok := tbl[k].(map[string]interface{})
+	if !ok {
+		sub = make(map[string]interface{})
+		tbl[k] = sub
+	}
+	return sub
+}
+
+// mergeTable merges src into the table at key k of dst. Keys already in dst
+// take precedence.
+func mergeTable(dst map[string]interface{}, k string, src map[string]interface{}) {
+	into := subtable(dst, k)
+	for sk, v := range src {
+		if _, ok := into[sk]; !ok {
+			into[sk] = v
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SchemaError lists the keys of a configuration that are not part of its
+// schema, which would otherwise be silently ignored.
+type SchemaError struct {
+	// File is the configuration file, if any.
+	File string
+
+	// Problems explain each unknown key, and where it likely belongs.
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		fmt.Fprintf(&b, "invalid configuration in %s:", e.File)
+	} else {
+		b.WriteString("invalid configuration:")
+	}
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// checkUndecoded returns an error explaining the keys of a configuration that
+// were not decoded into its type, if any.
+func checkUndecoded(file string, md toml.MetaData, typ reflect.Type) error {
+	undecoded := md.Undecoded()
+	if len(undecoded) == 0 {
+		return nil
+	}
+
+	keys := make(map[string]struct{}, len(undecoded))
+	for _, k := range undecoded {
+		keys[k.String()] = struct{}{}
+	}
+
+	known := schemaKeys(typ, "")
+	problems := make([]string, 0, len(undecoded))
+	for _, k := range undecoded {
+		// only report the outermost unknown table.
+		if _, ok := keys[strings.Join(k[:len(k)-1], ".")]; ok && len(k) > 1 {
+			continue
+		}
+		problems = append(problems, unknownKeyProblem(k.String(), known))
+	}
+	sort.Strings(problems)
+	return &SchemaError{File: file, Problems: problems}
+}
+
+// CheckConfigMap checks the keys of a configuration map, e.g. of a builder or
+// a runner, against the fields of its type, and the keys allowed besides. It
+// returns the problems found, with keys prefixed by table.
+func CheckConfigMap(table string, m ConfigMap, typ reflect.Type, allowed ...string) []string {
+	known := schemaKeys(typ, table+".")
+	for _, k := range allowed {
+		known = append(known, table+"."+k)
+	}
+
+	var problems []string
+	for k := range m {
+		if key := table + "." + k; !stringIn(key, known) {
+			problems = append(problems, unknownKeyProblem(key, known))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// schemaKeys returns the dotted paths of the keys of a type, by their TOML
+// tags. Keys of maps are denoted by *.
+func schemaKeys(typ reflect.Type, prefix string) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var keys []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous {
+			keys = append(keys, schemaKeys(f.Type, prefix)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("toml"), ",")[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		key := prefix + name
+		keys = append(keys, key)
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Map {
+			key += ".*"
+			ft = ft.Elem()
+		}
+		keys = append(keys, schemaKeys(ft, key+".")...)
+	}
+	return keys
+}
+
+// unknownKeyProblem explains an unknown key, suggesting the known keys it was
+// likely meant to be: those with the same name elsewhere, or with a similar
+// name in the same table.
+func unknownKeyProblem(key string, known []string) string {
+	parent, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parent, name = key[:i], key[i+1:]
+	}
+
+	var suggestions []string
+	for _, k := range known {
+		kparent, kname := "", k
+		if i := strings.LastIndex(k, "."); i >= 0 {
+			kparent, kname = k[:i], k[i+1:]
+		}
+		switch {
+		case kname == name:
+			suggestions = append(suggestions, k)
+		case matchesTable(parent, kparent) && similar(kname, name):
+			suggestions = append(suggestions, k)
+		}
+	}
+
+	if len(suggestions) == 0 {
+		return fmt.Sprintf("unknown key %s", key)
+	}
+	return fmt.Sprintf("unknown key %s; did you mean %s?", key, strings.Join(suggestions, " or "))
+}
+
+// matchesTable returns whether a concrete table path matches a schema table
+// path, in which map keys are denoted by *.
+func matchesTable(table, schema string) bool {
+	if table == "" || schema == "" {
+		return table == schema
+	}
+	a, b := strings.Split(table, "."), strings.Split(schema, ".")
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if b[i] != "*" && a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// similar returns whether two key names are likely typos of one another.
+func similar(a, b string) bool {
+	return editDistance(a, b) <= 2 || strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func stringIn(s string, list []string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
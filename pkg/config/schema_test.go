@@ -0,0 +1,89 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUndecoded(t *testing.T) {
+	const data = `
+[daemon]
+listen = ":8042"
+
+[daemon.scheduler]
+task_timeout = 10
+workers = 2
+
+[client]
+endpoint = "http://localhost:8042"
+slack_webhook_url = "https://hooks.slack.com/x"
+
+[runners."local:docker"]
+anything = "goes"
+`
+	var cfg EnvConfig
+	md, err := toml.Decode(data, &cfg)
+	require.NoError(t, err)
+
+	err = checkUndecoded(".env.toml", md, reflect.TypeOf(cfg))
+	require.Error(t, err)
+
+	problems := err.(*SchemaError).Problems
+	require.Len(t, problems, 2)
+	require.Equal(t, "unknown key client.slack_webhook_url; did you mean daemon.slack_webhook_url?", problems[0])
+	require.True(t, strings.HasPrefix(problems[1], "unknown key daemon.scheduler.task_timeout; did you mean"))
+	require.Contains(t, problems[1], "daemon.scheduler.task_timeout_min")
+}
+
+func TestCheckConfigMap(t *testing.T) {
+	type runnerConfig struct {
+		LogLevel string `toml:"log_level"`
+	}
+	problems := CheckConfigMap(`runners.local:docker`, ConfigMap{"log_level": "debug", "loglevel": "debug", "disabled": true}, reflect.TypeOf(runnerConfig{}), RunnerDisabledFlag)
+	require.Equal(t, []string{"unknown key runners.local:docker.loglevel; did you mean runners.local:docker.log_level?"}, problems)
+}
+
+func TestMigrate(t *testing.T) {
+	const data = `
+[daemon]
+listen = ":8042"
+workers = 4
+task_timeout_min = 30
+
+["local:docker"]
+keep_containers = true
+
+[builders."cluster:k8s"]
+provider = "aws"
+
+[runners."docker:go"]
+go_version = "1.16"
+`
+	var raw map[string]interface{}
+	_, err := toml.Decode(data, &raw)
+	require.NoError(t, err)
+
+	changes := Migrate(raw)
+	require.Len(t, changes, 5)
+
+	var cfg EnvConfig
+	var buf strings.Builder
+	require.NoError(t, toml.NewEncoder(&buf).Encode(raw))
+	md, err := toml.Decode(buf.String(), &cfg)
+	require.NoError(t, err)
+	require.NoError(t, checkUndecoded("", md, reflect.TypeOf(cfg)))
+
+	require.Equal(t, 4, cfg.Daemon.Scheduler.Workers)
+	require.Equal(t, 30, cfg.Daemon.Scheduler.TaskTimeoutMin)
+	require.Equal(t, true, cfg.Runners["local:docker"]["keep_containers"])
+	require.Equal(t, "aws", cfg.Runners["cluster:k8s"]["provider"])
+	require.Equal(t, "1.16", cfg.Builders["docker:go"]["go_version"])
+	require.Empty(t, cfg.Builders["cluster:k8s"])
+
+	// migrating again changes nothing.
+	require.Empty(t, Migrate(raw))
+}
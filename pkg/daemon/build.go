@@ -34,6 +34,8 @@ func (d *Daemon) buildHandler(engine api.Engine) func(w http.ResponseWriter, r *
 			tgw.WriteError("failed to create temp directory to unpack request", "err", err)
 			return
 		}
+		// queued tasks get a copy of the sources in their own workspace.
+		defer os.RemoveAll(dir)
 
 		var request *api.BuildRequest
 		sources, err := consumeRunBuildRequest(r, &request, dir)
@@ -42,12 +44,12 @@ func (d *Daemon) buildHandler(engine api.Engine) func(w http.ResponseWriter, r *
 			return
 		}
 
-		if sources == nil || sources.PlanDir == "" {
+		if (sources == nil || sources.PlanDir == "") && !request.Composition.Global.RemotePlan() {
 			tgw.WriteError("bad request", "err", errors.New("plan directory not present"))
 			return
 		}
 
-		id, err := engine.QueueBuild(request, sources)
+		id, err := engine.QueueBuild(r.Context(), request, sources)
 		if err != nil {
 			tgw.WriteError(fmt.Sprintf("engine build error: %s", err))
 			return
@@ -136,6 +138,14 @@ Outer:
 				kind     = strings.TrimSuffix(filename, ".zip")
 			)
 
+			// the file name is chosen by the client; only accept the parts
+			// we know, so that nothing is written outside of dir.
+			switch filename {
+			case "plan.zip", "sdk.zip", "extra.zip":
+			default:
+				return nil, fmt.Errorf("unexpected part in request: %q", filename)
+			}
+
 			// Read the archive.
 			targetzip, err := os.Create(filepath.Join(dir, filename))
 			if err != nil {
@@ -151,7 +161,10 @@ Outer:
 				return nil, fmt.Errorf("failed to create directory for sdk: %w", err)
 			}
 			logging.S().Infof("extracting %s to %s", filename, destdir)
-			if err := archiver.NewZip().Unarchive(targetzip.Name(), destdir); err != nil {
+			err = archiver.NewZip().Unarchive(targetzip.Name(), destdir)
+			_ = targetzip.Close()
+			_ = os.Remove(targetzip.Name())
+			if err != nil {
 				return nil, fmt.Errorf("failed to decompress sdk: %w", err)
 			}
 
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/engine"
 	"github.com/testground/testground/pkg/logging"
@@ -21,7 +22,11 @@ type Daemon struct {
 	server *http.Server
 	l      net.Listener
 	mv     *metrics.Viewer
+	engine *engine.Engine
 	doneCh chan struct{}
+
+	// openAPI is the OpenAPI document describing the routes of the daemon.
+	openAPI map[string]interface{}
 }
 
 // New creates a new Daemon and attaches the following handlers:
@@ -30,6 +35,9 @@ type Daemon struct {
 // * GET /describe: sends a `describe` request to the daemon. describes a test plan or test case.
 // * POST /build: sends a `build` request to the daemon. builds a test plan.
 // * POST /run: sends a `run` request to the daemon. (builds and) runs test case with name `<testplan>/<testcase>`.
+//
+// The full list is in routes.go, and is served as an OpenAPI document at
+// GET /openapi.json.
 // A type-safe client for this server can be found in the `pkg/client` package.
 func New(cfg *config.EnvConfig) (srv *Daemon, err error) {
 	srv = new(Daemon)
@@ -38,6 +46,7 @@ func New(cfg *config.EnvConfig) (srv *Daemon, err error) {
 	if err != nil {
 		return nil, err
 	}
+	srv.engine = engine
 
 	mv, err := metrics.NewViewer(cfg)
 	if err != nil {
@@ -45,20 +54,41 @@ func New(cfg *config.EnvConfig) (srv *Daemon, err error) {
 	}
 
 	r := mux.NewRouter().StrictSlash(true)
+	ds := newDatasets(cfg)
 
-	if len(cfg.Daemon.Tokens) > 0 {
-		tokens := map[string]struct{}{}
-		for _, t := range cfg.Daemon.Tokens {
+	tokens := map[string]struct{}{}
+	for _, t := range cfg.Daemon.Tokens {
+		tokens[strings.TrimSpace(t)] = struct{}{}
+	}
+	// users are the users of the tokens that belong to one.
+	users := map[string]string{}
+	for user, ts := range cfg.Daemon.UserTokens {
+		for _, t := range ts {
 			tokens[strings.TrimSpace(t)] = struct{}{}
+			users[strings.TrimSpace(t)] = user
 		}
+	}
 
+	if len(tokens) > 0 {
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// test instances authenticate to the stores of their runs,
+				// to abort them or claim their roles, to the objects of
+				// their runs, and to datasets, with their own tokens, and
+				// read the time without any.
+				if r.URL.Path == "/runs/store" || r.URL.Path == "/runs/abort" || r.URL.Path == "/runs/roles" || runObjectPath.MatchString(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/datasets/") || r.URL.Path == "/time" {
+					next.ServeHTTP(w, r)
+					return
+				}
+
 				splitToken := strings.Split(r.Header.Get("Authorization"), "Bearer ")
 				if len(splitToken) == 2 {
 					requestToken := strings.TrimSpace(splitToken[1])
 
 					if _, ok := tokens[requestToken]; ok {
+						if user := users[requestToken]; user != "" {
+							r = r.WithContext(api.WithAuthenticatedUser(r.Context(), user))
+						}
 						next.ServeHTTP(w, r)
 						return
 					}
@@ -80,25 +110,11 @@ func New(cfg *config.EnvConfig) (srv *Daemon, err error) {
 	staticDir := "/static/"
 	r.PathPrefix(staticDir).Handler(http.StripPrefix(staticDir, http.FileServer(http.Dir("."+staticDir))))
 
-	r.HandleFunc("/data", srv.dataHandler(engine)).Methods("GET")
-	r.HandleFunc("/dashboard", srv.dashboardHandler(engine)).Methods("GET")
-	r.HandleFunc("/kill", srv.killTaskHandler(engine)).Methods("GET")
-	r.HandleFunc("/delete", srv.deleteHandler(engine)).Methods("GET") // temporary endpoint until we build a proper ACL/admin endpoints within the daemon
-	r.HandleFunc("/tasks", srv.listTasksHandler(engine)).Methods("GET")
-	r.HandleFunc("/logs", srv.getLogsHandler(engine)).Methods("GET")
-	r.HandleFunc("/outputs", srv.getOutputsHandler(engine)).Methods("GET")
-	r.HandleFunc("/journal", srv.getJournalHandler(engine)).Methods("GET")
-	r.HandleFunc("/", srv.redirect()).Methods("GET")
-
-	r.HandleFunc("/build", srv.buildHandler(engine)).Methods("POST")
-	r.HandleFunc("/build/purge", srv.buildPurgeHandler(engine)).Methods("POST")
-	r.HandleFunc("/run", srv.runHandler(engine)).Methods("POST")
-	r.HandleFunc("/outputs", srv.outputsHandler(engine)).Methods("POST")
-	r.HandleFunc("/terminate", srv.terminateHandler(engine)).Methods("POST")
-	r.HandleFunc("/healthcheck", srv.healthcheckHandler(engine)).Methods("POST")
-	r.HandleFunc("/tasks", srv.tasksHandler(engine)).Methods("POST")
-	r.HandleFunc("/status", srv.statusHandler(engine)).Methods("POST")
-	r.HandleFunc("/logs", srv.logsHandler(engine)).Methods("POST")
+	routes := srv.routes(engine, tokens, ds)
+	for _, rt := range routes {
+		r.HandleFunc(rt.path, rt.handler).Methods(rt.method)
+	}
+	srv.openAPI = openAPIDocument(routes)
 
 	srv.doneCh = make(chan struct{})
 	srv.server = &http.Server{
@@ -139,7 +155,12 @@ func (d *Daemon) Port() int {
 	return d.l.Addr().(*net.TCPAddr).Port
 }
 
+// Shutdown stops the server, then cancels the tasks in progress.
 func (d *Daemon) Shutdown(ctx context.Context) error {
 	defer close(d.doneCh)
-	return d.server.Shutdown(ctx)
+	err := d.server.Shutdown(ctx)
+	if d.engine != nil {
+		_ = d.engine.Close()
+	}
+	return err
 }
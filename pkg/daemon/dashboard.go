@@ -8,6 +8,7 @@ import (
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/metrics"
 	"github.com/testground/testground/tmpl"
 )
 
@@ -39,9 +40,15 @@ func (d *Daemon) dashboardHandler(engine api.Engine) func(w http.ResponseWriter,
 			return
 		}
 
+		stream, err := metrics.ParseStream(r.URL.Query().Get("stream"))
+		if err != nil {
+			fmt.Fprintf(w, "%s", err)
+			return
+		}
+
 		name := clean(tsk.Plan) + "-" + tsk.Case
 
-		measurements, err := d.mv.GetMeasurements(name)
+		measurements, err := d.mv.GetMeasurements(stream, name)
 		if err != nil {
 			fmt.Fprintf(w, "Cannot get measurements")
 			return
@@ -64,10 +71,12 @@ func (d *Daemon) dashboardHandler(engine api.Engine) func(w http.ResponseWriter,
 		}
 
 		data := struct {
-			Plan  string
-			Items []Item
+			Plan   string
+			Stream string
+			Items  []Item
 		}{
 			tsk.Plan + ":" + tsk.Case,
+			string(stream),
 			nil,
 		}
 
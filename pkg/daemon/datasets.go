@@ -0,0 +1,198 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+var (
+	// errUnknownDataset is returned for datasets that are neither present
+	// locally nor configured with a source.
+	errUnknownDataset = errors.New("unknown dataset")
+	errInvalidDataset = errors.New("invalid dataset name")
+)
+
+// datasets serves the datasets in the datasets directory to test instances.
+// Datasets configured with a source are fetched into the directory on first
+// use, so that they are downloaded once per daemon rather than per instance.
+type datasets struct {
+	dir     string
+	sources map[string]string
+
+	lk      sync.Mutex
+	fetches map[string]*sync.Mutex
+}
+
+func newDatasets(cfg *config.EnvConfig) *datasets {
+	return &datasets{
+		dir:     cfg.Dirs().Datasets(),
+		sources: cfg.Daemon.Datasets,
+		fetches: make(map[string]*sync.Mutex),
+	}
+}
+
+// list returns the datasets known to the daemon, sorted by name.
+func (ds *datasets) list() ([]api.Dataset, error) {
+	byName := make(map[string]api.Dataset)
+	for name, src := range ds.sources {
+		byName[name] = api.Dataset{Name: name, Source: src}
+	}
+
+	fis, err := ioutil.ReadDir(ds.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		d := byName[fi.Name()]
+		d.Name, d.Cached, d.Size = fi.Name(), true, fi.Size()
+		byName[fi.Name()] = d
+	}
+
+	res := make([]api.Dataset, 0, len(byName))
+	for _, d := range byName {
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// open returns the local copy of a dataset, fetching it from its source if
+// necessary.
+func (ds *datasets) open(ctx context.Context, name string) (*os.File, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: %q", errInvalidDataset, name)
+	}
+
+	// serialise fetches of the same dataset.
+	ds.lk.Lock()
+	lk, ok := ds.fetches[name]
+	if !ok {
+		lk = new(sync.Mutex)
+		ds.fetches[name] = lk
+	}
+	ds.lk.Unlock()
+
+	lk.Lock()
+	defer lk.Unlock()
+
+	path := filepath.Join(ds.dir, name)
+	f, err := os.Open(path)
+	if err == nil || !os.IsNotExist(err) {
+		return f, err
+	}
+
+	src, ok := ds.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownDataset, name)
+	}
+	if err := ds.fetch(ctx, src, path); err != nil {
+		return nil, fmt.Errorf("failed to fetch dataset %s: %w", name, err)
+	}
+	return os.Open(path)
+}
+
+// fetch downloads src to path. The download is written to a temporary file
+// and renamed into place, so that partial downloads are never served.
+func (ds *datasets) fetch(ctx context.Context, src, path string) error {
+	if err := os.MkdirAll(ds.dir, 0755); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(ds.dir, ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// The /datasets endpoints list datasets to clients, and serve them to test
+// instances, which authenticate with the tokens of the key/value store of
+// their run.
+
+func (d *Daemon) datasetsHandler(ds *datasets) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := ds.list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}
+}
+
+func (d *Daemon) datasetHandler(e api.Engine, tokens map[string]struct{}, ds *datasets) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, _ := authorizeRunStore(e, tokens, r, r.URL.Query().Get("run_id")); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		f, err := ds.open(r.Context(), mux.Vars(r)["name"])
+		switch {
+		case errors.Is(err, errInvalidDataset):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, errUnknownDataset):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// ServeContent supports range requests, so that instances can resume
+		// interrupted downloads.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	}
+}
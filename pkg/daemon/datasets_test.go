@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDatasetsFetchOnce(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte("fixture"))
+	}))
+	defer srv.Close()
+
+	ds := &datasets{
+		dir:     t.TempDir(),
+		sources: map[string]string{"remote": srv.URL},
+		fetches: make(map[string]*sync.Mutex),
+	}
+	if err := ioutil.WriteFile(filepath.Join(ds.dir, "local"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		f, err := ds.open(context.Background(), "remote")
+		if err != nil {
+			t.Fatalf("failed to open dataset: %s", err)
+		}
+		b, _ := ioutil.ReadAll(f)
+		_ = f.Close()
+		if string(b) != "fixture" {
+			t.Errorf("got %q, want %q", b, "fixture")
+		}
+	}
+	if hits != 1 {
+		t.Errorf("dataset fetched %d times, want 1", hits)
+	}
+
+	list, err := ds.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "local" || !list[1].Cached || list[1].Source != srv.URL {
+		t.Errorf("unexpected datasets: %+v", list)
+	}
+
+	if _, err := ds.open(context.Background(), "missing"); !errors.Is(err, errUnknownDataset) {
+		t.Errorf("got %v, want errUnknownDataset", err)
+	}
+	if _, err := ds.open(context.Background(), "../local"); !errors.Is(err, errInvalidDataset) {
+		t.Errorf("got %v, want errInvalidDataset", err)
+	}
+	if _, err := os.Stat(filepath.Join(ds.dir, "remote")); err != nil {
+		t.Errorf("dataset not cached: %s", err)
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/logging"
+)
+
+// debugHandler attaches the client to a live instance of a run. Once the
+// instance is reached, the connection is upgraded to a raw byte stream,
+// spliced to the terminal of a shell in the instance, or to one of its ports.
+func (d *Daemon) debugHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "debug")
+		defer log.Debugw("request handled", "command", "debug")
+
+		req, err := parseDebugRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Upgrade") != client.DebugUpgrade {
+			http.Error(w, "expected upgrade to "+client.DebugUpgrade, http.StatusUpgradeRequired)
+			return
+		}
+
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+			return
+		}
+
+		stream, err := engine.DoDebug(r.Context(), req)
+		if err != nil {
+			log.Warnw("debug error", "err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer stream.Close()
+
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			log.Warnw("debug hijack error", "err", err.Error())
+			return
+		}
+		defer conn.Close()
+
+		// sessions outlive the timeouts of regular requests.
+		_ = conn.SetDeadline(time.Time{})
+
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", client.DebugUpgrade)
+		if err := buf.Flush(); err != nil {
+			return
+		}
+
+		log.Infow("debug session started", "run_id", req.RunID, "group", req.Group, "instance", req.Instance, "port", req.Port)
+		client.Splice(client.BufferedConn(conn, buf.Reader), stream)
+		log.Infow("debug session ended", "run_id", req.RunID, "group", req.Group, "instance", req.Instance, "port", req.Port)
+	}
+}
+
+func parseDebugRequest(r *http.Request) (*api.DebugRequest, error) {
+	q := r.URL.Query()
+
+	req := &api.DebugRequest{
+		RunID: q.Get("run_id"),
+		Group: q.Get("group"),
+	}
+	if req.RunID == "" {
+		return nil, fmt.Errorf("url param `run_id` is missing")
+	}
+
+	for name, dst := range map[string]*int{"instance": &req.Instance, "port": &req.Port} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid url param `%s`: %s", name, v)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*uint{"rows": &req.Rows, "cols": &req.Cols} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url param `%s`: %s", name, v)
+			}
+			*dst = uint(n)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) describeRunHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.DescribeRunRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("describe json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rec, err := engine.DescribeRun(req.RunID)
+		if err != nil {
+			tgw.WriteError("could not describe run", "run_id", req.RunID, "err", err)
+			return
+		}
+
+		tgw.WriteResult(rec)
+	}
+}
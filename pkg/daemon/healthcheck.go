@@ -35,3 +35,30 @@ func (d *Daemon) healthcheckHandler(engine api.Engine) func(w http.ResponseWrite
 		tgw.WriteResult(out)
 	}
 }
+
+func (d *Daemon) infraUpgradeHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "infra upgrade")
+		defer log.Debugw("request handled", "command", "infra upgrade")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.InfraUpgradeRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("infra upgrade json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		out, err := engine.DoInfraUpgrade(r.Context(), req.Runner, tgw)
+		if err != nil {
+			tgw.WriteError("infra upgrade error", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult(out)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
 )
 
 func (d *Daemon) logsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
@@ -26,7 +27,15 @@ func (d *Daemon) logsHandler(engine api.Engine) func(w http.ResponseWriter, r *h
 			return
 		}
 
-		tsk, err := engine.Logs(r.Context(), req.TaskID, req.Follow, req.CancelWithContext, w)
+		var tsk *task.Task
+		switch req.Phase {
+		case "":
+			tsk, err = engine.Logs(r.Context(), req.TaskID, req.Follow, req.CancelWithContext, w)
+		case api.LogsPhaseBuild:
+			tsk, err = engine.BuildLogs(r.Context(), req.TaskID, req.Follow, req.CancelWithContext, w)
+		default:
+			err = fmt.Errorf("unknown logs phase: %s", req.Phase)
+		}
 		if err != nil {
 			tgw.WriteError("error while getting task", "err", err)
 			return
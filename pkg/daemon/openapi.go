@@ -0,0 +1,260 @@
+package daemon
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/version"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	pathParam = regexp.MustCompile(`{([^}]+)}`)
+)
+
+// openAPIHandler serves the OpenAPI document of the daemon, from which
+// clients in other languages can be generated.
+func (d *Daemon) openAPIHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d.openAPI)
+	}
+}
+
+// openAPIDocument describes routes as an OpenAPI 3 document. The schemas of
+// requests and responses are derived from the Go types the handlers decode
+// and encode.
+func openAPIDocument(routes []route) map[string]interface{} {
+	g := &schemaGen{defs: make(map[string]interface{})}
+	chunk := g.schema(reflect.TypeOf(rpc.Chunk{}))
+
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		op := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt.method, rt.path),
+		}
+
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range rt.query {
+			params = append(params, map[string]interface{}{
+				"name": q, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		switch {
+		case rt.multipart:
+			// the request is a JSON part, followed by the sources of the
+			// plan, of the SDK and of extra sources, as plan.zip, sdk.zip and
+			// extra.zip attachments.
+			zip := map[string]interface{}{"type": "string", "format": "binary"}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"multipart/related": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"composition": g.schema(reflect.TypeOf(rt.body)),
+								"plan":        zip,
+								"sdk":         zip,
+								"extra":       zip,
+							},
+						},
+					},
+				},
+			}
+		case rt.body != nil:
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(rt.body))},
+				},
+			}
+		case rt.rawBody:
+			op["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/octet-stream": map[string]interface{}{
+						"schema": map[string]interface{}{"type": "string", "format": "binary"},
+					},
+				},
+			}
+		}
+
+		res := map[string]interface{}{"description": "OK"}
+		switch rt.response {
+		case responseRPC:
+			res["description"] = "A stream of chunks: progress and binary chunks, then a result or an error chunk."
+			res["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": chunk}}
+			if rt.result != nil {
+				// OpenAPI can't describe the payload of the last chunk of a
+				// stream; extensions can.
+				res["x-testground-result"] = g.schema(reflect.TypeOf(rt.result))
+			}
+		case responseJSON:
+			schema := map[string]interface{}{"type": "object"}
+			if rt.result != nil {
+				schema = g.schema(reflect.TypeOf(rt.result))
+			}
+			res["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+		case responseBinary:
+			res["content"] = map[string]interface{}{
+				"application/octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			}
+		case responseText:
+			res["content"] = map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+		case responseHTML:
+			res["content"] = map[string]interface{}{"text/html": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+		}
+		op["responses"] = map[string]interface{}{"200": res}
+
+		item, ok := paths[rt.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	ver := version.GitCommit
+	if ver == "" {
+		ver = "dev"
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Testground daemon",
+			"version": ver,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.defs,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"token": []string{}}},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// postRunsAbort for POST /runs/abort.
+func operationID(method, p string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaGen derives JSON schemas from Go types, following the rules of
+// encoding/json. Named structs are defined once, as components.
+type schemaGen struct {
+	defs map[string]interface{}
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+	if t.Kind() != reflect.Ptr && t.Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := g.defs[name]; !ok {
+			// reserve the name first, for recursive types.
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		// interfaces hold any value.
+		return map[string]interface{}{}
+	}
+}
+
+// object describes the fields of a struct, flattening embedded structs like
+// encoding/json does.
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	g.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type openAPIInner struct {
+	Name string `json:"name"`
+}
+
+type openAPIRequest struct {
+	openAPIInner
+	Count   int               `json:"count,omitempty"`
+	When    time.Time         `json:"when"`
+	Wait    time.Duration     `json:"wait"`
+	Labels  map[string]string `json:"labels"`
+	Next    *openAPIRequest   `json:"next,omitempty"`
+	Skipped string            `json:"-"`
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	routes := []route{
+		{method: "POST", path: "/things", summary: "Do a thing", body: openAPIRequest{}, result: ""},
+		{method: "GET", path: "/things/{id}", summary: "Get a thing", query: []string{"full"}, response: responseJSON, result: openAPIInner{}},
+	}
+	doc := openAPIDocument(routes)
+
+	// the document must be encodable.
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	post := paths["/things"].(map[string]interface{})["post"].(map[string]interface{})
+	if id := post["operationId"]; id != "postThings" {
+		t.Errorf("unexpected operation id %v", id)
+	}
+	get := paths["/things/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	if id := get["operationId"]; id != "getThingsId" {
+		t.Errorf("unexpected operation id %v", id)
+	}
+	if n := len(get["parameters"].([]interface{})); n != 2 {
+		t.Errorf("expected a path and a query parameter; got %d", n)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	req, ok := schemas["daemon.openAPIRequest"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("request schema missing; got %v", schemas)
+	}
+	props := req["properties"].(map[string]interface{})
+	for _, name := range []string{"name", "count", "when", "wait", "labels", "next"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("property %s missing", name)
+		}
+	}
+	for _, name := range []string{"Skipped", "-"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("unexpected property %s", name)
+		}
+	}
+	if f := props["when"].(map[string]interface{})["format"]; f != "date-time" {
+		t.Errorf("unexpected format of times %v", f)
+	}
+	if ref := props["next"].(map[string]interface{})["$ref"]; ref != "#/components/schemas/daemon.openAPIRequest" {
+		t.Errorf("unexpected reference %v", ref)
+	}
+	if _, ok := schemas["daemon.openAPIInner"]; !ok {
+		t.Errorf("result schema missing")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/testground/testground/pkg/client"
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
 )
 
 func (d *Daemon) outputsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +36,7 @@ func (d *Daemon) outputsHandler(engine api.Engine) func(w http.ResponseWriter, r
 			tgw.WriteResult(result)
 		}()
 
-		err = engine.DoCollectOutputs(r.Context(), req.RunID, tgw)
+		err = engine.DoCollectOutputs(r.Context(), &req, tgw)
 		if err != nil {
 			log.Warnw("collect outputs error", "err", err.Error())
 			return
@@ -58,11 +59,24 @@ func (d *Daemon) getOutputsHandler(engine api.Engine) func(w http.ResponseWriter
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/tar+gzip")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.tgz\"", runId))
+		// validate the compression before the headers name the archive after
+		// it.
+		compression := r.URL.Query().Get("compression")
+		if err := runner.CheckOutputsCompression(compression, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if compression == runner.OutputsCompressionZstd {
+			w.Header().Set("Content-Type", "application/zstd")
+		} else {
+			w.Header().Set("Content-Type", "application/tar+gzip")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", runId, runner.OutputsArchiveExt(compression)))
 
 		req := api.OutputsRequest{
-			RunID: runId,
+			RunID:       runId,
+			Dedup:       r.URL.Query().Get("dedup") == "true",
+			Compression: compression,
 		}
 
 		rr, ww := io.Pipe()
@@ -76,7 +90,7 @@ func (d *Daemon) getOutputsHandler(engine api.Engine) func(w http.ResponseWriter
 			}
 		}()
 
-		err := engine.DoCollectOutputs(r.Context(), req.RunID, tgw)
+		err := engine.DoCollectOutputs(r.Context(), &req, tgw)
 		if err != nil {
 			log.Warnw("collect outputs error", "err", err.Error())
 			return
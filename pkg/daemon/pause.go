@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) pauseRunHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return runPauseHandler("pause", engine.DoPauseRun)
+}
+
+func (d *Daemon) resumeRunHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return runPauseHandler("resume", engine.DoResumeRun)
+}
+
+func runPauseHandler(command string, do func(context.Context, string, *rpc.OutputWriter) error) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", command)
+		defer log.Debugw("request handled", "command", command)
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.PauseRunRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError(command+" json decode", "err", err.Error())
+			return
+		}
+
+		err = do(r.Context(), req.RunID, tgw)
+		if err != nil {
+			tgw.WriteError(command+" error", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult("Done")
+	}
+}
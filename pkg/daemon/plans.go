@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) publishPlanHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruid := r.Header.Get("X-Request-ID")
+		log := logging.S().With("req_id", ruid)
+
+		log.Infow("handle request", "command", "plan publish")
+		defer log.Infow("request handled", "command", "plan publish")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		// Create a packing directory under the workdir.
+		dir := filepath.Join(engine.EnvConfig().Dirs().Work(), "requests", ruid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tgw.WriteError("failed to create temp directory to unpack request", "err", err)
+			return
+		}
+		// the registry keeps its own copy of the plan.
+		defer os.RemoveAll(dir)
+
+		var request *api.PublishPlanRequest
+		sources, err := consumeRunBuildRequest(r, &request, dir)
+		if err != nil {
+			tgw.WriteError("failed to consume request", "err", err)
+			return
+		}
+
+		plan, err := engine.PublishPlan(request, sources)
+		if err != nil {
+			tgw.WriteError("could not publish plan", "err", err)
+			return
+		}
+
+		tgw.WriteResult(plan)
+	}
+}
+
+func (d *Daemon) plansHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.PlansRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			tgw.WriteError("plans json decode", "err", err.Error())
+			return
+		}
+
+		plans, err := engine.PublishedPlans(req.Plan)
+		if err != nil {
+			tgw.WriteError("could not list published plans", "err", err)
+			return
+		}
+
+		tgw.WriteResult(plans)
+	}
+}
+
+func (d *Daemon) planInfoHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.PlanInfoRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			tgw.WriteError("plan info json decode", "err", err.Error())
+			return
+		}
+
+		plan, err := engine.PublishedPlan(req.Plan, req.Version)
+		if err != nil {
+			tgw.WriteError("could not describe published plan", "plan", req.Plan, "version", req.Version, "err", err)
+			return
+		}
+
+		tgw.WriteResult(plan)
+	}
+}
@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+// responseKind is how an endpoint responds.
+type responseKind int
+
+const (
+	// responseRPC is a stream of rpc.Chunk, ending with a result or an error.
+	responseRPC responseKind = iota
+	// responseJSON is a single JSON document.
+	responseJSON
+	// responseBinary is an arbitrary byte stream, e.g. an archive.
+	responseBinary
+	// responseText is plain text.
+	responseText
+	// responseHTML is a page for browsers.
+	responseHTML
+	// responseNone has no body.
+	responseNone
+)
+
+// route is an endpoint of the daemon. Routes are registered on the router,
+// and described in the OpenAPI document of the daemon, from the same table,
+// so that the document can't drift from the handlers.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	summary string
+
+	// query lists the query parameters of the endpoint.
+	query []string
+	// body is a value of the type of the JSON body of requests; nil if they
+	// have none.
+	body interface{}
+	// multipart is set if the body is sent as a multipart request, along
+	// with the sources of a test plan.
+	multipart bool
+	// rawBody is set if the body is an arbitrary byte stream.
+	rawBody bool
+
+	response responseKind
+	// result is a value of the type of the result of RPC responses, or of
+	// JSON responses.
+	result interface{}
+}
+
+func (d *Daemon) routes(engine api.Engine, tokens map[string]struct{}, ds *datasets) []route {
+	return []route{
+		{method: "GET", path: "/data", handler: d.dataHandler(engine), summary: "Metrics of a task, for its dashboard", query: []string{"series"}, response: responseJSON},
+		{method: "GET", path: "/dashboard", handler: d.dashboardHandler(engine), summary: "Dashboard of the metrics of a task", query: []string{"task_id", "stream"}, response: responseHTML},
+		{method: "GET", path: "/kill", handler: d.killTaskHandler(engine), summary: "Kill a task, from the tasks page", query: []string{"task_id"}, response: responseHTML},
+		{method: "GET", path: "/delete", handler: d.deleteHandler(engine), summary: "Delete a task, from the tasks page", query: []string{"task_id"}, response: responseHTML},
+		{method: "GET", path: "/tasks", handler: d.listTasksHandler(engine), summary: "Page of the tasks of the daemon", response: responseHTML},
+		{method: "GET", path: "/logs", handler: d.getLogsHandler(engine), summary: "Log of a task", query: []string{"task_id"}, response: responseText},
+		{method: "GET", path: "/outputs", handler: d.getOutputsHandler(engine), summary: "Outputs archive of a run", query: []string{"run_id", "compression", "dedup"}, response: responseBinary},
+		{method: "GET", path: "/journal", handler: d.getJournalHandler(engine), summary: "Journal of a task", query: []string{"task_id"}, response: responseHTML},
+		{method: "GET", path: "/debug", handler: d.debugHandler(engine), summary: "Attach to a live instance; upgrades the connection", query: []string{"run_id", "group", "instance", "port", "rows", "cols"}, response: responseBinary},
+		{method: "GET", path: "/runs/store", handler: d.runStoreHandler(engine, tokens), summary: "Values of the store of a run", query: []string{"run_id"}, response: responseJSON, result: map[string]string{}},
+		{method: "GET", path: "/runs/{run_id}/objects/{key}", handler: d.runObjectHandler(engine, tokens), summary: "Object of the object store of a run", response: responseBinary},
+		{method: "GET", path: "/datasets", handler: d.datasetsHandler(ds), summary: "Datasets served to instances", response: responseJSON, result: api.DatasetsResponse{}},
+		{method: "GET", path: "/datasets/{name}", handler: d.datasetHandler(engine, tokens, ds), summary: "Content of a dataset", query: []string{"run_id"}, response: responseBinary},
+		{method: "GET", path: "/time", handler: d.timeHandler(), summary: "Clock of the daemon", response: responseJSON, result: api.TimeResponse{}},
+		{method: "GET", path: "/stats", handler: d.getStatsHandler(engine), summary: "Statistics of test cases", query: []string{"plan", "case", "since", "window"}, response: responseJSON, result: api.StatsResponse{}},
+		{method: "GET", path: "/", handler: d.redirect(), summary: "Redirect to the tasks page", response: responseNone},
+		{method: "GET", path: "/openapi.json", handler: d.openAPIHandler(), summary: "This document", response: responseJSON},
+
+		{method: "POST", path: "/build", handler: d.buildHandler(engine), summary: "Queue a build of a test plan", body: api.BuildRequest{}, multipart: true, result: ""},
+		{method: "POST", path: "/build/purge", handler: d.buildPurgeHandler(engine), summary: "Purge the build cache of a test plan", body: api.BuildPurgeRequest{}, result: ""},
+		{method: "POST", path: "/run", handler: d.runHandler(engine), summary: "Queue a run of a test plan", body: api.RunRequest{}, multipart: true, result: ""},
+		{method: "POST", path: "/trigger", handler: d.triggerHandler(engine), summary: "Queue a run of a test plan from a repository", body: api.TriggerRequest{}, result: ""},
+		{method: "POST", path: "/worker/claim", handler: d.workerClaimHandler(engine), summary: "Claim a task, for a remote worker", response: responseJSON, result: task.Task{}},
+		{method: "GET", path: "/worker/sources", handler: d.workerSourcesHandler(engine), summary: "Sources of a claimed task, for a remote worker", query: []string{"task_id"}, response: responseBinary},
+		{method: "POST", path: "/worker/update", handler: d.workerUpdateHandler(engine), summary: "Report the state of a task, from a remote worker", query: []string{"event"}, body: task.Task{}, response: responseJSON, result: api.WorkerUpdateResponse{}},
+		{method: "POST", path: "/worker/logs", handler: d.workerLogsHandler(engine), summary: "Append to the log of a task, from a remote worker", query: []string{"task_id"}, rawBody: true, response: responseNone},
+		{method: "POST", path: "/outputs", handler: d.outputsHandler(engine), summary: "Collect the outputs of a run", body: api.OutputsRequest{}, result: true},
+		{method: "POST", path: "/terminate", handler: d.terminateHandler(engine), summary: "Terminate the jobs of a runner or a builder", body: api.TerminateRequest{}, result: ""},
+		{method: "POST", path: "/healthcheck", handler: d.healthcheckHandler(engine), summary: "Check, and optionally fix, the environment of a runner", body: api.HealthcheckRequest{}, result: api.HealthcheckResponse{}},
+		{method: "POST", path: "/infra/upgrade", handler: d.infraUpgradeHandler(engine), summary: "Upgrade the infrastructure of a runner", body: api.InfraUpgradeRequest{}, result: api.HealthcheckResponse{}},
+		{method: "POST", path: "/tasks", handler: d.tasksHandler(engine), summary: "List tasks", body: api.TasksRequest{}, result: []task.Task{}},
+		{method: "POST", path: "/status", handler: d.statusHandler(engine), summary: "Status of a task", body: api.StatusRequest{}, result: api.StatusResponse{}},
+		{method: "POST", path: "/describe", handler: d.describeRunHandler(engine), summary: "Record of a run", body: api.DescribeRunRequest{}, result: api.DescribeRunResponse{}},
+		{method: "POST", path: "/stats", handler: d.statsHandler(engine), summary: "Statistics of test cases", body: api.StatsRequest{}, result: api.StatsResponse{}},
+		{method: "POST", path: "/sweeps/report", handler: d.sweepReportHandler(engine), summary: "Report of the runs of a sweep", body: api.SweepReportRequest{}, result: api.SweepReportResponse{}},
+		{method: "POST", path: "/plans", handler: d.plansHandler(engine), summary: "List published test plans", body: api.PlansRequest{}, result: api.PlansResponse{}},
+		{method: "POST", path: "/plans/info", handler: d.planInfoHandler(engine), summary: "Published test plan", body: api.PlanInfoRequest{}, result: api.PlanInfoResponse{}},
+		{method: "POST", path: "/plans/publish", handler: d.publishPlanHandler(engine), summary: "Publish a test plan", body: api.PublishPlanRequest{}, multipart: true, result: api.PublishPlanResponse{}},
+		{method: "POST", path: "/logs", handler: d.logsHandler(engine), summary: "Stream the log of a task", body: api.LogsRequest{}, result: api.LogsResponse{}},
+		{method: "POST", path: "/cancel", handler: d.cancelHandler(engine), summary: "Cancel a task in progress", body: api.CancelRequest{}, result: ""},
+		{method: "POST", path: "/runs/store", handler: d.setRunValueHandler(engine, tokens), summary: "Set a value in the store of a run", query: []string{"run_id"}, body: api.SetRunValueRequest{}, response: responseJSON},
+		{method: "POST", path: "/runs/abort", handler: d.abortRunHandler(engine, tokens), summary: "Abort a run, from one of its instances", query: []string{"run_id"}, body: api.AbortRunRequest{}, response: responseJSON},
+		{method: "POST", path: "/runs/roles", handler: d.claimRoleHandler(engine, tokens), summary: "Claim a role of a run, from one of its instances", query: []string{"run_id"}, body: api.ClaimRoleRequest{}, response: responseJSON, result: api.ClaimRoleResponse{}},
+		{method: "PUT", path: "/runs/{run_id}/objects/{key}", handler: d.putRunObjectHandler(engine, tokens), summary: "Put an object in the object store of a run", rawBody: true, response: responseJSON},
+		{method: "POST", path: "/runs/pause", handler: d.pauseRunHandler(engine), summary: "Pause a run", body: api.PauseRunRequest{}, result: ""},
+		{method: "POST", path: "/runs/resume", handler: d.resumeRunHandler(engine), summary: "Resume a paused run", body: api.PauseRunRequest{}, result: ""},
+		{method: "POST", path: "/runs/scale", handler: d.scaleRunHandler(engine), summary: "Resize a group of a run", body: api.ScaleRunRequest{}, result: ""},
+	}
+}
@@ -28,6 +28,8 @@ func (d *Daemon) runHandler(engine api.Engine) func(w http.ResponseWriter, r *ht
 			tgw.WriteError("failed to create temp directory to unpack request", "err", err)
 			return
 		}
+		// queued tasks get a copy of the sources in their own workspace.
+		defer os.RemoveAll(dir)
 
 		var request *api.RunRequest
 		sources, err := consumeRunBuildRequest(r, &request, dir)
@@ -36,12 +38,12 @@ func (d *Daemon) runHandler(engine api.Engine) func(w http.ResponseWriter, r *ht
 			return
 		}
 
-		if len(request.BuildGroups) > 0 && sources == nil {
+		if len(request.BuildGroups) > 0 && sources == nil && !request.Composition.Global.RemotePlan() {
 			tgw.WriteError("failed to consume request", "err", errors.New("plan dir required for build"))
 			return
 		}
 
-		id, err := engine.QueueRun(request, sources)
+		id, err := engine.QueueRun(r.Context(), request, sources)
 		if err != nil {
 			tgw.WriteError(fmt.Sprintf("engine run error: %s", err))
 			return
@@ -0,0 +1,203 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/engine"
+)
+
+// The /runs/store endpoints serve the key/value stores of ongoing runs to
+// test instances, as well as to clients. Like the /worker endpoints, they
+// speak plain JSON, except for the objects of runs, which are raw bytes.
+
+// runObjectPath matches the paths of the objects of runs.
+var runObjectPath = regexp.MustCompile(`^/runs/[^/]+/objects/[^/]+$`)
+
+func (d *Daemon) runStoreHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := r.URL.Query().Get("run_id")
+		if ok, _ := authorizeRunStore(e, tokens, r, runID); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		values, err := e.RunValues(runID)
+		if err != nil {
+			runStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(values)
+	}
+}
+
+func (d *Daemon) setRunValueHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := r.URL.Query().Get("run_id")
+		if _, write := authorizeRunStore(e, tokens, r, runID); !write {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req api.SetRunValueRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := e.SetRunValue(runID, req.Key, req.Value); err != nil {
+			runStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}\n"))
+	}
+}
+
+// abortRunHandler tears down a run on behalf of one of its instances. Any
+// instance of the run can abort it.
+func (d *Daemon) abortRunHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := r.URL.Query().Get("run_id")
+		if ok, _ := authorizeRunStore(e, tokens, r, runID); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req api.AbortRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := e.AbortRun(runID, &req); err != nil {
+			runStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}\n"))
+	}
+}
+
+// claimRoleHandler hands one of the roles of a run to one of its instances.
+func (d *Daemon) claimRoleHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runID := r.URL.Query().Get("run_id")
+		if ok, _ := authorizeRunStore(e, tokens, r, runID); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req api.ClaimRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := e.ClaimRole(runID, &req)
+		if err != nil {
+			runStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// putRunObjectHandler stores an object in the object store of a run. Any
+// instance of the run can put objects.
+func (d *Daemon) putRunObjectHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		runID := vars["run_id"]
+		if ok, _ := authorizeRunStore(e, tokens, r, runID); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		// objects over the quota are rejected without reading them whole; the
+		// extra byte tells them apart from those exactly at the quota.
+		body := http.MaxBytesReader(w, r.Body, e.EnvConfig().Daemon.RunObjectsQuota()+1)
+		if err := e.PutRunObject(runID, vars["key"], body); err != nil {
+			runStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}\n"))
+	}
+}
+
+// runObjectHandler serves an object of the object store of a run.
+func (d *Daemon) runObjectHandler(e api.Engine, tokens map[string]struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		runID := vars["run_id"]
+		if ok, _ := authorizeRunStore(e, tokens, r, runID); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		f, err := e.OpenRunObject(runID, vars["key"])
+		switch {
+		case os.IsNotExist(err):
+			http.Error(w, "unknown object", http.StatusNotFound)
+			return
+		case err != nil:
+			runStoreError(w, err)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	}
+}
+
+// authorizeRunStore returns whether a request can access the store of a run,
+// and write to it. Instances are limited by the token of their run; clients
+// of the daemon have full access.
+func authorizeRunStore(e api.Engine, tokens map[string]struct{}, r *http.Request, runID string) (ok, write bool) {
+	var token string
+	if split := strings.Split(r.Header.Get("Authorization"), "Bearer "); len(split) == 2 {
+		token = strings.TrimSpace(split[1])
+	}
+
+	if ok, write := e.RunStoreAccess(runID, token); ok {
+		return ok, write
+	}
+	if _, ok := tokens[token]; ok || len(tokens) == 0 {
+		return true, true
+	}
+	return false, false
+}
+
+func runStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, engine.ErrRunNotInProgress) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, engine.ErrRunObjectsQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) scaleRunHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.S().With("req_id", r.Header.Get("X-Request-ID"))
+
+		log.Debugw("handle request", "command", "scale")
+		defer log.Debugw("request handled", "command", "scale")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.ScaleRunRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("scale json decode", "err", err.Error())
+			return
+		}
+
+		err = engine.DoScaleRun(r.Context(), &req, tgw)
+		if err != nil {
+			tgw.WriteError("scale error", "err", err.Error())
+			return
+		}
+
+		tgw.WriteResult("Done")
+	}
+}
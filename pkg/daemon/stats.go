@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// defaultStatsSpan is the span of time statistics cover when the dashboard
+// endpoint isn't given a start.
+const defaultStatsSpan = 30 * 24 * time.Hour
+
+func (d *Daemon) statsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.StatsRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			tgw.WriteError("stats json decode", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		stats, err := engine.Stats(&req)
+		if err != nil {
+			tgw.WriteError("could not compute stats", "err", err)
+			return
+		}
+
+		tgw.WriteResult(stats)
+	}
+}
+
+// getStatsHandler serves the statistics of runs as plain JSON, for dashboards.
+// It takes the plan, case, since (RFC 3339), window (duration) and metric
+// (repeatable) query parameters; statistics cover the last 30 days by default.
+func (d *Daemon) getStatsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		req := api.StatsRequest{
+			TestPlan: q.Get("plan"),
+			TestCase: q.Get("case"),
+			Since:    time.Now().Add(-defaultStatsSpan),
+			Metrics:  q["metric"],
+		}
+		if v := q.Get("since"); v != "" {
+			since, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Since = since
+		}
+		if v := q.Get("window"); v != "" {
+			window, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, "invalid window: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Window = window
+		}
+
+		stats, err := engine.Stats(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	}
+}
@@ -26,6 +26,11 @@ func (d *Daemon) statusHandler(engine api.Engine) func(w http.ResponseWriter, r
 			return
 		}
 
+		// a missing estimate doesn't fail the request.
+		if tsk.Estimate, err = engine.EstimateTask(tsk); err != nil {
+			tgw.Warnw("could not estimate task progress", "task_id", req.TaskID, "err", err)
+		}
+
 		tgw.WriteResult(tsk)
 	}
 }
@@ -74,7 +74,7 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 
 		var allocatableCPUs, allocatableMemory int64
 		if rr.Enabled() {
-			allocatableCPUs, allocatableMemory, _ = rr.GetClusterCapacity()
+			allocatableCPUs, allocatableMemory, _ = rr.GetClusterCapacity(r.Context())
 		}
 
 		tdata := struct {
@@ -137,6 +137,9 @@ func (d *Daemon) listTasksHandler(engine api.Engine) func(w http.ResponseWriter,
 				currentTask.Status = EmojiCanceled
 			case task.StateProcessing:
 				currentTask.Status = EmojiInProgress
+				if p := t.Phase(); p != nil {
+					currentTask.Status += " " + string(p.Phase)
+				}
 				currentTask.Actions = fmt.Sprintf(`<a href=/kill?task_id=%s>kill</a><br/><a onclick="return confirm('Are you sure?');" href=/delete?task_id=%s>delete</a>`, t.ID, t.ID)
 				currentTask.Took = ""
 			case task.StateScheduled:
@@ -0,0 +1,22 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// timeHandler serves the time of the daemon, for instances to measure the
+// offset of their clock against it.
+func (d *Daemon) timeHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := api.TimeResponse{Received: time.Now()}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		res.Sent = time.Now()
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func (d *Daemon) triggerHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruid := r.Header.Get("X-Request-ID")
+		log := logging.S().With("req_id", ruid)
+
+		log.Infow("handle request", "command", "trigger")
+		defer log.Infow("request handled", "command", "trigger")
+
+		tgw := rpc.NewOutputWriter(w, r)
+
+		var req api.TriggerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			tgw.WriteError("trigger json decode", "err", err.Error())
+			return
+		}
+
+		// Create a checkout directory under the workdir.
+		dir := filepath.Join(engine.EnvConfig().Dirs().Work(), "requests", ruid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tgw.WriteError("failed to create temp directory to check out request", "err", err)
+			return
+		}
+		// queued tasks get a copy of the sources in their own workspace.
+		defer os.RemoveAll(dir)
+
+		tgw.Infow("checking out test plan", "repo", req.Repo, "ref", req.Ref, "plan", req.Plan)
+
+		id, err := engine.QueueTrigger(r.Context(), &req, dir)
+		if err != nil {
+			tgw.WriteError(fmt.Sprintf("engine trigger error: %s", err))
+			return
+		}
+
+		tgw.WriteResult(id)
+	}
+}
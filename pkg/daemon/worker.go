@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// The /worker endpoints are used by the workers of remote daemons to pull
+// tasks from our queue. They speak plain JSON, rather than the chunked
+// protocol used with clients.
+
+func (d *Daemon) workerClaimHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tsk, lease, err := engine.ClaimTask()
+		if err != nil {
+			logging.S().Errorw("could not claim task for remote worker", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if tsk == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(api.WorkerLeaseHeader, lease)
+		_ = json.NewEncoder(w).Encode(tsk)
+	}
+}
+
+func (d *Daemon) workerSourcesHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskId := r.URL.Query().Get("task_id")
+
+		w.Header().Set("Content-Type", "application/gzip")
+		if err := engine.TaskSources(taskId, w); err != nil {
+			logging.S().Errorw("could not send task sources to remote worker", "task_id", taskId, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func (d *Daemon) workerUpdateHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tsk task.Task
+		if err := json.NewDecoder(r.Body).Decode(&tsk); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		killed, err := engine.ReportTask(r.URL.Query().Get("event"), r.Header.Get(api.WorkerLeaseHeader), &tsk)
+		if err != nil {
+			logging.S().Errorw("could not record task reported by remote worker", "task_id", tsk.ID, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.WorkerUpdateResponse{Killed: killed})
+	}
+}
+
+func (d *Daemon) workerLogsHandler(engine api.Engine) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskId := r.URL.Query().Get("task_id")
+
+		if err := engine.AppendTaskLog(taskId, r.Header.Get(api.WorkerLeaseHeader), r.Body); err != nil {
+			logging.S().Errorw("could not append task log from remote worker", "task_id", taskId, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
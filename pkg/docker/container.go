@@ -21,6 +21,9 @@ const (
 	ImageStrategyNone ImageStrategy = iota
 	ImageStrategyPull
 	ImageStrategyBuild
+	// ImageStrategyLocal uses an image present locally as it is, without
+	// looking it up by tag, e.g. an image referenced by its ID.
+	ImageStrategyLocal
 )
 
 type EnsureContainerOpts struct {
@@ -0,0 +1,332 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/metrics"
+	"github.com/testground/testground/pkg/task"
+)
+
+// analyticsSchema is the schema of the tables completed runs are exported to,
+// created on first use. Both tables are ordered by test case and time, which
+// is how longitudinal analyses slice them.
+//
+// runs has a row per completed run task:
+//
+//   - run_id, plan, case, runner: identify the run.
+//   - user, repo, branch, commit: who created the run; the repo, branch and
+//     commit are only set for runs created by CI.
+//   - created, started, finished: when the run was queued, when it started
+//     processing (last), and when it completed.
+//   - duration_seconds: the time the run spent processing, builds included.
+//   - state, outcome, error: how the run ended, see task.State and
+//     task.Outcome.
+//   - instances, instances_ok, crashes: the number of instances of the run,
+//     of those that reported success, and of those that crashed or were
+//     killed.
+//
+// run_metrics has a row per measurement recorded by each group of a run, on
+// the results stream, aggregated over the run:
+//
+//   - run_id, plan, case, finished: the run the metrics were recorded by.
+//   - measurement, group_id: the InfluxDB measurement, and the group.
+//   - count, mean, min, max, p95: the aggregates of the values.
+const analyticsSchema = `
+CREATE TABLE IF NOT EXISTS %[1]s.runs (
+	run_id String,
+	plan String,
+	case String,
+	runner String,
+	user String,
+	repo String,
+	branch String,
+	commit String,
+	created DateTime64(3, 'UTC'),
+	started DateTime64(3, 'UTC'),
+	finished DateTime64(3, 'UTC'),
+	duration_seconds Float64,
+	state LowCardinality(String),
+	outcome LowCardinality(String),
+	error String,
+	instances UInt32,
+	instances_ok UInt32,
+	crashes UInt32
+) ENGINE = ReplacingMergeTree
+ORDER BY (plan, case, finished, run_id);
+
+CREATE TABLE IF NOT EXISTS %[1]s.run_metrics (
+	run_id String,
+	plan String,
+	case String,
+	finished DateTime64(3, 'UTC'),
+	measurement String,
+	group_id String,
+	count UInt64,
+	mean Float64,
+	min Float64,
+	max Float64,
+	p95 Float64
+) ENGINE = ReplacingMergeTree
+ORDER BY (plan, case, measurement, finished, run_id, group_id);
+`
+
+// analyticsRun is a row of the runs table, see analyticsSchema.
+type analyticsRun struct {
+	RunID           string  `json:"run_id"`
+	Plan            string  `json:"plan"`
+	Case            string  `json:"case"`
+	Runner          string  `json:"runner"`
+	User            string  `json:"user"`
+	Repo            string  `json:"repo"`
+	Branch          string  `json:"branch"`
+	Commit          string  `json:"commit"`
+	Created         string  `json:"created"`
+	Started         string  `json:"started"`
+	Finished        string  `json:"finished"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	State           string  `json:"state"`
+	Outcome         string  `json:"outcome"`
+	Error           string  `json:"error"`
+	Instances       int     `json:"instances"`
+	InstancesOk     int     `json:"instances_ok"`
+	Crashes         int     `json:"crashes"`
+}
+
+// analyticsMetric is a row of the run_metrics table, see analyticsSchema.
+type analyticsMetric struct {
+	RunID       string  `json:"run_id"`
+	Plan        string  `json:"plan"`
+	Case        string  `json:"case"`
+	Finished    string  `json:"finished"`
+	Measurement string  `json:"measurement"`
+	GroupID     string  `json:"group_id"`
+	Count       int64   `json:"count"`
+	Mean        float64 `json:"mean"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	P95         float64 `json:"p95"`
+}
+
+// runAggregator aggregates the metrics recorded by runs, see metrics.Viewer.
+type runAggregator interface {
+	RunAggregates(stream metrics.Stream, name string, runID string) ([]metrics.Aggregate, error)
+}
+
+// analyticsExporter exports completed runs to ClickHouse.
+type analyticsExporter struct {
+	cfg     config.AnalyticsConfig
+	client  *http.Client
+	metrics runAggregator
+
+	// schemaLk guards the creation of the tables, retried until it succeeds.
+	schemaLk sync.Mutex
+	schemaOk bool
+}
+
+// newAnalyticsExporter returns an exporter for the supplied configuration, or
+// nil if the export is disabled.
+func newAnalyticsExporter(cfg *config.EnvConfig) (*analyticsExporter, error) {
+	acfg := cfg.Daemon.Analytics
+	if acfg.ClickHouseURL == "" {
+		return nil, nil
+	}
+	if _, err := url.Parse(acfg.ClickHouseURL); err != nil {
+		return nil, fmt.Errorf("analytics: invalid clickhouse_url: %w", err)
+	}
+	if acfg.Database == "" {
+		acfg.Database = "testground"
+	}
+
+	x := &analyticsExporter{
+		cfg:    acfg,
+		client: &http.Client{Timeout: time.Minute},
+	}
+	if !acfg.DisableMetrics {
+		mv, err := metrics.NewViewer(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("analytics: %w", err)
+		}
+		x.metrics = mv
+	}
+	return x, nil
+}
+
+// exportRun exports a completed run task in the background. Failures are
+// logged.
+func (e *Engine) exportRun(tsk *task.Task) {
+	if e.analytics == nil || tsk.Type != task.TypeRun {
+		return
+	}
+
+	run := newAnalyticsRun(tsk)
+	go func() {
+		if err := e.analytics.export(run); err != nil {
+			logging.S().Warnw("could not export run to analytics", "run_id", run.RunID, "err", err)
+		}
+	}()
+}
+
+// newAnalyticsRun snapshots a completed run task into a row of the runs
+// table.
+func newAnalyticsRun(tsk *task.Task) *analyticsRun {
+	const tf = "2006-01-02 15:04:05.000"
+
+	run := &analyticsRun{
+		RunID:    tsk.ID,
+		Plan:     tsk.Plan,
+		Case:     tsk.Case,
+		Runner:   tsk.Runner,
+		User:     tsk.CreatedBy.User,
+		Repo:     tsk.CreatedBy.Repo,
+		Branch:   tsk.CreatedBy.Branch,
+		Commit:   tsk.CreatedBy.Commit,
+		Created:  tsk.Created().UTC().Format(tf),
+		Started:  tsk.Created().UTC().Format(tf),
+		Finished: tsk.State().Created.UTC().Format(tf),
+		State:    string(tsk.State().State),
+		Outcome:  string(taskOutcome(tsk)),
+		Error:    tsk.Error,
+	}
+	if d, ok := processingTime(tsk); ok {
+		run.Started = tsk.State().Created.Add(-d).UTC().Format(tf)
+		run.DurationSeconds = d.Seconds()
+	}
+	if tsk.Result != nil {
+		res := data.DecodeRunnerResult(tsk.Result)
+		for _, g := range res.Outcomes {
+			if g != nil {
+				run.Instances += g.Total
+				run.InstancesOk += g.Ok
+			}
+		}
+		run.Crashes = len(res.Crashes)
+	}
+	return run
+}
+
+// export inserts a run, and the aggregates of its metrics, into ClickHouse.
+func (x *analyticsExporter) export(run *analyticsRun) error {
+	if err := x.ensureSchema(); err != nil {
+		return err
+	}
+
+	if err := x.insert("runs", run); err != nil {
+		return err
+	}
+
+	if x.metrics == nil {
+		return nil
+	}
+
+	name := clean(run.Plan) + "-" + run.Case
+	aggs, err := x.metrics.RunAggregates(metrics.StreamResults, name, run.RunID)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate metrics: %w", err)
+	}
+	if len(aggs) == 0 {
+		return nil
+	}
+
+	rows := make([]interface{}, 0, len(aggs))
+	for _, a := range aggs {
+		rows = append(rows, &analyticsMetric{
+			RunID:       run.RunID,
+			Plan:        run.Plan,
+			Case:        run.Case,
+			Finished:    run.Finished,
+			Measurement: a.Measurement,
+			GroupID:     a.GroupID,
+			Count:       a.Count,
+			Mean:        a.Mean,
+			Min:         a.Min,
+			Max:         a.Max,
+			P95:         a.P95,
+		})
+	}
+	return x.insert("run_metrics", rows...)
+}
+
+// ensureSchema creates the database and the tables, unless already done.
+func (x *analyticsExporter) ensureSchema() error {
+	x.schemaLk.Lock()
+	defer x.schemaLk.Unlock()
+
+	if x.schemaOk {
+		return nil
+	}
+
+	stmts := []string{fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", x.cfg.Database)}
+	for _, s := range strings.Split(fmt.Sprintf(analyticsSchema, x.cfg.Database), ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	for _, s := range stmts {
+		if err := x.query(s, nil); err != nil {
+			return fmt.Errorf("failed to create analytics schema: %w", err)
+		}
+	}
+
+	x.schemaOk = true
+	return nil
+}
+
+// insert inserts rows into a table, as JSONEachRow.
+func (x *analyticsExporter) insert(table string, rows ...interface{}) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", x.cfg.Database, table)
+	if err := x.query(q, &body); err != nil {
+		return fmt.Errorf("failed to insert into %s: %w", table, err)
+	}
+	return nil
+}
+
+// query runs a statement on the HTTP interface of ClickHouse, with the
+// supplied data, if any.
+func (x *analyticsExporter) query(q string, body io.Reader) error {
+	u, err := url.Parse(x.cfg.ClickHouseURL)
+	if err != nil {
+		return err
+	}
+	params := u.Query()
+	params.Set("query", q)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if x.cfg.User != "" {
+		req.SetBasicAuth(x.cfg.User, x.cfg.Password)
+	}
+
+	res, err := x.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("unexpected status code: %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/metrics"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+type fakeAggregator []metrics.Aggregate
+
+func (f fakeAggregator) RunAggregates(stream metrics.Stream, name string, runID string) ([]metrics.Aggregate, error) {
+	if stream != metrics.StreamResults || name != "network-ping-pong" {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func TestAnalyticsExport(t *testing.T) {
+	var (
+		lk      sync.Mutex
+		queries []string
+		rows    = make(map[string][]map[string]interface{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "tg" || p != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query().Get("query")
+
+		lk.Lock()
+		defer lk.Unlock()
+		queries = append(queries, q)
+		if !strings.HasPrefix(q, "INSERT INTO ") {
+			return
+		}
+		table := strings.Fields(q)[2]
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var row map[string]interface{}
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &row))
+			rows[table] = append(rows[table], row)
+		}
+	}))
+	defer srv.Close()
+
+	x, err := newAnalyticsExporter(&config.EnvConfig{Daemon: config.DaemonConfig{Analytics: config.AnalyticsConfig{
+		ClickHouseURL:  srv.URL,
+		User:           "tg",
+		Password:       "secret",
+		DisableMetrics: true,
+	}}})
+	require.NoError(t, err)
+	x.metrics = fakeAggregator{
+		{Measurement: "results.network-ping-pong.rtt", GroupID: "peers", Count: 10, Mean: 2, Min: 1, Max: 4, P95: 3.5},
+	}
+
+	done := time.Now()
+	tsk := &task.Task{
+		ID:     "run1",
+		Type:   task.TypeRun,
+		Plan:   "network",
+		Case:   "ping-pong",
+		Runner: "local:docker",
+		States: []task.DatedState{
+			{State: task.StateScheduled, Created: done.Add(-time.Hour)},
+			{State: task.StateProcessing, Created: done.Add(-time.Minute)},
+			{State: task.StateComplete, Created: done},
+		},
+		Result: &runner.Result{
+			Outcome:  task.OutcomeFailure,
+			Outcomes: map[string]*runner.GroupOutcome{"peers": {Ok: 9, Total: 10}},
+			Crashes:  []runner.InstanceCrash{{}},
+		},
+	}
+	tsk.CreatedBy.Repo = "org/repo"
+
+	require.NoError(t, x.export(newAnalyticsRun(tsk)))
+	// the schema is only created once.
+	require.NoError(t, x.export(newAnalyticsRun(tsk)))
+
+	lk.Lock()
+	defer lk.Unlock()
+
+	require.Len(t, queries, 7)
+	require.Equal(t, "CREATE DATABASE IF NOT EXISTS testground", queries[0])
+	require.True(t, strings.HasPrefix(queries[1], "CREATE TABLE IF NOT EXISTS testground.runs"))
+	require.True(t, strings.HasPrefix(queries[2], "CREATE TABLE IF NOT EXISTS testground.run_metrics"))
+
+	runs := rows["testground.runs"]
+	require.Len(t, runs, 2)
+	require.Equal(t, "run1", runs[0]["run_id"])
+	require.Equal(t, "org/repo", runs[0]["repo"])
+	require.Equal(t, "failure", runs[0]["outcome"])
+	require.Equal(t, 60.0, runs[0]["duration_seconds"])
+	require.Equal(t, 10.0, runs[0]["instances"])
+	require.Equal(t, 9.0, runs[0]["instances_ok"])
+	require.Equal(t, 1.0, runs[0]["crashes"])
+
+	ms := rows["testground.run_metrics"]
+	require.Len(t, ms, 2)
+	require.Equal(t, "results.network-ping-pong.rtt", ms[0]["measurement"])
+	require.Equal(t, "peers", ms[0]["group_id"])
+	require.Equal(t, 3.5, ms[0]["p95"])
+}
+
+func TestAnalyticsDisabled(t *testing.T) {
+	x, err := newAnalyticsExporter(&config.EnvConfig{})
+	require.NoError(t, err)
+	require.Nil(t, x)
+}
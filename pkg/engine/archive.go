@@ -0,0 +1,382 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/aws"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+// archiveSweepInterval is how often the outputs of completed runs are moved
+// down the tiers of their archive policies.
+const archiveSweepInterval = time.Hour
+
+// The tiers of archived outputs, see config.ArchiveConfig.
+const (
+	archiveWarm = "warm"
+	archiveCold = "cold"
+)
+
+// archiveStore stores the archives of the outputs of runs.
+type archiveStore interface {
+	Upload(key string, r io.Reader) error
+	Download(key string, w io.WriterAt) error
+	// Freeze moves an archive to cold storage.
+	Freeze(key string) error
+	// Thaw requests the restore of a cold archive, and returns whether it
+	// can be downloaded yet.
+	Thaw(key string) (bool, error)
+	Delete(key string) error
+}
+
+// s3Archive stores archives in S3, moving cold ones to an archival storage
+// class.
+type s3Archive struct {
+	aws config.AWSConfig
+	cfg config.ArchiveConfig
+}
+
+func (s *s3Archive) Upload(key string, r io.Reader) error {
+	return aws.S3.Upload(s.aws, s.cfg.Bucket, key, r)
+}
+
+func (s *s3Archive) Download(key string, w io.WriterAt) error {
+	return aws.S3.Download(s.aws, s.cfg.Bucket, key, w)
+}
+
+func (s *s3Archive) Freeze(key string) error {
+	class := s.cfg.ColdStorageClass
+	if class == "" {
+		class = "GLACIER"
+	}
+	return aws.S3.Transition(s.aws, s.cfg.Bucket, key, class)
+}
+
+func (s *s3Archive) Thaw(key string) (bool, error) {
+	days := s.cfg.RestoreDays
+	if days <= 0 {
+		days = 7
+	}
+	return aws.S3.Restore(s.aws, s.cfg.Bucket, key, days)
+}
+
+func (s *s3Archive) Delete(key string) error {
+	return aws.S3.Delete(s.aws, s.cfg.Bucket, key)
+}
+
+// archiveRecord tracks the archive of the outputs of a run.
+type archiveRecord struct {
+	Key      string    `json:"key"`
+	Tier     string    `json:"tier"`
+	Archived time.Time `json:"archived"`
+	Frozen   time.Time `json:"frozen"`
+	// Restored is when the outputs were last restored to disk; zero if they
+	// are not on disk.
+	Restored time.Time `json:"restored"`
+}
+
+// archiveRecordPath returns the path of the archive record of a run, kept
+// next to its record.
+func (e *Engine) archiveRecordPath(runID string) string {
+	return filepath.Join(e.envcfg.Dirs().Daemon(), "runs", runID+".archive.json")
+}
+
+// readArchiveRecord returns the archive record of a run, or nil if its
+// outputs were never archived.
+func (e *Engine) readArchiveRecord(runID string) (*archiveRecord, error) {
+	b, err := os.ReadFile(e.archiveRecordPath(runID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec archiveRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode archive record of run %s: %w", runID, err)
+	}
+	return &rec, nil
+}
+
+func (e *Engine) writeArchiveRecord(runID string, rec *archiveRecord) error {
+	p := e.archiveRecordPath(runID)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0644)
+}
+
+// archiveLock serializes the moves of the outputs of a run between archive
+// tiers.
+type archiveLock struct {
+	sync.Mutex
+	// refs counts the holders and waiters of the lock.
+	refs int
+}
+
+// lockArchive locks the archive of the outputs of a run, and returns the
+// function unlocking it. Only the moves of the same run wait on each other.
+func (e *Engine) lockArchive(runID string) (unlock func()) {
+	e.archiveLk.Lock()
+	if e.archiveLocks == nil {
+		e.archiveLocks = make(map[string]*archiveLock)
+	}
+	l, ok := e.archiveLocks[runID]
+	if !ok {
+		l = &archiveLock{}
+		e.archiveLocks[runID] = l
+	}
+	l.refs++
+	e.archiveLk.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		e.archiveLk.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(e.archiveLocks, runID)
+		}
+		e.archiveLk.Unlock()
+	}
+}
+
+// runOutputsDir returns the directory holding the outputs of a run, if its
+// runner keeps them on the disk of the daemon.
+func (e *Engine) runOutputsDir(tsk *task.Task) (string, bool) {
+	loc, ok := e.runners[tsk.Runner].(api.OutputsLocator)
+	if !ok {
+		return "", false
+	}
+	return loc.RunOutputsDir(e.envcfg, clean(tsk.Plan), tsk.ID), true
+}
+
+// archiveLoop sweeps the outputs of completed runs periodically, until the
+// engine is closed.
+func (e *Engine) archiveLoop() {
+	ticker := time.NewTicker(archiveSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		e.sweepArchives(time.Now())
+
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepArchives moves the outputs of completed runs down the tiers of their
+// archive policies. Failures are logged, and retried on the next sweep.
+func (e *Engine) sweepArchives(now time.Time) {
+	tsks, err := e.store.Filter(task.StateComplete, time.Unix(0, 0), now)
+	if err != nil {
+		logging.S().Warnw("could not list completed tasks to archive", "err", err)
+		return
+	}
+	for _, tsk := range tsks {
+		if tsk.Type != task.TypeRun {
+			continue
+		}
+		if err := e.sweepRun(tsk, now); err != nil {
+			logging.S().Warnw("could not archive run outputs", "run_id", tsk.ID, "err", err)
+		}
+	}
+}
+
+// sweepRun moves the outputs of a completed run to the tier its age calls
+// for: they are archived once older than the hot days of the policy of its
+// plan, and frozen once archived for longer than the warm days. Outputs
+// restored from an archive are dropped from disk again after the hot days.
+func (e *Engine) sweepRun(tsk *task.Task, now time.Time) error {
+	dir, ok := e.runOutputsDir(tsk)
+	if !ok {
+		return nil
+	}
+
+	var (
+		policy = e.envcfg.Daemon.Archive.Policy(tsk.Plan)
+		hot    = time.Duration(policy.HotDays) * 24 * time.Hour
+		warm   = time.Duration(policy.WarmDays) * 24 * time.Hour
+	)
+
+	defer e.lockArchive(tsk.ID)()
+
+	rec, err := e.readArchiveRecord(tsk.ID)
+	if err != nil {
+		return err
+	}
+
+	onDisk := true
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		onDisk = false
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case rec == nil && (!onDisk || now.Sub(tsk.State().Created) < hot):
+		return nil
+	case rec == nil:
+		if rec, err = e.archiveOutputs(tsk, dir, now); err != nil {
+			return err
+		}
+		logging.S().Infow("archived run outputs", "run_id", tsk.ID, "key", rec.Key)
+	case onDisk && (rec.Restored.IsZero() || now.Sub(rec.Restored) >= hot):
+		// a restored copy expired, or the archiving was interrupted before
+		// the outputs were removed.
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		rec.Restored = time.Time{}
+		if err := e.writeArchiveRecord(tsk.ID, rec); err != nil {
+			return err
+		}
+	}
+
+	if rec.Tier != archiveWarm || warm == 0 || now.Sub(rec.Archived) < warm {
+		return nil
+	}
+	if err := e.archive.Freeze(rec.Key); err != nil {
+		return fmt.Errorf("failed to move archive to cold storage: %w", err)
+	}
+	rec.Tier, rec.Frozen = archiveCold, now
+	logging.S().Infow("moved run outputs to cold storage", "run_id", tsk.ID, "key", rec.Key)
+	return e.writeArchiveRecord(tsk.ID, rec)
+}
+
+// archiveOutputs uploads the outputs of a run, records the archive, and
+// removes the outputs from disk.
+func (e *Engine) archiveOutputs(tsk *task.Task, dir string, now time.Time) (*archiveRecord, error) {
+	f, err := os.CreateTemp("", "testground-archive-*.tgz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := archiveDir(dir, f); err != nil {
+		return nil, fmt.Errorf("failed to archive outputs: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	rec := &archiveRecord{
+		Key:      path.Join(e.envcfg.Daemon.Archive.Prefix, clean(tsk.Plan), tsk.ID+".tgz"),
+		Tier:     archiveWarm,
+		Archived: now,
+	}
+	if err := e.archive.Upload(rec.Key, f); err != nil {
+		return nil, fmt.Errorf("failed to upload archive: %w", err)
+	}
+	if err := e.writeArchiveRecord(tsk.ID, rec); err != nil {
+		return nil, err
+	}
+	return rec, os.RemoveAll(dir)
+}
+
+// restoreOutputs brings the archived outputs of a run back to disk, so that
+// they can be collected. Cold archives must be restored in S3 first, which
+// takes hours; until then, an error asks to retry later.
+func (e *Engine) restoreOutputs(tsk *task.Task, ow *rpc.OutputWriter) error {
+	if e.archive == nil {
+		return nil
+	}
+	dir, ok := e.runOutputsDir(tsk)
+	if !ok {
+		return nil
+	}
+
+	// most runs were never archived, or are on disk already.
+	rec, err := e.readArchiveRecord(tsk.ID)
+	if err != nil || rec == nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	defer e.lockArchive(tsk.ID)()
+
+	// the outputs may have been restored, or archived, while we waited.
+	if rec, err = e.readArchiveRecord(tsk.ID); err != nil || rec == nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	if rec.Tier == archiveCold {
+		ready, err := e.archive.Thaw(rec.Key)
+		if err != nil {
+			return fmt.Errorf("failed to restore outputs from cold storage: %w", err)
+		}
+		if !ready {
+			return fmt.Errorf("the outputs of run %s are in cold storage; their restore was requested, retry in a few hours", tsk.ID)
+		}
+	}
+
+	ow.Infow("restoring archived outputs", "run_id", tsk.ID, "tier", rec.Tier)
+
+	f, err := os.CreateTemp("", "testground-archive-*.tgz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := e.archive.Download(rec.Key, f); err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := extractDir(f, dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	rec.Restored = time.Now()
+	return e.writeArchiveRecord(tsk.ID, rec)
+}
+
+// deleteArchive deletes the archive of the outputs of a run, and its record,
+// if the outputs were archived.
+func (e *Engine) deleteArchive(runID string) error {
+	rec, err := e.readArchiveRecord(runID)
+	if err != nil || rec == nil {
+		return err
+	}
+
+	defer e.lockArchive(runID)()
+
+	if e.archive == nil {
+		logging.S().Warnw("archive is not configured; leaving the archive of deleted run behind", "run_id", runID, "key", rec.Key)
+	} else if err := e.archive.Delete(rec.Key); err != nil {
+		return fmt.Errorf("failed to delete the archive of run %s: %w", runID, err)
+	}
+	if err := os.Remove(e.archiveRecordPath(runID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// memArchive is an archiveStore in memory, whose cold archives are restored
+// once thawed is set.
+type memArchive struct {
+	objects map[string][]byte
+	frozen  map[string]bool
+	thawed  bool
+}
+
+func (m *memArchive) Upload(key string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	m.objects[key] = b
+	return err
+}
+
+func (m *memArchive) Download(key string, w io.WriterAt) error {
+	_, err := w.WriteAt(m.objects[key], 0)
+	return err
+}
+
+func (m *memArchive) Freeze(key string) error {
+	m.frozen[key] = true
+	return nil
+}
+
+func (m *memArchive) Thaw(key string) (bool, error) {
+	return m.thawed, nil
+}
+
+func (m *memArchive) Delete(key string) error {
+	delete(m.objects, key)
+	delete(m.frozen, key)
+	return nil
+}
+
+func TestArchiveTiers(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	cfg := &config.EnvConfig{}
+	require.NoError(t, cfg.Load())
+	cfg.Daemon.Archive = config.ArchiveConfig{
+		Bucket:        "archives",
+		Prefix:        "outputs",
+		ArchivePolicy: config.ArchivePolicy{HotDays: 30},
+		Plans:         map[string]config.ArchivePolicy{"network": {WarmDays: 90}},
+	}
+
+	store := &memArchive{objects: make(map[string][]byte), frozen: make(map[string]bool)}
+	e := &Engine{
+		envcfg:  cfg,
+		runners: map[string]api.Runner{"local:exec": &runner.LocalExecutableRunner{}},
+		archive: store,
+	}
+
+	completed := time.Now().Add(-40 * 24 * time.Hour)
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		Runner: "local:exec",
+		Plan:   "network",
+		States: []task.DatedState{{State: task.StateComplete, Created: completed}},
+	}
+
+	dir, ok := e.runOutputsDir(tsk)
+	require.True(t, ok)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "single", "0"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "single", "0", "run.out"), []byte("hello"), 0644))
+
+	// outputs stay on disk for the hot days.
+	require.NoError(t, e.sweepRun(tsk, completed.Add(29*24*time.Hour)))
+	require.Empty(t, store.objects)
+	require.DirExists(t, dir)
+
+	// then they are archived, and removed from disk.
+	now := completed.Add(31 * 24 * time.Hour)
+	require.NoError(t, e.sweepRun(tsk, now))
+	require.Contains(t, store.objects, "outputs/network/"+tsk.ID+".tgz")
+	require.NoDirExists(t, dir)
+
+	rec, err := e.readArchiveRecord(tsk.ID)
+	require.NoError(t, err)
+	require.Equal(t, archiveWarm, rec.Tier)
+
+	// the plan keeps archives warm for 90 days.
+	require.NoError(t, e.sweepRun(tsk, now.Add(89*24*time.Hour)))
+	require.Empty(t, store.frozen)
+	require.NoError(t, e.sweepRun(tsk, now.Add(91*24*time.Hour)))
+	require.True(t, store.frozen[rec.Key])
+
+	// collecting the outputs of a cold run waits for its restore.
+	ow := rpc.Discard()
+	err = e.restoreOutputs(tsk, ow)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cold storage")
+	require.NoDirExists(t, dir)
+
+	store.thawed = true
+	require.NoError(t, e.restoreOutputs(tsk, ow))
+	b, err := os.ReadFile(filepath.Join(dir, "single", "0", "run.out"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+
+	// the restored copy is dropped again after the hot days.
+	rec, err = e.readArchiveRecord(tsk.ID)
+	require.NoError(t, err)
+	require.NoError(t, e.sweepRun(tsk, rec.Restored.Add(24*time.Hour)))
+	require.DirExists(t, dir)
+	require.NoError(t, e.sweepRun(tsk, rec.Restored.Add(31*24*time.Hour)))
+	require.NoDirExists(t, dir)
+
+	// deleting the run deletes its archive, and the record of it.
+	require.NoError(t, e.deleteArchive(tsk.ID))
+	require.Empty(t, store.objects)
+	require.NoFileExists(t, e.archiveRecordPath(tsk.ID))
+	rec, err = e.readArchiveRecord(tsk.ID)
+	require.NoError(t, err)
+	require.Nil(t, rec)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+// timeoutFor returns the timeout of a task: the task timeout of the daemon,
+// unless the task is a persistent run.
+func timeoutFor(tsk *task.Task, taskTimeout time.Duration) time.Duration {
+	if in, ok := tsk.Input.(*RunInput); ok && in.RunRequest != nil && in.Composition.Global.Persistent {
+		return time.Duration(math.MaxInt64)
+	}
+	return taskTimeout
+}
+
+// maxPersistentRuns returns how many persistent runs the daemon holds workers
+// for at once: the configured cap, or one less than the number of workers.
+func maxPersistentRuns(cfg config.SchedulerConfig) int {
+	max := cfg.Workers - 1
+	if cfg.MaxPersistentRuns > 0 && cfg.MaxPersistentRuns < max {
+		max = cfg.MaxPersistentRuns
+	}
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// checkPersistent checks that the daemon can take another persistent run,
+// i.e. that it doesn't queue or run as many as it allows already, so that
+// persistent runs can't hold every worker.
+func (e *Engine) checkPersistent() error {
+	max := maxPersistentRuns(e.EnvConfig().Daemon.Scheduler)
+	if max == 0 {
+		return fmt.Errorf("persistent runs need a daemon with at least 2 workers")
+	}
+
+	var n int
+	for _, state := range []task.State{task.StateScheduled, task.StateProcessing} {
+		tsks, err := e.store.Filter(state, time.Unix(0, 0), time.Now().Add(time.Second))
+		if err != nil {
+			return err
+		}
+		for _, tsk := range tsks {
+			if tsk.Type != task.TypeRun {
+				continue
+			}
+			if in, err := taskRunInput(tsk); err == nil && in.Composition.Global.Persistent {
+				n++
+			}
+		}
+	}
+	if n >= max {
+		return fmt.Errorf("the daemon already holds %d persistent runs, its maximum; kill one first", n)
+	}
+	return nil
+}
+
+// checkAttach checks that a run of the given runner can attach to the network
+// of another run.
+func (e *Engine) checkAttach(ctx context.Context, runID, runner string) error {
+	id, run, _, err := e.liveRunner(runID)
+	if err != nil {
+		return fmt.Errorf("cannot attach to run %s: %w", runID, err)
+	}
+	if id != runner {
+		return fmt.Errorf("cannot attach to run %s of runner %s with runner %s", runID, id, runner)
+	}
+	a, ok := run.(api.Attacher)
+	if !ok {
+		return fmt.Errorf("runner %s does not support attaching runs", id)
+	}
+	return a.CheckAttach(ctx, runID)
+}
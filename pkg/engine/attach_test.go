@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestTimeoutFor(t *testing.T) {
+	tsk := &task.Task{Type: task.TypeRun, Input: &RunInput{RunRequest: &api.RunRequest{}}}
+	require.Equal(t, time.Minute, timeoutFor(tsk, time.Minute))
+
+	tsk.Input.(*RunInput).Composition.Global.Persistent = true
+	require.Greater(t, timeoutFor(tsk, time.Minute), 24*365*time.Hour)
+
+	require.Equal(t, time.Minute, timeoutFor(&task.Task{Type: task.TypeBuild, Input: &BuildInput{}}, time.Minute))
+}
+
+func TestCheckPersistent(t *testing.T) {
+	e := newSchedulerEngine(t)
+	e.envcfg.Daemon.Scheduler.Workers = 1
+	require.Error(t, e.checkPersistent())
+
+	e.envcfg.Daemon.Scheduler.Workers = 4
+	e.envcfg.Daemon.Scheduler.MaxPersistentRuns = 2
+	for _, id := range []string{"c60i0d2llu6a7gha3ee0", "c60i0d2llu6a7gha3ef0"} {
+		require.NoError(t, e.checkPersistent())
+
+		in := &RunInput{RunRequest: &api.RunRequest{}}
+		in.Composition.Global.Persistent = true
+		require.NoError(t, e.queue.Push(&task.Task{
+			ID:     id,
+			Type:   task.TypeRun,
+			States: []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+			Input:  in,
+		}))
+	}
+	require.Error(t, e.checkPersistent())
+
+	// the cap can't leave no worker for other tasks.
+	require.Equal(t, 3, maxPersistentRuns(config.SchedulerConfig{Workers: 4, MaxPersistentRuns: 8}))
+}
+
+func TestCheckAttach(t *testing.T) {
+	e := newSchedulerEngine(t)
+	e.runners = map[string]api.Runner{"local:docker": &fakePauser{}}
+
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		Runner: "local:docker",
+		States: []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	// the run isn't in progress.
+	require.Error(t, e.checkAttach(context.Background(), tsk.ID, "local:docker"))
+
+	ctx, cancel := withPausableTimeout(context.Background(), time.Hour)
+	defer cancel()
+	e.addTimeout(tsk.ID, ctx)
+
+	require.Error(t, e.checkAttach(context.Background(), tsk.ID, "local:exec"))
+	// the runner doesn't support attaching runs.
+	require.Error(t, e.checkAttach(context.Background(), tsk.ID, "local:docker"))
+}
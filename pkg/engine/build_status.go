@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// buildStatusReporter records the status of each build performed by a task,
+// persisting the task on every update so that the per-group progress is
+// visible while builds are running. A nil reporter discards all updates.
+type buildStatusReporter struct {
+	lk  sync.Mutex
+	tsk *task.Task
+	src taskSource
+}
+
+func newBuildStatusReporter(tsk *task.Task, src taskSource) *buildStatusReporter {
+	return &buildStatusReporter{tsk: tsk, src: src}
+}
+
+// add registers a pending build for the supplied groups, and returns its
+// index, to be used in subsequent updates.
+func (r *buildStatusReporter) add(groups []string, builder string) int {
+	if r == nil {
+		return -1
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.tsk.Builds = append(r.tsk.Builds, task.GroupBuild{
+		Groups:  groups,
+		Builder: builder,
+		State:   task.BuildStatePending,
+		Updated: time.Now().UTC(),
+	})
+	r.persist()
+	return len(r.tsk.Builds) - 1
+}
+
+// update transitions the build at idx to the supplied state.
+func (r *buildStatusReporter) update(idx int, state task.BuildState, artifact string, err error) {
+	if r == nil || idx < 0 {
+		return
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	b := &r.tsk.Builds[idx]
+	b.State = state
+	b.Artifact = artifact
+	b.Updated = time.Now().UTC()
+	if err != nil {
+		b.Error = err.Error()
+	}
+	r.persist()
+}
+
+func (r *buildStatusReporter) persist() {
+	if err := r.src.Persist(r.tsk); err != nil {
+		logging.S().Warnw("could not persist task build status", "task_id", r.tsk.ID, "err", err)
+	}
+}
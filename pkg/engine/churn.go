@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// churnerFor returns the runner of a run as a Churner if the run has churn
+// schedules, after checking them against its groups; nil if it has none.
+func churnerFor(run api.Runner, schedules []api.Churn, groups map[string]int) (api.Churner, error) {
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+	c, ok := run.(api.Churner)
+	if !ok {
+		return nil, fmt.Errorf("runner %s does not support churn", run.ID())
+	}
+	for _, s := range schedules {
+		if err := s.Validate(groups); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// startChurn executes the churn schedules of a run in the background, until
+// the returned function is called.
+func (e *Engine) startChurn(ctx context.Context, c api.Churner, in *api.RunInput, schedules []api.Churn, ow *rpc.OutputWriter) (stop func()) {
+	if c == nil {
+		return func() {}
+	}
+
+	sizes := &groupSizes{m: make(map[string]int, len(in.Groups))}
+	for _, g := range in.Groups {
+		sizes.m[g.ID] = g.Instances
+	}
+	e.churnSizesLk.Lock()
+	if e.churnSizes == nil {
+		e.churnSizes = make(map[string]*groupSizes)
+	}
+	e.churnSizes[in.RunID] = sizes
+	e.churnSizesLk.Unlock()
+
+	// churn stops while the run is paused, like its task timeout.
+	paused := e.timeout(in.RunID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i, s := range schedules {
+		s := s
+		interval, _ := s.Interval() // validated by churnerFor.
+		// each schedule gets its own source, so that the instances it picks
+		// only depend on the seed of the run.
+		rng := rand.New(rand.NewSource(in.Seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.churnGroup(ctx, c, in, s, interval, sizes, rng, paused, ow)
+		}()
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+
+		e.churnSizesLk.Lock()
+		delete(e.churnSizes, in.RunID)
+		e.churnSizesLk.Unlock()
+	}
+}
+
+// groupSizes are the sizes of the groups of a run, by group ID.
+type groupSizes struct {
+	lk sync.Mutex
+	m  map[string]int
+}
+
+func (g *groupSizes) get(group string) int {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	return g.m[group]
+}
+
+// resizeChurnedGroup records the new size of a group of a run, so that its
+// churn picks instances among all those of the group.
+func (e *Engine) resizeChurnedGroup(runID, group string, n int) {
+	e.churnSizesLk.Lock()
+	sizes, ok := e.churnSizes[runID]
+	e.churnSizesLk.Unlock()
+	if !ok {
+		return
+	}
+
+	sizes.lk.Lock()
+	sizes.m[group] = n
+	sizes.lk.Unlock()
+}
+
+func (e *Engine) churnGroup(ctx context.Context, c api.Churner, in *api.RunInput, s api.Churn, interval time.Duration, sizes *groupSizes, rng *rand.Rand, paused *pausableTimeout, ow *rpc.OutputWriter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// don't churn paused instances; the interval starts over once
+		// they're resumed.
+		if paused != nil && paused.waitResumed(ctx) {
+			ticker.Reset(interval)
+			continue
+		}
+
+		// the group may have been scaled since the last time.
+		n := sizes.get(s.Group)
+		instances := rng.Perm(n)[:s.Size(n)]
+		sort.Ints(instances)
+
+		err := c.ReplaceInstances(ctx, &api.ChurnInput{
+			EnvConfig:    in.EnvConfig,
+			RunID:        in.RunID,
+			RunnerConfig: in.RunnerConfig,
+			Group:        s.Group,
+			Instances:    instances,
+		}, ow)
+		if err != nil {
+			if ctx.Err() == nil {
+				ow.Warnw("failed to churn instances", "run_id", in.RunID, "group", s.Group, "instances", instances, "err", err)
+			}
+			continue
+		}
+
+		ow.Infow("churned instances", "run_id", in.RunID, "group", s.Group, "instances", instances)
+		ev := api.ChurnEvent{Time: time.Now().UTC(), Group: s.Group, Instances: instances}
+		if err := e.publishChurnEvent(in.RunID, ev); err != nil {
+			ow.Warnw("failed to publish churn event", "run_id", in.RunID, "err", err)
+		}
+	}
+}
+
+// publishChurnEvent appends a churn event to the events of a run in its
+// key/value store.
+func (e *Engine) publishChurnEvent(runID string, ev api.ChurnEvent) error {
+	e.runStoresLk.Lock()
+	defer e.runStoresLk.Unlock()
+
+	rs, ok := e.runStores[runID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+
+	var events []api.ChurnEvent
+	if v, ok := rs.values[api.ChurnEventsKey]; ok {
+		if err := json.Unmarshal([]byte(v), &events); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(append(events, ev))
+	if err != nil {
+		return err
+	}
+	rs.values[api.ChurnEventsKey] = string(b)
+	return nil
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+type fakeChurner struct {
+	lk     sync.Mutex
+	inputs []*api.ChurnInput
+}
+
+func (f *fakeChurner) ReplaceInstances(_ context.Context, in *api.ChurnInput, _ *rpc.OutputWriter) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.inputs = append(f.inputs, in)
+	return nil
+}
+
+func TestStartChurn(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}}
+	_, err := e.openRunStore("run1", "", nil)
+	require.NoError(t, err)
+
+	in := &api.RunInput{
+		RunID:  "run1",
+		Groups: []*api.RunGroup{{ID: "peers", Instances: 10}},
+	}
+	schedules := []api.Churn{{Group: "peers", Every: "10ms", Fraction: 0.2}}
+
+	c := &fakeChurner{}
+	stop := e.startChurn(context.Background(), c, in, schedules, rpc.Discard())
+	require.Eventually(t, func() bool {
+		c.lk.Lock()
+		defer c.lk.Unlock()
+		return len(c.inputs) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	for _, in := range c.inputs {
+		require.Equal(t, "peers", in.Group)
+		require.Len(t, in.Instances, 2)
+		require.NotEqual(t, in.Instances[0], in.Instances[1])
+	}
+
+	values, err := e.RunValues("run1")
+	require.NoError(t, err)
+	var events []api.ChurnEvent
+	require.NoError(t, json.Unmarshal([]byte(values[api.ChurnEventsKey]), &events))
+	require.Len(t, events, len(c.inputs))
+	require.Equal(t, c.inputs[0].Instances, events[0].Instances)
+}
+
+func TestChurnScaledGroup(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}}
+	_, err := e.openRunStore("run1", "", nil)
+	require.NoError(t, err)
+
+	in := &api.RunInput{
+		RunID:  "run1",
+		Groups: []*api.RunGroup{{ID: "peers", Instances: 10}},
+	}
+	schedules := []api.Churn{{Group: "peers", Every: "10ms", Fraction: 0.2}}
+
+	c := &fakeChurner{}
+	stop := e.startChurn(context.Background(), c, in, schedules, rpc.Discard())
+	defer stop()
+
+	// churn picks among the instances of the group once it's scaled.
+	e.resizeChurnedGroup("run1", "peers", 20)
+	require.Eventually(t, func() bool {
+		c.lk.Lock()
+		defer c.lk.Unlock()
+		return len(c.inputs) > 0 && len(c.inputs[len(c.inputs)-1].Instances) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestChurnSeed(t *testing.T) {
+	picks := func(seed int64) [][]int {
+		e := &Engine{envcfg: &config.EnvConfig{}}
+		_, err := e.openRunStore("run1", "", nil)
+		require.NoError(t, err)
+
+		in := &api.RunInput{
+			RunID:  "run1",
+			Seed:   seed,
+			Groups: []*api.RunGroup{{ID: "peers", Instances: 100}},
+		}
+		schedules := []api.Churn{{Group: "peers", Every: "10ms", Fraction: 0.1}}
+
+		c := &fakeChurner{}
+		stop := e.startChurn(context.Background(), c, in, schedules, rpc.Discard())
+		require.Eventually(t, func() bool {
+			c.lk.Lock()
+			defer c.lk.Unlock()
+			return len(c.inputs) >= 3
+		}, 5*time.Second, 10*time.Millisecond)
+		stop()
+
+		var res [][]int
+		for _, in := range c.inputs[:3] {
+			res = append(res, in.Instances)
+		}
+		return res
+	}
+
+	// the same seed replays the same picks.
+	require.Equal(t, picks(42), picks(42))
+	require.NotEqual(t, picks(42), picks(43))
+}
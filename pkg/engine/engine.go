@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/docker/docker/client"
 	"github.com/rs/xid"
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/build"
@@ -53,13 +54,67 @@ type Engine struct {
 	// runners binds runners to their identifying key.
 	runners map[string]api.Runner
 	envcfg  *config.EnvConfig
-	ctx     context.Context
+	// ctx is the context of the engine, from which the contexts of tasks
+	// derive; it is canceled on Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// workers tracks the workers of the engine, so that Close waits for
+	// them to clean up the tasks they were processing.
+	workers sync.WaitGroup
 	store   *task.Storage
 	queue   *task.Queue
 	// signals contains a channel for each running task
 	// by closing a channel, the task is canceled
 	signals   map[string]chan int
 	signalsLk sync.RWMutex
+	// leases contains the claims of remote workers, which the workers renew
+	// by reporting to us.
+	leases   map[string]remoteLease
+	leasesLk sync.Mutex
+	// timeouts contains the timeout of each running task, whose clock stops
+	// while its run is paused.
+	timeouts   map[string]*pausableTimeout
+	timeoutsLk sync.Mutex
+	// github reports tasks created by CI to GitHub; nil if not configured.
+	github *githubApp
+	// analytics exports completed runs to ClickHouse; nil if not configured.
+	analytics *analyticsExporter
+	// local is the source of the tasks queued on this daemon.
+	local *localTasks
+	// planSourceLocks serialize the fetches of each plan source into its
+	// cache, see lockPlanSource; planSourcesLk guards them.
+	planSourceLocks map[string]chan struct{}
+	planSourcesLk   sync.Mutex
+	// planRegistryLk serializes publications to the plan registry.
+	planRegistryLk sync.Mutex
+	// persistentLk serializes the queueing of persistent runs, so that they
+	// can't exceed the cap of the daemon, see checkPersistent.
+	persistentLk sync.Mutex
+	// runStores are the key/value stores of ongoing runs, by run ID.
+	runStores   map[string]*runStore
+	runStoresLk sync.RWMutex
+	// churnSizes are the sizes of the groups of the ongoing runs with churn,
+	// by run ID, which change as they're scaled.
+	churnSizes   map[string]*groupSizes
+	churnSizesLk sync.Mutex
+	// limits are the guardrails on the runs of the daemon.
+	limits *limits
+	// archive stores the archives of the outputs of runs; nil if not
+	// configured.
+	archive archiveStore
+	// archiveLocks serialize the moves of the outputs of each run between
+	// archive tiers, see lockArchive; archiveLk guards them.
+	archiveLocks map[string]*archiveLock
+	archiveLk    sync.Mutex
+	// docker is the client of the docker daemon, created on first use, see
+	// dockerClient.
+	docker     *client.Client
+	dockerErr  error
+	dockerOnce sync.Once
+	// estimates caches the expected durations of runs, by plan, case and
+	// instance count, see expectedDuration.
+	estimates   map[string]cachedEstimate
+	estimatesLk sync.Mutex
 }
 
 var _ api.Engine = (*Engine)(nil)
@@ -94,19 +149,46 @@ func NewEngine(cfg *EngineConfig) (*Engine, error) {
 		return nil, fmt.Errorf("unknown task repo type: %s", trt)
 	}
 
+	switch wr := cfg.EnvConfig.Daemon.Scheduler.WorkspaceRetention; wr {
+	case "", RetainNoWorkspaces, RetainFailedWorkspaces, RetainAllWorkspaces:
+	default:
+		return nil, fmt.Errorf("unknown workspace retention: %s", wr)
+	}
+
 	queue, err := task.NewQueue(store, cfg.EnvConfig.Daemon.Scheduler.QueueSize, UnmarshalTask)
 	if err != nil {
 		return nil, err
 	}
 
+	github, err := newGithubApp(cfg.EnvConfig.Daemon.GithubApp)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics, err := newAnalyticsExporter(cfg.EnvConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := newLimits(cfg.EnvConfig.Daemon.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	e := &Engine{
-		builders: make(map[string]api.Builder, len(cfg.Builders)),
-		runners:  make(map[string]api.Runner, len(cfg.Runners)),
-		envcfg:   cfg.EnvConfig,
-		ctx:      context.Background(),
-		store:    store,
-		queue:    queue,
-		signals:  make(map[string]chan int),
+		builders:  make(map[string]api.Builder, len(cfg.Builders)),
+		runners:   make(map[string]api.Runner, len(cfg.Runners)),
+		envcfg:    cfg.EnvConfig,
+		ctx:       ctx,
+		cancel:    cancel,
+		store:     store,
+		queue:     queue,
+		signals:   make(map[string]chan int),
+		leases:    make(map[string]remoteLease),
+		github:    github,
+		analytics: analytics,
+		limits:    limits,
 	}
 
 	for _, b := range cfg.Builders {
@@ -117,8 +199,33 @@ func NewEngine(cfg *EngineConfig) (*Engine, error) {
 		e.runners[r.ID()] = r
 	}
 
+	e.local = newLocalTasks(e)
+
+	if err := e.recoverTasks(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to recover interrupted tasks: %w", err)
+	}
+
+	go e.leaseLoop()
+
+	var src taskSource = e.local
+	if remote := cfg.EnvConfig.Daemon.Scheduler.Remote; remote != "" {
+		logging.S().Infow("pulling tasks from remote scheduler", "endpoint", remote)
+		src = newRemoteTasks(e, remote, cfg.EnvConfig.Daemon.Scheduler.RemoteToken)
+	}
+
 	for i := 0; i < cfg.EnvConfig.Daemon.Scheduler.Workers; i++ {
-		go e.worker(i)
+		i := i
+		e.workers.Add(1)
+		go func() {
+			defer e.workers.Done()
+			e.worker(i, src)
+		}()
+	}
+
+	if acfg := cfg.EnvConfig.Daemon.Archive; acfg.Bucket != "" {
+		e.archive = &s3Archive{aws: cfg.EnvConfig.AWS, cfg: acfg}
+		go e.archiveLoop()
 	}
 
 	return e, nil
@@ -177,9 +284,18 @@ func (e *Engine) ListRunners() map[string]api.Runner {
 	return m
 }
 
-func (e *Engine) QueueBuild(request *api.BuildRequest, sources *api.UnpackedSources) (string, error) {
+func (e *Engine) QueueBuild(ctx context.Context, request *api.BuildRequest, sources *api.UnpackedSources) (string, error) {
+	if err := checkNotifyURL(e.envcfg.Daemon.NotifyURLs, request.NotifyURL); err != nil {
+		return "", err
+	}
+
 	id := xid.New().String()
-	err := e.queue.Push(&task.Task{
+	sources, err := e.prepareTaskSources(ctx, id, &request.Composition, sources, &request.Manifest)
+	if err != nil {
+		return "", err
+	}
+
+	err = e.queue.Push(&task.Task{
 		Version:  0,
 		Priority: request.Priority,
 		ID:       id,
@@ -196,11 +312,14 @@ func (e *Engine) QueueBuild(request *api.BuildRequest, sources *api.UnpackedSour
 		},
 		CreatedBy: task.CreatedBy(request.CreatedBy),
 	})
+	if err != nil {
+		_ = os.RemoveAll(e.taskWorkspace(id))
+	}
 
 	return id, err
 }
 
-func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources) (string, error) {
+func (e *Engine) QueueRun(ctx context.Context, request *api.RunRequest, sources *api.UnpackedSources) (string, error) {
 	var (
 		builders = request.Composition.ListBuilders()
 		runner   = request.Composition.Global.Runner
@@ -212,6 +331,10 @@ func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources)
 		return "", fmt.Errorf("unknown runner: %s", runner)
 	}
 
+	if err := checkNotifyURL(e.envcfg.Daemon.NotifyURLs, request.NotifyURL); err != nil {
+		return "", err
+	}
+
 	// Check if builders and runner are compatible
 	for _, builder := range builders {
 		if !stringInSlice(builder, run.CompatibleBuilders()) {
@@ -219,7 +342,72 @@ func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources)
 		}
 	}
 
+	// Reject instance log limits on runners that can't enforce them, rather
+	// than leaving the logs of instances unbounded.
+	if v, ok := request.Composition.Global.RunConfig["instance_logs_limit"]; ok {
+		if problems := config.CheckConfigMap("global.run_config", config.ConfigMap{"instance_logs_limit": v}, run.ConfigType()); len(problems) > 0 {
+			return "", fmt.Errorf("runner %s doesn't support instance_logs_limit", runner)
+		}
+	}
+
+	if err := e.checkInstanceServices(&request.Composition, &request.Manifest); err != nil {
+		return "", err
+	}
+
+	// limits apply to the user the request authenticated as, not to the one
+	// it claims.
+	request.CreatedBy.Authenticated = api.AuthenticatedUser(ctx)
+
 	id := xid.New().String()
+	sources, err := e.prepareTaskSources(ctx, id, &request.Composition, sources, &request.Manifest)
+	if err != nil {
+		return "", err
+	}
+
+	// Discard the workspace of the task unless it's queued.
+	queued := false
+	defer func() {
+		if !queued {
+			_ = os.RemoveAll(e.taskWorkspace(id))
+		}
+	}()
+
+	// Reject invalid compositions, e.g. test params that don't match the
+	// manifest, before queueing them.
+	prepared, err := request.Composition.PrepareForRun(&request.Manifest)
+	if err != nil {
+		return "", err
+	}
+	if err := request.Manifest.Hooks.Validate(); err != nil {
+		return "", err
+	}
+
+	// Reject persistent runs beyond the cap of the daemon; the lock is held
+	// until the run is queued.
+	if request.Composition.Global.Persistent {
+		e.persistentLk.Lock()
+		defer e.persistentLk.Unlock()
+		if err := e.checkPersistent(); err != nil {
+			return "", err
+		}
+	}
+
+	// Reject runs exceeding the limits of the daemon.
+	for _, r := range prepared.Runs {
+		if err := e.limits.check(runner, request.CreatedBy.Authenticated, int(r.TotalInstances)); err != nil {
+			return "", err
+		}
+	}
+
+	// Reject groups requesting a security context the daemon doesn't allow.
+	for _, r := range prepared.Runs {
+		for _, g := range r.Groups {
+			if err := checkSecurity(e.EnvConfig().Daemon.Security, g.ID, g.Security); err != nil {
+				return "", err
+			}
+		}
+	}
+
 	cby := task.CreatedBy(request.CreatedBy)
 	newTask := &task.Task{
 		Version:     0,
@@ -243,12 +431,14 @@ func (e *Engine) QueueRun(request *api.RunRequest, sources *api.UnpackedSources)
 		CreatedBy: cby,
 	}
 
-	err := e.queue.PushUniqueByBranch(newTask)
+	err = e.queue.PushUniqueByBranch(newTask)
+	queued = err == nil
 
 	return id, err
 }
 
-func (e *Engine) DoCollectOutputs(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
+func (e *Engine) DoCollectOutputs(ctx context.Context, req *api.OutputsRequest, ow *rpc.OutputWriter) error {
+	runID := req.RunID
 	t, err := e.GetTask(runID)
 	if err != nil {
 		return fmt.Errorf("could not get task %s: %s", runID, err.Error())
@@ -277,6 +467,16 @@ func (e *Engine) DoCollectOutputs(ctx context.Context, runID string, ow *rpc.Out
 		RunID:        runID,
 		EnvConfig:    *e.envcfg,
 		RunnerConfig: obj,
+		Dedup:        req.Dedup,
+		Filter:       req.Filter,
+		Preview:      req.Preview,
+
+		Compression:      req.Compression,
+		CompressionLevel: req.CompressionLevel,
+	}
+
+	if err := e.restoreOutputs(t, ow); err != nil {
+		return err
 	}
 
 	return run.CollectOutputs(ctx, input, ow)
@@ -328,6 +528,75 @@ func (e *Engine) DoHealthcheck(ctx context.Context, runner string, fix bool, ow
 	return hc.Healthcheck(ctx, e, ow, fix)
 }
 
+// DoInfraUpgrade upgrades the infrastructure containers of a runner to the
+// images pinned in the configuration, which is read again so that a new pinned
+// set applies without restarting the daemon.
+func (e *Engine) DoInfraUpgrade(ctx context.Context, runner string, ow *rpc.OutputWriter) (*api.HealthcheckReport, error) {
+	run, ok := e.runners[runner]
+	if !ok {
+		return nil, fmt.Errorf("unknown runner: %s", runner)
+	}
+
+	up, ok := run.(api.InfraUpgrader)
+	if !ok {
+		return nil, fmt.Errorf("runner %s does not support infrastructure upgrades", runner)
+	}
+
+	fresh := &config.EnvConfig{}
+	if err := fresh.Load(); err != nil {
+		return nil, fmt.Errorf("failed to read the pinned infrastructure images: %w", err)
+	}
+	e.lk.Lock()
+	e.envcfg.Daemon.Infra = fresh.Daemon.Infra
+	e.lk.Unlock()
+
+	ow.Infof("upgrading infrastructure of runner: %s", runner)
+
+	return up.UpgradeInfra(ctx, e, ow)
+}
+
+// DoDebug attaches to a live instance of a run, through the runner of the
+// run: to a shell started in the instance, or to one of its ports.
+func (e *Engine) DoDebug(ctx context.Context, req *api.DebugRequest) (io.ReadWriteCloser, error) {
+	t, err := e.GetTask(req.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get task %s: %s", req.RunID, err.Error())
+	}
+
+	run, ok := e.runners[t.Runner]
+	if !ok {
+		return nil, fmt.Errorf("unknown runner: %s", t.Runner)
+	}
+
+	dbg, ok := run.(api.Debugger)
+	if !ok {
+		return nil, fmt.Errorf("runner %s does not support debugging", t.Runner)
+	}
+
+	var cfg config.CoalescedConfig
+	cfg = cfg.Append(e.envcfg.Runners[t.Runner])
+
+	obj, err := cfg.CoalesceIntoType(run.ConfigType())
+	if err != nil {
+		return nil, fmt.Errorf("error while coalescing configuration values: %w", err)
+	}
+
+	input := &api.DebugInput{
+		EnvConfig:    *e.envcfg,
+		RunID:        req.RunID,
+		RunnerConfig: obj,
+		GroupID:      req.Group,
+		Instance:     req.Instance,
+		Rows:         req.Rows,
+		Cols:         req.Cols,
+	}
+
+	if req.Port > 0 {
+		return dbg.DebugDial(ctx, input, req.Port)
+	}
+	return dbg.DebugShell(ctx, input)
+}
+
 func (e *Engine) DoBuildPurge(ctx context.Context, builder, plan string, ow *rpc.OutputWriter) error {
 	bm, ok := e.builders[builder]
 	if !ok {
@@ -338,13 +607,41 @@ func (e *Engine) DoBuildPurge(ctx context.Context, builder, plan string, ow *rpc
 
 // EnvConfig returns the EnvConfig for this Engine.
 func (e *Engine) EnvConfig() config.EnvConfig {
+	e.lk.RLock()
+	defer e.lk.RUnlock()
+
 	return *e.envcfg
 }
 
 func (e *Engine) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
 	return e.ctx
 }
 
+// Close stops the workers of the engine, cancels the tasks they are
+// processing, and waits for the runners to clean up after them.
+func (e *Engine) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.workers.Wait()
+	if e.docker != nil {
+		return e.docker.Close()
+	}
+	return nil
+}
+
+// dockerClient returns the client of the docker daemon shared by the engine,
+// creating it on first use: daemons that only run on k8s never need one.
+func (e *Engine) dockerClient() (*client.Client, error) {
+	e.dockerOnce.Do(func() {
+		e.docker, e.dockerErr = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	})
+	return e.docker, e.dockerErr
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -406,8 +703,12 @@ func (e *Engine) Tasks(filters api.TasksFilters) ([]task.Task, error) {
 	return res, nil
 }
 
-// DeleteTask removes a task from the Testground daemon database
+// DeleteTask removes a task from the Testground daemon database, along with
+// the archive of its outputs, if any.
 func (e *Engine) DeleteTask(id string) error {
+	if err := e.deleteArchive(id); err != nil {
+		return err
+	}
 	return e.store.Delete(id)
 }
 
@@ -417,12 +718,7 @@ func (e *Engine) GetTask(id string) (*task.Task, error) {
 
 // Kill closes the signal channel for a given task, which signals to the runner to stop it
 func (e *Engine) Kill(id string) error {
-	e.signalsLk.RLock()
-	if ch, ok := e.signals[id]; ok {
-		close(ch)
-	}
-	e.signalsLk.RUnlock()
-
+	e.signal(id)
 	return nil
 }
 
@@ -459,9 +755,28 @@ func UnmarshalTask(taskData []byte) (*task.Task, error) {
 // Logs writes the Testground daemon logs for a given task to the passed writer.
 // It is used when using the `--follow` option with `testground run`
 func (e *Engine) Logs(ctx context.Context, id string, follow bool, cancel bool, w io.Writer) (*task.Task, error) {
-	ow := rpc.NewFileOutputWriter(w)
+	return e.logs(ctx, id, e.taskLogPath(id), follow, cancel, w)
+}
 
-	path := filepath.Join(e.EnvConfig().Dirs().Daemon(), id+".out")
+// BuildLogs writes the complete builder output of a given task to the passed
+// writer. Both build tasks and run tasks that build their artifacts produce
+// build logs.
+func (e *Engine) BuildLogs(ctx context.Context, id string, follow bool, cancel bool, w io.Writer) (*task.Task, error) {
+	return e.logs(ctx, id, e.buildLogPath(id), follow, cancel, w)
+}
+
+// taskLogPath returns the path of the log of a task.
+func (e *Engine) taskLogPath(id string) string {
+	return filepath.Join(e.EnvConfig().Dirs().Daemon(), id+".out")
+}
+
+// buildLogPath returns the path of the build log of a task.
+func (e *Engine) buildLogPath(id string) string {
+	return filepath.Join(e.EnvConfig().Dirs().Daemon(), id+".build.out")
+}
+
+func (e *Engine) logs(ctx context.Context, id string, path string, follow bool, cancel bool, w io.Writer) (*task.Task, error) {
+	ow := rpc.NewFileOutputWriter(w)
 
 	if !follow {
 		file, err := os.Open(path)
@@ -525,11 +840,7 @@ Outer:
 		select {
 		case <-ctx.Done():
 			if cancel {
-				e.signalsLk.RLock()
-				if ch, ok := e.signals[id]; ok {
-					close(ch)
-				}
-				e.signalsLk.RUnlock()
+				e.signal(id)
 			}
 			break Outer
 		default:
@@ -1,12 +1,19 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
 	"github.com/testground/testground/pkg/task"
 )
 
@@ -96,3 +103,79 @@ func TestUnmarshalTaskBuild(t *testing.T) {
 		t.Errorf("Unmarshal Build task returned incorrect data")
 	}
 }
+
+func TestKillAndClose(t *testing.T) {
+	e := newSchedulerEngine(t)
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	// killing a task twice, e.g. on ^C and then explicitly, is harmless.
+	ch := make(chan int)
+	e.addSignal("c60i0d2llu6a7gha3ed0", ch)
+	require.NoError(t, e.Kill("c60i0d2llu6a7gha3ed0"))
+	require.NoError(t, e.Kill("c60i0d2llu6a7gha3ed0"))
+	select {
+	case <-ch:
+	default:
+		t.Fatal("task was not signaled")
+	}
+
+	// closing the engine stops its workers, and waits for them.
+	done := make(chan struct{})
+	e.workers.Add(1)
+	go func() {
+		defer e.workers.Done()
+		e.worker(0, e.local)
+	}()
+	go func() {
+		require.NoError(t, e.Close())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not stop when the engine was closed")
+	}
+}
+
+// fakeUpgrader records the pinned images it upgrades infrastructure to.
+type fakeUpgrader struct {
+	api.Runner
+	images []string
+}
+
+func (f *fakeUpgrader) UpgradeInfra(_ context.Context, engine api.Engine, _ *rpc.OutputWriter) (*api.HealthcheckReport, error) {
+	f.images = append(f.images, engine.EnvConfig().Daemon.Infra.Image("sync-service"))
+	return &api.HealthcheckReport{}, nil
+}
+
+func TestInfraUpgradeReadsPinnedImages(t *testing.T) {
+	home := t.TempDir()
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", home)
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	up := &fakeUpgrader{}
+	e := newSchedulerEngine(t)
+	e.runners = map[string]api.Runner{"local:docker": up, "exec:go": nil}
+
+	_, err := e.DoInfraUpgrade(context.Background(), "local:docker", rpc.Discard())
+	require.NoError(t, err)
+
+	// pin a new version, and upgrade again without restarting.
+	pinned := "[daemon.infra.images]\nsync-service = \"iptestground/sync-service:v0.4.0\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".env.toml"), []byte(pinned), 0644))
+	_, err = e.DoInfraUpgrade(context.Background(), "local:docker", rpc.Discard())
+	require.NoError(t, err)
+
+	require.Equal(t, []string{config.DefaultInfraImages["sync-service"], "iptestground/sync-service:v0.4.0"}, up.images)
+
+	_, err = e.DoInfraUpgrade(context.Background(), "exec:go", rpc.Discard())
+	require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+// CheckEnvConfig checks the configurations of builders and runners in the
+// environment configuration, including those of its profiles, against the
+// builders and runners known to the system. These are free-form tables, so
+// their typos are not caught when the configuration is loaded.
+func CheckEnvConfig(cfg *config.EnvConfig) error {
+	var problems []string
+
+	check := func(prefix string, builders, runners map[string]config.ConfigMap) {
+		for _, id := range sortedConfigIDs(builders) {
+			b := findBuilder(id)
+			if b == nil {
+				problems = append(problems, fmt.Sprintf("unknown builder %s in [%sbuilders]", id, prefix))
+				continue
+			}
+			problems = append(problems, config.CheckConfigMap(prefix+"builders."+id, builders[id], b.ConfigType())...)
+		}
+		for _, id := range sortedConfigIDs(runners) {
+			r := findRunner(id)
+			if r == nil {
+				problems = append(problems, fmt.Sprintf("unknown runner %s in [%srunners]", id, prefix))
+				continue
+			}
+			problems = append(problems, config.CheckConfigMap(prefix+"runners."+id, runners[id], r.ConfigType(), config.RunnerDisabledFlag)...)
+		}
+	}
+
+	check("", cfg.Builders, cfg.Runners)
+
+	profiles := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	for _, name := range profiles {
+		check("profiles."+name+".", cfg.Profiles[name].Builders, nil)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &config.SchemaError{File: cfg.Dirs().EnvFile(), Problems: problems}
+}
+
+func findBuilder(id string) api.Builder {
+	for _, b := range AllBuilders {
+		if b.ID() == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func findRunner(id string) api.Runner {
+	for _, r := range AllRunners {
+		if r.ID() == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func sortedConfigIDs(m map[string]config.ConfigMap) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+const (
+	// estimateWindow is how far back we look for similar tasks to estimate
+	// the duration of a task from.
+	estimateWindow = 30 * 24 * time.Hour
+	// estimateSamples is the number of most recent similar tasks the
+	// estimate is derived from.
+	estimateSamples = 10
+	// estimateReportInterval is how often the estimated progress of a run is
+	// written to its output.
+	estimateReportInterval = time.Minute
+	// estimateCacheTTL is how long the expected duration of runs is cached
+	// for, rather than scanning the archive for every task listed.
+	estimateCacheTTL = time.Minute
+)
+
+// cachedEstimate is the expected duration of runs, as of when it was derived.
+type cachedEstimate struct {
+	expected time.Duration
+	samples  int
+	at       time.Time
+}
+
+// EstimateTask estimates the progress of a scheduled or processing run task,
+// from how long the last successful runs of the same test case, with the same
+// number of instances, took to process. It returns nil if the task isn't
+// pending, or if no such run completed recently.
+func (e *Engine) EstimateTask(tsk *task.Task) (*task.Estimate, error) {
+	expected, samples, err := e.expectedDuration(tsk)
+	if err != nil || samples == 0 {
+		return nil, err
+	}
+
+	switch tsk.State().State {
+	case task.StateScheduled:
+		return &task.Estimate{Expected: expected, Remaining: expected, Samples: samples}, nil
+	case task.StateProcessing:
+		return newEstimate(expected, samples, time.Since(tsk.State().Created)), nil
+	default:
+		return nil, nil
+	}
+}
+
+// newEstimate returns the estimate of a task expected to take expected, which
+// has been processing for elapsed.
+func newEstimate(expected time.Duration, samples int, elapsed time.Duration) *task.Estimate {
+	est := &task.Estimate{Expected: expected, Samples: samples}
+	if elapsed < expected {
+		est.Remaining = (expected - elapsed).Truncate(time.Second)
+		est.Progress = float64(elapsed) / float64(expected)
+	} else {
+		// the task is overdue; it's nearly done, as far as we can tell.
+		est.Progress = 0.99
+	}
+	return est
+}
+
+// expectedDuration returns the median processing time of the last successful
+// runs similar to tsk, along with the number of runs it's derived from. It's
+// cached for estimateCacheTTL.
+func (e *Engine) expectedDuration(tsk *task.Task) (time.Duration, int, error) {
+	if tsk.Type != task.TypeRun {
+		return 0, 0, nil
+	}
+	instances, err := taskInstances(tsk)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	key := fmt.Sprintf("%s/%s/%d", tsk.Plan, tsk.Case, instances)
+	e.estimatesLk.Lock()
+	cached, ok := e.estimates[key]
+	e.estimatesLk.Unlock()
+	if ok && time.Since(cached.at) < estimateCacheTTL {
+		return cached.expected, cached.samples, nil
+	}
+
+	expected, samples, err := e.deriveDuration(tsk, instances)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	e.estimatesLk.Lock()
+	if e.estimates == nil {
+		e.estimates = make(map[string]cachedEstimate)
+	}
+	e.estimates[key] = cachedEstimate{expected: expected, samples: samples, at: time.Now()}
+	e.estimatesLk.Unlock()
+
+	return expected, samples, nil
+}
+
+// deriveDuration returns the median processing time of the last successful
+// runs of the plan and case of tsk, with the supplied number of instances.
+func (e *Engine) deriveDuration(tsk *task.Task, instances int) (time.Duration, int, error) {
+	now := time.Now().UTC()
+	past, err := e.store.Filter(task.StateComplete, now.Add(-estimateWindow), now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the most recent tasks come last.
+	var durations []time.Duration
+	for i := len(past) - 1; i >= 0 && len(durations) < estimateSamples; i-- {
+		p := past[i]
+		if p.ID == tsk.ID || p.Type != task.TypeRun || p.Plan != tsk.Plan || p.Case != tsk.Case {
+			continue
+		}
+		// runs that failed or timed out may have stopped early, or dragged on.
+		if outcome, err := data.DecodeTaskOutcome(p); err != nil || outcome != task.OutcomeSuccess || p.Error != "" {
+			continue
+		}
+		if n, err := taskInstances(p); err != nil || n != instances {
+			continue
+		}
+		if d, ok := processingTime(p); ok {
+			durations = append(durations, d)
+		}
+	}
+	if len(durations) == 0 {
+		return 0, 0, nil
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2].Truncate(time.Second), len(durations), nil
+}
+
+// taskInstances returns the number of instances of the run requested by a
+// run task.
+func taskInstances(tsk *task.Task) (int, error) {
+	in, err := taskRunInput(tsk)
+	if err != nil {
+		return 0, err
+	}
+
+	comp := in.Composition
+	for _, r := range comp.Runs {
+		if len(in.RunIds) > 0 && r.ID != in.RunIds[0] {
+			continue
+		}
+		if r.TotalInstances > 0 {
+			return int(r.TotalInstances), nil
+		}
+		var n int
+		for _, g := range r.Groups {
+			n += int(g.Instances.Count)
+		}
+		if n > 0 {
+			return n, nil
+		}
+		break
+	}
+	return int(comp.Global.TotalInstances), nil
+}
+
+// taskRunInput returns the input of a run task, decoding it if the task was
+// decoded without knowing its type.
+func taskRunInput(tsk *task.Task) (*RunInput, error) {
+	in, ok := tsk.Input.(*RunInput)
+	if !ok {
+		typed, err := unmarshalTaskInput(tsk)
+		if err != nil {
+			return nil, err
+		}
+		in, ok = typed.(*RunInput)
+	}
+	if !ok || in.RunRequest == nil {
+		return nil, fmt.Errorf("task %s has no run input", tsk.ID)
+	}
+	return in, nil
+}
+
+// processingTime returns how long a finished task spent processing, since it
+// was last picked up.
+func processingTime(tsk *task.Task) (time.Duration, bool) {
+	for i := len(tsk.States) - 1; i >= 0; i-- {
+		if tsk.States[i].State == task.StateProcessing {
+			return tsk.State().Created.Sub(tsk.States[i].Created), true
+		}
+	}
+	return 0, false
+}
+
+// reportEstimates periodically writes the estimated progress of a run task to
+// its output, until the returned function is called.
+func (e *Engine) reportEstimates(tsk *task.Task, ow *rpc.OutputWriter) (stop func()) {
+	expected, samples, err := e.expectedDuration(tsk)
+	if err != nil || samples == 0 {
+		return func() {}
+	}
+
+	ow.Infow("estimated run duration", "expected", expected, "samples", samples)
+
+	var (
+		start = time.Now()
+		done  = make(chan struct{})
+		wg    sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(estimateReportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				est := newEstimate(expected, samples, time.Since(start))
+				ow.Infow("estimated progress", "progress", fmt.Sprintf("%.0f%%", est.Progress*100), "remaining", est.Remaining)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestEstimateTask(t *testing.T) {
+	e := newSchedulerEngine(t)
+
+	// newRun returns a run task of the supplied test case and instance
+	// count, which started processing at the supplied time.
+	newRun := func(tcase string, instances uint, started time.Time) *task.Task {
+		var comp api.Composition
+		comp.Global.TotalInstances = instances
+		return &task.Task{
+			ID:   xid.NewWithTime(started.Add(-time.Minute)).String(),
+			Type: task.TypeRun,
+			Plan: "network",
+			Case: tcase,
+			States: []task.DatedState{
+				{State: task.StateScheduled, Created: started.Add(-time.Minute)},
+				{State: task.StateProcessing, Created: started},
+			},
+			Input: &RunInput{RunRequest: &api.RunRequest{Composition: comp}},
+		}
+	}
+
+	// archive similar runs that took 10, 20 and 30 minutes, and others that
+	// don't count.
+	now := time.Now().UTC()
+	archive := func(tsk *task.Task, took time.Duration, state task.State, errMsg string) {
+		tsk.States = append(tsk.States, task.DatedState{State: state, Created: tsk.States[1].Created.Add(took)})
+		tsk.Error = errMsg
+		require.NoError(t, e.store.PersistProcessing(tsk))
+		require.NoError(t, e.store.ArchiveTask(tsk))
+	}
+	archive(newRun("ping-pong", 10, now.Add(-5*time.Hour)), 10*time.Minute, task.StateComplete, "")
+	archive(newRun("ping-pong", 10, now.Add(-4*time.Hour)), 30*time.Minute, task.StateComplete, "")
+	archive(newRun("ping-pong", 10, now.Add(-3*time.Hour)), 20*time.Minute, task.StateComplete, "")
+	archive(newRun("ping-pong", 20, now.Add(-3*time.Hour)), time.Hour, task.StateComplete, "")
+	archive(newRun("traffic", 10, now.Add(-3*time.Hour)), time.Hour, task.StateComplete, "")
+	archive(newRun("ping-pong", 10, now.Add(-2*time.Hour)), time.Hour, task.StateCanceled, "")
+	archive(newRun("ping-pong", 10, now.Add(-2*time.Hour)), time.Hour, task.StateComplete, "failed")
+	failed := newRun("ping-pong", 10, now.Add(-2*time.Hour))
+	failed.Result = &runner.Result{Outcome: task.OutcomeFailure}
+	archive(failed, time.Hour, task.StateComplete, "")
+
+	// a run in progress for 5 minutes is expected to take the median.
+	tsk := newRun("ping-pong", 10, now.Add(-5*time.Minute))
+	est, err := e.EstimateTask(tsk)
+	require.NoError(t, err)
+	require.NotNil(t, est)
+	require.Equal(t, 20*time.Minute, est.Expected)
+	require.Equal(t, 3, est.Samples)
+	require.InDelta(t, 0.25, est.Progress, 0.01)
+	require.InDelta(t, float64(15*time.Minute), float64(est.Remaining), float64(time.Second))
+
+	// overdue runs don't go past 99%.
+	tsk = newRun("ping-pong", 10, now.Add(-time.Hour))
+	est, err = e.EstimateTask(tsk)
+	require.NoError(t, err)
+	require.Equal(t, 0.99, est.Progress)
+	require.Zero(t, est.Remaining)
+
+	// estimates are cached.
+	archive(newRun("ping-pong", 10, now.Add(-time.Hour)), 5*time.Minute, task.StateComplete, "")
+	est, err = e.EstimateTask(newRun("ping-pong", 10, now))
+	require.NoError(t, err)
+	require.Equal(t, 3, est.Samples)
+
+	// runs without history have no estimate.
+	tsk = newRun("ping-pong", 30, now)
+	est, err = e.EstimateTask(tsk)
+	require.NoError(t, err)
+	require.Nil(t, est)
+}
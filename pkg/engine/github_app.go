@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+const defaultGithubAPIURL = "https://api.github.com"
+
+// githubApp reports tasks to GitHub, authenticating as a GitHub App
+// installation.
+type githubApp struct {
+	cfg     config.GithubAppConfig
+	key     *rsa.PrivateKey
+	baseURL string
+	cl      *http.Client
+}
+
+// newGithubApp returns a client for the configured GitHub App, or nil if no
+// app is configured.
+func newGithubApp(cfg config.GithubAppConfig) (*githubApp, error) {
+	if cfg.AppID == 0 {
+		return nil, nil
+	}
+	if cfg.InstallationID == 0 {
+		return nil, errors.New("github app: installation_id must be set")
+	}
+
+	b, err := os.ReadFile(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("github app: failed to read private key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("github app: private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		k, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, fmt.Errorf("github app: failed to parse private key: %w", err)
+		}
+		var ok bool
+		if key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("github app: private key is not an RSA key")
+		}
+	}
+
+	base := cfg.APIURL
+	if base == "" {
+		base = defaultGithubAPIURL
+	}
+
+	return &githubApp{
+		cfg:     cfg,
+		key:     key,
+		baseURL: strings.TrimSuffix(base, "/"),
+		cl:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// jwt returns a JSON Web Token identifying the app, as required to request
+// installation tokens.
+func (g *githubApp) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]int64{
+		// backdated to allow for clock drift, as recommended by GitHub.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": g.cfg.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// installationToken obtains a short-lived token for the app installation.
+func (g *githubApp) installationToken(ctx context.Context) (string, error) {
+	jwt, err := g.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", g.cfg.InstallationID)
+	if err := g.do(ctx, "Bearer "+jwt, http.MethodPost, path, nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to obtain installation token: %w", err)
+	}
+	return resp.Token, nil
+}
+
+func (g *githubApp) do(ctx context.Context, auth, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	res, err := g.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s %s: unexpected status code %d: %s", method, path, res.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// githubCheck is the GitHub check run reporting a task.
+type githubCheck struct {
+	owner, repo string
+	id          int64
+}
+
+// startGithubCheck creates an in-progress check run for a task created by
+// CI. It returns nil if the task can't be reported.
+func (e *Engine) startGithubCheck(tsk *task.Task) *githubCheck {
+	if e.github == nil || !tsk.CreatedByCI() {
+		return nil
+	}
+
+	ownerrepo := strings.SplitN(tsk.CreatedBy.Repo, "/", 2)
+	if len(ownerrepo) != 2 {
+		logging.S().Warnw("cannot report task to github: invalid repo", "task_id", tsk.ID, "repo", tsk.CreatedBy.Repo)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := e.github.installationToken(ctx)
+	if err != nil {
+		logging.S().Warnw("could not create github check run", "task_id", tsk.ID, "err", err)
+		return nil
+	}
+
+	check := &githubCheck{owner: ownerrepo[0], repo: ownerrepo[1]}
+	n := e.newNotification(tsk)
+
+	var resp struct {
+		ID int64 `json:"id"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/check-runs", check.owner, check.repo)
+	err = e.github.do(ctx, "token "+token, http.MethodPost, path, map[string]interface{}{
+		"name":        "testground/" + tsk.Name(),
+		"head_sha":    tsk.CreatedBy.Commit,
+		"status":      "in_progress",
+		"external_id": tsk.ID,
+		"details_url": n.LogsURL,
+	}, &resp)
+	if err != nil {
+		logging.S().Warnw("could not create github check run", "task_id", tsk.ID, "err", err)
+		return nil
+	}
+
+	check.id = resp.ID
+	return check
+}
+
+// completeGithubCheck concludes the check run of a completed task, and
+// comments a summary of the task on the pull requests of its commit.
+func (e *Engine) completeGithubCheck(tsk *task.Task, check *githubCheck) {
+	if check == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := e.github.installationToken(ctx)
+	if err != nil {
+		logging.S().Warnw("could not complete github check run", "task_id", tsk.ID, "err", err)
+		return
+	}
+
+	n := e.newNotification(tsk)
+	summary := githubSummary(tsk, n)
+
+	conclusion := "failure"
+	switch n.Outcome {
+	case task.OutcomeSuccess:
+		conclusion = "success"
+	case task.OutcomeCanceled:
+		conclusion = "cancelled"
+	}
+
+	path := fmt.Sprintf("/repos/%s/%s/check-runs/%d", check.owner, check.repo, check.id)
+	err = e.github.do(ctx, "token "+token, http.MethodPatch, path, map[string]interface{}{
+		"status":     "completed",
+		"conclusion": conclusion,
+		"output": map[string]string{
+			"title":   n.summary(),
+			"summary": summary,
+		},
+	}, nil)
+	if err != nil {
+		logging.S().Warnw("could not complete github check run", "task_id", tsk.ID, "err", err)
+	}
+
+	if e.github.cfg.DisableComments {
+		return
+	}
+
+	var pulls []struct {
+		Number int `json:"number"`
+	}
+	path = fmt.Sprintf("/repos/%s/%s/commits/%s/pulls", check.owner, check.repo, tsk.CreatedBy.Commit)
+	if err := e.github.do(ctx, "token "+token, http.MethodGet, path, nil, &pulls); err != nil {
+		logging.S().Warnw("could not list pull requests of commit", "task_id", tsk.ID, "err", err)
+		return
+	}
+
+	for _, pr := range pulls {
+		path := fmt.Sprintf("/repos/%s/%s/issues/%d/comments", check.owner, check.repo, pr.Number)
+		body := map[string]string{"body": "### " + n.summary() + "\n\n" + summary}
+		if err := e.github.do(ctx, "token "+token, http.MethodPost, path, body, nil); err != nil {
+			logging.S().Warnw("could not comment on pull request", "task_id", tsk.ID, "pr", pr.Number, "err", err)
+		}
+	}
+}
+
+// githubSummary renders the markdown summary of a completed task.
+func githubSummary(tsk *task.Task, n *notification) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "**Outcome:** %s, after %s\n\n", n.Outcome, n.Took)
+	if n.Error != "" {
+		fmt.Fprintf(&b, "**Error:** `%s`\n\n", n.Error)
+	}
+
+	if res, ok := tsk.Result.(*runner.Result); ok && len(res.Outcomes) > 0 {
+		groups := make([]string, 0, len(res.Outcomes))
+		for g := range res.Outcomes {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+
+		b.WriteString("| Group | Succeeded | Total |\n|---|---|---|\n")
+		for _, g := range groups {
+			o := res.Outcomes[g]
+			fmt.Fprintf(&b, "| %s | %d | %d |\n", g, o.Ok, o.Total)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "[Logs](%s)", n.LogsURL)
+	if n.OutputsURL != "" {
+		fmt.Fprintf(&b, " · [Outputs archive](%s)", n.OutputsURL)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
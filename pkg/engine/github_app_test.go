@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestGithubCheckLifecycle(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lk    sync.Mutex
+		calls []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		lk.Unlock()
+
+		switch {
+		case r.URL.Path == "/app/installations/7/access_tokens":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				t.Errorf("expected a JWT, got %q", r.Header.Get("Authorization"))
+			}
+			_, _ = w.Write([]byte(`{"token":"tkn"}`))
+		case r.Header.Get("Authorization") != "token tkn":
+			t.Errorf("unexpected authorization: %q", r.Header.Get("Authorization"))
+		case r.URL.Path == "/repos/org/repo/check-runs":
+			_, _ = w.Write([]byte(`{"id":42}`))
+		case r.URL.Path == "/repos/org/repo/check-runs/42":
+			var body struct {
+				Conclusion string `json:"conclusion"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body.Conclusion != "failure" {
+				t.Errorf("unexpected conclusion: %s", body.Conclusion)
+			}
+		case r.URL.Path == "/repos/org/repo/commits/abc/pulls":
+			_, _ = w.Write([]byte(`[{"number":3}]`))
+		}
+	}))
+	defer srv.Close()
+
+	gh, err := newGithubApp(config.GithubAppConfig{AppID: 1, InstallationID: 7, PrivateKeyPath: keyPath, APIURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{envcfg: &config.EnvConfig{}, github: gh}
+
+	now := time.Now().UTC()
+	tsk := &task.Task{
+		ID:        "c1",
+		Type:      task.TypeRun,
+		Plan:      "network",
+		Case:      "ping-pong",
+		CreatedBy: task.CreatedBy{Repo: "org/repo", Branch: "main", Commit: "abc"},
+		States: []task.DatedState{
+			{State: task.StateScheduled, Created: now},
+			{State: task.StateProcessing, Created: now},
+		},
+	}
+
+	check := e.startGithubCheck(tsk)
+	if check == nil || check.id != 42 {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+
+	tsk.Result = &runner.Result{
+		Outcome:  task.OutcomeFailure,
+		Outcomes: map[string]*runner.GroupOutcome{"pingers": {Ok: 1, Total: 2}},
+	}
+	tsk.States = append(tsk.States, task.DatedState{State: task.StateComplete, Created: now.Add(time.Minute)})
+	e.completeGithubCheck(tsk, check)
+
+	expected := []string{
+		"POST /app/installations/7/access_tokens",
+		"POST /repos/org/repo/check-runs",
+		"POST /app/installations/7/access_tokens",
+		"PATCH /repos/org/repo/check-runs/42",
+		"GET /repos/org/repo/commits/abc/pulls",
+		"POST /repos/org/repo/issues/3/comments",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected calls:\n%s", strings.Join(calls, "\n"))
+	}
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/docker"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+// hookAnalysisDir is the directory, under the outputs of a run, where the
+// post-run hook writes its results.
+const hookAnalysisDir = "_analysis"
+
+// runPreBuildHook runs the pre-build hook of a plan in its build context, if
+// the manifest declares one.
+func (e *Engine) runPreBuildHook(ctx context.Context, manifest *api.TestPlanManifest, buildID, builder string, src *api.UnpackedSources, ow *rpc.OutputWriter) error {
+	hook := manifest.Hooks.PreBuild
+	if hook == nil {
+		return nil
+	}
+
+	ow.Infow("running pre-build hook", "plan", manifest.Name, "image", hook.Image)
+	mounts := []mount.Mount{{
+		Type:   mount.TypeBind,
+		Source: src.BaseDir,
+		Target: "/src",
+	}}
+	env := map[string]string{
+		"TEST_PLAN":    manifest.Name,
+		"TEST_BUILDER": builder,
+	}
+	if err := runHook(ctx, hook, "tg-hook-prebuild-"+buildID, "/src/plan", mounts, env, ow); err != nil {
+		return fmt.Errorf("pre-build hook failed: %w", err)
+	}
+	return nil
+}
+
+// runPostRunHook runs the post-run hook of a plan over the outputs of a run,
+// if the manifest declares one. Its results are written next to the outputs
+// of the run, so that they're collected, and archived, with them. It's only
+// bounded by its own timeout, not by the context of the run, which may be
+// done by then, e.g. when the run timed out.
+func (e *Engine) runPostRunHook(manifest *api.TestPlanManifest, id, plan, tcase, trunner string, outcome task.Outcome, ow *rpc.OutputWriter) error {
+	hook := manifest.Hooks.PostRun
+	if hook == nil {
+		return nil
+	}
+
+	loc, ok := e.runners[trunner].(api.OutputsLocator)
+	if !ok {
+		return fmt.Errorf("runner %s doesn't keep the outputs of runs on the daemon", trunner)
+	}
+	dir := loc.RunOutputsDir(e.envcfg, clean(plan), id)
+	analysis := filepath.Join(dir, hookAnalysisDir)
+	if err := os.MkdirAll(analysis, 0755); err != nil {
+		return err
+	}
+
+	ow.Infow("running post-run hook", "plan", plan, "run_id", id, "image", hook.Image)
+	mounts := []mount.Mount{{
+		Type:     mount.TypeBind,
+		Source:   dir,
+		Target:   "/outputs",
+		ReadOnly: true,
+	}, {
+		Type:   mount.TypeBind,
+		Source: analysis,
+		Target: "/analysis",
+	}}
+	env := map[string]string{
+		"TEST_PLAN":    plan,
+		"TEST_CASE":    tcase,
+		"TEST_RUN":     id,
+		"TEST_OUTCOME": string(outcome),
+	}
+	if err := runHook(e.Context(), hook, "tg-hook-postrun-"+id, "/analysis", mounts, env, ow); err != nil {
+		return fmt.Errorf("post-run hook failed: %w", err)
+	}
+	return nil
+}
+
+// runHook runs a hook container to completion, relaying its output, and
+// removes it. Containers left behind with the same name, e.g. by a daemon
+// that stopped midway, are removed first, rather than reused.
+func runHook(ctx context.Context, hook *api.Hook, name, workdir string, mounts []mount.Mount, vars map[string]string, ow *rpc.OutputWriter) error {
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+	timeout, _ := hook.ParseTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	stale, err := docker.CheckContainer(ctx, ow, cli, name)
+	if err != nil {
+		return err
+	}
+	if stale != nil {
+		ow.Infow("removing stale hook container", "id", stale.ID)
+		if err := cli.ContainerRemove(ctx, stale.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			return fmt.Errorf("failed to remove stale hook container: %w", err)
+		}
+	}
+
+	c, _, err := docker.EnsureContainerStarted(ctx, ow, cli, &docker.EnsureContainerOpts{
+		ContainerName: name,
+		ContainerConfig: &container.Config{
+			Image:      hook.Image,
+			Cmd:        hook.Command,
+			Env:        hook.EnvList(vars),
+			WorkingDir: workdir,
+		},
+		HostConfig: &container.HostConfig{
+			Mounts: mounts,
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start hook container: %w", err)
+	}
+
+	defer func() {
+		if err := cli.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			ow.Warnw("failed to remove hook container", "id", c.ID, "error", err)
+		}
+	}()
+
+	stream, err := cli.ContainerLogs(ctx, c.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to hook container: %w", err)
+	}
+	defer stream.Close()
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		_, _ = stdcopy.StdCopy(ow.StdoutWriter(), ow.StdoutWriter(), stream)
+	}()
+
+	statusCh, errCh := cli.ContainerWait(ctx, c.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		err = fmt.Errorf("failed while waiting for hook container: %w", err)
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			err = fmt.Errorf("hook exited with code %d", status.StatusCode)
+		}
+	}
+
+	// make sure we've relayed all the output before returning.
+	<-copied
+	return err
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// ErrLimitExceeded is returned for runs exceeding the limits of the daemon.
+var ErrLimitExceeded = errors.New("run exceeds the limits of the daemon")
+
+// limitsPollInterval is how often runs waiting for instances to be freed
+// check again.
+const limitsPollInterval = time.Second
+
+// limits enforces the guardrails configured in the daemon on runs. A nil
+// *limits enforces none.
+type limits struct {
+	cfgs      []config.LimitsConfig
+	durations []time.Duration
+
+	lk sync.Mutex
+	// inFlight counts the instances of the runs in progress matching each
+	// limit.
+	inFlight []int
+}
+
+func newLimits(cfgs []config.LimitsConfig) (*limits, error) {
+	l := &limits{
+		cfgs:      cfgs,
+		durations: make([]time.Duration, len(cfgs)),
+		inFlight:  make([]int, len(cfgs)),
+	}
+	for i, c := range cfgs {
+		if c.MaxInstances < 0 || c.MaxConcurrentInstances < 0 {
+			return nil, fmt.Errorf("invalid limits: negative number of instances")
+		}
+		if c.MaxDuration == "" {
+			continue
+		}
+		d, err := time.ParseDuration(c.MaxDuration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid limits: max_duration %q", c.MaxDuration)
+		}
+		l.durations[i] = d
+	}
+	return l, nil
+}
+
+// matching returns the indices of the limits applying to the runs of a runner
+// created by a user.
+func (l *limits) matching(runner, user string) []int {
+	if l == nil {
+		return nil
+	}
+	var ret []int
+	for i, c := range l.cfgs {
+		if (c.Runner == "" || c.Runner == runner) && (c.User == "" || c.User == user) {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// describe names the runs a limit applies to, for error messages.
+func (l *limits) describe(i int) string {
+	c := l.cfgs[i]
+	switch {
+	case c.Runner != "" && c.User != "":
+		return fmt.Sprintf("runner %s and user %s", c.Runner, c.User)
+	case c.Runner != "":
+		return "runner " + c.Runner
+	case c.User != "":
+		return "user " + c.User
+	default:
+		return "all runs"
+	}
+}
+
+// check rejects runs that exceed the limits whatever the load of the daemon.
+func (l *limits) check(runner, user string, instances int) error {
+	for _, i := range l.matching(runner, user) {
+		c := l.cfgs[i]
+		if c.MaxInstances > 0 && instances > c.MaxInstances {
+			return fmt.Errorf("%w: %d instances, but %s are limited to %d instances per run", ErrLimitExceeded, instances, l.describe(i), c.MaxInstances)
+		}
+		if c.MaxConcurrentInstances > 0 && instances > c.MaxConcurrentInstances {
+			return fmt.Errorf("%w: %d instances, but %s are limited to %d concurrent instances", ErrLimitExceeded, instances, l.describe(i), c.MaxConcurrentInstances)
+		}
+	}
+	return nil
+}
+
+// maxDuration returns the shortest maximum duration of the limits applying to
+// a run, or zero if there is none.
+func (l *limits) maxDuration(runner, user string) time.Duration {
+	var ret time.Duration
+	for _, i := range l.matching(runner, user) {
+		if d := l.durations[i]; d > 0 && (ret == 0 || d < ret) {
+			ret = d
+		}
+	}
+	return ret
+}
+
+// tryAcquire reserves the instances of a run against the concurrency limits
+// applying to it, if they all have room for them.
+func (l *limits) tryAcquire(matching []int, instances int) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	for _, i := range matching {
+		if max := l.cfgs[i].MaxConcurrentInstances; max > 0 && l.inFlight[i]+instances > max {
+			return false
+		}
+	}
+	for _, i := range matching {
+		l.inFlight[i] += instances
+	}
+	return true
+}
+
+func (l *limits) release(matching []int, instances int) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	for _, i := range matching {
+		l.inFlight[i] -= instances
+	}
+}
+
+// acquire waits until the instances of a run fit within the concurrency
+// limits applying to it, and reserves them. The returned function releases
+// them once the run is done.
+func (l *limits) acquire(ctx context.Context, runner, user string, instances int, ow *rpc.OutputWriter) (func(), error) {
+	if err := l.check(runner, user, instances); err != nil {
+		return nil, err
+	}
+
+	matching := l.matching(runner, user)
+	if len(matching) == 0 {
+		return func() {}, nil
+	}
+	if !l.tryAcquire(matching, instances) {
+		ow.Infow("waiting for instances of other runs to be freed", "instances", instances)
+
+		ticker := time.NewTicker(limitsPollInterval)
+		defer ticker.Stop()
+		for !l.tryAcquire(matching, instances) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+	return func() { l.release(matching, instances) }, nil
+}
+
+// applyRunLimits enforces the limits of the daemon on a run about to start:
+// it waits for the instances of the run to fit within the concurrency limits,
+// and bounds its duration. The returned function must be called once the run
+// is done.
+func (e *Engine) applyRunLimits(ctx context.Context, in *api.RunInput, runner, user string, ow *rpc.OutputWriter) (context.Context, func(), error) {
+	release, err := e.limits.acquire(ctx, runner, user, in.TotalInstances, ow)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := e.limits.maxDuration(runner, user)
+	if d == 0 {
+		return ctx, release, nil
+	}
+
+	ow.Infow("run duration is limited", "max_duration", d)
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return ctx, func() {
+		cancel()
+		release()
+	}, nil
+}
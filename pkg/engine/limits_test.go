@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	l, err := newLimits([]config.LimitsConfig{
+		{Runner: "cluster:k8s", MaxInstances: 100, MaxDuration: "1h"},
+		{User: "alice", MaxInstances: 10, MaxDuration: "10m"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, l.check("cluster:k8s", "bob", 100))
+	require.True(t, errors.Is(l.check("cluster:k8s", "bob", 100000), ErrLimitExceeded))
+	require.True(t, errors.Is(l.check("local:docker", "alice", 11), ErrLimitExceeded))
+	require.NoError(t, l.check("local:docker", "bob", 100000))
+
+	require.Equal(t, time.Hour, l.maxDuration("cluster:k8s", "bob"))
+	require.Equal(t, 10*time.Minute, l.maxDuration("cluster:k8s", "alice"))
+	require.Zero(t, l.maxDuration("local:docker", "bob"))
+
+	_, err = newLimits([]config.LimitsConfig{{MaxDuration: "forever"}})
+	require.Error(t, err)
+
+	// a nil *limits enforces none.
+	var none *limits
+	require.NoError(t, none.check("cluster:k8s", "bob", 100000))
+	release, err := none.acquire(context.Background(), "cluster:k8s", "bob", 100000, nil)
+	require.NoError(t, err)
+	release()
+}
+
+func TestLimitsConcurrentInstances(t *testing.T) {
+	l, err := newLimits([]config.LimitsConfig{{Runner: "cluster:k8s", MaxConcurrentInstances: 10}})
+	require.NoError(t, err)
+	ow := rpc.Discard()
+
+	// runs that can never fit are rejected.
+	_, err = l.acquire(context.Background(), "cluster:k8s", "", 11, ow)
+	require.True(t, errors.Is(err, ErrLimitExceeded))
+
+	release, err := l.acquire(context.Background(), "cluster:k8s", "", 8, ow)
+	require.NoError(t, err)
+
+	// runs that don't fit yet wait for instances to be freed.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "cluster:k8s", "", 4, ow)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	acquired := make(chan func())
+	go func() {
+		r, err := l.acquire(context.Background(), "cluster:k8s", "", 4, ow)
+		if err == nil {
+			acquired <- r
+		}
+	}()
+	release()
+
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not start once instances were freed")
+	}
+}
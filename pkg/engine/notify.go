@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// Events notification targets can subscribe to.
+const (
+	NotifyOnProcessing = "processing"
+	NotifyOnComplete   = "complete"
+	NotifyOnFailure    = "failure"
+)
+
+// notification is the payload delivered to notification targets when a task
+// changes state.
+type notification struct {
+	TaskID     string         `json:"task_id"`
+	Type       task.Type      `json:"type"`
+	Name       string         `json:"name"`
+	State      task.State     `json:"state"`
+	Outcome    task.Outcome   `json:"outcome,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	CreatedBy  task.CreatedBy `json:"created_by"`
+	Took       string         `json:"took,omitempty"`
+	LogsURL    string         `json:"logs_url"`
+	OutputsURL string         `json:"outputs_url,omitempty"`
+}
+
+// newNotification snapshots the current state of a task into a notification.
+func (e *Engine) newNotification(tsk *task.Task) *notification {
+	root := strings.TrimSuffix(e.envcfg.Daemon.RootURL, "/")
+
+	n := &notification{
+		TaskID:    tsk.ID,
+		Type:      tsk.Type,
+		Name:      tsk.Name(),
+		State:     tsk.State().State,
+		Error:     tsk.Error,
+		CreatedBy: tsk.CreatedBy,
+		LogsURL:   fmt.Sprintf("%s/logs?task_id=%s", root, tsk.ID),
+	}
+
+	if n.State == task.StateProcessing {
+		return n
+	}
+
+	n.Took = tsk.Took().String()
+	n.Outcome = taskOutcome(tsk)
+	if tsk.Type == task.TypeRun {
+		n.OutputsURL = fmt.Sprintf("%s/outputs?run_id=%s", root, tsk.ID)
+	}
+	return n
+}
+
+// taskOutcome returns the outcome of a task in a terminal state.
+func taskOutcome(tsk *task.Task) task.Outcome {
+	switch {
+	case tsk.IsCanceled():
+		return task.OutcomeCanceled
+	case tsk.Error != "":
+		return task.OutcomeFailure
+	}
+	if res, ok := tsk.Result.(*runner.Result); ok {
+		return res.Outcome
+	}
+	return task.OutcomeSuccess
+}
+
+// wants returns whether a target subscribed to the supplied events should be
+// notified of this notification.
+func (n *notification) wants(on []string) bool {
+	if len(on) == 0 {
+		on = []string{NotifyOnComplete}
+	}
+	for _, ev := range on {
+		switch {
+		case ev == NotifyOnProcessing && n.State == task.StateProcessing:
+			return true
+		case ev == NotifyOnComplete && n.State != task.StateProcessing:
+			return true
+		case ev == NotifyOnFailure && n.State != task.StateProcessing && n.Outcome != task.OutcomeSuccess:
+			return true
+		}
+	}
+	return false
+}
+
+// notify delivers a notification of the current state of a task to the
+// configured targets that are interested in it, and to the per-task webhook
+// on terminal states. Delivery happens in the background; failures are
+// logged.
+func (e *Engine) notify(tsk *task.Task) {
+	n := e.newNotification(tsk)
+
+	var targets []config.NotificationConfig
+	for _, t := range e.envcfg.Daemon.Notifications {
+		if len(t.Users) > 0 && !stringInSlice(n.CreatedBy.User, t.Users) {
+			continue
+		}
+		if n.wants(t.On) {
+			targets = append(targets, t)
+		}
+	}
+	if u := taskNotifyURL(tsk); u != "" && n.wants(nil) {
+		// tasks queued before the allowed URLs changed are checked again.
+		if err := checkNotifyURL(e.envcfg.Daemon.NotifyURLs, u); err != nil {
+			logging.S().Warnw("not delivering notification", "task_id", n.TaskID, "err", err)
+		} else {
+			targets = append(targets, config.NotificationConfig{Type: "webhook", URL: u})
+		}
+	}
+
+	for _, t := range targets {
+		go func(t config.NotificationConfig) {
+			if err := deliverNotification(t, n); err != nil {
+				logging.S().Warnw("could not deliver notification", "type", t.Type, "task_id", n.TaskID, "err", err)
+			}
+		}(t)
+	}
+}
+
+// checkNotifyURL checks that a webhook requested by the creator of a task is
+// allowed by the daemon, i.e. that it has the scheme and host of one of the
+// allowed URLs, and a path under it, so that clients can't have the daemon
+// post to arbitrary hosts, e.g. internal services.
+func checkNotifyURL(allowed []string, notifyURL string) error {
+	if notifyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(notifyURL)
+	if err != nil {
+		return fmt.Errorf("invalid notify url %q: %w", notifyURL, err)
+	}
+	for _, a := range allowed {
+		au, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		// compare whole segments, so that /hooks doesn't allow /hooksevil.
+		prefix := au.Path
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if u.Scheme == au.Scheme && u.User == nil && strings.EqualFold(u.Host, au.Host) && strings.HasPrefix(path.Clean("/"+u.Path)+"/", prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("notify url %q is not allowed by the daemon; see notify_urls", notifyURL)
+}
+
+// taskNotifyURL returns the webhook requested by the creator of a task, if
+// any.
+func taskNotifyURL(tsk *task.Task) string {
+	switch in := tsk.Input.(type) {
+	case *RunInput:
+		if in.RunRequest != nil {
+			return in.NotifyURL
+		}
+	case *BuildInput:
+		if in.BuildRequest != nil {
+			return in.NotifyURL
+		}
+	}
+	return ""
+}
+
+func deliverNotification(t config.NotificationConfig, n *notification) error {
+	switch t.Type {
+	case "slack":
+		payload, err := json.Marshal(map[string]string{"text": n.text()})
+		if err != nil {
+			return err
+		}
+		return postNotification(t.URL, payload)
+	case "webhook":
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		return postNotification(t.URL, payload)
+	case "email":
+		var auth smtp.Auth
+		if t.SMTPUser != "" {
+			host := strings.Split(t.SMTPAddr, ":")[0]
+			auth = smtp.PlainAuth("", t.SMTPUser, t.SMTPPassword, host)
+		}
+		msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [testground] %s\r\n\r\n%s\r\n",
+			t.From, strings.Join(t.To, ", "), n.summary(), n.text())
+		return smtp.SendMail(t.SMTPAddr, auth, t.From, t.To, []byte(msg))
+	default:
+		return fmt.Errorf("unknown notification type: %s", t.Type)
+	}
+}
+
+func postNotification(url string, payload []byte) error {
+	cl := &http.Client{
+		Timeout: time.Second * 10,
+		// don't follow redirects, which could lead outside of the allowed
+		// urls; they're reported as unexpected status codes.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := cl.Post(url, "application/json; charset=UTF-8", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// summary returns a one-line description of the notification.
+func (n *notification) summary() string {
+	if n.State == task.StateProcessing {
+		return fmt.Sprintf("%s task %s (%s) started", n.Type, n.TaskID, n.Name)
+	}
+	return fmt.Sprintf("%s task %s (%s) %s", n.Type, n.TaskID, n.Name, n.Outcome)
+}
+
+// text returns a human-readable description of the notification.
+func (n *notification) text() string {
+	var b strings.Builder
+	b.WriteString(n.summary())
+	if n.Took != "" {
+		fmt.Fprintf(&b, " after %s", n.Took)
+	}
+	if n.Error != "" {
+		fmt.Fprintf(&b, "\nerror: %s", n.Error)
+	}
+	fmt.Fprintf(&b, "\nlogs: %s", n.LogsURL)
+	if n.OutputsURL != "" {
+		fmt.Fprintf(&b, "\noutputs: %s", n.OutputsURL)
+	}
+	return b.String()
+}
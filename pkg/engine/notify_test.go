@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestNotifyFailure(t *testing.T) {
+	got := make(chan notification, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		got <- n
+	}))
+	defer srv.Close()
+
+	cfg := &config.EnvConfig{}
+	cfg.Daemon.RootURL = "https://tg.example.com/"
+	cfg.Daemon.Notifications = []config.NotificationConfig{
+		{Type: "webhook", URL: srv.URL, On: []string{NotifyOnFailure}},
+		{Type: "webhook", URL: srv.URL, Users: []string{"someone-else"}},
+	}
+	e := &Engine{envcfg: cfg}
+
+	now := time.Now().UTC()
+	tsk := &task.Task{
+		ID:        "c1",
+		Type:      task.TypeRun,
+		Plan:      "network",
+		Case:      "ping-pong",
+		CreatedBy: task.CreatedBy{User: "alice"},
+		Input:     &RunInput{RunRequest: &api.RunRequest{}},
+		States:    []task.DatedState{{State: task.StateScheduled, Created: now}},
+	}
+
+	// processing is not subscribed to.
+	tsk.States = append(tsk.States, task.DatedState{State: task.StateProcessing, Created: now})
+	e.notify(tsk)
+
+	tsk.Error = "boom"
+	tsk.States = append(tsk.States, task.DatedState{State: task.StateCanceled, Created: now.Add(time.Minute)})
+	e.notify(tsk)
+
+	select {
+	case n := <-got:
+		if n.TaskID != "c1" || n.Outcome != task.OutcomeCanceled || n.Error != "boom" {
+			t.Fatalf("unexpected notification: %+v", n)
+		}
+		if n.LogsURL != "https://tg.example.com/logs?task_id=c1" {
+			t.Fatalf("unexpected logs url: %s", n.LogsURL)
+		}
+		if n.OutputsURL != "https://tg.example.com/outputs?run_id=c1" {
+			t.Fatalf("unexpected outputs url: %s", n.OutputsURL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not delivered")
+	}
+
+	select {
+	case n := <-got:
+		t.Fatalf("unexpected extra notification: %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCheckNotifyURL(t *testing.T) {
+	allowed := []string{"https://ci.example.com/hooks/"}
+
+	for _, u := range []string{"", "https://ci.example.com/hooks/build-1", "https://CI.example.com/hooks/"} {
+		if err := checkNotifyURL(allowed, u); err != nil {
+			t.Errorf("%q: unexpected error: %s", u, err)
+		}
+	}
+	for _, u := range []string{
+		"http://ci.example.com/hooks/build-1",
+		"https://ci.example.com/other",
+		"https://ci.example.com/hooks/../admin",
+		"https://ci.example.com.evil.com/hooks/",
+		"https://ci.example.com@169.254.169.254/hooks/",
+		"https://user@ci.example.com/hooks/",
+		"http://localhost:8042/tasks",
+	} {
+		if err := checkNotifyURL(allowed, u); err == nil {
+			t.Errorf("%q: expected an error", u)
+		}
+	}
+
+	// allowed urls without a trailing slash only allow paths under them.
+	allowed = []string{"https://ci.example.com/hooks"}
+	if err := checkNotifyURL(allowed, "https://ci.example.com/hooks/build-1"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := checkNotifyURL(allowed, "https://ci.example.com/hooksevil"); err == nil {
+		t.Error("expected an error")
+	}
+
+	// without allowed urls, none is.
+	if err := checkNotifyURL(nil, "https://ci.example.com/hooks/"); err == nil {
+		t.Error("expected an error")
+	}
+}
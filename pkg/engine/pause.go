@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+// pausableTimeout is a context canceled once its timeout has elapsed, like a
+// context with a deadline, except that its clock stops while it's paused. It
+// bounds the processing of tasks, so that the time runs spend paused isn't
+// counted against the task timeout.
+type pausableTimeout struct {
+	parent context.Context
+	done   chan struct{}
+
+	lk        sync.Mutex
+	err       error
+	timer     *time.Timer
+	remaining time.Duration
+	started   time.Time
+	paused    bool
+	// resumed is closed when the timeout is resumed; nil unless paused.
+	resumed chan struct{}
+}
+
+var _ context.Context = (*pausableTimeout)(nil)
+
+// withPausableTimeout returns a context canceled when parent is, or once d
+// has elapsed while not paused, with context.DeadlineExceeded.
+func withPausableTimeout(parent context.Context, d time.Duration) (*pausableTimeout, context.CancelFunc) {
+	t := &pausableTimeout{
+		parent:    parent,
+		done:      make(chan struct{}),
+		remaining: d,
+		started:   time.Now(),
+	}
+	t.timer = time.AfterFunc(d, t.expire)
+
+	go func() {
+		select {
+		case <-parent.Done():
+			t.finish(parent.Err())
+		case <-t.done:
+		}
+	}()
+
+	return t, func() { t.finish(context.Canceled) }
+}
+
+func (t *pausableTimeout) expire() {
+	t.finish(context.DeadlineExceeded)
+}
+
+func (t *pausableTimeout) finish(err error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if t.err != nil {
+		return
+	}
+	t.err = err
+	t.timer.Stop()
+	close(t.done)
+}
+
+// pause stops the clock of the timeout.
+func (t *pausableTimeout) pause() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if t.paused || t.err != nil {
+		return
+	}
+	t.paused = true
+	t.resumed = make(chan struct{})
+	if t.timer.Stop() {
+		t.remaining -= time.Since(t.started)
+	}
+}
+
+// resume restarts the clock of the timeout, with the time that was remaining
+// when it was paused.
+func (t *pausableTimeout) resume() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if !t.paused || t.err != nil {
+		return
+	}
+	t.paused = false
+	close(t.resumed)
+	t.resumed = nil
+	t.started = time.Now()
+	t.timer = time.AfterFunc(t.remaining, t.expire)
+}
+
+// waitResumed blocks while the timeout is paused, until it's resumed or ctx
+// is done. It reports whether the timeout was paused.
+func (t *pausableTimeout) waitResumed(ctx context.Context) bool {
+	t.lk.Lock()
+	resumed := t.resumed
+	t.lk.Unlock()
+
+	if resumed == nil {
+		return false
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// Deadline returns no deadline: it moves while the timeout is paused.
+func (t *pausableTimeout) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (t *pausableTimeout) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *pausableTimeout) Err() error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.err
+}
+
+func (t *pausableTimeout) Value(key interface{}) interface{} {
+	return t.parent.Value(key)
+}
+
+func (e *Engine) addTimeout(id string, t *pausableTimeout) {
+	e.timeoutsLk.Lock()
+	defer e.timeoutsLk.Unlock()
+
+	if e.timeouts == nil {
+		e.timeouts = make(map[string]*pausableTimeout)
+	}
+	e.timeouts[id] = t
+}
+
+func (e *Engine) deleteTimeout(id string) {
+	e.timeoutsLk.Lock()
+	delete(e.timeouts, id)
+	e.timeoutsLk.Unlock()
+}
+
+func (e *Engine) timeout(id string) *pausableTimeout {
+	e.timeoutsLk.Lock()
+	defer e.timeoutsLk.Unlock()
+	return e.timeouts[id]
+}
+
+// DoPauseRun suspends the instances of a run in progress, and stops the clock
+// of its task timeout, and its churn, until it's resumed.
+func (e *Engine) DoPauseRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
+	p, input, timeout, err := e.pauserFor(runID)
+	if err != nil {
+		return err
+	}
+	if err := p.PauseRun(ctx, input, ow); err != nil {
+		return err
+	}
+	timeout.pause()
+	ow.Infow("run paused", "run_id", runID)
+	return nil
+}
+
+// DoResumeRun resumes the instances of a paused run, and restarts the clock of
+// its task timeout.
+func (e *Engine) DoResumeRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
+	p, input, timeout, err := e.pauserFor(runID)
+	if err != nil {
+		return err
+	}
+	if err := p.ResumeRun(ctx, input, ow); err != nil {
+		return err
+	}
+	timeout.resume()
+	ow.Infow("run resumed", "run_id", runID)
+	return nil
+}
+
+// pauserFor returns the runner of a run in progress on this daemon, if it
+// can pause runs, along with its input and the timeout of the task.
+func (e *Engine) pauserFor(runID string) (api.Pauser, *api.PauseInput, *pausableTimeout, error) {
+	id, run, timeout, err := e.liveRunner(runID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p, ok := run.(api.Pauser)
+	if !ok {
+		var pausers []string
+		for name, r := range e.runners {
+			if _, ok := r.(api.Pauser); ok {
+				pausers = append(pausers, name)
+			}
+		}
+		sort.Strings(pausers)
+		return nil, nil, nil, fmt.Errorf("runner %s does not support pausing runs; only %s do", id, strings.Join(pausers, ", "))
+	}
+
+	obj, err := e.runnerConfig(id, run)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	input := &api.PauseInput{
+		EnvConfig:    e.EnvConfig(),
+		RunID:        runID,
+		RunnerConfig: obj,
+	}
+	return p, input, timeout, nil
+}
+
+// liveRunner returns the ID and the runner of a run in progress on this
+// daemon, along with the timeout of its task.
+func (e *Engine) liveRunner(runID string) (string, api.Runner, *pausableTimeout, error) {
+	t, err := e.GetTask(runID)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("could not get task %s: %s", runID, err.Error())
+	}
+	if t.Type != task.TypeRun {
+		return "", nil, nil, fmt.Errorf("task %s is not a run", runID)
+	}
+
+	timeout := e.timeout(runID)
+	if timeout == nil {
+		return "", nil, nil, fmt.Errorf("run %s is not in progress on this daemon", runID)
+	}
+
+	run, ok := e.runners[t.Runner]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("unknown runner: %s", t.Runner)
+	}
+	return t.Runner, run, timeout, nil
+}
+
+// runnerConfig returns the configuration of a runner, coalesced with the env
+// configuration.
+func (e *Engine) runnerConfig(id string, run api.Runner) (interface{}, error) {
+	var cfg config.CoalescedConfig
+	cfg = cfg.Append(e.EnvConfig().Runners[id])
+
+	obj, err := cfg.CoalesceIntoType(run.ConfigType())
+	if err != nil {
+		return nil, fmt.Errorf("error while coalescing configuration values: %w", err)
+	}
+	return obj, nil
+}
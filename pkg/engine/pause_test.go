@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestPausableTimeout(t *testing.T) {
+	ctx, cancel := withPausableTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the clock stops while paused.
+	ctx.pause()
+	select {
+	case <-ctx.Done():
+		t.Fatal("timeout expired while paused")
+	case <-time.After(400 * time.Millisecond):
+	}
+	require.NoError(t, ctx.Err())
+
+	ctx.resume()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout did not expire once resumed")
+	}
+	require.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	// contexts derived from it see the timeout too.
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+	<-child.Done()
+	require.Equal(t, context.DeadlineExceeded, child.Err())
+}
+
+func TestPausableTimeoutCanceled(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := withPausableTimeout(parent, time.Hour)
+	defer cancel()
+
+	cancelParent()
+	<-ctx.Done()
+	require.Equal(t, context.Canceled, ctx.Err())
+}
+
+func TestPausableTimeoutWaitResumed(t *testing.T) {
+	ctx, cancel := withPausableTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	require.False(t, ctx.waitResumed(context.Background()))
+
+	ctx.pause()
+	done := make(chan bool)
+	go func() { done <- ctx.waitResumed(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("waitResumed returned while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ctx.resume()
+	require.True(t, <-done)
+	require.False(t, ctx.waitResumed(context.Background()))
+}
+
+// fakePauser records the runs it pauses and resumes.
+type fakePauser struct {
+	api.Runner
+	paused []string
+}
+
+func (f *fakePauser) ConfigType() reflect.Type {
+	return reflect.TypeOf(struct{}{})
+}
+
+func (f *fakePauser) PauseRun(_ context.Context, in *api.PauseInput, _ *rpc.OutputWriter) error {
+	f.paused = append(f.paused, in.RunID)
+	return nil
+}
+
+func (f *fakePauser) ResumeRun(_ context.Context, in *api.PauseInput, _ *rpc.OutputWriter) error {
+	f.paused = f.paused[:len(f.paused)-1]
+	return nil
+}
+
+func TestPauseRun(t *testing.T) {
+	p := &fakePauser{}
+	e := newSchedulerEngine(t)
+	e.runners = map[string]api.Runner{"local:docker": p}
+
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		Runner: "local:docker",
+		States: []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	// the run isn't being processed yet.
+	require.Error(t, e.DoPauseRun(context.Background(), tsk.ID, rpc.Discard()))
+
+	ctx, cancel := withPausableTimeout(context.Background(), time.Hour)
+	defer cancel()
+	e.addTimeout(tsk.ID, ctx)
+
+	require.NoError(t, e.DoPauseRun(context.Background(), tsk.ID, rpc.Discard()))
+	require.Equal(t, []string{tsk.ID}, p.paused)
+	require.True(t, ctx.paused)
+
+	require.NoError(t, e.DoResumeRun(context.Background(), tsk.ID, rpc.Discard()))
+	require.Empty(t, p.paused)
+	require.False(t, ctx.paused)
+
+	// runners that can't pause runs are reported, along with those that can.
+	e.runners["local:docker"] = &fakeUpgrader{}
+	e.runners["local:exec"] = p
+	err := e.DoPauseRun(context.Background(), tsk.ID, rpc.Discard())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only local:exec do")
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// phaseReporter records the phases a task goes through, persisting the task
+// whenever it enters a new one, so that a long processing task shows whether
+// it's building, launching instances or running. A nil reporter discards all
+// updates.
+type phaseReporter struct {
+	lk  sync.Mutex
+	tsk *task.Task
+	src taskSource
+}
+
+var _ api.PhaseReporter = (*phaseReporter)(nil)
+
+func newPhaseReporter(tsk *task.Task, src taskSource) *phaseReporter {
+	return &phaseReporter{tsk: tsk, src: src}
+}
+
+// EnterPhase ends the current phase of the task and starts the supplied one.
+// Entering the current phase again is a no-op.
+func (r *phaseReporter) EnterPhase(phase task.Phase) {
+	if r == nil {
+		return
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	now := time.Now().UTC()
+	if p := r.tsk.Phase(); p != nil && p.Ended.IsZero() {
+		if p.Phase == phase {
+			return
+		}
+		p.Ended = now
+	}
+	r.tsk.Phases = append(r.tsk.Phases, task.DatedPhase{Phase: phase, Started: now})
+	r.persist()
+}
+
+// end ends the current phase of the task, if any. The task is persisted by
+// the caller, along with its final state.
+func (r *phaseReporter) end() {
+	if r == nil {
+		return
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if p := r.tsk.Phase(); p != nil && p.Ended.IsZero() {
+		p.Ended = time.Now().UTC()
+	}
+}
+
+func (r *phaseReporter) persist() {
+	if err := r.src.Persist(r.tsk); err != nil {
+		logging.S().Warnw("could not persist task phase", "task_id", r.tsk.ID, "err", err)
+	}
+}
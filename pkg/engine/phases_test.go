@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestPhaseReporter(t *testing.T) {
+	e := newSchedulerEngine(t)
+
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ef0",
+		Type:   task.TypeRun,
+		States: []task.DatedState{{State: task.StateProcessing, Created: time.Now().UTC()}},
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	r := newPhaseReporter(tsk, e.local)
+
+	r.EnterPhase(task.PhaseLaunch)
+	r.EnterPhase(task.PhaseLaunch)
+	r.EnterPhase(task.PhaseRun)
+
+	// the phases are persisted as they're entered.
+	got, err := e.store.Get(tsk.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Phases, 2)
+	require.Equal(t, task.PhaseLaunch, got.Phases[0].Phase)
+	require.False(t, got.Phases[0].Ended.IsZero())
+	require.Equal(t, task.PhaseRun, got.Phase().Phase)
+	require.True(t, got.Phase().Ended.IsZero())
+
+	r.end()
+	require.False(t, tsk.Phase().Ended.IsZero())
+
+	// runs report their phases through their input, even when not tracked.
+	in := &api.RunInput{Phases: r}
+	in.EnterPhase(task.PhaseCleanup)
+	require.Equal(t, task.PhaseCleanup, tsk.Phase().Phase)
+
+	in = &api.RunInput{}
+	in.EnterPhase(task.PhaseCleanup)
+
+	var nilReporter *phaseReporter
+	nilReporter.EnterPhase(task.PhaseRun)
+	nilReporter.end()
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/otiai10/copy"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+)
+
+// latestPlanVersion resolves to the most recently published version of a
+// plan.
+const latestPlanVersion = "latest"
+
+// ErrPlanNotPublished is returned when a plan, or a version of it, hasn't
+// been published.
+var ErrPlanNotPublished = errors.New("plan not published")
+
+// publishedNameRe restricts plan names and versions to single path elements.
+var publishedNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// planRegistryDir is where published plans are kept: the source of each
+// version is under <name>/<version>/plan, along with its plan.json record.
+func (e *Engine) planRegistryDir() string {
+	return filepath.Join(e.envcfg.Dirs().Daemon(), "registry")
+}
+
+func (e *Engine) PublishPlan(request *api.PublishPlanRequest, sources *api.UnpackedSources) (*api.PublishedPlan, error) {
+	if sources == nil || sources.PlanDir == "" {
+		return nil, errors.New("no plan supplied")
+	}
+
+	var manifest api.TestPlanManifest
+	if _, err := toml.DecodeFile(filepath.Join(sources.PlanDir, "manifest.toml"), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse plan manifest: %w", err)
+	}
+	if !publishedNameRe.MatchString(manifest.Name) {
+		return nil, fmt.Errorf("invalid plan name: %q", manifest.Name)
+	}
+	if !publishedNameRe.MatchString(request.Version) || request.Version == latestPlanVersion {
+		return nil, fmt.Errorf("invalid plan version: %q", request.Version)
+	}
+
+	hash, err := hashSources(sources.PlanDir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &api.PublishedPlan{
+		Name:        manifest.Name,
+		Version:     request.Version,
+		PublishedAt: time.Now().UTC(),
+		PublishedBy: request.CreatedBy,
+		SourceHash:  hash,
+		Manifest:    manifest,
+	}
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	e.planRegistryLk.Lock()
+	defer e.planRegistryLk.Unlock()
+
+	dir := filepath.Join(e.planRegistryDir(), plan.Name, plan.Version)
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("version %s of plan %s has already been published", plan.Version, plan.Name)
+	}
+
+	// publish atomically, so that half-published versions are never seen.
+	// Versions can't start with a dot, so the temporary directory can't be
+	// taken for one, e.g. a version named after it.
+	tmp := filepath.Join(filepath.Dir(dir), "."+plan.Version)
+	_ = os.RemoveAll(tmp)
+	err = copy.Copy(sources.PlanDir, filepath.Join(tmp, "plan"))
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(tmp, "plan.json"), b, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dir)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return nil, fmt.Errorf("failed to publish plan: %w", err)
+	}
+
+	logging.S().Infow("plan published", "plan", plan.Name, "version", plan.Version, "source_hash", plan.SourceHash)
+	return plan, nil
+}
+
+func (e *Engine) PublishedPlans(name string) ([]*api.PublishedPlan, error) {
+	names := []string{name}
+	if name == "" {
+		entries, err := ioutil.ReadDir(e.planRegistryDir())
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		names = names[:0]
+		for _, fi := range entries {
+			if fi.IsDir() {
+				names = append(names, fi.Name())
+			}
+		}
+	} else if !publishedNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid plan name: %q", name)
+	}
+
+	var plans []*api.PublishedPlan
+	for _, n := range names {
+		versions, err := e.planVersions(n)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, versions...)
+	}
+	return plans, nil
+}
+
+func (e *Engine) PublishedPlan(name, version string) (*api.PublishedPlan, error) {
+	if !publishedNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid plan name: %q", name)
+	}
+
+	if version != latestPlanVersion {
+		if !publishedNameRe.MatchString(version) {
+			return nil, fmt.Errorf("invalid plan version: %q", version)
+		}
+		return e.loadPublishedPlan(name, version)
+	}
+
+	versions, err := e.planVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPlanNotPublished, name)
+	}
+	return versions[len(versions)-1], nil
+}
+
+// planVersions returns the published versions of a plan, oldest first.
+func (e *Engine) planVersions(name string) ([]*api.PublishedPlan, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(e.planRegistryDir(), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var plans []*api.PublishedPlan
+	for _, fi := range entries {
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		plan, err := e.loadPublishedPlan(name, fi.Name())
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].PublishedAt.Before(plans[j].PublishedAt)
+	})
+	return plans, nil
+}
+
+func (e *Engine) loadPublishedPlan(name, version string) (*api.PublishedPlan, error) {
+	b, err := ioutil.ReadFile(filepath.Join(e.planRegistryDir(), name, version, "plan.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s@%s", ErrPlanNotPublished, name, version)
+		}
+		return nil, err
+	}
+
+	var plan api.PublishedPlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// copyPublishedPlan copies the source of a published plan into dest, and
+// returns the version that was copied.
+func (e *Engine) copyPublishedPlan(name, version, dest string) (string, error) {
+	plan, err := e.PublishedPlan(name, version)
+	if err != nil {
+		return "", err
+	}
+	src := filepath.Join(e.planRegistryDir(), plan.Name, plan.Version, "plan")
+	if err := copy.Copy(src, dest); err != nil {
+		return "", err
+	}
+	return plan.Version, nil
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestPlanRegistry(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	e := &Engine{envcfg: &config.EnvConfig{}, ctx: context.Background()}
+	require.NoError(t, e.envcfg.Load())
+
+	publish := func(version, content string) (*api.PublishedPlan, error) {
+		base := t.TempDir()
+		plan := filepath.Join(base, "plan")
+		require.NoError(t, os.MkdirAll(plan, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(plan, "manifest.toml"), []byte(`name = "ping"`), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(plan, "main.go"), []byte(content), 0644))
+		return e.PublishPlan(&api.PublishPlanRequest{Version: version}, &api.UnpackedSources{BaseDir: base, PlanDir: plan})
+	}
+
+	p1, err := publish("1.0.0", "package main // v1")
+	require.NoError(t, err)
+	require.Equal(t, "ping", p1.Name)
+	require.NotEmpty(t, p1.SourceHash)
+
+	time.Sleep(10 * time.Millisecond)
+	p2, err := publish("1.1.0", "package main // v2")
+	require.NoError(t, err)
+	require.NotEqual(t, p1.SourceHash, p2.SourceHash)
+
+	// published versions are immutable, and names are confined.
+	_, err = publish("1.0.0", "package main // v3")
+	require.Error(t, err)
+	_, err = publish("../1.0.0", "package main")
+	require.Error(t, err)
+	_, err = publish("latest", "package main")
+	require.Error(t, err)
+
+	// versions ending like temporary directories are versions like others.
+	time.Sleep(10 * time.Millisecond)
+	_, err = publish("1.2.0.tmp", "package main // v3")
+	require.NoError(t, err)
+	_, err = publish(".1.2.0", "package main")
+	require.Error(t, err)
+
+	plans, err := e.PublishedPlans("")
+	require.NoError(t, err)
+	require.Len(t, plans, 3)
+	require.Equal(t, "1.0.0", plans[0].Version)
+
+	latest, err := e.PublishedPlan("ping", "latest")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.0.tmp", latest.Version)
+
+	_, err = e.PublishedPlan("ping", "2.0.0")
+	require.True(t, errors.Is(err, ErrPlanNotPublished))
+
+	// compositions reference published plans as <name>@<version>.
+	var manifest api.TestPlanManifest
+	comp := &api.Composition{Global: api.Global{Plan: "ping@1.0.0"}}
+	sources, err := e.remotePlanSources(context.Background(), "a", comp, nil, &manifest)
+	require.NoError(t, err)
+	require.Equal(t, "ping", manifest.Name)
+
+	b, err := os.ReadFile(filepath.Join(sources.PlanDir, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main // v1", string(b))
+}
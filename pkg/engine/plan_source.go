@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/otiai10/copy"
+)
+
+// planSource is a parsed api.Global.PlanSource.
+type planSource struct {
+	// kind is "git" or "oci".
+	kind string
+	// location is the URL to clone, or the image to pull.
+	location string
+	// ref is the git ref to check out; the default branch if empty.
+	ref string
+	// dir is the slash-separated directory of the plan, within the
+	// repository or image.
+	dir string
+}
+
+// parsePlanSource parses a plan source of the form git+<url>[//<dir>][?ref=<ref>]
+// or oci://<image>[//<dir>].
+func parsePlanSource(s string) (*planSource, error) {
+	switch {
+	case strings.HasPrefix(s, "git+"):
+		u, err := url.Parse(strings.TrimPrefix(s, "git+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan source %q: %w", s, err)
+		}
+		src := &planSource{kind: "git", ref: u.Query().Get("ref")}
+		u.RawQuery = ""
+		if i := strings.Index(u.Path, "//"); i >= 0 {
+			u.Path, src.dir = u.Path[:i], u.Path[i+2:]
+		}
+		src.location = u.String()
+		return src, nil
+
+	case strings.HasPrefix(s, "oci://"):
+		src := &planSource{kind: "oci", location: strings.TrimPrefix(s, "oci://"), dir: "plan"}
+		if i := strings.Index(src.location, "//"); i >= 0 {
+			src.location, src.dir = src.location[:i], src.location[i+2:]
+		}
+		if src.location == "" || src.dir == "" {
+			return nil, fmt.Errorf("invalid plan source %q", s)
+		}
+		return src, nil
+	}
+	return nil, fmt.Errorf("invalid plan source %q: expected git+<url> or oci://<image>", s)
+}
+
+// planSourcesDir is where fetched plan sources are cached.
+func (e *Engine) planSourcesDir() string {
+	return filepath.Join(e.envcfg.Dirs().Work(), "plan-sources")
+}
+
+// fetchPlan fetches the plan from a plan source into dest, and returns the
+// commit or image ID it was fetched at.
+func (e *Engine) fetchPlan(ctx context.Context, s string, dest string) (string, error) {
+	src, err := parsePlanSource(s)
+	if err != nil {
+		return "", err
+	}
+
+	// caches are shared between tasks, but only fetches of the same source
+	// wait on each other.
+	unlock, err := e.lockPlanSource(ctx, src.kind+":"+src.location)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if src.kind == "git" {
+		return e.fetchGitPlan(ctx, src, dest)
+	}
+	return e.fetchOCIPlan(ctx, src, dest)
+}
+
+// lockPlanSource locks the cache of a plan source, and returns the function
+// unlocking it. It gives up once ctx is done.
+func (e *Engine) lockPlanSource(ctx context.Context, key string) (unlock func(), err error) {
+	e.planSourcesLk.Lock()
+	if e.planSourceLocks == nil {
+		e.planSourceLocks = make(map[string]chan struct{})
+	}
+	l, ok := e.planSourceLocks[key]
+	if !ok {
+		l = make(chan struct{}, 1)
+		e.planSourceLocks[key] = l
+	}
+	e.planSourcesLk.Unlock()
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("gave up waiting for the fetch of plan source %s: %w", key, ctx.Err())
+	}
+}
+
+// fetchGitPlan fetches a plan from a git repository. Repositories are cloned
+// once, and fetched from thereafter.
+func (e *Engine) fetchGitPlan(ctx context.Context, src *planSource, dest string) (string, error) {
+	auth, err := e.gitAuth(ctx, src.location)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(e.planSourcesDir(), "git", cacheKey(src.location))
+	r, err := git.PlainOpen(dir)
+	switch err {
+	case nil:
+		err = r.FetchContext(ctx, &git.FetchOptions{
+			Auth:     auth,
+			RefSpecs: []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+			Force:    true,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return "", fmt.Errorf("failed to fetch %s: %w", src.location, err)
+		}
+	case git.ErrRepositoryNotExists:
+		_ = os.RemoveAll(dir)
+		if r, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: src.location, Auth: auth}); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to clone %s: %w", src.location, err)
+		}
+	default:
+		return "", err
+	}
+
+	ref := src.ref
+	if ref == "" {
+		if ref, err = remoteHead(ctx, r, auth); err != nil {
+			return "", err
+		}
+	}
+
+	sha, err := checkoutRef(r, ref)
+	if err != nil {
+		return "", err
+	}
+	if err := copyPlan(dir, src.dir, dest); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// remoteHead returns the default branch of the origin of r.
+func remoteHead(ctx context.Context, r *git.Repository, auth transport.AuthMethod) (string, error) {
+	origin, err := r.Remote("origin")
+	if err != nil {
+		return "", err
+	}
+	refs, err := origin.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote refs: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+	return "", errors.New("failed to determine the default branch of the remote")
+}
+
+// fetchOCIPlan fetches a plan from an OCI image, through the docker daemon.
+// The contents of images are cached by image ID.
+func (e *Engine) fetchOCIPlan(ctx context.Context, src *planSource, dest string) (string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	rc, err := cli.ImagePull(ctx, src.location, types.ImagePullOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", src.location, err)
+	}
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", src.location, err)
+	}
+
+	img, _, err := cli.ImageInspectWithRaw(ctx, src.location)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(e.planSourcesDir(), "oci", cacheKey(img.ID+"//"+src.dir))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := extractImageDir(ctx, cli, img.ID, src.dir, dir); err != nil {
+			return "", fmt.Errorf("failed to extract plan from %s: %w", src.location, err)
+		}
+	}
+
+	// the copied directory is extracted under its base name.
+	if err := copyPlan(dir, path.Base(path.Clean("/"+src.dir)), dest); err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
+// extractImageDir copies a directory out of an image into dir.
+func extractImageDir(ctx context.Context, cli *client.Client, image, src, dir string) error {
+	// the container is never started; the command is only there for images
+	// that don't define one.
+	c, err := cli.ContainerCreate(ctx, &container.Config{Image: image, Cmd: []string{"plan"}}, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cli.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+
+	rc, _, err := cli.CopyFromContainer(ctx, c.ID, path.Clean("/"+src))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp := dir + ".tmp"
+	_ = os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	if err := extractTar(rc, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// copyPlan copies the plan at the slash-separated path within root to dest,
+// leaving out git metadata.
+func copyPlan(root, dir, dest string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	src, err := withinDir(root, dir)
+	if err != nil {
+		return fmt.Errorf("invalid plan dir: %w", err)
+	}
+
+	return copy.Copy(src, dest, copy.Options{
+		Skip: func(p string) (bool, error) {
+			return filepath.Base(p) == ".git", nil
+		},
+	})
+}
+
+// cacheKey derives a directory name from a cache key.
+func cacheKey(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:16])
+}
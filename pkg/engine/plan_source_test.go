@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestParsePlanSource(t *testing.T) {
+	src, err := parsePlanSource("git+https://github.com/org/repo.git//plans/ping?ref=v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, &planSource{kind: "git", location: "https://github.com/org/repo.git", ref: "v1.0.0", dir: "plans/ping"}, src)
+
+	src, err = parsePlanSource("git+ssh://git@github.com/org/repo.git")
+	require.NoError(t, err)
+	require.Equal(t, &planSource{kind: "git", location: "ssh://git@github.com/org/repo.git"}, src)
+
+	src, err = parsePlanSource("oci://ghcr.io/org/plans:v1//ping")
+	require.NoError(t, err)
+	require.Equal(t, &planSource{kind: "oci", location: "ghcr.io/org/plans:v1", dir: "ping"}, src)
+
+	src, err = parsePlanSource("oci://ghcr.io/org/plans:v1")
+	require.NoError(t, err)
+	require.Equal(t, "plan", src.dir)
+
+	_, err = parsePlanSource("https://github.com/org/repo.git")
+	require.Error(t, err)
+}
+
+func TestFetchGitPlanSource(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	e := &Engine{envcfg: &config.EnvConfig{}, ctx: context.Background()}
+	require.NoError(t, e.envcfg.Load())
+
+	// create the "remote" repository.
+	repo := t.TempDir()
+	r, err := git.PlainInit(repo, false)
+	require.NoError(t, err)
+	wt, err := r.Worktree()
+	require.NoError(t, err)
+
+	commit := func(name string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(repo, "plans", "ping"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(repo, "plans", "ping", "manifest.toml"), []byte(`name = "`+name+`"`), 0644))
+		_, err := wt.Add("plans")
+		require.NoError(t, err)
+		_, err = wt.Commit("update plan", &git.CommitOptions{
+			Author: &object.Signature{Name: "tg", Email: "tg@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+	}
+
+	// the first fetch clones, the following ones pick up new commits from
+	// the cached clone.
+	comp := &api.Composition{}
+	for i, name := range []string{"ping", "pong", "pang"} {
+		commit(name)
+
+		comp.Global.PlanSource = "git+file://" + repo + "//plans/ping?ref=master"
+		if i == 2 {
+			// the default branch.
+			comp.Global.PlanSource = "git+file://" + repo + "//plans/ping"
+		}
+
+		var manifest api.TestPlanManifest
+		sources, err := e.remotePlanSources(context.Background(), string(rune('a'+i)), comp, nil, &manifest)
+		require.NoError(t, err)
+		require.Equal(t, name, manifest.Name)
+
+		_, err = os.Stat(filepath.Join(sources.PlanDir, "manifest.toml"))
+		require.NoError(t, err)
+	}
+
+	// plan dirs can't escape the repository.
+	comp.Global.PlanSource = "git+file://" + repo + "//../?ref=master"
+	_, err = e.remotePlanSources(context.Background(), "d", comp, nil, new(api.TestPlanManifest))
+	require.Error(t, err)
+}
+
+func TestPlanSourceLocks(t *testing.T) {
+	e := &Engine{}
+
+	unlock, err := e.lockPlanSource(context.Background(), "git:a")
+	require.NoError(t, err)
+
+	// other sources are fetched meanwhile.
+	unlockB, err := e.lockPlanSource(context.Background(), "git:b")
+	require.NoError(t, err)
+	unlockB()
+
+	// fetches of the same source give up with their request.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = e.lockPlanSource(ctx, "git:a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlock()
+	unlock, err = e.lockPlanSource(context.Background(), "git:a")
+	require.NoError(t, err)
+	unlock()
+}
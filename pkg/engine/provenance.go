@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+var artifactFileReplacer = strings.NewReplacer("/", "_", ":", "_", "\\", "_")
+
+// provenancePath returns the path of the provenance record of an artifact.
+// The detached cosign signature lives next to it, with a .sig suffix.
+func (e *Engine) provenancePath(artifact string) string {
+	return filepath.Join(e.envcfg.Dirs().Daemon(), "provenance", artifactFileReplacer.Replace(artifact)+".json")
+}
+
+// hashSources returns the hex-encoded SHA-256 digest of all regular files
+// under dir, covering both their relative paths and their contents.
+func hashSources(dir string) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkArtifactDigest checks that an artifact still has the contents its
+// provenance record describes, e.g. that its tag wasn't moved to another
+// image since.
+func (e *Engine) checkArtifactDigest(ctx context.Context, p *api.Provenance) error {
+	if p.ArtifactDigest == "" {
+		return fmt.Errorf("provenance record for artifact %s has no artifact digest; rebuild it", p.ArtifactPath)
+	}
+	digest, err := e.artifactDigest(ctx, p.ArtifactPath)
+	if err != nil {
+		return err
+	}
+	if digest != p.ArtifactDigest {
+		return fmt.Errorf("artifact %s has digest %s; its provenance record describes %s", p.ArtifactPath, digest, p.ArtifactDigest)
+	}
+	return nil
+}
+
+// recordProvenance persists the provenance record of an artifact, and signs
+// it with cosign if a signing key is configured.
+func (e *Engine) recordProvenance(ctx context.Context, p *api.Provenance, ow *rpc.OutputWriter) error {
+	path := e.provenancePath(p.ArtifactPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("failed to write provenance record: %w", err)
+	}
+
+	key := e.envcfg.Daemon.Provenance.SignKey
+	if key == "" {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "cosign", "sign-blob", "--yes", "--key", key, "--output-signature", path+".sig", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to sign provenance record: %w; output: %s", err, string(out))
+	}
+
+	ow.Infow("signed artifact provenance", "artifact", p.ArtifactPath, "artifact_digest", p.ArtifactDigest, "source_hash", p.SourceHash)
+	return nil
+}
+
+// verifyProvenance checks that an artifact has a provenance record signed by
+// the configured verification key, and that the artifact still has the
+// contents the record describes. It is a no-op when no key is configured.
+func (e *Engine) verifyProvenance(ctx context.Context, artifact string) error {
+	key := e.envcfg.Daemon.Provenance.VerifyKey
+	if key == "" {
+		return nil
+	}
+
+	path := e.provenancePath(artifact)
+
+	p, err := e.loadProvenance(artifact)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "cosign", "verify-blob", "--key", key, "--signature", path+".sig", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("provenance verification failed for artifact %s: %w; output: %s", artifact, err, string(out))
+	}
+	return e.checkArtifactDigest(ctx, p)
+}
+
+// loadProvenance reads the provenance record of an artifact.
+func (e *Engine) loadProvenance(artifact string) (*api.Provenance, error) {
+	b, err := os.ReadFile(e.provenancePath(artifact))
+	if err != nil {
+		return nil, fmt.Errorf("no provenance record for artifact %s: %w", artifact, err)
+	}
+
+	var p api.Provenance
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid provenance record for artifact %s: %w", artifact, err)
+	}
+	if p.ArtifactPath != artifact {
+		return nil, fmt.Errorf("provenance record for artifact %s describes artifact %s", artifact, p.ArtifactPath)
+	}
+	return &p, nil
+}
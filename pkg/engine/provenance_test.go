@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestHashSources(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("plan/main.go", "package main")
+	write("plan/go.mod", "module plan")
+
+	h1, err := hashSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2, err := hashSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 {
+		t.Errorf("hash is not stable: %s != %s", h1, h2)
+	}
+
+	write("plan/main.go", "package main // changed")
+
+	h3, err := hashSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == h3 {
+		t.Errorf("hash did not change after modifying sources")
+	}
+}
+
+func TestCheckArtifactDigest(t *testing.T) {
+	artifact := filepath.Join(t.TempDir(), "plan")
+	if err := os.WriteFile(artifact, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Engine{}
+	digest, err := e.artifactDigest(context.Background(), artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &api.Provenance{ArtifactPath: artifact, ArtifactDigest: digest}
+	if err := e.checkArtifactDigest(context.Background(), p); err != nil {
+		t.Errorf("unexpected error for an unchanged artifact: %s", err)
+	}
+
+	// an artifact replaced at the same path no longer matches its record.
+	if err := os.WriteFile(artifact, []byte("another binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.checkArtifactDigest(context.Background(), p); err == nil {
+		t.Error("expected an error for a replaced artifact")
+	}
+
+	// records predating digests are rejected.
+	if err := e.checkArtifactDigest(context.Background(), &api.Provenance{ArtifactPath: artifact}); err == nil {
+		t.Error("expected an error for a record without a digest")
+	}
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// errInterrupted is recorded on the tasks interrupted by a restart of the
+// daemon.
+const errInterrupted = "interrupted by a restart of the daemon"
+
+// recoveryCleanupTimeout bounds the cleanup of the resources of a run
+// interrupted by a restart of the daemon.
+const recoveryCleanupTimeout = 2 * time.Minute
+
+// recoverTasks reconciles the tasks that were being processed when the daemon
+// stopped, using their journal:
+//
+//   - tasks claimed by remote workers are adopted, with a fresh lease; the
+//     workers keep reporting their progress to us, or the task is requeued
+//     once the lease expires.
+//   - tasks that had reached a terminal state are archived.
+//   - builds are queued again, to be resumed from scratch.
+//   - runs can't be resumed: the resources of the run are cleaned up, and the
+//     run is marked failed.
+//
+// It must be called before the workers are started.
+func (e *Engine) recoverTasks() error {
+	tasks, err := e.store.Interrupted()
+	if err != nil {
+		return err
+	}
+
+	for _, tsk := range tasks {
+		log := logging.S().With("task_id", tsk.ID)
+
+		journal, err := e.store.Journal(tsk.ID)
+		if err != nil {
+			return err
+		}
+		claim := lastClaim(journal)
+
+		if claim != nil && claim.Claimant == task.ClaimantRemote {
+			log.Infow("adopting task claimed by remote worker", "claimed", claim.Time)
+			e.addSignal(tsk.ID, make(chan int))
+			e.grantLease(tsk.ID, claim.Lease)
+			continue
+		}
+
+		if len(tsk.States) == 0 {
+			log.Warnw("discarding interrupted task without state")
+			_ = e.store.Delete(tsk.ID)
+			continue
+		}
+
+		// The task may have been claimed without its state being persisted
+		// yet; the journal knows when it was.
+		if claim != nil && tsk.State().State == task.StateScheduled {
+			tsk.States = append(tsk.States, task.DatedState{State: task.StateProcessing, Created: claim.Time})
+		}
+
+		if tsk.Input, err = unmarshalTaskInput(tsk); err != nil {
+			log.Errorw("failed to decode the input of interrupted task", "err", err)
+		}
+
+		switch st := tsk.State().State; {
+		case st == task.StateComplete || st == task.StateCanceled:
+			log.Infow("archiving interrupted task that had finished")
+			err = e.local.Finished(tsk)
+
+		case tsk.Type == task.TypeBuild && tsk.Input != nil:
+			log.Infow("resuming interrupted build")
+			tsk.States = append(tsk.States, task.DatedState{State: task.StateScheduled, Created: time.Now().UTC()})
+			err = e.queue.Requeue(tsk, errInterrupted)
+
+		default:
+			log.Infow("failing interrupted task")
+			e.cleanupInterruptedRun(tsk)
+			tsk.Error = errInterrupted
+			if tsk.Type == task.TypeRun {
+				tsk.Result = &runner.Result{Outcome: task.OutcomeFailure}
+			}
+			tsk.States = append(tsk.States, task.DatedState{State: task.StateComplete, Created: time.Now().UTC()})
+			err = e.local.Finished(tsk)
+		}
+
+		if err != nil {
+			log.Errorw("failed to recover interrupted task", "err", err)
+		}
+	}
+	return nil
+}
+
+// lastClaim returns the last time a task was claimed for processing, or nil if
+// it never was.
+func lastClaim(journal []task.JournalEntry) *task.JournalEntry {
+	for i := len(journal) - 1; i >= 0; i-- {
+		if journal[i].State == task.StateProcessing {
+			return &journal[i]
+		}
+	}
+	return nil
+}
+
+// cleanupInterruptedRun cleans up the resources of an interrupted run, if its
+// runner can, logging to the log of the task.
+func (e *Engine) cleanupInterruptedRun(tsk *task.Task) {
+	if tsk.Type != task.TypeRun {
+		return
+	}
+	rec, ok := e.runners[tsk.Runner].(api.Reconciler)
+	if !ok {
+		return
+	}
+
+	f, err := os.OpenFile(e.taskLogPath(tsk.ID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logging.S().Errorw("could not open the log of interrupted task", "task_id", tsk.ID, "err", err)
+		return
+	}
+	defer f.Close()
+
+	ow := rpc.NewFileOutputWriter(f)
+	ow.Warnw("run " + errInterrupted + "; cleaning up its resources")
+
+	ctx, cancel := context.WithTimeout(context.Background(), recoveryCleanupTimeout)
+	defer cancel()
+	if err := rec.CleanupRun(ctx, tsk.ID, ow); err != nil {
+		ow.Errorw("failed to clean up the resources of the run", "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestRecoverInterruptedTasks(t *testing.T) {
+	e := newSchedulerEngine(t)
+
+	scheduled := []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}}
+	build := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ed0",
+		Type:   task.TypeBuild,
+		States: scheduled,
+		Input:  &BuildInput{BuildRequest: &api.BuildRequest{}},
+	}
+	run := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		Runner: "local:docker",
+		States: scheduled,
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	remote := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ef0",
+		Type:   task.TypeRun,
+		States: scheduled,
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+
+	// the build and the run are claimed by this daemon, the other run by a
+	// remote worker.
+	for _, tsk := range []*task.Task{build, run} {
+		require.NoError(t, e.queue.Push(tsk))
+		_, err := e.queue.Pop()
+		require.NoError(t, err)
+	}
+	require.NoError(t, e.queue.Push(remote))
+	_, err := e.queue.Claim(task.ClaimantRemote, "c0ffee")
+	require.NoError(t, err)
+
+	// restart.
+	e.queue, err = task.NewQueue(e.store, 10, UnmarshalTask)
+	require.NoError(t, err)
+	e.signals = make(map[string]chan int)
+	e.leases = make(map[string]remoteLease)
+	require.NoError(t, e.recoverTasks())
+
+	// the build is resumed, with its interruption in its history.
+	tsk, err := e.queue.Pop()
+	require.NoError(t, err)
+	require.Equal(t, build.ID, tsk.ID)
+	var states []task.State
+	for _, s := range tsk.States {
+		states = append(states, s.State)
+	}
+	require.Equal(t, []task.State{task.StateScheduled, task.StateProcessing, task.StateScheduled}, states)
+
+	// the run is failed.
+	tsk, err = e.store.Get(run.ID)
+	require.NoError(t, err)
+	require.Equal(t, task.StateComplete, tsk.State().State)
+	require.Equal(t, errInterrupted, tsk.Error)
+	require.EqualValues(t, task.OutcomeFailure, tsk.Result.(map[string]interface{})["outcome"])
+
+	journal, err := e.store.Journal(run.ID)
+	require.NoError(t, err)
+	require.Equal(t, task.StateComplete, journal[len(journal)-1].State)
+	require.Equal(t, errInterrupted, journal[len(journal)-1].Note)
+
+	// the remote run is adopted, until its lease expires.
+	tsk, err = e.store.Get(remote.ID)
+	require.NoError(t, err)
+	require.Equal(t, task.StateScheduled, tsk.State().State)
+	_, adopted := e.signals[remote.ID]
+	require.True(t, adopted)
+	require.True(t, e.renewLease(remote.ID, "c0ffee"))
+
+	e.expireLeases(time.Now().Add(2 * remoteLeaseTTL))
+	tsk, err = e.queue.Pop()
+	require.NoError(t, err)
+	require.Equal(t, remote.ID, tsk.ID)
+}
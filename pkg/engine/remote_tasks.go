@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// remoteHeartbeatInterval is how often workers check with the scheduler
+// whether the task they are processing has been killed, which renews their
+// claim on it.
+var remoteHeartbeatInterval = 10 * time.Second
+
+// remoteRequestTimeout bounds the requests of workers to the scheduler. The
+// transfers of sources and logs are only bounded until the scheduler
+// responds, as they take as long as they take.
+var remoteRequestTimeout = 30 * time.Second
+
+// remoteTasks is the taskSource of daemons whose workers pull tasks from the
+// queue of another daemon (the scheduler), through its /worker endpoints.
+// Sources are downloaded from the scheduler, and the logs and progress of
+// tasks are reported back to it, so that clients only ever talk to the
+// scheduler.
+type remoteTasks struct {
+	e        *Engine
+	endpoint string
+	token    string
+	cl       *http.Client
+	// streams is the client of the transfers of sources and logs.
+	streams *http.Client
+
+	lk         sync.Mutex
+	heartbeats map[string]chan struct{}
+	// leases are the tokens of our claims on tasks, by task ID.
+	leases map[string]string
+}
+
+var _ taskSource = (*remoteTasks)(nil)
+
+func newRemoteTasks(e *Engine, endpoint, token string) *remoteTasks {
+	return &remoteTasks{
+		e:        e,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    token,
+		cl:       &http.Client{Timeout: remoteRequestTimeout},
+		streams: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: remoteRequestTimeout}).DialContext,
+			TLSHandshakeTimeout:   remoteRequestTimeout,
+			ResponseHeaderTimeout: remoteRequestTimeout,
+		}},
+		heartbeats: make(map[string]chan struct{}),
+		leases:     make(map[string]string),
+	}
+}
+
+func (r *remoteTasks) request(method, path string, body io.Reader) (*http.Response, error) {
+	return r.do(r.cl, method, path, "", body)
+}
+
+// do sends a request to the scheduler with the given client, presenting the
+// lease on the task it's about, if any.
+func (r *remoteTasks) do(cl *http.Client, method, path string, taskID string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	if taskID != "" {
+		r.lk.Lock()
+		req.Header.Set(api.WorkerLeaseHeader, r.leases[taskID])
+		r.lk.Unlock()
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("%s %s: unexpected status code %d: %s", method, path, res.StatusCode, bytes.TrimSpace(msg))
+	}
+	return res, nil
+}
+
+// Pop claims the next task from the scheduler, and downloads its sources.
+// The claim is kept alive by heartbeats from then on, until the task
+// finishes.
+func (r *remoteTasks) Pop() (*task.Task, error) {
+	res, err := r.request(http.MethodPost, "/worker/claim", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil, task.ErrQueueEmpty
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	tsk, err := UnmarshalTask(b)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lk.Lock()
+	r.leases[tsk.ID] = res.Header.Get(api.WorkerLeaseHeader)
+	r.lk.Unlock()
+	r.keepalive(tsk.ID)
+
+	if err := r.fetchSources(tsk); err != nil {
+		r.stopKeepalive(tsk.ID)
+
+		// the task is ours now; fail it, rather than leaving it hanging.
+		tsk.Error = fmt.Sprintf("failed to fetch task sources: %s", err)
+		tsk.States = append(tsk.States, task.DatedState{State: task.StateCanceled, Created: time.Now().UTC()})
+		if _, rerr := r.report(api.WorkerEventFinished, tsk); rerr != nil {
+			logging.S().Errorw("could not report task failure to scheduler", "task_id", tsk.ID, "err", rerr)
+		}
+		r.releaseLease(tsk.ID)
+		r.e.cleanWorkspace(tsk)
+		return nil, err
+	}
+	return tsk, nil
+}
+
+// fetchSources downloads the sources of a task into its workspace, and points
+// the task to them.
+func (r *remoteTasks) fetchSources(tsk *task.Task) error {
+	sources := taskInputSources(tsk)
+	if sources == nil {
+		return nil
+	}
+
+	dir := filepath.Join(r.e.taskWorkspace(tsk.ID), "sources")
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	res, err := r.do(r.streams, http.MethodGet, "/worker/sources?task_id="+url.QueryEscape(tsk.ID), tsk.ID, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := extractDir(res.Body, dir); err != nil {
+		return err
+	}
+
+	// rebase the source dirs from the scheduler's workspace onto ours.
+	return rebaseSources(sources, dir)
+}
+
+// report sends the state of a task to the scheduler, and returns whether the
+// task has been killed.
+func (r *remoteTasks) report(event string, tsk *task.Task) (bool, error) {
+	b, err := json.Marshal(tsk)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.do(r.cl, http.MethodPost, "/worker/update?event="+event, tsk.ID, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	var resp api.WorkerUpdateResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return false, err
+	}
+	return resp.Killed, nil
+}
+
+// Log writes the log of a task to the local log file, and streams it to the
+// scheduler. Failing to stream the log doesn't interrupt the task.
+func (r *remoteTasks) Log(tsk *task.Task) (io.WriteCloser, error) {
+	f, err := os.OpenFile(r.e.taskLogPath(tsk.ID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, err := r.do(r.streams, http.MethodPost, "/worker/logs?task_id="+url.QueryEscape(tsk.ID), tsk.ID, pr)
+		if err != nil {
+			logging.S().Warnw("could not stream task log to scheduler", "task_id", tsk.ID, "err", err)
+			_ = pr.CloseWithError(err)
+			return
+		}
+		res.Body.Close()
+	}()
+
+	return &remoteLog{f: f, pw: pw, done: done}, nil
+}
+
+func (r *remoteTasks) Persist(tsk *task.Task) error {
+	_, err := r.report(api.WorkerEventProgress, tsk)
+	return err
+}
+
+// Started reports a task as started.
+func (r *remoteTasks) Started(tsk *task.Task) error {
+	_, err := r.report(api.WorkerEventStarted, tsk)
+	return err
+}
+
+// keepalive checks periodically with the scheduler whether a task has been
+// killed, which renews our claim on it, until stopKeepalive is called.
+func (r *remoteTasks) keepalive(id string) {
+	stop := make(chan struct{})
+	r.lk.Lock()
+	r.heartbeats[id] = stop
+	r.lk.Unlock()
+
+	// heartbeats only carry the task ID, as the task is being mutated by
+	// the worker.
+	go func() {
+		ticker := time.NewTicker(remoteHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			killed, err := r.report(api.WorkerEventHeartbeat, &task.Task{ID: id})
+			if err != nil {
+				logging.S().Warnw("could not check task with scheduler", "task_id", id, "err", err)
+				continue
+			}
+			if killed {
+				logging.S().Infow("task killed on scheduler", "task_id", id)
+				_ = r.e.Kill(id)
+				return
+			}
+		}
+	}()
+}
+
+func (r *remoteTasks) stopKeepalive(id string) {
+	r.lk.Lock()
+	if stop, ok := r.heartbeats[id]; ok {
+		close(stop)
+		delete(r.heartbeats, id)
+	}
+	r.lk.Unlock()
+}
+
+// releaseLease forgets our lease on a task, once we're done reporting on it.
+func (r *remoteTasks) releaseLease(id string) {
+	r.lk.Lock()
+	delete(r.leases, id)
+	r.lk.Unlock()
+}
+
+func (r *remoteTasks) Finished(tsk *task.Task) error {
+	r.stopKeepalive(tsk.ID)
+
+	defer r.e.cleanWorkspace(tsk)
+	defer r.releaseLease(tsk.ID)
+
+	_, err := r.report(api.WorkerEventFinished, tsk)
+	return err
+}
+
+// remoteLog writes a task log both to a local file and to the stream to the
+// scheduler. Once the stream fails, only the local file is written to.
+type remoteLog struct {
+	f    *os.File
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	broken bool
+}
+
+func (l *remoteLog) Write(p []byte) (int, error) {
+	if !l.broken {
+		if _, err := l.pw.Write(p); err != nil {
+			l.broken = true
+		}
+	}
+	return l.f.Write(p)
+}
+
+func (l *remoteLog) Close() error {
+	_ = l.pw.Close()
+	<-l.done
+	return l.f.Close()
+}
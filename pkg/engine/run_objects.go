@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidObjectKey is returned for keys that can't name an object in the
+// object store of a run.
+var ErrInvalidObjectKey = errors.New("invalid object key")
+
+// ErrRunObjectsQuotaExceeded is returned for objects that would take the
+// object store of a run over its quota, see config.DaemonConfig.
+var ErrRunObjectsQuotaExceeded = errors.New("run objects quota exceeded")
+
+// runObjectsDir returns the directory of the object store of a run, if the
+// run is in progress.
+func (e *Engine) runObjectsDir(runID, key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectKey, key)
+	}
+
+	e.runStoresLk.RLock()
+	_, ok := e.runStores[runID]
+	e.runStoresLk.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	return filepath.Join(e.envcfg.Dirs().RunObjects(), runID), nil
+}
+
+// PutRunObject stores an object in the object store of an ongoing run,
+// replacing the object under the same key, if any. Objects that would take
+// the store over its quota are rejected with ErrRunObjectsQuotaExceeded.
+func (e *Engine) PutRunObject(runID, key string, r io.Reader) error {
+	dir, err := e.runObjectsDir(runID, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// objects are written to a temporary file and renamed into place, so
+	// that partial uploads are never served.
+	tmp, err := ioutil.TempFile(dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	quota := e.envcfg.Daemon.RunObjectsQuota()
+	n, err := io.Copy(tmp, io.LimitReader(r, quota+1))
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// the object is accounted for, and moved into place, atomically, so that
+	// concurrent puts can't exceed the quota together.
+	e.runStoresLk.Lock()
+	defer e.runStoresLk.Unlock()
+
+	s, ok := e.runStores[runID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	var total int64
+	for k, size := range s.objects {
+		if k != key {
+			total += size
+		}
+	}
+	if total+n > quota {
+		return fmt.Errorf("%w: %s would take the objects of run %s over %d bytes", ErrRunObjectsQuotaExceeded, key, runID, quota)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, key)); err != nil {
+		return err
+	}
+	if s.objects == nil {
+		s.objects = make(map[string]int64)
+	}
+	s.objects[key] = n
+	return nil
+}
+
+// OpenRunObject opens an object of the object store of an ongoing run.
+func (e *Engine) OpenRunObject(runID, key string) (*os.File, error) {
+	dir, err := e.runObjectsDir(runID, key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(dir, key))
+}
+
+// removeRunObjects discards the object store of a finished run.
+func (e *Engine) removeRunObjects(runID string) {
+	if runID == "" || runID != filepath.Base(runID) {
+		return
+	}
+	_ = os.RemoveAll(filepath.Join(e.envcfg.Dirs().RunObjects(), runID))
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/version"
+)
+
+// sdkModule is the module path of the Testground SDK, whose version we record
+// for every artifact.
+const sdkModule = "github.com/testground/sdk-go"
+
+// runRecordPath returns the path of the record of a run. The detached cosign
+// signature lives next to it, with a .sig suffix.
+func (e *Engine) runRecordPath(runID string) string {
+	return filepath.Join(e.envcfg.Dirs().Daemon(), "runs", runID+".json")
+}
+
+// runPlacementPath returns the path of the placement of the instances of a
+// run, kept next to its record.
+func (e *Engine) runPlacementPath(runID string) string {
+	return filepath.Join(e.envcfg.Dirs().Daemon(), "runs", runID+".placement.json")
+}
+
+// artifactDigest resolves an artifact to the digest of its contents: the
+// SHA-256 of the file for executable artifacts, or the image ID for docker
+// artifacts.
+func (e *Engine) artifactDigest(ctx context.Context, artifact string) (string, error) {
+	if f, err := os.Open(artifact); err == nil {
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	cli, err := e.dockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	img, _, err := cli.ImageInspectWithRaw(ctx, artifact)
+	if err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
+// newRunRecord assembles the record of a run about to start.
+func (e *Engine) newRunRecord(ctx context.Context, comp *api.Composition, in *api.RunInput, runner string, ow *rpc.OutputWriter) *api.RunRecord {
+	rec := &api.RunRecord{
+		RunID:         in.RunID,
+		Composition:   *comp,
+		Runner:        runner,
+		RunnerConfig:  in.RunnerConfig,
+		Artifacts:     make(map[string]api.RecordedArtifact, len(in.Groups)),
+		DaemonVersion: version.GitCommit,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	for _, g := range in.Groups {
+		a := api.RecordedArtifact{Path: g.ArtifactPath}
+
+		digest, err := e.artifactDigest(ctx, g.ArtifactPath)
+		if err != nil {
+			ow.Warnw("could not resolve artifact digest", "group_id", g.ID, "artifact", g.ArtifactPath, "err", err)
+		}
+		a.Digest = digest
+
+		if p, err := e.loadProvenance(g.ArtifactPath); err == nil {
+			a.Provenance = p
+			a.SDKVersion = p.Dependencies[sdkModule]
+		}
+
+		rec.Artifacts[g.ID] = a
+	}
+
+	return rec
+}
+
+// recordRun persists the record of a run, and signs it with cosign if a
+// signing key is configured. Records are immutable: recording a run twice
+// fails.
+func (e *Engine) recordRun(ctx context.Context, rec *api.RunRecord) error {
+	path := e.runRecordPath(rec.RunID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0444)
+	if err != nil {
+		return fmt.Errorf("failed to create run record: %w", err)
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+
+	key := e.envcfg.Daemon.Provenance.SignKey
+	if key == "" {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "cosign", "sign-blob", "--yes", "--key", key, "--output-signature", path+".sig", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to sign run record: %w; output: %s", err, string(out))
+	}
+	return nil
+}
+
+// DescribeRun returns the record of a run.
+func (e *Engine) DescribeRun(runID string) (*api.RunRecord, error) {
+	b, err := os.ReadFile(e.runRecordPath(filepath.Base(runID)))
+	if err != nil {
+		return nil, fmt.Errorf("no record for run %s: %w", runID, err)
+	}
+
+	var rec api.RunRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("invalid record for run %s: %w", runID, err)
+	}
+
+	if b, err := os.ReadFile(e.runPlacementPath(rec.RunID)); err == nil {
+		if err := json.Unmarshal(b, &rec.Placement); err != nil {
+			return nil, fmt.Errorf("invalid placement for run %s: %w", runID, err)
+		}
+	}
+	return &rec, nil
+}
+
+// recordPlacement persists the placement of the instances of a run, once it
+// is done, next to the record of the run.
+func (e *Engine) recordPlacement(runID string, placement []api.InstancePlacement) error {
+	b, err := json.MarshalIndent(placement, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.runPlacementPath(runID), b, 0644)
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestRunRecordIsImmutable(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{envcfg: cfg}
+
+	rec := &api.RunRecord{RunID: "run1", Runner: "local:exec"}
+	if err := e.recordRun(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.Runner = "local:docker"
+	if err := e.recordRun(context.Background(), rec); err == nil {
+		t.Fatal("expected recording a run twice to fail")
+	}
+
+	got, err := e.DescribeRun("run1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Runner != "local:exec" {
+		t.Errorf("expected the original record to be preserved, got runner %s", got.Runner)
+	}
+}
+
+func TestRunRecordIncludesPlacement(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	cfg := &config.EnvConfig{}
+	if err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{envcfg: cfg}
+
+	if err := e.recordRun(context.Background(), &api.RunRecord{RunID: "run1", Runner: "cluster:k8s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	placement := []api.InstancePlacement{
+		{Group: "a", Instance: 0, Host: "node-1", Zone: "us-east-1a"},
+		{Group: "b", Instance: 0, Host: "node-1", Zone: "us-east-1a"},
+	}
+	if err := e.recordPlacement("run1", placement); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.DescribeRun("run1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Placement) != 2 || got.Placement[1] != placement[1] {
+		t.Errorf("expected the placement of the run, got %v", got.Placement)
+	}
+}
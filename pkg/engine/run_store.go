@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+)
+
+// ErrRunNotInProgress is returned when accessing the key/value store of a run
+// that is not in progress on this daemon.
+var ErrRunNotInProgress = errors.New("run not in progress")
+
+// runStore is the key/value store of an ongoing run.
+type runStore struct {
+	readToken  string
+	writeToken string
+	values     map[string]string
+	// abort is set when an instance aborts the run.
+	abort *api.RunAbort
+	// roles are the roles of the run, claimed[i] the number of instances
+	// that claimed roles[i], and assigned the role of each instance that
+	// claimed one, by group and sequence number.
+	roles    api.Roles
+	claimed  []int
+	assigned map[string]string
+	// objects is the size of the objects put into the object store of the
+	// run, by key.
+	objects map[string]int64
+}
+
+// checkInstanceServices rejects runs relying on services the daemon serves to
+// instances, i.e. roles and those the test case declares, if it doesn't
+// serve instances at all, as instances would only find out midway.
+func (e *Engine) checkInstanceServices(comp *api.Composition, manifest *api.TestPlanManifest) error {
+	var services []string
+	if _, tc, ok := manifest.TestCaseByName(comp.Global.Case); ok {
+		for _, s := range tc.Services {
+			if s != api.ServiceAbort && s != api.ServiceObjects {
+				return fmt.Errorf("test case %s uses unknown service %q; expected %s or %s", tc.Name, s, api.ServiceAbort, api.ServiceObjects)
+			}
+		}
+		services = append(services, tc.Services...)
+	}
+	if len(comp.Global.Roles) > 0 {
+		services = append(services, "roles")
+	}
+
+	if len(services) > 0 && e.envcfg.Daemon.InstanceEndpoint == "" {
+		return fmt.Errorf("run uses %s, which the daemon doesn't serve without an instance_endpoint", strings.Join(services, ", "))
+	}
+	return nil
+}
+
+// openRunStore opens the key/value store of a run, for the duration of the
+// run, and returns how its instances reach it; nil if the daemon doesn't
+// expose the store to instances. The roles and the object store of the run
+// are handed out through the store too.
+func (e *Engine) openRunStore(runID string, writer string, roles api.Roles) (*api.RunStoreEndpoint, error) {
+	rs := &runStore{
+		values:   make(map[string]string),
+		roles:    roles,
+		claimed:  make([]int, len(roles)),
+		assigned: make(map[string]string),
+	}
+	for _, t := range []*string{&rs.readToken, &rs.writeToken} {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		*t = hex.EncodeToString(b)
+	}
+
+	e.runStoresLk.Lock()
+	if e.runStores == nil {
+		e.runStores = make(map[string]*runStore)
+	}
+	e.runStores[runID] = rs
+	e.runStoresLk.Unlock()
+
+	endpoint := e.envcfg.Daemon.InstanceEndpoint
+	if endpoint == "" {
+		return nil, nil
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	return &api.RunStoreEndpoint{
+		URL:         fmt.Sprintf("%s/runs/store?run_id=%s", endpoint, url.QueryEscape(runID)),
+		DatasetsURL: endpoint + "/datasets/",
+		ClockURL:    endpoint + "/time",
+		AbortURL:    fmt.Sprintf("%s/runs/abort?run_id=%s", endpoint, url.QueryEscape(runID)),
+		RolesURL:    fmt.Sprintf("%s/runs/roles?run_id=%s", endpoint, url.QueryEscape(runID)),
+		ObjectsURL:  fmt.Sprintf("%s/runs/%s/objects/", endpoint, url.PathEscape(runID)),
+		ReadToken:   rs.readToken,
+		WriteToken:  rs.writeToken,
+		WriterGroup: writer,
+	}, nil
+}
+
+// closeRunStore discards the key/value store and the object store of a
+// finished run.
+func (e *Engine) closeRunStore(runID string) {
+	e.runStoresLk.Lock()
+	delete(e.runStores, runID)
+	e.runStoresLk.Unlock()
+
+	e.removeRunObjects(runID)
+}
+
+func (e *Engine) RunValues(runID string) (map[string]string, error) {
+	e.runStoresLk.RLock()
+	defer e.runStoresLk.RUnlock()
+
+	rs, ok := e.runStores[runID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	values := make(map[string]string, len(rs.values))
+	for k, v := range rs.values {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (e *Engine) SetRunValue(runID, key, value string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+
+	e.runStoresLk.Lock()
+	defer e.runStoresLk.Unlock()
+
+	rs, ok := e.runStores[runID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	rs.values[key] = value
+	return nil
+}
+
+func (e *Engine) RunStoreAccess(runID, token string) (ok, write bool) {
+	e.runStoresLk.RLock()
+	defer e.runStoresLk.RUnlock()
+
+	rs, found := e.runStores[runID]
+	if !found || token == "" {
+		return false, false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(rs.writeToken)) == 1 {
+		return true, true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(rs.readToken)) == 1, false
+}
+
+func (e *Engine) AbortRun(runID string, req *api.AbortRunRequest) error {
+	if req.Reason == "" {
+		return errors.New("empty reason")
+	}
+
+	e.runStoresLk.Lock()
+	rs, ok := e.runStores[runID]
+	if !ok {
+		e.runStoresLk.Unlock()
+		return fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	first := rs.abort == nil
+	if first {
+		rs.abort = &api.RunAbort{
+			GroupID:  req.GroupID,
+			Instance: req.Instance,
+			Reason:   req.Reason,
+		}
+	}
+	e.runStoresLk.Unlock()
+
+	if first {
+		logging.S().Warnw("instance aborted run", "run_id", runID, "group_id", req.GroupID, "instance", req.Instance, "reason", req.Reason)
+	}
+
+	// runs are executed by tasks of the same ID; cancelling the task tears
+	// down the run.
+	e.signal(runID)
+	return nil
+}
+
+// runAbort returns how an instance aborted a run; nil if none did.
+func (e *Engine) runAbort(runID string) *api.RunAbort {
+	e.runStoresLk.RLock()
+	defer e.runStoresLk.RUnlock()
+
+	if rs, ok := e.runStores[runID]; ok {
+		return rs.abort
+	}
+	return nil
+}
+
+func (e *Engine) ClaimRole(runID string, req *api.ClaimRoleRequest) (*api.ClaimRoleResponse, error) {
+	e.runStoresLk.Lock()
+	defer e.runStoresLk.Unlock()
+
+	rs, ok := e.runStores[runID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotInProgress, runID)
+	}
+	if len(rs.roles) == 0 {
+		return nil, fmt.Errorf("run %s has no roles", runID)
+	}
+
+	instance := fmt.Sprintf("%s/%d", req.GroupID, req.Instance)
+	if role, ok := rs.assigned[instance]; ok {
+		return &api.ClaimRoleResponse{Role: role}, nil
+	}
+	for i, r := range rs.roles {
+		if rs.claimed[i] < r.Count {
+			rs.claimed[i]++
+			rs.assigned[instance] = r.Name
+			return &api.ClaimRoleResponse{Role: r.Name}, nil
+		}
+	}
+	return nil, fmt.Errorf("all roles of run %s are taken", runID)
+}
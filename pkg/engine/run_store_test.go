@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestRunStore(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}}
+	e.envcfg.Daemon.InstanceEndpoint = "http://daemon:8042/"
+
+	endpoint, err := e.openRunStore("run1", "leader", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://daemon:8042/runs/store?run_id=run1", endpoint.URL)
+	require.Equal(t, "leader", endpoint.WriterGroup)
+
+	ok, write := e.RunStoreAccess("run1", endpoint.ReadToken)
+	require.True(t, ok)
+	require.False(t, write)
+
+	ok, write = e.RunStoreAccess("run1", endpoint.WriteToken)
+	require.True(t, ok)
+	require.True(t, write)
+
+	// tokens are scoped to their run.
+	_, err = e.openRunStore("run2", "", nil)
+	require.NoError(t, err)
+	ok, _ = e.RunStoreAccess("run2", endpoint.WriteToken)
+	require.False(t, ok)
+
+	require.NoError(t, e.SetRunValue("run1", "token", "abc"))
+	values, err := e.RunValues("run1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"token": "abc"}, values)
+
+	e.closeRunStore("run1")
+	_, err = e.RunValues("run1")
+	require.True(t, errors.Is(err, ErrRunNotInProgress))
+	ok, _ = e.RunStoreAccess("run1", endpoint.WriteToken)
+	require.False(t, ok)
+}
+
+func TestAbortRun(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}, signals: make(map[string]chan int)}
+	e.envcfg.Daemon.InstanceEndpoint = "http://daemon:8042"
+
+	ch := make(chan int)
+	e.addSignal("run1", ch)
+
+	endpoint, err := e.openRunStore("run1", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://daemon:8042/runs/abort?run_id=run1", endpoint.AbortURL)
+
+	require.Error(t, e.AbortRun("run1", &api.AbortRunRequest{Instance: 2}))
+	require.Nil(t, e.runAbort("run1"))
+
+	require.NoError(t, e.AbortRun("run1", &api.AbortRunRequest{GroupID: "peers", Instance: 2, Reason: "bootstrap failed"}))
+	require.NoError(t, e.AbortRun("run1", &api.AbortRunRequest{GroupID: "peers", Instance: 3, Reason: "too late"}))
+
+	// the task running the run is cancelled.
+	select {
+	case <-ch:
+	default:
+		t.Fatal("run was not signalled")
+	}
+
+	// only the first abort is recorded.
+	abort := e.runAbort("run1")
+	require.NotNil(t, abort)
+	require.Equal(t, 2, abort.Instance)
+	require.Equal(t, "run aborted by instance 2 of group peers: bootstrap failed", abort.String())
+
+	e.closeRunStore("run1")
+	err = e.AbortRun("run1", &api.AbortRunRequest{Reason: "gone"})
+	require.True(t, errors.Is(err, ErrRunNotInProgress))
+}
+
+func TestClaimRole(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}}
+
+	roles := api.Roles{{Name: "bootstrapper", Count: 1}, {Name: "seeker", Count: 2}}
+	_, err := e.openRunStore("run1", "", roles)
+	require.NoError(t, err)
+
+	claim := func(group string, instance int) string {
+		res, err := e.ClaimRole("run1", &api.ClaimRoleRequest{GroupID: group, Instance: instance})
+		require.NoError(t, err)
+		return res.Role
+	}
+
+	require.Equal(t, "bootstrapper", claim("peers", 3))
+	require.Equal(t, "seeker", claim("peers", 0))
+	// claims are idempotent.
+	require.Equal(t, "bootstrapper", claim("peers", 3))
+	require.Equal(t, "seeker", claim("clients", 0))
+
+	_, err = e.ClaimRole("run1", &api.ClaimRoleRequest{GroupID: "peers", Instance: 1})
+	require.Error(t, err)
+
+	_, err = e.openRunStore("run2", "", nil)
+	require.NoError(t, err)
+	_, err = e.ClaimRole("run2", &api.ClaimRoleRequest{GroupID: "peers"})
+	require.Error(t, err)
+}
+
+func TestRunObjects(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	e := &Engine{envcfg: &config.EnvConfig{}}
+	require.NoError(t, e.envcfg.Load())
+	e.envcfg.Daemon.InstanceEndpoint = "http://daemon:8042"
+
+	endpoint, err := e.openRunStore("run1", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://daemon:8042/runs/run1/objects/", endpoint.ObjectsURL)
+
+	require.NoError(t, e.PutRunObject("run1", "peers.json", strings.NewReader(`["a"]`)))
+	require.NoError(t, e.PutRunObject("run1", "peers.json", strings.NewReader(`["a","b"]`)))
+
+	f, err := e.OpenRunObject("run1", "peers.json")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, `["a","b"]`, string(b))
+
+	_, err = e.OpenRunObject("run1", "missing")
+	require.True(t, os.IsNotExist(err))
+
+	for _, key := range []string{"", "../run2", ".hidden"} {
+		err = e.PutRunObject("run1", key, strings.NewReader("x"))
+		require.True(t, errors.Is(err, ErrInvalidObjectKey), key)
+	}
+
+	// objects can't take the store over its quota; replaced objects don't
+	// count towards it.
+	e.envcfg.Daemon.RunObjectsQuotaMiB = 1
+	big := strings.Repeat("x", 600<<10)
+	require.NoError(t, e.PutRunObject("run1", "big", strings.NewReader(big)))
+	require.NoError(t, e.PutRunObject("run1", "big", strings.NewReader(big)))
+	err = e.PutRunObject("run1", "bigger", strings.NewReader(big))
+	require.True(t, errors.Is(err, ErrRunObjectsQuotaExceeded))
+	_, err = e.OpenRunObject("run1", "bigger")
+	require.True(t, os.IsNotExist(err))
+
+	// objects are discarded with their run.
+	e.closeRunStore("run1")
+	_, err = e.OpenRunObject("run1", "peers.json")
+	require.True(t, errors.Is(err, ErrRunNotInProgress))
+	_, err = os.Stat(filepath.Join(e.envcfg.Dirs().RunObjects(), "run1"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCheckInstanceServices(t *testing.T) {
+	e := &Engine{envcfg: &config.EnvConfig{}}
+
+	manifest := &api.TestPlanManifest{TestCases: []*api.TestCase{
+		{Name: "plain"},
+		{Name: "aborting", Services: []string{api.ServiceAbort}},
+		{Name: "unknown", Services: []string{"mail"}},
+	}}
+	comp := func(tc string, roles api.Roles) *api.Composition {
+		return &api.Composition{Global: api.Global{Case: tc, Roles: roles}}
+	}
+
+	require.NoError(t, e.checkInstanceServices(comp("plain", nil), manifest))
+	require.Error(t, e.checkInstanceServices(comp("aborting", nil), manifest))
+	require.Error(t, e.checkInstanceServices(comp("plain", api.Roles{{Name: "seeker"}}), manifest))
+	require.Error(t, e.checkInstanceServices(comp("unknown", nil), manifest))
+
+	// all are served with an instance endpoint.
+	e.envcfg.Daemon.InstanceEndpoint = "http://daemon:8042/"
+	require.NoError(t, e.checkInstanceServices(comp("aborting", nil), manifest))
+	require.NoError(t, e.checkInstanceServices(comp("plain", api.Roles{{Name: "seeker"}}), manifest))
+	require.Error(t, e.checkInstanceServices(comp("unknown", nil), manifest))
+}
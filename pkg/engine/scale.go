@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// DoScaleRun resizes a group of a run in progress.
+func (e *Engine) DoScaleRun(ctx context.Context, req *api.ScaleRunRequest, ow *rpc.OutputWriter) error {
+	if req.Group == "" {
+		return errors.New("no group to scale")
+	}
+	if req.Instances < 0 {
+		return fmt.Errorf("invalid number of instances: %d", req.Instances)
+	}
+
+	id, run, _, err := e.liveRunner(req.RunID)
+	if err != nil {
+		return err
+	}
+
+	s, ok := run.(api.Scaler)
+	if !ok {
+		return fmt.Errorf("runner %s does not support scaling runs", id)
+	}
+
+	obj, err := e.runnerConfig(id, run)
+	if err != nil {
+		return err
+	}
+
+	input := &api.ScaleInput{
+		EnvConfig:    e.EnvConfig(),
+		RunID:        req.RunID,
+		RunnerConfig: obj,
+		Group:        req.Group,
+		Instances:    req.Instances,
+	}
+	if err := s.ScaleGroup(ctx, input, ow); err != nil {
+		return err
+	}
+	e.resizeChurnedGroup(req.RunID, req.Group, req.Instances)
+	ow.Infow("run scaled", "run_id", req.RunID, "group", req.Group, "instances", req.Instances)
+	return nil
+}
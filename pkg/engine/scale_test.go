@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
+)
+
+type fakeScaler struct {
+	fakePauser
+	scaled []*api.ScaleInput
+}
+
+func (f *fakeScaler) ScaleGroup(_ context.Context, in *api.ScaleInput, _ *rpc.OutputWriter) error {
+	f.scaled = append(f.scaled, in)
+	return nil
+}
+
+func TestScaleRun(t *testing.T) {
+	s := &fakeScaler{}
+	e := newSchedulerEngine(t)
+	e.runners = map[string]api.Runner{"local:docker": s}
+
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		Runner: "local:docker",
+		States: []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	require.NoError(t, e.queue.Push(tsk))
+
+	req := &api.ScaleRunRequest{RunID: tsk.ID, Group: "providers", Instances: 200}
+
+	// the run isn't being processed yet.
+	require.Error(t, e.DoScaleRun(context.Background(), req, rpc.Discard()))
+
+	ctx, cancel := withPausableTimeout(context.Background(), time.Hour)
+	defer cancel()
+	e.addTimeout(tsk.ID, ctx)
+
+	require.NoError(t, e.DoScaleRun(context.Background(), req, rpc.Discard()))
+	require.Len(t, s.scaled, 1)
+	require.Equal(t, "providers", s.scaled[0].Group)
+	require.Equal(t, 200, s.scaled[0].Instances)
+
+	require.Error(t, e.DoScaleRun(context.Background(), &api.ScaleRunRequest{RunID: tsk.ID, Group: "providers", Instances: -1}, rpc.Discard()))
+
+	// runners that can't scale runs are reported.
+	e.runners["local:docker"] = &fakePauser{}
+	require.Error(t, e.DoScaleRun(context.Background(), req, rpc.Discard()))
+}
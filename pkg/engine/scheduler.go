@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// remoteLeaseTTL is how long the claim of a remote worker holds without the
+// worker reporting to us. It spans several heartbeats of the worker, so that
+// a few failed ones don't cost it the task.
+var remoteLeaseTTL = 6 * remoteHeartbeatInterval
+
+// errLeaseExpired is recorded on the tasks whose remote worker stopped
+// reporting to us.
+const errLeaseExpired = "claim of remote worker expired"
+
+// remoteLease is the claim of a remote worker on a task.
+type remoteLease struct {
+	// token identifies the claim; the worker presents it on its reports, so
+	// that a worker whose claim expired can't report on the task anymore once
+	// it's claimed again.
+	token    string
+	deadline time.Time
+}
+
+// ClaimTask takes the next task off the queue on behalf of a remote worker.
+// The task can be killed like any other task being processed: the worker
+// learns about it the next time it reports to us. The claim is leased: it
+// is requeued if the worker stops reporting to us for remoteLeaseTTL. The
+// returned token of the lease must accompany the reports of the worker.
+func (e *Engine) ClaimTask() (*task.Task, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	lease := hex.EncodeToString(b)
+
+	tsk, err := e.queue.Claim(task.ClaimantRemote, lease)
+	switch err {
+	case nil:
+	case task.ErrQueueEmpty:
+		return nil, "", nil
+	default:
+		return nil, "", err
+	}
+
+	e.addSignal(tsk.ID, make(chan int))
+	e.grantLease(tsk.ID, lease)
+	logging.S().Infow("task claimed by remote worker", "task_id", tsk.ID)
+	return tsk, lease, nil
+}
+
+// TaskSources writes the sources of a task as a gzipped tarball.
+func (e *Engine) TaskSources(taskID string, w io.Writer) error {
+	tsk, err := e.store.Get(taskID)
+	if err != nil {
+		return err
+	}
+	tsk.Input, err = unmarshalTaskInput(tsk)
+	if err != nil {
+		return err
+	}
+
+	sources := taskInputSources(tsk)
+	if sources == nil {
+		return fmt.Errorf("task %s has no sources", taskID)
+	}
+	return archiveDir(sources.BaseDir, w)
+}
+
+// ReportTask records the state of a task processed by a remote worker, and
+// renews its claim. Only the progress of the task is taken from the report;
+// its inputs remain the ones we queued. Workers whose claim expired, or who
+// present the token of another claim, are told to kill the task through
+// their heartbeats, and their other reports are refused.
+func (e *Engine) ReportTask(event string, lease string, upd *task.Task) (bool, error) {
+	if !e.renewLease(upd.ID, lease) {
+		if event == api.WorkerEventHeartbeat {
+			return true, nil
+		}
+		return false, fmt.Errorf("claim of task %s has expired", upd.ID)
+	}
+
+	if event == api.WorkerEventHeartbeat {
+		return e.killed(upd.ID), nil
+	}
+
+	tsk, err := e.store.Get(upd.ID)
+	if err != nil {
+		return false, err
+	}
+	if st := tsk.State().State; st == task.StateComplete || st == task.StateCanceled {
+		return false, fmt.Errorf("task %s has already finished", tsk.ID)
+	}
+	if tsk.Input, err = unmarshalTaskInput(tsk); err != nil {
+		return false, err
+	}
+
+	tsk.States = upd.States
+	tsk.Result = upd.Result
+	tsk.Error = upd.Error
+	tsk.Builds = upd.Builds
+	tsk.Phases = upd.Phases
+	if upd.Composition != nil {
+		tsk.Composition = upd.Composition
+	}
+
+	switch event {
+	case api.WorkerEventStarted:
+		err = e.local.Started(tsk)
+	case api.WorkerEventProgress:
+		err = e.local.Persist(tsk)
+	case api.WorkerEventFinished:
+		e.deleteSignal(tsk.ID)
+		e.deleteLease(tsk.ID)
+		return false, e.local.Finished(tsk)
+	default:
+		return false, fmt.Errorf("unknown worker event: %s", event)
+	}
+
+	return e.killed(tsk.ID), err
+}
+
+// grantLease leases a task to a remote worker for remoteLeaseTTL, under the
+// given token.
+func (e *Engine) grantLease(id, token string) {
+	e.leasesLk.Lock()
+	e.leases[id] = remoteLease{token: token, deadline: time.Now().Add(remoteLeaseTTL)}
+	e.leasesLk.Unlock()
+}
+
+// renewLease extends the claim of a remote worker on a task by
+// remoteLeaseTTL. It returns false if the task isn't claimed under this token
+// anymore, e.g. because its claim expired.
+func (e *Engine) renewLease(id, token string) bool {
+	e.leasesLk.Lock()
+	defer e.leasesLk.Unlock()
+
+	l, ok := e.leases[id]
+	if !ok || token == "" || l.token != token {
+		return false
+	}
+	l.deadline = time.Now().Add(remoteLeaseTTL)
+	e.leases[id] = l
+	return true
+}
+
+func (e *Engine) deleteLease(id string) {
+	e.leasesLk.Lock()
+	delete(e.leases, id)
+	e.leasesLk.Unlock()
+}
+
+// leaseLoop requeues the tasks whose remote claim expired, until the engine
+// is closed.
+func (e *Engine) leaseLoop() {
+	ticker := time.NewTicker(remoteHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		e.expireLeases(time.Now())
+	}
+}
+
+// expireLeases requeues the tasks whose remote claim expired before now. The
+// ones that were killed meanwhile are canceled instead.
+func (e *Engine) expireLeases(now time.Time) {
+	var expired []string
+	e.leasesLk.Lock()
+	for id, l := range e.leases {
+		if now.After(l.deadline) {
+			expired = append(expired, id)
+			delete(e.leases, id)
+		}
+	}
+	e.leasesLk.Unlock()
+
+	for _, id := range expired {
+		log := logging.S().With("task_id", id)
+		killed := e.killed(id)
+		e.deleteSignal(id)
+
+		tsk, err := e.store.Get(id)
+		if err != nil {
+			log.Errorw("failed to load task whose remote claim expired", "err", err)
+			continue
+		}
+		if tsk.Input, err = unmarshalTaskInput(tsk); err != nil {
+			log.Errorw("failed to decode the input of task whose remote claim expired", "err", err)
+			continue
+		}
+
+		if killed {
+			log.Infow("canceling killed task whose remote claim expired")
+			tsk.Error = errLeaseExpired
+			tsk.States = append(tsk.States, task.DatedState{State: task.StateCanceled, Created: now.UTC()})
+			err = e.local.Finished(tsk)
+		} else {
+			log.Infow("requeuing task whose remote claim expired")
+			if tsk.State().State != task.StateScheduled {
+				tsk.States = append(tsk.States, task.DatedState{State: task.StateScheduled, Created: now.UTC()})
+			}
+			err = e.queue.Requeue(tsk, errLeaseExpired)
+		}
+		if err != nil {
+			log.Errorw("failed to release task whose remote claim expired", "err", err)
+		}
+	}
+}
+
+// killed returns whether a task claimed by a remote worker has been killed.
+func (e *Engine) killed(id string) bool {
+	e.signalsLk.RLock()
+	ch, ok := e.signals[id]
+	e.signalsLk.RUnlock()
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// AppendTaskLog appends the output of a remote worker to the log of a task,
+// if the worker holds the lease on it.
+func (e *Engine) AppendTaskLog(taskID string, lease string, r io.Reader) error {
+	if _, err := e.store.Get(taskID); err != nil {
+		return err
+	}
+	if !e.renewLease(taskID, lease) {
+		return fmt.Errorf("claim of task %s has expired", taskID)
+	}
+
+	f, err := os.OpenFile(e.taskLogPath(filepath.Base(taskID)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// unmarshalTaskInput decodes the input of a task read from the storage, which
+// is left untyped.
+func unmarshalTaskInput(tsk *task.Task) (interface{}, error) {
+	b, err := json.Marshal(tsk)
+	if err != nil {
+		return nil, err
+	}
+	typed, err := UnmarshalTask(b)
+	if err != nil {
+		return nil, err
+	}
+	return typed.Input, nil
+}
+
+// taskInputSources returns the sources of a task, if it has any.
+func taskInputSources(tsk *task.Task) *api.UnpackedSources {
+	switch in := tsk.Input.(type) {
+	case *RunInput:
+		return in.Sources
+	case *BuildInput:
+		return in.Sources
+	}
+	return nil
+}
+
+// archiveDir writes the regular files, directories and symlinks under dir
+// as a gzipped tarball.
+func archiveDir(dir string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		var link string
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !fi.Mode().IsRegular() && !fi.IsDir():
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractDir extracts a tarball produced by archiveDir into dir.
+func extractDir(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return extractTar(gz, dir)
+}
+
+// extractTar extracts the directories, regular files and symlinks of an
+// uncompressed tarball into dir.
+func extractTar(r io.Reader, dir string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		// entries must land within dir, even through the symlinks extracted
+		// so far.
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, parent); err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, path)
+		case tar.TypeReg:
+			var f *os.File
+			if f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		default:
+			err = errors.New("unsupported entry in archive: " + hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func newSchedulerEngine(t *testing.T) *Engine {
+	store, err := task.NewMemoryTaskStorage()
+	require.NoError(t, err)
+	queue, err := task.NewQueue(store, 10, UnmarshalTask)
+	require.NoError(t, err)
+
+	cfg := &config.EnvConfig{}
+	cfg.Daemon.Scheduler.TaskRepoType = "memory"
+
+	e := &Engine{envcfg: cfg, store: store, queue: queue, signals: make(map[string]chan int), leases: make(map[string]remoteLease)}
+	e.local = newLocalTasks(e)
+	return e
+}
+
+func TestRemoteWorkerClaimsAndReports(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	sched := newSchedulerEngine(t)
+	require.NoError(t, sched.envcfg.Load())
+
+	// queue a build task, with sources.
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "plan"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "plan", "main.go"), []byte("package main"), 0644))
+	tsk := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ed0",
+		Type:   task.TypeBuild,
+		States: []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}},
+		Input: &BuildInput{
+			BuildRequest: &api.BuildRequest{},
+			Sources:      &api.UnpackedSources{BaseDir: base, PlanDir: filepath.Join(base, "plan")},
+		},
+	}
+	require.NoError(t, sched.queue.Push(tsk))
+
+	// serve the scheduler as the daemon would.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/worker/claim", func(w http.ResponseWriter, r *http.Request) {
+		tsk, lease, err := sched.ClaimTask()
+		require.NoError(t, err)
+		if tsk == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set(api.WorkerLeaseHeader, lease)
+		_ = json.NewEncoder(w).Encode(tsk)
+	})
+	mux.HandleFunc("/worker/sources", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, sched.TaskSources(r.URL.Query().Get("task_id"), w))
+	})
+	mux.HandleFunc("/worker/update", func(w http.ResponseWriter, r *http.Request) {
+		var tsk task.Task
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&tsk))
+		killed, err := sched.ReportTask(r.URL.Query().Get("event"), r.Header.Get(api.WorkerLeaseHeader), &tsk)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.WorkerUpdateResponse{Killed: killed})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	worker := &Engine{envcfg: &config.EnvConfig{}, signals: make(map[string]chan int)}
+	require.NoError(t, worker.envcfg.Load())
+	remote := newRemoteTasks(worker, srv.URL, "")
+
+	got, err := remote.Pop()
+	require.NoError(t, err)
+	require.Equal(t, tsk.ID, got.ID)
+
+	// sources were fetched and rebased onto the worker's work dir.
+	sources := got.Input.(*BuildInput).Sources
+	require.NotEqual(t, base, sources.BaseDir)
+	b, err := os.ReadFile(filepath.Join(sources.PlanDir, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main", string(b))
+
+	_, err = remote.Pop()
+	require.Equal(t, task.ErrQueueEmpty, err)
+
+	// start the task, and kill it on the scheduler.
+	got.States = append(got.States, task.DatedState{State: task.StateProcessing, Created: time.Now().UTC()})
+	killed, err := remote.report(api.WorkerEventStarted, got)
+	require.NoError(t, err)
+	require.False(t, killed)
+
+	require.NoError(t, sched.Kill(got.ID))
+	killed, err = remote.report(api.WorkerEventHeartbeat, &task.Task{ID: got.ID})
+	require.NoError(t, err)
+	require.True(t, killed)
+
+	got.States = append(got.States, task.DatedState{State: task.StateCanceled, Created: time.Now().UTC()})
+	require.NoError(t, remote.Finished(got))
+
+	stored, err := sched.GetTask(got.ID)
+	require.NoError(t, err)
+	require.Equal(t, task.StateCanceled, stored.State().State)
+
+	// reports about finished tasks are refused.
+	_, err = remote.report(api.WorkerEventProgress, got)
+	require.Error(t, err)
+}
+
+func TestExpiredRemoteClaimsAreRequeued(t *testing.T) {
+	sched := newSchedulerEngine(t)
+
+	scheduled := []task.DatedState{{State: task.StateScheduled, Created: time.Now().UTC()}}
+	build := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ed0",
+		Type:   task.TypeBuild,
+		States: scheduled,
+		Input:  &BuildInput{BuildRequest: &api.BuildRequest{}},
+	}
+	run := &task.Task{
+		ID:     "c60i0d2llu6a7gha3ee0",
+		Type:   task.TypeRun,
+		States: scheduled,
+		Input:  &RunInput{RunRequest: &api.RunRequest{}},
+	}
+	leases := make(map[string]string)
+	for _, tsk := range []*task.Task{build, run} {
+		require.NoError(t, sched.queue.Push(tsk))
+		claimed, lease, err := sched.ClaimTask()
+		require.NoError(t, err)
+		require.Equal(t, tsk.ID, claimed.ID)
+		leases[tsk.ID] = lease
+	}
+
+	// the run is killed, and both workers go silent.
+	require.NoError(t, sched.Kill(run.ID))
+	sched.expireLeases(time.Now().Add(remoteLeaseTTL / 2))
+	killed, err := sched.ReportTask(api.WorkerEventHeartbeat, leases[build.ID], &task.Task{ID: build.ID})
+	require.NoError(t, err)
+	require.False(t, killed)
+
+	sched.expireLeases(time.Now().Add(2 * remoteLeaseTTL))
+
+	// the build can be claimed again, and the run is canceled.
+	tsk, lease, err := sched.ClaimTask()
+	require.NoError(t, err)
+	require.Equal(t, build.ID, tsk.ID)
+	require.NotEqual(t, leases[build.ID], lease)
+
+	tsk, err = sched.store.Get(run.ID)
+	require.NoError(t, err)
+	require.Equal(t, task.StateCanceled, tsk.State().State)
+	require.Equal(t, errLeaseExpired, tsk.Error)
+
+	// the workers are told to stop, should they come back, and can't
+	// overwrite the state or log of the new claim of the build.
+	killed, err = sched.ReportTask(api.WorkerEventHeartbeat, leases[build.ID], &task.Task{ID: build.ID})
+	require.NoError(t, err)
+	require.True(t, killed)
+	_, err = sched.ReportTask(api.WorkerEventProgress, leases[build.ID], &task.Task{ID: build.ID})
+	require.Error(t, err)
+	require.Error(t, sched.AppendTaskLog(build.ID, leases[build.ID], strings.NewReader("stale")))
+
+	killed, err = sched.ReportTask(api.WorkerEventHeartbeat, lease, &task.Task{ID: build.ID})
+	require.NoError(t, err)
+	require.False(t, killed)
+}
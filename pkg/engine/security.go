@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+// ErrSecurityNotAllowed is returned for groups requesting a security context
+// the daemon doesn't allow.
+var ErrSecurityNotAllowed = errors.New("security context not allowed by the daemon")
+
+// checkSecurity checks the security context requested by a group against the
+// allow-list of the daemon.
+func checkSecurity(cfg config.SecurityConfig, groupID string, s api.Security) error {
+	if s.Privileged && !cfg.AllowPrivileged {
+		return fmt.Errorf("%w: group %s requests privileged instances", ErrSecurityNotAllowed, groupID)
+	}
+	if s.Seccomp == api.SeccompUnconfined && !cfg.AllowUnconfined {
+		return fmt.Errorf("%w: group %s requests unconfined seccomp", ErrSecurityNotAllowed, groupID)
+	}
+
+	allowed := make(map[string]struct{}, len(cfg.AllowedCapabilities))
+	for _, c := range (api.Security{CapAdd: cfg.AllowedCapabilities}).Capabilities() {
+		allowed[c] = struct{}{}
+	}
+	var denied []string
+	for _, c := range s.Capabilities() {
+		if _, ok := allowed[c]; !ok {
+			denied = append(denied, c)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: group %s requests capabilities %s", ErrSecurityNotAllowed, groupID, strings.Join(denied, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+)
+
+func TestCheckSecurity(t *testing.T) {
+	cfg := config.SecurityConfig{AllowedCapabilities: []string{"net_admin"}}
+
+	require.NoError(t, checkSecurity(cfg, "a", api.Security{}))
+	require.NoError(t, checkSecurity(cfg, "a", api.Security{CapAdd: []string{"CAP_NET_ADMIN"}, Seccomp: api.SeccompDefault}))
+
+	for _, s := range []api.Security{
+		{CapAdd: []string{"NET_ADMIN", "SYS_ADMIN"}},
+		{Privileged: true},
+		{Seccomp: api.SeccompUnconfined},
+	} {
+		require.True(t, errors.Is(checkSecurity(cfg, "a", s), ErrSecurityNotAllowed), s)
+	}
+
+	cfg.AllowPrivileged = true
+	cfg.AllowUnconfined = true
+	require.NoError(t, checkSecurity(cfg, "a", api.Security{Privileged: true, Seccomp: api.SeccompUnconfined}))
+}
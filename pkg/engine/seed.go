@@ -0,0 +1,20 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// newRunSeed picks a random seed for a run that doesn't set one. Seeds are
+// positive, so that they read the same whatever the notation.
+func newRunSeed() (int64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if s := int64(binary.BigEndian.Uint64(b[:]) >> 1); s != 0 {
+			return s, nil
+		}
+	}
+}
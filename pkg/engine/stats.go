@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/metrics"
+	"github.com/testground/testground/pkg/task"
+)
+
+// maxStatsWindows bounds the number of windows a trend is broken down into.
+const maxStatsWindows = 1000
+
+// Stats summarizes the outcomes and durations of the runs archived in the
+// task store that completed since req.Since, by test case, along with the
+// metrics they recorded, if requested.
+func (e *Engine) Stats(req *api.StatsRequest) ([]api.CaseStats, error) {
+	var agg runAggregator
+	if len(req.Metrics) > 0 {
+		mv, err := metrics.NewViewer(e.envcfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate metrics: %w", err)
+		}
+		agg = mv
+	}
+	return e.stats(agg, req)
+}
+
+// stats computes the statistics requested by req; agg aggregates the metrics
+// of runs, and may be nil if none are requested.
+func (e *Engine) stats(agg runAggregator, req *api.StatsRequest) ([]api.CaseStats, error) {
+	now := time.Now().UTC()
+	since := req.Since.UTC()
+	if !since.Before(now) {
+		return nil, errors.New("the start of the span must be in the past")
+	}
+	// the span is rounded to the second, so that a span given relative to
+	// the time of the request doesn't end with a sliver of a window.
+	span := now.Sub(since).Round(time.Second)
+	if span <= 0 {
+		span = now.Sub(since)
+	}
+	window := req.Window
+	if window <= 0 {
+		window = span
+	}
+	if span/window >= maxStatsWindows {
+		return nil, errors.New("too many windows; use a wider window, or a shorter span")
+	}
+
+	// tasks are keyed by the time they were created, which is before they
+	// completed.
+	tsks, err := e.store.Filter(task.StateComplete, since, now.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ plan, tcase string }
+	runs := make(map[key][]*task.Task)
+	for _, tsk := range tsks {
+		if tsk.Type != task.TypeRun || len(tsk.States) == 0 || tsk.State().Created.Before(since) {
+			continue
+		}
+		if (req.TestPlan != "" && tsk.Plan != req.TestPlan) || (req.TestCase != "" && tsk.Case != req.TestCase) {
+			continue
+		}
+		k := key{tsk.Plan, tsk.Case}
+		runs[k] = append(runs[k], tsk)
+	}
+
+	// the metrics of each run are aggregated once, for the summary and the
+	// window they fall in.
+	aggs := make(map[string][]metrics.Aggregate)
+	if agg != nil {
+		for k, tsks := range runs {
+			for _, tsk := range tsks {
+				a, err := agg.RunAggregates(metrics.StreamResults, clean(k.plan)+"-"+k.tcase, tsk.ID)
+				if err != nil {
+					logging.S().Warnw("could not aggregate the metrics of a run", "task_id", tsk.ID, "err", err)
+					continue
+				}
+				aggs[tsk.ID] = a
+			}
+		}
+	}
+
+	stats := make([]api.CaseStats, 0, len(runs))
+	for k, tsks := range runs {
+		cs := api.CaseStats{
+			Plan:    k.plan,
+			Case:    k.tcase,
+			Summary: windowStats(since, now, tsks, aggs, req.Metrics),
+		}
+		for start := since; start.Before(since.Add(span)); start = start.Add(window) {
+			end := start.Add(window)
+			var in []*task.Task
+			for _, tsk := range tsks {
+				if done := tsk.State().Created; !done.Before(start) && done.Before(end) {
+					in = append(in, tsk)
+				}
+			}
+			cs.Trend = append(cs.Trend, windowStats(start, end, in, aggs, req.Metrics))
+		}
+		stats = append(stats, cs)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Plan != stats[j].Plan {
+			return stats[i].Plan < stats[j].Plan
+		}
+		return stats[i].Case < stats[j].Case
+	})
+	return stats, nil
+}
+
+// windowStats computes the statistics of the supplied runs, which completed
+// between start and end, and aggregates the values of the named metrics out
+// of the aggregates of the runs, by task ID.
+func windowStats(start, end time.Time, tsks []*task.Task, aggs map[string][]metrics.Aggregate, names []string) api.WindowStats {
+	ws := api.WindowStats{Start: start, End: end, Runs: len(tsks)}
+
+	var (
+		durations []time.Duration
+		total     time.Duration
+		ok        int
+	)
+	for _, tsk := range tsks {
+		outcome, err := data.DecodeTaskOutcome(tsk)
+		switch {
+		case err != nil:
+			continue
+		case outcome == task.OutcomeCanceled:
+			ws.Canceled++
+		case tsk.Error != "":
+			// runs that errored may not have a result to tell.
+			ws.Failures++
+		case data.IsOutcomeSuccess(outcome):
+			ws.Successes++
+		default:
+			ws.Failures++
+		}
+
+		if d, found := processingTime(tsk); found {
+			durations = append(durations, d)
+			total += d
+		}
+
+		if tsk.Result == nil {
+			continue
+		}
+		res := data.DecodeRunnerResult(tsk.Result)
+		for _, g := range res.Outcomes {
+			if g == nil {
+				continue
+			}
+			ws.Instances += g.Total
+			ok += g.Ok
+		}
+		ws.Crashes += len(res.Crashes)
+	}
+
+	if n := ws.Successes + ws.Failures; n > 0 {
+		ws.PassRate = float64(ws.Successes) / float64(n)
+	}
+	if ws.Instances > 0 {
+		ws.InstancePassRate = float64(ok) / float64(ws.Instances)
+	}
+	if n := len(durations); n > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		ws.MeanDuration = (total / time.Duration(n)).Truncate(time.Second)
+		ws.MedianDuration = durations[n/2].Truncate(time.Second)
+		ws.P95Duration = durations[(n*95-1)/100].Truncate(time.Second)
+	}
+
+	for _, name := range names {
+		ws.Metrics = append(ws.Metrics, metricStats(name, tsks, aggs))
+	}
+	return ws
+}
+
+// metricStats aggregates the values a metric took in the supplied runs, out
+// of their aggregates by group.
+func metricStats(name string, tsks []*task.Task, aggs map[string][]metrics.Aggregate) api.MetricStats {
+	ms := api.MetricStats{Metric: name}
+
+	var (
+		sum, p95 float64
+		groups   int
+	)
+	for _, tsk := range tsks {
+		recorded := false
+		for _, a := range aggs[tsk.ID] {
+			if measurementMetric(a.Measurement, clean(tsk.Plan)+"-"+tsk.Case) != name || a.Count == 0 {
+				continue
+			}
+			if groups == 0 || a.Min < ms.Min {
+				ms.Min = a.Min
+			}
+			if groups == 0 || a.Max > ms.Max {
+				ms.Max = a.Max
+			}
+			ms.Count += a.Count
+			sum += a.Mean * float64(a.Count)
+			p95 += a.P95
+			groups++
+			recorded = true
+		}
+		if recorded {
+			ms.Runs++
+		}
+	}
+
+	if ms.Count > 0 {
+		ms.Mean = sum / float64(ms.Count)
+		ms.P95 = p95 / float64(groups)
+	}
+	return ms
+}
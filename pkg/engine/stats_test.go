@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestStats(t *testing.T) {
+	e := newSchedulerEngine(t)
+	now := time.Now().UTC()
+
+	// archive archives a run of the supplied test case, which completed at
+	// the supplied time after processing for took.
+	archive := func(tcase string, done time.Time, took time.Duration, state task.State, outcome task.Outcome, ok int) string {
+		tsk := &task.Task{
+			ID:   xid.NewWithTime(done.Add(-took)).String(),
+			Type: task.TypeRun,
+			Plan: "network",
+			Case: tcase,
+			States: []task.DatedState{
+				{State: task.StateScheduled, Created: done.Add(-took)},
+				{State: task.StateProcessing, Created: done.Add(-took)},
+				{State: state, Created: done},
+			},
+			Result: &runner.Result{
+				Outcome:  outcome,
+				Outcomes: map[string]*runner.GroupOutcome{"peers": {Ok: ok, Total: 10}},
+			},
+		}
+		require.NoError(t, e.store.PersistProcessing(tsk))
+		require.NoError(t, e.store.ArchiveTask(tsk))
+		return tsk.ID
+	}
+
+	first := archive("ping-pong", now.Add(-50*time.Hour), 10*time.Minute, task.StateComplete, task.OutcomeSuccess, 10)
+	second := archive("ping-pong", now.Add(-30*time.Hour), 20*time.Minute, task.StateComplete, task.OutcomeFailure, 5)
+	last := archive("ping-pong", now.Add(-2*time.Hour), 30*time.Minute, task.StateComplete, task.OutcomeSuccess, 10)
+	archive("ping-pong", now.Add(-time.Hour), time.Minute, task.StateCanceled, task.OutcomeCanceled, 0)
+	archive("traffic", now.Add(-time.Hour), time.Hour, task.StateComplete, task.OutcomeSuccess, 10)
+	// too old to count.
+	archive("ping-pong", now.Add(-100*time.Hour), time.Hour, task.StateComplete, task.OutcomeFailure, 0)
+
+	stats, err := e.Stats(&api.StatsRequest{
+		TestCase: "ping-pong",
+		Since:    now.Add(-72 * time.Hour),
+		Window:   24 * time.Hour,
+	})
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+
+	s := stats[0].Summary
+	require.Equal(t, 4, s.Runs)
+	require.Equal(t, 2, s.Successes)
+	require.Equal(t, 1, s.Failures)
+	require.Equal(t, 1, s.Canceled)
+	require.InDelta(t, 2.0/3, s.PassRate, 0.001)
+	require.Equal(t, 40, s.Instances)
+	require.InDelta(t, 25.0/40, s.InstancePassRate, 0.001)
+	require.Equal(t, 20*time.Minute, s.MedianDuration)
+	require.Equal(t, 30*time.Minute, s.P95Duration)
+
+	// one run in each of the first two days, the rest on the last one.
+	trend := stats[0].Trend
+	require.Len(t, trend, 3)
+	require.Equal(t, 1, trend[0].Runs)
+	require.Equal(t, 1.0, trend[0].PassRate)
+	require.Equal(t, 1, trend[1].Runs)
+	require.Equal(t, 0.0, trend[1].PassRate)
+	require.Equal(t, 2, trend[2].Runs)
+
+	// without a window, the trend is the summary.
+	stats, err = e.Stats(&api.StatsRequest{Since: now.Add(-72 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	require.Equal(t, "traffic", stats[1].Case)
+	require.Len(t, stats[1].Trend, 1)
+	require.Equal(t, 1, stats[1].Trend[0].Runs)
+
+	// metrics are aggregated by window, across runs and groups.
+	const latency = "results.network-ping-pong.latency.ms.histogram"
+	agg := runsAggregator{
+		first: {{Measurement: latency, GroupID: "peers", Count: 10, Mean: 10, Min: 5, Max: 20, P95: 18}},
+		second: {
+			{Measurement: latency, GroupID: "peers", Count: 10, Mean: 20, Min: 10, Max: 40, P95: 30},
+			{Measurement: latency, GroupID: "seeds", Count: 30, Mean: 40, Min: 1, Max: 50, P95: 50},
+		},
+		last: {{Measurement: "results.network-ping-pong.bandwidth.point", GroupID: "peers", Count: 1, Mean: 100}},
+	}
+	stats, err = e.stats(agg, &api.StatsRequest{
+		TestCase: "ping-pong",
+		Since:    now.Add(-72 * time.Hour),
+		Window:   24 * time.Hour,
+		Metrics:  []string{"latency.ms"},
+	})
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+
+	m := stats[0].Summary.Metrics
+	require.Len(t, m, 1)
+	require.Equal(t, api.MetricStats{Metric: "latency.ms", Runs: 2, Count: 50, Mean: 30, Min: 1, Max: 50, P95: 98.0 / 3}, m[0])
+
+	trend = stats[0].Trend
+	require.Equal(t, api.MetricStats{Metric: "latency.ms", Runs: 1, Count: 10, Mean: 10, Min: 5, Max: 20, P95: 18}, trend[0].Metrics[0])
+	require.Equal(t, 35.0, trend[1].Metrics[0].Mean)
+	// windows without values still list the metric.
+	require.Equal(t, api.MetricStats{Metric: "latency.ms"}, trend[2].Metrics[0])
+}
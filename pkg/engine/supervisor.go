@@ -13,12 +13,14 @@ import (
 	"github.com/google/uuid"
 	"github.com/logrusorgru/aurora"
 	"github.com/otiai10/copy"
+	"github.com/testground/testground/pkg/build"
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
 	"github.com/testground/testground/pkg/runner"
 	"github.com/testground/testground/pkg/task"
+	"github.com/testground/testground/pkg/version"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -38,23 +40,49 @@ func (e *Engine) addSignal(id string, ch chan int) {
 	e.signalsLk.Unlock()
 }
 
+// signal closes the signal channel of a task, if it wasn't already, which
+// cancels the task.
+func (e *Engine) signal(id string) {
+	e.signalsLk.Lock()
+	defer e.signalsLk.Unlock()
+
+	ch, ok := e.signals[id]
+	if !ok {
+		return
+	}
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
 func (e *Engine) deleteSignal(id string) {
 	e.signalsLk.Lock()
 	delete(e.signals, id)
 	e.signalsLk.Unlock()
 }
 
-func (e *Engine) worker(n int) {
+func (e *Engine) worker(n int, src taskSource) {
 	logging.S().Infow("supervisor worker started", "worker_id", n)
 	taskTimeout := 10 * time.Minute
 	if e.EnvConfig().Daemon.Scheduler.TaskTimeoutMin != 0 {
 		taskTimeout = time.Duration(e.EnvConfig().Daemon.Scheduler.TaskTimeoutMin) * time.Minute
 	}
 
+	engineCtx := e.Context()
 	for {
-		tsk, err := e.queue.Pop()
+		if engineCtx.Err() != nil {
+			logging.S().Infow("supervisor worker stopped", "worker_id", n)
+			return
+		}
+
+		tsk, err := src.Pop()
 		if err == task.ErrQueueEmpty {
-			time.Sleep(time.Second)
+			select {
+			case <-engineCtx.Done():
+			case <-time.After(time.Second):
+			}
 			continue
 		}
 
@@ -64,9 +92,12 @@ func (e *Engine) worker(n int) {
 		}
 
 		func() {
-			ctx, cancel := context.WithTimeout(context.Background(), taskTimeout)
+			ctx, cancel := withPausableTimeout(engineCtx, timeoutFor(tsk, taskTimeout))
 			defer cancel()
 
+			e.addTimeout(tsk.ID, ctx)
+			defer e.deleteTimeout(tsk.ID)
+
 			ch := make(chan int)
 			e.addSignal(tsk.ID, ch)
 
@@ -84,19 +115,13 @@ func (e *Engine) worker(n int) {
 				State:   task.StateProcessing,
 				Created: time.Now().UTC(),
 			})
-			err = e.store.PersistProcessing(tsk)
+			err = src.Started(tsk)
 			if err != nil {
 				logging.S().Errorw("could not persist task", "err", err)
 			}
 			logging.S().Infow("worker processing task", "worker_id", n, "task_id", tsk.ID)
-			err = e.postStatusToGithub(tsk)
-			if err != nil {
-				logging.S().Errorw("could not post status to github", "err", err)
-			}
 
-			// Create a packing directory under the work dir.
-			file := filepath.Join(e.EnvConfig().Dirs().Daemon(), tsk.ID+".out")
-			f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			f, err := src.Log(tsk)
 			if err != nil {
 				logging.S().Errorw("could not create stop log", "err", err)
 				return
@@ -108,10 +133,14 @@ func (e *Engine) worker(n int) {
 			var result interface{}
 			var errTask error
 
+			phases := newPhaseReporter(tsk, src)
+
 			switch tsk.Type {
 			case task.TypeRun:
 				var res *api.RunOutput
-				res, errTask = e.doRun(ctx, tsk.ID, tsk.Input.(*RunInput), ow)
+				stopEstimates := e.reportEstimates(tsk, ow)
+				res, errTask = e.doRun(ctx, tsk.ID, tsk.Input.(*RunInput), ow, newBuildStatusReporter(tsk, src), phases)
+				stopEstimates()
 
 				if errTask != nil {
 					errTask = &TaskExecutionError{TaskType: string(tsk.Type), WrappedErr: errTask}
@@ -124,7 +153,9 @@ func (e *Engine) worker(n int) {
 				}
 			case task.TypeBuild:
 				var res []*api.BuildOutput
-				res, errTask = e.doBuild(ctx, tsk.Input.(*BuildInput), ow)
+				bow, closeBuildLog := e.buildLogWriter(tsk.ID, ow)
+				res, errTask = e.doBuild(ctx, tsk.ID, tsk.Input.(*BuildInput), bow, newBuildStatusReporter(tsk, src))
+				closeBuildLog()
 				if errTask != nil {
 					errTask = &TaskExecutionError{TaskType: string(tsk.Type), WrappedErr: errTask}
 					logging.S().Errorw("doBuild returned err", "err", errTask)
@@ -143,6 +174,8 @@ func (e *Engine) worker(n int) {
 				return
 			}
 
+			phases.end()
+
 			newState := task.DatedState{
 				Created: time.Now().UTC(),
 				State:   task.StateComplete,
@@ -162,27 +195,12 @@ func (e *Engine) worker(n int) {
 			tsk.States = append(tsk.States, newState)
 			tsk.Result = result
 
-			err = e.store.PersistProcessing(tsk)
-			if err != nil {
-				logging.S().Errorw("could not persist task", "err", err)
-				return
-			}
-
-			err = e.store.ArchiveTask(tsk)
+			err = src.Finished(tsk)
 			if err != nil {
 				logging.S().Errorw("could not archive task", "err", err)
 				return
 			}
 
-			err = e.postStatusToSlack(tsk)
-			if err != nil {
-				logging.S().Errorw("could not send status to slack", "err", err)
-			}
-			err = e.postStatusToGithub(tsk)
-			if err != nil {
-				logging.S().Errorw("could not post status to github", "err", err)
-			}
-
 			e.deleteSignal(tsk.ID)
 			logging.S().Infow("worker completed task", "worker_id", n, "task_id", tsk.ID)
 		}()
@@ -295,7 +313,20 @@ func (e *Engine) postStatusToSlack(tsk *task.Task) error {
 	return nil
 }
 
-func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputWriter) ([]*api.BuildOutput, error) {
+// buildLogWriter returns an OutputWriter that captures the builder output of
+// a task into its build log, in addition to emitting it through ow. The
+// returned function closes the build log. If the build log can't be created,
+// ow is returned unchanged.
+func (e *Engine) buildLogWriter(id string, ow *rpc.OutputWriter) (*rpc.OutputWriter, func()) {
+	f, err := os.OpenFile(e.buildLogPath(id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		ow.Warnw("could not create build log; build output will only be in the task log", "err", err)
+		return ow, func() {}
+	}
+	return ow.Tee(f), func() { _ = f.Close() }
+}
+
+func (e *Engine) doBuild(ctx context.Context, id string, input *BuildInput, ow *rpc.OutputWriter, builds *buildStatusReporter) ([]*api.BuildOutput, error) {
 	sources := input.Sources
 	comp, err := input.Composition.PrepareForBuild(&input.Manifest)
 
@@ -320,6 +351,10 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 		if !ok {
 			return nil, fmt.Errorf("unrecognized builder: %s", b)
 		}
+
+		if err := build.CheckAirGapped(b, e.envcfg.AirGapped); err != nil {
+			return nil, err
+		}
 	}
 
 	// Call healthcheck on the builders
@@ -408,22 +443,32 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 		src := finalSources[cnt]
 		cnt++
 
+		// Every Group in `idxs`` have the same build key. They are identitical when it comes to build,
+		// so it's safe to use the first one to build them all.
+		grp := comp.Groups[idxs[0]]
+
+		// Pluck all IDs from the groups this build artifact is for.
+		grpids := make([]string, 0, len(idxs))
+		for _, idx := range idxs {
+			grpids = append(grpids, comp.Groups[idx].ID)
+		}
+
+		// Report the build as pending until a build slot frees up.
+		status := builds.add(grpids, grp.Builder)
+
 		errGroup.Go(func() (err error) {
-			// Every Group in `idxs`` have the same build key. They are identitical when it comes to build,
-			// so it's safe to use the first one to build them all.
-			grp := comp.Groups[idxs[0]]
-
-			// Pluck all IDs from the groups this build artifact is for.
-			grpids := make([]string, 0, len(idxs))
-			for _, idx := range idxs {
-				grpids = append(grpids, comp.Groups[idx].ID)
-			}
+			defer func() {
+				if err != nil {
+					builds.update(status, task.BuildStateFailed, "", err)
+				}
+			}()
 
 			// get the builder
 			builder := grp.Builder
 			bm := e.builders[builder]
 
 			ow.Infow("performing build for groups", "plan", plan, "groups", grpids, "builder", builder)
+			builds.update(status, task.BuildStateBuilding, "", nil)
 
 			deps := make(map[string]api.DependencyTarget, len(grp.Build.Dependencies))
 
@@ -463,6 +508,32 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 				BuildConfig:     obj,
 				UnpackedSources: src,
 			}
+			in.Metadata = api.BuildMetadata{
+				TaskID:  id,
+				BuildID: in.BuildID,
+				Plan:    comp.Global.Plan,
+				Case:    comp.Global.Case,
+				User:    input.CreatedBy.User,
+				Repo:    input.CreatedBy.Repo,
+				Branch:  input.CreatedBy.Branch,
+				Commit:  input.CreatedBy.Commit,
+			}
+
+			// Hash the sources before building, as builders may write into
+			// them; only when they are pinned, or attested to by a signature.
+			var sourceHash string
+			if input.SourceHash != "" || e.envcfg.Daemon.Provenance.SignKey != "" {
+				if sourceHash, err = hashSources(src.BaseDir); err != nil {
+					return fmt.Errorf("failed to hash build sources: %w", err)
+				}
+			}
+			if input.SourceHash != "" && input.SourceHash != sourceHash {
+				return fmt.Errorf("build sources differ from the expected ones: expected source hash %s, got %s", input.SourceHash, sourceHash)
+			}
+
+			if err := e.runPreBuildHook(errGroupCtx, &input.Manifest, in.BuildID, builder, src, ow); err != nil {
+				return err
+			}
 
 			res, err := bm.Build(errGroupCtx, in, ow)
 			if err != nil {
@@ -470,7 +541,27 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 				return err
 			}
 
+			digest, err := e.artifactDigest(errGroupCtx, res.ArtifactPath)
+			if err != nil {
+				return err
+			}
+
 			res.BuilderID = bm.ID()
+			res.Provenance = &api.Provenance{
+				ArtifactPath:   res.ArtifactPath,
+				ArtifactDigest: digest,
+				BuilderID:      res.BuilderID,
+				TestPlan:       plan,
+				SourceHash:     sourceHash,
+				BuildConfig:    obj,
+				Dependencies:   res.Dependencies,
+				DaemonVersion:  version.GitCommit,
+				BuiltAt:        time.Now().UTC(),
+			}
+
+			if err := e.recordProvenance(errGroupCtx, res.Provenance, ow); err != nil {
+				return err
+			}
 
 			// no need for a mutex as the indices we access do not intersect
 			// across goroutines.
@@ -479,6 +570,7 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 			}
 
 			ow.Infow("build succeeded", "plan", plan, "groups", grpids, "builder", builder, "artifact", res.ArtifactPath)
+			builds.update(status, task.BuildStateSucceeded, res.ArtifactPath, nil)
 			return nil
 		})
 	}
@@ -491,20 +583,26 @@ func (e *Engine) doBuild(ctx context.Context, input *BuildInput, ow *rpc.OutputW
 	return ress, nil
 }
 
-func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.OutputWriter) (*api.RunOutput, error) {
+func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.OutputWriter, builds *buildStatusReporter, phases *phaseReporter) (*api.RunOutput, error) {
 	if len(input.BuildGroups) > 0 {
+		phases.EnterPhase(task.PhaseBuild)
+
 		bcomp, err := input.Composition.PickGroups(input.BuildGroups...)
 		if err != nil {
 			return nil, err
 		}
 
-		bout, err := e.doBuild(ctx, &BuildInput{
+		bow, closeBuildLog := e.buildLogWriter(id, ow)
+		bout, err := e.doBuild(ctx, id, &BuildInput{
 			BuildRequest: &api.BuildRequest{
 				Composition: bcomp,
 				Manifest:    input.Manifest,
+				CreatedBy:   input.CreatedBy,
+				SourceHash:  input.SourceHash,
 			},
 			Sources: input.Sources,
-		}, ow)
+		}, bow, builds)
+		closeBuildLog()
 		if err != nil {
 			return nil, err
 		}
@@ -526,8 +624,18 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 		return nil, err
 	}
 
+	// Pick a seed if the run doesn't set one; it's recorded with the
+	// composition of the run, which replays it.
+	if comp.Global.Seed == 0 {
+		if comp.Global.Seed, err = newRunSeed(); err != nil {
+			return nil, fmt.Errorf("failed to pick a seed for the run: %w", err)
+		}
+	}
+
 	compositionUsedForRun := comp
 
+	phases.EnterPhase(task.PhasePrepareInfra)
+
 	var (
 		plan    = comp.Global.Plan
 		tcase   = comp.Global.Case
@@ -594,6 +702,59 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 
 	compRun := framedComp.Runs[0]
 
+	startDelays, err := comp.Global.Stagger.StartDelays(int(compRun.TotalInstances))
+	if err != nil {
+		return nil, err
+	}
+
+	if w := comp.Global.StoreWriter; w != "" {
+		found := false
+		for _, g := range compRun.Groups {
+			found = found || g.ID == w
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown store writer group: %s", w)
+		}
+	}
+
+	if err := comp.Global.Roles.Validate(int(compRun.TotalInstances)); err != nil {
+		return nil, err
+	}
+
+	groupSizes := make(map[string]int, len(compRun.Groups))
+	for _, g := range compRun.Groups {
+		groupSizes[g.ID] = int(g.CalculatedInstanceCount())
+	}
+	churner, err := churnerFor(run, comp.Global.Churn, groupSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	if a := comp.Global.AttachTo; a != "" {
+		if err := e.checkAttach(ctx, a, trunner); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := comp.Global.Snapshot; s != nil {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		ss, ok := run.(api.Snapshotter)
+		if !ok {
+			return nil, fmt.Errorf("runner %s does not support snapshots", trunner)
+		}
+		if err := ss.CheckSnapshot(e.envcfg, s); err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := e.openRunStore(id, comp.Global.StoreWriter, comp.Global.Roles)
+	if err != nil {
+		return nil, err
+	}
+	defer e.closeRunStore(id)
+
 	in := api.RunInput{
 		RunID:          id,
 		EnvConfig:      *e.envcfg,
@@ -603,6 +764,12 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 		TotalInstances: int(compRun.TotalInstances),
 		Groups:         make([]*api.RunGroup, 0, len(compRun.Groups)),
 		DisableMetrics: comp.Global.DisableMetrics,
+		Seed:           comp.Global.Seed,
+		StartDelays:    startDelays,
+		Store:          store,
+		AttachTo:       comp.Global.AttachTo,
+		Snapshot:       comp.Global.Snapshot,
+		Phases:         phases,
 	}
 
 	for _, grp := range compRun.Groups {
@@ -617,14 +784,98 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 			ArtifactPath: buildgroup.Run.Artifact,
 			Parameters:   grp.TestParams,
 			Resources:    grp.Resources,
+			Mounts:       grp.Mounts,
+			Security:     grp.Security,
+			Placement:    grp.Placement,
 			Profiles:     grp.Profiles,
 		}
 
 		in.Groups = append(in.Groups, g)
 	}
 
-	ow.Infow("starting run", "run_id", id, "plan", in.TestPlan, "case", in.TestCase, "runner", trunner, "instances", in.TotalInstances)
+	// Refuse to run artifacts that weren't built by a trusted daemon.
+	for _, g := range in.Groups {
+		if err := e.verifyProvenance(ctx, g.ArtifactPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// The allow-list may have changed since the run was queued.
+	for _, g := range in.Groups {
+		if err := checkSecurity(e.EnvConfig().Daemon.Security, g.ID, g.Security); err != nil {
+			return nil, err
+		}
+	}
+
+	// Refuse to run artifacts that don't match their pinned digest.
+	for _, g := range in.Groups {
+		want, ok := input.ArtifactDigests[g.ArtifactPath]
+		if !ok {
+			continue
+		}
+		got, err := e.artifactDigest(ctx, g.ArtifactPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve digest of artifact %s: %w", g.ArtifactPath, err)
+		}
+		if got != want {
+			return nil, fmt.Errorf("artifact %s of group %s does not match its pinned digest: expected %s, got %s", g.ArtifactPath, g.ID, want, got)
+		}
+	}
+
+	// Keep an immutable record of what this run is made of.
+	rec := e.newRunRecord(ctx, compositionUsedForRun, &in, trunner, ow)
+	rec.CompositionRun = runId
+	if err := e.recordRun(ctx, rec); err != nil {
+		return nil, err
+	}
+
+	ctx, releaseLimits, err := e.applyRunLimits(ctx, &in, trunner, input.CreatedBy.Authenticated, ow)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLimits()
+
+	phases.EnterPhase(task.PhaseLaunch)
+	ow.Infow("starting run", "run_id", id, "plan", in.TestPlan, "case", in.TestCase, "runner", trunner, "instances", in.TotalInstances, "seed", in.Seed)
+	stopChurn := e.startChurn(ctx, churner, &in, comp.Global.Churn, ow)
 	out, err := run.Run(ctx, &in, ow)
+	stopChurn()
+
+	// An instance may have torn down the run; record why in its result.
+	if abort := e.runAbort(id); abort != nil {
+		if out == nil {
+			out = &api.RunOutput{RunID: id}
+		}
+		res, ok := out.Result.(*runner.Result)
+		if !ok || res == nil {
+			res = &runner.Result{}
+			out.Result = res
+		}
+		res.Outcome = task.OutcomeFailure
+		res.Abort = abort
+		err = errors.New(abort.String())
+	}
+
+	// Gate the run on the metrics it recorded.
+	if err == nil && len(comp.Global.Thresholds) > 0 {
+		if out == nil {
+			out = &api.RunOutput{RunID: id}
+		}
+		err = e.enforceThresholds(id, plan, tcase, comp.Global.Thresholds, out, ow)
+	}
+
+	// Analyse the outputs of the run with the hook of the plan, if any.
+	if input.Manifest.Hooks.PostRun != nil && !errors.Is(err, context.Canceled) {
+		outcome := task.OutcomeUnknown
+		if out != nil {
+			if res, ok := out.Result.(*runner.Result); ok && res != nil {
+				outcome = res.Outcome
+			}
+		}
+		if err := e.runPostRunHook(&input.Manifest, id, plan, tcase, trunner, outcome, ow); err != nil {
+			ow.Warnw("failed to analyse the outputs of the run", "run_id", id, "error", err)
+		}
+	}
 
 	if err == nil {
 		message := "run finished with outcome unknown"
@@ -641,6 +892,12 @@ func (e *Engine) doRun(ctx context.Context, id string, input *RunInput, ow *rpc.
 
 	if out != nil { // TODO: Make sure all runners return a value, and get rid of nil check
 		out.Composition = *compositionUsedForRun
+
+		if res, ok := out.Result.(*runner.Result); ok && len(res.Placement) > 0 {
+			if err := e.recordPlacement(id, res.Placement); err != nil {
+				ow.Warnw("failed to record the placement of instances", "err", err)
+			}
+		}
 	}
 
 	return out, err
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/data"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/metrics"
+	"github.com/testground/testground/pkg/task"
+)
+
+// sweepClockSkew bounds how far the clock of a client generating a sweep ID
+// may be ahead of the clock of the daemon.
+const sweepClockSkew = time.Hour
+
+// SweepReport joins the runs of a sweep, with the metrics they recorded on the
+// results stream. Metrics are left out if InfluxDB can't be reached.
+func (e *Engine) SweepReport(sweep string) (*api.SweepReport, error) {
+	var agg runAggregator
+	if mv, err := metrics.NewViewer(e.envcfg); err != nil {
+		logging.S().Warnw("reporting on sweep without metrics", "sweep", sweep, "err", err)
+	} else {
+		agg = mv
+	}
+	return e.sweepReport(agg, sweep)
+}
+
+func (e *Engine) sweepReport(agg runAggregator, sweep string) (*api.SweepReport, error) {
+	id, err := xid.FromString(sweep)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sweep ID: %s", sweep)
+	}
+
+	// tasks are keyed by the time they were created, after the client
+	// generated the ID of their sweep.
+	var (
+		since = id.Time().Add(-sweepClockSkew)
+		until = time.Now().Add(time.Second)
+		tsks  []*task.Task
+	)
+	for _, state := range []task.State{task.StateScheduled, task.StateProcessing, task.StateComplete} {
+		found, err := e.store.Filter(state, since, until)
+		if err != nil {
+			return nil, err
+		}
+		for _, tsk := range found {
+			if tsk.Type != task.TypeRun {
+				continue
+			}
+			if in, err := taskRunInput(tsk); err == nil && in.Sweep == sweep {
+				tsks = append(tsks, tsk)
+			}
+		}
+	}
+	if len(tsks) == 0 {
+		return nil, fmt.Errorf("unknown sweep: %s", sweep)
+	}
+	sort.Slice(tsks, func(i, j int) bool { return tsks[i].Created().Before(tsks[j].Created()) })
+
+	report := &api.SweepReport{
+		ID:   sweep,
+		Plan: tsks[0].Plan,
+		Case: tsks[0].Case,
+		Runs: make([]api.SweepRun, 0, len(tsks)),
+	}
+	for _, tsk := range tsks {
+		report.Runs = append(report.Runs, newSweepRun(agg, tsk))
+	}
+	return report, nil
+}
+
+// newSweepRun reports on a run task of a sweep. agg may be nil, to leave the
+// metrics of the run out.
+func newSweepRun(agg runAggregator, tsk *task.Task) api.SweepRun {
+	run := api.SweepRun{
+		TaskID: tsk.ID,
+		Params: make(map[string]string),
+		State:  tsk.State().State,
+		Error:  tsk.Error,
+	}
+
+	if in, err := taskRunInput(tsk); err == nil && len(in.RunIds) > 0 {
+		run.RunID = in.RunIds[0]
+		for _, r := range in.Composition.Runs {
+			if r.ID != run.RunID {
+				continue
+			}
+			for k, v := range r.TestParams {
+				run.Params[k] = v
+			}
+			for _, g := range r.Groups {
+				for k, v := range g.TestParams {
+					run.Params[g.ID+"."+k] = v
+				}
+			}
+		}
+	}
+
+	if run.State == task.StateScheduled || run.State == task.StateProcessing {
+		return run
+	}
+
+	run.Outcome = taskOutcome(tsk)
+	run.Duration, _ = processingTime(tsk)
+	for _, o := range data.DecodeRunnerResult(tsk.Result).Outcomes {
+		run.Instances += o.Total
+		run.InstancesOk += o.Ok
+	}
+
+	if agg == nil {
+		return run
+	}
+	name := clean(tsk.Plan) + "-" + tsk.Case
+	aggs, err := agg.RunAggregates(metrics.StreamResults, name, tsk.ID)
+	if err != nil {
+		logging.S().Warnw("could not aggregate the metrics of a run of a sweep", "task_id", tsk.ID, "err", err)
+		return run
+	}
+	for _, a := range aggs {
+		run.Metrics = append(run.Metrics, api.SweepMetric{
+			Metric: measurementMetric(a.Measurement, name),
+			Group:  a.GroupID,
+			Count:  a.Count,
+			Mean:   a.Mean,
+			P95:    a.P95,
+		})
+	}
+	sort.Slice(run.Metrics, func(i, j int) bool {
+		if run.Metrics[i].Metric != run.Metrics[j].Metric {
+			return run.Metrics[i].Metric < run.Metrics[j].Metric
+		}
+		return run.Metrics[i].Group < run.Metrics[j].Group
+	})
+	return run
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestSweepReport(t *testing.T) {
+	e := newSchedulerEngine(t)
+	now := time.Now().UTC()
+	sweep := xid.NewWithTime(now.Add(-time.Hour)).String()
+
+	comp := api.Composition{
+		Global: api.Global{Plan: "network", Case: "ping-pong"},
+		Runs: api.Runs{
+			{ID: "latency-10", TestParams: map[string]string{"latency": "10ms"}, Groups: api.CompositionRunGroups{
+				{ID: "peers", TestParams: map[string]string{"size": "1KiB"}},
+			}},
+			{ID: "latency-50", TestParams: map[string]string{"latency": "50ms"}, Groups: api.CompositionRunGroups{
+				{ID: "peers"},
+			}},
+		},
+	}
+
+	// queue queues a run of the sweep, archiving it if it completed.
+	queue := func(runID, sweep string, started time.Time, done bool) *task.Task {
+		req := &api.RunRequest{RunIds: []string{runID}, Composition: comp, Sweep: sweep}
+		tsk := &task.Task{
+			ID:     xid.NewWithTime(started).String(),
+			Type:   task.TypeRun,
+			Plan:   "network",
+			Case:   "ping-pong",
+			Input:  &RunInput{RunRequest: req},
+			States: []task.DatedState{{State: task.StateScheduled, Created: started}},
+		}
+		if !done {
+			require.NoError(t, e.store.PersistScheduled(tsk))
+			return tsk
+		}
+		tsk.States = append(tsk.States,
+			task.DatedState{State: task.StateProcessing, Created: started},
+			task.DatedState{State: task.StateComplete, Created: started.Add(10 * time.Minute)},
+		)
+		tsk.Result = &runner.Result{
+			Outcome:  task.OutcomeSuccess,
+			Outcomes: map[string]*runner.GroupOutcome{"peers": {Ok: 9, Total: 10}},
+		}
+		require.NoError(t, e.store.PersistProcessing(tsk))
+		require.NoError(t, e.store.ArchiveTask(tsk))
+		return tsk
+	}
+
+	first := queue("latency-10", sweep, now.Add(-50*time.Minute), true)
+	second := queue("latency-50", sweep, now.Add(-40*time.Minute), false)
+	// not part of the sweep.
+	queue("latency-10", "", now.Add(-30*time.Minute), true)
+
+	agg := fakeAggregator{{Measurement: "results.network-ping-pong.rtt.histogram", GroupID: "peers", Count: 90, Mean: 12, P95: 20}}
+	report, err := e.sweepReport(agg, sweep)
+	require.NoError(t, err)
+	require.Equal(t, "network", report.Plan)
+	require.Len(t, report.Runs, 2)
+
+	r := report.Runs[0]
+	require.Equal(t, first.ID, r.TaskID)
+	require.Equal(t, "latency-10", r.RunID)
+	require.Equal(t, map[string]string{"latency": "10ms", "peers.size": "1KiB"}, r.Params)
+	require.Equal(t, task.OutcomeSuccess, r.Outcome)
+	require.Equal(t, 9, r.InstancesOk)
+	require.Equal(t, 10, r.Instances)
+	require.Equal(t, 10*time.Minute, r.Duration)
+	require.Equal(t, []api.SweepMetric{{Metric: "rtt", Group: "peers", Count: 90, Mean: 12, P95: 20}}, r.Metrics)
+
+	// runs still queued are reported without outcome.
+	r = report.Runs[1]
+	require.Equal(t, second.ID, r.TaskID)
+	require.Equal(t, task.StateScheduled, r.State)
+	require.Empty(t, r.Outcome)
+	require.Empty(t, r.Metrics)
+
+	_, err = e.sweepReport(agg, xid.New().String())
+	require.Error(t, err)
+	_, err = e.sweepReport(agg, "not-a-sweep")
+	require.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// taskSource is where workers take tasks from, and where they report their
+// progress to.
+type taskSource interface {
+	// Pop takes the next task to process. It returns task.ErrQueueEmpty if
+	// there is none.
+	Pop() (*task.Task, error)
+
+	// Log returns the writer the log of a task is written to.
+	Log(tsk *task.Task) (io.WriteCloser, error)
+
+	// Persist records the current state of a task being processed.
+	Persist(tsk *task.Task) error
+
+	// Started is called when the processing of a task starts, and Finished
+	// when it reaches a terminal state.
+	Started(tsk *task.Task) error
+	Finished(tsk *task.Task) error
+}
+
+// localTasks is the taskSource backed by the queue and storage of this
+// daemon. It's also where tasks processed by remote workers are reported to.
+type localTasks struct {
+	e *Engine
+
+	// checks are the GitHub check runs of the tasks in progress, delivered
+	// once created; they're created and completed in the background, so that
+	// workers don't wait on GitHub.
+	lk     sync.Mutex
+	checks map[string]chan *githubCheck
+}
+
+var _ taskSource = (*localTasks)(nil)
+
+func newLocalTasks(e *Engine) *localTasks {
+	return &localTasks{e: e, checks: make(map[string]chan *githubCheck)}
+}
+
+func (l *localTasks) Pop() (*task.Task, error) {
+	return l.e.queue.Pop()
+}
+
+func (l *localTasks) Log(tsk *task.Task) (io.WriteCloser, error) {
+	return os.OpenFile(l.e.taskLogPath(tsk.ID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+func (l *localTasks) Persist(tsk *task.Task) error {
+	return l.e.store.PersistProcessing(tsk)
+}
+
+func (l *localTasks) Started(tsk *task.Task) error {
+	if err := l.Persist(tsk); err != nil {
+		return err
+	}
+
+	l.e.notify(tsk)
+	if l.e.github != nil && tsk.CreatedByCI() {
+		started := make(chan *githubCheck, 1)
+		l.lk.Lock()
+		l.checks[tsk.ID] = started
+		l.lk.Unlock()
+
+		// the worker carries on with the task meanwhile.
+		snapshot := *tsk
+		go func() { started <- l.e.startGithubCheck(&snapshot) }()
+	}
+	if err := l.e.postStatusToGithub(tsk); err != nil {
+		logging.S().Errorw("could not post status to github", "err", err)
+	}
+	return nil
+}
+
+func (l *localTasks) Finished(tsk *task.Task) error {
+	if err := l.Persist(tsk); err != nil {
+		return err
+	}
+	if err := l.e.store.ArchiveTask(tsk); err != nil {
+		return err
+	}
+	l.e.cleanWorkspace(tsk)
+
+	l.lk.Lock()
+	started := l.checks[tsk.ID]
+	delete(l.checks, tsk.ID)
+	l.lk.Unlock()
+
+	l.e.notify(tsk)
+	if started != nil {
+		snapshot := *tsk
+		go func() { l.e.completeGithubCheck(&snapshot, <-started) }()
+	}
+	l.e.exportRun(tsk)
+
+	if err := l.e.postStatusToSlack(tsk); err != nil {
+		logging.S().Errorw("could not send status to slack", "err", err)
+	}
+	if err := l.e.postStatusToGithub(tsk); err != nil {
+		logging.S().Errorw("could not post status to github", "err", err)
+	}
+	return nil
+}
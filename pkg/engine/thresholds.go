@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/metrics"
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/runner"
+	"github.com/testground/testground/pkg/task"
+)
+
+// enforceThresholds checks the thresholds of a completed run, records the
+// checks in its result, and fails its outcome if any of them failed. The run
+// itself still completes; errors are only returned when the checks couldn't
+// be made.
+func (e *Engine) enforceThresholds(runID, plan, tcase string, thresholds []api.Threshold, out *api.RunOutput, ow *rpc.OutputWriter) error {
+	mv, err := metrics.NewViewer(e.envcfg)
+	if err != nil {
+		return fmt.Errorf("failed to check thresholds: %w", err)
+	}
+	checks, err := checkThresholds(mv, clean(plan)+"-"+tcase, runID, thresholds)
+	if err != nil {
+		return fmt.Errorf("failed to check thresholds: %w", err)
+	}
+
+	res, ok := out.Result.(*runner.Result)
+	if !ok || res == nil {
+		res = &runner.Result{}
+		out.Result = res
+	}
+	res.Thresholds = checks
+
+	failed := 0
+	for _, c := range checks {
+		if c.Passed {
+			ow.Infow("threshold passed", "metric", c.Metric, "group", c.Group, "stat", c.Stat, "value", c.Value, "baseline", c.Baseline)
+			continue
+		}
+		failed++
+		ow.Warnw("threshold failed", "metric", c.Metric, "group", c.Group, "reason", c.Message)
+	}
+	if failed > 0 {
+		res.Outcome = task.OutcomeFailure
+		res.Reason = fmt.Sprintf("%d of %d threshold checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkThresholds evaluates the thresholds of a completed run against the
+// metrics it recorded on the results stream, see api.Threshold. name encodes
+// the test plan and case of the run, like in metrics.Viewer.
+func checkThresholds(agg runAggregator, name, runID string, thresholds []api.Threshold) ([]api.ThresholdCheck, error) {
+	aggs, err := agg.RunAggregates(metrics.StreamResults, name, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate the metrics of run %s: %w", runID, err)
+	}
+
+	// the aggregates of baseline runs, fetched once each.
+	baselines := make(map[string][]metrics.Aggregate)
+
+	var checks []api.ThresholdCheck
+	for _, t := range thresholds {
+		stat := t.Statistic()
+
+		var matched []metrics.Aggregate
+		for _, a := range aggs {
+			if measurementMetric(a.Measurement, name) == t.Metric && (t.Group == "" || a.GroupID == t.Group) {
+				matched = append(matched, a)
+			}
+		}
+		if len(matched) == 0 {
+			checks = append(checks, api.ThresholdCheck{
+				Metric:  t.Metric,
+				Group:   t.Group,
+				Stat:    stat,
+				Message: "no values recorded",
+			})
+			continue
+		}
+
+		if t.BaselineRun != "" {
+			if _, ok := baselines[t.BaselineRun]; !ok {
+				b, err := agg.RunAggregates(metrics.StreamResults, name, t.BaselineRun)
+				if err != nil {
+					return nil, fmt.Errorf("failed to aggregate the metrics of baseline run %s: %w", t.BaselineRun, err)
+				}
+				baselines[t.BaselineRun] = b
+			}
+		}
+
+		for _, a := range matched {
+			c := api.ThresholdCheck{
+				Metric:      t.Metric,
+				Measurement: a.Measurement,
+				Group:       a.GroupID,
+				Stat:        stat,
+				Value:       aggregateStat(a, stat),
+				Baseline:    t.Baseline,
+			}
+
+			if t.BaselineRun != "" {
+				found := false
+				for _, b := range baselines[t.BaselineRun] {
+					if b.Measurement == a.Measurement && b.GroupID == a.GroupID {
+						c.Baseline, found = aggregateStat(b, stat), true
+						break
+					}
+				}
+				if !found {
+					c.Message = fmt.Sprintf("no values recorded by baseline run %s", t.BaselineRun)
+					checks = append(checks, c)
+					continue
+				}
+			}
+
+			switch {
+			case t.Max != 0 && c.Value > t.Max*c.Baseline:
+				c.Message = fmt.Sprintf("%s %g above %gx baseline %g", stat, c.Value, t.Max, c.Baseline)
+			case t.Min != 0 && c.Value < t.Min*c.Baseline:
+				c.Message = fmt.Sprintf("%s %g below %gx baseline %g", stat, c.Value, t.Min, c.Baseline)
+			default:
+				c.Passed = true
+			}
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+// metricTypes are the kinds of metrics the SDK suffixes the names of their
+// measurements with.
+var metricTypes = []string{"point", "counter", "ewma", "gauge", "histogram", "meter", "timer"}
+
+// measurementMetric returns the name a test plan recorded a measurement
+// under, from the name of the measurement in InfluxDB, i.e.
+// <stream>.<name>.<metric>.<type>, where name encodes the test plan and case
+// of the run, like in metrics.Viewer. Metric names may contain dots.
+func measurementMetric(measurement, name string) string {
+	metric := measurement
+	if i := strings.IndexByte(metric, '.'); i >= 0 {
+		metric = strings.TrimPrefix(metric[i+1:], name+".")
+	}
+	if i := strings.LastIndexByte(metric, '.'); i >= 0 && stringInSlice(metric[i+1:], metricTypes) {
+		metric = metric[:i]
+	}
+	return metric
+}
+
+func aggregateStat(a metrics.Aggregate, stat string) float64 {
+	switch stat {
+	case api.StatCount:
+		return float64(a.Count)
+	case api.StatMean:
+		return a.Mean
+	case api.StatMin:
+		return a.Min
+	case api.StatMax:
+		return a.Max
+	default:
+		return a.P95
+	}
+}
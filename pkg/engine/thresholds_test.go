@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/metrics"
+)
+
+// runsAggregator aggregates the metrics of runs by their ID.
+type runsAggregator map[string][]metrics.Aggregate
+
+func (f runsAggregator) RunAggregates(_ metrics.Stream, _ string, runID string) ([]metrics.Aggregate, error) {
+	return f[runID], nil
+}
+
+func TestCheckThresholds(t *testing.T) {
+	const latency = "results.dht-find-peers.lookup.latency-ms.timer"
+	agg := runsAggregator{
+		"golden": {
+			{Measurement: latency, GroupID: "peers", P95: 100},
+			{Measurement: latency, GroupID: "seeds", P95: 50},
+		},
+		"run1": {
+			{Measurement: latency, GroupID: "peers", P95: 115, Mean: 80},
+			{Measurement: latency, GroupID: "seeds", P95: 70},
+		},
+	}
+
+	checks, err := checkThresholds(agg, "dht-find-peers", "run1", []api.Threshold{
+		// within 1.2x of the golden run for peers, not for seeds.
+		{Metric: "lookup.latency-ms", BaselineRun: "golden", Max: 1.2},
+		// a fixed baseline, for a single group.
+		{Metric: "lookup.latency-ms", Group: "peers", Stat: api.StatMean, Baseline: 100, Min: 0.9},
+		{Metric: "dial-failures", Baseline: 1, Max: 1},
+	})
+	require.NoError(t, err)
+	require.Len(t, checks, 4)
+
+	byGroup := map[string]api.ThresholdCheck{}
+	for _, c := range checks[:2] {
+		byGroup[c.Group] = c
+	}
+	require.True(t, byGroup["peers"].Passed)
+	require.Equal(t, 100.0, byGroup["peers"].Baseline)
+	require.False(t, byGroup["seeds"].Passed)
+	require.Equal(t, 70.0, byGroup["seeds"].Value)
+
+	require.False(t, checks[2].Passed)
+	require.Equal(t, 80.0, checks[2].Value)
+
+	// measurements that were not recorded fail their thresholds.
+	require.False(t, checks[3].Passed)
+	require.Equal(t, "no values recorded", checks[3].Message)
+}
+
+func TestMeasurementMetric(t *testing.T) {
+	for measurement, want := range map[string]string{
+		"results.network-ping-pong.rtt.histogram":  "rtt",
+		"results.network-ping-pong.dial.ms.point":  "dial.ms",
+		"results.network-ping-pong.bytes.received": "bytes.received",
+		"diagnostics.network-ping-pong.rtt.gauge":  "rtt",
+		"results.other-case.rtt.point":             "other-case.rtt",
+	} {
+		require.Equal(t, want, measurementMetric(measurement, "network-ping-pong"), measurement)
+	}
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// githubCloneURL is the URL repositories of trigger requests are cloned from.
+var githubCloneURL = "https://github.com/%s.git"
+
+// QueueTrigger checks out the repository of a trigger request under dir,
+// renders its composition, and queues a run that builds and runs it.
+func (e *Engine) QueueTrigger(ctx context.Context, req *api.TriggerRequest, dir string) (string, error) {
+	switch {
+	case len(strings.Split(req.Repo, "/")) != 2:
+		return "", fmt.Errorf("invalid repo %q: expected owner/name", req.Repo)
+	case req.Ref == "":
+		return "", errors.New("no ref supplied")
+	case req.Composition == "":
+		return "", errors.New("no composition supplied")
+	}
+
+	repoDir := filepath.Join(dir, "repo")
+	sha, err := e.checkout(ctx, req.Repo, req.Ref, repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	// all paths come from the request; make sure they stay within the
+	// repository.
+	if repoDir, err = filepath.EvalSymlinks(repoDir); err != nil {
+		return "", err
+	}
+	planDir, err := withinDir(repoDir, req.Plan)
+	if err != nil {
+		return "", fmt.Errorf("invalid plan: %w", err)
+	}
+	compPath, err := withinDir(repoDir, req.Composition)
+	if err != nil {
+		return "", fmt.Errorf("invalid composition: %w", err)
+	}
+
+	env := map[string]string{}
+	for k, v := range req.Env {
+		env[k] = v
+	}
+	env["GITHUB_REPOSITORY"] = req.Repo
+	env["GITHUB_SHA"] = sha
+	env["GITHUB_REF_NAME"] = req.Branch
+
+	comp, err := api.LoadComposition(compPath, &api.CompositionTemplateData{Env: env, Root: repoDir})
+	if err != nil {
+		return "", err
+	}
+
+	runID := req.RunID
+	if runID == "" {
+		if ids := comp.ListRunIds(); len(ids) == 1 {
+			runID = ids[0]
+		} else {
+			return "", fmt.Errorf("composition has %d runs; a run id must be supplied", len(ids))
+		}
+	}
+	if comp, err = comp.FrameForRuns(runID); err != nil {
+		return "", err
+	}
+	if err := comp.ValidateForRun(); err != nil {
+		return "", fmt.Errorf("invalid composition: %w", err)
+	}
+
+	manifest := new(api.TestPlanManifest)
+	if _, err := toml.DecodeFile(filepath.Join(planDir, "manifest.toml"), manifest); err != nil {
+		return "", fmt.Errorf("failed to parse plan manifest: %w", err)
+	}
+	for _, b := range comp.ListBuilders() {
+		if len(manifest.ExtraSources[strings.Replace(b, ":", "_", -1)]) > 0 {
+			return "", fmt.Errorf("plans with extra sources can't be triggered (builder %s)", b)
+		}
+	}
+
+	// builders expect the plan under <base>/plan; the rest of the checkout
+	// stays out of the sources.
+	base := filepath.Join(dir, "sources")
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", err
+	}
+	sources := &api.UnpackedSources{BaseDir: base, PlanDir: filepath.Join(base, "plan")}
+	if err := os.Rename(planDir, sources.PlanDir); err != nil {
+		return "", fmt.Errorf("failed to move plan sources: %w", err)
+	}
+
+	var buildIdx []int
+	for i, grp := range comp.Groups {
+		if grp.Run.Artifact == "" {
+			buildIdx = append(buildIdx, i)
+		}
+	}
+
+	return e.QueueRun(ctx, &api.RunRequest{
+		Priority:    req.Priority,
+		BuildGroups: buildIdx,
+		RunIds:      []string{runID},
+		Composition: *comp,
+		Manifest:    *manifest,
+		CreatedBy: api.CreatedBy{
+			User:   req.User,
+			Repo:   req.Repo,
+			Branch: req.Branch,
+			Commit: sha,
+		},
+		NotifyURL: req.NotifyURL,
+	}, sources)
+}
+
+// checkout clones a GitHub repository into dir, and checks out ref, which can
+// be a commit, branch or tag. It authenticates with the GitHub App, if one is
+// configured, so that private repositories can be cloned. It returns the
+// commit that was checked out.
+func (e *Engine) checkout(ctx context.Context, repo, ref, dir string) (string, error) {
+	url := fmt.Sprintf(githubCloneURL, repo)
+	auth, err := e.gitAuth(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: url, Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone %s: %w", repo, err)
+	}
+	return checkoutRef(r, ref)
+}
+
+// gitAuth returns the credentials to clone url with: the token of the GitHub
+// App for GitHub repositories, if one is configured.
+func (e *Engine) gitAuth(ctx context.Context, url string) (transport.AuthMethod, error) {
+	if e.github == nil || !strings.HasPrefix(url, "https://github.com/") {
+		return nil, nil
+	}
+	token, err := e.github.installationToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &http.BasicAuth{Username: "x-access-token", Password: token}, nil
+}
+
+// checkoutRef checks out ref, which can be a commit, branch or tag, in the
+// worktree of r, and returns the commit that was checked out.
+func checkoutRef(r *git.Repository, ref string) (string, error) {
+	// branches are tracked by remote refs, which are the ones updated by
+	// fetches; anything else resolves as is.
+	hash, err := r.ResolveRevision(plumbing.Revision("origin/" + ref))
+	if err != nil {
+		if hash, err = r.ResolveRevision(plumbing.Revision(ref)); err != nil {
+			return "", fmt.Errorf("failed to resolve ref %s: %w", ref, err)
+		}
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	return hash.String(), nil
+}
+
+// withinDir joins a slash-separated relative path to dir, failing if the
+// result (after resolving symlinks) falls outside of it.
+func withinDir(dir, path string) (string, error) {
+	p, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(dir, p); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is outside of the repository", path)
+	}
+	return p, nil
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestCheckoutAndConfinePaths(t *testing.T) {
+	remotes := t.TempDir()
+	prev := githubCloneURL
+	githubCloneURL = filepath.Join(remotes, "%s")
+	defer func() { githubCloneURL = prev }()
+
+	// create the "remote" repository, with one commit.
+	src := filepath.Join(remotes, "org", "repo")
+	r, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "plans", "ping"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "plans", "ping", "manifest.toml"), []byte(`name = "ping"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("plans"); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := wt.Commit("add plan", &git.CommitOptions{
+		Author: &object.Signature{Name: "tg", Email: "tg@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Engine{}
+	dir := filepath.Join(t.TempDir(), "repo")
+	sha, err := e.checkout(context.Background(), "org/repo", commit.String(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != commit.String() {
+		t.Fatalf("expected to check out %s, got %s", commit, sha)
+	}
+
+	if _, err := withinDir(dir, "plans/ping"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withinDir(dir, "../"); err == nil {
+		t.Fatal("expected paths outside of the repository to be rejected")
+	}
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/otiai10/copy"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/task"
+)
+
+// Workspace retention policies, deciding which task workspaces are kept
+// once tasks finish.
+const (
+	RetainNoWorkspaces     = "none"
+	RetainFailedWorkspaces = "failed"
+	RetainAllWorkspaces    = "all"
+)
+
+// taskWorkspace returns the workspace of a task: the directory holding its
+// plan sources, and everything derived from them while building, so that
+// concurrent tasks never share paths.
+func (e *Engine) taskWorkspace(id string) string {
+	return filepath.Join(e.envcfg.Dirs().Work(), "tasks", filepath.Base(id))
+}
+
+// prepareTaskSources sets up the sources of a task being queued in its
+// workspace, fetching the plan if the composition has a plan source. Fetches
+// are bound to ctx, the context of the request queueing the task.
+func (e *Engine) prepareTaskSources(ctx context.Context, id string, comp *api.Composition, sources *api.UnpackedSources, manifest *api.TestPlanManifest) (*api.UnpackedSources, error) {
+	err := e.adoptSources(id, sources)
+	if err == nil && comp.Global.RemotePlan() {
+		sources, err = e.remotePlanSources(ctx, id, comp, sources, manifest)
+	}
+	if err != nil {
+		_ = os.RemoveAll(e.taskWorkspace(id))
+		return nil, err
+	}
+	return sources, nil
+}
+
+// remotePlanSources fetches the plan of a composition from its plan source,
+// or from the plan registry, into the sources of a task, and loads its
+// manifest. Only an SDK can be supplied alongside such plans.
+func (e *Engine) remotePlanSources(ctx context.Context, id string, comp *api.Composition, sources *api.UnpackedSources, manifest *api.TestPlanManifest) (*api.UnpackedSources, error) {
+	if sources == nil {
+		sources = &api.UnpackedSources{BaseDir: filepath.Join(e.taskWorkspace(id), "sources")}
+		if err := os.MkdirAll(sources.BaseDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if sources.PlanDir != "" || sources.ExtraDir != "" {
+		return nil, errors.New("plan sources can't be uploaded for plans fetched by the daemon")
+	}
+
+	var (
+		rev string
+		err error
+
+		name, version = comp.Global.PlanVersion()
+	)
+	sources.PlanDir = filepath.Join(sources.BaseDir, "plan")
+	switch {
+	case version != "" && comp.Global.PlanSource != "":
+		return nil, errors.New("published plans can't have a plan source")
+	case version != "":
+		rev, err = e.copyPublishedPlan(name, version, sources.PlanDir)
+	default:
+		rev, err = e.fetchPlan(ctx, comp.Global.PlanSource, sources.PlanDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logging.S().Infow("fetched plan", "task_id", id, "plan", comp.Global.Plan, "plan_source", comp.Global.PlanSource, "revision", rev)
+
+	*manifest = api.TestPlanManifest{}
+	if _, err := toml.DecodeFile(filepath.Join(sources.PlanDir, "manifest.toml"), manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse plan manifest: %w", err)
+	}
+	for _, b := range comp.ListBuilders() {
+		if len(manifest.ExtraSources[strings.Replace(b, ":", "_", -1)]) > 0 {
+			return nil, fmt.Errorf("plans with extra sources can't be fetched by the daemon (builder %s)", b)
+		}
+	}
+	return sources, nil
+}
+
+// adoptSources copies the sources of a task being queued into its workspace,
+// and points them there. Callers remain responsible for the original sources.
+func (e *Engine) adoptSources(id string, sources *api.UnpackedSources) error {
+	if sources == nil {
+		return nil
+	}
+
+	ws := e.taskWorkspace(id)
+	if err := os.MkdirAll(ws, 0755); err != nil {
+		return fmt.Errorf("failed to create task workspace: %w", err)
+	}
+
+	dir := filepath.Join(ws, "sources")
+	if err := copy.Copy(sources.BaseDir, dir); err != nil {
+		return fmt.Errorf("failed to copy sources into task workspace: %w", err)
+	}
+	return rebaseSources(sources, dir)
+}
+
+// cleanWorkspace removes the workspace of a finished task, unless the
+// retention policy says it should be kept.
+func (e *Engine) cleanWorkspace(tsk *task.Task) {
+	switch e.envcfg.Daemon.Scheduler.WorkspaceRetention {
+	case RetainAllWorkspaces:
+		return
+	case RetainFailedWorkspaces:
+		if taskOutcome(tsk) != task.OutcomeSuccess {
+			return
+		}
+	}
+
+	if err := os.RemoveAll(e.taskWorkspace(tsk.ID)); err != nil {
+		logging.S().Warnw("could not remove task workspace", "task_id", tsk.ID, "err", err)
+	}
+}
+
+// rebaseSources points sources to the copy of their base dir at dir.
+func rebaseSources(sources *api.UnpackedSources, dir string) error {
+	for _, p := range []*string{&sources.PlanDir, &sources.SDKDir, &sources.ExtraDir} {
+		if *p == "" {
+			continue
+		}
+		rel, err := filepath.Rel(sources.BaseDir, *p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("invalid source dir: %s", *p)
+		}
+		*p = filepath.Join(dir, rel)
+	}
+	sources.BaseDir = dir
+	return nil
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/task"
+)
+
+func TestTaskWorkspaces(t *testing.T) {
+	prev, ok := os.LookupEnv("TESTGROUND_HOME")
+	_ = os.Setenv("TESTGROUND_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			_ = os.Setenv("TESTGROUND_HOME", prev)
+		} else {
+			_ = os.Unsetenv("TESTGROUND_HOME")
+		}
+	}()
+
+	e := &Engine{envcfg: &config.EnvConfig{}}
+	require.NoError(t, e.envcfg.Load())
+
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "plan"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "plan", "main.go"), []byte("package main"), 0644))
+
+	// each task gets its own copy of the sources.
+	var tasks []*task.Task
+	for _, id := range []string{"c60i0d2llu6a7gha3ed0", "c60i0d2llu6a7gha3ed1"} {
+		sources := &api.UnpackedSources{BaseDir: base, PlanDir: filepath.Join(base, "plan")}
+		require.NoError(t, e.adoptSources(id, sources))
+		require.Equal(t, filepath.Join(e.taskWorkspace(id), "sources", "plan"), sources.PlanDir)
+
+		b, err := os.ReadFile(filepath.Join(sources.PlanDir, "main.go"))
+		require.NoError(t, err)
+		require.Equal(t, "package main", string(b))
+
+		tasks = append(tasks, &task.Task{ID: id, States: []task.DatedState{{State: task.StateComplete}}})
+	}
+	_, err := os.Stat(filepath.Join(base, "plan", "main.go"))
+	require.NoError(t, err, "the original sources must be left alone")
+
+	// the failed task's workspace is retained.
+	e.envcfg.Daemon.Scheduler.WorkspaceRetention = RetainFailedWorkspaces
+	tasks[0].Error = "boom"
+	for _, tsk := range tasks {
+		e.cleanWorkspace(tsk)
+	}
+	_, err = os.Stat(e.taskWorkspace(tasks[0].ID))
+	require.NoError(t, err)
+	_, err = os.Stat(e.taskWorkspace(tasks[1].ID))
+	require.True(t, os.IsNotExist(err))
+
+	e.envcfg.Daemon.Scheduler.WorkspaceRetention = RetainNoWorkspaces
+	e.cleanWorkspace(tasks[0])
+	_, err = os.Stat(e.taskWorkspace(tasks[0].ID))
+	require.True(t, os.IsNotExist(err))
+}
@@ -2,10 +2,14 @@ package healthcheck
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/rpc"
@@ -27,6 +31,31 @@ func CheckContainerStarted(ctx context.Context, ow *rpc.OutputWriter, cli *clien
 	}
 }
 
+// CheckContainerImage returns a Checker that succeeds if a container runs the
+// supplied image, and fails if it runs another one, e.g. after the image of an
+// infrastructure container was pinned to a new version, or the pinned tag was
+// pulled anew. Images are compared by ID, so that tags and digests referring
+// to the same image match.
+func CheckContainerImage(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, name string, image string) Checker {
+	return func() (bool, string, error) {
+		ci, err := docker.CheckContainer(ctx, ow, cli, name)
+		if err != nil || ci == nil {
+			return false, "container not found.", err
+		}
+		pinned, _, err := cli.ImageInspectWithRaw(ctx, image)
+		if client.IsErrNotFound(err) {
+			return false, fmt.Sprintf("container runs %s; %s is pinned, but not pulled.", ci.Config.Image, image), nil
+		}
+		if err != nil {
+			return false, "failed to inspect the pinned image.", err
+		}
+		if ci.Image != pinned.ID {
+			return false, fmt.Sprintf("container runs %s (%s); %s (%s) is pinned.", ci.Config.Image, ci.Image, image, pinned.ID), nil
+		}
+		return true, fmt.Sprintf("container runs %s (%s).", image, pinned.ID), nil
+	}
+}
+
 // CheckNetwork returns a Checker that succeeds if the specified network exists,
 // and fails otherwise.
 func CheckNetwork(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, networkID string) Checker {
@@ -47,14 +76,146 @@ func CheckNetwork(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client,
 // or that the remote TCP socket is closed. For UDP sockets, being
 // connectionless, may return a false positive even if there is no listening
 // process, but at least it will try to find a route to the host.
+//
+// See DialableCheckerWithOpts for retries, and for validating what the
+// endpoint serves.
 func DialableChecker(protocol string, address string) Checker {
+	return DialableCheckerWithOpts(context.Background(), protocol, address, DialOpts{})
+}
+
+// DialOpts tunes DialableCheckerWithOpts.
+type DialOpts struct {
+	// Timeout bounds each attempt; defaults to 5 seconds.
+	Timeout time.Duration
+	// RetryWindow is how long to keep retrying failed attempts for, e.g.
+	// while an infrastructure container is starting up. Zero makes a single
+	// attempt.
+	RetryWindow time.Duration
+	// RetryInterval is the pause between attempts; defaults to 1 second.
+	RetryInterval time.Duration
+
+	// TLS performs a TLS handshake, verifying the certificate of the
+	// endpoint against ServerName, or the host of the address if empty,
+	// unless InsecureSkipVerify is set.
+	TLS                bool
+	ServerName         string
+	InsecureSkipVerify bool
+
+	// Banner, if not empty, is the prefix of what the endpoint must send
+	// first once connected, e.g. "SSH-2.0".
+	Banner string
+
+	// HTTPPath, if not empty, makes the attempts HTTP GET requests to this
+	// path, over TLS if TLS is set. The endpoint must respond with
+	// HTTPStatus, or any non-error status if zero.
+	HTTPPath   string
+	HTTPStatus int
+}
+
+// DialableCheckerWithOpts returns a Checker that checks whether a remote
+// endpoint is dialable, like DialableChecker, retrying failed attempts within
+// a window, and optionally validating the TLS handshake, the banner, or the
+// HTTP status of the endpoint.
+func DialableCheckerWithOpts(ctx context.Context, protocol string, address string, opts DialOpts) Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+
 	return func() (bool, string, error) {
-		_, err := net.Dial(protocol, address)
+		deadline := time.Now().Add(opts.RetryWindow)
+		for attempt := 1; ; attempt++ {
+			msg, err := dialOnce(ctx, protocol, address, opts)
+			if err == nil {
+				return true, "address is already dialable.", nil
+			}
+			if time.Now().Add(opts.RetryInterval).After(deadline) {
+				if attempt > 1 {
+					msg = fmt.Sprintf("%s (after %d attempts)", msg, attempt)
+				}
+				return false, msg, err
+			}
+			select {
+			case <-ctx.Done():
+				return false, msg, ctx.Err()
+			case <-time.After(opts.RetryInterval):
+			}
+		}
+	}
+}
+
+// dialOnce makes a single attempt of DialableCheckerWithOpts, returning a
+// message describing what failed.
+func dialOnce(ctx context.Context, protocol string, address string, opts DialOpts) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var tlsConfig *tls.Config
+	if opts.TLS {
+		serverName := opts.ServerName
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConfig = &tls.Config{ServerName: serverName, InsecureSkipVerify: opts.InsecureSkipVerify}
+	}
+
+	if opts.HTTPPath != "" {
+		scheme := "http"
+		if opts.TLS {
+			scheme = "https"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+address+opts.HTTPPath, nil)
+		if err != nil {
+			return "invalid address.", err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		defer client.CloseIdleConnections()
+
+		resp, err := client.Do(req)
 		if err != nil {
-			return false, "address not dialable.", err
+			return "address not dialable.", err
+		}
+		_ = resp.Body.Close()
+
+		switch {
+		case opts.HTTPStatus != 0 && resp.StatusCode != opts.HTTPStatus:
+			return "unexpected http status.", fmt.Errorf("expected status %d, got %s", opts.HTTPStatus, resp.Status)
+		case opts.HTTPStatus == 0 && resp.StatusCode >= 400:
+			return "unexpected http status.", fmt.Errorf("got status %s", resp.Status)
+		}
+		return "", nil
+	}
+
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, protocol, address)
+	if err != nil {
+		return "address not dialable.", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if tlsConfig != nil {
+		tconn := tls.Client(conn, tlsConfig)
+		if err := tconn.Handshake(); err != nil {
+			return "tls handshake failed.", err
+		}
+		conn = tconn
+	}
+
+	if opts.Banner != "" {
+		banner := make([]byte, len(opts.Banner))
+		if _, err := io.ReadFull(conn, banner); err != nil {
+			return "no banner received.", err
+		}
+		if string(banner) != opts.Banner {
+			return "unexpected banner.", fmt.Errorf("expected banner %q, got %q", opts.Banner, banner)
 		}
-		return true, "address is already dialable.", err
 	}
+	return "", nil
 }
 
 // CheckDirectoryExists returns a Checker that checks whether the specified
@@ -79,6 +240,25 @@ func CheckDirectoryExists(path string) Checker {
 	}
 }
 
+// CheckFileExists returns a Checker that checks whether the specified regular
+// file exists. It fails if the Go runtime returns a ErrNotExist error, and
+// propagates all other errors.
+func CheckFileExists(path string) Checker {
+	return func() (bool, string, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, "file does not exist. can recreate.", nil
+			}
+			return false, "filesystem error. cannot recreate.", err
+		}
+		if fi.Mode().IsRegular() {
+			return true, "file exists.", nil
+		}
+		return false, "expected regular file. please fix manually.", fmt.Errorf("not a regular file")
+	}
+}
+
 // CheckCommandStatus returns a checker which executes a command and returns successfully or
 // unsuccessfully depending on the exit status of the command.
 func CheckCommandStatus(ctx context.Context, cmd string, args ...string) Checker {
@@ -99,6 +279,18 @@ func CheckCommandStatus(ctx context.Context, cmd string, args ...string) Checker
 	}
 }
 
+// CheckExecutable returns a Checker that succeeds if an executable is found in
+// the PATH, and fails otherwise.
+func CheckExecutable(name string) Checker {
+	return func() (bool, string, error) {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return false, fmt.Sprintf("%s not found in PATH.", name), nil
+		}
+		return true, fmt.Sprintf("found %s.", path), nil
+	}
+}
+
 // CheckK8sPods returns a checker which verifies the number of pods found matches the number
 // expected. If Listing the pods returns an error, the error is returned. The boolean value returned
 // by the check follows whether the number of pods observed in the list matches the expected count.
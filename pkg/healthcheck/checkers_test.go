@@ -0,0 +1,108 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialableCheckerRetries(t *testing.T) {
+	// reserve a port, and only start listening on it later, as a starting
+	// container would.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	ok, _, err := DialableChecker("tcp", addr)()
+	require.False(t, ok)
+	require.Error(t, err)
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		defer l.Close()
+		if conn, err := l.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	opts := DialOpts{RetryWindow: 5 * time.Second, RetryInterval: 100 * time.Millisecond}
+	ok, _, err = DialableCheckerWithOpts(context.Background(), "tcp", addr, opts)()
+	require.True(t, ok)
+	require.NoError(t, err)
+}
+
+func TestDialableCheckerBanner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH\r\n"))
+			_ = conn.Close()
+		}
+	}()
+
+	addr := l.Addr().String()
+	ok, _, err := DialableCheckerWithOpts(context.Background(), "tcp", addr, DialOpts{Banner: "SSH-2.0"})()
+	require.True(t, ok)
+	require.NoError(t, err)
+
+	ok, msg, err := DialableCheckerWithOpts(context.Background(), "tcp", addr, DialOpts{Banner: "+PONG"})()
+	require.False(t, ok)
+	require.Error(t, err)
+	require.Equal(t, "unexpected banner.", msg)
+}
+
+func TestDialableCheckerHTTPAndTLS(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	srv := httptest.NewTLSServer(handler)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	// the certificate of the test server is self-signed.
+	ok, msg, err := DialableCheckerWithOpts(context.Background(), "tcp", addr, DialOpts{TLS: true})()
+	require.False(t, ok)
+	require.Error(t, err)
+	require.Equal(t, "tls handshake failed.", msg)
+
+	opts := DialOpts{TLS: true, InsecureSkipVerify: true}
+	ok, _, err = DialableCheckerWithOpts(context.Background(), "tcp", addr, opts)()
+	require.True(t, ok)
+	require.NoError(t, err)
+
+	opts.HTTPPath = "/health"
+	ok, _, err = DialableCheckerWithOpts(context.Background(), "tcp", addr, opts)()
+	require.True(t, ok)
+	require.NoError(t, err)
+
+	opts.HTTPPath = "/missing"
+	ok, msg, err = DialableCheckerWithOpts(context.Background(), "tcp", addr, opts)()
+	require.False(t, ok)
+	require.Error(t, err)
+	require.Equal(t, "unexpected http status.", msg)
+
+	opts.HTTPStatus = http.StatusNotFound
+	ok, _, err = DialableCheckerWithOpts(context.Background(), "tcp", addr, opts)()
+	require.True(t, ok)
+	require.NoError(t, err)
+}
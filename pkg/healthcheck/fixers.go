@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/rpc"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 )
@@ -56,6 +58,92 @@ func CreateNetwork(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client
 	}
 }
 
+// RemoveNetwork returns a Rollback that removes the specified Docker network,
+// undoing CreateNetwork.
+func RemoveNetwork(ctx context.Context, cli *client.Client, networkID string) Rollback {
+	return func() error {
+		return cli.NetworkRemove(ctx, networkID)
+	}
+}
+
+// StartContainerWithRollback returns a ReversibleFixer like StartContainer,
+// whose Rollback removes the container if the fix created it, or stops it
+// otherwise.
+func StartContainerWithRollback(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, opts *docker.EnsureContainerOpts) ReversibleFixer {
+	return func() (string, Rollback, error) {
+		ci, created, err := docker.EnsureContainerStarted(ctx, ow, cli, opts)
+		if err != nil {
+			return "failed to start container.", nil, err
+		}
+		if created {
+			return "container created.", func() error {
+				return cli.ContainerRemove(ctx, ci.ID, types.ContainerRemoveOptions{Force: true})
+			}, nil
+		}
+		return "container started.", func() error {
+			return cli.ContainerStop(ctx, ci.ID, nil)
+		}, nil
+	}
+}
+
+// UpgradeContainer returns a ReversibleFixer that replaces the specified
+// container with one running the image of the supplied options, pulling it
+// first to keep the downtime short. If the new container fails to start, the
+// previous one is restored; the Rollback restores it too.
+func UpgradeContainer(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, opts *docker.EnsureContainerOpts) ReversibleFixer {
+	return func() (string, Rollback, error) {
+		ci, err := docker.CheckContainer(ctx, ow, cli, opts.ContainerName)
+		if err != nil || ci == nil {
+			return "container not found.", nil, fmt.Errorf("container %s not found: %w", opts.ContainerName, err)
+		}
+
+		pull := opts.ImageStrategy == docker.ImageStrategyPull
+		if opts.ImageStrategy == docker.ImageStrategyNone {
+			_, found, err := docker.FindImage(ctx, ow, cli, opts.ContainerConfig.Image)
+			if err != nil {
+				return "failed to look up image.", nil, err
+			}
+			pull = !found
+		}
+		if pull {
+			out, err := cli.ImagePull(ctx, opts.ContainerConfig.Image, types.ImagePullOptions{})
+			if err != nil {
+				return "failed to pull image.", nil, err
+			}
+			if _, err := docker.PipeOutput(out, ow.StdoutWriter()); err != nil {
+				return "failed to pull image.", nil, err
+			}
+		}
+
+		// the previous container, to restore. It's restored from the ID of
+		// its image, as its tag may point to another image by then, e.g. the
+		// one of the upgrade.
+		prev := *opts
+		prevConfig := *opts.ContainerConfig
+		prevConfig.Image = ci.Image
+		prev.ContainerConfig = &prevConfig
+		prev.ImageStrategy = docker.ImageStrategyLocal
+
+		replace := func(with *docker.EnsureContainerOpts) error {
+			if err := cli.ContainerRemove(ctx, opts.ContainerName, types.ContainerRemoveOptions{Force: true}); err != nil {
+				return err
+			}
+			_, _, err := docker.EnsureContainerStarted(ctx, ow, cli, with)
+			return err
+		}
+
+		if err := replace(opts); err != nil {
+			if rerr := replace(&prev); rerr != nil {
+				return "upgrade failed, and the previous container could not be restored.", nil, fmt.Errorf("%w; restoring: %s", err, rerr)
+			}
+			return "upgrade failed; previous container restored.", nil, err
+		}
+
+		msg := fmt.Sprintf("upgraded from %s to %s.", ci.Config.Image, opts.ContainerConfig.Image)
+		return msg, func() error { return replace(&prev) }, nil
+	}
+}
+
 // StartCommand returns a Fixer that starts the given process, under the
 // supplied context, via os/exec.CommandContext.
 func StartCommand(ctx context.Context, cmd string, args ...string) Fixer {
@@ -81,6 +169,20 @@ func CreateDirectory(path string) Fixer {
 	}
 }
 
+// WriteFile returns a Fixer that writes the supplied contents to the
+// specified path, creating any parent directories as appropriate.
+func WriteFile(path string, contents []byte) Fixer {
+	return func() (string, error) {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return "parent directory not created successfully.", err
+		}
+		if err := os.WriteFile(path, contents, 0644); err != nil {
+			return "file not written successfully.", err
+		}
+		return "file written successfully.", nil
+	}
+}
+
 // NotImplemented is a placeholder Fixer which always returns successfully.
 func NotImplemented() Fixer {
 	return func() (string, error) {
@@ -95,6 +197,18 @@ func RequiresManualFixing() Fixer {
 	}
 }
 
+// WithRollback returns a ReversibleFixer that applies the supplied Fixer, and
+// is undone by the supplied Rollback, which may be nil.
+func WithRollback(f Fixer, rollback Rollback) ReversibleFixer {
+	return func() (string, Rollback, error) {
+		msg, err := f()
+		if err != nil {
+			return msg, nil, err
+		}
+		return msg, rollback, nil
+	}
+}
+
 // And returns a Fixer that executes all fixes sequentially, short-circuiting at
 // the first error.
 func And(fixers ...Fixer) Fixer {
@@ -23,10 +23,25 @@ type Checker func() (ok bool, msg string, err error)
 // failed.
 type Fixer func() (msg string, err error)
 
+// Rollback is a function that undoes a fix that was applied successfully.
+type Rollback func() error
+
+// ReversibleFixer is a Fixer that, when it succeeds, also returns a Rollback
+// undoing the fix, or nil if the fix can't be undone.
+type ReversibleFixer func() (msg string, rollback Rollback, err error)
+
 type item struct {
 	Name    string
 	Checker Checker
-	Fixer   Fixer
+	Fixer   ReversibleFixer
+}
+
+// applied is a fix applied during an invocation of RunChecks, which may be
+// rolled back.
+type applied struct {
+	name     string
+	fix      int // index in the report fixes.
+	rollback Rollback
 }
 
 // Helper is a utility that facilitates the execution of healthchecks.
@@ -37,15 +52,24 @@ type item struct {
 //
 // To run the healthchecks and obtain an api.HealthcheckReport, call RunChecks.
 //
-// Healthchecks are run sequentially, in the same order they were listed.
+// Healthchecks are run sequentially, in the same order they were listed,
+// except that the healthchecks an item depends on, declared via DependsOn(),
+// always run before it. When a dependency is unhealthy, the check and the fix
+// of the dependent item are omitted.
 //
 // For each item, the Checker runs first. If it results in a "failed" status,
 // and an associated Fixer is registered, we run the Fixer, if and only if
 // "fix" mode is requested when calling RunChecks.
+//
+// Fixers enlisted via EnlistReversible() return a Rollback. If a fix fails,
+// the fixes applied earlier in the same invocation are rolled back, in reverse
+// order, and no further fixes are attempted, so that we don't leave
+// half-provisioned infrastructure behind.
 type Helper struct {
 	sync.Mutex
 
 	items  []*item
+	deps   map[string][]string
 	report *api.HealthcheckReport
 	err    error
 }
@@ -53,12 +77,80 @@ type Helper struct {
 // Enlist registers a new healthcheck, supplying its name, a compulsory Checker,
 // and an optional Fixer.
 func (h *Helper) Enlist(name string, c Checker, f Fixer) {
+	var rf ReversibleFixer
+	if f != nil {
+		rf = WithRollback(f, nil)
+	}
+	h.EnlistReversible(name, c, rf)
+}
+
+// EnlistReversible registers a new healthcheck whose optional Fixer can be
+// rolled back.
+func (h *Helper) EnlistReversible(name string, c Checker, f ReversibleFixer) {
 	h.Lock()
 	defer h.Unlock()
 
 	h.items = append(h.items, &item{name, c, f})
 }
 
+// DependsOn declares that the healthcheck with the given name requires the
+// healthchecks named by deps to succeed, e.g. a container requires the network
+// it is attached to.
+func (h *Helper) DependsOn(name string, deps ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.deps == nil {
+		h.deps = make(map[string][]string)
+	}
+	h.deps[name] = append(h.deps[name], deps...)
+}
+
+// ordered returns the items in the order they were listed, moving the
+// dependencies of each item before it.
+func (h *Helper) ordered() ([]*item, error) {
+	byName := make(map[string]*item, len(h.items))
+	for _, li := range h.items {
+		byName[li.Name] = li
+	}
+
+	var (
+		ret      = make([]*item, 0, len(h.items))
+		done     = make(map[string]bool, len(h.items))
+		visiting = make(map[string]bool)
+		visit    func(li *item) error
+	)
+	visit = func(li *item) error {
+		if done[li.Name] {
+			return nil
+		}
+		if visiting[li.Name] {
+			return fmt.Errorf("healthcheck %s depends on itself", li.Name)
+		}
+		visiting[li.Name] = true
+		for _, dep := range h.deps[li.Name] {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("healthcheck %s depends on unknown healthcheck %s", li.Name, dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		visiting[li.Name] = false
+		done[li.Name] = true
+		ret = append(ret, li)
+		return nil
+	}
+
+	for _, li := range h.items {
+		if err := visit(li); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
 // RunChecks runs the checks and returns an api.HealthcheckReport, or a non-nil
 // error if an internal error occured. See godocs on the Helper type for
 // additional information.
@@ -70,10 +162,33 @@ func (h *Helper) RunChecks(_ context.Context, fix bool) (*api.HealthcheckReport,
 		return h.report, h.err
 	}
 
+	items, err := h.ordered()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		healthy    = make(map[string]bool, len(items))
+		fixes      []applied
+		rolledBack bool
+	)
+
 	h.report = new(api.HealthcheckReport)
-	for _, li := range h.items {
+	for _, li := range items {
 		check := api.HealthcheckItem{Name: li.Name}
 
+		// Dependency is unhealthy.
+		if dep := h.unhealthyDep(li, healthy); dep != "" {
+			check.Status = api.HealthcheckStatusOmitted
+			check.Message = fmt.Sprintf("depends on %s, which is unhealthy.", dep)
+			h.report.Checks = append(h.report.Checks, check)
+
+			if fix && li.Fixer != nil {
+				h.report.Fixes = append(h.report.Fixes, api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusOmitted, Message: check.Message})
+			}
+			continue
+		}
+
 		// Check succeeds.
 		ok, msg, err := li.Checker()
 		switch {
@@ -90,6 +205,7 @@ func (h *Helper) RunChecks(_ context.Context, fix bool) (*api.HealthcheckReport,
 			check.Status = api.HealthcheckStatusOK
 			check.Message = msg
 			h.report.Checks = append(h.report.Checks, check)
+			healthy[li.Name] = true
 
 			if fix && li.Fixer != nil {
 				h.report.Fixes = append(h.report.Fixes, api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusUnnecessary})
@@ -111,19 +227,59 @@ func (h *Helper) RunChecks(_ context.Context, fix bool) (*api.HealthcheckReport,
 				break
 			}
 
+			if rolledBack {
+				h.report.Fixes = append(h.report.Fixes, api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusOmitted, Message: "not attempted, as an earlier fix failed."})
+				break
+			}
+
 			// Attempt fix if fix is enabled.
 			// The fix might result in a failure, a successful recovery.
-			var f api.HealthcheckItem
-			msg, err := li.Fixer()
+			msg, rollback, err := li.Fixer()
 			if err != nil {
-				f = api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusFailed, Message: msg}
-			} else {
-				f = api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusOK, Message: msg}
+				h.report.Fixes = append(h.report.Fixes, api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusFailed, Message: msg})
+
+				// Undo the fixes applied so far.
+				h.rollback(fixes, healthy)
+				fixes, rolledBack = nil, true
+				break
 			}
 
-			h.report.Fixes = append(h.report.Fixes, f)
+			h.report.Fixes = append(h.report.Fixes, api.HealthcheckItem{Name: li.Name, Status: api.HealthcheckStatusOK, Message: msg})
+			healthy[li.Name] = true
+			if rollback != nil {
+				fixes = append(fixes, applied{li.Name, len(h.report.Fixes) - 1, rollback})
+			}
 		}
 	}
 
 	return h.report, h.err
 }
+
+// unhealthyDep returns the first dependency of an item that is not healthy, if
+// any.
+func (h *Helper) unhealthyDep(li *item, healthy map[string]bool) string {
+	for _, dep := range h.deps[li.Name] {
+		if !healthy[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// rollback rolls back the fixes applied, in reverse order, and records it in
+// the report.
+func (h *Helper) rollback(fixes []applied, healthy map[string]bool) {
+	for i := len(fixes) - 1; i >= 0; i-- {
+		a := fixes[i]
+		f := &h.report.Fixes[a.fix]
+		healthy[a.name] = false
+
+		if err := a.rollback(); err != nil {
+			f.Status = api.HealthcheckStatusFailed
+			f.Message = fmt.Sprintf("%s; rollback failed: %s", f.Message, err)
+			continue
+		}
+		f.Status = api.HealthcheckStatusRolledBack
+		f.Message = fmt.Sprintf("%s; rolled back, as a later fix failed.", f.Message)
+	}
+}
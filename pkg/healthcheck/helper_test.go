@@ -0,0 +1,118 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// fakeInfra records the fixes applied to it, and the rollbacks.
+type fakeInfra struct {
+	up  map[string]bool
+	log []string
+}
+
+func (f *fakeInfra) check(name string) Checker {
+	return func() (bool, string, error) {
+		return f.up[name], "", nil
+	}
+}
+
+func (f *fakeInfra) fix(name string, fail bool) ReversibleFixer {
+	return func() (string, Rollback, error) {
+		f.log = append(f.log, "fix "+name)
+		if fail {
+			return "failed.", nil, errors.New("failed")
+		}
+		f.up[name] = true
+		return "fixed.", func() error {
+			f.log = append(f.log, "rollback "+name)
+			f.up[name] = false
+			return nil
+		}, nil
+	}
+}
+
+func statuses(items []api.HealthcheckItem) map[string]api.HealthcheckStatus {
+	ret := make(map[string]api.HealthcheckStatus, len(items))
+	for _, it := range items {
+		ret[it.Name] = it.Status
+	}
+	return ret
+}
+
+func TestHelperRunsDependenciesFirst(t *testing.T) {
+	infra := &fakeInfra{up: map[string]bool{}}
+
+	hh := &Helper{}
+	hh.EnlistReversible("container", infra.check("container"), infra.fix("container", false))
+	hh.EnlistReversible("network", infra.check("network"), infra.fix("network", false))
+	hh.DependsOn("container", "network")
+
+	report, err := hh.RunChecks(context.Background(), true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"fix network", "fix container"}, infra.log)
+	require.Equal(t, "network", report.Checks[0].Name)
+	require.True(t, report.FixesSucceeded())
+}
+
+func TestHelperOmitsDependentsOfUnhealthyItems(t *testing.T) {
+	infra := &fakeInfra{up: map[string]bool{"container": true}}
+
+	hh := &Helper{}
+	hh.EnlistReversible("network", infra.check("network"), infra.fix("network", false))
+	hh.EnlistReversible("container", infra.check("container"), infra.fix("container", false))
+	hh.DependsOn("container", "network")
+
+	report, err := hh.RunChecks(context.Background(), false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]api.HealthcheckStatus{
+		"network":   api.HealthcheckStatusFailed,
+		"container": api.HealthcheckStatusOmitted,
+	}, statuses(report.Checks))
+}
+
+func TestHelperRollsBackOnFailedFix(t *testing.T) {
+	infra := &fakeInfra{up: map[string]bool{}}
+
+	hh := &Helper{}
+	hh.EnlistReversible("network", infra.check("network"), infra.fix("network", false))
+	hh.EnlistReversible("redis", infra.check("redis"), infra.fix("redis", false))
+	hh.Enlist("outputs", infra.check("outputs"), func() (string, error) {
+		infra.log = append(infra.log, "fix outputs")
+		return "fixed.", nil
+	})
+	hh.EnlistReversible("sync-service", infra.check("sync-service"), infra.fix("sync-service", true))
+	hh.EnlistReversible("sidecar", infra.check("sidecar"), infra.fix("sidecar", false))
+	hh.DependsOn("sync-service", "redis", "network")
+
+	report, err := hh.RunChecks(context.Background(), true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"fix network", "fix redis", "fix outputs", "fix sync-service",
+		"rollback redis", "rollback network",
+	}, infra.log)
+	require.Equal(t, map[string]api.HealthcheckStatus{
+		"network":      api.HealthcheckStatusRolledBack,
+		"redis":        api.HealthcheckStatusRolledBack,
+		"outputs":      api.HealthcheckStatusOK,
+		"sync-service": api.HealthcheckStatusFailed,
+		"sidecar":      api.HealthcheckStatusOmitted,
+	}, statuses(report.Fixes))
+	require.False(t, report.FixesSucceeded())
+}
+
+func TestHelperRejectsDependencyCycles(t *testing.T) {
+	hh := &Helper{}
+	hh.Enlist("a", func() (bool, string, error) { return true, "", nil }, nil)
+	hh.Enlist("b", func() (bool, string, error) { return true, "", nil }, nil)
+	hh.DependsOn("a", "b")
+	hh.DependsOn("b", "a")
+
+	_, err := hh.RunChecks(context.Background(), false)
+	require.Error(t, err)
+}
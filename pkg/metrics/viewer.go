@@ -3,6 +3,7 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -21,6 +22,30 @@ func init() {
 	tagsIgnoreList["run"] = struct{}{}
 }
 
+// Stream identifies one of the two metric streams emitted by test instances.
+// Results are recorded explicitly by test plans, whereas diagnostics are
+// high-frequency observations (e.g. runtime stats) that are kept apart so
+// that analysis of results doesn't have to filter them out.
+type Stream string
+
+const (
+	StreamResults     Stream = "results"
+	StreamDiagnostics Stream = "diagnostics"
+)
+
+// ParseStream parses a metric stream name, defaulting to results when the
+// name is empty.
+func ParseStream(s string) (Stream, error) {
+	switch Stream(s) {
+	case "", StreamResults:
+		return StreamResults, nil
+	case StreamDiagnostics:
+		return StreamDiagnostics, nil
+	default:
+		return "", fmt.Errorf("unknown metric stream: %s", s)
+	}
+}
+
 type Viewer struct {
 	db string
 	cl client.Client
@@ -42,8 +67,10 @@ func NewViewer(cfg *config.EnvConfig) (*Viewer, error) {
 	return &Viewer{db: "testground", cl: cl}, nil
 }
 
-func (v *Viewer) GetMeasurements(name string) ([]string, error) {
-	cmd := fmt.Sprintf("SHOW MEASUREMENTS ON testground WITH MEASUREMENT =~ /results.%s.*/ LIMIT 20", name)
+// GetMeasurements returns the measurements of the given stream that belong to
+// the test plan and case encoded in name.
+func (v *Viewer) GetMeasurements(stream Stream, name string) ([]string, error) {
+	cmd := fmt.Sprintf("SHOW MEASUREMENTS ON testground WITH MEASUREMENT =~ /%s.%s.*/ LIMIT 20", stream, name)
 
 	q := client.Query{
 		Command:  cmd,
@@ -254,3 +281,73 @@ func marshalTags(m map[string]string) string {
 
 	return strings.Join(result, ",")
 }
+
+// Aggregate summarizes the values a measurement took for a group of a run.
+type Aggregate struct {
+	Measurement string
+	GroupID     string
+	Count       int64
+	Mean        float64
+	Min         float64
+	Max         float64
+	P95         float64
+}
+
+// RunAggregates aggregates the values of the measurements of the given stream
+// that a run recorded, by measurement and group. name encodes the test plan
+// and case of the run, like in GetMeasurements.
+func (v *Viewer) RunAggregates(stream Stream, name string, runID string) ([]Aggregate, error) {
+	cmd := fmt.Sprintf(`SELECT count("value"), mean("value"), min("value"), max("value"), percentile("value", 95) FROM /^%s\.%s\./ WHERE "run" = '%s' GROUP BY "group_id"`,
+		stream, regexp.QuoteMeta(name), strings.ReplaceAll(runID, "'", ""))
+
+	q := client.Query{
+		Command:  cmd,
+		Database: v.db,
+	}
+
+	response, err := v.cl.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error() != nil {
+		return nil, response.Error()
+	}
+
+	if len(response.Results) == 0 {
+		return nil, nil
+	}
+
+	var aggs []Aggregate
+	for _, s := range response.Results[0].Series {
+		if len(s.Values) == 0 || len(s.Values[0]) < 6 {
+			continue
+		}
+		row := s.Values[0]
+		count, _ := toFloat(row[1])
+		a := Aggregate{
+			Measurement: s.Name,
+			GroupID:     s.Tags["group_id"],
+			Count:       int64(count),
+		}
+		a.Mean, _ = toFloat(row[2])
+		a.Min, _ = toFloat(row[3])
+		a.Max, _ = toFloat(row[4])
+		a.P95, _ = toFloat(row[5])
+		aggs = append(aggs, a)
+	}
+
+	return aggs, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/testground/testground/pkg/rpc"
 	"github.com/testground/testground/pkg/rpc/rpctest"
@@ -124,3 +125,45 @@ func TestWriters(t *testing.T) {
 		testBody(t, &test, res.Body)
 	}
 }
+
+// test that a tee'd writer emits progress to both destinations.
+func TestTee(t *testing.T) {
+	var orig, tee strings.Builder
+
+	ow := rpc.NewFileOutputWriter(&orig).Tee(&tee)
+	if _, err := ow.WriteProgress([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	if orig.String() == "" || orig.String() != tee.String() {
+		t.Errorf("expected identical output in both destinations, got %q and %q", orig.String(), tee.String())
+	}
+}
+
+// test that a tee'd writer holds the lock of the writer it tees from.
+func TestTeeSharesLock(t *testing.T) {
+	var orig, tee strings.Builder
+
+	ow := rpc.NewFileOutputWriter(&orig)
+	teed := ow.Tee(&tee)
+
+	ow.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = teed.WriteProgress([]byte("test"))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the tee'd write to wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ow.Unlock()
+	<-done
+
+	if orig.String() == "" || orig.String() != tee.String() {
+		t.Errorf("expected identical output in both destinations, got %q and %q", orig.String(), tee.String())
+	}
+}
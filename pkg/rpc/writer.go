@@ -18,7 +18,9 @@ import (
 )
 
 type OutputWriter struct {
-	sync.Mutex
+	// Mutex serializes writes to out. It's shared with the writers derived
+	// through With and Tee, which write to the same destination.
+	*sync.Mutex
 	*zap.SugaredLogger
 	pw *progressWriter
 	bw *binaryWriter
@@ -30,6 +32,7 @@ func NewStdoutWriter() *OutputWriter {
 	pw := &progressWriter{out: ioutil.Discard}
 	bw := &binaryWriter{}
 	ow := &OutputWriter{
+		Mutex:         new(sync.Mutex),
 		SugaredLogger: logging.S(),
 		out:           ioutil.Discard,
 		pw:            pw,
@@ -56,6 +59,7 @@ func NewFileOutputWriter(w io.Writer) *OutputWriter {
 	logger := logging.NewLogger(writeSyncer)
 
 	ow := &OutputWriter{
+		Mutex:         new(sync.Mutex),
 		SugaredLogger: logger.Sugar(),
 		out:           writer,
 		pw:            progressWriter,
@@ -88,6 +92,7 @@ func NewOutputWriter(w http.ResponseWriter, r *http.Request) *OutputWriter {
 	logger := logging.NewLogger(writeSyncer).With(zap.String("req_id", r.Header.Get("X-Request-ID")))
 
 	ow := &OutputWriter{
+		Mutex:         new(sync.Mutex),
 		SugaredLogger: logger.Sugar(),
 		out:           httpWriter,
 		pw:            progressWriter,
@@ -106,6 +111,7 @@ func Discard() *OutputWriter {
 	pw := &progressWriter{out: ioutil.Discard}
 	bw := &binaryWriter{}
 	ow := &OutputWriter{
+		Mutex:         new(sync.Mutex),
 		SugaredLogger: zap.NewNop().Sugar(),
 		out:           ioutil.Discard,
 		pw:            pw,
@@ -199,12 +205,44 @@ func (ow *OutputWriter) BinaryWriter() io.Writer {
 // from delegating to SugaredLogger.With.
 func (ow *OutputWriter) With(args ...interface{}) *OutputWriter {
 	return &OutputWriter{
+		Mutex:         ow.Mutex,
 		SugaredLogger: ow.SugaredLogger.With(args...),
 		out:           ow.out,
 		pw:            ow.pw,
 	}
 }
 
+// Tee returns a new OutputWriter that emits all output both to the
+// destination of ow and to w, in the same chunk format. Writes through the
+// tee and through ow are serialized by the same lock.
+func (ow *OutputWriter) Tee(w io.Writer) *OutputWriter {
+	writer := ioutils.NewWriteFlusher(io.MultiWriter(ow.out, w))
+
+	// progressWriter will emit log output as progress messages.
+	progressWriter := &progressWriter{out: writer, newline: ow.pw.newline}
+
+	// binaryWriter will emit binary chunks
+	binaryWriter := &binaryWriter{}
+
+	writeSyncer := zapcore.Lock(zapcore.AddSync(progressWriter))
+	logger := logging.NewLogger(writeSyncer)
+
+	tee := &OutputWriter{
+		Mutex:         ow.Mutex,
+		SugaredLogger: logger.Sugar(),
+		out:           writer,
+		pw:            progressWriter,
+		bw:            binaryWriter,
+	}
+
+	// we need to wire this back for the lock.
+	progressWriter.ow = tee
+
+	// we need to wire this back for the lock.
+	binaryWriter.ow = tee
+	return tee
+}
+
 func (ow *OutputWriter) WriteProgress(b []byte) (n int, err error) {
 	return ow.pw.Write(b)
 }
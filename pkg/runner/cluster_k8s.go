@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,9 +33,11 @@ import (
 	"github.com/testground/testground/pkg/healthcheck"
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/syncsvc"
 	"github.com/testground/testground/pkg/task"
 	"golang.org/x/sync/errgroup"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
@@ -51,6 +54,8 @@ var (
 	_             api.Runner        = (*ClusterK8sRunner)(nil)
 	_             api.Terminatable  = (*ClusterK8sRunner)(nil)
 	_             api.Healthchecker = (*ClusterK8sRunner)(nil)
+	_             api.Debugger      = (*ClusterK8sRunner)(nil)
+	_             api.Reconciler    = (*ClusterK8sRunner)(nil)
 	mu                              = sync.Mutex{}
 	errSyncClient                   = errors.New("failed to start sync client")
 )
@@ -124,8 +129,77 @@ type ClusterK8sRunnerConfig struct {
 	RunTimeoutMin int `toml:"run_timeout_min"`
 
 	Sysctls []string `toml:"sysctls"`
+
+	// MetricsPort is the port on which test instances serve Prometheus
+	// metrics. When set, it is passed to instances as METRICS_PORT, and pods
+	// are annotated so that the cluster Prometheus scrapes them (default: not
+	// set).
+	MetricsPort string `toml:"metrics_port"`
+
+	// PrePullImages warms every plan node with the images of the run before
+	// creating any pod, reporting how long each node took to pull them
+	// (default: false).
+	PrePullImages bool `toml:"pre_pull_images"`
+
+	// PrePullTimeoutMin bounds the pre-pull phase; the run proceeds when it
+	// elapses, even if some nodes are still pulling (default: 10).
+	PrePullTimeoutMin int `toml:"pre_pull_timeout_min"`
+
+	// ImageDistribution selects how images reach the nodes when no
+	// `provider` registry is configured. "import" saves the images to a
+	// tarball on the shared volume and imports them into the containerd image
+	// store of every plan node (default: not set, i.e. images must already be
+	// reachable by the nodes).
+	ImageDistribution string `toml:"image_distribution"`
+
+	// ImageImportTool is the image providing `ctr`, used by the "import"
+	// image distribution (default: DefaultImageImportTool).
+	ImageImportTool string `toml:"image_import_tool"`
+
+	// ImageImportTimeoutMin bounds the "import" image distribution (default:
+	// 10).
+	ImageImportTimeoutMin int `toml:"image_import_timeout_min"`
+
+	// LaunchBatchSize is the number of pods created concurrently; a batch is
+	// fully created before the next one starts (default: 100).
+	LaunchBatchSize int `toml:"launch_batch_size"`
+
+	// LaunchQPS and LaunchBurst limit the rate at which pods are created, to
+	// avoid overwhelming the API server (default: 20 and 40). Creations the
+	// API server still throttles are retried with an exponential backoff.
+	LaunchQPS   int `toml:"launch_qps"`
+	LaunchBurst int `toml:"launch_burst"`
+
+	// SyncServiceShards is the number of sync service instances runs are
+	// sharded across, each one serving a share of the runs; the n-th shard
+	// (n > 0) is expected at testground-sync-service-<n> (default: 1).
+	SyncServiceShards int `toml:"sync_service_shards"`
+
+	// AllowedBindMounts are the node paths under which compositions may bind
+	// mount directories into pods, as hostPath volumes (default: none).
+	AllowedBindMounts []string `toml:"allowed_bind_mounts"`
+
+	// HostMetrics captures the CPU, memory, disk and network metrics of every
+	// plan node for the duration of the run, into the host-metrics directory
+	// of its outputs, through a DaemonSet (default: false).
+	HostMetrics bool `toml:"host_metrics"`
+	// HostMetricsInterval is how often host metrics are sampled (default:
+	// "5s").
+	HostMetricsInterval string `toml:"host_metrics_interval"`
+	// HostMetricsPort is the port the collectors of host metrics listen on,
+	// on the loopback interface of the plan nodes, since they share their
+	// network namespace. It must be free on every node (default: 9101).
+	HostMetricsPort int `toml:"host_metrics_port"`
 }
 
+// ImageDistributionImport distributes images to the nodes of the cluster by
+// importing them into the nodes' containerd, bypassing any registry.
+const ImageDistributionImport = "import"
+
+// DefaultImageImportTool is the default image used to import images into the
+// containerd image store of the nodes.
+const DefaultImageImportTool = "rancher/k3s:v1.22.2-k3s1"
+
 // ClusterK8sRunner is a runner that creates a Docker service to launch as
 // many replicated instances of a container as the run job indicates.
 type ClusterK8sRunner struct {
@@ -134,6 +208,7 @@ type ClusterK8sRunner struct {
 	pool        *pool
 	imagesLRU   *lru.Cache
 	syncClient  *ss.DefaultClient
+	syncClients *syncsvc.Clients
 }
 
 type Journal struct {
@@ -200,13 +275,69 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 
 	cfg := *input.RunnerConfig.(*ClusterK8sRunnerConfig)
 
+	if err := checkMounts(input.Groups, cfg.AllowedBindMounts); err != nil {
+		runerr = err
+		return
+	}
+
+	if err := checkPlacement(input.Groups); err != nil {
+		runerr = err
+		return
+	}
+
 	// if `provider` is set, we have to push to a docker registry
-	if cfg.Provider != "" {
+	switch {
+	case cfg.Provider != "" && cfg.ImageDistribution != "":
+		runerr = fmt.Errorf("`provider` and `image_distribution` are mutually exclusive")
+		return
+	case cfg.Provider != "":
 		err := c.pushImagesToDockerRegistry(ctx, ow, input)
 		if err != nil {
 			runerr = fmt.Errorf("failed to push images to %s; err: %w", cfg.Provider, err)
 			return
 		}
+	case cfg.ImageDistribution == ImageDistributionImport:
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			runerr = fmt.Errorf("failed to create docker client: %w", err)
+			return
+		}
+		timeout := 10 * time.Minute
+		if cfg.ImageImportTimeoutMin != 0 {
+			timeout = time.Duration(cfg.ImageImportTimeoutMin) * time.Minute
+		}
+		if err := c.importImagesToNodes(ctx, ow, cli, input, timeout); err != nil {
+			runerr = fmt.Errorf("failed to import images onto nodes; err: %w", err)
+			return
+		}
+	case cfg.ImageDistribution != "":
+		runerr = fmt.Errorf("unknown image distribution: %s", cfg.ImageDistribution)
+		return
+	}
+
+	if cfg.PrePullImages {
+		timeout := 10 * time.Minute
+		if cfg.PrePullTimeoutMin != 0 {
+			timeout = time.Duration(cfg.PrePullTimeoutMin) * time.Minute
+		}
+		// pre-pulling is an optimisation; proceed with the run if it fails.
+		if err := c.prePullImages(ctx, ow, input, timeout); err != nil {
+			ow.Warnw("failed to pre-pull images; continuing", "err", err)
+		}
+	}
+
+	if cfg.HostMetrics {
+		interval, err := parseHostMetricsInterval(cfg.HostMetricsInterval)
+		if err != nil {
+			runerr = err
+			return
+		}
+		stop, err := c.startHostMetrics(ctx, ow, input.RunID, interval, cfg.HostMetricsPort)
+		if err != nil {
+			runerr = err
+			return
+		}
+		defer stop()
 	}
 
 	defaultCPU, err := resource.ParseQuantity(cfg.TestplanPodCPU)
@@ -245,7 +376,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 
 	template.TestSubnet = &ptypes.IPNet{IPNet: *subnet}
 
-	enoughResources, err := c.checkClusterResources(ow, input.Groups, defaultMemory, defaultCPU)
+	enoughResources, err := c.checkClusterResources(ctx, ow, input.Groups, defaultMemory, defaultCPU)
 	if err != nil {
 		runerr = fmt.Errorf("couldn't check cluster resources: %v", err)
 		return
@@ -261,6 +392,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 	}
 
 	jobName := fmt.Sprintf("tg-%s", input.TestPlan)
+	syncHost := syncsvc.ShardHost(syncsvc.DefaultHost, cfg.SyncServiceShards, input.RunID)
 
 	ow.Infow("deploying testground testplan run on k8s", "job-name", jobName)
 
@@ -270,7 +402,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		ctxContainers, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		outcomesDoneCh, err := c.collectOutcomes(ctxContainers, result, &template)
+		outcomesDoneCh, err := c.collectOutcomes(ctxContainers, syncHost, result, &template)
 		if err != nil {
 			ow.Errorw("could not start collecting outcomes", "err", err)
 		}
@@ -279,6 +411,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		if err != nil {
 			return err
 		}
+		input.EnterPhase(task.PhaseCollect)
 
 		cancel()
 		<-outcomesDoneCh
@@ -287,6 +420,7 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 
 	sem := make(chan struct{}, 30) // limit the number of concurrent k8s api calls
 
+	var launches []podLaunch
 	for _, g := range input.Groups {
 		runenv := template
 		runenv.TestGroupID = g.ID
@@ -300,10 +434,12 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 
 		env := conv.ToEnvVar(runenv.ToEnvVars())
 		env = append(env, v1.EnvVar{Name: "REDIS_HOST", Value: "testground-infra-redis"})
-		env = append(env, v1.EnvVar{Name: "SYNC_SERVICE_HOST", Value: "testground-sync-service"})
+		env = append(env, v1.EnvVar{Name: "SYNC_SERVICE_HOST", Value: syncHost})
 		env = append(env, v1.EnvVar{Name: "INFLUXDB_URL", Value: "http://influxdb:8086"})
 		// This subnet should correspond to the secondary CNI's IP range (usually Weave)
 		env = append(env, v1.EnvVar{Name: "TEST_SUBNET", Value: "10.32.0.0/12"})
+		env = append(env, conv.ToEnvVar(seedEnvVars(input))...)
+		env = append(env, conv.ToEnvVar(storeEnvVars(input, g))...)
 
 		// Set the log level if provided in cfg.
 		if cfg.LogLevel != "" {
@@ -317,6 +453,11 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		for name, value := range cfg.ExposedPorts.ToEnvVars() {
 			env = append(env, v1.EnvVar{Name: name, Value: value})
 		}
+		if cfg.MetricsPort != "" {
+			for name, value := range (ExposedPorts{MetricsExposedPortLabel: cfg.MetricsPort}).ToEnvVars() {
+				env = append(env, v1.EnvVar{Name: name, Value: value})
+			}
+		}
 
 		podCPU := defaultCPU
 		if g.Resources.CPU != "" {
@@ -338,10 +479,16 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 			}
 		}
 
+		if g.Resources.MemorySwap != "" {
+			ow.Warnw("memory swap is not supported by this runner, and will be ignored", "group_id", g.ID)
+		}
+		if guaranteedQoS(g.Resources) {
+			ow.Infow("pods of group get the Guaranteed QoS class, to protect them from the OOM killer", "group_id", g.ID)
+		}
+
 		for i := 0; i < g.Instances; i++ {
 			i := i
 			g := g
-			sem <- struct{}{}
 
 			podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
 
@@ -352,28 +499,41 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 				client := c.pool.Acquire()
 				defer c.pool.Release(client)
 				ow.Debugw("deleting pod", "pod", podName)
-				err = client.CoreV1().Pods(c.config.Namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+				// the run may have been canceled; pods are deleted
+				// nonetheless.
+				dctx, cancel := cleanupContext()
+				defer cancel()
+				err := client.CoreV1().Pods(c.config.Namespace).Delete(dctx, podName, metav1.DeleteOptions{})
 				if err != nil {
 					ow.Errorw("couldn't remove pod", "pod", podName, "err", err)
 				}
 			}()
 
-			eg.Go(func() error {
-				defer func() { <-sem }()
+			currentEnv := make([]v1.EnvVar, len(env))
+			copy(currentEnv, env)
 
-				currentEnv := make([]v1.EnvVar, len(env))
-				copy(currentEnv, env)
-
-				currentEnv = append(currentEnv, v1.EnvVar{
-					Name:  "TEST_OUTPUTS_PATH",
-					Value: fmt.Sprintf("/outputs/%s/%s/%d", input.RunID, g.ID, i),
-				})
+			currentEnv = append(currentEnv, v1.EnvVar{
+				Name:  "TEST_OUTPUTS_PATH",
+				Value: fmt.Sprintf("/outputs/%s/%s/%d", input.RunID, g.ID, i),
+			})
 
-				return c.createTestplanPod(ctx, podName, input, runenv, currentEnv, g, i, podMemory, podCPU)
+			launches = append(launches, podLaunch{
+				name:  podName,
+				delay: input.StartDelay(len(launches)),
+				create: func(ctx context.Context) error {
+					return c.createTestplanPod(ctx, podName, input, runenv, currentEnv, g, i, podMemory, podCPU)
+				},
 			})
 		}
 	}
 
+	eg.Go(func() error {
+		return c.launchPods(ctx, ow, input.RunID, &cfg, launches)
+	})
+
+	// pods are deleted once their logs and placement have been collected.
+	defer input.EnterPhase(task.PhaseCleanup)
+
 	// we want to fetch logs even in an event of error
 	defer func() {
 		if input.TotalInstances <= 200 {
@@ -391,7 +551,11 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 						podName := fmt.Sprintf("%s-%s-%s-%d", jobName, input.RunID, g.ID, i)
 
 						ow.Debugw("fetching logs", "pod", podName)
-						logs, err := c.getPodLogs(ow, podName)
+						// the run may have been canceled; logs are fetched
+						// nonetheless.
+						lctx, cancel := cleanupContext()
+						defer cancel()
+						logs, err := c.getPodLogs(lctx, ow, podName)
 						if err != nil {
 							return err
 						}
@@ -412,6 +576,19 @@ func (c *ClusterK8sRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		}
 	}()
 
+	// record where the instances ran, before their pods are deleted.
+	defer func() {
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		placement, err := c.podPlacement(ctx, input.RunID)
+		if err != nil {
+			ow.Warnw("failed to record the placement of instances", "err", err)
+			return
+		}
+		result.Placement = placement
+		logPlacement(ow, placement)
+	}()
+
 	err = eg.Wait()
 	if err != nil {
 		runerr = err
@@ -465,6 +642,16 @@ func (c *ClusterK8sRunner) Healthcheck(ctx context.Context, engine api.Engine, o
 		healthcheck.NotImplemented(),
 	)
 
+	shards, _ := engine.EnvConfig().Runners["cluster:k8s"]["sync_service_shards"].(int64)
+	for n := 1; n < int(shards); n++ {
+		hh.Enlist(fmt.Sprintf("sync service shard %d pod", n),
+			healthcheck.CheckK8sPods(ctx, client, fmt.Sprintf("name=%s-%d", syncsvc.DefaultHost, n), c.config.Namespace, 1),
+			healthcheck.NotImplemented(),
+		)
+	}
+
+	hh.DependsOn("sync service pod", "redis pod")
+
 	hh.Enlist("prometheus pod",
 		healthcheck.CheckK8sPods(ctx, client, "app=prometheus", c.config.Namespace, 1),
 		healthcheck.NotImplemented(),
@@ -516,6 +703,7 @@ func (c *ClusterK8sRunner) initPool() error {
 		return err
 	}
 
+	c.syncClients = syncsvc.NewClients(context.Background(), logging.S())
 	c.syncClient, err = ss.NewGenericClient(context.Background(), logging.S())
 	if err != nil {
 		return fmt.Errorf("%w: %s", errSyncClient, err)
@@ -530,7 +718,14 @@ func (c *ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.Collec
 		return fmt.Errorf("could not init pool: %w", err)
 	}
 
+	if input.Filter != nil || input.Preview {
+		return errors.New("cluster:k8s does not filter or preview outputs; collect them whole")
+	}
+
 	log := ow.With("runner", "cluster:k8s", "run_id", input.RunID)
+	if input.Dedup {
+		log.Warn("cluster:k8s does not deduplicate outputs; collecting them as they are")
+	}
 	err := c.ensureCollectOutputsPod(ctx, input)
 	if err != nil {
 		return err
@@ -548,7 +743,8 @@ func (c *ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.Collec
 	}
 
 	// This request is sent to the collect-outputs pod
-	// tar, compress, and write to stdout.
+	// tar, and write to stdout; we compress on our end, in the requested
+	// format.
 	// stdout will remain connected so we can read it later.
 
 	log.Info("collecting outputs")
@@ -568,7 +764,7 @@ func (c *ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.Collec
 				"tar",
 				"-C",
 				"/outputs",
-				"-czf",
+				"-cf",
 				"-",
 				input.RunID,
 			},
@@ -584,18 +780,23 @@ func (c *ClusterK8sRunner) CollectOutputs(ctx context.Context, input *api.Collec
 		return err
 	}
 
-	// Connect stdout of the above command to the output file
-	// Connect stderr to a buffer which we can read from to display any errors to the user.
+	// Connect stdout of the above command to the output file, through the
+	// compressor.
 	outbuf := bufio.NewWriter(ow.BinaryWriter())
 	defer outbuf.Flush()
+	zw, err := newOutputsCompressor(outbuf, input.Compression, input.CompressionLevel)
+	if err != nil {
+		return err
+	}
 	err = exec.Stream(remotecommand.StreamOptions{
-		Stdout: outbuf,
+		Stdout: zw,
 	})
 	if err != nil {
 		log.Warnf("failed to collect results from remote collection command: %v", err)
+		zw.Close()
 		return err
 	}
-	return nil
+	return zw.Close()
 }
 
 // waitForPod waits until a given pod reaches the desired `phase` or the context is canceled
@@ -658,7 +859,7 @@ func (c *ClusterK8sRunner) ensureCollectOutputsPod(ctx context.Context, input *a
 	return nil
 }
 
-func (c *ClusterK8sRunner) getPodLogs(ow *rpc.OutputWriter, podName string) (string, error) {
+func (c *ClusterK8sRunner) getPodLogs(ctx context.Context, ow *rpc.OutputWriter, podName string) (string, error) {
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
@@ -670,7 +871,7 @@ func (c *ClusterK8sRunner) getPodLogs(ow *rpc.OutputWriter, podName string) (str
 	var err error
 	err = retry(5, 5*time.Second, func() error {
 		req := client.CoreV1().Pods(c.config.Namespace).GetLogs(podName, &podLogOpts)
-		podLogs, err = req.Stream(context.TODO())
+		podLogs, err = req.Stream(ctx)
 		if err != nil {
 			ow.Warnw("got error when trying to fetch pod logs", "err", err.Error())
 		}
@@ -804,6 +1005,7 @@ func (c *ClusterK8sRunner) watchRunPods(ctx context.Context, ow *rpc.OutputWrite
 		if counters["Running"] == input.TotalInstances && !allRunningStage {
 			allRunningStage = true
 			ow.Infow("all testplan instances in `Running` state", "took", time.Since(start).Truncate(time.Second))
+			input.EnterPhase(task.PhaseRun)
 		}
 
 		if counters["Succeeded"] == input.TotalInstances {
@@ -842,23 +1044,53 @@ func (c *ClusterK8sRunner) createTestplanPod(ctx context.Context, podName string
 		cnt++
 	}
 
+	annotations := map[string]string{"cni": defaultK8sNetworkAnnotation, "k8s.v1.cni.cncf.io/networks": "weave"}
+	if cfg.MetricsPort != "" {
+		port, err := strconv.ParseInt(cfg.MetricsPort, 10, 32)
+		if err != nil {
+			return err
+		}
+
+		ports = append(ports, v1.ContainerPort{Name: MetricsExposedPortLabel, ContainerPort: int32(port)})
+
+		// Let the cluster Prometheus discover this instance.
+		annotations["prometheus.io/scrape"] = "true"
+		annotations["prometheus.io/port"] = cfg.MetricsPort
+	}
+
 	mountPropagationMode := v1.MountPropagationHostToContainer
 	sharedVolumeName := "efs-shared"
 
+	volumes, volumeMounts := k8sMounts(g.Mounts)
+
+	labels := map[string]string{
+		"testground.plan":     input.TestPlan,
+		"testground.testcase": runenv.TestCase,
+		"testground.run_id":   input.RunID,
+		"testground.groupid":  g.ID,
+		"testground.instance": strconv.Itoa(i),
+		"testground.purpose":  "plan",
+	}
+	if n := g.Placement.InstancesPerNode; n > 0 {
+		labels[placementBucketLabel] = strconv.Itoa(i / n)
+	}
+
+	podLimits := v1.ResourceList{
+		v1.ResourceMemory: podResourceMemory,
+	}
+	if guaranteedQoS(g.Resources) {
+		podLimits[v1.ResourceCPU] = podResourceCPU
+	}
+
 	podRequest := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: podName,
-			Labels: map[string]string{
-				"testground.plan":     input.TestPlan,
-				"testground.testcase": runenv.TestCase,
-				"testground.run_id":   input.RunID,
-				"testground.groupid":  g.ID,
-				"testground.purpose":  "plan",
-			},
-			Annotations: map[string]string{"cni": defaultK8sNetworkAnnotation, "k8s.v1.cni.cncf.io/networks": "weave"},
+			Name:        podName,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Spec: v1.PodSpec{
-			Volumes: []v1.Volume{
+			Affinity: k8sAffinity(input.RunID, g, i),
+			Volumes: append([]v1.Volume{
 				{
 					Name: sharedVolumeName,
 					VolumeSource: v1.VolumeSource{
@@ -867,7 +1099,7 @@ func (c *ClusterK8sRunner) createTestplanPod(ctx context.Context, podName string
 						},
 					},
 				},
-			},
+			}, volumes...),
 			SecurityContext: &v1.PodSecurityContext{
 				Sysctls: sysctls,
 			},
@@ -917,21 +1149,20 @@ func (c *ClusterK8sRunner) createTestplanPod(ctx context.Context, podName string
 					Args:            []string{},
 					Env:             env,
 					Ports:           ports,
-					VolumeMounts: []v1.VolumeMount{
+					SecurityContext: k8sSecurityContext(g.Security),
+					VolumeMounts: append([]v1.VolumeMount{
 						{
 							Name:             sharedVolumeName,
 							MountPath:        "/outputs",
 							MountPropagation: &mountPropagationMode,
 						},
-					},
+					}, volumeMounts...),
 					Resources: v1.ResourceRequirements{
 						Requests: v1.ResourceList{
 							v1.ResourceMemory: podResourceMemory,
 							v1.ResourceCPU:    podResourceCPU,
 						},
-						Limits: v1.ResourceList{
-							v1.ResourceMemory: podResourceMemory,
-						},
+						Limits: podLimits,
 					},
 				},
 			},
@@ -943,6 +1174,122 @@ func (c *ClusterK8sRunner) createTestplanPod(ctx context.Context, podName string
 	return err
 }
 
+// placementBucketLabel labels the pods of groups with a number of instances
+// per node with their bucket: the instances sharing a node.
+const placementBucketLabel = "testground.placement.bucket"
+
+// k8sAffinity translates the placement constraints of a group into the
+// affinity of the pod of one of its instances, or nil if it has none. The
+// groups to avoid are excluded from the node of the pod. The instances of a
+// group with a number of instances per node are split in buckets; the pods of
+// a bucket are attracted to each other, and repelled by the other buckets.
+func k8sAffinity(runID string, g *api.RunGroup, i int) *v1.Affinity {
+	var (
+		p   = g.Placement
+		aff v1.Affinity
+	)
+	if len(p.AvoidGroups) == 0 && p.InstancesPerNode == 0 {
+		return nil
+	}
+
+	term := func(exprs ...metav1.LabelSelectorRequirement) v1.PodAffinityTerm {
+		return v1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"testground.run_id": runID},
+				MatchExpressions: exprs,
+			},
+			TopologyKey: "kubernetes.io/hostname",
+		}
+	}
+
+	var anti []v1.PodAffinityTerm
+	if len(p.AvoidGroups) > 0 {
+		anti = append(anti, term(metav1.LabelSelectorRequirement{
+			Key: "testground.groupid", Operator: metav1.LabelSelectorOpIn, Values: p.AvoidGroups,
+		}))
+	}
+	if n := p.InstancesPerNode; n > 0 {
+		bucket := strconv.Itoa(i / n)
+		group := metav1.LabelSelectorRequirement{Key: "testground.groupid", Operator: metav1.LabelSelectorOpIn, Values: []string{g.ID}}
+		aff.PodAffinity = &v1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
+				term(group, metav1.LabelSelectorRequirement{Key: placementBucketLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{bucket}}),
+			},
+		}
+		anti = append(anti, term(group, metav1.LabelSelectorRequirement{Key: placementBucketLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{bucket}}))
+	}
+	aff.PodAntiAffinity = &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: anti}
+	return &aff
+}
+
+// guaranteedQoS returns whether the pods of a group should get the Guaranteed
+// QoS class, for which the kubelet sets the lowest OOM score adjustment. It is
+// the closest equivalent to the OOM settings of local:docker.
+func guaranteedQoS(r api.Resources) bool {
+	return r.OOMKillDisable || r.OOMScoreAdj < 0
+}
+
+// k8sSecurityContext converts the security context of a group into the
+// security context of its testplan containers, or nil if it's the default.
+func k8sSecurityContext(s api.Security) *v1.SecurityContext {
+	caps := s.Capabilities()
+	if len(caps) == 0 && !s.Privileged && s.Seccomp == "" {
+		return nil
+	}
+
+	sc := &v1.SecurityContext{}
+	if len(caps) > 0 {
+		sc.Capabilities = &v1.Capabilities{}
+		for _, c := range caps {
+			sc.Capabilities.Add = append(sc.Capabilities.Add, v1.Capability(c))
+		}
+	}
+	if s.Privileged {
+		sc.Privileged = &s.Privileged
+	}
+	switch s.Seccomp {
+	case api.SeccompDefault:
+		sc.SeccompProfile = &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault}
+	case api.SeccompUnconfined:
+		sc.SeccompProfile = &v1.SeccompProfile{Type: v1.SeccompProfileTypeUnconfined}
+	}
+	return sc
+}
+
+// k8sMounts converts the mounts of a group into the volumes of a pod, and
+// their mounts in the testplan container. Volume mounts are backed by an
+// emptyDir, which lives as long as the pod; tmpfs mounts by a memory-backed
+// emptyDir; bind mounts by a hostPath volume.
+func k8sMounts(mounts []api.Mount) ([]v1.Volume, []v1.VolumeMount) {
+	volumes := make([]v1.Volume, 0, len(mounts))
+	volumeMounts := make([]v1.VolumeMount, 0, len(mounts))
+	for i, m := range mounts {
+		name := fmt.Sprintf("mount-%d", i)
+
+		var src v1.VolumeSource
+		switch m.Type {
+		case api.MountTypeVolume:
+			src.EmptyDir = &v1.EmptyDirVolumeSource{}
+		case api.MountTypeBind:
+			src.HostPath = &v1.HostPathVolumeSource{Path: m.Source}
+		case api.MountTypeTmpfs:
+			src.EmptyDir = &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}
+			// the size was validated along with the composition.
+			if size, _ := m.SizeBytes(); size > 0 {
+				src.EmptyDir.SizeLimit = resource.NewQuantity(size, resource.BinarySI)
+			}
+		}
+
+		volumes = append(volumes, v1.Volume{Name: name, VolumeSource: src})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      name,
+			MountPath: m.Target,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+	return volumes, volumeMounts
+}
+
 func int64Ptr(i int64) *int64 { return &i }
 
 type FakeWriterAt struct {
@@ -955,7 +1302,7 @@ func (fw FakeWriterAt) WriteAt(p []byte, offset int64) (n int, err error) {
 }
 
 // checkClusterResources returns whether we can fit the input groups in the current cluster
-func (c *ClusterK8sRunner) checkClusterResources(ow *rpc.OutputWriter, groups []*api.RunGroup, fallbackMemory resource.Quantity, fallbackCPU resource.Quantity) (bool, error) {
+func (c *ClusterK8sRunner) checkClusterResources(ctx context.Context, ow *rpc.OutputWriter, groups []*api.RunGroup, fallbackMemory resource.Quantity, fallbackCPU resource.Quantity) (bool, error) {
 	neededCPUs := 0.0
 
 	defaultPodCPU, err := strconv.ParseFloat(fallbackCPU.AsDec().String(), 64)
@@ -966,7 +1313,7 @@ func (c *ClusterK8sRunner) checkClusterResources(ow *rpc.OutputWriter, groups []
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
-	res, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
+	res, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
 		LabelSelector: "testground.node.role.plan=true",
 	})
 	if err != nil {
@@ -1030,6 +1377,30 @@ func (c *ClusterK8sRunner) TerminateAll(ctx context.Context, ow *rpc.OutputWrite
 	return nil
 }
 
+// CleanupRun deletes the pods of a run.
+func (c *ClusterK8sRunner) CleanupRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
+	if err := c.initPool(); err != nil {
+		return fmt.Errorf("could not init pool: %w", err)
+	}
+
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	runPods := metav1.ListOptions{
+		LabelSelector: "testground.run_id=" + runID,
+	}
+	// delete the daemonsets of the run first, so that they don't recreate
+	// their pods.
+	if err := client.AppsV1().DaemonSets(c.config.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, runPods); err != nil {
+		ow.Warnw("could not delete the daemonsets of run", "run_id", runID, "err", err)
+	}
+	if err := client.CoreV1().Pods(c.config.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, runPods); err != nil {
+		ow.Errorw("could not delete the pods of run", "run_id", runID, "err", err)
+		return err
+	}
+	return nil
+}
+
 func (c *ClusterK8sRunner) pushImagesToDockerRegistry(ctx context.Context, ow *rpc.OutputWriter, in *api.RunInput) error {
 	cfg := *in.RunnerConfig.(*ClusterK8sRunnerConfig)
 
@@ -1093,6 +1464,268 @@ func (c *ClusterK8sRunner) pushImagesToDockerRegistry(ctx context.Context, ow *r
 	return c.pushToDockerRegistry(ctx, ow, cli, in, ipo, uri)
 }
 
+// prePullImages warms every plan node with the images of the run, through a
+// short-lived DaemonSet with a container per image. It returns once all
+// scheduled nodes have pulled all images, logging how long each node took.
+func (c *ClusterK8sRunner) prePullImages(ctx context.Context, ow *rpc.OutputWriter, input *api.RunInput, timeout time.Duration) error {
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	name := fmt.Sprintf("tg-prepull-%s", input.RunID)
+	labels := map[string]string{
+		"testground.run_id":  input.RunID,
+		"testground.purpose": "prepull",
+	}
+
+	var containers []v1.Container
+	for i, img := range runImages(input.Groups) {
+		containers = append(containers, v1.Container{
+			Name:            fmt.Sprintf("pull-%d", i),
+			Image:           img,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			// we only need the image on the node; don't run the test plan.
+			Command: []string{"sh", "-c", "sleep 86400"},
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{
+					v1.ResourceMemory: resource.MustParse("10Mi"),
+					v1.ResourceCPU:    resource.MustParse("10m"),
+				},
+			},
+		})
+	}
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers:   containers,
+					NodeSelector: map[string]string{"testground.node.role.plan": "true"},
+				},
+			},
+		},
+	}
+
+	start := time.Now()
+	ow.Infow("pre-pulling images on plan nodes", "images", len(containers))
+
+	if _, err := client.AppsV1().DaemonSets(c.config.Namespace).Create(ctx, ds, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create pre-pull daemonset: %w", err)
+	}
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		err := client.AppsV1().DaemonSets(c.config.Namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			ow.Warnw("failed to delete pre-pull daemonset", "name", name, "err", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var (
+		pulled  = make(map[string]struct{})
+		desired int32
+	)
+	for {
+		current, err := client.AppsV1().DaemonSets(c.config.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			desired = current.Status.DesiredNumberScheduled
+		}
+
+		pods, err := client.CoreV1().Pods(c.config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("testground.purpose=prepull,testground.run_id=%s", input.RunID),
+		})
+		if err == nil {
+			for _, pod := range pods.Items {
+				node := pod.Spec.NodeName
+				if _, ok := pulled[node]; ok || node == "" || !imagesPulled(&pod) {
+					continue
+				}
+				pulled[node] = struct{}{}
+				ow.Infow("node pulled images", "node", node, "took", time.Since(start).Truncate(time.Second))
+			}
+		}
+
+		if desired > 0 && len(pulled) >= int(desired) {
+			ow.Infow("pre-pulled images on all plan nodes", "nodes", len(pulled), "took", time.Since(start).Truncate(time.Second))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pre-pull incomplete after %s; %d/%d nodes ready: %w", timeout, len(pulled), desired, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// zoneLabels are the node labels holding the availability zone of nodes, in
+// order of preference.
+var zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+
+// podPlacement returns the nodes, and their zones, the testplan pods of a run
+// were scheduled on. Pods not scheduled yet are left out.
+func (c *ClusterK8sRunner) podPlacement(ctx context.Context, runID string) ([]api.InstancePlacement, error) {
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	pods, err := client.CoreV1().Pods(c.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("testground.purpose=plan,testground.run_id=%s", runID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make(map[string]string)
+	placement := make([]api.InstancePlacement, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		node := pod.Spec.NodeName
+		if node == "" {
+			continue
+		}
+		zone, ok := zones[node]
+		if !ok {
+			if n, err := client.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{}); err == nil {
+				zone = nodeZone(n)
+			}
+			zones[node] = zone
+		}
+		instance, _ := strconv.Atoi(pod.Labels["testground.instance"])
+		placement = append(placement, api.InstancePlacement{
+			Group:    pod.Labels["testground.groupid"],
+			Instance: instance,
+			Host:     node,
+			Zone:     zone,
+		})
+	}
+
+	sort.Slice(placement, func(i, j int) bool {
+		if placement[i].Group != placement[j].Group {
+			return placement[i].Group < placement[j].Group
+		}
+		return placement[i].Instance < placement[j].Instance
+	})
+	return placement, nil
+}
+
+// nodeZone returns the availability zone of a node, if labelled with it.
+func nodeZone(node *v1.Node) string {
+	for _, l := range zoneLabels {
+		if z := node.Labels[l]; z != "" {
+			return z
+		}
+	}
+	return ""
+}
+
+// startHostMetrics starts a DaemonSet capturing the metrics of every plan
+// node into the host metrics directory of the outputs of a run, on the shared
+// volume. The returned function deletes it.
+func (c *ClusterK8sRunner) startHostMetrics(ctx context.Context, ow *rpc.OutputWriter, runID string, interval int, port int) (func(), error) {
+	if port == 0 {
+		port = defaultHostMetricsPort
+	}
+
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	name := fmt.Sprintf("tg-host-metrics-%s", runID)
+	labels := map[string]string{
+		"testground.run_id":  runID,
+		"testground.purpose": "host-metrics",
+	}
+
+	mountPropagationMode := v1.MountPropagationHostToContainer
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					HostNetwork: true,
+					HostPID:     true,
+					Volumes: []v1.Volume{
+						{
+							Name:         "root",
+							VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/"}},
+						},
+						{
+							Name: "efs-shared",
+							VolumeSource: v1.VolumeSource{
+								PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "efs"},
+							},
+						},
+					},
+					Containers: []v1.Container{
+						{
+							Name:            "host-metrics",
+							Image:           hostMetricsImage,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Command:         []string{"/bin/sh", "-c", hostMetricsScript(port, interval, "/outputs/"+runID+"/"+hostMetricsDir)},
+							Env: []v1.EnvVar{{
+								Name:      "NODE_NAME",
+								ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+							}},
+							VolumeMounts: []v1.VolumeMount{
+								{Name: "root", MountPath: "/host", ReadOnly: true, MountPropagation: &mountPropagationMode},
+								{Name: "efs-shared", MountPath: "/outputs", MountPropagation: &mountPropagationMode},
+							},
+							Resources: v1.ResourceRequirements{
+								Limits: v1.ResourceList{
+									v1.ResourceMemory: resource.MustParse("64Mi"),
+									v1.ResourceCPU:    resource.MustParse("100m"),
+								},
+							},
+						},
+					},
+					NodeSelector: map[string]string{"testground.node.role.plan": "true"},
+				},
+			},
+		},
+	}
+
+	if _, err := client.AppsV1().DaemonSets(c.config.Namespace).Create(ctx, ds, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create host metrics daemonset: %w", err)
+	}
+	ow.Infow("capturing host metrics of plan nodes", "dir", hostMetricsDir, "interval_s", interval)
+
+	return func() {
+		client := c.pool.Acquire()
+		defer c.pool.Release(client)
+
+		propagation := metav1.DeletePropagationBackground
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		err := client.AppsV1().DaemonSets(c.config.Namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			ow.Warnw("failed to delete host metrics daemonset", "name", name, "err", err)
+		}
+	}, nil
+}
+
+// imagesPulled returns whether all the images of a pod are present on its
+// node. Containers report an image ID once their image has been pulled.
+func imagesPulled(pod *v1.Pod) bool {
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.ImageID == "" {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *ClusterK8sRunner) createCollectOutputsPod(ctx context.Context, input *api.CollectionInput) error {
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
@@ -1166,7 +1799,7 @@ func (c *ClusterK8sRunner) createCollectOutputsPod(ctx context.Context, input *a
 	return err
 }
 
-func (c *ClusterK8sRunner) GetClusterCapacity() (int64, int64, error) {
+func (c *ClusterK8sRunner) GetClusterCapacity(ctx context.Context) (int64, int64, error) {
 	if err := c.initPool(); err != nil {
 		return -1, -1, fmt.Errorf("could not init pool: %w", err)
 	}
@@ -1174,7 +1807,7 @@ func (c *ClusterK8sRunner) GetClusterCapacity() (int64, int64, error) {
 	client := c.pool.Acquire()
 	defer c.pool.Release(client)
 
-	res, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
+	res, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
 		LabelSelector: "testground.node.role.plan=true",
 	})
 	if err != nil {
@@ -1207,8 +1840,19 @@ func (c *ClusterK8sRunner) GetClusterCapacity() (int64, int64, error) {
 	return allocatableCPUs, allocatableMemory, nil
 }
 
-func (c *ClusterK8sRunner) collectOutcomes(ctx context.Context, result *Result, tpl *runtime.RunParams) (chan bool, error) {
-	eventsCh, err := c.syncClient.SubscribeEvents(ctx, tpl)
+// collectOutcomes collects the outcomes of instances from the sync service
+// at syncHost. The first shard is reached through the client configured from
+// the environment of the daemon.
+func (c *ClusterK8sRunner) collectOutcomes(ctx context.Context, syncHost string, result *Result, tpl *runtime.RunParams) (chan bool, error) {
+	client := c.syncClient
+	if syncHost != syncsvc.DefaultHost {
+		var err error
+		if client, err = c.syncClients.Get(syncHost); err != nil {
+			return nil, err
+		}
+	}
+
+	eventsCh, err := client.SubscribeEvents(ctx, tpl)
 	if err != nil {
 		return nil, err
 	}
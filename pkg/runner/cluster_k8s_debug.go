@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// DebugShell starts a shell in the pod of an instance, with a TTY.
+func (c *ClusterK8sRunner) DebugShell(ctx context.Context, in *api.DebugInput) (io.ReadWriteCloser, error) {
+	if err := c.initPool(); err != nil {
+		return nil, fmt.Errorf("could not init pool: %w", err)
+	}
+
+	pod, err := c.debugPod(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	k8sCfg, err := clientcmd.BuildConfigFromFlags("", c.config.KubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	req := client.
+		CoreV1().
+		RESTClient().
+		Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(c.config.Namespace).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Command:   debugShell,
+			Stdin:     true,
+			Stdout:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(k8sCfg, "POST", req.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	opts := remotecommand.StreamOptions{Stdin: stdinR, Stdout: stdoutW, Tty: true}
+	if in.Rows > 0 && in.Cols > 0 {
+		opts.TerminalSizeQueue = &fixedTerminalSize{size: &remotecommand.TerminalSize{Height: uint16(in.Rows), Width: uint16(in.Cols)}}
+	}
+
+	go func() {
+		err := exec.Stream(opts)
+		_ = stdoutW.CloseWithError(err)
+		_ = stdinR.Close()
+	}()
+
+	return &execStream{stdin: stdinW, stdout: stdoutR}, nil
+}
+
+// DebugDial connects to a port of an instance, through the address of its
+// pod; the daemon is expected to run in the cluster.
+func (c *ClusterK8sRunner) DebugDial(ctx context.Context, in *api.DebugInput, port int) (net.Conn, error) {
+	if err := c.initPool(); err != nil {
+		return nil, fmt.Errorf("could not init pool: %w", err)
+	}
+
+	pod, err := c.debugPod(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Status.PodIP == "" {
+		return nil, fmt.Errorf("pod %s has no address", pod.Name)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)))
+}
+
+// debugPod returns the running pod of the instance to debug.
+func (c *ClusterK8sRunner) debugPod(ctx context.Context, in *api.DebugInput) (*v1.Pod, error) {
+	client := c.pool.Acquire()
+	defer c.pool.Release(client)
+
+	selector := fmt.Sprintf("testground.run_id=%s,testground.instance=%d", in.RunID, in.Instance)
+	if in.GroupID != "" {
+		selector += ",testground.groupid=" + in.GroupID
+	}
+
+	pods, err := client.CoreV1().Pods(c.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(pods.Items) {
+	case 0:
+		return nil, fmt.Errorf("no running pod for instance %d of run %s", in.Instance, in.RunID)
+	case 1:
+		return &pods.Items[0], nil
+	default:
+		return nil, fmt.Errorf("instance %d of run %s is ambiguous; specify its group", in.Instance, in.RunID)
+	}
+}
+
+// execStream is the terminal of a command executed in a pod.
+type execStream struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+}
+
+func (s *execStream) Read(p []byte) (int, error)  { return s.stdout.Read(p) }
+func (s *execStream) Write(p []byte) (int, error) { return s.stdin.Write(p) }
+func (s *execStream) CloseWrite() error           { return s.stdin.Close() }
+
+func (s *execStream) Close() error {
+	_ = s.stdin.Close()
+	return s.stdout.Close()
+}
+
+// fixedTerminalSize reports a single terminal size.
+type fixedTerminalSize struct {
+	size *remotecommand.TerminalSize
+}
+
+func (q *fixedTerminalSize) Next() *remotecommand.TerminalSize {
+	size := q.size
+	q.size = nil
+	return size
+}
@@ -0,0 +1,199 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Defaults of the pod launch settings of the cluster:k8s runner.
+const (
+	defaultLaunchBatchSize = 100
+	defaultLaunchQPS       = 20
+	defaultLaunchBurst     = 40
+)
+
+var (
+	// launchRetries is the number of times the creation of a pod is retried
+	// when the API server throttles it.
+	launchRetries = 8
+	// launchBackoff is the delay before the first retry; it doubles with
+	// every retry, up to launchMaxBackoff.
+	launchBackoff    = 500 * time.Millisecond
+	launchMaxBackoff = 30 * time.Second
+	// launchProgressInterval is how often the launch progress is reported.
+	launchProgressInterval = 5 * time.Second
+)
+
+// podLaunch is a test plan pod to be created.
+type podLaunch struct {
+	name string
+	// delay is how long after the start of the launch the pod is created,
+	// when instances are staggered.
+	delay  time.Duration
+	create func(ctx context.Context) error
+}
+
+// launchPods creates the pods of a run in batches of LaunchBatchSize pods,
+// issuing at most LaunchQPS creations per second, and reports the progress of
+// the launch until all pods have been created. Every pod in a batch is
+// created before the next batch starts, and no pod is created before its
+// delay.
+func (c *ClusterK8sRunner) launchPods(ctx context.Context, ow *rpc.OutputWriter, runID string, cfg *ClusterK8sRunnerConfig, pods []podLaunch) error {
+	batch, qps, burst := cfg.LaunchBatchSize, cfg.LaunchQPS, cfg.LaunchBurst
+	if batch <= 0 {
+		batch = defaultLaunchBatchSize
+	}
+	if qps <= 0 {
+		qps = defaultLaunchQPS
+	}
+	if burst <= 0 {
+		burst = defaultLaunchBurst
+	}
+
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst)
+	defer limiter.Stop()
+
+	var (
+		created int64
+		start   = time.Now()
+		stop    = make(chan struct{})
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		c.reportLaunchProgress(ctx, ow, runID, len(pods), &created, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	ow.Infow("creating testplan pods", "count", len(pods), "batch_size", batch, "qps", qps, "burst", burst)
+
+	for i := 0; i < len(pods); i += batch {
+		end := i + batch
+		if end > len(pods) {
+			end = len(pods)
+		}
+
+		var eg errgroup.Group
+		for _, p := range pods[i:end] {
+			p := p
+			eg.Go(func() error {
+				if err := waitStartDelay(ctx, start, p.delay); err != nil {
+					return err
+				}
+				if err := createWithBackoff(ctx, limiter, p.create); err != nil {
+					return fmt.Errorf("could not create pod %s: %w", p.name, err)
+				}
+				atomic.AddInt64(&created, 1)
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+		ow.Debugw("created batch of testplan pods", "created", end, "total", len(pods))
+	}
+
+	ow.Infow("all testplan pods created", "count", len(pods), "took", time.Since(start).Truncate(time.Second))
+	return nil
+}
+
+// createWithBackoff calls create once the limiter allows it, and retries it
+// with an exponential backoff when the API server responds with 429 Too Many
+// Requests.
+func createWithBackoff(ctx context.Context, limiter flowcontrol.RateLimiter, create func(ctx context.Context) error) error {
+	delay := launchBackoff
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := create(ctx)
+		if err == nil || !k8serrors.IsTooManyRequests(err) || attempt == launchRetries {
+			return err
+		}
+
+		// honour the delay suggested by the server, if longer.
+		wait := delay
+		if s, ok := k8serrors.SuggestsClientDelay(err); ok && time.Duration(s)*time.Second > wait {
+			wait = time.Duration(s) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if delay *= 2; delay > launchMaxBackoff {
+			delay = launchMaxBackoff
+		}
+	}
+}
+
+// reportLaunchProgress periodically reports how many pods of a run have been
+// created, scheduled, are running and have completed, until stop is closed.
+func (c *ClusterK8sRunner) reportLaunchProgress(ctx context.Context, ow *rpc.OutputWriter, runID string, total int, created *int64, stop <-chan struct{}) {
+	ticker := time.NewTicker(launchProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		client := c.pool.Acquire()
+		res, err := client.CoreV1().Pods(c.config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("testground.run_id=%s", runID),
+		})
+		c.pool.Release(client)
+		if err != nil {
+			ow.Warnw("k8s client pods list error", "err", err.Error())
+			continue
+		}
+
+		p := countLaunchedPods(res.Items)
+		ow.Infow("launching testplan pods",
+			"created", atomic.LoadInt64(created),
+			"total", total,
+			"scheduled", p.scheduled,
+			"running", p.running,
+			"completed", p.completed)
+	}
+}
+
+// launchedPods are the counts reported while launching pods.
+type launchedPods struct {
+	scheduled, running, completed int
+}
+
+func countLaunchedPods(pods []v1.Pod) launchedPods {
+	var res launchedPods
+	for _, p := range pods {
+		if p.Spec.NodeName != "" {
+			res.scheduled++
+		}
+		switch p.Status.Phase {
+		case v1.PodRunning:
+			res.running++
+		case v1.PodSucceeded, v1.PodFailed:
+			res.completed++
+		}
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestCreateWithBackoff(t *testing.T) {
+	defer func(b time.Duration) { launchBackoff = b }(launchBackoff)
+	launchBackoff = time.Millisecond
+
+	limiter := flowcontrol.NewFakeAlwaysRateLimiter()
+
+	// throttled creations are retried.
+	attempts := 0
+	err := createWithBackoff(context.Background(), limiter, func(context.Context) error {
+		if attempts++; attempts < 3 {
+			return k8serrors.NewTooManyRequests("slow down", 0)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	// other errors are not.
+	attempts = 0
+	err = createWithBackoff(context.Background(), limiter, func(context.Context) error {
+		attempts++
+		return errors.New("invalid pod")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+
+	// retries are bounded.
+	attempts = 0
+	err = createWithBackoff(context.Background(), limiter, func(context.Context) error {
+		attempts++
+		return k8serrors.NewTooManyRequests("slow down", 0)
+	})
+	require.True(t, k8serrors.IsTooManyRequests(err))
+	require.Equal(t, launchRetries+1, attempts)
+}
+
+func TestCountLaunchedPods(t *testing.T) {
+	pods := []v1.Pod{
+		{Status: v1.PodStatus{Phase: v1.PodPending}},
+		{Spec: v1.PodSpec{NodeName: "a"}, Status: v1.PodStatus{Phase: v1.PodPending}},
+		{Spec: v1.PodSpec{NodeName: "a"}, Status: v1.PodStatus{Phase: v1.PodRunning}},
+		{Spec: v1.PodSpec{NodeName: "b"}, Status: v1.PodStatus{Phase: v1.PodSucceeded}},
+		{Spec: v1.PodSpec{NodeName: "b"}, Status: v1.PodStatus{Phase: v1.PodFailed}},
+	}
+	require.Equal(t, launchedPods{scheduled: 4, running: 1, completed: 2}, countLaunchedPods(pods))
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestK8sMounts(t *testing.T) {
+	volumes, volumeMounts := k8sMounts([]api.Mount{
+		{Type: api.MountTypeTmpfs, Target: "/scratch", Size: "1MiB"},
+		{Type: api.MountTypeBind, Source: "/mnt/scratch", Target: "/data", ReadOnly: true},
+	})
+	require.Len(t, volumes, 2)
+	require.Len(t, volumeMounts, 2)
+
+	require.Equal(t, v1.StorageMediumMemory, volumes[0].EmptyDir.Medium)
+	require.Equal(t, int64(1<<20), volumes[0].EmptyDir.SizeLimit.Value())
+	require.Equal(t, "/mnt/scratch", volumes[1].HostPath.Path)
+
+	require.Equal(t, volumes[1].Name, volumeMounts[1].Name)
+	require.Equal(t, "/data", volumeMounts[1].MountPath)
+	require.True(t, volumeMounts[1].ReadOnly)
+}
+
+func TestK8sSecurityContext(t *testing.T) {
+	require.Nil(t, k8sSecurityContext(api.Security{}))
+
+	sc := k8sSecurityContext(api.Security{CapAdd: []string{"cap_net_admin"}, Seccomp: api.SeccompUnconfined})
+	require.Equal(t, []v1.Capability{"NET_ADMIN"}, sc.Capabilities.Add)
+	require.Nil(t, sc.Privileged)
+	require.Equal(t, v1.SeccompProfileTypeUnconfined, sc.SeccompProfile.Type)
+}
+
+func TestK8sAffinity(t *testing.T) {
+	require.Nil(t, k8sAffinity("run", &api.RunGroup{ID: "a"}, 0))
+
+	g := &api.RunGroup{ID: "a", Instances: 4, Placement: api.Placement{AvoidGroups: []string{"b"}, InstancesPerNode: 2}}
+	aff := k8sAffinity("run", g, 3)
+
+	require.Len(t, aff.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 1)
+	attract := aff.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+	require.Equal(t, "kubernetes.io/hostname", attract.TopologyKey)
+	require.Equal(t, "run", attract.LabelSelector.MatchLabels["testground.run_id"])
+	require.Equal(t, []string{"1"}, attract.LabelSelector.MatchExpressions[1].Values)
+
+	anti := aff.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	require.Len(t, anti, 2)
+	require.Equal(t, []string{"b"}, anti[0].LabelSelector.MatchExpressions[0].Values)
+	require.Equal(t, placementBucketLabel, anti[1].LabelSelector.MatchExpressions[1].Key)
+	require.EqualValues(t, "NotIn", anti[1].LabelSelector.MatchExpressions[1].Operator)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/testground/testground/pkg/aws"
 	"github.com/testground/testground/pkg/conv"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/task"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/docker/docker/api/types"
@@ -76,6 +77,12 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		cfg = *input.RunnerConfig.(*ClusterSwarmRunnerConfig)
 	)
 
+	// the replicas of a service are all scheduled at once; they can't be
+	// staggered.
+	if len(input.StartDelays) > 0 {
+		return nil, fmt.Errorf("cluster:swarm doesn't support staggering the start of instances")
+	}
+
 	// global timeout of 1 minute for the scheduling.
 	ctx, cancelFn := context.WithTimeout(ctx, 1*time.Minute)
 	defer cancelFn()
@@ -201,6 +208,7 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 
 		// Serialize the runenv into env variables to pass to docker.
 		env := conv.ToOptionsSlice(runenv.ToEnvVars())
+		env = append(env, conv.ToOptionsSlice(seedEnvVars(input))...)
 
 		// Set the log level if provided in cfg.
 		if cfg.LogLevel != "" {
@@ -273,6 +281,8 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		services[serviceResp.ID] = g.Instances
 	}
 
+	input.EnterPhase(task.PhaseRun)
+
 	// If we are running in background mode, return immediately.
 	if cfg.Background {
 		return &api.RunOutput{RunID: input.RunID}, nil
@@ -288,7 +298,7 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 	// if the flag has been set.
 	errgrp, ctx := errgroup.WithContext(ctx)
 	for service, count := range services {
-		rc, err := cli.ServiceLogs(context.Background(), service, types.ContainerLogsOptions{
+		rc, err := cli.ServiceLogs(ctx, service, types.ContainerLogsOptions{
 			ShowStdout: true,
 			ShowStderr: true,
 			Since:      "2019-01-01T00:00:00",
@@ -352,6 +362,8 @@ func (*ClusterSwarmRunner) Run(ctx context.Context, input *api.RunInput, ow *rpc
 		fmt.Println(scanner.Text())
 	}
 
+	input.EnterPhase(task.PhaseCleanup)
+
 	if !cfg.KeepService {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 		defer cancel()
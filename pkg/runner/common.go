@@ -2,7 +2,6 @@ package runner
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -10,6 +9,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/rpc"
@@ -25,6 +26,93 @@ var (
 
 var ErrRunnerDisabled = fmt.Errorf("runner is disabled by config")
 
+// cleanupTimeout bounds the cleanup done by runners once a run is over, which
+// can't use the context of the run as it may have been canceled already.
+const cleanupTimeout = time.Minute
+
+// cleanupContext returns the context of the cleanup done once a run is over.
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+// EnvTestRunSeed is the environment variable through which instances are given
+// the seed of their run, to seed their randomness with.
+const EnvTestRunSeed = "TEST_RUN_SEED"
+
+// seedEnvVars returns the environment variables that pass the seed of the run
+// to instances.
+//
+// The result can be piped through conv.ToOptionsSlice to turn it into a slice.
+func seedEnvVars(input *api.RunInput) map[string]string {
+	return map[string]string{EnvTestRunSeed: strconv.FormatInt(input.Seed, 10)}
+}
+
+// Environment variables through which instances are told how to reach the
+// key/value store of their run. Instances GET the URL for a JSON object of the
+// stored values, and writers POST {"key": ..., "value": ...} to it, passing
+// the token as a bearer token.
+//
+// Datasets are fetched by appending their name and ?run_id=<run> to
+// TEST_DATASETS_URL, with the same token.
+//
+// Instances measure the offset of their clock against the daemon by GETting
+// TEST_CLOCK_URL, which needs no token; see api.TimeResponse.
+//
+// Instances abort the whole run by POSTing an api.AbortRunRequest to
+// TEST_ABORT_URL, with either token, and claim a role of the run by POSTing an
+// api.ClaimRoleRequest to TEST_ROLES_URL.
+const (
+	EnvTestRunStoreURL   = "TEST_RUN_STORE_URL"
+	EnvTestRunStoreToken = "TEST_RUN_STORE_TOKEN"
+	EnvTestDatasetsURL   = "TEST_DATASETS_URL"
+	EnvTestClockURL      = "TEST_CLOCK_URL"
+	EnvTestAbortURL      = "TEST_ABORT_URL"
+	EnvTestRolesURL      = "TEST_ROLES_URL"
+	EnvTestObjectsURL    = "TEST_OBJECTS_URL"
+)
+
+// storeEnvVars returns the environment variables through which the instances
+// of a group reach the key/value store of the run, if it is exposed to them.
+//
+// The result can be piped through conv.ToOptionsSlice to turn it into a slice.
+func storeEnvVars(input *api.RunInput, g *api.RunGroup) map[string]string {
+	if input.Store == nil {
+		return map[string]string{}
+	}
+	token := input.Store.ReadToken
+	if g.ID == input.Store.WriterGroup {
+		token = input.Store.WriteToken
+	}
+	return map[string]string{
+		EnvTestRunStoreURL:   input.Store.URL,
+		EnvTestRunStoreToken: token,
+		EnvTestDatasetsURL:   input.Store.DatasetsURL,
+		EnvTestClockURL:      input.Store.ClockURL,
+		EnvTestAbortURL:      input.Store.AbortURL,
+		EnvTestRolesURL:      input.Store.RolesURL,
+		EnvTestObjectsURL:    input.Store.ObjectsURL,
+	}
+}
+
+// waitStartDelay blocks until delay has elapsed since start, to stagger the
+// start of instances.
+func waitStartDelay(ctx context.Context, start time.Time, delay time.Duration) error {
+	d := time.Until(start.Add(delay))
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 func nextDataNetwork(lenNetworks int) (*net.IPNet, string, error) {
 	if lenNetworks > 4095 {
 		return nil, "", errors.New("space exhausted")
@@ -39,7 +127,9 @@ func nextDataNetwork(lenNetworks int) (*net.IPNet, string, error) {
 	return subnet, gw, err
 }
 
-func gzipRunOutputs(ctx context.Context, basedir string, input *api.CollectionInput, ow *rpc.OutputWriter) error {
+// archiveRunOutputs writes the outputs of a run under basedir to ow, as a
+// tarball compressed with the format requested.
+func archiveRunOutputs(ctx context.Context, basedir string, input *api.CollectionInput, ow *rpc.OutputWriter) error {
 	pattern := filepath.Join(basedir, "*", input.RunID)
 
 	matches, err := filepath.Glob(pattern)
@@ -59,15 +149,40 @@ func gzipRunOutputs(ctx context.Context, basedir string, input *api.CollectionIn
 		return fmt.Errorf("internal error: not a directory when accessing run outputs")
 	}
 
-	gz := gzip.NewWriter(ow.BinaryWriter())
-	defer gz.Close()
-
-	tw := tar.NewWriter(gz)
-	defer tw.Close()
+	filter, err := newOutputsFilter(input.Filter)
+	if err != nil {
+		return err
+	}
 
 	// validate path
 	dir = filepath.Clean(dir)
 
+	if input.Preview {
+		return previewRunOutputs(dir, filter, ow)
+	}
+
+	zw, err := newOutputsCompressor(ow.BinaryWriter(), input.Compression, input.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	defer zw.Close()
+
+	tw := tar.NewWriter(zw)
+	defer tw.Close()
+
+	// when deduplicating, identical files are stored once as blobs, and
+	// referenced from the manifest of their directory.
+	var (
+		dups      map[string]string
+		blobs     = make(map[string]struct{})
+		manifests = make(map[string]map[string]string)
+	)
+	if input.Dedup {
+		if dups, err = findDuplicateOutputs(dir, dedupOutputsSize); err != nil {
+			return err
+		}
+	}
+
 	walker := func(file string, finfo os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -86,7 +201,27 @@ func gzipRunOutputs(ctx context.Context, basedir string, input *api.CollectionIn
 			}
 		}
 
-		hdr.Name = input.RunID + "/" + relFilePath
+		// the directories of filtered files are created on extraction.
+		if filter != nil && (finfo.Mode().IsDir() || !filter.match(filepath.ToSlash(relFilePath))) {
+			return nil
+		}
+
+		// archives always use forward slashes, whatever the platform.
+		hdr.Name = input.RunID + "/" + filepath.ToSlash(relFilePath)
+
+		if h, ok := dups[file]; ok {
+			dir := filepath.ToSlash(filepath.Dir(hdr.Name))
+			if manifests[dir] == nil {
+				manifests[dir] = make(map[string]string)
+			}
+			manifests[dir][finfo.Name()] = h
+
+			if _, ok := blobs[h]; ok {
+				return nil
+			}
+			blobs[h] = struct{}{}
+			hdr.Name = input.RunID + "/" + OutputsBlobsDir + "/" + h
+		}
 
 		if err := tw.WriteHeader(hdr); err != nil {
 			return err
@@ -112,6 +247,33 @@ func gzipRunOutputs(ctx context.Context, basedir string, input *api.CollectionIn
 	if err := filepath.Walk(dir, walker); err != nil {
 		return err
 	}
+	return writeOutputsManifests(tw, manifests)
+}
+
+// previewRunOutputs reports the files of a run that a collection would
+// archive, by group.
+func previewRunOutputs(dir string, filter *outputsFilter, ow *rpc.OutputWriter) error {
+	preview := newOutputsPreview()
+	err := filepath.Walk(dir, func(file string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !finfo.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); filter.match(rel) {
+			preview.add(rel, finfo.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	preview.report(ow)
 	return nil
 }
 
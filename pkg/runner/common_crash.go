@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Files written into the outputs of an instance that crashed or was killed.
+const (
+	// CrashTraceFile holds the trace of the panic or fatal error the instance
+	// died of.
+	CrashTraceFile = "crash.txt"
+	// GoroutineDumpFile holds the goroutine dump the instance printed when it
+	// was sent SIGQUIT, before being killed.
+	GoroutineDumpFile = "goroutines.txt"
+)
+
+// Reasons of crashes.
+const (
+	CrashReasonPanic  = "panic"
+	CrashReasonKilled = "killed"
+	CrashReasonExit   = "exit"
+)
+
+// InstanceCrash records an instance that crashed or was killed, and the dumps
+// captured into its outputs directory.
+type InstanceCrash struct {
+	Group    string `json:"group"`
+	Instance int    `json:"instance"`
+	Reason   string `json:"reason"`
+	// Status is the exit status of the instance, if it exited by itself.
+	Status int64 `json:"status,omitempty"`
+	// Dumps are the files of the outputs directory of the instance that
+	// contain dumps, e.g. crash.txt, goroutines.txt, or core dumps.
+	Dumps []string `json:"dumps,omitempty"`
+}
+
+// panicTrace returns the trace of the panic or fatal error at the end of the
+// stderr of a Go program, or nil if there is none.
+func panicTrace(stderr []byte) []byte {
+	start := -1
+	for _, marker := range []string{"panic: ", "fatal error: "} {
+		if bytes.HasPrefix(stderr, []byte(marker)) && start < 0 {
+			start = 0
+		}
+		if i := bytes.LastIndex(stderr, []byte("\n"+marker)); i >= 0 && i+1 > start {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	return stderr[start:]
+}
+
+// goroutineDump returns the goroutine dump a Go program prints when it
+// receives SIGQUIT, or nil if there is none.
+func goroutineDump(stderr []byte) []byte {
+	i := bytes.LastIndex(stderr, []byte("SIGQUIT: quit"))
+	if i < 0 {
+		return nil
+	}
+	return stderr[i:]
+}
+
+// writeDump writes a dump into the outputs directory of an instance, and
+// appends its name to the dumps of the crash. Empty dumps are skipped.
+func (c *InstanceCrash) writeDump(dir, name string, dump []byte) error {
+	if len(dump) == 0 {
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), dump, 0644); err != nil {
+		return err
+	}
+	c.Dumps = append(c.Dumps, name)
+	return nil
+}
+
+// findCoreDumps appends the core dumps found in the outputs directory of an
+// instance to the dumps of the crash.
+func (c *InstanceCrash) findCoreDumps(dir string) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && (fi.Name() == "core" || strings.HasPrefix(fi.Name(), "core.")) {
+			c.Dumps = append(c.Dumps, fi.Name())
+		}
+	}
+}
+
+// addCrash records a crash in the result of the run.
+func (r *Result) addCrash(c InstanceCrash) {
+	r.crashesLk.Lock()
+	defer r.crashesLk.Unlock()
+
+	r.Crashes = append(r.Crashes, c)
+}
+
+// coreDumpsEnabled reports whether instances can write core dumps into their
+// working directory, i.e. whether the core pattern of the kernel is relative.
+func coreDumpsEnabled() bool {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return false
+	}
+	p := strings.TrimSpace(string(b))
+	return p != "" && !strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "|")
+}
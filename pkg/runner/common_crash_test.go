@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanicTrace(t *testing.T) {
+	require.Nil(t, panicTrace(nil))
+	require.Nil(t, panicTrace([]byte("some log\nanother log\n")))
+
+	trace := "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"
+	require.Equal(t, trace, string(panicTrace([]byte(trace))))
+	require.Equal(t, trace, string(panicTrace([]byte("some log\n"+trace))))
+
+	// the last panic or fatal error wins.
+	fatal := "fatal error: concurrent map writes\n\ngoroutine 7 [running]:\n"
+	require.Equal(t, fatal, string(panicTrace([]byte(trace+fatal))))
+}
+
+func TestGoroutineDump(t *testing.T) {
+	require.Nil(t, goroutineDump([]byte("some log\n")))
+
+	dump := "SIGQUIT: quit\nPC=0x0 m=0 sigcode=0\n\ngoroutine 1 [select]:\n"
+	require.Equal(t, dump, string(goroutineDump([]byte("some log\n"+dump))))
+}
+
+func TestInstanceCrashDumps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"core", "core.42", "corer", "out.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	var c InstanceCrash
+	require.NoError(t, c.writeDump(dir, CrashTraceFile, []byte("panic: boom\n")))
+	require.NoError(t, c.writeDump(dir, GoroutineDumpFile, nil))
+	c.findCoreDumps(dir)
+
+	require.Equal(t, []string{CrashTraceFile, "core", "core.42"}, c.Dumps)
+	require.NoFileExists(t, filepath.Join(dir, GoroutineDumpFile))
+}
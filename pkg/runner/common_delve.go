@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// DefaultDelvePort is the port the debugger of an instance started under
+// delve listens on, unless configured otherwise.
+const DefaultDelvePort = 2345
+
+// delveTarget is the instance of a run that is started under a headless delve
+// debugger, which waits for a client to connect before starting the instance.
+// It is configured as <group>:<index> through the debug_instance option of
+// runners. A nil *delveTarget matches no instance.
+type delveTarget struct {
+	group string
+	index int
+	port  int
+}
+
+// parseDelveTarget parses the debug_instance and debug_port options of a
+// runner, and checks that the instance is part of the run.
+func parseDelveTarget(instance string, port int, groups []*api.RunGroup) (*delveTarget, error) {
+	if instance == "" {
+		return nil, nil
+	}
+
+	i := strings.LastIndex(instance, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid debug_instance %q; expected <group>:<index>", instance)
+	}
+	index, err := strconv.Atoi(instance[i+1:])
+	if err != nil || index < 0 {
+		return nil, fmt.Errorf("invalid debug_instance %q; expected <group>:<index>", instance)
+	}
+	if port == 0 {
+		port = DefaultDelvePort
+	}
+
+	t := &delveTarget{group: instance[:i], index: index, port: port}
+	for _, g := range groups {
+		if g.ID == t.group {
+			if t.index >= g.Instances {
+				return nil, fmt.Errorf("invalid debug_instance %q; group %s has %d instances", instance, g.ID, g.Instances)
+			}
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid debug_instance %q; no such group", instance)
+}
+
+func (t *delveTarget) matches(group string, index int) bool {
+	return t != nil && t.group == group && t.index == index
+}
+
+// command returns the command line running bin under the delve executable
+// dlv, listening on addr.
+func (t *delveTarget) command(dlv, bin, addr string) []string {
+	return []string{
+		dlv, "exec", bin,
+		"--headless",
+		"--listen=" + addr,
+		"--api-version=2",
+		"--accept-multiclient",
+		// plans may be built with a Go newer than the one delve supports.
+		"--check-go-version=false",
+	}
+}
@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestParseDelveTarget(t *testing.T) {
+	groups := []*api.RunGroup{{ID: "miners", Instances: 2}, {ID: "a:b", Instances: 1}}
+
+	target, err := parseDelveTarget("", 0, groups)
+	require.NoError(t, err)
+	require.Nil(t, target)
+	require.False(t, target.matches("miners", 0))
+
+	target, err = parseDelveTarget("miners:1", 0, groups)
+	require.NoError(t, err)
+	require.Equal(t, DefaultDelvePort, target.port)
+	require.True(t, target.matches("miners", 1))
+	require.False(t, target.matches("miners", 0))
+
+	// the index follows the last colon.
+	target, err = parseDelveTarget("a:b:0", 4000, groups)
+	require.NoError(t, err)
+	require.Equal(t, 4000, target.port)
+	require.True(t, target.matches("a:b", 0))
+
+	for _, invalid := range []string{"miners", "miners:", "miners:x", ":1", "miners:2", "clients:0"} {
+		_, err := parseDelveTarget(invalid, 0, groups)
+		require.Error(t, err, invalid)
+	}
+}
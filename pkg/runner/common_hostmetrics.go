@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+)
+
+// hostMetricsImage is the image of the collector of host metrics. Besides
+// node_exporter, it ships the busybox tools the sampling script relies on.
+const hostMetricsImage = "prom/node-exporter:v1.3.1"
+
+// defaultHostMetricsPort is the port the collectors of host metrics listen
+// on, on the loopback interface of the hosts, unless configured otherwise,
+// or picked by the runner.
+const defaultHostMetricsPort = 9101
+
+// hostMetricsDir is the directory of the outputs of a run the host metrics
+// are captured into, one <host>.prom file per host.
+const hostMetricsDir = "host-metrics"
+
+// defaultHostMetricsInterval is how often host metrics are sampled, unless
+// configured otherwise.
+const defaultHostMetricsInterval = 5 * time.Second
+
+// parseHostMetricsInterval parses the sampling interval of host metrics into
+// whole seconds, at least one.
+func parseHostMetricsInterval(interval string) (int, error) {
+	d := defaultHostMetricsInterval
+	if interval != "" {
+		var err error
+		if d, err = time.ParseDuration(interval); err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid host metrics interval %q", interval)
+		}
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	return int(d / time.Second), nil
+}
+
+// hostMetricsScript returns the script run by the collector of host metrics,
+// in the network and pid namespaces of the host. It runs node_exporter with
+// the CPU, memory, disk and network collectors only, and every interval
+// appends a sample of its metrics to <dir>/<host>.prom, in the Prometheus
+// text format, with explicit timestamps. The host is named by $NODE_NAME if
+// set.
+func hostMetricsScript(port int, interval int, dir string) string {
+	return fmt.Sprintf(`/bin/node_exporter --path.rootfs=/host --web.listen-address=127.0.0.1:%[1]d \
+  --collector.disable-defaults --collector.cpu --collector.loadavg --collector.meminfo \
+  --collector.diskstats --collector.filesystem --collector.netdev &
+mkdir -p %[3]s
+out=%[3]s/${NODE_NAME:-$(hostname)}.prom
+while sleep %[2]d; do
+  ts=$(date +%%s)000
+  wget -qO- http://127.0.0.1:%[1]d/metrics | grep '^node_' | sed "s/\$/ $ts/" >> "$out"
+done
+`, port, interval, dir)
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHostMetricsInterval(t *testing.T) {
+	for in, want := range map[string]int{"": 5, "10s": 10, "1m": 60, "200ms": 1} {
+		got, err := parseHostMetricsInterval(in)
+		if err != nil {
+			t.Fatalf("%q: %s", in, err)
+		}
+		if got != want {
+			t.Errorf("%q: expected %d, got %d", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"5", "-1s", "soon"} {
+		if _, err := parseHostMetricsInterval(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestHostMetricsScript(t *testing.T) {
+	script := hostMetricsScript(9101, 5, "/outputs/run/host-metrics")
+	for _, want := range []string{
+		"--web.listen-address=127.0.0.1:9101",
+		"while sleep 5; do",
+		"out=/outputs/run/host-metrics/${NODE_NAME:-$(hostname)}.prom",
+		"ts=$(date +%s)000",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script is missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestIsLocalDockerHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"unix:///var/run/docker.sock":    true,
+		"npipe:////./pipe/docker_engine": true,
+		"tcp://10.0.0.2:2376":            false,
+		"ssh://user@docker-host":         false,
+	} {
+		if got := isLocalDockerHost(host); got != want {
+			t.Errorf("%s: got %t, want %t", host, got, want)
+		}
+	}
+}
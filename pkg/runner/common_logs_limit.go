@@ -0,0 +1,281 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/docker/go-units"
+)
+
+// TruncatedLogsFile is the file of the outputs of a run that lists the logs
+// of its instances that were truncated for exceeding their limit.
+const TruncatedLogsFile = "truncated-logs.json"
+
+// TruncatedLog records that the log of an instance was truncated.
+type TruncatedLog struct {
+	Group    string `json:"group"`
+	Instance int    `json:"instance"`
+	// Stream is stdout or stderr.
+	Stream string `json:"stream"`
+	// Dropped is the number of bytes dropped between the head and the tail
+	// of the log.
+	Dropped int64 `json:"dropped_bytes"`
+}
+
+// parseLogsLimit parses the human-readable limit of the logs of instances,
+// e.g. "64MiB". It returns 0 if no limit is set.
+func parseLogsLimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	n, err := units.RAMInBytes(limit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid instance logs limit %q: %w", limit, err)
+	}
+	// the head and the two segments of the tail need a few bytes each.
+	if n < 1024 {
+		return 0, fmt.Errorf("invalid instance logs limit %q: must be at least 1KiB", limit)
+	}
+	return n, nil
+}
+
+// cappedLog writes a log to a file, keeping at most its first and last limit/2
+// bytes, so that it stays within limit (plus a truncation marker) whatever
+// its length, and memory use stays constant.
+//
+// The head is written to the file directly. The tail is written to two
+// segments of limit/4 bytes, next to the file, used in turn: once a segment
+// is full, the other is emptied and written to. On Close, the segments are
+// appended to the file after a marker, if anything was dropped in between.
+type cappedLog struct {
+	path    string
+	headMax int64
+	segMax  int64
+
+	f        *os.File
+	written  int64
+	segs     [2]*os.File
+	segSizes [2]int64
+	cur      int
+	dropped  int64
+}
+
+func newCappedLog(path string, limit int64) (*cappedLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &cappedLog{path: path, headMax: limit / 2, segMax: limit / 4, f: f}, nil
+}
+
+func (l *cappedLog) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if l.written < l.headMax {
+		k := int64(len(p))
+		if k > l.headMax-l.written {
+			k = l.headMax - l.written
+		}
+		if _, err := l.f.Write(p[:k]); err != nil {
+			return 0, err
+		}
+		l.written += k
+		p = p[k:]
+	}
+
+	for len(p) > 0 {
+		if l.segs[l.cur] == nil {
+			seg, err := os.Create(fmt.Sprintf("%s.tail.%d", l.path, l.cur))
+			if err != nil {
+				return 0, err
+			}
+			l.segs[l.cur] = seg
+		}
+		if l.segSizes[l.cur] == l.segMax {
+			// the older segment is dropped.
+			l.cur = 1 - l.cur
+			if seg := l.segs[l.cur]; seg != nil {
+				if err := seg.Truncate(0); err != nil {
+					return 0, err
+				}
+				if _, err := seg.Seek(0, io.SeekStart); err != nil {
+					return 0, err
+				}
+			}
+			l.dropped += l.segSizes[l.cur]
+			l.segSizes[l.cur] = 0
+			continue
+		}
+
+		k := int64(len(p))
+		if k > l.segMax-l.segSizes[l.cur] {
+			k = l.segMax - l.segSizes[l.cur]
+		}
+		if _, err := l.segs[l.cur].Write(p[:k]); err != nil {
+			return 0, err
+		}
+		l.segSizes[l.cur] += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Close assembles the log, and returns the number of bytes dropped from it.
+func (l *cappedLog) Close() (int64, error) {
+	defer func() {
+		for i, seg := range l.segs {
+			if seg != nil {
+				_ = seg.Close()
+				_ = os.Remove(fmt.Sprintf("%s.tail.%d", l.path, i))
+			}
+		}
+	}()
+
+	if l.dropped > 0 {
+		if _, err := fmt.Fprintf(l.f, "\n[... %d bytes truncated ...]\n", l.dropped); err != nil {
+			_ = l.f.Close()
+			return 0, err
+		}
+	}
+
+	// the older segment goes first.
+	for _, i := range []int{1 - l.cur, l.cur} {
+		seg := l.segs[i]
+		if seg == nil {
+			continue
+		}
+		if _, err := seg.Seek(0, io.SeekStart); err != nil {
+			_ = l.f.Close()
+			return 0, err
+		}
+		if _, err := io.Copy(l.f, seg); err != nil {
+			_ = l.f.Close()
+			return 0, err
+		}
+	}
+	return l.dropped, l.f.Close()
+}
+
+// truncatedLogs collects the truncations of the logs of the instances of a
+// run.
+type truncatedLogs struct {
+	lk   sync.Mutex
+	logs []TruncatedLog
+}
+
+func (t *truncatedLogs) add(tl TruncatedLog) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.logs = append(t.logs, tl)
+}
+
+// write writes the truncations into the outputs directory of the run, if
+// there were any.
+func (t *truncatedLogs) write(runDir string) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if len(t.logs) == 0 {
+		return nil
+	}
+	sort.Slice(t.logs, func(i, j int) bool {
+		a, b := t.logs[i], t.logs[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Stream < b.Stream
+	})
+	b, err := json.MarshalIndent(t.logs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(runDir, TruncatedLogsFile), b, 0644)
+}
+
+// instanceLogs captures the stdout and stderr of a process instance into
+// stdout.log and stderr.log in its outputs directory, each capped to limit.
+// Writes after close are discarded, since the streams may still be read when
+// a run is torn down.
+type instanceLogs struct {
+	lk       sync.Mutex
+	group    string
+	instance int
+	logs     map[string]*cappedLog
+	closed   bool
+}
+
+func newInstanceLogs(dir, group string, instance int, limit int64) (*instanceLogs, error) {
+	l := &instanceLogs{group: group, instance: instance, logs: make(map[string]*cappedLog, 2)}
+	for _, stream := range []string{"stdout", "stderr"} {
+		cl, err := newCappedLog(filepath.Join(dir, stream+".log"), limit)
+		if err != nil {
+			_ = l.close(nil)
+			return nil, err
+		}
+		l.logs[stream] = cl
+	}
+	return l, nil
+}
+
+// tee returns a stream that copies what is read from rc into the log of the
+// given stream.
+func (l *instanceLogs) tee(stream string, rc io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(rc, instanceLogWriter{l, stream}), rc}
+}
+
+// close assembles the logs, and records their truncations, if truncated is
+// not nil.
+func (l *instanceLogs) close(truncated *truncatedLogs) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	var firstErr error
+	for stream, cl := range l.logs {
+		dropped, err := cl.Close()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to write %s.log: %w", stream, err)
+			}
+			continue
+		}
+		if dropped > 0 && truncated != nil {
+			truncated.add(TruncatedLog{Group: l.group, Instance: l.instance, Stream: stream, Dropped: dropped})
+		}
+	}
+	return firstErr
+}
+
+type instanceLogWriter struct {
+	l      *instanceLogs
+	stream string
+}
+
+func (w instanceLogWriter) Write(p []byte) (int, error) {
+	w.l.lk.Lock()
+	defer w.l.lk.Unlock()
+
+	// failing to capture the log mustn't stop the stream from being read,
+	// lest the instance blocks writing to it.
+	if !w.l.closed {
+		_, _ = w.l.logs[w.stream].Write(p)
+	}
+	return len(p), nil
+}
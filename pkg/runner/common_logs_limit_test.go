@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCappedLog(t *testing.T) {
+	dir := t.TempDir()
+
+	// under the limit, the log is kept whole.
+	path := filepath.Join(dir, "short.log")
+	l, err := newCappedLog(path, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := l.Close()
+	if err != nil || dropped != 0 {
+		t.Fatalf("unexpected close: %d, %v", dropped, err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "hello\n" {
+		t.Errorf("unexpected log: %q", b)
+	}
+
+	// over the limit, its head and tail are.
+	var lines bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&lines, "line %04d\n", i)
+	}
+	path = filepath.Join(dir, "long.log")
+	if l, err = newCappedLog(path, 4096); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range bytes.SplitAfter(lines.Bytes(), []byte("\n")) {
+		if _, err := l.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped, err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped == 0 {
+		t.Fatal("expected bytes to be dropped")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(b)
+	if !strings.HasPrefix(log, "line 0000\n") || !strings.HasSuffix(log, "line 1999\n") {
+		t.Errorf("head or tail missing from log")
+	}
+	if !strings.Contains(log, fmt.Sprintf("[... %d bytes truncated ...]", dropped)) {
+		t.Errorf("truncation marker missing from log")
+	}
+	if len(b) > 4096+64 {
+		t.Errorf("log of %d bytes exceeds its limit", len(b))
+	}
+	if int64(len(b)) < int64(lines.Len())-dropped {
+		t.Errorf("log of %d bytes is missing bytes that weren't dropped", len(b))
+	}
+
+	// the segments of the tail are removed.
+	matches, _ := filepath.Glob(path + ".tail.*")
+	if len(matches) != 0 {
+		t.Errorf("segments left behind: %v", matches)
+	}
+}
+
+func TestTruncatedLogs(t *testing.T) {
+	dir := t.TempDir()
+
+	var tl truncatedLogs
+	if err := tl.write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, TruncatedLogsFile)); !os.IsNotExist(err) {
+		t.Fatal("expected no file without truncations")
+	}
+
+	tl.add(TruncatedLog{Group: "b", Instance: 0, Stream: "stdout", Dropped: 10})
+	tl.add(TruncatedLog{Group: "a", Instance: 1, Stream: "stderr", Dropped: 20})
+	if err := tl.write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, TruncatedLogsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []TruncatedLog
+	if err := json.Unmarshal(b, &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].Group != "a" || logs[1].Dropped != 10 {
+		t.Errorf("unexpected truncated logs: %+v", logs)
+	}
+}
+
+func TestInstanceLogs(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := newInstanceLogs(dir, "g", 3, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := l.tee("stdout", ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 4096))))
+	stderr := l.tee("stderr", ioutil.NopCloser(strings.NewReader("oops\n")))
+	for _, rc := range []io.ReadCloser{stdout, stderr} {
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tl truncatedLogs
+	if err := l.close(&tl); err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.logs) != 1 || tl.logs[0].Stream != "stdout" || tl.logs[0].Instance != 3 {
+		t.Errorf("unexpected truncated logs: %+v", tl.logs)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "stderr.log")); string(b) != "oops\n" {
+		t.Errorf("unexpected stderr.log: %q", b)
+	}
+
+	// writes after close are discarded.
+	if _, err := (instanceLogWriter{l, "stdout"}).Write([]byte("late")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoundedLogConfig(t *testing.T) {
+	for _, driver := range []string{"json-file", "local"} {
+		lc := boundedLogConfig(driver, 64<<20)
+		if lc == nil || lc.Type != "" || lc.Config["max-size"] != "33554432" || lc.Config["max-file"] != "2" {
+			t.Errorf("unexpected log config for driver %s: %+v", driver, lc)
+		}
+	}
+	if lc := boundedLogConfig("journald", 64<<20); lc != nil {
+		t.Errorf("expected no log config for journald, got %+v", lc)
+	}
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// MetricsExposedPortLabel is the exposed port label under which test instances
+// are told which port to serve their Prometheus metrics on. Instances read it
+// from the METRICS_PORT environment variable.
+const MetricsExposedPortLabel = "metrics"
+
+// prometheusConfig is the configuration of the Prometheus instance that the
+// local runners provision. It discovers scrape targets from the JSON files that
+// runners drop into the file_sd directory, one file per run.
+const prometheusConfig = `global:
+  scrape_interval: 5s
+  evaluation_interval: 5s
+
+scrape_configs:
+  - job_name: testground
+    file_sd_configs:
+      - files:
+          - /etc/prometheus/file_sd/*.json
+        refresh_interval: 5s
+`
+
+// metricsTargetGroup is a group of scrape targets sharing the same labels, in
+// the format expected by Prometheus' file-based service discovery.
+//
+// See https://prometheus.io/docs/guides/file-sd/.
+type metricsTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// newMetricsTargetGroup returns the target group for a single test instance.
+func newMetricsTargetGroup(addr, plan, testcase, runID, groupID string, instance int) metricsTargetGroup {
+	return metricsTargetGroup{
+		Targets: []string{addr},
+		Labels: map[string]string{
+			"plan":     plan,
+			"case":     testcase,
+			"run_id":   runID,
+			"group_id": groupID,
+			"instance": strconv.Itoa(instance),
+		},
+	}
+}
+
+// writeMetricsTargets writes the scrape targets of a run to
+// <dir>/<run_id>.json. The file is written to a temporary path and renamed into
+// place, so that Prometheus never observes a partially written file.
+func writeMetricsTargets(dir string, runID string, groups []metricsTargetGroup) (string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("failed to create metrics discovery dir %s: %w", dir, err)
+	}
+
+	b, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, runID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return "", fmt.Errorf("failed to write metrics targets: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write metrics targets: %w", err)
+	}
+	return path, nil
+}
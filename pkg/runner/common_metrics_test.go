@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetricsTargets(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "file_sd")
+
+	groups := []metricsTargetGroup{
+		newMetricsTargetGroup("tg-plan-case-run-single-0:9100", "plan", "case", "run", "single", 0),
+		newMetricsTargetGroup("tg-plan-case-run-single-1:9100", "plan", "case", "run", "single", 1),
+	}
+
+	path, err := writeMetricsTargets(dir, "run", groups)
+	if err != nil {
+		t.Fatalf("failed to write targets: %s", err)
+	}
+	if path != filepath.Join(dir, "run.json") {
+		t.Errorf("got path %s, want %s", path, filepath.Join(dir, "run.json"))
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []metricsTargetGroup
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("targets file is not valid json: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d target groups, want 2", len(got))
+	}
+	if got[1].Targets[0] != "tg-plan-case-run-single-1:9100" || got[1].Labels["instance"] != "1" {
+		t.Errorf("unexpected target group: %v", got[1])
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file was left behind")
+	}
+}
+
+func TestRunPrometheusConfig(t *testing.T) {
+	cfg := runPrometheusConfig("run", "")
+	if !strings.Contains(cfg, `run_id: "run"`) || !strings.Contains(cfg, "/etc/prometheus/file_sd/*.json") {
+		t.Errorf("unexpected config:\n%s", cfg)
+	}
+	if strings.Contains(cfg, "pushgateway") {
+		t.Errorf("pushgateway scraped without being configured:\n%s", cfg)
+	}
+
+	cfg = runPrometheusConfig("run", "pushgateway:9091")
+	if !strings.Contains(cfg, `targets: ["pushgateway:9091"]`) || !strings.Contains(cfg, "honor_labels: true") {
+		t.Errorf("pushgateway not scraped:\n%s", cfg)
+	}
+}
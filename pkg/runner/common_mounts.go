@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// checkMounts validates the mounts of all groups, and checks that every bind
+// mount is under one of the host paths allowed by the runner configuration.
+func checkMounts(groups []*api.RunGroup, allowed []string) error {
+	for _, g := range groups {
+		for _, m := range g.Mounts {
+			if err := m.Validate(); err != nil {
+				return fmt.Errorf("group %s has an invalid mount: %w", g.ID, err)
+			}
+			if m.Type == api.MountTypeBind && !bindAllowed(m.Source, allowed) {
+				return fmt.Errorf("group %s is not allowed to bind mount %s; allowed host paths: %v", g.ID, m.Source, allowed)
+			}
+		}
+	}
+	return nil
+}
+
+// bindAllowed returns whether path is one of the allowed paths, or lies under
+// one of them.
+func bindAllowed(path string, allowed []string) bool {
+	path = filepath.Clean(path)
+	for _, a := range allowed {
+		a = filepath.Clean(a)
+		if path == a || strings.HasPrefix(path, strings.TrimSuffix(a, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountVolumeName returns the name of the volume backing a volume mount of an
+// instance. Volumes are private to each instance of a run, so that they
+// survive restarts of the instance without being shared with its peers.
+func mountVolumeName(runID string, groupID string, idx int, source string) string {
+	return fmt.Sprintf("tg-%s-%s-%d-%s", runID, groupID, idx, source)
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestCheckMounts(t *testing.T) {
+	groups := func(mounts ...api.Mount) []*api.RunGroup {
+		return []*api.RunGroup{{ID: "a", Mounts: mounts}}
+	}
+	allowed := []string{"/data/testground/"}
+
+	require.NoError(t, checkMounts(groups(
+		api.Mount{Type: api.MountTypeVolume, Source: "state", Target: "/state"},
+		api.Mount{Type: api.MountTypeTmpfs, Target: "/scratch", Size: "64MiB"},
+		api.Mount{Type: api.MountTypeBind, Source: "/data/testground", Target: "/data"},
+		api.Mount{Type: api.MountTypeBind, Source: "/data/testground/fixtures", Target: "/fixtures", ReadOnly: true},
+	), allowed))
+
+	for _, m := range []api.Mount{
+		{Type: api.MountTypeBind, Source: "/data/testground-other", Target: "/data"},
+		{Type: api.MountTypeBind, Source: "/data/testground/../../etc", Target: "/etc"},
+		{Type: api.MountTypeBind, Source: "/", Target: "/host"},
+		{Type: api.MountTypeTmpfs, Target: "/scratch", Size: "lots"},
+		{Type: "nfs", Source: "server:/", Target: "/nfs"},
+	} {
+		require.Error(t, checkMounts(groups(m), allowed), m)
+	}
+
+	require.Error(t, checkMounts(groups(api.Mount{Type: api.MountTypeBind, Source: "/data/testground", Target: "/data"}), nil))
+}
+
+func TestDockerMounts(t *testing.T) {
+	mounts := dockerMounts("run", "a", 2, []api.Mount{
+		{Type: api.MountTypeVolume, Source: "state", Target: "/state"},
+		{Type: api.MountTypeTmpfs, Target: "/scratch", Size: "1MiB"},
+	})
+	require.Len(t, mounts, 2)
+
+	require.Equal(t, mount.TypeVolume, mounts[0].Type)
+	require.Equal(t, "tg-run-a-2-state", mounts[0].Source)
+	require.Equal(t, "run", mounts[0].VolumeOptions.Labels["testground.run_id"])
+
+	require.Equal(t, mount.TypeTmpfs, mounts[1].Type)
+	require.Equal(t, int64(1<<20), mounts[1].TmpfsOptions.SizeBytes)
+}
@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of outputs archives.
+const (
+	OutputsCompressionGzip = "gzip"
+	OutputsCompressionZstd = "zstd"
+)
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// OutputsArchiveExt returns the extension of outputs archives compressed with
+// a format.
+func OutputsArchiveExt(compression string) string {
+	if compression == OutputsCompressionZstd {
+		return ".tar.zst"
+	}
+	return ".tgz"
+}
+
+// CheckOutputsCompression returns an error if outputs archives can't be
+// compressed with a format at a level. Levels range from 1, the fastest, to
+// 9, the smallest; 0 selects the default of the format.
+func CheckOutputsCompression(compression string, level int) error {
+	if level < 0 || level > 9 {
+		return fmt.Errorf("invalid compression level %d; expected 1-9", level)
+	}
+	switch compression {
+	case "", OutputsCompressionGzip, OutputsCompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q; expected %s or %s", compression, OutputsCompressionGzip, OutputsCompressionZstd)
+}
+
+// newOutputsCompressor returns a writer compressing outputs archives into w,
+// see CheckOutputsCompression. zstd compresses on every CPU.
+func newOutputsCompressor(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	if err := CheckOutputsCompression(compression, level); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case "", OutputsCompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+
+	case OutputsCompressionZstd:
+		speed := zstd.SpeedDefault
+		switch {
+		case level == 0:
+		case level <= 2:
+			speed = zstd.SpeedFastest
+		case level >= 7:
+			speed = zstd.SpeedBetterCompression
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(speed), zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0)))
+
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+// newOutputsDecompressor returns a reader decompressing an outputs archive,
+// whatever the format it was compressed with.
+func newOutputsDecompressor(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{zr}, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// zstdReadCloser releases the resources of a zstd decoder when closed.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
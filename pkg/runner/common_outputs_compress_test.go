@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOutputsCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("pcap pcap pcap "), 4096)
+
+	for _, c := range []struct {
+		compression string
+		level       int
+	}{
+		{"", 0},
+		{OutputsCompressionGzip, 1},
+		{OutputsCompressionZstd, 0},
+		{OutputsCompressionZstd, 9},
+	} {
+		var buf bytes.Buffer
+		zw, err := newOutputsCompressor(&buf, c.compression, c.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := newOutputsDecompressor(&buf)
+		if err != nil {
+			t.Fatalf("%s: %s", c.compression, err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		_ = zr.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", c.compression, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: content differs after decompression", c.compression)
+		}
+	}
+
+	if _, err := newOutputsCompressor(ioutil.Discard, "lz4", 0); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+	if _, err := newOutputsCompressor(ioutil.Discard, OutputsCompressionGzip, 10); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
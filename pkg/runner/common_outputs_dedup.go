@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Deduplicated output archives store the contents of identical files once,
+// under <run_id>/.blobs/<sha256>. The files themselves are left out of the
+// archive, and listed in a manifest in their directory, which maps their names
+// to their blobs. RehydrateOutputs restores them once the archive is
+// extracted.
+const (
+	OutputsBlobsDir  = ".blobs"
+	OutputsManifest  = ".blobs.json"
+	dedupOutputsSize = 64 << 10
+)
+
+// findDuplicateOutputs hashes the files in dir of at least minSize bytes, and
+// returns the hashes of those whose content appears more than once, indexed by
+// path.
+func findDuplicateOutputs(dir string, minSize int64) (map[string]string, error) {
+	var (
+		hashes = make(map[string]string)
+		counts = make(map[string]int)
+	)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || fi.Size() < minSize {
+			return nil
+		}
+
+		h, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		hashes[path] = h
+		counts[h]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path, h := range hashes {
+		if counts[h] < 2 {
+			delete(hashes, path)
+		}
+	}
+	return hashes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeOutputsManifests adds the manifests of deduplicated files to an
+// archive, given the blobs of the files of each directory.
+func writeOutputsManifests(tw *tar.Writer, manifests map[string]map[string]string) error {
+	for dir, blobs := range manifests {
+		b, err := json.MarshalIndent(blobs, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     dir + "/" + OutputsManifest,
+			Mode:     0644,
+			Size:     int64(len(b)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractOutputs extracts an outputs archive into dst, and rehydrates the
+// files deduplicated in it.
+func ExtractOutputs(archive string, dst string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := newOutputsDecompressor(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	dst = filepath.Clean(dst)
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, hdr.Name)
+		if target != dst && !strings.HasPrefix(target, dst+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal path in archive: %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			// outputs only consist of directories and regular files.
+		}
+	}
+
+	return RehydrateOutputs(dst)
+}
+
+// RehydrateOutputs restores the files deduplicated in the extracted outputs
+// archive at dir, and removes the blobs and manifests.
+func RehydrateOutputs(dir string) error {
+	var manifests, blobDirs []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir() && fi.Name() == OutputsBlobsDir:
+			blobDirs = append(blobDirs, path)
+			return filepath.SkipDir
+		case !fi.IsDir() && fi.Name() == OutputsManifest:
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		b, err := ioutil.ReadFile(manifest)
+		if err != nil {
+			return err
+		}
+		var blobs map[string]string
+		if err := json.Unmarshal(b, &blobs); err != nil {
+			return fmt.Errorf("invalid manifest %s: %w", manifest, err)
+		}
+
+		// blobs live at the root of the run, which is the closest blob
+		// directory above the manifest.
+		blobDir := closestBlobDir(blobDirs, filepath.Dir(manifest))
+		if blobDir == "" {
+			return fmt.Errorf("no blobs found for manifest %s", manifest)
+		}
+
+		for name, h := range blobs {
+			if name != filepath.Base(name) || h != filepath.Base(h) {
+				return fmt.Errorf("invalid entry %s in manifest %s", name, manifest)
+			}
+			if err := copyFile(filepath.Join(blobDir, h), filepath.Join(filepath.Dir(manifest), name)); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(manifest); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range blobDirs {
+		if err := os.RemoveAll(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func closestBlobDir(blobDirs []string, dir string) (res string) {
+	for _, d := range blobDirs {
+		root := filepath.Dir(d)
+		if (dir == root || strings.HasPrefix(dir, root+string(os.PathSeparator))) && len(d) > len(res) {
+			res = d
+		}
+	}
+	return res
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
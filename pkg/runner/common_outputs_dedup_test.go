@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func TestDedupOutputsRoundTrip(t *testing.T) {
+	var (
+		base    = t.TempDir()
+		runDir  = filepath.Join(base, "plan", "run")
+		dataset = make([]byte, 2*dedupOutputsSize)
+		files   = map[string][]byte{
+			"single/0/dataset": dataset,
+			"single/1/dataset": dataset,
+			"single/1/copy":    dataset,
+			"single/0/log":     []byte("instance 0"),
+			"single/1/log":     []byte("instance 1"),
+		}
+	)
+	if _, err := rand.Read(dataset); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range files {
+		path := filepath.Join(runDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "run.tgz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr, ww := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.ParseCollectResponse(rr, f, ioutil.Discard)
+		done <- err
+	}()
+
+	ow := rpc.NewFileOutputWriter(ww)
+	err = archiveRunOutputs(context.Background(), base, &api.CollectionInput{RunID: "run", Dedup: true}, ow)
+	ow.WriteResult(true)
+	_ = ww.Close()
+	if err != nil {
+		t.Fatalf("failed to archive outputs: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("failed to read archive: %s", err)
+	}
+	_ = f.Close()
+
+	fi, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > int64(len(dataset))*3/2 {
+		t.Errorf("archive of %d bytes holds more than one copy of the dataset", fi.Size())
+	}
+
+	dst := t.TempDir()
+	if err := ExtractOutputs(archive, dst); err != nil {
+		t.Fatalf("failed to extract outputs: %s", err)
+	}
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, "run", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("content of %s differs after extraction", name)
+		}
+	}
+	for _, p := range []string{filepath.Join("run", OutputsBlobsDir), filepath.Join("run", "single", "0", OutputsManifest)} {
+		if _, err := os.Stat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after extraction", p)
+		}
+	}
+}
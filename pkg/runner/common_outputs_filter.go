@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// outputsFilter selects output files by their path relative to the outputs
+// directory of their run, laid out as <group>/<instance>/<file> for the files
+// of instances. See api.OutputsFilter.
+type outputsFilter struct {
+	groups    map[string]struct{}
+	instances []instanceRange
+	globs     []string
+}
+
+type instanceRange struct {
+	from, to int
+}
+
+// newOutputsFilter parses a filter of outputs; nil selects every file.
+func newOutputsFilter(f *api.OutputsFilter) (*outputsFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	of := &outputsFilter{}
+	if len(f.Groups) > 0 {
+		of.groups = make(map[string]struct{}, len(f.Groups))
+		for _, g := range f.Groups {
+			of.groups[g] = struct{}{}
+		}
+	}
+
+	var err error
+	if of.instances, err = parseInstanceRanges(f.Instances); err != nil {
+		return nil, err
+	}
+
+	for _, g := range f.Globs {
+		g = strings.Trim(g, "/")
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", g, err)
+		}
+		of.globs = append(of.globs, g)
+	}
+	return of, nil
+}
+
+// parseInstanceRanges parses comma-separated sequence numbers and ranges of
+// them, e.g. "0-4,7".
+func parseInstanceRanges(s string) ([]instanceRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var ranges []instanceRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		a, err := strconv.Atoi(from)
+		if err != nil || a < 0 {
+			return nil, fmt.Errorf("invalid instance range %q", part)
+		}
+		b, err := strconv.Atoi(to)
+		if err != nil || b < a {
+			return nil, fmt.Errorf("invalid instance range %q", part)
+		}
+		ranges = append(ranges, instanceRange{a, b})
+	}
+	return ranges, nil
+}
+
+// match returns whether the file at rel, a slash-separated path relative to
+// the outputs directory of the run, is selected.
+func (f *outputsFilter) match(rel string) bool {
+	if f == nil {
+		return true
+	}
+
+	parts := strings.Split(rel, "/")
+
+	// files of instances are under <group>/<instance>/.
+	instance := -1
+	if len(parts) > 2 {
+		if n, err := strconv.Atoi(parts[1]); err == nil && n >= 0 {
+			instance = n
+		}
+	}
+
+	if instance < 0 {
+		// files of the run itself.
+		if f.groups != nil || f.instances != nil {
+			return false
+		}
+		return f.matchGlobs(parts)
+	}
+
+	if f.groups != nil {
+		if _, ok := f.groups[parts[0]]; !ok {
+			return false
+		}
+	}
+	if f.instances != nil && !f.matchInstance(instance) {
+		return false
+	}
+	return f.matchGlobs(parts[2:])
+}
+
+func (f *outputsFilter) matchInstance(n int) bool {
+	for _, r := range f.instances {
+		if n >= r.from && n <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlobs returns whether a path, or any of the directories it is under,
+// matches any of the globs.
+func (f *outputsFilter) matchGlobs(parts []string) bool {
+	if len(f.globs) == 0 {
+		return true
+	}
+	for i := 1; i <= len(parts); i++ {
+		p := strings.Join(parts[:i], "/")
+		for _, g := range f.globs {
+			if ok, _ := path.Match(g, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// outputsPreview sums up the files that a collection would archive, per
+// group, and for the run itself under the empty group.
+type outputsPreview struct {
+	files map[string]int
+	bytes map[string]int64
+}
+
+func newOutputsPreview() *outputsPreview {
+	return &outputsPreview{files: make(map[string]int), bytes: make(map[string]int64)}
+}
+
+func (p *outputsPreview) add(rel string, size int64) {
+	group := ""
+	if parts := strings.SplitN(rel, "/", 3); len(parts) == 3 {
+		if _, err := strconv.Atoi(parts[1]); err == nil {
+			group = parts[0]
+		}
+	}
+	p.files[group]++
+	p.bytes[group] += size
+}
+
+// report writes the preview, one line per group, and the total.
+func (p *outputsPreview) report(ow *rpc.OutputWriter) {
+	groups := make([]string, 0, len(p.files))
+	for g := range p.files {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	var (
+		files int
+		bytes int64
+	)
+	for _, g := range groups {
+		name := g
+		if name == "" {
+			name = "(run)"
+		}
+		ow.Infof("%s: %d files, %s", name, p.files[g], humanize.IBytes(uint64(p.bytes[g])))
+		files += p.files[g]
+		bytes += p.bytes[g]
+	}
+	ow.Infof("total: %d files, %s", files, humanize.IBytes(uint64(bytes)))
+}
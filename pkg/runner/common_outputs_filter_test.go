@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestOutputsFilter(t *testing.T) {
+	f, err := newOutputsFilter(&api.OutputsFilter{
+		Groups:    []string{"peers"},
+		Instances: "0-1,5",
+		Globs:     []string{"metrics/*", "run.out"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rel, want := range map[string]bool{
+		"peers/0/run.out":          true,
+		"peers/1/metrics/cpu.prom": true,
+		"peers/5/metrics/a/b.prom": true,
+		"peers/2/run.out":          false,
+		"peers/0/run.err":          false,
+		"seeds/0/run.out":          false,
+		"timeline.json":            false,
+	} {
+		if got := f.match(rel); got != want {
+			t.Errorf("%s: expected %t, got %t", rel, want, got)
+		}
+	}
+
+	// files of the run are selected by globs only.
+	f, err = newOutputsFilter(&api.OutputsFilter{Globs: []string{"host-metrics"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.match("host-metrics/host.prom") || f.match("timeline.json") {
+		t.Error("unexpected match of the files of the run")
+	}
+
+	var none *outputsFilter
+	if !none.match("anything") {
+		t.Error("a nil filter should match everything")
+	}
+
+	for _, in := range []string{"a", "3-1", "-1", "1,,2"} {
+		if _, err := newOutputsFilter(&api.OutputsFilter{Instances: in}); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+	if _, err := newOutputsFilter(&api.OutputsFilter{Globs: []string{"[a"}}); err == nil {
+		t.Error("expected an error for an invalid glob")
+	}
+}
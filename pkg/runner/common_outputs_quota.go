@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/go-units"
+)
+
+// Policies applied when an instance exceeds its outputs quota.
+const (
+	// OutputsQuotaPolicyFail stops the offending instance.
+	OutputsQuotaPolicyFail = "fail"
+	// OutputsQuotaPolicyRotate truncates the oldest files of the offending
+	// instance until it fits in its quota again.
+	OutputsQuotaPolicyRotate = "rotate"
+)
+
+// outputsQuota is the parsed form of the outputs quota settings of a runner.
+type outputsQuota struct {
+	limit  int64
+	policy string
+}
+
+// parseOutputsQuota parses a human-readable size (e.g. "512MiB") and a policy
+// into an outputsQuota. It returns nil if no quota is set.
+func parseOutputsQuota(quota string, policy string) (*outputsQuota, error) {
+	if quota == "" {
+		return nil, nil
+	}
+
+	limit, err := units.RAMInBytes(quota)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outputs quota %q: %w", quota, err)
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid outputs quota %q: must be positive", quota)
+	}
+
+	switch policy {
+	case "":
+		policy = OutputsQuotaPolicyFail
+	case OutputsQuotaPolicyFail, OutputsQuotaPolicyRotate:
+	default:
+		return nil, fmt.Errorf("invalid outputs quota policy %q; expected %q or %q", policy, OutputsQuotaPolicyFail, OutputsQuotaPolicyRotate)
+	}
+
+	return &outputsQuota{limit: limit, policy: policy}, nil
+}
+
+type outputsFile struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// listOutputsFiles returns all regular files under dir, along with their
+// total size.
+func listOutputsFiles(dir string) ([]outputsFile, int64, error) {
+	var (
+		files []outputsFile
+		total int64
+	)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// files may vanish while the instance is running.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, outputsFile{path: path, size: fi.Size(), modTime: fi.ModTime().UnixNano()})
+		total += fi.Size()
+		return nil
+	})
+
+	return files, total, err
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	_, total, err := listOutputsFiles(dir)
+	return total, err
+}
+
+// rotateOldest truncates the oldest files under dir until their total size is
+// at most limit. It returns the number of bytes freed.
+//
+// Files are truncated rather than deleted, because the instance may still hold
+// them open: unlinking an open file frees no space until it's closed, and
+// would hide it from the next measurement. The SDK appends to run.out,
+// results.out and diagnostics.out, so it keeps writing them from the start.
+func rotateOldest(dir string, limit int64) (int64, error) {
+	files, total, err := listOutputsFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime < files[j].modTime
+	})
+
+	var freed int64
+	for _, f := range files {
+		if total-freed <= limit {
+			break
+		}
+		if f.size == 0 {
+			continue
+		}
+		if err := os.Truncate(f.path, 0); err != nil && !os.IsNotExist(err) {
+			return freed, err
+		}
+		freed += f.size
+	}
+	return freed, nil
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOutputsQuota(t *testing.T) {
+	q, err := parseOutputsQuota("", "")
+	if err != nil || q != nil {
+		t.Fatalf("expected no quota, got %v (err: %v)", q, err)
+	}
+
+	q, err = parseOutputsQuota("1MiB", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.limit != 1<<20 || q.policy != OutputsQuotaPolicyFail {
+		t.Errorf("got limit %d policy %s, want %d and %s", q.limit, q.policy, 1<<20, OutputsQuotaPolicyFail)
+	}
+
+	for _, tt := range []struct{ quota, policy string }{
+		{"lots", ""},
+		{"1MiB", "truncate"},
+	} {
+		if _, err := parseOutputsQuota(tt.quota, tt.policy); err == nil {
+			t.Errorf("expected error for quota %q policy %q", tt.quota, tt.policy)
+		}
+	}
+}
+
+func TestRotateOldest(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	for i, name := range []string{"a.out", "b.out", "c.out"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freed, err := rotateOldest(dir, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 200 {
+		t.Errorf("got %d bytes freed, want 200", freed)
+	}
+
+	size, err := dirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 100 {
+		t.Errorf("got size %d, want 100", size)
+	}
+
+	if fi, err := os.Stat(filepath.Join(dir, "c.out")); err != nil || fi.Size() != 100 {
+		t.Errorf("expected newest file to be retained: %v", err)
+	}
+
+	// the oldest files are truncated in place, so that instances writing them
+	// free their space.
+	if fi, err := os.Stat(filepath.Join(dir, "a.out")); err != nil || fi.Size() != 0 {
+		t.Errorf("expected oldest file to be truncated: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// PlacementFile is the file of the outputs of a run recording where each of
+// its instances was scheduled, as a JSON array of api.InstancePlacement.
+const PlacementFile = "placement.json"
+
+// writePlacement writes the placement of the instances of a run into the
+// outputs of the run.
+func writePlacement(runDir string, placement []api.InstancePlacement) error {
+	if err := os.MkdirAll(runDir, 0777); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(placement, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(runDir, PlacementFile), b, 0644); err != nil {
+		return fmt.Errorf("failed to write placement: %w", err)
+	}
+	return nil
+}
+
+// placementByHost groups the instances of a run by the host they were
+// scheduled on, as <group>[<instance>].
+func placementByHost(placement []api.InstancePlacement) map[string][]string {
+	ret := make(map[string][]string)
+	for _, p := range placement {
+		ret[p.Host] = append(ret[p.Host], fmt.Sprintf("%s[%d]", p.Group, p.Instance))
+	}
+	for _, instances := range ret {
+		sort.Strings(instances)
+	}
+	return ret
+}
+
+// logPlacement logs how the instances of a run are spread across hosts, so
+// that co-located instances don't go unnoticed.
+func logPlacement(log *rpc.OutputWriter, placement []api.InstancePlacement) {
+	if len(placement) == 0 {
+		return
+	}
+	byHost := placementByHost(placement)
+	most := 0
+	for _, instances := range byHost {
+		if len(instances) > most {
+			most = len(instances)
+		}
+	}
+	log.Infow("instances placed", "instances", len(placement), "hosts", len(byHost), "max_instances_per_host", most)
+}
+
+// checkPlacement checks that the placement constraints of the groups of a run
+// can be honoured by their instance counts.
+func checkPlacement(groups []*api.RunGroup) error {
+	for _, g := range groups {
+		if n := g.Placement.InstancesPerNode; n > 0 && g.Instances%n != 0 {
+			return fmt.Errorf("group %s has %d instances, which is not a multiple of its %d instances per node", g.ID, g.Instances, n)
+		}
+	}
+	return nil
+}
+
+// scheduleOnHosts assigns the instances of the groups of a run to hosts,
+// honouring their placement constraints. It returns the host of every
+// instance, by group ID. Groups with a number of instances per node are
+// placed first, each bucket of instances on a host of its own; the instances
+// of other groups are spread across the least loaded hosts they may share.
+func scheduleOnHosts(groups []*api.RunGroup, hosts []string) (map[string][]string, error) {
+	if err := checkPlacement(groups); err != nil {
+		return nil, err
+	}
+
+	// constraints between groups are symmetric.
+	avoid := make(map[string]map[string]struct{}, len(groups))
+	for _, g := range groups {
+		for _, a := range g.Placement.AvoidGroups {
+			if avoid[g.ID] == nil {
+				avoid[g.ID] = make(map[string]struct{})
+			}
+			if avoid[a] == nil {
+				avoid[a] = make(map[string]struct{})
+			}
+			avoid[g.ID][a] = struct{}{}
+			avoid[a][g.ID] = struct{}{}
+		}
+	}
+
+	var (
+		load   = make([]int, len(hosts))
+		placed = make([]map[string]int, len(hosts))
+	)
+	for i := range hosts {
+		placed[i] = make(map[string]int)
+	}
+	allowed := func(h int, group string) bool {
+		for a := range avoid[group] {
+			if placed[h][a] > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	place := func(h int, group string, n int) {
+		placed[h][group] += n
+		load[h] += n
+	}
+
+	ordered := make([]*api.RunGroup, 0, len(groups))
+	for _, g := range groups {
+		if g.Placement.InstancesPerNode > 0 {
+			ordered = append(ordered, g)
+		}
+	}
+	for _, g := range groups {
+		if g.Placement.InstancesPerNode == 0 {
+			ordered = append(ordered, g)
+		}
+	}
+
+	ret := make(map[string][]string, len(groups))
+	for _, g := range ordered {
+		assigned := make([]string, 0, g.Instances)
+		if n := g.Placement.InstancesPerNode; n > 0 {
+			for b := 0; b < g.Instances/n; b++ {
+				h := -1
+				for i := range hosts {
+					if placed[i][g.ID] == 0 && allowed(i, g.ID) {
+						h = i
+						break
+					}
+				}
+				if h < 0 {
+					return nil, fmt.Errorf("cannot place %d instances of group %s per host: not enough hosts", n, g.ID)
+				}
+				place(h, g.ID, n)
+				for j := 0; j < n; j++ {
+					assigned = append(assigned, hosts[h])
+				}
+			}
+		} else {
+			for j := 0; j < g.Instances; j++ {
+				h := -1
+				for i := range hosts {
+					if allowed(i, g.ID) && (h < 0 || load[i] < load[h]) {
+						h = i
+					}
+				}
+				if h < 0 {
+					return nil, fmt.Errorf("cannot place group %s: every host runs a group it must avoid", g.ID)
+				}
+				place(h, g.ID, 1)
+				assigned = append(assigned, hosts[h])
+			}
+		}
+		ret[g.ID] = assigned
+	}
+	return ret, nil
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestPlacementByHost(t *testing.T) {
+	got := placementByHost([]api.InstancePlacement{
+		{Group: "b", Instance: 0, Host: "node-1"},
+		{Group: "a", Instance: 1, Host: "node-2"},
+		{Group: "a", Instance: 0, Host: "node-1"},
+	})
+	want := map[string][]string{
+		"node-1": {"a[0]", "b[0]"},
+		"node-2": {"a[1]"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestScheduleOnHosts(t *testing.T) {
+	hosts := []string{"h1", "h2", "h3"}
+
+	got, err := scheduleOnHosts([]*api.RunGroup{
+		{ID: "providers", Instances: 4, Placement: api.Placement{InstancesPerNode: 2}},
+		{ID: "requesters", Instances: 2, Placement: api.Placement{AvoidGroups: []string{"providers"}}},
+	}, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"providers":  {"h1", "h1", "h2", "h2"},
+		"requesters": {"h3", "h3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// groups avoiding themselves get a host per instance.
+	got, err = scheduleOnHosts([]*api.RunGroup{
+		{ID: "a", Instances: 3, Placement: api.Placement{AvoidGroups: []string{"a"}}},
+	}, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["a"], hosts) {
+		t.Errorf("expected an instance per host, got %v", got["a"])
+	}
+
+	for _, groups := range [][]*api.RunGroup{
+		// not a multiple.
+		{{ID: "a", Instances: 3, Placement: api.Placement{InstancesPerNode: 2}}},
+		// not enough hosts.
+		{{ID: "a", Instances: 8, Placement: api.Placement{InstancesPerNode: 2}}},
+		// a single host can't separate groups.
+		{{ID: "a", Instances: 1}, {ID: "b", Instances: 1, Placement: api.Placement{AvoidGroups: []string{"a"}}}},
+	} {
+		h := hosts
+		if len(groups) == 2 {
+			h = hosts[:1]
+		}
+		if _, err := scheduleOnHosts(groups, h); err == nil {
+			t.Errorf("expected scheduling %v on %v to fail", groups, h)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/docker"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// runImages returns the distinct artifacts used by the groups of a run, in a
+// stable order.
+func runImages(groups []*api.RunGroup) []string {
+	set := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		set[g.ArtifactPath] = struct{}{}
+	}
+
+	images := make([]string, 0, len(set))
+	for img := range set {
+		images = append(images, img)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// prePullDockerImages pulls, in parallel, the images that are missing from the
+// local docker daemon, so that instances aren't created before their image is
+// available. It logs how long each pull took.
+func prePullDockerImages(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, images []string) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, img := range images {
+		img := img
+		eg.Go(func() error {
+			_, _, err := cli.ImageInspectWithRaw(ctx, img)
+			switch {
+			case err == nil:
+				return nil
+			case !client.IsErrNotFound(err):
+				return fmt.Errorf("failed to inspect image %s: %w", img, err)
+			}
+
+			ow.Infow("pre-pulling image", "image", img)
+			start := time.Now()
+
+			out, err := cli.ImagePull(ctx, img, types.ImagePullOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to pull image %s: %w", img, err)
+			}
+			defer out.Close()
+
+			if _, err := docker.PipeOutput(out, ow.StdoutWriter()); err != nil {
+				return fmt.Errorf("failed to pull image %s: %w", img, err)
+			}
+
+			ow.Infow("pre-pulled image", "image", img, "took", time.Since(start).Truncate(time.Millisecond))
+			return nil
+		})
+	}
+	return eg.Wait()
+}
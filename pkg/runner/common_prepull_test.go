@@ -0,0 +1,20 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestRunImages(t *testing.T) {
+	groups := []*api.RunGroup{
+		{ID: "a", ArtifactPath: "img2"},
+		{ID: "b", ArtifactPath: "img1"},
+		{ID: "c", ArtifactPath: "img2"},
+	}
+
+	if got, expected := runImages(groups), []string{"img1", "img2"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
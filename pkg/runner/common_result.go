@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"sync"
+
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/task"
 )
@@ -9,6 +11,22 @@ type Result struct {
 	Outcome  task.Outcome             `json:"outcome"`
 	Outcomes map[string]*GroupOutcome `json:"outcomes"`
 	Journal  *Journal                 `json:"journal"`
+	// Crashes lists the instances that crashed or were killed.
+	Crashes []InstanceCrash `json:"crashes,omitempty"`
+	// crashesLk guards Crashes, which are recorded concurrently by the
+	// goroutines watching instances. It's set by newResult, and shared by the
+	// copies of the result.
+	crashesLk *sync.Mutex
+	// Placement is where each instance was scheduled.
+	Placement []api.InstancePlacement `json:"placement,omitempty"`
+	// Abort is set when an instance aborted the run.
+	Abort *api.RunAbort `json:"abort,omitempty"`
+	// Thresholds are the checks of the thresholds of the run, once it
+	// completed.
+	Thresholds []api.ThresholdCheck `json:"thresholds,omitempty"`
+	// Reason explains a failure decided once the instances completed, e.g.
+	// failed thresholds.
+	Reason string `json:"reason,omitempty"`
 }
 
 func newResult(input *api.RunInput) *Result {
@@ -19,6 +37,7 @@ func newResult(input *api.RunInput) *Result {
 			Events:       make(map[string]string),
 			PodsStatuses: make(map[string]struct{}),
 		},
+		crashesLk: new(sync.Mutex),
 	}
 
 	for _, g := range input.Groups {
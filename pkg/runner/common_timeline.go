@@ -0,0 +1,287 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+
+	"github.com/testground/testground/pkg/sidecar"
+)
+
+// TimelineFile is the file of the outputs of a run holding its timeline: the
+// events of its instances, of the runner and of the sidecar, ordered on the
+// clock of the daemon, one JSON TimelineEntry per line.
+const TimelineFile = "timeline.jsonl"
+
+// Sources of timeline entries.
+const (
+	TimelineSourceRunner   = "runner"
+	TimelineSourceInstance = "instance"
+	TimelineSourceSidecar  = "sidecar"
+)
+
+// Events recorded by the runner in timelines.
+const (
+	TimelineEventInstanceStarted = "instance_started"
+	TimelineEventInstanceExited  = "instance_exited"
+	TimelineEventClockOffset     = "clock_offset"
+	TimelineEventNetworkChange   = "network_change"
+	TimelineEventInfraOutage     = "infra_outage"
+	TimelineEventInfraRecovered  = "infra_recovered"
+)
+
+// TimelineEntry is an event of the timeline of a run.
+type TimelineEntry struct {
+	// Time is when the event happened, on the clock of the daemon.
+	Time   time.Time `json:"ts"`
+	Source string    `json:"source"`
+	Event  string    `json:"event"`
+	Group  string    `json:"group,omitempty"`
+	// Instance is the index of the instance in its group, if the event is
+	// about an instance.
+	Instance *int   `json:"instance,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// LocalTime is when the event happened on the clock of the instance, for
+	// events timestamped by instances, before correcting for its clock offset.
+	LocalTime *time.Time `json:"local_ts,omitempty"`
+	// Data is the payload of the event.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// ClockOffset is the estimated offset of the clock of an instance against the
+// clock of the daemon. The actual offset is within Offset ± Uncertainty. Both
+// are in nanoseconds when encoded.
+type ClockOffset struct {
+	Offset      time.Duration `json:"offset_ns"`
+	Uncertainty time.Duration `json:"uncertainty_ns"`
+}
+
+// estimateClockOffset estimates the clock offset of an instance the way NTP
+// does, from two exchanges bounding it. The instance cannot have logged its
+// first event before the runner started it, which bounds the offset from
+// above, nor its last event after the runner saw it exit, which bounds it from
+// below. It returns false if the instance has not been seen both starting and
+// exiting.
+func estimateClockOffset(started, exited, first, last time.Time) (ClockOffset, bool) {
+	if started.IsZero() || exited.IsZero() || first.IsZero() || last.IsZero() {
+		return ClockOffset{}, false
+	}
+	upper := first.Sub(started)
+	lower := last.Sub(exited)
+	if lower > upper {
+		// the clock drifted during the run; the bounds are crossed.
+		lower, upper = upper, lower
+	}
+	return ClockOffset{
+		Offset:      lower + (upper-lower)/2,
+		Uncertainty: (upper - lower) / 2,
+	}, true
+}
+
+type timelineInstance struct {
+	group string
+	index int
+}
+
+// timeline records the events of a run as they are observed by the runner,
+// and merges them with the events logged by its instances when the run ends.
+type timeline struct {
+	lk      sync.Mutex
+	entries []TimelineEntry
+	started map[timelineInstance]time.Time
+	exited  map[timelineInstance]time.Time
+}
+
+func newTimeline() *timeline {
+	return &timeline{
+		started: make(map[timelineInstance]time.Time),
+		exited:  make(map[timelineInstance]time.Time),
+	}
+}
+
+func (t *timeline) add(e TimelineEntry) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.entries = append(t.entries, e)
+}
+
+// instanceStarted records that the runner started an instance.
+func (t *timeline) instanceStarted(group string, index int) {
+	now := time.Now()
+
+	t.lk.Lock()
+	t.started[timelineInstance{group, index}] = now
+	t.lk.Unlock()
+
+	t.add(TimelineEntry{Time: now, Source: TimelineSourceRunner, Event: TimelineEventInstanceStarted, Group: group, Instance: &index})
+}
+
+// instanceExited records that the runner saw an instance exit.
+func (t *timeline) instanceExited(group string, index int, status int64) {
+	now := time.Now()
+
+	t.lk.Lock()
+	t.exited[timelineInstance{group, index}] = now
+	t.lk.Unlock()
+
+	t.add(TimelineEntry{
+		Time:     now,
+		Source:   TimelineSourceRunner,
+		Event:    TimelineEventInstanceExited,
+		Group:    group,
+		Instance: &index,
+		Message:  fmt.Sprintf("exit status %d", status),
+	})
+}
+
+// networkChange records a network change applied by the sidecar. index is
+// the index of the instance in its group, or -1 if unknown.
+func (t *timeline) networkChange(c *sidecar.NetworkChange, index int) {
+	e := TimelineEntry{
+		Time:    c.Time,
+		Source:  TimelineSourceSidecar,
+		Event:   TimelineEventNetworkChange,
+		Group:   c.GroupID,
+		Message: c.Hostname,
+	}
+	if index >= 0 {
+		e.Instance = &index
+	}
+	if c.Config != nil {
+		e.Message = fmt.Sprintf("%s: network %s (enabled: %t)", c.Hostname, c.Config.Network, c.Config.Enable)
+		e.Data, _ = json.Marshal(c.Config)
+	}
+	t.add(e)
+}
+
+// runOutEvent is an event line of the run.out file of an instance.
+type runOutEvent struct {
+	TS    int64           `json:"ts"`
+	Event json.RawMessage `json:"event"`
+}
+
+// readInstanceEvents reads the events an instance logged into its run.out file.
+func readInstanceEvents(path string) ([]runOutEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []runOutEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e runOutEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.TS == 0 || len(e.Event) == 0 {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// describeEvent returns the type of an event logged by an instance, and a
+// short description of it.
+func describeEvent(raw json.RawMessage) (typ string, msg string) {
+	var e runtime.Event
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return "unknown", ""
+	}
+	switch {
+	case e.StartEvent != nil:
+		return e.StartEvent.Type(), ""
+	case e.MessageEvent != nil:
+		return e.MessageEvent.Type(), e.MessageEvent.Message
+	case e.SuccessEvent != nil:
+		return e.SuccessEvent.Type(), ""
+	case e.FailureEvent != nil:
+		return e.FailureEvent.Type(), e.FailureEvent.Error
+	case e.CrashEvent != nil:
+		return e.CrashEvent.Type(), e.CrashEvent.Error
+	case e.StageStartEvent != nil:
+		return e.StageStartEvent.Type(), e.StageStartEvent.Name
+	case e.StageEndEvent != nil:
+		return e.StageEndEvent.Type(), e.StageEndEvent.Name
+	default:
+		return "unknown", ""
+	}
+}
+
+// addInstanceEvents merges the events an instance logged into its run.out
+// file, correcting their timestamps for the estimated offset of its clock,
+// which is recorded too.
+func (t *timeline) addInstanceEvents(group string, index int, outputsDir string) error {
+	events, err := readInstanceEvents(filepath.Join(outputsDir, "run.out"))
+	if err != nil || len(events) == 0 {
+		return err
+	}
+
+	t.lk.Lock()
+	started, exited := t.started[timelineInstance{group, index}], t.exited[timelineInstance{group, index}]
+	t.lk.Unlock()
+
+	first, last := time.Unix(0, events[0].TS), time.Unix(0, events[len(events)-1].TS)
+	offset, ok := estimateClockOffset(started, exited, first, last)
+	if ok {
+		data, _ := json.Marshal(offset)
+		t.add(TimelineEntry{
+			Time:     started,
+			Source:   TimelineSourceRunner,
+			Event:    TimelineEventClockOffset,
+			Group:    group,
+			Instance: &index,
+			Message:  fmt.Sprintf("%s ± %s", offset.Offset, offset.Uncertainty),
+			Data:     data,
+		})
+	}
+
+	for _, e := range events {
+		local := time.Unix(0, e.TS)
+		typ, msg := describeEvent(e.Event)
+		t.add(TimelineEntry{
+			Time:      local.Add(-offset.Offset),
+			Source:    TimelineSourceInstance,
+			Event:     typ,
+			Group:     group,
+			Instance:  &index,
+			Message:   msg,
+			LocalTime: &local,
+			Data:      e.Event,
+		})
+	}
+	return nil
+}
+
+// write writes the timeline, ordered by time, into the outputs directory of
+// a run.
+func (t *timeline) write(runDir string) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return t.entries[i].Time.Before(t.entries[j].Time)
+	})
+
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	for _, e := range t.entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(runDir, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(runDir, TimelineFile), []byte(b.String()), 0644)
+}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateClockOffset(t *testing.T) {
+	base := time.Now()
+
+	// the instance clock is 5s ahead; it logs 100ms after starting and
+	// exits 50ms after its last event.
+	offset, ok := estimateClockOffset(
+		base,
+		base.Add(10*time.Second),
+		base.Add(5*time.Second+100*time.Millisecond),
+		base.Add(5*time.Second+10*time.Second-50*time.Millisecond),
+	)
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second+25*time.Millisecond, offset.Offset)
+	require.Equal(t, 75*time.Millisecond, offset.Uncertainty)
+
+	_, ok = estimateClockOffset(base, time.Time{}, base, base)
+	require.False(t, ok)
+}
+
+func TestTimelineWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeline")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tl := newTimeline()
+	tl.instanceStarted("miners", 0)
+	started := tl.started[timelineInstance{"miners", 0}]
+
+	// the instance clock is 1h ahead.
+	ahead := started.Add(time.Hour)
+	runOut := fmt.Sprintf(`{"ts":%d,"msg":"","event":{"start_event":{"runenv":{}}}}
+{"ts":%d,"msg":"not an event"}
+{"ts":%d,"msg":"","event":{"message_event":{"message":"hello"}}}
+`, ahead.Add(time.Millisecond).UnixNano(), ahead.Add(2*time.Millisecond).UnixNano(), ahead.Add(3*time.Millisecond).UnixNano())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "run.out"), []byte(runOut), 0644))
+
+	time.Sleep(5 * time.Millisecond)
+	tl.instanceExited("miners", 0, 0)
+
+	require.NoError(t, tl.addInstanceEvents("miners", 0, dir))
+	require.NoError(t, tl.write(dir))
+
+	f, err := os.Open(filepath.Join(dir, TimelineFile))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []TimelineEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e TimelineEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+
+	var events []string
+	for i, e := range entries {
+		events = append(events, e.Event)
+		if i > 0 {
+			require.False(t, e.Time.Before(entries[i-1].Time), "timeline is not ordered")
+		}
+		// once corrected, the events of the instance are within its lifetime.
+		require.WithinDuration(t, started, e.Time, time.Second)
+	}
+	require.ElementsMatch(t, []string{
+		TimelineEventInstanceStarted,
+		TimelineEventClockOffset,
+		"start_event",
+		"message_event",
+		TimelineEventInstanceExited,
+	}, events)
+}
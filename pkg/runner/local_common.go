@@ -5,6 +5,7 @@ import (
 
 	"github.com/docker/go-units"
 
+	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/healthcheck"
 	"github.com/testground/testground/pkg/rpc"
@@ -15,108 +16,121 @@ import (
 	"github.com/docker/go-connections/nat"
 )
 
-func localCommonHealthcheck(ctx context.Context, hh *healthcheck.Helper, cli *client.Client, ow *rpc.OutputWriter, controlNetworkID string, workdir string) {
+// enlistInfraContainer enlists the healthchecks of an infrastructure container:
+// that it is started, and that it runs the image pinned in the configuration.
+// Containers running another image are only replaced when upgrading, so that
+// healthchecks don't restart the infrastructure under running tests.
+func enlistInfraContainer(ctx context.Context, hh *healthcheck.Helper, cli *client.Client, ow *rpc.OutputWriter, item string, opts *docker.EnsureContainerOpts, upgrade bool, deps ...string) {
+	hh.EnlistReversible(item,
+		healthcheck.CheckContainerStarted(ctx, ow, cli, opts.ContainerName),
+		healthcheck.StartContainerWithRollback(ctx, ow, cli, opts),
+	)
+	hh.DependsOn(item, deps...)
+
+	var upgrader healthcheck.ReversibleFixer
+	if upgrade {
+		upgrader = healthcheck.UpgradeContainer(ctx, ow, cli, opts)
+	}
+	hh.EnlistReversible(item+"-version",
+		healthcheck.CheckContainerImage(ctx, ow, cli, opts.ContainerName, opts.ContainerConfig.Image),
+		upgrader,
+	)
+	hh.DependsOn(item+"-version", item)
+}
+
+func localCommonHealthcheck(ctx context.Context, hh *healthcheck.Helper, cli *client.Client, ow *rpc.OutputWriter, controlNetworkID string, workdir string, infra config.InfraConfig, upgrade bool) {
 	hh.Enlist("local-outputs-dir",
 		healthcheck.CheckDirectoryExists(workdir),
 		healthcheck.CreateDirectory(workdir),
 	)
 
 	// testground-control network
-	hh.Enlist("control-network",
+	hh.EnlistReversible("control-network",
 		healthcheck.CheckNetwork(ctx, ow, cli, controlNetworkID),
-		healthcheck.CreateNetwork(ctx, ow, cli, controlNetworkID, network.IPAMConfig{Subnet: controlSubnet, Gateway: controlGateway}),
+		healthcheck.WithRollback(
+			healthcheck.CreateNetwork(ctx, ow, cli, controlNetworkID, network.IPAMConfig{Subnet: controlSubnet, Gateway: controlGateway}),
+			healthcheck.RemoveNetwork(ctx, cli, controlNetworkID),
+		),
 	)
 
 	// grafana from downloaded image, with no additional configuration.
 	_, exposed, _ := nat.ParsePortSpecs([]string{"3000:3000"})
-	hh.Enlist("local-grafana",
-		healthcheck.CheckContainerStarted(ctx, ow, cli, "testground-grafana"),
-		healthcheck.StartContainer(ctx, ow, cli, &docker.EnsureContainerOpts{
-			ContainerName: "testground-grafana",
-			ContainerConfig: &container.Config{
-				Image: "bitnami/grafana",
-			},
-			HostConfig: &container.HostConfig{
-				PortBindings: exposed,
-				NetworkMode:  container.NetworkMode(controlNetworkID),
-			},
-			ImageStrategy: docker.ImageStrategyPull,
-		}),
-	)
+	enlistInfraContainer(ctx, hh, cli, ow, "local-grafana", &docker.EnsureContainerOpts{
+		ContainerName: "testground-grafana",
+		ContainerConfig: &container.Config{
+			Image: infra.Image("grafana"),
+		},
+		HostConfig: &container.HostConfig{
+			PortBindings: exposed,
+			NetworkMode:  container.NetworkMode(controlNetworkID),
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	}, upgrade, "control-network")
 
 	// redis, using a downloaded image and no additional configuration.
 	_, exposed, _ = nat.ParsePortSpecs([]string{"6379:6379"})
-	hh.Enlist("local-redis",
-		healthcheck.CheckContainerStarted(ctx, ow, cli, "testground-redis"),
-		healthcheck.StartContainer(ctx, ow, cli, &docker.EnsureContainerOpts{
-			ContainerName: "testground-redis",
-			ContainerConfig: &container.Config{
-				Image: "library/redis",
-				Cmd:   []string{"--save", "", "--appendonly", "no", "--maxclients", "120000", "--stop-writes-on-bgsave-error", "no"},
-			},
-			HostConfig: &container.HostConfig{
-				// NOTE: we expose this port for compatibility with older sdk versions.
-				PortBindings: exposed,
-				NetworkMode:  container.NetworkMode(controlNetworkID),
-				Resources: container.Resources{
-					Ulimits: []*units.Ulimit{
-						{Name: "nofile", Hard: InfraMaxFilesUlimit, Soft: InfraMaxFilesUlimit},
-					},
-				},
-				Sysctls: map[string]string{
-					"net.core.somaxconn": "150000",
-				},
-				RestartPolicy: container.RestartPolicy{
-					Name: "unless-stopped",
+	enlistInfraContainer(ctx, hh, cli, ow, "local-redis", &docker.EnsureContainerOpts{
+		ContainerName: "testground-redis",
+		ContainerConfig: &container.Config{
+			Image: infra.Image("redis"),
+			Cmd:   []string{"--save", "", "--appendonly", "no", "--maxclients", "120000", "--stop-writes-on-bgsave-error", "no"},
+		},
+		HostConfig: &container.HostConfig{
+			// NOTE: we expose this port for compatibility with older sdk versions.
+			PortBindings: exposed,
+			NetworkMode:  container.NetworkMode(controlNetworkID),
+			Resources: container.Resources{
+				Ulimits: []*units.Ulimit{
+					{Name: "nofile", Hard: InfraMaxFilesUlimit, Soft: InfraMaxFilesUlimit},
 				},
 			},
-			ImageStrategy: docker.ImageStrategyPull,
-		}),
-	)
+			Sysctls: map[string]string{
+				"net.core.somaxconn": "150000",
+			},
+			RestartPolicy: container.RestartPolicy{
+				Name: "unless-stopped",
+			},
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	}, upgrade, "control-network")
 
 	// sync service, which uses redis.
 	_, exposed, _ = nat.ParsePortSpecs([]string{"5050:5050"})
-	hh.Enlist("local-sync-service",
-		healthcheck.CheckContainerStarted(ctx, ow, cli, "testground-sync-service"),
-		healthcheck.StartContainer(ctx, ow, cli, &docker.EnsureContainerOpts{
-			ContainerName: "testground-sync-service",
-			ContainerConfig: &container.Config{
-				Image:      "iptestground/sync-service:edge",
-				Entrypoint: []string{"/service"},
-				Env:        []string{"REDIS_HOST=testground-redis"},
-			},
-			HostConfig: &container.HostConfig{
-				PortBindings: exposed,
-				NetworkMode:  container.NetworkMode(controlNetworkID),
-				Resources: container.Resources{
-					Ulimits: []*units.Ulimit{
-						{Name: "nofile", Hard: InfraMaxFilesUlimit, Soft: InfraMaxFilesUlimit},
-					},
-				},
-				Sysctls: map[string]string{
-					"net.core.somaxconn": "150000",
-				},
-				RestartPolicy: container.RestartPolicy{
-					Name: "unless-stopped",
+	enlistInfraContainer(ctx, hh, cli, ow, "local-sync-service", &docker.EnsureContainerOpts{
+		ContainerName: "testground-sync-service",
+		ContainerConfig: &container.Config{
+			Image:      infra.Image("sync-service"),
+			Entrypoint: []string{"/service"},
+			Env:        []string{"REDIS_HOST=testground-redis"},
+		},
+		HostConfig: &container.HostConfig{
+			PortBindings: exposed,
+			NetworkMode:  container.NetworkMode(controlNetworkID),
+			Resources: container.Resources{
+				Ulimits: []*units.Ulimit{
+					{Name: "nofile", Hard: InfraMaxFilesUlimit, Soft: InfraMaxFilesUlimit},
 				},
 			},
-		}),
-	)
-
-	_, exposed, _ = nat.ParsePortSpecs([]string{"8086:8086", "8088:8088"})
-	hh.Enlist("local-influxdb",
-		healthcheck.CheckContainerStarted(ctx, ow, cli, "testground-influxdb"),
-		healthcheck.StartContainer(ctx, ow, cli, &docker.EnsureContainerOpts{
-			ContainerName: "testground-influxdb",
-			ContainerConfig: &container.Config{
-				Image: "library/influxdb:1.8",
-				Env:   []string{"INFLUXDB_HTTP_AUTH_ENABLED=false", "INFLUXDB_DB=testground", "INFLUXDB_HTTP_FLUX_ENABLED=true"},
+			Sysctls: map[string]string{
+				"net.core.somaxconn": "150000",
 			},
-			HostConfig: &container.HostConfig{
-				PortBindings: exposed,
-				NetworkMode:  container.NetworkMode(controlNetworkID),
+			RestartPolicy: container.RestartPolicy{
+				Name: "unless-stopped",
 			},
-			ImageStrategy: docker.ImageStrategyPull,
-		}),
-	)
+		},
+	}, upgrade, "control-network", "local-redis")
+
+	_, exposed, _ = nat.ParsePortSpecs([]string{"8086:8086", "8088:8088"})
+	enlistInfraContainer(ctx, hh, cli, ow, "local-influxdb", &docker.EnsureContainerOpts{
+		ContainerName: "testground-influxdb",
+		ContainerConfig: &container.Config{
+			Image: infra.Image("influxdb"),
+			Env:   []string{"INFLUXDB_HTTP_AUTH_ENABLED=false", "INFLUXDB_DB=testground", "INFLUXDB_HTTP_FLUX_ENABLED=true"},
+		},
+		HostConfig: &container.HostConfig{
+			PortBindings: exposed,
+			NetworkMode:  container.NetworkMode(controlNetworkID),
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	}, upgrade, "control-network")
 }
@@ -3,7 +3,6 @@ package runner
 import (
 	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -23,6 +22,7 @@ import (
 	"github.com/testground/sdk-go/runtime"
 
 	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/conv"
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/healthcheck"
@@ -35,7 +35,6 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 
 	"github.com/imdario/mergo"
 	"golang.org/x/sync/errgroup"
@@ -46,9 +45,13 @@ import (
 const InfraMaxFilesUlimit int64 = 1048576
 
 var (
-	_ api.Runner        = (*LocalDockerRunner)(nil)
-	_ api.Healthchecker = (*LocalDockerRunner)(nil)
-	_ api.Terminatable  = (*LocalDockerRunner)(nil)
+	_ api.Runner         = (*LocalDockerRunner)(nil)
+	_ api.Healthchecker  = (*LocalDockerRunner)(nil)
+	_ api.InfraUpgrader  = (*LocalDockerRunner)(nil)
+	_ api.Terminatable   = (*LocalDockerRunner)(nil)
+	_ api.Debugger       = (*LocalDockerRunner)(nil)
+	_ api.Reconciler     = (*LocalDockerRunner)(nil)
+	_ api.OutputsLocator = (*LocalDockerRunner)(nil)
 )
 
 // LocalDockerRunnerConfig is the configuration object of this runner. Boolean
@@ -76,12 +79,88 @@ type LocalDockerRunnerConfig struct {
 	OutcomesCollectionTimeout time.Duration `toml:"outcomes_collection_timeout"`
 
 	AdditionalHosts []string `toml:"additional_hosts"`
+
+	// MetricsPort is the port on which test instances serve Prometheus
+	// metrics. When set, it is passed to instances as METRICS_PORT, and every
+	// instance is registered as a scrape target with the local Prometheus
+	// for the duration of the run (default: not set).
+	MetricsPort string `toml:"metrics_port"`
+
+	// OutputsQuota caps the size of the outputs directory of each instance,
+	// in human-readable units, e.g. "512MiB" (default: unlimited).
+	OutputsQuota string `toml:"outputs_quota"`
+	// OutputsQuotaPolicy is what happens to an instance exceeding its outputs
+	// quota: "fail" stops it, "rotate" truncates its oldest files (default:
+	// "fail").
+	OutputsQuotaPolicy string `toml:"outputs_quota_policy"`
+
+	// DedicatedMetrics spins up a Prometheus and Grafana pair dedicated to the
+	// run, scraping its instances when MetricsPort is set. Its TSDB is
+	// snapshotted into the outputs of the run when it ends (default: false).
+	DedicatedMetrics bool `toml:"dedicated_metrics"`
+	// Pushgateway is the host:port of a pushgateway the dedicated Prometheus
+	// also scrapes (default: not set).
+	Pushgateway string `toml:"pushgateway"`
+
+	// HostMetrics captures the CPU, memory, disk and network metrics of the
+	// docker host for the duration of the run, into the host-metrics
+	// directory of its outputs (default: false).
+	HostMetrics bool `toml:"host_metrics"`
+	// HostMetricsInterval is how often host metrics are sampled (default:
+	// "5s").
+	HostMetricsInterval string `toml:"host_metrics_interval"`
+	// HostMetricsPort is the port the collector of host metrics listens on,
+	// on the loopback interface of the docker host. By default, a free port
+	// is picked if the docker host is the daemon host, and 9101 is used
+	// otherwise.
+	HostMetricsPort int `toml:"host_metrics_port"`
+
+	// PauseOnFailure freezes the run as soon as an instance fails, and holds
+	// it for the given duration, e.g. "30m", before tearing it down, so that
+	// instances can be inspected. Canceling the task ends the pause early
+	// (default: not set).
+	PauseOnFailure string `toml:"pause_on_failure"`
+
+	// DebugInstance starts an instance, given as <group>:<index>, under the
+	// delve debugger, which waits for a client to connect before starting the
+	// instance. Its image must have been built by docker:go with debug = true
+	// (default: not set).
+	DebugInstance string `toml:"debug_instance"`
+	// DebugPort is the port delve listens on in the container. It is
+	// published on a random host port, which is logged (default: 2345).
+	DebugPort int `toml:"debug_port"`
+
+	// CoreDumps lets instances dump core when they crash, into their outputs
+	// directory. It requires the core pattern of the kernel to be a relative
+	// path, e.g. "core" (default: false).
+	CoreDumps bool `toml:"core_dumps"`
+
+	// AllowedBindMounts are the host paths under which compositions may bind
+	// mount directories into instances (default: none).
+	AllowedBindMounts []string `toml:"allowed_bind_mounts"`
+
+	// InstanceLogsLimit caps the stdout and stderr of each instance, in
+	// human-readable units, e.g. "64MiB". Docker keeps that much of them, if
+	// its log driver is json-file or local, and their head and tail are
+	// captured into the outputs of the instance, as stdout.log and
+	// stderr.log; truncations are listed in truncated-logs.json in the
+	// outputs of the run (default: not set).
+	InstanceLogsLimit string `toml:"instance_logs_limit"`
+
+	// InfraChaosEvery cuts the instances off the control network, and thus
+	// off the sync service, at this interval, e.g. "1m", to check that they
+	// recover from infrastructure blips. Only full outages are injected, not
+	// latency, and the data network is unaffected (default: not set).
+	InfraChaosEvery string `toml:"infra_chaos_every"`
+	// InfraChaosOutage is how long each outage lasts (default: "5s").
+	InfraChaosOutage string `toml:"infra_chaos_outage"`
 }
 
 type testContainerInstance struct {
 	containerID string
 	groupID     string
 	groupIdx    int
+	outputsDir  string
 }
 
 // defaultConfig is the default configuration. Incoming configurations will be
@@ -109,11 +188,37 @@ type LocalDockerRunner struct {
 
 	controlNetworkID string
 	outputsDir       string
+	prometheusDir    string
 
 	syncClient *ss.DefaultClient
+
+	// live holds the runs in progress, to resize their groups, see
+	// ScaleGroup.
+	liveLk sync.Mutex
+	live   map[string]*liveDockerRun
+
+	// attachedSubnets are the blocks of data networks reserved by the
+	// ongoing runs attached to other runs, see reserveAttachedSubnet.
+	attachedLk      sync.Mutex
+	attachedSubnets map[string]struct{}
+
+	// pauses hold the pause state of the ongoing runs, to hold their infra
+	// chaos while they're paused, see PauseRun.
+	pausesLk sync.Mutex
+	pauses   map[string]*pauseGate
 }
 
 func (r *LocalDockerRunner) Healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool) (*api.HealthcheckReport, error) {
+	return r.healthcheck(ctx, engine, ow, fix, false)
+}
+
+// UpgradeInfra replaces the infrastructure containers running other images
+// than the pinned ones, one at a time, in dependency order.
+func (r *LocalDockerRunner) UpgradeInfra(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter) (*api.HealthcheckReport, error) {
+	return r.healthcheck(ctx, engine, ow, true, true)
+}
+
+func (r *LocalDockerRunner) healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool, upgrade bool) (*api.HealthcheckReport, error) {
 	r.lk.Lock()
 	defer r.lk.Unlock()
 
@@ -125,11 +230,47 @@ func (r *LocalDockerRunner) Healthcheck(ctx context.Context, engine api.Engine,
 
 	r.outputsDir = filepath.Join(engine.EnvConfig().Dirs().Outputs(), "local_docker")
 	r.controlNetworkID = "testground-control"
+	r.prometheusDir = ""
 
 	hh := &healthcheck.Helper{}
 
 	// enlist healthchecks which are common between local:docker and local:exec
-	localCommonHealthcheck(ctx, hh, cli, ow, r.controlNetworkID, r.outputsDir)
+	infra := engine.EnvConfig().Daemon.Infra
+	localCommonHealthcheck(ctx, hh, cli, ow, r.controlNetworkID, r.outputsDir, infra, upgrade)
+
+	// prometheus, which scrapes test instances discovered through the
+	// file_sd directory that this runner populates on every run. It's only
+	// provisioned when the daemon configures a metrics port for instances.
+	if port, _ := engine.EnvConfig().Runners["local:docker"]["metrics_port"].(string); port != "" {
+		r.prometheusDir = engine.EnvConfig().Dirs().Prometheus()
+		prometheusCfg := filepath.Join(r.prometheusDir, "prometheus.yml")
+		hh.Enlist("prometheus-config",
+			healthcheck.CheckFileExists(prometheusCfg),
+			healthcheck.WriteFile(prometheusCfg, []byte(prometheusConfig)),
+		)
+
+		_, exposed, _ := nat.ParsePortSpecs([]string{"9090:9090"})
+		enlistInfraContainer(ctx, hh, cli, ow, "local-prometheus", &docker.EnsureContainerOpts{
+			ContainerName: "testground-prometheus",
+			ContainerConfig: &container.Config{
+				Image: infra.Image("prometheus"),
+				Cmd:   []string{"--config.file=/etc/prometheus/prometheus.yml"},
+			},
+			HostConfig: &container.HostConfig{
+				PortBindings: exposed,
+				NetworkMode:  container.NetworkMode(r.controlNetworkID),
+				Mounts: []mount.Mount{{
+					Type:   mount.TypeBind,
+					Source: r.prometheusDir,
+					Target: "/etc/prometheus",
+				}},
+				RestartPolicy: container.RestartPolicy{
+					Name: "unless-stopped",
+				},
+			},
+			ImageStrategy: docker.ImageStrategyPull,
+		}, upgrade, "prometheus-config", "control-network")
+	}
 
 	dockerSock := "/var/run/docker.sock"
 	if host := cli.DaemonHost(); strings.HasPrefix(host, "unix://") {
@@ -146,7 +287,7 @@ func (r *LocalDockerRunner) Healthcheck(ctx context.Context, engine api.Engine,
 	sidecarContainerOpts := docker.EnsureContainerOpts{
 		ContainerName: "testground-sidecar",
 		ContainerConfig: &container.Config{
-			Image:      "iptestground/sidecar:edge",
+			Image:      infra.Image("sidecar"),
 			Entrypoint: []string{"testground"},
 			Cmd:        []string{"sidecar", "--runner", "docker"},
 			// NOTE: we export REDIS_HOST for compatibility with older sdk versions.
@@ -181,10 +322,8 @@ func (r *LocalDockerRunner) Healthcheck(ctx context.Context, engine api.Engine,
 	}
 
 	// sidecar healthcheck.
-	hh.Enlist("sidecar-container",
-		healthcheck.CheckContainerStarted(ctx, ow, cli, "testground-sidecar"),
-		healthcheck.StartContainer(ctx, ow, cli, &sidecarContainerOpts),
-	)
+	enlistInfraContainer(ctx, hh, cli, ow, "sidecar-container", &sidecarContainerOpts, upgrade,
+		"control-network", "local-sync-service", "local-influxdb")
 
 	// RunChecks will fill the report and return any errors.
 	return hh.RunChecks(ctx, fix)
@@ -214,45 +353,90 @@ func (r *LocalDockerRunner) setupSyncClient() error {
 
 // collectOutcomes listens to the sync service and collects the outcome for every test instance.
 // It stops when all instances have submitted a result or the context was canceled.
-func (r *LocalDockerRunner) collectOutcomes(ctx context.Context, result *Result, tpl *runtime.RunParams) (chan bool, error) {
+// onFailure, if not nil, is called with the group of every instance reporting a failure.
+//
+// The returned function adjusts the number of outcomes expected from a group,
+// as instances are added to the run or removed from it.
+func (r *LocalDockerRunner) collectOutcomes(ctx context.Context, result *Result, tpl *runtime.RunParams, onFailure func(groupID string)) (chan bool, func(groupID string, delta int), error) {
 	eventsCh, err := r.syncClient.SubscribeEvents(ctx, tpl)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// TODO: eventually we'll keep a trace of each test instance status.
 	// Right now, if a container sends multiple events, it will mess up the outcomes.
 	// We have to pass its group id to the container, so that it can send us back messages
 	// with its own id.
-	expectingOutcomes := result.countTotalInstances()
-	done := make(chan bool)
+	var (
+		lk                sync.Mutex // guards expectingOutcomes and the outcomes of result.
+		expectingOutcomes = result.countTotalInstances()
+		reported          = make(map[string]int) // outcomes received, by group.
+		expected          = make(chan struct{}, 1)
+		done              = make(chan bool)
+	)
+
+	expect := func(groupID string, delta int) {
+		lk.Lock()
+		g := result.Outcomes[groupID]
+		if pending := g.Total - reported[groupID]; delta < -pending {
+			delta = -pending
+		}
+		g.Total += delta
+		expectingOutcomes += delta
+		lk.Unlock()
+
+		select {
+		case expected <- struct{}{}:
+		default:
+		}
+	}
+
+	remaining := func() int {
+		lk.Lock()
+		defer lk.Unlock()
+		return expectingOutcomes
+	}
 
 	go func() {
 		running := true
-		for running && expectingOutcomes > 0 {
+		for running && remaining() > 0 {
 			select {
 			case <-ctx.Done():
 				running = false
+			case <-expected:
 			case e := <-eventsCh:
+				lk.Lock()
 				if e.SuccessEvent != nil {
 					result.addOutcome(e.SuccessEvent.TestGroupID, task.OutcomeSuccess)
+					reported[e.SuccessEvent.TestGroupID]++
 					expectingOutcomes -= 1
 				} else if e.FailureEvent != nil {
 					result.addOutcome(e.FailureEvent.TestGroupID, task.OutcomeFailure)
+					reported[e.FailureEvent.TestGroupID]++
 					expectingOutcomes -= 1
+					if onFailure != nil {
+						onFailure(e.FailureEvent.TestGroupID)
+					}
 				} else if e.CrashEvent != nil {
 					result.addOutcome(e.CrashEvent.TestGroupID, task.OutcomeFailure)
+					reported[e.CrashEvent.TestGroupID]++
 					expectingOutcomes -= 1
+					if onFailure != nil {
+						onFailure(e.CrashEvent.TestGroupID)
+					}
 				}
 				// else: skip
+				lk.Unlock()
 			}
 		}
 
+		lk.Lock()
 		result.updateOutcome()
+		lk.Unlock()
 		done <- true
 	}()
 
-	return done, nil
+	return done, expect, nil
 }
 
 func (r *LocalDockerRunner) prepareOutputDirectory(instance_id int, runenv *runtime.RunParams) (string, error) {
@@ -323,8 +507,25 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		return
 	}
 
-	// Create a data network.
-	dataNetworkID, subnet, err := newDataNetwork(ctx, cli, ow, input, "default")
+	// Create a data network, or join that of the run to attach to.
+	var (
+		dataNetworkID string
+		subnet        *net.IPNet
+	)
+	if input.AttachTo != "" {
+		dataNetworkID, subnet, err = findDataNetwork(ctx, cli, input.AttachTo, "default")
+		if err != nil {
+			return
+		}
+		// the instances of the run derive their data addresses from a block
+		// of the network of their own.
+		if subnet, err = r.reserveAttachedSubnet(ctx, cli, dataNetworkID, subnet); err != nil {
+			return
+		}
+		defer r.releaseAttachedSubnet(subnet)
+	} else {
+		dataNetworkID, subnet, err = newDataNetwork(ctx, cli, ow, input, "default")
+	}
 	if err != nil {
 		return
 	}
@@ -350,6 +551,73 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		return
 	}
 
+	// Expose the metrics port to instances, without altering the supplied
+	// configuration.
+	if cfg.MetricsPort != "" {
+		exposed := make(ExposedPorts, len(cfg.ExposedPorts)+1)
+		for label, port := range cfg.ExposedPorts {
+			exposed[label] = port
+		}
+		exposed[MetricsExposedPortLabel] = cfg.MetricsPort
+		cfg.ExposedPorts = exposed
+	}
+
+	quota, err := parseOutputsQuota(cfg.OutputsQuota, cfg.OutputsQuotaPolicy)
+	if err != nil {
+		return
+	}
+
+	logsLimit, err := parseLogsLimit(cfg.InstanceLogsLimit)
+	if err != nil {
+		return
+	}
+	var logConfig *container.LogConfig
+	if logsLimit > 0 {
+		if logConfig = dockerLogConfig(ctx, cli, ow, logsLimit); logConfig == nil {
+			ow.Infow("the log driver of the docker host can't bound the logs it keeps; only the captured logs are capped")
+		}
+	}
+
+	if err = checkMounts(input.Groups, cfg.AllowedBindMounts); err != nil {
+		return
+	}
+
+	var hostMetricsInterval int
+	if cfg.HostMetrics {
+		if hostMetricsInterval, err = parseHostMetricsInterval(cfg.HostMetricsInterval); err != nil {
+			return
+		}
+	}
+
+	// All instances run on the docker host; make sure that the placement
+	// constraints of the groups allow it.
+	host := dockerHostName(ctx, cli, log)
+	if _, err = scheduleOnHosts(input.Groups, []string{host}); err != nil {
+		return
+	}
+
+	delve, err := parseDelveTarget(cfg.DebugInstance, cfg.DebugPort, input.Groups)
+	if err != nil {
+		return
+	}
+
+	chaos, err := parseInfraChaos(cfg.InfraChaosEvery, cfg.InfraChaosOutage)
+	if err != nil {
+		return
+	}
+
+	var bp *failureBreakpoint
+	if cfg.PauseOnFailure != "" {
+		if bp, err = newFailureBreakpoint(cfg.PauseOnFailure); err != nil {
+			return
+		}
+	}
+
+	// Make sure all images are available before creating any container.
+	if err = prePullDockerImages(ctx, log, cli, runImages(input.Groups)); err != nil {
+		return
+	}
+
 	// Prepare the ports mapping.
 	ports := make(nat.PortSet)
 	for _, p := range cfg.ExposedPorts {
@@ -362,29 +630,68 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 	sharedEnv = append(sharedEnv, "REDIS_HOST=testground-redis")
 	// Inject exposed ports.
 	sharedEnv = append(sharedEnv, conv.ToOptionsSlice(cfg.ExposedPorts.ToEnvVars())...)
+	sharedEnv = append(sharedEnv, conv.ToOptionsSlice(seedEnvVars(input))...)
+	// Tell instances which run they're attached to, if any.
+	if input.AttachTo != "" {
+		sharedEnv = append(sharedEnv, EnvTestAttachedRun+"="+input.AttachTo)
+	}
 	// Set the log level if provided in cfg.
 	if cfg.LogLevel != "" {
 		sharedEnv = append(sharedEnv, "LOG_LEVEL="+cfg.LogLevel)
 	}
+	// Make the Go runtime abort on fatal errors, so that the kernel dumps core.
+	if cfg.CoreDumps {
+		sharedEnv = append(sharedEnv, "GOTRACEBACK=crash")
+		if !coreDumpsEnabled() {
+			log.Warn("the core pattern of the kernel is not a relative path; core dumps will not land in the outputs of instances")
+		}
+	}
+
+	// Prepare the snapshot directories of the instances, if the run saves or
+	// restores a snapshot.
+	snap, err := newRunSnapshot(input.EnvConfig.Dirs().Snapshots(), input.RunID, input.Snapshot)
+	if err != nil {
+		return
+	}
+	defer func() {
+		snap.finish(log, err == nil && ctx.Err() == nil && result.Outcome == task.OutcomeSuccess)
+	}()
+	sharedEnv = append(sharedEnv, conv.ToOptionsSlice(snap.envVars())...)
 
 	// ## Create the containers
 	var (
-		containers []testContainerInstance
-		tmpdirs    []string
+		// instancesLk guards containers, tmpdirs and metricsTargets, which
+		// grow when groups are scaled up during the run.
+		instancesLk    sync.Mutex
+		containers     []testContainerInstance
+		tmpdirs        []string
+		metricsTargets []metricsTargetGroup
+		delveContainer *testContainerInstance
 	)
 
+	// instances returns the containers of the run so far.
+	instances := func() []testContainerInstance {
+		instancesLk.Lock()
+		defer instancesLk.Unlock()
+		return append([]testContainerInstance(nil), containers...)
+	}
+
 	defer func() {
 		// remove all temporary directories.
+		instancesLk.Lock()
+		defer instancesLk.Unlock()
 		for _, tmpdir := range tmpdirs {
 			_ = os.RemoveAll(tmpdir)
 		}
 	}()
 
-	for _, g := range input.Groups {
-		reviewResources(g, ow)
-
+	// groupEnv prepares the run environment of the instances of a group, and
+	// their environment variables, given the size of the group and the total
+	// number of instances.
+	groupEnv := func(g *api.RunGroup, instances, total int) (runtime.RunParams, []string) {
 		runenv := template
-		runenv.TestGroupInstanceCount = g.Instances
+		runenv.TestInstanceCount = total
+		runenv.TestGroupInstanceCount = instances
 		runenv.TestGroupID = g.ID
 		runenv.TestInstanceParams = g.Parameters
 		runenv.TestCaptureProfiles = g.Profiles
@@ -392,89 +699,167 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		env := make([]string, 0, len(sharedEnv)+len(runenv.ToEnvVars()))
 		env = append(env, sharedEnv...)
 		env = append(env, conv.ToOptionsSlice(runenv.ToEnvVars())...)
+		env = append(env, conv.ToOptionsSlice(storeEnvVars(input, g))...)
 		logging.S().Infow("additional hosts", "hosts", strings.Join(cfg.AdditionalHosts, ","))
 		env = append(env, fmt.Sprintf("ADDITIONAL_HOSTS=%s", strings.Join(cfg.AdditionalHosts, ",")))
+		return runenv, env
+	}
 
-		// Start as many containers as group instances.
-		for i := 0; i < g.Instances; i++ {
-			// TODO: We should set the instance id in runenv and make this whole operation self contained around a local runenv.
-			tmpdir, err := r.prepareTemporaryDirectory(i, &runenv)
-			if err != nil {
-				return nil, fmt.Errorf("failed to prepare temporary directory: %w", err)
-			}
-			tmpdirs = append(tmpdirs, tmpdir)
+	// createInstance creates the container of the i-th instance of a group,
+	// and attaches it to the data network.
+	createInstance := func(g *api.RunGroup, runenv runtime.RunParams, env []string, i int, name string) (testContainerInstance, error) {
+		// TODO: We should set the instance id in runenv and make this whole operation self contained around a local runenv.
+		tmpdir, err := r.prepareTemporaryDirectory(i, &runenv)
+		if err != nil {
+			return testContainerInstance{}, fmt.Errorf("failed to prepare temporary directory: %w", err)
+		}
+		instancesLk.Lock()
+		tmpdirs = append(tmpdirs, tmpdir)
+		instancesLk.Unlock()
 
-			odir, err := r.prepareOutputDirectory(i, &runenv)
-			if err != nil {
-				return nil, fmt.Errorf("failed to prepare output directory: %w", err)
-			}
+		odir, err := r.prepareOutputDirectory(i, &runenv)
+		if err != nil {
+			return testContainerInstance{}, fmt.Errorf("failed to prepare output directory: %w", err)
+		}
 
-			// TODO: runenv.TestRun == input.RunID. Refactor into a single name.
-			name := fmt.Sprintf("tg-%s-%s-%s-%s-%d", runenv.TestPlan, runenv.TestCase, runenv.TestRun, runenv.TestGroupID, i)
-			log.Infow("creating container", "name", name)
+		log.Infow("creating container", "name", name)
+
+		ccfg := &container.Config{
+			Image:        g.ArtifactPath,
+			ExposedPorts: ports,
+			Env:          env,
+			Labels: map[string]string{
+				"testground.purpose":  "plan",
+				"testground.plan":     runenv.TestPlan,
+				"testground.testcase": runenv.TestCase,
+				"testground.run_id":   runenv.TestRun,
+				"testground.group_id": runenv.TestGroupID,
+				"testground.instance": strconv.Itoa(i),
+			},
+		}
 
-			ccfg := &container.Config{
-				Image:        g.ArtifactPath,
-				ExposedPorts: ports,
-				Env:          env,
-				Labels: map[string]string{
-					"testground.purpose":  "plan",
-					"testground.plan":     runenv.TestPlan,
-					"testground.testcase": runenv.TestCase,
-					"testground.run_id":   runenv.TestRun,
-					"testground.group_id": runenv.TestGroupID,
-				},
+		hcfg := &container.HostConfig{
+			NetworkMode:     container.NetworkMode("testground-control"),
+			PublishAllPorts: true,
+			Mounts: []mount.Mount{{
+				Type:   mount.TypeBind,
+				Source: odir,
+				Target: runenv.TestOutputsPath,
+			}, {
+				Type:   mount.TypeBind,
+				Source: tmpdir,
+				Target: runenv.TestTempPath,
+			}},
+		}
+		hcfg.Mounts = append(hcfg.Mounts, dockerMounts(input.RunID, g.ID, i, g.Mounts)...)
+		if snap != nil {
+			sdir, err := snap.instanceDir(g.ID, i)
+			if err != nil {
+				return testContainerInstance{}, err
 			}
+			hcfg.Mounts = append(hcfg.Mounts, mount.Mount{
+				Type:   mount.TypeBind,
+				Source: sdir,
+				Target: snapshotMountPath,
+			})
+		}
+		hcfg.CapAdd = g.Security.Capabilities()
+		hcfg.Privileged = g.Security.Privileged
+		if g.Security.Seccomp == api.SeccompUnconfined {
+			hcfg.SecurityOpt = []string{"seccomp=unconfined"}
+		}
 
-			hcfg := &container.HostConfig{
-				NetworkMode:     container.NetworkMode("testground-control"),
-				PublishAllPorts: true,
-				Mounts: []mount.Mount{{
-					Type:   mount.TypeBind,
-					Source: odir,
-					Target: runenv.TestOutputsPath,
-				}, {
-					Type:   mount.TypeBind,
-					Source: tmpdir,
-					Target: runenv.TestTempPath,
-				}},
+		if delve.matches(g.ID, i) {
+			if err := checkDelveImage(ctx, cli, g.ArtifactPath); err != nil {
+				return testContainerInstance{}, err
 			}
-
-			if len(cfg.Ulimits) > 0 {
-				ulimits, err := conv.ToUlimits(cfg.Ulimits)
-				if err == nil {
-					hcfg.Resources = container.Resources{Ulimits: ulimits}
-				} else {
-					ow.Warnf("invalid ulimit will be ignored %v", err)
-				}
+			ccfg.Entrypoint = delve.command("/dlv", "/testplan", fmt.Sprintf(":%d", delve.port))
+			ccfg.ExposedPorts = make(nat.PortSet, len(ports)+1)
+			for p := range ports {
+				ccfg.ExposedPorts[p] = struct{}{}
 			}
+			ccfg.ExposedPorts[delvePort(delve.port)] = struct{}{}
+		}
 
-			// Create the container.
-			var res container.ContainerCreateCreatedBody
-			res, err = cli.ContainerCreate(ctx, ccfg, hcfg, nil, name)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create container: %w", err)
+		if len(cfg.Ulimits) > 0 {
+			ulimits, err := conv.ToUlimits(cfg.Ulimits)
+			if err == nil {
+				hcfg.Resources = container.Resources{Ulimits: ulimits}
+			} else {
+				ow.Warnf("invalid ulimit will be ignored %v", err)
 			}
+		}
 
-			container := testContainerInstance{
-				containerID: res.ID,
-				groupID:     g.ID,
-				groupIdx:    i,
-			}
-			containers = append(containers, container)
+		// Core dumps are written to the working directory.
+		if cfg.CoreDumps {
+			ccfg.WorkingDir = runenv.TestOutputsPath
+			hcfg.Resources.Ulimits = append(hcfg.Resources.Ulimits, &units.Ulimit{Name: "core", Soft: -1, Hard: -1})
+		}
 
-			// TODO: Remove this when we get the sidecar working. It'll do this for us.
-			err = attachContainerToNetwork(ctx, cli, res.ID, dataNetworkID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to attach container to network: %w", err)
+		if logConfig != nil {
+			hcfg.LogConfig = *logConfig
+		}
+
+		if err := applyMemoryBehavior(hcfg, g.Resources); err != nil {
+			return testContainerInstance{}, fmt.Errorf("group %s: %w", g.ID, err)
+		}
+
+		// Create the container.
+		res, err := cli.ContainerCreate(ctx, ccfg, hcfg, nil, name)
+		if err != nil {
+			return testContainerInstance{}, fmt.Errorf("failed to create container: %w", err)
+		}
+
+		container := testContainerInstance{
+			containerID: res.ID,
+			groupID:     g.ID,
+			groupIdx:    i,
+			outputsDir:  odir,
+		}
+		instancesLk.Lock()
+		containers = append(containers, container)
+		if delve.matches(g.ID, i) {
+			delveContainer = &container
+		}
+
+		// Instances are reachable by container name on the control network.
+		if cfg.MetricsPort != "" {
+			addr := net.JoinHostPort(name, cfg.MetricsPort)
+			metricsTargets = append(metricsTargets, newMetricsTargetGroup(addr, runenv.TestPlan, runenv.TestCase, runenv.TestRun, runenv.TestGroupID, i))
+		}
+		instancesLk.Unlock()
+
+		// TODO: Remove this when we get the sidecar working. It'll do this for us.
+		if err := attachContainerToNetwork(ctx, cli, res.ID, dataNetworkID); err != nil {
+			return testContainerInstance{}, fmt.Errorf("failed to attach container to network: %w", err)
+		}
+		return container, nil
+	}
+
+	for _, g := range input.Groups {
+		// memory is enforced along with swap, and when the OOM killer is
+		// disabled.
+		if g.Resources.MemorySwap == "" && !g.Resources.OOMKillDisable {
+			reviewResources(g, ow)
+		}
+
+		runenv, env := groupEnv(g, g.Instances, input.TotalInstances)
+
+		// Start as many containers as group instances.
+		for i := 0; i < g.Instances; i++ {
+			// TODO: runenv.TestRun == input.RunID. Refactor into a single name.
+			name := fmt.Sprintf("tg-%s-%s-%s-%s-%d", runenv.TestPlan, runenv.TestCase, runenv.TestRun, runenv.TestGroupID, i)
+			if _, err := createInstance(g, runenv, env, i, name); err != nil {
+				return nil, err
 			}
 		}
 	}
 
 	if !cfg.KeepContainers {
 		defer func() {
-			ids := make([]string, 0, len(containers))
-			for _, c := range containers {
+			all := instances()
+			ids := make([]string, 0, len(all))
+			for _, c := range all {
 				ids = append(ids, c.containerID)
 			}
 			if err := docker.DeleteContainers(cli, log, ids); err != nil {
@@ -482,9 +867,14 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 			}
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			if err := cli.NetworkRemove(ctx, dataNetworkID); err != nil {
-				log.Errorw("removing network", "network", dataNetworkID, "error", err)
+			// the network of an attached run belongs to the run it's
+			// attached to.
+			if input.AttachTo == "" {
+				if err := cli.NetworkRemove(ctx, dataNetworkID); err != nil {
+					log.Errorw("removing network", "network", dataNetworkID, "error", err)
+				}
 			}
+			removeRunVolumes(ctx, cli, log, input.RunID)
 		}()
 	}
 
@@ -494,10 +884,57 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		return
 	}
 
+	// Record where the instances run: all of them share the docker host.
+	result.Placement = dockerPlacement(host, containers)
+	logPlacement(log, result.Placement)
+	if err := writePlacement(filepath.Join(r.outputsDir, input.TestPlan, input.RunID), result.Placement); err != nil {
+		log.Warnw("failed to record the placement of instances", "err", err)
+	}
+
 	if cfg.Unstarted {
 		return
 	}
 
+	// Register the instances as scrape targets for the duration of the run.
+	if len(metricsTargets) > 0 && r.prometheusDir == "" && !cfg.DedicatedMetrics {
+		ow.Warnw("instances serve metrics, but the local Prometheus isn't provisioned; set metrics_port in the local:docker config of the daemon, or enable dedicated_metrics")
+	}
+	if len(metricsTargets) > 0 && r.prometheusDir != "" {
+		var path string
+		path, err = writeMetricsTargets(filepath.Join(r.prometheusDir, "file_sd"), input.RunID, metricsTargets)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer os.Remove(path)
+	}
+
+	// Spin up the metrics stack of the run, if requested.
+	if cfg.DedicatedMetrics {
+		var rm *runMetrics
+		rm, err = startRunMetrics(ctx, cli, log, filepath.Join(input.EnvConfig.Dirs().Work(), "metrics", input.RunID), input.RunID, r.controlNetworkID, metricsTargets, cfg.Pushgateway)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer rm.stop(filepath.Join(r.outputsDir, input.TestPlan, input.RunID, "metrics", "prometheus"))
+	}
+
+	// Capture the metrics of the host, if requested.
+	if cfg.HostMetrics {
+		var id string
+		id, err = startHostMetrics(ctx, cli, log, input.RunID, filepath.Join(r.outputsDir, input.TestPlan, input.RunID), hostMetricsInterval, cfg.HostMetricsPort)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer func() {
+			if err := docker.DeleteContainers(cli, log, []string{id}); err != nil {
+				log.Warnw("failed to delete the host metrics collector", "err", err)
+			}
+		}()
+	}
+
 	// ## Start the containers & log their outputs.
 	runCtx, cancelRun := context.WithCancel(ctx)
 
@@ -505,8 +942,19 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		cancelRun()
 	}()
 
+	// Record the timeline of the run, written once the instances are done.
+	tl := newTimeline()
+	defer func() {
+		r.writeTimeline(log, tl, filepath.Join(r.outputsDir, input.TestPlan, input.RunID), instances())
+	}()
+
+	if err = r.followNetworkChanges(runCtx, log, &template, tl, containers); err != nil {
+		log.Error(err)
+		return
+	}
+
 	// First we collect every container outcomes.
-	outcomesCollectIsCompleteCh, err := r.collectOutcomes(runCtx, result, &template)
+	outcomesCollectIsCompleteCh, expectOutcomes, err := r.collectOutcomes(runCtx, result, &template, bp.onGroupFailure)
 	if err != nil {
 		log.Error(err)
 		return
@@ -521,9 +969,19 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		started                   = make(chan testContainerInstance, len(containers))
 	)
 
-	for _, c := range containers {
+	if n := len(input.StartDelays); n > 0 {
+		log.Infow("staggering container starts", "over", input.StartDelays[n-1])
+	}
+
+	startedAt := time.Now()
+	for i, c := range containers {
 		c := c
+		delay := input.StartDelay(i)
 		f := func() error {
+			if err := waitStartDelay(startGroupCtx, startedAt, delay); err != nil {
+				return err
+			}
+
 			ratelimit <- struct{}{}
 			defer func() { <-ratelimit }()
 
@@ -532,6 +990,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 			err := cli.ContainerStart(startGroupCtx, c.containerID, types.ContainerStartOptions{})
 			if err == nil {
 				log.Debugw("started container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx)
+				tl.instanceStarted(c.groupID, c.groupIdx)
 				select {
 				case <-startGroupCtx.Done():
 				default:
@@ -547,6 +1006,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 	// Third we start the pretty printer
 	if !cfg.Background {
 		pretty := NewPrettyPrinter(ow)
+		defer pretty.Close()
 
 		// Tail the sidecar container logs and appends them to the pretty printer.
 		go func() {
@@ -564,15 +1024,7 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 				return
 			}
 
-			rstdout, wstdout := io.Pipe()
-			rstderr, wstderr := io.Pipe()
-			go func() {
-				_, _ = stdcopy.StdCopy(wstdout, wstderr, stream)
-				_ = wstdout.Close()
-				_ = wstderr.Close()
-			}()
-
-			pretty.Append("sidecar     ", rstdout, rstderr)
+			pretty.AppendMultiplexed("sidecar     ", stream)
 		}()
 
 		// Tail the other container logs and appends them to the pretty printer.
@@ -595,17 +1047,9 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 						return
 					}
 
-					rstdout, wstdout := io.Pipe()
-					rstderr, wstderr := io.Pipe()
-					go func() {
-						_, err := stdcopy.StdCopy(wstdout, wstderr, stream)
-						_ = wstdout.CloseWithError(err)
-						_ = wstderr.CloseWithError(err)
-					}()
-
 					// instance tag in output: << group[zero_padded_i] >> (container_id[0:6]), e.g. << miner[003] (a1b2c3) >>
 					tag := fmt.Sprintf("%s[%03d] (%s)", c.groupID, c.groupIdx, c.containerID[0:6])
-					pretty.Manage(tag, rstdout, rstderr)
+					pretty.ManageMultiplexed(tag, stream)
 				case <-runCtx.Done():
 					// Exit
 					return
@@ -621,11 +1065,126 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		return
 	}
 
-	// Finally, we're going to follow our containers until they are done
+	input.EnterPhase(task.PhaseRun)
 
-	for _, c := range containers {
-		c := c
-		f := func() error {
+	if delveContainer != nil {
+		advertiseDelve(ctx, cli, log, *delveContainer, delve.port)
+	}
+
+	// Capture the goroutines of the instances still running when the run
+	// ends, before they're torn down.
+	if !cfg.KeepContainers {
+		defer func() {
+			dumpRunningContainers(cli, log, result, input.RunID, instances())
+		}()
+	}
+
+	// Keep an eye on the outputs of every container, if a quota is set.
+	if quota != nil {
+		quotaCtx, cancelQuota := context.WithCancel(runCtx)
+		quotaDone := make(chan struct{})
+		go func() {
+			defer close(quotaDone)
+			r.enforceOutputsQuota(quotaCtx, cli, log, result, quota, containers)
+		}()
+		defer func() {
+			cancelQuota()
+			<-quotaDone
+		}()
+	}
+
+	// Cut the instances off the sync service every now and then, if asked.
+	if chaos != nil {
+		paused := r.addPauseGate(input.RunID)
+		defer r.deletePauseGate(input.RunID)
+
+		chaosCtx, cancelChaos := context.WithCancel(runCtx)
+		chaosDone := make(chan struct{})
+		go func() {
+			defer close(chaosDone)
+			chaos.run(chaosCtx, cli, log, tl, r.controlNetworkID, instances, paused)
+		}()
+		defer func() {
+			cancelChaos()
+			<-chaosDone
+		}()
+	}
+
+	// Capture the logs of the instances into their outputs, if they're
+	// capped.
+	var (
+		captures   sync.WaitGroup
+		truncated  truncatedLogs
+		captureCtx = ctx
+	)
+	if logsLimit > 0 {
+		var cancelCapture context.CancelFunc
+		captureCtx, cancelCapture = context.WithCancel(ctx)
+		defer func() {
+			// give the captures of the instances that exited a moment to
+			// drain; those of the instances still running are cut short.
+			done := make(chan struct{})
+			go func() {
+				captures.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				cancelCapture()
+				<-done
+			}
+			cancelCapture()
+			if err := truncated.write(filepath.Join(r.outputsDir, input.TestPlan, input.RunID)); err != nil {
+				log.Warnw("failed to write the truncated logs", "err", err)
+			}
+		}()
+	}
+
+	// Registered last, so that it runs before the instances are torn down.
+	defer input.EnterPhase(task.PhaseCleanup)
+
+	// Let the groups of the run be resized while it's in progress.
+	live := &liveDockerRun{
+		groups:         make(map[string]*api.RunGroup, len(input.Groups)),
+		sizes:          make(map[string]int, len(input.Groups)),
+		total:          input.TotalInstances,
+		removed:        make(map[string]struct{}),
+		replaced:       make(map[string]struct{}),
+		cli:            cli,
+		template:       &template,
+		groupEnv:       groupEnv,
+		createInstance: createInstance,
+		containers:     instances,
+		expect:         expectOutcomes,
+	}
+	for _, g := range input.Groups {
+		live.groups[g.ID] = g
+		live.sizes[g.ID] = g.Instances
+	}
+
+	// Finally, we're going to follow our containers until they are done.
+	// The instances added by scaling are followed outside of runGroup,
+	// which can't grow once it's being waited on, until the run can't be
+	// resized anymore.
+	var scaled sync.WaitGroup
+
+	// capture starts capturing the logs of an instance, before it's
+	// followed, so that the capture is added before the captures are waited
+	// for.
+	capture := func(c testContainerInstance) {
+		if logsLimit == 0 {
+			return
+		}
+		captures.Add(1)
+		go func() {
+			defer captures.Done()
+			captureInstanceLogs(captureCtx, cli, log, c, logsLimit, &truncated)
+		}()
+	}
+
+	follow := func(groupCtx context.Context, c testContainerInstance) func() error {
+		return func() error {
 			log.Infow("waiting for container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx)
 
 			statusCh, errCh := cli.ContainerWait(runCtx, c.containerID, container.WaitConditionNotRunning)
@@ -638,15 +1197,56 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 				}
 				return nil
 			case status := <-statusCh:
+				if live.wasRemoved(c.containerID) {
+					log.Infow("container removed", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx)
+					return nil
+				}
+
+				// killed by churn; its replacement is followed instead.
+				if live.wasReplaced(c.containerID) {
+					log.Infow("container replaced", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx)
+					return nil
+				}
+
 				log.Infow("container exited", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "status", status.StatusCode)
+				tl.instanceExited(c.groupID, c.groupIdx, status.StatusCode)
+				if status.StatusCode != 0 {
+					captureCrash(runCtx, cli, log, result, c, status.StatusCode)
+					bp.onInstanceFailure(c, status.StatusCode)
+				}
 				return nil
-			case <-runGroupCtx.Done(): // race with the group
-				log.Infow("container group exited", "err", runGroupCtx.Err())
+			case <-groupCtx.Done(): // race with the group
+				log.Infow("container group exited", "err", groupCtx.Err())
 				return nil
 			}
 		}
-		runGroup.Go(f)
 	}
+	for _, c := range containers {
+		capture(c)
+		runGroup.Go(follow(runGroupCtx, c))
+	}
+
+	live.start = func(ctx context.Context, c testContainerInstance) error {
+		if err := cli.ContainerStart(ctx, c.containerID, types.ContainerStartOptions{}); err != nil {
+			return err
+		}
+		tl.instanceStarted(c.groupID, c.groupIdx)
+		select {
+		case started <- c:
+		default:
+		}
+		capture(c)
+		scaled.Add(1)
+		go func() {
+			defer scaled.Done()
+			if err := follow(runCtx, c)(); err != nil {
+				log.Warnw("failed to follow container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "err", err)
+			}
+		}()
+		return nil
+	}
+	r.registerRun(input.RunID, live)
+	defer r.unregisterRun(input.RunID)
 
 	// When we're here, our containers are started, the outcomes are being collected.
 	// We wait until either:
@@ -656,9 +1256,12 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 	containersAreCompleteCh := make(chan bool)
 	outcomesCollectTimeout := make(chan bool)
 
-	// Wait for the containers
+	// Wait for the containers, including the ones added by scaling up to
+	// when the run stops being resizable.
 	go func() {
 		err = runGroup.Wait()
+		live.finish()
+		scaled.Wait()
 		containersAreCompleteCh <- true
 	}()
 
@@ -675,7 +1278,9 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		select {
 		case <-containersAreCompleteCh:
 			log.Infow("all containers are complete")
+			live.finish()
 			waitingForContainers = false
+			input.EnterPhase(task.PhaseCollect)
 			go startOutcomesCollectTimeout()
 		case <-outcomesCollectIsCompleteCh:
 			log.Infow("all outcomes are complete")
@@ -683,6 +1288,9 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 		case <-outcomesCollectTimeout:
 			log.Infow("we timeout'd waiting for outcomes")
 			waitingForOutcomes = false
+		case reason := <-bp.hits():
+			bp.suspend(ctx, cli, log, input.RunID, instances(), reason)
+			return
 		case <-runCtx.Done():
 			log.Infow("the test run ended early", "err", runCtx.Err())
 			return
@@ -692,6 +1300,59 @@ func (r *LocalDockerRunner) Run(ctx context.Context, input *api.RunInput, ow *rp
 	return
 }
 
+// enforceOutputsQuota periodically measures the outputs directory of every
+// container, and applies the quota policy to the ones exceeding it. It returns
+// when the context is done.
+func (r *LocalDockerRunner) enforceOutputsQuota(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, result *Result, quota *outputsQuota, containers []testContainerInstance) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	stopped := make(map[string]struct{})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, c := range containers {
+			if _, ok := stopped[c.containerID]; ok {
+				continue
+			}
+
+			size, err := dirSize(c.outputsDir)
+			if err != nil {
+				log.Warnw("failed to measure outputs", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "error", err)
+				continue
+			}
+			if size <= quota.limit {
+				continue
+			}
+
+			switch quota.policy {
+			case OutputsQuotaPolicyRotate:
+				freed, err := rotateOldest(c.outputsDir, quota.limit)
+				if err != nil {
+					log.Warnw("failed to rotate outputs", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "error", err)
+					continue
+				}
+				log.Warnw("outputs quota exceeded; truncated oldest files", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "size", size, "freed", freed)
+
+			default:
+				log.Errorw("outputs quota exceeded; stopping container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "size", size, "quota", quota.limit)
+				stopped[c.containerID] = struct{}{}
+				result.Journal.Events[c.containerID] = fmt.Sprintf("group<%s> instance<%d> stopped: outputs size %d exceeds quota %d", c.groupID, c.groupIdx, size, quota.limit)
+
+				timeout := 10 * time.Second
+				if err := cli.ContainerStop(ctx, c.containerID, &timeout); err != nil {
+					log.Warnw("failed to stop container", "id", c.containerID, "error", err)
+				}
+			}
+		}
+	}
+}
+
 func newDataNetwork(ctx context.Context, cli *client.Client, rw *rpc.OutputWriter, env *api.RunInput, name string) (id string, subnet *net.IPNet, err error) {
 	// Find a free network.
 	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
@@ -736,7 +1397,7 @@ func (r *LocalDockerRunner) CollectOutputs(ctx context.Context, input *api.Colle
 	dir := r.outputsDir
 	r.lk.RUnlock()
 
-	return gzipRunOutputs(ctx, dir, input, ow)
+	return archiveRunOutputs(ctx, dir, input, ow)
 }
 
 // attachContainerToNetwork attaches the provided container to the specified
@@ -747,13 +1408,20 @@ func attachContainerToNetwork(ctx context.Context, cli *client.Client, container
 	return cli.NetworkConnect(ctx, networkID, containerID, nil)
 }
 
-// nolint this function is unused, but it may come in handy.
+// detachContainerFromNetwork detaches the provided container from the
+// specified network.
 func detachContainerFromNetwork(ctx context.Context, cli *client.Client, containerID string, networkID string) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	return cli.NetworkDisconnect(ctx, networkID, containerID, true)
 }
 
+// RunOutputsDir returns the directory holding the outputs of a run, under
+// the outputs directory of the runner.
+func (*LocalDockerRunner) RunOutputsDir(cfg *config.EnvConfig, plan, runID string) string {
+	return filepath.Join(cfg.Dirs().Outputs(), "local_docker", plan, runID)
+}
+
 func (*LocalDockerRunner) ID() string {
 	return "local:docker"
 }
@@ -796,6 +1464,11 @@ func (*LocalDockerRunner) TerminateAll(ctx context.Context, ow *rpc.OutputWriter
 	planOpts.Filters = filters.NewArgs()
 	planOpts.Filters.Add("label", "testground.purpose=plan")
 
+	// Build query for the metrics stacks dedicated to runs.
+	metricsOpts := types.ContainerListOptions{}
+	metricsOpts.Filters = filters.NewArgs()
+	metricsOpts.Filters.Add("label", "testground.purpose=metrics")
+
 	infracontainers, err := cli.ContainerList(ctx, infraOpts)
 	if err != nil {
 		return fmt.Errorf("failed to list infrastructure containers: %w", err)
@@ -804,6 +1477,10 @@ func (*LocalDockerRunner) TerminateAll(ctx context.Context, ow *rpc.OutputWriter
 	if err != nil {
 		return fmt.Errorf("failed to list test plan containers: %w", err)
 	}
+	metricscontainers, err := cli.ContainerList(ctx, metricsOpts)
+	if err != nil {
+		return fmt.Errorf("failed to list metrics containers: %w", err)
+	}
 
 	containers := make([]string, 0, len(infracontainers)+len(plancontainers))
 	for _, container := range infracontainers {
@@ -812,6 +1489,9 @@ func (*LocalDockerRunner) TerminateAll(ctx context.Context, ow *rpc.OutputWriter
 	for _, container := range plancontainers {
 		containers = append(containers, container.ID)
 	}
+	for _, container := range metricscontainers {
+		containers = append(containers, container.ID)
+	}
 
 	err = docker.DeleteContainers(cli, ow, containers)
 	if err != nil {
@@ -821,3 +1501,115 @@ func (*LocalDockerRunner) TerminateAll(ctx context.Context, ow *rpc.OutputWriter
 	ow.Info("to delete networks and images, you may want to run `docker system prune`")
 	return nil
 }
+
+// CleanupRun deletes the containers and networks of a run.
+func (*LocalDockerRunner) CleanupRun(ctx context.Context, runID string, ow *rpc.OutputWriter) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	byRun := filters.NewArgs(filters.Arg("label", "testground.run_id="+runID))
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: byRun})
+	if err != nil {
+		return fmt.Errorf("failed to list the containers of run %s: %w", runID, err)
+	}
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	if len(ids) > 0 {
+		if err := docker.DeleteContainers(cli, ow, ids); err != nil {
+			return err
+		}
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: byRun})
+	if err != nil {
+		return fmt.Errorf("failed to list the networks of run %s: %w", runID, err)
+	}
+	for _, n := range networks {
+		if err := cli.NetworkRemove(ctx, n.ID); err != nil {
+			ow.Warnw("failed to remove network", "network", n.Name, "err", err)
+		}
+	}
+
+	removeRunVolumes(ctx, cli, ow, runID)
+	return nil
+}
+
+// dockerMounts converts the mounts of a group into the mounts of one of its
+// instances. Volume mounts are backed by a volume private to the instance,
+// labelled with the run, so that they can be removed with it.
+func dockerMounts(runID string, groupID string, idx int, mounts []api.Mount) []mount.Mount {
+	res := make([]mount.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		dm := mount.Mount{
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		}
+		switch m.Type {
+		case api.MountTypeVolume:
+			dm.Type = mount.TypeVolume
+			dm.Source = mountVolumeName(runID, groupID, idx, m.Source)
+			dm.VolumeOptions = &mount.VolumeOptions{
+				Labels: map[string]string{
+					"testground.purpose":  "plan",
+					"testground.run_id":   runID,
+					"testground.group_id": groupID,
+					"testground.instance": strconv.Itoa(idx),
+				},
+			}
+		case api.MountTypeBind:
+			dm.Type = mount.TypeBind
+			dm.Source = m.Source
+		case api.MountTypeTmpfs:
+			// the size was validated along with the composition.
+			size, _ := m.SizeBytes()
+			dm.Type = mount.TypeTmpfs
+			dm.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: size}
+		}
+		res = append(res, dm)
+	}
+	return res
+}
+
+// dockerHostName returns the name of the docker host, or "localhost" if it
+// can't be known.
+func dockerHostName(ctx context.Context, cli *client.Client, log *rpc.OutputWriter) string {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		log.Warnw("failed to get the name of the docker host", "err", err)
+		return "localhost"
+	}
+	if info.Name == "" {
+		return "localhost"
+	}
+	return info.Name
+}
+
+// dockerPlacement returns the placement of the containers of a run, on the
+// docker host.
+func dockerPlacement(host string, containers []testContainerInstance) []api.InstancePlacement {
+	placement := make([]api.InstancePlacement, 0, len(containers))
+	for _, c := range containers {
+		placement = append(placement, api.InstancePlacement{Group: c.groupID, Instance: c.groupIdx, Host: host})
+	}
+	return placement
+}
+
+// removeRunVolumes removes the volumes backing the volume mounts of a run.
+func removeRunVolumes(ctx context.Context, cli *client.Client, ow *rpc.OutputWriter, runID string) {
+	volumes, err := cli.VolumeList(ctx, filters.NewArgs(filters.Arg("label", "testground.run_id="+runID)))
+	if err != nil {
+		ow.Warnw("failed to list the volumes of run", "run_id", runID, "err", err)
+		return
+	}
+	for _, v := range volumes.Volumes {
+		if err := cli.VolumeRemove(ctx, v.Name, true); err != nil {
+			ow.Warnw("failed to remove volume", "volume", v.Name, "err", err)
+		}
+	}
+}
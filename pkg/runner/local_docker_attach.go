@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// EnvTestAttachedRun is the environment variable through which the instances
+// of a run attached to another are told the ID of that run, to reach its
+// instances through the sync service.
+const EnvTestAttachedRun = "TEST_ATTACHED_RUN"
+
+var _ api.Attacher = (*LocalDockerRunner)(nil)
+
+// CheckAttach checks that the data network of a run is still there to attach
+// to.
+func (*LocalDockerRunner) CheckAttach(ctx context.Context, runID string) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	_, _, err = findDataNetwork(ctx, cli, runID, "default")
+	return err
+}
+
+// findDataNetwork returns the data network of an ongoing run, and its subnet.
+func findDataNetwork(ctx context.Context, cli *client.Client, runID string, name string) (id string, subnet *net.IPNet, err error) {
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "testground.run_id="+runID),
+			filters.Arg("label", "testground.name="+name),
+		),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(networks) == 0 {
+		return "", nil, fmt.Errorf("run %s has no %s data network", runID, name)
+	}
+
+	nw := networks[0]
+	if len(nw.IPAM.Config) == 0 {
+		return "", nil, fmt.Errorf("data network %s has no subnet", nw.Name)
+	}
+	_, subnet, err = net.ParseCIDR(nw.IPAM.Config[0].Subnet)
+	if err != nil {
+		return "", nil, fmt.Errorf("data network %s has an invalid subnet: %w", nw.Name, err)
+	}
+	return nw.ID, subnet, nil
+}
+
+// attachedSubnetOnes is the prefix length of the blocks of the data network
+// of a run reserved to the runs attached to it. The first block is left to
+// the run itself, whose instances derive their data addresses from the start
+// of the subnet.
+const attachedSubnetOnes = 20
+
+// reserveAttachedSubnet reserves a block of the data network of a run for a
+// run attaching to it, so that the data addresses its instances derive from
+// their sequence numbers don't collide with those of the instances already
+// on the network. Blocks holding addresses of containers on the network, or
+// reserved by other runs attaching, are skipped. The block must be released
+// with releaseAttachedSubnet once the run is over.
+func (r *LocalDockerRunner) reserveAttachedSubnet(ctx context.Context, cli *client.Client, networkID string, subnet *net.IPNet) (*net.IPNet, error) {
+	nw, err := cli.NetworkInspect(ctx, networkID, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var used []net.IP
+	for _, ep := range nw.Containers {
+		if ip, _, err := net.ParseCIDR(ep.IPv4Address); err == nil {
+			used = append(used, ip)
+		}
+	}
+
+	r.attachedLk.Lock()
+	defer r.attachedLk.Unlock()
+
+	block, err := freeAttachedSubnet(subnet, used, r.attachedSubnets)
+	if err != nil {
+		return nil, err
+	}
+	if r.attachedSubnets == nil {
+		r.attachedSubnets = make(map[string]struct{})
+	}
+	r.attachedSubnets[block.String()] = struct{}{}
+	return block, nil
+}
+
+// releaseAttachedSubnet releases a block reserved by reserveAttachedSubnet.
+func (r *LocalDockerRunner) releaseAttachedSubnet(block *net.IPNet) {
+	r.attachedLk.Lock()
+	delete(r.attachedSubnets, block.String())
+	r.attachedLk.Unlock()
+}
+
+// freeAttachedSubnet returns the first block of subnet, but the first one,
+// that holds none of the used addresses and isn't reserved.
+func freeAttachedSubnet(subnet *net.IPNet, used []net.IP, reserved map[string]struct{}) (*net.IPNet, error) {
+	ones, bits := subnet.Mask.Size()
+	if bits != 32 || ones >= attachedSubnetOnes {
+		return nil, fmt.Errorf("data network %s is too small to attach to", subnet)
+	}
+
+	base := subnet.IP.To4()
+	size := uint32(1) << (32 - attachedSubnetOnes)
+	mask := net.CIDRMask(attachedSubnetOnes, 32)
+
+	for i := uint32(1); i < 1<<(attachedSubnetOnes-ones); i++ {
+		start := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+		start += i * size
+		block := &net.IPNet{IP: net.IPv4(byte(start>>24), byte(start>>16), byte(start>>8), byte(start)).To4(), Mask: mask}
+
+		if _, ok := reserved[block.String()]; ok {
+			continue
+		}
+		free := true
+		for _, ip := range used {
+			if block.Contains(ip) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("data network %s has no address range left for attached runs", subnet)
+}
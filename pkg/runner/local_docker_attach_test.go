@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"net"
+	"testing"
+)
+
+func TestFreeAttachedSubnet(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("16.3.0.0/16")
+
+	// the first block is left to the run attached to.
+	used := []net.IP{net.ParseIP("16.3.0.2"), net.ParseIP("16.3.1.1")}
+	block, err := freeAttachedSubnet(subnet, used, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.String() != "16.3.16.0/20" {
+		t.Errorf("got block %s, want 16.3.16.0/20", block)
+	}
+
+	// blocks in use or reserved are skipped.
+	used = append(used, net.ParseIP("16.3.17.1"))
+	block, err = freeAttachedSubnet(subnet, used, map[string]struct{}{"16.3.32.0/20": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.String() != "16.3.48.0/20" {
+		t.Errorf("got block %s, want 16.3.48.0/20", block)
+	}
+
+	_, small, _ := net.ParseCIDR("16.3.0.0/24")
+	if _, err := freeAttachedSubnet(small, nil, nil); err == nil {
+		t.Error("expected an error for a network too small to attach to")
+	}
+}
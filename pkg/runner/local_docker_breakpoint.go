@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// failureBreakpoint suspends a run at the first failure of one of its
+// instances, like a breakpoint: every container still running is frozen, and
+// the teardown of the run is held off, so that the instances can be inspected
+// post mortem. A nil *failureBreakpoint is disabled.
+type failureBreakpoint struct {
+	hold time.Duration
+
+	once sync.Once
+	hit  chan string
+}
+
+func newFailureBreakpoint(hold string) (*failureBreakpoint, error) {
+	d, err := time.ParseDuration(hold)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid pause_on_failure duration: %q", hold)
+	}
+	return &failureBreakpoint{hold: d, hit: make(chan string, 1)}, nil
+}
+
+// hits returns the channel the reason of the failure is delivered on, once.
+func (bp *failureBreakpoint) hits() <-chan string {
+	if bp == nil {
+		return nil
+	}
+	return bp.hit
+}
+
+func (bp *failureBreakpoint) trigger(reason string) {
+	if bp == nil {
+		return
+	}
+	bp.once.Do(func() { bp.hit <- reason })
+}
+
+// onGroupFailure triggers the breakpoint on a failure reported through the
+// sync service, which only identifies the group of the instance.
+func (bp *failureBreakpoint) onGroupFailure(groupID string) {
+	bp.trigger(fmt.Sprintf("an instance of group %s reported a failure", groupID))
+}
+
+// onInstanceFailure triggers the breakpoint on an instance exiting with an
+// error, e.g. after a panic.
+func (bp *failureBreakpoint) onInstanceFailure(c testContainerInstance, status int64) {
+	bp.trigger(fmt.Sprintf("instance %s[%d] exited with status %d", c.groupID, c.groupIdx, status))
+}
+
+// suspend freezes the containers of the run, and blocks until the pause
+// elapses or ctx is done.
+func (bp *failureBreakpoint) suspend(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, runID string, containers []testContainerInstance, reason string) {
+	var paused []testContainerInstance
+	for _, c := range containers {
+		info, err := cli.ContainerInspect(ctx, c.containerID)
+		if err != nil || !info.State.Running || info.State.Paused {
+			continue
+		}
+		if err := cli.ContainerPause(ctx, c.containerID); err != nil {
+			log.Warnw("failed to pause container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "err", err)
+			continue
+		}
+		paused = append(paused, c)
+	}
+
+	until := time.Now().Add(bp.hold)
+	log.Warnw("run paused on failure; cancel the task to tear it down earlier", "reason", reason, "paused", len(paused), "until", until.Format(time.RFC3339))
+	for _, c := range paused {
+		log.Warnf("inspect %s[%d] with: testground debug --run %s --group %s --instance %d", c.groupID, c.groupIdx, runID, c.groupID, c.groupIdx)
+	}
+
+	select {
+	case <-time.After(bp.hold):
+		log.Infow("pause on failure elapsed; tearing down the run")
+	case <-ctx.Done():
+		log.Infow("pause on failure ended", "err", ctx.Err())
+	}
+}
@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureBreakpoint(t *testing.T) {
+	_, err := newFailureBreakpoint("soon")
+	require.Error(t, err)
+	_, err = newFailureBreakpoint("0s")
+	require.Error(t, err)
+
+	bp, err := newFailureBreakpoint("30m")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, bp.hold)
+
+	// only the first failure is reported, and later ones don't block.
+	bp.onInstanceFailure(testContainerInstance{groupID: "miners", groupIdx: 3}, 2)
+	bp.onGroupFailure("miners")
+	require.Equal(t, "instance miners[3] exited with status 2", <-bp.hits())
+
+	select {
+	case reason := <-bp.hits():
+		t.Fatalf("unexpected second hit: %s", reason)
+	default:
+	}
+}
+
+func TestFailureBreakpointDisabled(t *testing.T) {
+	var bp *failureBreakpoint
+	bp.onGroupFailure("miners")
+	require.Nil(t, bp.hits())
+}
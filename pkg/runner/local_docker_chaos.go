@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// defaultInfraOutage is how long instances are cut off from the sync service
+// and the control network by infrastructure chaos, unless configured
+// otherwise.
+const defaultInfraOutage = 5 * time.Second
+
+// infraChaos injects outages into the infrastructure the instances of a run
+// depend on, i.e. the sync service and the control network, to exercise
+// their reconnection logic. It cuts the instances off the control network
+// altogether; it doesn't slow it down. The data network is left alone.
+type infraChaos struct {
+	// every is the time between outages.
+	every time.Duration
+	// outage is how long each outage lasts.
+	outage time.Duration
+}
+
+// parseInfraChaos parses the infrastructure chaos settings of a run. It
+// returns nil if infrastructure chaos is disabled.
+func parseInfraChaos(every, outage string) (*infraChaos, error) {
+	if every == "" {
+		if outage != "" {
+			return nil, fmt.Errorf("infra chaos outage is set without an interval")
+		}
+		return nil, nil
+	}
+
+	c := &infraChaos{outage: defaultInfraOutage}
+	var err error
+	if c.every, err = time.ParseDuration(every); err != nil || c.every <= 0 {
+		return nil, fmt.Errorf("invalid infra chaos interval %q", every)
+	}
+	if outage != "" {
+		if c.outage, err = time.ParseDuration(outage); err != nil || c.outage <= 0 {
+			return nil, fmt.Errorf("invalid infra chaos outage %q", outage)
+		}
+	}
+	if c.outage >= c.every {
+		return nil, fmt.Errorf("infra chaos outage %s must be shorter than its interval %s", c.outage, c.every)
+	}
+	return c, nil
+}
+
+// run cuts the instances of a run off the control network, and thus off the
+// sync service, every interval, for the duration of an outage, until the
+// context is done. Outages are recorded in the timeline of the run. No
+// outages are injected while the run is paused.
+func (c *infraChaos) run(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, tl *timeline, network string, containers func() []testContainerInstance, paused *pauseGate) {
+	ticker := time.NewTicker(c.every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// the interval starts over once the run is resumed.
+		if paused.wait(ctx) {
+			ticker.Reset(c.every)
+			continue
+		}
+
+		cut := c.disconnect(ctx, cli, log, network, containers())
+		tl.add(TimelineEntry{
+			Time:    time.Now(),
+			Source:  TimelineSourceRunner,
+			Event:   TimelineEventInfraOutage,
+			Message: fmt.Sprintf("%d instances cut off the control network for %s", len(cut), c.outage),
+		})
+		log.Infow("infra chaos: control network outage", "instances", len(cut), "duration", c.outage)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.outage):
+		}
+
+		// reconnect even if the run is ending, so that outcomes can be
+		// collected.
+		c.reconnect(cli, log, network, cut)
+		tl.add(TimelineEntry{
+			Time:    time.Now(),
+			Source:  TimelineSourceRunner,
+			Event:   TimelineEventInfraRecovered,
+			Message: fmt.Sprintf("%d instances reconnected to the control network", len(cut)),
+		})
+	}
+}
+
+// disconnect detaches containers from the control network, and returns those
+// that were detached.
+func (c *infraChaos) disconnect(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, network string, containers []testContainerInstance) []testContainerInstance {
+	var (
+		lk  sync.Mutex
+		cut []testContainerInstance
+		wg  sync.WaitGroup
+	)
+	for _, ci := range containers {
+		wg.Add(1)
+		go func(ci testContainerInstance) {
+			defer wg.Done()
+			// instances that are done can't be detached; skip them.
+			if err := detachContainerFromNetwork(ctx, cli, ci.containerID, network); err != nil {
+				log.Debugw("infra chaos: failed to detach instance", "group", ci.groupID, "instance", ci.groupIdx, "err", err)
+				return
+			}
+			lk.Lock()
+			cut = append(cut, ci)
+			lk.Unlock()
+		}(ci)
+	}
+	wg.Wait()
+	return cut
+}
+
+func (c *infraChaos) reconnect(cli *client.Client, log *rpc.OutputWriter, network string, containers []testContainerInstance) {
+	var wg sync.WaitGroup
+	for _, ci := range containers {
+		wg.Add(1)
+		go func(ci testContainerInstance) {
+			defer wg.Done()
+			if err := attachContainerToNetwork(context.Background(), cli, ci.containerID, network); err != nil {
+				log.Warnw("infra chaos: failed to reattach instance", "group", ci.groupID, "instance", ci.groupIdx, "err", err)
+			}
+		}(ci)
+	}
+	wg.Wait()
+}
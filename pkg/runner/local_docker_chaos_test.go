@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInfraChaos(t *testing.T) {
+	c, err := parseInfraChaos("", "")
+	if err != nil || c != nil {
+		t.Fatalf("expected chaos to be disabled, got %v, %v", c, err)
+	}
+
+	c, err = parseInfraChaos("1m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.every != time.Minute || c.outage != defaultInfraOutage {
+		t.Errorf("unexpected chaos: %+v", c)
+	}
+
+	c, err = parseInfraChaos("30s", "10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.every != 30*time.Second || c.outage != 10*time.Second {
+		t.Errorf("unexpected chaos: %+v", c)
+	}
+
+	for _, in := range [][2]string{{"", "5s"}, {"soon", ""}, {"-1m", ""}, {"1m", "0s"}, {"10s", "10s"}} {
+		if _, err := parseInfraChaos(in[0], in[1]); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
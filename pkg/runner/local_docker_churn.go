@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+var _ api.Churner = (*LocalDockerRunner)(nil)
+
+// errInstanceNotRunning is returned when replacing an instance whose container
+// isn't running anymore.
+var errInstanceNotRunning = errors.New("instance is not running")
+
+// ReplaceInstances kills the containers of instances of a run, and replaces
+// them by fresh containers with the same sequence numbers. The killed
+// containers are recorded as replaced, so that Run doesn't count them as
+// exited, and the fresh ones are followed like the instances added by
+// scaling.
+func (r *LocalDockerRunner) ReplaceInstances(ctx context.Context, in *api.ChurnInput, ow *rpc.OutputWriter) error {
+	r.liveLk.Lock()
+	live, ok := r.live[in.RunID]
+	r.liveLk.Unlock()
+	if !ok {
+		return fmt.Errorf("run %s is not in progress", in.RunID)
+	}
+
+	for _, i := range in.Instances {
+		switch err := live.replace(ctx, in.Group, i, ow); {
+		case errors.Is(err, errInstanceNotRunning):
+			ow.Warnw("instance to replace is not running", "group", in.Group, "instance", i)
+		case err != nil:
+			return fmt.Errorf("failed to replace instance %s[%d]: %w", in.Group, i, err)
+		}
+	}
+	return nil
+}
+
+// replace kills the container of the i-th instance of a group, and starts a
+// fresh one in its place.
+func (l *liveDockerRun) replace(ctx context.Context, group string, i int, ow *rpc.OutputWriter) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.finished {
+		return errors.New("run is finishing")
+	}
+	g, ok := l.groups[group]
+	if !ok {
+		return fmt.Errorf("unknown group: %s", group)
+	}
+	if i >= l.sizes[group] {
+		return errInstanceNotRunning
+	}
+
+	// the current container of the instance is the last one created for it.
+	var current *testContainerInstance
+	for _, c := range l.containers() {
+		if c.groupID == group && c.groupIdx == i {
+			c := c
+			current = &c
+		}
+	}
+	if current == nil {
+		return errInstanceNotRunning
+	}
+	if info, err := l.cli.ContainerInspect(ctx, current.containerID); err != nil {
+		return err
+	} else if info.State == nil || !info.State.Running {
+		return errInstanceNotRunning
+	}
+
+	// recorded before the kill, so that Run can't see the container exit
+	// before knowing it was replaced.
+	l.replaced[current.containerID] = struct{}{}
+	if err := l.cli.ContainerKill(ctx, current.containerID, "SIGKILL"); err != nil {
+		delete(l.replaced, current.containerID)
+		return err
+	}
+
+	l.generation++
+	runenv, env := l.groupEnv(g, l.sizes[group], l.total)
+	name := fmt.Sprintf("tg-%s-%s-%s-%s-%d-%d", runenv.TestPlan, runenv.TestCase, runenv.TestRun, group, i, l.generation)
+	c, err := l.createInstance(g, runenv, env, i, name)
+	if err == nil {
+		err = l.start(ctx, c)
+	}
+	if err != nil {
+		// the killed instance won't report its outcome, nor its replacement.
+		l.expect(group, -1)
+		return err
+	}
+	ow.Infow("replaced instance", "group", group, "instance", i, "container", c.containerID)
+	return nil
+}
+
+// wasReplaced returns whether a container is that of an instance replaced by
+// churn.
+func (l *liveDockerRun) wasReplaced(id string) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	_, ok := l.replaced[id]
+	return ok
+}
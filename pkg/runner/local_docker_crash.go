@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+const (
+	// crashStderrTail is the number of lines of stderr searched for dumps.
+	crashStderrTail = "20000"
+	// goroutineDumpTimeout is how long instances are given to print their
+	// goroutines after SIGQUIT, before they're killed.
+	goroutineDumpTimeout = 10 * time.Second
+)
+
+// containerStderr returns the tail of the stderr of a container.
+func containerStderr(ctx context.Context, cli *client.Client, id string) ([]byte, error) {
+	rc, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{ShowStderr: true, Tail: crashStderrTail})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var stderr bytes.Buffer
+	_, err = stdcopy.StdCopy(ioutil.Discard, &stderr, rc)
+	return stderr.Bytes(), err
+}
+
+// captureCrash captures the trace of an instance that exited with an error
+// into its outputs, and records the crash in the result.
+func captureCrash(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, result *Result, c testContainerInstance, status int64) {
+	crash := InstanceCrash{Group: c.groupID, Instance: c.groupIdx, Reason: CrashReasonExit, Status: status}
+
+	stderr, err := containerStderr(ctx, cli, c.containerID)
+	if err != nil {
+		log.Warnw("failed to read the stderr of crashed container", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "err", err)
+	}
+	if trace := panicTrace(stderr); trace != nil {
+		crash.Reason = CrashReasonPanic
+		if err := crash.writeDump(c.outputsDir, CrashTraceFile, trace); err != nil {
+			log.Warnw("failed to write crash trace", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "err", err)
+		}
+	}
+	crash.findCoreDumps(c.outputsDir)
+
+	log.Warnw("instance crashed", "group", c.groupID, "group_index", c.groupIdx, "reason", crash.Reason, "status", status, "dumps", crash.Dumps)
+	result.addCrash(crash)
+}
+
+// dumpRunningContainers sends SIGQUIT to the containers of a run that are
+// still running, so that the Go runtime prints their goroutines before they
+// exit, and captures the dumps into their outputs. Containers frozen by a
+// pause on failure are thawed first.
+func dumpRunningContainers(cli *client.Client, log *rpc.OutputWriter, result *Result, runID string, containers []testContainerInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), goroutineDumpTimeout+30*time.Second)
+	defer cancel()
+
+	list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "testground.run_id="+runID)),
+	})
+	if err != nil {
+		log.Warnw("failed to list the containers of the run", "err", err)
+		return
+	}
+
+	states := make(map[string]string, len(list))
+	for _, c := range list {
+		if c.State == "running" || c.State == "paused" {
+			states[c.ID] = c.State
+		}
+	}
+	if len(states) == 0 {
+		return
+	}
+	log.Warnw("capturing the goroutines of instances still running before killing them", "instances", len(states))
+
+	var (
+		wg       sync.WaitGroup
+		deadline = time.Now().Add(goroutineDumpTimeout)
+	)
+	for _, c := range containers {
+		state, ok := states[c.containerID]
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c testContainerInstance, paused bool) {
+			defer wg.Done()
+
+			if paused {
+				if err := cli.ContainerUnpause(ctx, c.containerID); err != nil {
+					return
+				}
+			}
+			if err := cli.ContainerKill(ctx, c.containerID, "SIGQUIT"); err != nil {
+				return
+			}
+
+			waitCtx, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+			statusCh, errCh := cli.ContainerWait(waitCtx, c.containerID, container.WaitConditionNotRunning)
+			select {
+			case <-statusCh:
+			case <-errCh:
+			}
+
+			crash := InstanceCrash{Group: c.groupID, Instance: c.groupIdx, Reason: CrashReasonKilled}
+			stderr, err := containerStderr(ctx, cli, c.containerID)
+			if err == nil {
+				err = crash.writeDump(c.outputsDir, GoroutineDumpFile, goroutineDump(stderr))
+			}
+			if err != nil {
+				log.Warnw("failed to capture goroutine dump", "id", c.containerID, "group", c.groupID, "group_index", c.groupIdx, "err", err)
+			}
+			crash.findCoreDumps(c.outputsDir)
+			result.addCrash(crash)
+		}(c, state == "paused")
+	}
+	wg.Wait()
+}
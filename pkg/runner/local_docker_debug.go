@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/api"
+	tgclient "github.com/testground/testground/pkg/client"
+)
+
+// debugShell is the shell started in instances; bash is preferred when the
+// image has it.
+var debugShell = []string{"sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"}
+
+// DebugShell starts a shell in the container of an instance, with a TTY.
+func (r *LocalDockerRunner) DebugShell(ctx context.Context, in *api.DebugInput) (io.ReadWriteCloser, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	info, err := debugContainer(ctx, cli, in)
+	if err != nil {
+		return nil, err
+	}
+
+	exec, err := cli.ContainerExecCreate(ctx, info.ID, types.ExecConfig{
+		Cmd:          debugShell,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	hr, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+
+	if in.Rows > 0 && in.Cols > 0 {
+		// the terminal size is cosmetic; a failure to set it is not fatal.
+		_ = cli.ContainerExecResize(ctx, exec.ID, types.ResizeOptions{Height: in.Rows, Width: in.Cols})
+	}
+
+	return tgclient.BufferedConn(hr.Conn, hr.Reader), nil
+}
+
+// DebugDial connects to a port of an instance, through its address on the
+// control network.
+func (r *LocalDockerRunner) DebugDial(ctx context.Context, in *api.DebugInput, port int) (net.Conn, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	info, err := debugContainer(ctx, cli, in)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, ok := info.NetworkSettings.Networks["testground-control"]
+	if !ok || settings.IPAddress == "" {
+		return nil, fmt.Errorf("container %s has no address on the control network", info.Name)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(settings.IPAddress, strconv.Itoa(port)))
+}
+
+// debugContainer returns the running container of the instance to debug. A
+// container frozen by a pause on failure is thawed, so that it can be
+// attached to.
+func debugContainer(ctx context.Context, cli *client.Client, in *api.DebugInput) (types.ContainerJSON, error) {
+	args := filters.NewArgs(
+		filters.Arg("label", "testground.run_id="+in.RunID),
+		filters.Arg("label", "testground.instance="+strconv.Itoa(in.Instance)),
+	)
+	if in.GroupID != "" {
+		args.Add("label", "testground.group_id="+in.GroupID)
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{Filters: args})
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	switch len(containers) {
+	case 0:
+		return types.ContainerJSON{}, fmt.Errorf("no running container for instance %d of run %s", in.Instance, in.RunID)
+	case 1:
+	default:
+		return types.ContainerJSON{}, fmt.Errorf("instance %d of run %s is ambiguous; specify its group", in.Instance, in.RunID)
+	}
+
+	info, err := cli.ContainerInspect(ctx, containers[0].ID)
+	if err != nil {
+		return info, err
+	}
+	if info.State.Paused {
+		if err := cli.ContainerUnpause(ctx, info.ID); err != nil {
+			return info, fmt.Errorf("failed to unpause container %s: %w", info.Name, err)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func delvePort(port int) nat.Port {
+	return nat.Port(fmt.Sprintf("%d/tcp", port))
+}
+
+// checkDelveImage verifies that an image ships delve, i.e. that it was built
+// by docker:go with debug = true.
+func checkDelveImage(ctx context.Context, cli *client.Client, image string) error {
+	info, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	if info.Config == nil || info.Config.Labels["testground.debug"] != "true" {
+		return fmt.Errorf("image %s was not built for debugging; build it with docker:go and debug = true", image)
+	}
+	return nil
+}
+
+// advertiseDelve logs the host address the debugger of an instance can be
+// reached at.
+func advertiseDelve(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, c testContainerInstance, port int) {
+	tag := fmt.Sprintf("%s[%03d]", c.groupID, c.groupIdx)
+
+	info, err := cli.ContainerInspect(ctx, c.containerID)
+	if err != nil {
+		log.Warnw("failed to inspect the container run under delve", "instance", tag, "err", err)
+		return
+	}
+
+	bindings := info.NetworkSettings.Ports[delvePort(port)]
+	if len(bindings) == 0 {
+		log.Warnw("the port of delve is not published", "instance", tag, "port", port)
+		return
+	}
+
+	host := bindings[0].HostIP
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, bindings[0].HostPort)
+	log.Warnw("instance started under delve; it waits for a debugger to connect", "instance", tag, "connect", "dlv connect "+addr)
+}
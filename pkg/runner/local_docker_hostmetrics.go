@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/docker"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// startHostMetrics starts the collector of the metrics of the docker host for
+// the duration of a run, capturing them into the host metrics directory of the
+// outputs of the run. It returns the ID of its container.
+func startHostMetrics(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, runID string, runOutputsDir string, interval int, port int) (string, error) {
+	dir := filepath.Join(runOutputsDir, hostMetricsDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+
+	// node_exporter listens in the network namespace of the docker host. If
+	// that's ours, find a free port, so that concurrent runs don't clash;
+	// we can't probe a remote one.
+	if port == 0 {
+		port = defaultHostMetricsPort
+		if isLocalDockerHost(cli.DaemonHost()) {
+			var err error
+			if port, err = freeLocalPort(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// The collector runs as us, so that we own the metrics it captures.
+	ci, _, err := docker.EnsureContainerStarted(ctx, log, cli, &docker.EnsureContainerOpts{
+		ContainerName: "tg-host-metrics-" + runID,
+		ContainerConfig: &container.Config{
+			Image:      hostMetricsImage,
+			User:       fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			Entrypoint: []string{"/bin/sh", "-c", hostMetricsScript(port, interval, "/host-metrics")},
+			Labels: map[string]string{
+				"testground.purpose": "metrics",
+				"testground.run_id":  runID,
+			},
+		},
+		HostConfig: &container.HostConfig{
+			NetworkMode: "host",
+			PidMode:     "host",
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: "/", Target: "/host", ReadOnly: true, BindOptions: &mount.BindOptions{Propagation: mount.PropagationRSlave}},
+				{Type: mount.TypeBind, Source: dir, Target: "/host-metrics"},
+			},
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start the host metrics collector: %w", err)
+	}
+
+	log.Infow("capturing host metrics", "dir", dir, "interval_s", interval)
+	return ci.ID, nil
+}
+
+// isLocalDockerHost returns whether a docker daemon, given by its host,
+// runs on this host, i.e. is reached through a unix socket or a named pipe.
+func isLocalDockerHost(host string) bool {
+	return strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://")
+}
+
+// freeLocalPort returns a TCP port that is free on the loopback interface.
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// dockerLogConfig bounds the logs docker keeps for a container to limit, in
+// two files of limit/2 bytes, if the default log driver of the docker daemon
+// supports it. The driver itself is left as configured; nil is returned for
+// drivers that can't be bounded.
+func dockerLogConfig(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, limit int64) *container.LogConfig {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		log.Warnw("failed to get the log driver of the docker host; not bounding the logs it keeps", "err", err)
+		return nil
+	}
+	return boundedLogConfig(info.LoggingDriver, limit)
+}
+
+// boundedLogConfig returns the log config bounding the logs of a container to
+// limit with the given log driver, or nil if it can't.
+func boundedLogConfig(driver string, limit int64) *container.LogConfig {
+	switch driver {
+	case "json-file", "local":
+	default:
+		return nil
+	}
+	// the type is left empty, so that docker uses its default driver, and
+	// merges its default options with ours.
+	return &container.LogConfig{
+		Config: map[string]string{
+			"max-size": strconv.FormatInt(limit/2, 10),
+			"max-file": "2",
+		},
+	}
+}
+
+// captureInstanceLogs follows the stdout and stderr of the container of an
+// instance until it exits, into stdout.log and stderr.log in its outputs
+// directory, each capped to limit. Truncated logs are recorded.
+func captureInstanceLogs(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, c testContainerInstance, limit int64, truncated *truncatedLogs) {
+	stream, err := cli.ContainerLogs(ctx, c.containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		log.Warnw("failed to capture the logs of instance", "group", c.groupID, "instance", c.groupIdx, "err", err)
+		return
+	}
+	defer stream.Close()
+
+	stdout, err := newCappedLog(filepath.Join(c.outputsDir, "stdout.log"), limit)
+	if err != nil {
+		log.Warnw("failed to capture the logs of instance", "group", c.groupID, "instance", c.groupIdx, "err", err)
+		return
+	}
+	stderr, err := newCappedLog(filepath.Join(c.outputsDir, "stderr.log"), limit)
+	if err != nil {
+		_, _ = stdout.Close()
+		log.Warnw("failed to capture the logs of instance", "group", c.groupID, "instance", c.groupIdx, "err", err)
+		return
+	}
+
+	// the stream ends when the container exits, or the context is done.
+	_, _ = stdcopy.StdCopy(stdout, stderr, stream)
+
+	for name, l := range map[string]*cappedLog{"stdout": stdout, "stderr": stderr} {
+		dropped, err := l.Close()
+		if err != nil {
+			log.Warnw("failed to write the logs of instance", "group", c.groupID, "instance", c.groupIdx, "stream", name, "err", err)
+			continue
+		}
+		if dropped > 0 {
+			log.Warnw("truncated the logs of instance", "group", c.groupID, "instance", c.groupIdx, "stream", name, "dropped_bytes", dropped)
+			truncated.add(TruncatedLog{Group: c.groupID, Instance: c.groupIdx, Stream: name, Dropped: dropped})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// applyMemoryBehavior applies the swap and OOM settings of a group to the
+// host configuration of its containers. The memory of the group, otherwise
+// ignored by local:docker, is enforced along with swap, which docker
+// requires, and when the OOM killer is disabled, which would otherwise leave
+// instances free to exhaust the memory of the host.
+func applyMemoryBehavior(hcfg *container.HostConfig, r api.Resources) error {
+	if r.MemorySwap == "" && !r.OOMKillDisable {
+		return applyOOMScoreAdj(hcfg, r)
+	}
+
+	if r.Memory == "" {
+		if r.MemorySwap != "" {
+			return fmt.Errorf("memory swap %q requires memory to be set", r.MemorySwap)
+		}
+		return fmt.Errorf("disabling the OOM killer requires memory to be set")
+	}
+	memory, err := resource.ParseQuantity(r.Memory)
+	if err != nil {
+		return fmt.Errorf("invalid memory %q: %w", r.Memory, err)
+	}
+	hcfg.Memory = memory.Value()
+
+	if r.MemorySwap != "" {
+		swap := int64(-1)
+		if r.MemorySwap != "-1" {
+			q, err := resource.ParseQuantity(r.MemorySwap)
+			if err != nil {
+				return fmt.Errorf("invalid memory swap %q: %w", r.MemorySwap, err)
+			}
+			if q.Cmp(memory) < 0 {
+				return fmt.Errorf("memory swap %q must be at least memory %q", r.MemorySwap, r.Memory)
+			}
+			swap = q.Value()
+		}
+		hcfg.MemorySwap = swap
+	}
+
+	if r.OOMKillDisable {
+		disable := true
+		hcfg.OomKillDisable = &disable
+	}
+	return applyOOMScoreAdj(hcfg, r)
+}
+
+func applyOOMScoreAdj(hcfg *container.HostConfig, r api.Resources) error {
+	if r.OOMScoreAdj < -1000 || r.OOMScoreAdj > 1000 {
+		return fmt.Errorf("invalid oom score adjustment %d; expected a value between -1000 and 1000", r.OOMScoreAdj)
+	}
+	hcfg.OomScoreAdj = r.OOMScoreAdj
+	return nil
+}
@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestApplyMemoryBehavior(t *testing.T) {
+	hcfg := &container.HostConfig{}
+	require.NoError(t, applyMemoryBehavior(hcfg, api.Resources{}))
+	require.Zero(t, hcfg.Memory)
+	require.Nil(t, hcfg.OomKillDisable)
+
+	hcfg = &container.HostConfig{}
+	require.NoError(t, applyMemoryBehavior(hcfg, api.Resources{Memory: "512Mi", MemorySwap: "1Gi", OOMKillDisable: true, OOMScoreAdj: -500}))
+	require.Equal(t, int64(512<<20), hcfg.Memory)
+	require.Equal(t, int64(1<<30), hcfg.MemorySwap)
+	require.True(t, *hcfg.OomKillDisable)
+	require.Equal(t, -500, hcfg.OomScoreAdj)
+
+	hcfg = &container.HostConfig{}
+	require.NoError(t, applyMemoryBehavior(hcfg, api.Resources{Memory: "512Mi", MemorySwap: "-1"}))
+	require.Equal(t, int64(-1), hcfg.MemorySwap)
+
+	// the OOM killer is only disabled along with a memory limit.
+	hcfg = &container.HostConfig{}
+	require.NoError(t, applyMemoryBehavior(hcfg, api.Resources{Memory: "256Mi", OOMKillDisable: true}))
+	require.Equal(t, int64(256<<20), hcfg.Memory)
+	require.Zero(t, hcfg.MemorySwap)
+	require.True(t, *hcfg.OomKillDisable)
+
+	for _, r := range []api.Resources{
+		{MemorySwap: "1Gi"},
+		{Memory: "1Gi", MemorySwap: "512Mi"},
+		{Memory: "1Gi", MemorySwap: "lots"},
+		{OOMScoreAdj: 1001},
+		{OOMKillDisable: true},
+		{Memory: "lots", OOMKillDisable: true},
+	} {
+		require.Error(t, applyMemoryBehavior(&container.HostConfig{}, r), r)
+	}
+}
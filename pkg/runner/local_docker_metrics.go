@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/otiai10/copy"
+
+	"github.com/testground/testground/pkg/docker"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Images of the metrics stack dedicated to a run.
+const (
+	runPrometheusImage = "prom/prometheus:v2.37.0"
+	runGrafanaImage    = "grafana/grafana:9.1.6"
+)
+
+// runPrometheusConfig returns the configuration of the Prometheus dedicated
+// to a run. It scrapes the instances of the run, discovered like the shared
+// Prometheus does, and the pushgateway if any.
+func runPrometheusConfig(runID, pushgateway string) string {
+	cfg := fmt.Sprintf(`global:
+  scrape_interval: 5s
+  evaluation_interval: 5s
+  external_labels:
+    run_id: %q
+
+scrape_configs:
+  - job_name: testground
+    file_sd_configs:
+      - files:
+          - /etc/prometheus/file_sd/*.json
+        refresh_interval: 5s
+`, runID)
+
+	if pushgateway != "" {
+		cfg += fmt.Sprintf(`  - job_name: pushgateway
+    honor_labels: true
+    static_configs:
+      - targets: [%q]
+`, pushgateway)
+	}
+	return cfg
+}
+
+// runGrafanaDatasource provisions the Prometheus of the run as the default
+// datasource of its Grafana.
+const runGrafanaDatasource = `apiVersion: 1
+
+datasources:
+  - name: prometheus
+    type: prometheus
+    access: proxy
+    url: http://%s:9090
+    isDefault: true
+`
+
+// runMetrics is a Prometheus and Grafana pair dedicated to a run, living for
+// the duration of the run.
+type runMetrics struct {
+	cli   *client.Client
+	log   *rpc.OutputWriter
+	runID string
+
+	// dir holds the configuration and the TSDB of the Prometheus.
+	dir string
+	// containers are the IDs of the containers of the stack.
+	containers []string
+	// api is the host address of the Prometheus API.
+	api string
+}
+
+// startRunMetrics spins up the metrics stack of a run on the control network,
+// scraping the given targets. Its configuration and TSDB are kept under dir,
+// until it is torn down.
+func startRunMetrics(ctx context.Context, cli *client.Client, log *rpc.OutputWriter, dir, runID, network string, targets []metricsTargetGroup, pushgateway string) (rm *runMetrics, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	rm = &runMetrics{cli: cli, log: log, runID: runID, dir: dir}
+	defer func() {
+		if err != nil {
+			rm.teardown()
+		}
+	}()
+
+	var (
+		configDir     = filepath.Join(dir, "prometheus")
+		dataDir       = filepath.Join(dir, "data")
+		datasourceDir = filepath.Join(dir, "grafana")
+		prometheus    = "tg-prometheus-" + runID
+	)
+	for _, d := range []string{configDir, dataDir, datasourceDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(configDir, "prometheus.yml"), []byte(runPrometheusConfig(runID, pushgateway)), 0644); err != nil {
+		return nil, err
+	}
+	if _, err := writeMetricsTargets(filepath.Join(configDir, "file_sd"), runID, targets); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(datasourceDir, "prometheus.yml"), []byte(fmt.Sprintf(runGrafanaDatasource, prometheus)), 0644); err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"testground.purpose": "metrics",
+		"testground.run_id":  runID,
+	}
+
+	// Prometheus runs as us, so that we own its TSDB.
+	exposed, bindings, _ := nat.ParsePortSpecs([]string{"127.0.0.1::9090"})
+	ci, _, err := docker.EnsureContainerStarted(ctx, log, cli, &docker.EnsureContainerOpts{
+		ContainerName: prometheus,
+		ContainerConfig: &container.Config{
+			Image:        runPrometheusImage,
+			User:         fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			ExposedPorts: exposed,
+			Labels:       labels,
+			Cmd: []string{
+				"--config.file=/etc/prometheus/prometheus.yml",
+				"--storage.tsdb.path=/prometheus",
+				"--web.enable-admin-api",
+			},
+		},
+		HostConfig: &container.HostConfig{
+			PortBindings: bindings,
+			NetworkMode:  container.NetworkMode(network),
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: configDir, Target: "/etc/prometheus"},
+				{Type: mount.TypeBind, Source: dataDir, Target: "/prometheus"},
+			},
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the prometheus of the run: %w", err)
+	}
+	rm.containers = append(rm.containers, ci.ID)
+	if rm.api, err = publishedAddr(ci.NetworkSettings.Ports, "9090/tcp"); err != nil {
+		return nil, err
+	}
+
+	exposed, bindings, _ = nat.ParsePortSpecs([]string{"127.0.0.1::3000"})
+	ci, _, err = docker.EnsureContainerStarted(ctx, log, cli, &docker.EnsureContainerOpts{
+		ContainerName: "tg-grafana-" + runID,
+		ContainerConfig: &container.Config{
+			Image:        runGrafanaImage,
+			ExposedPorts: exposed,
+			Labels:       labels,
+			Env: []string{
+				"GF_AUTH_ANONYMOUS_ENABLED=true",
+				"GF_AUTH_ANONYMOUS_ORG_ROLE=Viewer",
+			},
+		},
+		HostConfig: &container.HostConfig{
+			PortBindings: bindings,
+			NetworkMode:  container.NetworkMode(network),
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: datasourceDir, Target: "/etc/grafana/provisioning/datasources", ReadOnly: true},
+			},
+		},
+		ImageStrategy: docker.ImageStrategyPull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the grafana of the run: %w", err)
+	}
+	rm.containers = append(rm.containers, ci.ID)
+
+	grafana, err := publishedAddr(ci.NetworkSettings.Ports, "3000/tcp")
+	if err != nil {
+		return nil, err
+	}
+	log.Infow("started metrics stack of the run", "prometheus", "http://"+rm.api, "grafana", "http://"+grafana)
+	return rm, nil
+}
+
+// stop snapshots the TSDB of the run into dir, and tears the stack down.
+func (rm *runMetrics) stop(dir string) {
+	defer rm.teardown()
+
+	if err := rm.snapshot(dir); err != nil {
+		rm.log.Warnw("failed to snapshot the metrics of the run", "err", err)
+		return
+	}
+	rm.log.Infow("saved the metrics of the run", "dir", dir)
+}
+
+// snapshot takes a snapshot of the TSDB through the admin API of Prometheus,
+// and copies it to dir.
+func (rm *runMetrics) snapshot(dir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+rm.api+"/api/v1/admin/tsdb/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	if res.Status != "success" {
+		return fmt.Errorf("snapshot failed: %s", res.Error)
+	}
+
+	return copy.Copy(filepath.Join(rm.dir, "data", "snapshots", filepath.Base(res.Data.Name)), dir)
+}
+
+// teardown removes the containers and the data of the stack.
+func (rm *runMetrics) teardown() {
+	if len(rm.containers) > 0 {
+		if err := docker.DeleteContainers(rm.cli, rm.log, rm.containers); err != nil {
+			rm.log.Warnw("failed to delete metrics containers", "err", err)
+		}
+	}
+	_ = os.RemoveAll(rm.dir)
+}
+
+// publishedAddr returns the host address a container port is published at.
+func publishedAddr(ports nat.PortMap, port nat.Port) (string, error) {
+	bindings := ports[port]
+	if len(bindings) == 0 {
+		return "", fmt.Errorf("port %s not published", port)
+	}
+	return net.JoinHostPort(bindings[0].HostIP, bindings[0].HostPort), nil
+}
@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+var _ api.Pauser = (*LocalDockerRunner)(nil)
+
+// PauseRun freezes the containers of the instances of a run, through the
+// freezer cgroup: their processes are suspended without being signaled. The
+// infra chaos of the run is held until it's resumed.
+func (r *LocalDockerRunner) PauseRun(ctx context.Context, in *api.PauseInput, ow *rpc.OutputWriter) error {
+	if err := togglePauseRun(ctx, in.RunID, ow, true); err != nil {
+		return err
+	}
+	r.setPaused(in.RunID, true)
+	return nil
+}
+
+// ResumeRun thaws the frozen containers of a run.
+func (r *LocalDockerRunner) ResumeRun(ctx context.Context, in *api.PauseInput, ow *rpc.OutputWriter) error {
+	if err := togglePauseRun(ctx, in.RunID, ow, false); err != nil {
+		return err
+	}
+	r.setPaused(in.RunID, false)
+	return nil
+}
+
+// pauseGate holds back the work a runner does on behalf of a run, e.g. its
+// infra chaos, while the run is paused.
+type pauseGate struct {
+	lk sync.Mutex
+	// resumed is closed when the run is resumed; nil unless paused.
+	resumed chan struct{}
+}
+
+func (g *pauseGate) set(paused bool) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	switch {
+	case paused && g.resumed == nil:
+		g.resumed = make(chan struct{})
+	case !paused && g.resumed != nil:
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// wait blocks while the run is paused, until it's resumed or ctx is done. It
+// reports whether the run was paused.
+func (g *pauseGate) wait(ctx context.Context) bool {
+	g.lk.Lock()
+	resumed := g.resumed
+	g.lk.Unlock()
+
+	if resumed == nil {
+		return false
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+func (r *LocalDockerRunner) addPauseGate(runID string) *pauseGate {
+	r.pausesLk.Lock()
+	defer r.pausesLk.Unlock()
+
+	if r.pauses == nil {
+		r.pauses = make(map[string]*pauseGate)
+	}
+	g := new(pauseGate)
+	r.pauses[runID] = g
+	return g
+}
+
+func (r *LocalDockerRunner) deletePauseGate(runID string) {
+	r.pausesLk.Lock()
+	defer r.pausesLk.Unlock()
+
+	if g, ok := r.pauses[runID]; ok {
+		g.set(false)
+		delete(r.pauses, runID)
+	}
+}
+
+func (r *LocalDockerRunner) setPaused(runID string, paused bool) {
+	r.pausesLk.Lock()
+	defer r.pausesLk.Unlock()
+
+	if g, ok := r.pauses[runID]; ok {
+		g.set(paused)
+	}
+}
+
+func togglePauseRun(ctx context.Context, runID string, ow *rpc.OutputWriter, pause bool) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "testground.run_id="+runID),
+			filters.Arg("label", "testground.purpose=plan"),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the containers of run %s: %w", runID, err)
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("run %s has no running instances", runID)
+	}
+
+	var n int
+	for _, c := range containers {
+		instance := c.Labels["testground.group_id"] + "[" + c.Labels["testground.instance"] + "]"
+		switch {
+		case pause && c.State == "running":
+			err = cli.ContainerPause(ctx, c.ID)
+		case !pause && c.State == "paused":
+			err = cli.ContainerUnpause(ctx, c.ID)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to toggle the pause of instance %s: %w", instance, err)
+		}
+		n++
+	}
+
+	if pause {
+		ow.Infow("paused instances", "run_id", runID, "count", n)
+	} else {
+		ow.Infow("resumed instances", "run_id", runID, "count", n)
+	}
+	return nil
+}
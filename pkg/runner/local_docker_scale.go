@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/client"
+	"github.com/testground/sdk-go/runtime"
+	ss "github.com/testground/sdk-go/sync"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+var _ api.Scaler = (*LocalDockerRunner)(nil)
+
+// ScaleEventsTopic is the sync service topic on which the instances of a run
+// are told about the resizing of its groups.
+var ScaleEventsTopic = ss.NewTopic("testground-scale", &api.ScaleEvent{})
+
+// liveDockerRun is the state of an ongoing run of the local:docker runner that
+// is needed to resize its groups, and to replace its instances.
+type liveDockerRun struct {
+	lk sync.Mutex
+	// finished is set once the run stops waiting for instances; it can't be
+	// resized anymore.
+	finished bool
+
+	groups map[string]*api.RunGroup
+	sizes  map[string]int
+	total  int
+	// generation counts the times instances were added to the run, by
+	// scaling or churn, to name their containers apart from the ones of
+	// previous instances with the same sequence numbers.
+	generation int
+	// removed are the containers of the instances removed from the run.
+	removed map[string]struct{}
+	// replaced are the containers of the instances replaced by churn.
+	replaced map[string]struct{}
+
+	cli      *client.Client
+	template *runtime.RunParams
+
+	// The following are provided by Run.
+	groupEnv       func(g *api.RunGroup, instances, total int) (runtime.RunParams, []string)
+	createInstance func(g *api.RunGroup, runenv runtime.RunParams, env []string, i int, name string) (testContainerInstance, error)
+	containers     func() []testContainerInstance
+	// start starts the container of a new instance, and follows it until
+	// it's done.
+	start func(ctx context.Context, c testContainerInstance) error
+	// expect adjusts the number of outcomes expected from a group. The
+	// outcomes of a group can't be expected below the ones it reported.
+	expect func(group string, delta int)
+}
+
+// ScaleGroup resizes a group of an ongoing run, and tells its instances about
+// it on ScaleEventsTopic.
+func (r *LocalDockerRunner) ScaleGroup(ctx context.Context, in *api.ScaleInput, ow *rpc.OutputWriter) error {
+	r.liveLk.Lock()
+	live, ok := r.live[in.RunID]
+	r.liveLk.Unlock()
+	if !ok {
+		return fmt.Errorf("run %s is not in progress", in.RunID)
+	}
+	return live.scale(ctx, r.syncClient, in.Group, in.Instances, ow)
+}
+
+func (r *LocalDockerRunner) registerRun(runID string, live *liveDockerRun) {
+	r.liveLk.Lock()
+	defer r.liveLk.Unlock()
+	if r.live == nil {
+		r.live = make(map[string]*liveDockerRun)
+	}
+	r.live[runID] = live
+}
+
+func (r *LocalDockerRunner) unregisterRun(runID string) {
+	r.liveLk.Lock()
+	live := r.live[runID]
+	delete(r.live, runID)
+	r.liveLk.Unlock()
+
+	if live != nil {
+		live.finish()
+	}
+}
+
+// finish stops the run from being resized, waiting for any resizing in
+// progress.
+func (l *liveDockerRun) finish() {
+	l.lk.Lock()
+	l.finished = true
+	l.lk.Unlock()
+}
+
+// wasRemoved returns whether a container is that of an instance removed from
+// the run.
+func (l *liveDockerRun) wasRemoved(id string) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	_, ok := l.removed[id]
+	return ok
+}
+
+func (l *liveDockerRun) scale(ctx context.Context, sc *ss.DefaultClient, group string, to int, ow *rpc.OutputWriter) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.finished {
+		return errors.New("run is finishing")
+	}
+	g, ok := l.groups[group]
+	if !ok {
+		return fmt.Errorf("unknown group: %s", group)
+	}
+
+	from := l.sizes[group]
+	switch {
+	case to > from:
+		l.generation++
+		runenv, env := l.groupEnv(g, to, l.total+to-from)
+		for i := from; i < to; i++ {
+			name := fmt.Sprintf("tg-%s-%s-%s-%s-%d-%d", runenv.TestPlan, runenv.TestCase, runenv.TestRun, group, i, l.generation)
+			c, err := l.createInstance(g, runenv, env, i, name)
+			if err != nil {
+				return err
+			}
+			l.expect(group, 1)
+			if err := l.start(ctx, c); err != nil {
+				l.expect(group, -1)
+				return fmt.Errorf("failed to start instance %s[%d]: %w", group, i, err)
+			}
+			l.sizes[group]++
+			l.total++
+		}
+
+	case to < from:
+		for _, c := range l.containers() {
+			if c.groupID != group || c.groupIdx < to {
+				continue
+			}
+			if _, ok := l.removed[c.containerID]; ok {
+				continue
+			}
+			l.removed[c.containerID] = struct{}{}
+
+			// instances that exited already reported their outcome, if
+			// they ever will; only the running ones are still expected to.
+			pending := true
+			if info, err := l.cli.ContainerInspect(ctx, c.containerID); err == nil && info.State != nil {
+				pending = info.State.Running
+			}
+			if err := l.cli.ContainerKill(ctx, c.containerID, "SIGKILL"); err != nil && pending {
+				ow.Warnw("failed to kill removed instance", "group", group, "instance", c.groupIdx, "err", err)
+			}
+			if pending {
+				l.expect(group, -1)
+			}
+		}
+		l.total -= from - to
+		l.sizes[group] = to
+
+	default:
+		return nil
+	}
+
+	ev := &api.ScaleEvent{Group: group, Instances: l.sizes[group], TotalInstances: l.total}
+	if _, err := sc.Publish(ss.WithRunParams(ctx, l.template), ScaleEventsTopic, ev); err != nil {
+		return fmt.Errorf("failed to broadcast the new size of group %s: %w", group, err)
+	}
+	ow.Infow("scaled group", "group", group, "from", from, "to", l.sizes[group])
+	return nil
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/otiai10/copy"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+// Environment variables through which instances find the directory holding
+// their snapshot, see api.Snapshot.
+const (
+	EnvTestSnapshotPath     = "TEST_SNAPSHOT_PATH"
+	EnvTestSnapshotRestored = "TEST_SNAPSHOT_RESTORED"
+)
+
+// snapshotMountPath is where the snapshot directory of an instance is mounted.
+const snapshotMountPath = "/snapshot"
+
+var _ api.Snapshotter = (*LocalDockerRunner)(nil)
+
+// CheckSnapshot checks that the snapshot to restore, if any, exists.
+func (*LocalDockerRunner) CheckSnapshot(env *config.EnvConfig, s *api.Snapshot) error {
+	if s.Restore == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(env.Dirs().Snapshots(), s.Restore)); err != nil {
+		return fmt.Errorf("unknown snapshot %s: %w", s.Restore, err)
+	}
+	return nil
+}
+
+// runSnapshot holds the snapshot directories of the instances of a run, in
+// which they export their state, or find the state restored for them.
+type runSnapshot struct {
+	spec *api.Snapshot
+	// root is the directory of all snapshots, and dir that of the run, which
+	// becomes a snapshot of its own when the run succeeds.
+	root string
+	dir  string
+}
+
+// newRunSnapshot prepares the snapshot directories of a run; it returns nil if
+// the run neither saves nor restores a snapshot.
+func newRunSnapshot(root, runID string, spec *api.Snapshot) (*runSnapshot, error) {
+	if spec == nil || (spec.Save == "" && spec.Restore == "") {
+		return nil, nil
+	}
+	dir := filepath.Join(root, ".runs", runID)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot dir %s: %w", dir, err)
+	}
+	return &runSnapshot{spec: spec, root: root, dir: dir}, nil
+}
+
+// envVars returns the environment variables of the instances.
+func (s *runSnapshot) envVars() map[string]string {
+	if s == nil {
+		return map[string]string{}
+	}
+	env := map[string]string{EnvTestSnapshotPath: snapshotMountPath}
+	if s.spec.Restore != "" {
+		env[EnvTestSnapshotRestored] = "true"
+	}
+	return env
+}
+
+// instanceDir returns the snapshot directory of an instance, holding the
+// restored state of the instance with the same group and sequence number, if
+// the run restores a snapshot. The restored state is copied when the
+// directory is first created only, so that an instance recreated within the
+// run, e.g. when it's restarted, resumes from the state it left off at.
+func (s *runSnapshot) instanceDir(group string, i int) (string, error) {
+	dir := filepath.Join(s.dir, group, strconv.Itoa(i))
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	if s.spec.Restore != "" {
+		src := filepath.Join(s.root, s.spec.Restore, group, strconv.Itoa(i))
+		if _, err := os.Stat(src); err == nil {
+			if err := copy.Copy(src, dir); err != nil {
+				return "", fmt.Errorf("failed to restore snapshot %s of instance %s[%d]: %w", s.spec.Restore, group, i, err)
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("failed to create snapshot dir %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// finish saves the snapshot directories of the run under the name of the
+// snapshot to save, if the run succeeded, and discards them otherwise.
+func (s *runSnapshot) finish(log *rpc.OutputWriter, succeeded bool) {
+	if s == nil {
+		return
+	}
+	defer os.RemoveAll(s.dir)
+
+	if s.spec.Save == "" || !succeeded {
+		return
+	}
+	dst := filepath.Join(s.root, s.spec.Save)
+	if err := os.RemoveAll(dst); err != nil {
+		log.Warnw("failed to replace snapshot", "snapshot", s.spec.Save, "err", err)
+		return
+	}
+	if err := os.Rename(s.dir, dst); err != nil {
+		log.Warnw("failed to save snapshot", "snapshot", s.spec.Save, "err", err)
+		return
+	}
+	log.Infow("saved snapshot", "snapshot", s.spec.Save)
+}
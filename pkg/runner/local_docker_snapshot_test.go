@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func TestRunSnapshot(t *testing.T) {
+	root := t.TempDir()
+
+	snap, err := newRunSnapshot(root, "run1", nil)
+	require.NoError(t, err)
+	require.Nil(t, snap)
+	require.Empty(t, snap.envVars())
+
+	// save the state of a bootstrapped network.
+	snap, err = newRunSnapshot(root, "run1", &api.Snapshot{Save: "bootstrapped"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{EnvTestSnapshotPath: snapshotMountPath}, snap.envVars())
+
+	dir, err := snap.instanceDir("peers", 3)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state"), []byte("routing table"), 0644))
+	snap.finish(rpc.Discard(), true)
+
+	// restore it in a later run.
+	snap, err = newRunSnapshot(root, "run2", &api.Snapshot{Restore: "bootstrapped"})
+	require.NoError(t, err)
+	require.Equal(t, "true", snap.envVars()[EnvTestSnapshotRestored])
+
+	dir, err = snap.instanceDir("peers", 3)
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(dir, "state"))
+	require.NoError(t, err)
+	require.Equal(t, "routing table", string(b))
+
+	// the state of an instance recreated within the run isn't restored again.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state"), []byte("updated table"), 0644))
+	dir, err = snap.instanceDir("peers", 3)
+	require.NoError(t, err)
+	b, err = os.ReadFile(filepath.Join(dir, "state"))
+	require.NoError(t, err)
+	require.Equal(t, "updated table", string(b))
+
+	// instances missing from the snapshot start from scratch.
+	dir, err = snap.instanceDir("peers", 4)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// runs that fail don't replace snapshots.
+	snap.finish(rpc.Discard(), false)
+	snap, err = newRunSnapshot(root, "run3", &api.Snapshot{Save: "bootstrapped"})
+	require.NoError(t, err)
+	snap.finish(rpc.Discard(), false)
+	_, err = os.Stat(filepath.Join(root, "bootstrapped", "peers", "3", "state"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, ".runs", "run3"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/testground/sdk-go/runtime"
+	ss "github.com/testground/sdk-go/sync"
+
+	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/sidecar"
+)
+
+// followNetworkChanges records the network changes the sidecar applies to the
+// instances of a run in its timeline, until the context is done.
+func (r *LocalDockerRunner) followNetworkChanges(ctx context.Context, log *rpc.OutputWriter, tpl *runtime.RunParams, tl *timeline, containers []testContainerInstance) error {
+	// instances are known to the sidecar by their hostname, which docker
+	// defaults to the short ID of their container.
+	byHostname := make(map[string]testContainerInstance, len(containers))
+	for _, c := range containers {
+		if len(c.containerID) >= 12 {
+			byHostname[c.containerID[:12]] = c
+		}
+	}
+
+	ch := make(chan *sidecar.NetworkChange, 64)
+	sub, err := r.syncClient.Subscribe(ss.WithRunParams(ctx, tpl), sidecar.NetworkChangesTopic, ch)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case c := <-ch:
+				index := -1
+				if inst, ok := byHostname[c.Hostname]; ok {
+					index = inst.groupIdx
+				}
+				tl.networkChange(c, index)
+			case <-ctx.Done():
+				return
+			case err := <-sub.Done():
+				if err != nil && ctx.Err() == nil {
+					log.Warnw("stopped following network changes", "err", err)
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// writeTimeline merges the events logged by the instances of a run into its
+// timeline, and writes it into the outputs of the run.
+func (r *LocalDockerRunner) writeTimeline(log *rpc.OutputWriter, tl *timeline, runDir string, containers []testContainerInstance) {
+	for _, c := range containers {
+		if err := tl.addInstanceEvents(c.groupID, c.groupIdx, c.outputsDir); err != nil {
+			log.Warnw("failed to read the events of instance", "group", c.groupID, "group_index", c.groupIdx, "err", err)
+		}
+	}
+	if err := tl.write(runDir); err != nil {
+		log.Warnw("failed to write the timeline of the run", "err", err)
+		return
+	}
+	log.Infow("wrote the timeline of the run", "file", TimelineFile)
+}
@@ -16,12 +16,17 @@ import (
 	"github.com/testground/sdk-go/ptypes"
 
 	"github.com/testground/sdk-go/runtime"
+	ss "github.com/testground/sdk-go/sync"
 
 	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/config"
 	"github.com/testground/testground/pkg/conv"
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/healthcheck"
+	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
+	"github.com/testground/testground/pkg/syncsvc"
+	"github.com/testground/testground/pkg/task"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
@@ -33,20 +38,64 @@ var (
 )
 
 var (
-	_ api.Runner        = (*LocalExecutableRunner)(nil)
-	_ api.Healthchecker = (*LocalExecutableRunner)(nil)
+	_ api.Runner         = (*LocalExecutableRunner)(nil)
+	_ api.Healthchecker  = (*LocalExecutableRunner)(nil)
+	_ api.InfraUpgrader  = (*LocalExecutableRunner)(nil)
+	_ api.OutputsLocator = (*LocalExecutableRunner)(nil)
 )
 
 type LocalExecutableRunner struct {
 	lk sync.RWMutex
 
 	outputsDir string
+
+	// procs are the commands of the instances of the runs in progress, by
+	// run ID, so that they can be paused.
+	procs   map[string][]*exec.Cmd
+	procsLk sync.Mutex
 }
 
 // LocalExecutableRunnerCfg is the configuration struct for this runner.
-type LocalExecutableRunnerCfg struct{}
+type LocalExecutableRunnerCfg struct {
+	// Cgroups enforces the CPU and memory resources of groups by running each
+	// instance in its own cgroup v2. Instances are started inside their cgroup,
+	// which requires Linux 5.7 or later (default: false).
+	Cgroups bool `toml:"cgroups"`
+	// CgroupParent is the cgroup v2 directory the cgroups of runs are created
+	// under. It must be delegated to the user running the daemon (default:
+	// /sys/fs/cgroup/testground).
+	CgroupParent string `toml:"cgroup_parent"`
+	// NetworkIsolation runs each instance in its own network namespace,
+	// attached to a bridge dedicated to the run, and applies the network
+	// configurations instances request, like the sidecar does on other
+	// runners. Linux only; requires CAP_NET_ADMIN and CAP_SYS_ADMIN (default:
+	// false).
+	NetworkIsolation bool `toml:"network_isolation"`
+	// DebugInstance starts an instance, given as <group>:<index>, under the
+	// delve debugger found in PATH, which waits for a client to connect
+	// before starting the instance (default: not set).
+	DebugInstance string `toml:"debug_instance"`
+	// DebugPort is the port delve listens on (default: 2345).
+	DebugPort int `toml:"debug_port"`
+	// InstanceLogsLimit caps the stdout and stderr of each instance, in
+	// human-readable units, e.g. "64MiB". Their head and tail are captured
+	// into the outputs of the instance, as stdout.log and stderr.log;
+	// truncations are listed in truncated-logs.json in the outputs of the run
+	// (default: not set).
+	InstanceLogsLimit string `toml:"instance_logs_limit"`
+}
 
 func (r *LocalExecutableRunner) Healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool) (*api.HealthcheckReport, error) {
+	return r.healthcheck(ctx, engine, ow, fix, false)
+}
+
+// UpgradeInfra replaces the infrastructure containers running other images
+// than the pinned ones, one at a time, in dependency order.
+func (r *LocalExecutableRunner) UpgradeInfra(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter) (*api.HealthcheckReport, error) {
+	return r.healthcheck(ctx, engine, ow, true, true)
+}
+
+func (r *LocalExecutableRunner) healthcheck(ctx context.Context, engine api.Engine, ow *rpc.OutputWriter, fix bool, upgrade bool) (*api.HealthcheckReport, error) {
 	r.lk.Lock()
 	defer r.lk.Unlock()
 
@@ -65,7 +114,7 @@ func (r *LocalExecutableRunner) Healthcheck(ctx context.Context, engine api.Engi
 	)
 
 	// setup infra which is common between local:docker and local:exec
-	localCommonHealthcheck(ctx, hh, cli, ow, "testground-control", r.outputsDir)
+	localCommonHealthcheck(ctx, hh, cli, ow, "testground-control", r.outputsDir, engine.EnvConfig().Daemon.Infra, upgrade)
 
 	// RunChecks will fill the report and return any errors.
 	return hh.RunChecks(ctx, fix)
@@ -90,29 +139,127 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 		TestSubnet:         &ptypes.IPNet{IPNet: *localSubnet},
 	}
 
+	cfg := *input.RunnerConfig.(*LocalExecutableRunnerCfg)
+
+	delve, err := parseDelveTarget(cfg.DebugInstance, cfg.DebugPort, input.Groups)
+	if err != nil {
+		return nil, err
+	}
+	var dlv string
+	if delve != nil {
+		if dlv, err = exec.LookPath("dlv"); err != nil {
+			return nil, fmt.Errorf("debug_instance requires delve: %w", err)
+		}
+	}
+
+	logsLimit, err := parseLogsLimit(cfg.InstanceLogsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the cgroup of the run, if resources are to be enforced.
+	var cgroup *runCgroup
+	if cfg.Cgroups {
+		parent := cfg.CgroupParent
+		if parent == "" {
+			parent = defaultCgroupParent
+		}
+		var err error
+		if cgroup, err = newRunCgroup(parent, input.RunID); err != nil {
+			return nil, err
+		}
+		defer cgroup.remove()
+	}
+
+	// Isolate the instances in network namespaces, if requested. They then
+	// reach the infrastructure services through the gateway of the bridge.
+	var (
+		rnet     *runNetwork
+		client   ss.Client
+		services = "localhost"
+		managers sync.WaitGroup
+	)
+	if cfg.NetworkIsolation {
+		var err error
+		if rnet, err = newRunNetwork(); err != nil {
+			return nil, err
+		}
+		defer rnet.remove()
+
+		clients := syncsvc.NewClients(ctx, logging.S())
+		defer clients.Close()
+		if client, err = clients.Get("localhost"); err != nil {
+			return nil, err
+		}
+
+		template.TestSubnet = &ptypes.IPNet{IPNet: *rnet.subnet}
+		template.TestSidecar = true
+		services = rnet.gateway.String()
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer func() {
+			cancel()
+			managers.Wait()
+		}()
+	}
+
 	// Spawn as many instances as the input parameters require.
 	pretty := NewPrettyPrinter(ow)
+	defer pretty.Close()
 	commands := make([]*exec.Cmd, 0, input.TotalInstances)
+
+	// Capture the logs of the instances into their outputs, if they're
+	// capped, once the instances are done.
+	var logs []*instanceLogs
+	defer func() {
+		var truncated truncatedLogs
+		for _, l := range logs {
+			if err := l.close(&truncated); err != nil {
+				ow.Warnw("failed to write the logs of instance", "group", l.group, "instance", l.instance, "err", err)
+			}
+		}
+		if err := truncated.write(filepath.Join(r.outputsDir, input.TestPlan, input.RunID)); err != nil {
+			ow.Warnw("failed to write the truncated logs", "err", err)
+		}
+	}()
+
 	defer func() {
+		r.forgetProcesses(input.RunID)
 		for _, cmd := range commands {
-			_ = cmd.Process.Kill()
+			killProcessGroup(cmd)
 		}
 		for _, cmd := range commands {
 			_ = cmd.Wait()
 		}
 		_ = pretty.Wait()
 	}()
+	defer input.EnterPhase(task.PhaseCleanup)
 
 	var (
-		total   int
-		tmpdirs []string
+		total     int
+		tmpdirs   []string
+		startedAt = time.Now()
 	)
 	for _, g := range input.Groups {
-		reviewResources(g, ow)
+		var limits cgroupLimits
+		if cgroup == nil {
+			reviewResources(g, ow)
+		} else {
+			var err error
+			if limits, err = parseCgroupLimits(g.Resources); err != nil {
+				return nil, fmt.Errorf("group %s: %w", g.ID, err)
+			}
+		}
 
 		for i := 0; i < g.Instances; i++ {
+			if err := waitStartDelay(ctx, startedAt, input.StartDelay(total)); err != nil {
+				return nil, err
+			}
+
 			total++
 			tag := fmt.Sprintf("%s[%03d]", g.ID, i)
+			hostname := fmt.Sprintf("%s-%d", g.ID, i)
 
 			odir := filepath.Join(r.outputsDir, input.TestPlan, input.RunID, g.ID, strconv.Itoa(i))
 			if err := os.MkdirAll(odir, 0777); err != nil {
@@ -140,31 +287,99 @@ func (r *LocalExecutableRunner) Run(ctx context.Context, input *api.RunInput, ow
 			runenv.TestCaptureProfiles = g.Profiles
 
 			env := conv.ToOptionsSlice(runenv.ToEnvVars())
-			env = append(env, "INFLUXDB_URL=http://localhost:8086")
+			env = append(env, "INFLUXDB_URL=http://"+services+":8086")
 			// NOTE: we export REDIS_HOST for compatibility with older sdk versions.
-			env = append(env, "REDIS_HOST=localhost")
-			env = append(env, "SYNC_SERVICE_HOST=localhost")
+			env = append(env, "REDIS_HOST="+services)
+			env = append(env, "SYNC_SERVICE_HOST="+services)
 			env = append(env, "PATH="+os.Getenv("PATH"))
+			for _, name := range platformEnvVars {
+				if v, ok := os.LookupEnv(name); ok {
+					env = append(env, name+"="+v)
+				}
+			}
+			env = append(env, conv.ToOptionsSlice(seedEnvVars(input))...)
+			env = append(env, conv.ToOptionsSlice(storeEnvVars(input, g))...)
 
 			ow.Infow("starting test case instance", "plan", input.TestPlan, "group", g.ID, "number", i, "total", total)
 
 			cmd := exec.CommandContext(ctx, g.ArtifactPath)
+			if delve.matches(g.ID, i) {
+				// isolated instances are reached through their own address.
+				addr := fmt.Sprintf("127.0.0.1:%d", delve.port)
+				if rnet != nil {
+					addr = fmt.Sprintf(":%d", delve.port)
+				}
+				args := delve.command(dlv, g.ArtifactPath, addr)
+				cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+			}
 			stdout, _ := cmd.StdoutPipe()
 			stderr, _ := cmd.StderrPipe()
 			cmd.Env = env
+			setProcessGroup(cmd)
+
+			release := func() {}
+			if cgroup != nil {
+				if release, err = cgroup.add(hostname, limits, cmd); err != nil {
+					return nil, err
+				}
+			}
 
-			if err := cmd.Start(); err != nil {
+			var isolated *isolatedInstance
+			if rnet != nil {
+				if isolated, err = rnet.attach(); err != nil {
+					release()
+					pretty.FailStart(tag, err)
+					continue
+				}
+				err = isolated.start(cmd, hostname)
+			} else {
+				err = cmd.Start()
+			}
+			release()
+			if err != nil {
 				pretty.FailStart(tag, err)
 				continue
 			}
 
 			commands = append(commands, cmd)
+			r.trackProcess(input.RunID, cmd)
+
+			if delve.matches(g.ID, i) {
+				host := "127.0.0.1"
+				if isolated != nil {
+					host = isolated.ip.String()
+				}
+				addr := net.JoinHostPort(host, strconv.Itoa(delve.port))
+				ow.Warnw("instance started under delve; it waits for a debugger to connect", "instance", tag, "connect", "dlv connect "+addr)
+			}
+
+			if isolated != nil {
+				managers.Add(1)
+				go func(params runtime.RunParams) {
+					defer managers.Done()
+					if err := isolated.manage(ctx, client, params, hostname, rnet.gateway); err != nil {
+						ow.Warnw("failed to manage the network of instance", "instance", hostname, "err", err)
+					}
+				}(runenv)
+			}
+
+			if logsLimit > 0 {
+				l, err := newInstanceLogs(odir, g.ID, i, logsLimit)
+				if err != nil {
+					ow.Warnw("failed to capture the logs of instance", "group", g.ID, "instance", i, "err", err)
+				} else {
+					logs = append(logs, l)
+					stdout, stderr = l.tee("stdout", stdout), l.tee("stderr", stderr)
+				}
+			}
 
 			// instance tag in output: << group[zero_padded_i] >>, e.g. << miner[003] >>
 			pretty.Manage(tag, stdout, stderr)
 		}
 	}
 
+	input.EnterPhase(task.PhaseRun)
+
 	if err := <-pretty.Wait(); err != nil {
 		return nil, err
 	}
@@ -182,7 +397,13 @@ func (r *LocalExecutableRunner) CollectOutputs(ctx context.Context, input *api.C
 	dir := r.outputsDir
 	r.lk.RUnlock()
 
-	return gzipRunOutputs(ctx, dir, input, ow)
+	return archiveRunOutputs(ctx, dir, input, ow)
+}
+
+// RunOutputsDir returns the directory holding the outputs of a run, under
+// the outputs directory of the runner.
+func (*LocalExecutableRunner) RunOutputsDir(cfg *config.EnvConfig, plan, runID string) string {
+	return filepath.Join(cfg.Dirs().Outputs(), "local_exec", plan, runID)
 }
 
 func (*LocalExecutableRunner) ID() string {
@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+// defaultCgroupParent is the cgroup v2 hierarchy under which local:exec creates
+// the cgroups of runs. It must be delegated to the user the daemon runs as.
+const defaultCgroupParent = "/sys/fs/cgroup/testground"
+
+// cgroupPeriod is the CPU bandwidth period, in microseconds.
+const cgroupPeriod = 100000
+
+// cgroupLimits are the limits applied to the cgroup of an instance; zero
+// values mean unlimited.
+type cgroupLimits struct {
+	// memory is in bytes.
+	memory int64
+	// cpuQuota is in microseconds per cgroupPeriod.
+	cpuQuota int64
+}
+
+// parseCgroupLimits converts the resources of a group, expressed like for
+// cluster:k8s (e.g. memory = "512Mi", cpu = "500m"), into cgroup limits.
+func parseCgroupLimits(r api.Resources) (cgroupLimits, error) {
+	var l cgroupLimits
+	if r.Memory != "" {
+		q, err := resource.ParseQuantity(r.Memory)
+		if err != nil {
+			return l, fmt.Errorf("invalid memory %q: %w", r.Memory, err)
+		}
+		l.memory = q.Value()
+	}
+	if r.CPU != "" {
+		q, err := resource.ParseQuantity(r.CPU)
+		if err != nil {
+			return l, fmt.Errorf("invalid cpu %q: %w", r.CPU, err)
+		}
+		l.cpuQuota = q.MilliValue() * cgroupPeriod / 1000
+	}
+	return l, nil
+}
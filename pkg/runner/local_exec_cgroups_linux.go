@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// runCgroup is the cgroup v2 of a run, under which every instance gets its own
+// cgroup.
+type runCgroup struct {
+	dir       string
+	instances []string
+}
+
+// newRunCgroup creates the cgroup of a run under parent, delegating the cpu
+// and memory controllers to the cgroups of its instances.
+func newRunCgroup(parent, runID string) (*runCgroup, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", parent, err)
+	}
+	if err := enableCgroupControllers(parent); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(parent, runID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", dir, err)
+	}
+	rc := &runCgroup{dir: dir}
+	if err := enableCgroupControllers(dir); err != nil {
+		rc.remove()
+		return nil, err
+	}
+	return rc, nil
+}
+
+func enableCgroupControllers(dir string) error {
+	path := filepath.Join(dir, "cgroup.subtree_control")
+	if err := ioutil.WriteFile(path, []byte("+cpu +memory"), 0644); err != nil {
+		return fmt.Errorf("failed to enable cpu and memory controllers in %s: %w", dir, err)
+	}
+	return nil
+}
+
+// add creates the cgroup of an instance with the given limits, and sets up
+// cmd to be started inside it, so that the instance never runs unconstrained.
+// The returned function must be called once cmd has been started.
+func (rc *runCgroup) add(name string, limits cgroupLimits, cmd *exec.Cmd) (func(), error) {
+	dir := filepath.Join(rc.dir, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", dir, err)
+	}
+	rc.instances = append(rc.instances, dir)
+
+	files := make(map[string]string)
+	if limits.memory > 0 {
+		files["memory.max"] = strconv.FormatInt(limits.memory, 10)
+	}
+	if limits.cpuQuota > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", limits.cpuQuota, cgroupPeriod)
+	}
+	for f, v := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(v), 0644); err != nil {
+			return nil, fmt.Errorf("failed to set %s of cgroup %s: %w", f, dir, err)
+		}
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", dir, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return func() { _ = f.Close() }, nil
+}
+
+// remove removes the cgroups of the run, once its processes have exited.
+func (rc *runCgroup) remove() {
+	for _, dir := range rc.instances {
+		_ = os.Remove(dir)
+	}
+	_ = os.Remove(rc.dir)
+}
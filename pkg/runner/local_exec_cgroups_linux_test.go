@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCgroup(t *testing.T) {
+	// a plain directory stands in for the cgroup hierarchy.
+	parent := t.TempDir()
+
+	rc, err := newRunCgroup(parent, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("true")
+	release, err := rc.add("single-0", cgroupLimits{memory: 1 << 30, cpuQuota: 50000}, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// the instance is started directly inside its cgroup.
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.UseCgroupFD || cmd.SysProcAttr.CgroupFD <= 0 {
+		t.Errorf("expected the command to be started inside the cgroup")
+	}
+
+	for f, want := range map[string]string{
+		"cgroup.subtree_control":     "+cpu +memory",
+		"run/cgroup.subtree_control": "+cpu +memory",
+		"run/single-0/memory.max":    "1073741824",
+		"run/single-0/cpu.max":       "50000 100000",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(parent, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", f, b, want)
+		}
+	}
+}
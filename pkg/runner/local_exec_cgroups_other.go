@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+)
+
+type runCgroup struct{}
+
+func newRunCgroup(parent, runID string) (*runCgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (*runCgroup) add(name string, limits cgroupLimits, cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+func (*runCgroup) remove() {}
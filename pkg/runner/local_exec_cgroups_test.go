@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/testground/testground/pkg/api"
+)
+
+func TestParseCgroupLimits(t *testing.T) {
+	l, err := parseCgroupLimits(api.Resources{Memory: "512Mi", CPU: "500m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.memory != 512<<20 || l.cpuQuota != cgroupPeriod/2 {
+		t.Errorf("got %+v", l)
+	}
+
+	l, err = parseCgroupLimits(api.Resources{CPU: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.memory != 0 || l.cpuQuota != 2*cgroupPeriod {
+		t.Errorf("got %+v", l)
+	}
+
+	if _, err := parseCgroupLimits(api.Resources{Memory: "lots"}); err == nil {
+		t.Error("expected an error for an invalid memory")
+	}
+}
@@ -0,0 +1,274 @@
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	tgruntime "github.com/testground/sdk-go/runtime"
+	ss "github.com/testground/sdk-go/sync"
+
+	"github.com/testground/testground/pkg/sidecar"
+)
+
+// isolatedIfname is the name of the data link of isolated instances.
+const isolatedIfname = "eth0"
+
+// runNetworksLk serialises the allocation of the subnets of runs.
+var runNetworksLk sync.Mutex
+
+// runNetwork is the bridge that the instances of a local:exec run, each
+// isolated in its own network namespace, are attached to. The bridge holds
+// the gateway address of the data subnet, through which instances reach the
+// infrastructure services published on the host.
+type runNetwork struct {
+	bridge  netlink.Link
+	subnet  *net.IPNet
+	gateway net.IP
+
+	hosts     uint32
+	instances []*isolatedInstance
+}
+
+// isolatedInstance is the network namespace of an instance, attached to the
+// bridge of its run through a veth pair.
+type isolatedInstance struct {
+	ns   netns.NsHandle
+	veth netlink.Link
+	ip   net.IP
+}
+
+// newRunNetwork creates the bridge of a run, on a data subnet unused on the
+// host.
+func newRunNetwork() (rn *runNetwork, err error) {
+	runNetworksLk.Lock()
+	defer runNetworksLk.Unlock()
+
+	addrs, err := netlink.AddrList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, err
+	}
+
+	rn = new(runNetwork)
+	for n := 0; rn.subnet == nil; n++ {
+		subnet, gw, err := nextDataNetwork(n)
+		if err != nil {
+			return nil, err
+		}
+		if !subnetInUse(subnet, addrs) {
+			rn.subnet, rn.gateway = subnet, net.ParseIP(gw).To4()
+		}
+	}
+
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "tgbr" + randomSuffix()}}
+	if err := netlink.LinkAdd(bridge); err != nil {
+		return nil, fmt.Errorf("failed to create bridge: %w", err)
+	}
+	rn.bridge = bridge
+	defer func() {
+		if err != nil {
+			rn.remove()
+		}
+	}()
+
+	addr := &netlink.Addr{IPNet: &net.IPNet{IP: rn.gateway, Mask: rn.subnet.Mask}}
+	if err := netlink.AddrAdd(bridge, addr); err != nil {
+		return nil, fmt.Errorf("failed to assign gateway address to bridge: %w", err)
+	}
+	if err := netlink.LinkSetUp(bridge); err != nil {
+		return nil, err
+	}
+	return rn, nil
+}
+
+func subnetInUse(subnet *net.IPNet, addrs []netlink.Addr) bool {
+	for _, a := range addrs {
+		if subnet.Contains(a.IP) || a.IPNet.Contains(subnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// attach creates the network namespace of a new instance, and attaches it to
+// the bridge with the next address of the subnet.
+func (rn *runNetwork) attach() (inst *isolatedInstance, err error) {
+	rn.hosts++
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(rn.subnet.IP.To4())+rn.hosts+1)
+	if !rn.subnet.Contains(ip) {
+		return nil, errors.New("data subnet exhausted")
+	}
+
+	ns, err := newNetns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network namespace: %w", err)
+	}
+	inst = &isolatedInstance{ns: ns, ip: ip}
+	rn.instances = append(rn.instances, inst)
+
+	suffix := randomSuffix()
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: "tgv" + suffix},
+		PeerName:  "tgp" + suffix,
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return nil, fmt.Errorf("failed to create veth pair: %w", err)
+	}
+	inst.veth = veth
+
+	peer, err := netlink.LinkByName(veth.PeerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := netlink.LinkSetNsFd(peer, int(ns)); err != nil {
+		return nil, fmt.Errorf("failed to move veth into network namespace: %w", err)
+	}
+	if err := netlink.LinkSetMaster(veth, rn.bridge); err != nil {
+		return nil, fmt.Errorf("failed to attach veth to bridge: %w", err)
+	}
+	if err := netlink.LinkSetUp(veth); err != nil {
+		return nil, err
+	}
+
+	// configure the namespace side.
+	nl, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, err
+	}
+	defer nl.Delete()
+
+	if peer, err = nl.LinkByName(veth.PeerName); err != nil {
+		return nil, err
+	}
+	if err := nl.LinkSetName(peer, isolatedIfname); err != nil {
+		return nil, err
+	}
+	if err := nl.AddrAdd(peer, &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: rn.subnet.Mask}}); err != nil {
+		return nil, err
+	}
+	if err := nl.LinkSetUp(peer); err != nil {
+		return nil, err
+	}
+	lo, err := nl.LinkByName("lo")
+	if err != nil {
+		return nil, err
+	}
+	return inst, nl.LinkSetUp(lo)
+}
+
+// remove tears down the namespaces of the instances and the bridge.
+func (rn *runNetwork) remove() {
+	for _, inst := range rn.instances {
+		if inst.veth != nil {
+			_ = netlink.LinkDel(inst.veth)
+		}
+		_ = inst.ns.Close()
+	}
+	if rn.bridge != nil {
+		_ = netlink.LinkDel(rn.bridge)
+	}
+}
+
+// newNetns creates a network namespace without entering it.
+func newNetns() (netns.NsHandle, error) {
+	var (
+		ns  netns.NsHandle
+		err error
+	)
+	onThread(func() bool {
+		var orig netns.NsHandle
+		if orig, err = netns.Get(); err != nil {
+			return true
+		}
+		defer orig.Close()
+
+		if ns, err = netns.New(); err != nil {
+			return true
+		}
+		if err = netns.Set(orig); err != nil {
+			_ = ns.Close()
+			return false
+		}
+		return true
+	})
+	return ns, err
+}
+
+// start starts the process of the instance in its network namespace, and in a
+// UTS namespace of its own with the given hostname, which the SDK identifies
+// the instance by when requesting network changes.
+func (inst *isolatedInstance) start(cmd *exec.Cmd, hostname string) error {
+	var err error
+	onThread(func() bool {
+		var origNet, origUTS netns.NsHandle
+		if origNet, err = netns.Get(); err != nil {
+			return true
+		}
+		defer origNet.Close()
+		if origUTS, err = netns.GetFromPath(fmt.Sprintf("/proc/self/task/%d/ns/uts", syscall.Gettid())); err != nil {
+			return true
+		}
+		defer origUTS.Close()
+
+		if err = syscall.Unshare(syscall.CLONE_NEWUTS); err != nil {
+			return true
+		}
+		if err = syscall.Sethostname([]byte(hostname)); err == nil {
+			if err = netns.Set(inst.ns); err == nil {
+				err = cmd.Start()
+			}
+		}
+		return netns.Set(origNet) == nil && netns.Setns(origUTS, syscall.CLONE_NEWUTS) == nil
+	})
+	return err
+}
+
+// onThread runs f on a dedicated OS thread, which is discarded unless f
+// reports that it restored the namespaces of the thread.
+func onThread(f func() (restored bool)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		runtime.LockOSThread()
+		if f() {
+			runtime.UnlockOSThread()
+		}
+	}()
+	<-done
+}
+
+// manage applies the network configurations requested by the instance until
+// ctx is done, like the sidecar does on other runners.
+func (inst *isolatedInstance) manage(ctx context.Context, client ss.Client, params tgruntime.RunParams, hostname string, gateway net.IP) error {
+	nw, err := sidecar.NewLocalNetwork(inst.ns, isolatedIfname, gateway)
+	if err != nil {
+		return err
+	}
+
+	params.TestOutputsPath = ""
+	si, err := sidecar.NewInstance(client, tgruntime.NewRunEnv(params), hostname, nw)
+	if err != nil {
+		_ = nw.Close()
+		return err
+	}
+	return sidecar.HandleInstance(ctx, si)
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunNetworkIsolation(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	rn, err := newRunNetwork()
+	if err != nil {
+		t.Skipf("cannot create networks: %s", err)
+	}
+	defer rn.remove()
+
+	inst, err := rn.attach()
+	if err != nil {
+		t.Fatalf("failed to attach instance: %s", err)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("cat", "/proc/sys/kernel/hostname", "/proc/net/dev")
+	cmd.Stdout = &out
+	if err := inst.start(cmd, "single-0"); err != nil {
+		t.Fatalf("failed to start instance: %s", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(out.String(), "single-0\n") {
+		t.Errorf("instance does not have its own hostname:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), isolatedIfname+":") || strings.Contains(out.String(), rn.bridge.Attrs().Name) {
+		t.Errorf("instance does not have its own network:\n%s", out.String())
+	}
+
+	if h, _ := os.Hostname(); h == "single-0" {
+		t.Error("hostname of the daemon changed")
+	}
+}
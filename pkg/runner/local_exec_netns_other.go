@@ -0,0 +1,41 @@
+//go:build !linux
+// +build !linux
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+
+	tgruntime "github.com/testground/sdk-go/runtime"
+	ss "github.com/testground/sdk-go/sync"
+)
+
+type runNetwork struct {
+	subnet  *net.IPNet
+	gateway net.IP
+}
+
+type isolatedInstance struct {
+	ip net.IP
+}
+
+func newRunNetwork() (*runNetwork, error) {
+	return nil, errors.New("network isolation is only supported on Linux")
+}
+
+func (*runNetwork) attach() (*isolatedInstance, error) {
+	return nil, errors.New("network isolation is only supported on Linux")
+}
+
+func (*runNetwork) remove() {}
+
+func (*isolatedInstance) start(cmd *exec.Cmd, hostname string) error {
+	return cmd.Start()
+}
+
+func (*isolatedInstance) manage(ctx context.Context, client ss.Client, params tgruntime.RunParams, hostname string, gateway net.IP) error {
+	return nil
+}
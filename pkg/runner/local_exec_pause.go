@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/testground/testground/pkg/api"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+var _ api.Pauser = (*LocalExecutableRunner)(nil)
+
+func (r *LocalExecutableRunner) trackProcess(runID string, cmd *exec.Cmd) {
+	r.procsLk.Lock()
+	defer r.procsLk.Unlock()
+
+	if r.procs == nil {
+		r.procs = make(map[string][]*exec.Cmd)
+	}
+	r.procs[runID] = append(r.procs[runID], cmd)
+}
+
+func (r *LocalExecutableRunner) forgetProcesses(runID string) {
+	r.procsLk.Lock()
+	delete(r.procs, runID)
+	r.procsLk.Unlock()
+}
+
+// PauseRun stops the process groups of the instances of a run with SIGSTOP.
+func (r *LocalExecutableRunner) PauseRun(_ context.Context, in *api.PauseInput, ow *rpc.OutputWriter) error {
+	return r.pauseProcesses(in.RunID, ow, true)
+}
+
+// ResumeRun continues the stopped process groups of a run with SIGCONT.
+func (r *LocalExecutableRunner) ResumeRun(_ context.Context, in *api.PauseInput, ow *rpc.OutputWriter) error {
+	return r.pauseProcesses(in.RunID, ow, false)
+}
+
+func (r *LocalExecutableRunner) pauseProcesses(runID string, ow *rpc.OutputWriter, pause bool) error {
+	r.procsLk.Lock()
+	defer r.procsLk.Unlock()
+
+	cmds := r.procs[runID]
+	if len(cmds) == 0 {
+		return fmt.Errorf("run %s has no running instances", runID)
+	}
+	for _, cmd := range cmds {
+		if err := pauseProcessGroup(cmd, pause); err != nil {
+			return fmt.Errorf("failed to signal instance with pid %d: %w", cmd.Process.Pid, err)
+		}
+	}
+
+	if pause {
+		ow.Infow("paused instances", "run_id", runID, "count", len(cmds))
+	} else {
+		ow.Infow("resumed instances", "run_id", runID, "count", len(cmds))
+	}
+	return nil
+}
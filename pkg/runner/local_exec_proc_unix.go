@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package runner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// platformEnvVars are the variables of the environment of the daemon passed
+// on to instances, besides PATH.
+var platformEnvVars = []string{"HOME", "TMPDIR"}
+
+// setProcessGroup makes cmd the leader of a new process group, so that the
+// processes it spawns can be killed along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessGroup kills the process group led by a started cmd.
+func killProcessGroup(cmd *exec.Cmd) {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// pauseProcessGroup stops the process group led by a started cmd, or
+// continues it if pause is false.
+func pauseProcessGroup(cmd *exec.Cmd, pause bool) error {
+	sig := syscall.SIGCONT
+	if pause {
+		sig = syscall.SIGSTOP
+	}
+	// the instance may have exited already.
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
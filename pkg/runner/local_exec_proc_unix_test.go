@@ -0,0 +1,92 @@
+//go:build !windows
+// +build !windows
+
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillProcessGroup(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 60 & echo $!; wait")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	killProcessGroup(cmd)
+	_ = cmd.Wait()
+
+	// the child is reparented and reaped by init once killed.
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+		if err := syscall.Kill(child, 0); err == syscall.ESRCH {
+			return
+		}
+	}
+	t.Errorf("child process %d survived", child)
+}
+
+func TestPauseProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no procfs")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		killProcessGroup(cmd)
+		_ = cmd.Wait()
+	}()
+
+	// state returns the state of the process, as reported by procfs.
+	state := func() string {
+		b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", cmd.Process.Pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := strings.Fields(string(b)[strings.LastIndex(string(b), ")")+1:])
+		return fields[0]
+	}
+	waitState := func(want string) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+			if state() == want {
+				return
+			}
+		}
+		t.Fatalf("process is in state %s; expected %s", state(), want)
+	}
+
+	if err := pauseProcessGroup(cmd, true); err != nil {
+		t.Fatal(err)
+	}
+	waitState("T")
+
+	if err := pauseProcessGroup(cmd, false); err != nil {
+		t.Fatal(err)
+	}
+	waitState("S")
+}
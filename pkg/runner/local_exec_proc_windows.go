@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// platformEnvVars are the variables of the environment of the daemon passed
+// on to instances, besides PATH. Go programs need SYSTEMROOT for networking.
+var platformEnvVars = []string{"SYSTEMROOT", "USERPROFILE", "TEMP", "TMP", "LOCALAPPDATA"}
+
+// setProcessGroup makes cmd the root of a new process group, so that the
+// processes it spawns can be killed along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// killProcessGroup kills the process tree rooted at a started cmd.
+func killProcessGroup(cmd *exec.Cmd) {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// pauseProcessGroup is not supported on windows, which has no equivalent of
+// job control signals.
+func pauseProcessGroup(cmd *exec.Cmd, pause bool) error {
+	return errors.New("pausing instances is not supported on windows")
+}
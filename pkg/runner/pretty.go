@@ -2,10 +2,11 @@ package runner
 
 import (
 	"bufio"
-	"context"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	goruntime "runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/testground/testground/pkg/logging"
 	"github.com/testground/testground/pkg/rpc"
 
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/logrusorgru/aurora"
 )
 
@@ -36,6 +38,23 @@ func (et eventType) String() string {
 	return [...]string{"Error", "Start", "Ok", "Fail", "Crash", "Incomplete", "Message", "Metric", "Other", "InternalErr"}[et]
 }
 
+// The output of instances is read by a goroutine per stream, which only
+// splits it into lines. The lines are parsed and formatted by a fixed pool of
+// workers, each instance being pinned to one so that its lines stay in order.
+// Formatted lines are queued, and logged in batches by a single goroutine, so
+// that the output of hundreds of instances doesn't contend on the logger.
+// Instances are slowed down when the queues are full.
+const (
+	prettyQueueSize     = 4096
+	prettyBatchSize     = 256
+	prettyFlushInterval = 100 * time.Millisecond
+	// prettyMaxLine is the length beyond which lines are cut.
+	prettyMaxLine = bufio.MaxScanTokenSize
+)
+
+// prettyWorkers is the number of workers parsing the output of instances.
+var prettyWorkers = goruntime.NumCPU()
+
 // PrettyPrinter is a logger that sends output to the console.
 type PrettyPrinter struct {
 	aurora  aurora.Aurora
@@ -47,13 +66,37 @@ type PrettyPrinter struct {
 	count  uint32
 
 	start time.Time
-	wg    sync.WaitGroup
+	// wg tracks the instances waited by Wait.
+	wg sync.WaitGroup
+
+	// work are the queues of the workers.
+	work    []chan prettyWork
+	workers sync.WaitGroup
+	// idle is closed once the workers stopped, after the printer was closed.
+	idle chan struct{}
+
+	lines     chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+	flushed   chan struct{}
+}
+
+// prettyWork is a line of output of an instance, or the end of one of its
+// outputs, to be handled by a worker.
+type prettyWork struct {
+	o      *instanceOutput
+	line   []byte
+	stderr bool
+	// end is set once the output ended, with err the error it ended with,
+	// if any.
+	end bool
+	err error
 }
 
 // NewPrettyPrinter constructs a new console logger.
 func NewPrettyPrinter(ow *rpc.OutputWriter) *PrettyPrinter {
 	au := aurora.NewAurora(logging.IsTerminal())
-	return &PrettyPrinter{
+	pp := &PrettyPrinter{
 		aurora: au,
 		classes: [...]aurora.Value{
 			aurora.BgRed("ERROR").White(),
@@ -67,8 +110,123 @@ func NewPrettyPrinter(ow *rpc.OutputWriter) *PrettyPrinter {
 			aurora.BgMagenta("OTHER").White(),
 			aurora.BgBrightRed("INTERNAL_ERR").White(),
 		},
-		start: time.Now(),
-		ow:    ow,
+		start:   time.Now(),
+		ow:      ow,
+		work:    make([]chan prettyWork, prettyWorkers),
+		idle:    make(chan struct{}),
+		lines:   make(chan string, prettyQueueSize),
+		closed:  make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	for i := range pp.work {
+		pp.work[i] = make(chan prettyWork, prettyQueueSize/len(pp.work)+1)
+		pp.workers.Add(1)
+		go pp.worker(pp.work[i])
+	}
+	go func() {
+		pp.workers.Wait()
+		close(pp.idle)
+	}()
+	go pp.flushLoop()
+	return pp
+}
+
+// Close writes the output still queued, and stops the printer. Output
+// printed afterwards is dropped.
+func (c *PrettyPrinter) Close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+	<-c.flushed
+}
+
+// worker handles the output queued to it, until the printer is closed.
+func (c *PrettyPrinter) worker(work <-chan prettyWork) {
+	defer c.workers.Done()
+	for {
+		select {
+		case w := <-work:
+			c.handle(w)
+		case <-c.closed:
+			for {
+				select {
+				case w := <-work:
+					c.handle(w)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *PrettyPrinter) handle(w prettyWork) {
+	o := w.o
+	switch {
+	case w.end:
+		if w.err != nil {
+			c.print(o.idx, o.id, time.Now(), Error, w.err)
+		}
+		if !w.stderr {
+			o.finish()
+		}
+		if o.waited {
+			c.wg.Done()
+		}
+	case w.stderr:
+		c.print(o.idx, o.id, time.Now(), Error, string(w.line))
+	default:
+		o.stdoutLine(w.line)
+	}
+}
+
+// enqueue hands output to the worker of its instance. Output is dropped once
+// the printer is closed.
+func (c *PrettyPrinter) enqueue(w prettyWork) {
+	select {
+	case c.work[w.o.idx%uint32(len(c.work))] <- w:
+	case <-c.closed:
+		if w.end && w.o.waited {
+			c.wg.Done()
+		}
+	}
+}
+
+// flushLoop logs the formatted lines in batches, through the logger of the
+// output writer, until the workers have stopped.
+func (c *PrettyPrinter) flushLoop() {
+	defer close(c.flushed)
+
+	var (
+		batch  = make([]string, 0, prettyBatchSize)
+		ticker = time.NewTicker(prettyFlushInterval)
+	)
+	defer ticker.Stop()
+
+	flush := func() {
+		for _, l := range batch {
+			c.ow.Info(l)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case l := <-c.lines:
+			if batch = append(batch, l); len(batch) >= prettyBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-c.idle:
+			for {
+				select {
+				case l := <-c.lines:
+					batch = append(batch, l)
+				default:
+					flush()
+					return
+				}
+			}
+		}
 	}
 }
 
@@ -93,125 +251,171 @@ func (c *PrettyPrinter) FailStart(id string, message interface{}) {
 	c.print(cnt-1, id, time.Now(), Incomplete, "failed to start:", message)
 }
 
-// processStderr processes unstructured log output that's not managed by zap, in
+// processStderr queues unstructured log output that's not managed by zap, in
 // a line-by-line fashion.
-func (c *PrettyPrinter) processStderr(idx uint32, id string, stderr io.ReadCloser) {
+func (c *PrettyPrinter) processStderr(o *instanceOutput, stderr io.ReadCloser) {
 	defer stderr.Close()
 
 	scanner := bufio.NewScanner(stderr)
-
 	for scanner.Scan() {
-		c.print(idx, id, time.Now(), Error, scanner.Text())
+		c.enqueue(prettyWork{o: o, line: copyLine(scanner.Bytes()), stderr: true})
 	}
+	c.enqueue(prettyWork{o: o, stderr: true, end: true, err: scanner.Err()})
+}
 
-	if err := scanner.Err(); err != nil {
-		c.print(idx, id, time.Now(), Error, err)
+// processStdout queues structured log output managed by zap.
+func (c *PrettyPrinter) processStdout(o *instanceOutput, stdout io.ReadCloser) {
+	defer stdout.Close()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		c.enqueue(prettyWork{o: o, line: copyLine(scanner.Bytes())})
 	}
+	c.enqueue(prettyWork{o: o, end: true})
 }
 
-// processStdout processes structured log output managed by zap.
-func (c *PrettyPrinter) processStdout(idx uint32, id string, stdout io.ReadCloser) {
-	defer stdout.Close()
+// processMultiplexed queues the stdout and stderr of an instance multiplexed
+// into a single docker stream.
+func (c *PrettyPrinter) processMultiplexed(o *instanceOutput, stream io.ReadCloser) {
+	defer stream.Close()
+
+	stdout := &lineWriter{fn: func(line []byte) {
+		c.enqueue(prettyWork{o: o, line: copyLine(line)})
+	}}
+	stderr := &lineWriter{fn: func(line []byte) {
+		c.enqueue(prettyWork{o: o, line: copyLine(line), stderr: true})
+	}}
+
+	_, err := stdcopy.StdCopy(stdout, stderr, stream)
+	stdout.flush()
+	stderr.flush()
+	c.enqueue(prettyWork{o: o, end: true, err: err})
+}
 
-	var (
-		failed, ok bool
-		all        = make(map[string]json.RawMessage, 16)
-	)
+// copyLine copies a line out of the buffer of a reader, which reuses it.
+func copyLine(line []byte) []byte {
+	return append([]byte(nil), line...)
+}
 
-	defer func() {
-		if !ok && !failed {
-			// incomplete.
-			c.print(idx, id, time.Now(), Incomplete)
-		}
-		if !ok || failed {
-			atomic.AddUint32(&c.failed, 1)
-		}
-	}()
+// instanceOutput follows the structured output of an instance, line by line,
+// to tell whether it passed. It's only handled by the worker of the instance.
+type instanceOutput struct {
+	c   *PrettyPrinter
+	idx uint32
+	id  string
+	// waited is set if the instance is waited by Wait.
+	waited bool
+
+	failed, ok bool
+	// stopped is set when the output can't be followed anymore.
+	stopped bool
+	all     map[string]json.RawMessage
+}
 
-	for scanner := bufio.NewScanner(stdout); scanner.Scan(); {
-		// clear the map (optimized by the compiler).
-		for k := range all {
-			delete(all, k)
-		}
+// newInstanceOutput numbers a new instance, whose output is waited by Wait
+// once per output if waited is set.
+func (c *PrettyPrinter) newInstanceOutput(id string, waited bool, outputs int) *instanceOutput {
+	idx := atomic.AddUint32(&c.count, 1) - 1
+	if waited {
+		c.wg.Add(outputs)
+	}
+	return &instanceOutput{c: c, idx: idx, id: id, waited: waited, all: make(map[string]json.RawMessage, 16)}
+}
 
-		line := scanner.Bytes()
+func (o *instanceOutput) stdoutLine(line []byte) {
+	if o.stopped {
+		return
+	}
 
-		// decode the incoming log line.
-		switch err := json.Unmarshal(line, &all); err {
-		case nil:
-		case io.EOF, context.Canceled:
-			return
-		default:
-			c.print(idx, id, time.Now(), Other, string(line))
-			continue
-		}
+	c, idx, id := o.c, o.idx, o.id
 
-		var (
-			evt runtime.Event
-			ts  time.Time
-		)
+	// clear the map (optimized by the compiler).
+	for k := range o.all {
+		delete(o.all, k)
+	}
 
-		var nanos int64
-		_ = json.Unmarshal(all["ts"], &nanos)
-		ts = time.Unix(0, nanos)
+	// decode the incoming log line.
+	if err := json.Unmarshal(line, &o.all); err != nil {
+		c.print(idx, id, time.Now(), Other, string(line))
+		return
+	}
 
-		if err := json.Unmarshal(all["event"], &evt); err != nil {
-			c.print(idx, id, time.Now(), Other, string(line))
-			continue
-		}
+	var (
+		evt runtime.Event
+		ts  time.Time
+	)
 
-		switch {
-		case evt.SuccessEvent != nil:
-			ok = true
-			c.print(idx, id, ts, Ok, "")
-		case evt.FailureEvent != nil:
-			failed = true
-			c.print(idx, id, ts, Fail, evt.FailureEvent.Error)
-		case evt.CrashEvent != nil:
-			failed = true
-			c.print(idx, id, ts, Crash, evt.CrashEvent.Error, evt.CrashEvent.Stacktrace)
-		case evt.MessageEvent != nil:
-			c.print(idx, id, ts, Message, evt.Message)
-		case evt.StartEvent != nil:
-			m, _ := json.Marshal(evt.StartEvent.Runenv)
-			c.print(idx, id, ts, Start, string(m))
-		case evt.StageStartEvent != nil:
-		case evt.StageEndEvent != nil:
-		default:
-			c.print(idx, id, ts, InternalErr, fmt.Sprintf("unknown event: %v", evt))
-			return
-		}
+	var nanos int64
+	_ = json.Unmarshal(o.all["ts"], &nanos)
+	ts = time.Unix(0, nanos)
+
+	if err := json.Unmarshal(o.all["event"], &evt); err != nil {
+		c.print(idx, id, time.Now(), Other, string(line))
+		return
+	}
+
+	switch {
+	case evt.SuccessEvent != nil:
+		o.ok = true
+		c.print(idx, id, ts, Ok, "")
+	case evt.FailureEvent != nil:
+		o.failed = true
+		c.print(idx, id, ts, Fail, evt.FailureEvent.Error)
+	case evt.CrashEvent != nil:
+		o.failed = true
+		c.print(idx, id, ts, Crash, evt.CrashEvent.Error, evt.CrashEvent.Stacktrace)
+	case evt.MessageEvent != nil:
+		c.print(idx, id, ts, Message, evt.Message)
+	case evt.StartEvent != nil:
+		m, _ := json.Marshal(evt.StartEvent.Runenv)
+		c.print(idx, id, ts, Start, string(m))
+	case evt.StageStartEvent != nil:
+	case evt.StageEndEvent != nil:
+	default:
+		c.print(idx, id, ts, InternalErr, fmt.Sprintf("unknown event: %v", evt))
+		o.stopped = true
+	}
+}
+
+// finish records the outcome of the instance once its output ends.
+func (o *instanceOutput) finish() {
+	if !o.ok && !o.failed {
+		// incomplete.
+		o.c.print(o.idx, o.id, time.Now(), Incomplete)
+	}
+	if !o.ok || o.failed {
+		atomic.AddUint32(&o.c.failed, 1)
 	}
 }
 
 // Manage should be called on the standard output of all instances. It will
 // send the events to a logger and record whether or not the test passed.
 func (c *PrettyPrinter) Manage(id string, stdout, stderr io.ReadCloser) {
-	idx := atomic.AddUint32(&c.count, 1) - 1
-
-	c.wg.Add(2)
-	go func() {
-		defer c.wg.Done()
-		c.processStderr(idx, id, stderr)
-	}()
+	o := c.newInstanceOutput(id, true, 2)
+	go c.processStderr(o, stderr)
+	go c.processStdout(o, stdout)
+}
 
-	go func() {
-		defer c.wg.Done()
-		c.processStdout(idx, id, stdout)
-	}()
+// ManageMultiplexed is the same as Manage, for the stdout and stderr of an
+// instance multiplexed into a single docker stream, which is read by a
+// single goroutine.
+func (c *PrettyPrinter) ManageMultiplexed(id string, stream io.ReadCloser) {
+	o := c.newInstanceOutput(id, true, 1)
+	go c.processMultiplexed(o, stream)
 }
 
 // Append is the same as Manage, but doesn't wait for instance to exit.
 func (c *PrettyPrinter) Append(id string, stdout, stderr io.ReadCloser) {
-	idx := atomic.AddUint32(&c.count, 1) - 1
-
-	go func() {
-		c.processStderr(idx, id, stderr)
-	}()
+	o := c.newInstanceOutput(id, false, 2)
+	go c.processStderr(o, stderr)
+	go c.processStdout(o, stdout)
+}
 
-	go func() {
-		c.processStdout(idx, id, stdout)
-	}()
+// AppendMultiplexed is the same as ManageMultiplexed, but doesn't wait for
+// the instance to exit.
+func (c *PrettyPrinter) AppendMultiplexed(id string, stream io.ReadCloser) {
+	o := c.newInstanceOutput(id, false, 1)
+	go c.processMultiplexed(o, stream)
 }
 
 func (c *PrettyPrinter) print(idx uint32, id string, now time.Time, evtType eventType, message ...interface{}) {
@@ -225,10 +429,64 @@ func (c *PrettyPrinter) print(idx uint32, id string, now time.Time, evtType even
 		elapsed = 0
 	}
 
-	c.ow.Infof("%5.4fs %10s %s %s",
+	line := fmt.Sprintf("%5.4fs %10s %s %s",
 		float64(elapsed)/float64(time.Second),
 		class,
 		c.aurora.Index(uint8(idx%15)+1, "<< "+id+" >>"),
 		msg,
 	)
+
+	select {
+	case c.lines <- line:
+	case <-c.flushed:
+	}
+}
+
+// lineWriter splits what is written to it into lines, without their line
+// feeds, and hands them to fn. Lines longer than prettyMaxLine are cut.
+type lineWriter struct {
+	fn  func(line []byte)
+	buf []byte
+	// skip is set while the rest of a line that was cut is discarded.
+	skip bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.append(p)
+			break
+		}
+		w.append(p[:i])
+		if !w.skip {
+			w.flush()
+		}
+		w.skip = false
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (w *lineWriter) append(p []byte) {
+	if w.skip {
+		return
+	}
+	if room := prettyMaxLine - len(w.buf); len(p) > room {
+		w.buf = append(w.buf, p[:room]...)
+		w.flush()
+		w.skip = true
+		return
+	}
+	w.buf = append(w.buf, p...)
+}
+
+// flush hands what is buffered to fn as a line, if anything.
+func (w *lineWriter) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	w.fn(bytes.TrimSuffix(w.buf, []byte{'\r'}))
+	w.buf = w.buf[:0]
 }
@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/testground/testground/pkg/client"
+	"github.com/testground/testground/pkg/rpc"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line []byte) { lines = append(lines, string(line)) }}
+
+	long := strings.Repeat("x", prettyMaxLine+10)
+	for _, chunk := range []string{"he", "llo\nwor", "ld\r\n\n", long, "\nlast"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.flush()
+
+	want := []string{"hello", "world", long[:prettyMaxLine], "last"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(lines))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: expected %.20q, got %.20q", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestPrettyPrinterMultiplexed(t *testing.T) {
+	var out bytes.Buffer
+	ow := rpc.NewFileOutputWriter(&out)
+	pp := NewPrettyPrinter(ow)
+
+	var stream bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stdout).Write([]byte("not an event\n"))
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stderr).Write([]byte("boom\n"))
+
+	pp.ManageMultiplexed("single[000]", ioutil.NopCloser(&stream))
+
+	// the instance never reported an outcome.
+	if err := <-pp.Wait(); err == nil {
+		t.Error("expected the instance to be counted as failed")
+	}
+	pp.Close()
+	ow.WriteResult(true)
+
+	var progress bytes.Buffer
+	if _, err := client.ParseCollectResponse(ioutil.NopCloser(&out), ioutil.Discard, &progress); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"not an event", "boom", "INCOMPLETE", "<< single[000] >>"} {
+		if !strings.Contains(progress.String(), want) {
+			t.Errorf("output is missing %q", want)
+		}
+	}
+}
+
+func TestPrettyPrinterKeepsInstanceOrder(t *testing.T) {
+	var out bytes.Buffer
+	ow := rpc.NewFileOutputWriter(&out)
+	pp := NewPrettyPrinter(ow)
+
+	const instances, lines = 50, 100
+	for i := 0; i < instances; i++ {
+		var stream bytes.Buffer
+		w := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+		for l := 0; l < lines; l++ {
+			_, _ = fmt.Fprintf(w, "line-%d\n", l)
+		}
+		pp.ManageMultiplexed(fmt.Sprintf("single[%03d]", i), ioutil.NopCloser(&stream))
+	}
+	<-pp.Wait()
+	pp.Close()
+	ow.WriteResult(true)
+
+	var progress bytes.Buffer
+	if _, err := client.ParseCollectResponse(ioutil.NopCloser(&out), ioutil.Discard, &progress); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lines of every instance are printed, in order.
+	next := make(map[string]int, instances)
+	for _, line := range strings.Split(progress.String(), "\n") {
+		i := strings.Index(line, "<< single[")
+		if i < 0 || !strings.Contains(line, "line-") {
+			continue
+		}
+		id := line[i : i+len("<< single[000]")]
+		if want := fmt.Sprintf("line-%d", next[id]); !strings.HasSuffix(line, want) {
+			t.Fatalf("%s: expected %s, got %q", id, want, line)
+		}
+		next[id]++
+	}
+	if len(next) != instances {
+		t.Fatalf("expected the output of %d instances, got %d", instances, len(next))
+	}
+	for id, n := range next {
+		if n != lines {
+			t.Errorf("%s: expected %d lines, got %d", id, lines, n)
+		}
+	}
+}
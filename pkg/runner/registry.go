@@ -1,7 +1,11 @@
 package runner
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/testground/testground/pkg/api"
 	"github.com/testground/testground/pkg/docker"
@@ -9,6 +13,12 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 func (c *ClusterK8sRunner) pushToDockerRegistry(ctx context.Context, ow *rpc.OutputWriter, client *client.Client, in *api.RunInput, ipo types.ImagePushOptions, uri string) error {
@@ -45,3 +55,199 @@ func (c *ClusterK8sRunner) pushToDockerRegistry(ctx context.Context, ow *rpc.Out
 
 	return nil
 }
+
+// importImagesToNodes distributes the images of a run to all plan nodes when
+// no registry is available. The images are saved into a tarball on the shared
+// volume, which a privileged DaemonSet then imports into the containerd image
+// store of every node.
+func (c *ClusterK8sRunner) importImagesToNodes(ctx context.Context, ow *rpc.OutputWriter, cli *client.Client, in *api.RunInput, timeout time.Duration) error {
+	cfg := *in.RunnerConfig.(*ClusterK8sRunnerConfig)
+	if cfg.ImageImportTool == "" {
+		cfg.ImageImportTool = DefaultImageImportTool
+	}
+
+	start := time.Now()
+	ow.Info("importing images onto plan nodes")
+	defer func() { ow.Infow("importing of images finished", "took", time.Since(start).Truncate(time.Second)) }()
+
+	// Image IDs can't be referenced from pod specs; tag the images.
+	var tags []string
+	for _, g := range in.Groups {
+		tag := fmt.Sprintf("testground-%s:%s", in.TestPlan, g.ArtifactPath)
+		ow.Infow("tagging image", "group_id", g.ID, "tag", tag)
+		if err := cli.ImageTag(ctx, g.ArtifactPath, tag); err != nil {
+			return err
+		}
+		g.ArtifactPath = tag
+		tags = append(tags, tag)
+	}
+
+	err := c.ensureCollectOutputsPod(ctx, &api.CollectionInput{
+		EnvConfig:    in.EnvConfig,
+		RunID:        in.RunID,
+		RunnerID:     c.ID(),
+		RunnerConfig: in.RunnerConfig,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Stream the images into a tarball on the shared volume.
+	tarball := fmt.Sprintf("/outputs/images/%s.tar", in.RunID)
+
+	rc, err := cli.ImageSave(ctx, tags)
+	if err != nil {
+		return fmt.Errorf("failed to save images: %w", err)
+	}
+	defer rc.Close()
+
+	ow.Infow("copying images to the shared volume", "tarball", tarball)
+	if err := c.execInCollectOutputsPod(ctx, rc, "sh", "-c", fmt.Sprintf("mkdir -p /outputs/images && cat > %s", tarball)); err != nil {
+		return fmt.Errorf("failed to copy images to the shared volume: %w", err)
+	}
+	defer func() {
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		if err := c.execInCollectOutputsPod(ctx, nil, "rm", "-f", tarball); err != nil {
+			ow.Warnw("failed to remove images tarball", "tarball", tarball, "err", err)
+		}
+	}()
+
+	k8s := c.pool.Acquire()
+	defer c.pool.Release(k8s)
+
+	name := fmt.Sprintf("tg-import-%s", in.RunID)
+	labels := map[string]string{
+		"testground.run_id":  in.RunID,
+		"testground.purpose": "import",
+	}
+
+	var (
+		privileged           = true
+		socketType           = v1.HostPathSocket
+		mountPropagationMode = v1.MountPropagationHostToContainer
+		sharedVolumeName     = "efs-shared"
+		socket               = "/run/containerd/containerd.sock"
+		done                 = "/tmp/imported"
+	)
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Volumes: []v1.Volume{
+						{
+							Name: sharedVolumeName,
+							VolumeSource: v1.VolumeSource{
+								PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "efs"},
+							},
+						},
+						{
+							Name: "containerd",
+							VolumeSource: v1.VolumeSource{
+								HostPath: &v1.HostPathVolumeSource{Path: socket, Type: &socketType},
+							},
+						},
+					},
+					Containers: []v1.Container{
+						{
+							Name:    "import",
+							Image:   cfg.ImageImportTool,
+							Command: []string{"sh", "-c"},
+							Args: []string{fmt.Sprintf("ctr --address %s -n k8s.io images import %s && touch %s && sleep 86400",
+								socket, tarball, done)},
+							SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+							VolumeMounts: []v1.VolumeMount{
+								{Name: sharedVolumeName, MountPath: "/outputs", MountPropagation: &mountPropagationMode},
+								{Name: "containerd", MountPath: socket},
+							},
+							ReadinessProbe: &v1.Probe{
+								Handler:       v1.Handler{Exec: &v1.ExecAction{Command: []string{"cat", done}}},
+								PeriodSeconds: 2,
+							},
+						},
+					},
+					NodeSelector: map[string]string{"testground.node.role.plan": "true"},
+				},
+			},
+		},
+	}
+
+	if _, err := k8s.AppsV1().DaemonSets(c.config.Namespace).Create(ctx, ds, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create image import daemonset: %w", err)
+	}
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		err := k8s.AppsV1().DaemonSets(c.config.Namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			ow.Warnw("failed to delete image import daemonset", "name", name, "err", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		current, err := k8s.AppsV1().DaemonSets(c.config.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			desired, ready := current.Status.DesiredNumberScheduled, current.Status.NumberReady
+			if desired > 0 && ready >= desired {
+				ow.Infow("imported images on all plan nodes", "nodes", ready)
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("image import incomplete after %s: %w", timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// execInCollectOutputsPod runs a command in the collect-outputs pod, which has
+// the shared volume attached, feeding it the supplied stdin, if any.
+func (c *ClusterK8sRunner) execInCollectOutputsPod(ctx context.Context, stdin io.Reader, cmd ...string) error {
+	k8sCfg, err := clientcmd.BuildConfigFromFlags("", c.config.KubeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	k8s := c.pool.Acquire()
+	defer c.pool.Release(k8s)
+
+	req := k8s.
+		CoreV1().
+		RESTClient().
+		Post().
+		Resource("pods").
+		Name(collectOutputsPodName).
+		Namespace(c.config.Namespace).
+		SubResource("exec").
+		Param("container", collectOutputsPodName).
+		VersionedParams(&v1.PodExecOptions{
+			Container: collectOutputsPodName,
+			Command:   cmd,
+			Stdin:     stdin != nil,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(k8sCfg, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	if err := exec.Stream(remotecommand.StreamOptions{Stdin: stdin, Stderr: &stderr}); err != nil {
+		return fmt.Errorf("%w; stderr: %s", err, stderr.String())
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	gosync "sync"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 
 	"github.com/testground/testground/pkg/docker"
 	"github.com/testground/testground/pkg/logging"
+	"github.com/testground/testground/pkg/syncsvc"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/hashicorp/go-multierror"
@@ -41,6 +43,7 @@ type K8sReactor struct {
 	gosync.Mutex
 
 	client          sync.Client
+	shardClients    *syncsvc.Clients
 	manager         *docker.Manager
 	allowedServices []AllowedService
 	runidsCache     *lru.Cache
@@ -60,17 +63,20 @@ func NewK8sReactor() (Reactor, error) {
 	cache, _ := lru.New(32)
 
 	r := &K8sReactor{
-		client:      client,
-		manager:     docker,
-		runidsCache: cache,
+		client:       client,
+		shardClients: syncsvc.NewClients(context.Background(), logging.S()),
+		manager:      docker,
+		runidsCache:  cache,
 	}
 
-	r.ResolveServices("constructor")
+	r.ResolveServices("constructor", os.Getenv(EnvSyncServiceHost))
 
 	return r, nil
 }
 
-func (d *K8sReactor) ResolveServices(runid string) {
+// ResolveServices resolves the services instances of a run reach, including
+// the sync service shard at syncHost.
+func (d *K8sReactor) ResolveServices(runid string, syncHost string) {
 	d.Lock()
 	defer d.Unlock()
 
@@ -84,7 +90,7 @@ func (d *K8sReactor) ResolveServices(runid string) {
 	}{
 		{
 			"sync-service",
-			os.Getenv(EnvSyncServiceHost),
+			syncHost,
 		},
 		{
 			"influxdb",
@@ -134,6 +140,7 @@ func (d *K8sReactor) Close() error {
 	var err *multierror.Error
 	err = multierror.Append(err, d.manager.Close())
 	err = multierror.Append(err, d.client.Close())
+	err = multierror.Append(err, d.shardClients.Close())
 	return err.ErrorOrNil()
 }
 
@@ -163,8 +170,20 @@ func (d *K8sReactor) manageContainer(ctx context.Context, container *docker.Cont
 		return nil, fmt.Errorf("couldn't get pod name from container labels for: %s", container.ID)
 	}
 
+	// Runs may be sharded across sync service instances; use the one the
+	// instance was pointed to.
+	client := d.client
+	syncHost := containerEnv(info.Config.Env, EnvSyncServiceHost)
+	if syncHost == "" {
+		syncHost = os.Getenv(EnvSyncServiceHost)
+	} else if syncHost != os.Getenv(EnvSyncServiceHost) {
+		if client, err = d.shardClients.Get(syncHost); err != nil {
+			return nil, err
+		}
+	}
+
 	// Resolve allowed services, so that we update network routes
-	d.ResolveServices(params.TestRun)
+	d.ResolveServices(params.TestRun, syncHost)
 
 	err = waitForPodRunningPhase(ctx, podName)
 	if err != nil {
@@ -242,7 +261,17 @@ func (d *K8sReactor) manageContainer(ctx context.Context, container *docker.Cont
 		}
 	}
 
-	return NewInstance(d.client, runenv, info.Config.Hostname, network)
+	return NewInstance(client, runenv, info.Config.Hostname, network)
+}
+
+// containerEnv returns the value of an environment variable of a container.
+func containerEnv(env []string, name string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			return kv[len(name)+1:]
+		}
+	}
+	return ""
 }
 
 func waitForPodRunningPhase(ctx context.Context, podName string) error {
@@ -0,0 +1,131 @@
+//go:build linux
+// +build linux
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	"github.com/testground/sdk-go/network"
+)
+
+// LocalNetwork is the network of a local:exec instance isolated in its own
+// network namespace, and attached to the bridge of its run by a veth pair.
+//
+// local:exec has no sidecar process: the runner manages the networks of its
+// instances in-process, through HandleInstance.
+type LocalNetwork struct {
+	nl      *netlink.Handle
+	link    *NetlinkLink
+	ipv4    *net.IPNet
+	gateway net.IP
+	enabled bool
+}
+
+var _ Network = (*LocalNetwork)(nil)
+
+// NewLocalNetwork constructs the network of the instance living in the network
+// namespace ns, whose data link is ifname. External traffic is routed through
+// gateway, when allowed.
+func NewLocalNetwork(ns netns.NsHandle, ifname string, gateway net.IP) (n *LocalNetwork, err error) {
+	nl, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get handle to network namespace: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			nl.Delete()
+		}
+	}()
+
+	link, err := nl.LinkByName(ifname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link by name %s: %w", ifname, err)
+	}
+
+	addrs, err := nl.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("link %s has no address", ifname)
+	}
+
+	handle, err := NewNetlinkLink(nl, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalNetwork{
+		nl:      nl,
+		link:    handle,
+		ipv4:    addrs[0].IPNet,
+		gateway: gateway,
+		enabled: link.Attrs().Flags&net.FlagUp != 0,
+	}, nil
+}
+
+func (n *LocalNetwork) Close() error {
+	n.nl.Delete()
+	return nil
+}
+
+func (n *LocalNetwork) ListActive() []string {
+	if !n.enabled {
+		return nil
+	}
+	return []string{defaultDataNetwork}
+}
+
+func (n *LocalNetwork) ConfigureNetwork(ctx context.Context, cfg *network.Config) error {
+	if cfg.Network != defaultDataNetwork {
+		return fmt.Errorf("unsupported network: %s", cfg.Network)
+	}
+
+	// Routing outside of the data network goes through the host, and is
+	// denied unless explicitly allowed, like on other runners.
+	defaultRoute := &netlink.Route{LinkIndex: n.link.Attrs().Index, Gw: n.gateway}
+	if cfg.RoutingPolicy == network.AllowAll {
+		if err := n.nl.RouteReplace(defaultRoute); err != nil {
+			return fmt.Errorf("failed to add default route: %w", err)
+		}
+	} else if err := n.nl.RouteDel(defaultRoute); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to remove default route: %w", err)
+	}
+
+	if !cfg.Enable {
+		n.enabled = false
+		return n.link.Down()
+	}
+
+	if cfg.IPv4 != nil && !cfg.IPv4.IP.Equal(n.ipv4.IP) {
+		ipv4 := &net.IPNet{IP: cfg.IPv4.IP, Mask: n.ipv4.Mask}
+		if err := n.link.AddrAdd(ipv4); err != nil {
+			return err
+		}
+		if err := n.link.AddrDel(n.ipv4); err != nil {
+			return err
+		}
+		n.ipv4 = ipv4
+	}
+
+	if !n.enabled {
+		if err := n.link.Up(); err != nil {
+			return err
+		}
+		n.enabled = true
+	}
+
+	if err := n.link.Shape(cfg.Default); err != nil {
+		return err
+	}
+
+	return n.link.AddRules(cfg.Rules)
+}
@@ -0,0 +1,25 @@
+package sidecar
+
+import (
+	"time"
+
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/sync"
+)
+
+// NetworkChangesTopic is the topic of a run the sidecar publishes the network
+// changes it applies to, so that runners can record them in the timeline of
+// the run.
+var NetworkChangesTopic = sync.NewTopic("network-changes", &NetworkChange{})
+
+// NetworkChange is a network change applied to an instance.
+type NetworkChange struct {
+	// Hostname is the hostname of the instance.
+	Hostname string `json:"hostname"`
+	// GroupID is the group of the instance.
+	GroupID string `json:"group"`
+	// Time is when the change was applied, on the clock of the sidecar.
+	Time time.Time `json:"time"`
+	// Config is the applied configuration.
+	Config *network.Config `json:"config"`
+}
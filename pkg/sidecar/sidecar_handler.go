@@ -3,6 +3,7 @@ package sidecar
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/testground/sdk-go/network"
 	"github.com/testground/sdk-go/sync"
@@ -12,6 +13,12 @@ const (
 	defaultDataNetwork = "default"
 )
 
+// HandleInstance manages the network of an instance for its whole lifetime,
+// like the sidecar does. It is used by runners without a sidecar process.
+func HandleInstance(ctx context.Context, instance *Instance) error {
+	return handler(ctx, instance)
+}
+
 func handler(ctx context.Context, instance *Instance) error {
 	instance.S().Debugw("managing instance", "instance", instance.Hostname)
 
@@ -72,6 +79,16 @@ func handler(ctx context.Context, instance *Instance) error {
 				return fmt.Errorf("failed to update network %s: %w", cfg.Network, err)
 			}
 
+			change := &NetworkChange{
+				Hostname: instance.Hostname,
+				GroupID:  instance.RunEnv.TestGroupID,
+				Time:     time.Now(),
+				Config:   cfg,
+			}
+			if _, err := instance.Client.Publish(ctx, NetworkChangesTopic, change); err != nil {
+				instance.S().Warnw("failed to publish network change", "err", err)
+			}
+
 			if cfg.CallbackState != "" {
 				_, err := instance.Client.SignalEntry(ctx, cfg.CallbackState)
 				if err != nil {
@@ -21,7 +21,7 @@ var runners = map[string]func() (Reactor, error){
 	"docker": NewDockerReactor,
 	"k8s":    NewK8sReactor,
 	"mock":   NewMockReactor,
-	// TODO: local
+	// local:exec handles its instances in-process; see LocalNetwork.
 }
 
 // GetRunners lists the available sidecar environments.
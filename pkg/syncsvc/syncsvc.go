@@ -0,0 +1,125 @@
+// Package syncsvc locates the instances of the sync service that runs are
+// sharded across, and keeps clients to them.
+package syncsvc
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	ss "github.com/testground/sdk-go/sync"
+	"go.uber.org/zap"
+)
+
+// DefaultHost is the host of the sync service, and of its first shard.
+const DefaultHost = "testground-sync-service"
+
+// ShardHost returns the host of the sync service instance serving a run, when
+// runs are sharded across shards instances of the service. The first shard is
+// at host itself, and the n-th one at <host>-<n>.
+func ShardHost(host string, shards int, runID string) string {
+	if shards <= 1 {
+		return host
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(runID))
+	if n := h.Sum32() % uint32(shards); n > 0 {
+		return fmt.Sprintf("%s-%d", host, n)
+	}
+	return host
+}
+
+// hostKey carries the host of the sync service a client is created for, in
+// the context the client dials with.
+type hostKey struct{}
+
+func init() {
+	// sdk-go dials the sync service at the host it finds in the environment
+	// of the process, through http.DefaultClient. Rather than changing the
+	// environment of the whole process for each client, the host of a client
+	// is carried by the context it dials with, and substituted by a transport
+	// of http.DefaultClient of its own; http.DefaultTransport, which other
+	// clients share, is left alone. Other dials are left untouched.
+	if http.DefaultClient.Transport != nil {
+		return
+	}
+	dt, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return
+	}
+	t := dt.Clone()
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, ok := ctx.Value(hostKey{}).(string); ok {
+			if h, port, err := net.SplitHostPort(addr); err == nil && h == sdkHost() {
+				addr = net.JoinHostPort(host, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+	http.DefaultClient.Transport = t
+}
+
+// sdkHost returns the host sdk-go dials the sync service at.
+func sdkHost() string {
+	if host := os.Getenv(ss.EnvServiceHost); host != "" {
+		return host
+	}
+	return DefaultHost
+}
+
+// Clients keeps a sync client per sync service host, created on first use.
+type Clients struct {
+	ctx context.Context
+	log *zap.SugaredLogger
+
+	lk      sync.Mutex
+	clients map[string]*ss.DefaultClient
+}
+
+// NewClients returns an empty set of clients, whose lifecycle is governed by
+// ctx.
+func NewClients(ctx context.Context, log *zap.SugaredLogger) *Clients {
+	return &Clients{ctx: ctx, log: log, clients: make(map[string]*ss.DefaultClient)}
+}
+
+// Get returns a generic client to the sync service at host.
+func (c *Clients) Get(host string) (*ss.DefaultClient, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if client, ok := c.clients[host]; ok {
+		return client, nil
+	}
+
+	client, err := ss.NewGenericClient(context.WithValue(c.ctx, hostKey{}, host), c.log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to sync service at %s: %w", host, err)
+	}
+
+	c.clients[host] = client
+	return client, nil
+}
+
+// Close closes all clients.
+func (c *Clients) Close() error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	var err error
+	for host, client := range c.clients {
+		if cerr := client.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(c.clients, host)
+	}
+	return err
+}
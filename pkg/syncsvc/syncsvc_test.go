@@ -0,0 +1,65 @@
+package syncsvc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	ss "github.com/testground/sdk-go/sync"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardHost(t *testing.T) {
+	require.Equal(t, DefaultHost, ShardHost(DefaultHost, 0, "run"))
+	require.Equal(t, DefaultHost, ShardHost(DefaultHost, 1, "run"))
+
+	// runs are spread across all shards, and stick to theirs.
+	seen := make(map[string]bool)
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		host := ShardHost(DefaultHost, 3, id)
+		require.Equal(t, host, ShardHost(DefaultHost, 3, id))
+		seen[host] = true
+	}
+	require.Equal(t, map[string]bool{
+		DefaultHost:        true,
+		DefaultHost + "-1": true,
+		DefaultHost + "-2": true,
+	}, seen)
+}
+
+func TestDialHostFromContext(t *testing.T) {
+	if prev, ok := os.LookupEnv(ss.EnvServiceHost); ok {
+		_ = os.Unsetenv(ss.EnvServiceHost)
+		defer os.Setenv(ss.EnvServiceHost, prev)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	// the host sdk-go dials is substituted by the one of the context.
+	ctx := context.WithValue(context.Background(), hostKey{}, host)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(DefaultHost, port), nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// other clients, which share http.DefaultTransport, dial it as it is.
+	require.NotSame(t, http.DefaultTransport, http.DefaultClient.Transport)
+	_, err = (&http.Client{}).Do(req.Clone(ctx))
+	require.Error(t, err)
+
+	// other hosts are dialed as they are.
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+}
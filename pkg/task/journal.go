@@ -0,0 +1,118 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Claimants of tasks being processed.
+const (
+	// ClaimantLocal is the workers of this daemon.
+	ClaimantLocal = "local"
+	// ClaimantRemote is the workers of other daemons, pulling tasks from
+	// this one.
+	ClaimantRemote = "remote"
+)
+
+// JournalEntry is a state transition of a task. Transitions are journaled in
+// the same write as the task moving between the queue, processing and the
+// archive, so that the history of tasks interrupted by a crash of the daemon
+// can be reconstructed when it restarts.
+type JournalEntry struct {
+	Time  time.Time `json:"time"`
+	State State     `json:"state"`
+	// Claimant is who took the task for processing, for transitions to
+	// StateProcessing.
+	Claimant string `json:"claimant,omitempty"`
+	// Lease is the token of the claim of a remote worker, which the worker
+	// presents when reporting on the task.
+	Lease string `json:"lease,omitempty"`
+	// Note explains the transition, e.g. the error a task failed with.
+	Note string `json:"note,omitempty"`
+}
+
+// journalPrefix returns the prefix of the keys of the journal of a task.
+func journalPrefix(id string) ([]byte, error) {
+	key, err := taskKey(prefixJournal, id)
+	if err != nil {
+		return nil, err
+	}
+	return append(key, ':'), nil
+}
+
+// journalRecord returns the key and value of a journal entry. Keys sort in
+// the order of the entries.
+func journalRecord(id string, e JournalEntry) (key []byte, val []byte, err error) {
+	prefix, err := journalPrefix(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	val, err = json.Marshal(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(prefix, fmt.Sprintf("%020d", e.Time.UnixNano())...), val, nil
+}
+
+// Journal returns the state transitions of a task, oldest first.
+func (s *Storage) Journal(id string) ([]JournalEntry, error) {
+	prefix, err := journalPrefix(id)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	var entries []JournalEntry
+	for iter.Next() {
+		var e JournalEntry
+		if err := json.Unmarshal(iter.Value(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, iter.Error()
+}
+
+// Interrupted returns the tasks that are being processed, according to the
+// storage. When the daemon starts, those are the tasks it was processing when
+// it stopped, and the tasks claimed by remote workers.
+func (s *Storage) Interrupted() ([]*Task, error) {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixProcessing+":")), nil)
+	defer iter.Release()
+
+	var tasks []*Task
+	for iter.Next() {
+		tsk := &Task{}
+		if err := json.Unmarshal(iter.Value(), tsk); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, tsk)
+	}
+	return tasks, iter.Error()
+}
+
+func (s *Storage) deleteJournal(id string) error {
+	prefix, err := journalPrefix(id)
+	if err != nil {
+		return err
+	}
+
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return s.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
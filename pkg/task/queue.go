@@ -17,18 +17,18 @@ var (
 
 func NewQueue(ts *Storage, max int, converter func([]byte) (*Task, error)) (*Queue, error) {
 	tq := new(taskQueue)
-	for _, prefix := range []string{prefixScheduled, prefixProcessing} {
-		// read the active tasks into the queue
-		iter := ts.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-		for iter.Next() {
-			tsk, err := converter(iter.Value())
-			if err != nil {
-				return nil, err
-			}
-			heap.Push(tq, tsk)
+	// read the scheduled tasks into the queue; the tasks that were being
+	// processed are recovered separately, see Storage.Interrupted.
+	iter := ts.db.NewIterator(util.BytesPrefix([]byte(prefixScheduled+":")), nil)
+	for iter.Next() {
+		tsk, err := converter(iter.Value())
+		if err != nil {
+			iter.Release()
+			return nil, err
 		}
-		iter.Release()
+		heap.Push(tq, tsk)
 	}
+	iter.Release()
 	// correct the eviction order so we will evict oldest items first
 	return &Queue{
 		tq:  tq,
@@ -101,6 +101,12 @@ func (q *Queue) PushUniqueByBranch(tsk *Task) error {
 // The task remains in the database, but is no longer in the heap.
 // As the state of the task changes
 func (q *Queue) Pop() (*Task, error) {
+	return q.Claim(ClaimantLocal, "")
+}
+
+// Claim pops the next task off the queue on behalf of a claimant, which is
+// journaled along with the token of its lease, if any.
+func (q *Queue) Claim(claimant, lease string) (*Task, error) {
 	q.Lock()
 	defer q.Unlock()
 	if q.tq.Len() == 0 {
@@ -110,13 +116,26 @@ func (q *Queue) Pop() (*Task, error) {
 	tsk := heap.Pop(q.tq).(*Task)
 
 	logging.S().Debugw("queue.pop.got-task", "id", tsk.ID, "taskname", tsk.Name())
-	err := q.ts.ProcessTask(tsk)
+	err := q.ts.ClaimTask(tsk, claimant, lease)
 	if err != nil {
 		return nil, err
 	}
 	return tsk, nil
 }
 
+// Requeue puts a task being processed back into the queue, e.g. to resume a
+// task interrupted by a restart of the daemon.
+func (q *Queue) Requeue(tsk *Task, note string) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.ts.RequeueTask(tsk, note); err != nil {
+		return err
+	}
+	heap.Push(q.tq, tsk)
+	return nil
+}
+
 // Remove all existing tasks from the queue that match the given branch/string
 func (q *Queue) removeExisting(branch string, repo string) error {
 	var err error
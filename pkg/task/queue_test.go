@@ -250,3 +250,91 @@ func convertTask(taskData []byte) (*Task, error) {
 	}
 	return tsk, nil
 }
+
+// Tasks being processed when the daemon stops are not reloaded into the queue,
+// and their state transitions are journaled.
+func TestQueueJournalsTransitions(t *testing.T) {
+	ts, err := NewMemoryTaskStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(ts, 10, convertTask)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id1 := "bt4brhjpc98qra498sg0"
+	id2 := "bt4brhjpc98qra499sg0"
+	states := []DatedState{{State: StateScheduled, Created: time.Now()}}
+	for _, id := range []string{id1, id2} {
+		if err := q.Push(&Task{ID: id, States: states}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tsk, err := q.Claim(ClaimantRemote, "c0ffee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, id1, tsk.ID)
+
+	// a restart only reloads the scheduled task.
+	q2, err := NewQueue(ts, 10, convertTask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, q2.tq.Len())
+
+	interrupted, err := ts.Interrupted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, interrupted, 1)
+	assert.Equal(t, id1, interrupted[0].ID)
+
+	// requeue the interrupted task, claim it again and complete it.
+	if err := q2.Requeue(tsk, "interrupted"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		popped, err := q2.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if popped.ID == id1 {
+			tsk = popped
+		}
+	}
+	tsk.Error = "failed"
+	tsk.States = append(tsk.States, DatedState{State: StateComplete, Created: time.Now()})
+	if err := ts.PersistProcessing(tsk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.ArchiveTask(tsk); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := ts.Journal(id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []State
+	for _, e := range journal {
+		got = append(got, e.State)
+	}
+	assert.Equal(t, []State{StateScheduled, StateProcessing, StateScheduled, StateProcessing, StateComplete}, got)
+	assert.Equal(t, ClaimantRemote, journal[1].Claimant)
+	assert.Equal(t, "c0ffee", journal[1].Lease)
+	assert.Equal(t, "interrupted", journal[2].Note)
+	assert.Equal(t, ClaimantLocal, journal[3].Claimant)
+	assert.Equal(t, "failed", journal[4].Note)
+
+	// deleting the task deletes its journal.
+	if err := ts.Delete(id1); err != nil {
+		t.Fatal(err)
+	}
+	if journal, err = ts.Journal(id1); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, journal)
+}
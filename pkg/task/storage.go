@@ -21,6 +21,7 @@ var (
 	prefixScheduled  = "queue"
 	prefixProcessing = "current"
 	prefixComplete   = "archive"
+	prefixJournal    = "journal"
 
 	ErrNotFound = errors.New("task not found")
 )
@@ -85,6 +86,9 @@ func (s *Storage) put(prefix string, tsk *Task) error {
 }
 
 func (s *Storage) Delete(id string) error {
+	if err := s.deleteJournal(id); err != nil {
+		return err
+	}
 	tsk, err := s.get(prefixComplete, id)
 	if err == nil {
 		return s.delete(prefixComplete, tsk)
@@ -141,20 +145,66 @@ func (s *Storage) PersistProcessing(tsk *Task) error {
 	return s.put(prefixProcessing, tsk)
 }
 
+// PersistScheduled records a task entering the queue.
 func (s *Storage) PersistScheduled(tsk *Task) error {
-	return s.put(prefixScheduled, tsk)
+	val, err := json.Marshal(tsk)
+	if err != nil {
+		return err
+	}
+	key, err := taskKey(prefixScheduled, tsk.ID)
+	if err != nil {
+		return err
+	}
+	jkey, jval, err := journalRecord(tsk.ID, JournalEntry{Time: time.Now().UTC(), State: StateScheduled})
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(key, val)
+	batch.Put(jkey, jval)
+	return s.db.Write(batch, &opt.WriteOptions{Sync: true})
 }
 
+// ProcessTask moves a scheduled task to processing, on behalf of this daemon.
 func (s *Storage) ProcessTask(tsk *Task) error {
-	return s.changePrefix(prefixProcessing, prefixScheduled, tsk.ID)
+	return s.ClaimTask(tsk, ClaimantLocal, "")
 }
 
+// ClaimTask moves a scheduled task to processing, on behalf of a claimant
+// holding a lease on it, if any.
+func (s *Storage) ClaimTask(tsk *Task, claimant, lease string) error {
+	e := JournalEntry{Time: time.Now().UTC(), State: StateProcessing, Claimant: claimant, Lease: lease}
+	return s.move(prefixProcessing, prefixScheduled, tsk.ID, &e)
+}
+
+// ArchiveTask moves a task that reached a terminal state to the archive.
 func (s *Storage) ArchiveTask(tsk *Task) error {
-	return s.changePrefix(prefixComplete, prefixProcessing, tsk.ID)
+	var e *JournalEntry
+	if len(tsk.States) > 0 {
+		e = &JournalEntry{Time: time.Now().UTC(), State: tsk.State().State, Note: tsk.Error}
+	}
+	return s.move(prefixComplete, prefixProcessing, tsk.ID, e)
+}
+
+// RequeueTask moves a task being processed back to the queue, e.g. to resume
+// a task interrupted by a restart of the daemon.
+func (s *Storage) RequeueTask(tsk *Task, note string) error {
+	if err := s.PersistProcessing(tsk); err != nil {
+		return err
+	}
+	e := JournalEntry{Time: time.Now().UTC(), State: StateScheduled, Note: note}
+	return s.move(prefixScheduled, prefixProcessing, tsk.ID, &e)
 }
 
 // Change the prefix of a task
 func (s *Storage) changePrefix(dst string, src string, id string) error {
+	return s.move(dst, src, id, nil)
+}
+
+// move changes the prefix of a task and, if e is not nil, journals the
+// transition in the same transaction.
+func (s *Storage) move(dst string, src string, id string, e *JournalEntry) error {
 	oldkey, err := taskKey(src, id)
 	if err != nil {
 		return err
@@ -182,6 +232,16 @@ func (s *Storage) changePrefix(dst string, src string, id string) error {
 		trans.Discard()
 		return err
 	}
+	if e != nil {
+		jkey, jval, err := journalRecord(id, *e)
+		if err == nil {
+			err = trans.Put(jkey, jval, &opt.WriteOptions{Sync: true})
+		}
+		if err != nil {
+			trans.Discard()
+			return err
+		}
+	}
 	return trans.Commit()
 }
 
@@ -46,30 +46,102 @@ type DatedState struct {
 	State   State     `json:"state"`
 }
 
+// BuildState (kind: string) represents the state of the build of an artifact
+// within a task.
+type BuildState string
+
+const (
+	BuildStatePending   BuildState = "pending"
+	BuildStateBuilding  BuildState = "building"
+	BuildStateSucceeded BuildState = "succeeded"
+	BuildStateFailed    BuildState = "failed"
+)
+
+// GroupBuild (kind: struct) is the status of the build of an artifact, shared
+// by all the groups it's built for.
+type GroupBuild struct {
+	Groups   []string   `json:"groups"`
+	Builder  string     `json:"builder"`
+	State    BuildState `json:"state"`
+	Artifact string     `json:"artifact,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Updated  time.Time  `json:"updated"`
+}
+
+// Phase (kind: string) represents the phase a run task is going through while
+// it's being processed.
+type Phase string
+
+const (
+	PhaseBuild        Phase = "build"
+	PhasePrepareInfra Phase = "prepare-infra"
+	PhaseLaunch       Phase = "launch"
+	PhaseRun          Phase = "run"
+	PhaseCollect      Phase = "collect"
+	PhaseCleanup      Phase = "cleanup"
+)
+
+// DatedPhase (kind: struct) is a Phase with the times it started and ended.
+// Ended is zero while the phase is in progress.
+type DatedPhase struct {
+	Phase   Phase     `json:"phase"`
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
+}
+
+// Took returns how long the phase lasted, or has lasted so far.
+func (p DatedPhase) Took() time.Duration {
+	if p.Ended.IsZero() {
+		return time.Since(p.Started).Truncate(time.Second)
+	}
+	return p.Ended.Sub(p.Started).Truncate(time.Second)
+}
+
+// Estimate (kind: struct) is how far along a task is expected to be, based on
+// how long similar tasks took to process.
+type Estimate struct {
+	// Expected is how long the task is expected to take to process.
+	Expected time.Duration `json:"expected"`
+	// Remaining is how long the task is expected to still take to complete.
+	Remaining time.Duration `json:"remaining"`
+	// Progress is the fraction of the expected time elapsed so far, between
+	// 0 and 1. It stays below 1 until the task completes.
+	Progress float64 `json:"progress"`
+	// Samples is the number of past tasks the estimate is derived from.
+	Samples int `json:"samples"`
+}
+
 type CreatedBy struct {
 	User   string `json:"user,omitempty"`
 	Repo   string `json:"repo,omitempty"`
 	Branch string `json:"branch,omitempty"`
 	Commit string `json:"commit,omitempty"`
+	// Authenticated is the user of the token the task was created with, set
+	// by the daemon; unlike User, clients can't claim it. Empty if the token
+	// belongs to no user.
+	Authenticated string `json:"authenticated,omitempty"`
 }
 
 // Task (kind: struct) contains metadata about a testground task. This schema is used to store
 // metadata in our task storage database as well as the wire format returned when clients get the
 // state of a running or scheduled task.
 type Task struct {
-	Version     int          `json:"version"`     // Schema version
-	Priority    int          `json:"priority"`    // Scheduling priority
-	ID          string       `json:"id"`          // Unique identifier for this task
-	Runner      string       `json:"runner"`      // Runner that ran this task
-	Plan        string       `json:"plan"`        // Test plan
-	Case        string       `json:"case"`        // Test case
-	States      []DatedState `json:"states"`      // State of the task
-	Type        Type         `json:"type"`        // Type of the task
-	Composition interface{}  `json:"composition"` // Composition used for the task
-	Input       interface{}  `json:"input"`       // The input data for this task
-	Result      interface{}  `json:"result"`      // Result of the task, when terminal.
-	Error       string       `json:"error"`       // Error from Testground
-	CreatedBy   CreatedBy    `json:"created_by"`  // Who created the task
+	Version     int          `json:"version"`            // Schema version
+	Priority    int          `json:"priority"`           // Scheduling priority
+	ID          string       `json:"id"`                 // Unique identifier for this task
+	Runner      string       `json:"runner"`             // Runner that ran this task
+	Plan        string       `json:"plan"`               // Test plan
+	Case        string       `json:"case"`               // Test case
+	States      []DatedState `json:"states"`             // State of the task
+	Type        Type         `json:"type"`               // Type of the task
+	Composition interface{}  `json:"composition"`        // Composition used for the task
+	Input       interface{}  `json:"input"`              // The input data for this task
+	Result      interface{}  `json:"result"`             // Result of the task, when terminal.
+	Error       string       `json:"error"`              // Error from Testground
+	CreatedBy   CreatedBy    `json:"created_by"`         // Who created the task
+	Builds      []GroupBuild `json:"builds"`             // Status of the builds performed by the task
+	Phases      []DatedPhase `json:"phases"`             // Phases the task went through while processing
+	Estimate    *Estimate    `json:"estimate,omitempty"` // Estimated progress, set on status responses only
 }
 
 func (t *Task) Created() time.Time {
@@ -106,6 +178,15 @@ func (t *Task) State() DatedState {
 	return t.States[len(t.States)-1]
 }
 
+// Phase returns the phase the task is in, or went through last; nil if the
+// task didn't enter any.
+func (t *Task) Phase() *DatedPhase {
+	if len(t.Phases) == 0 {
+		return nil
+	}
+	return &t.Phases[len(t.Phases)-1]
+}
+
 func (t *Task) CreatedByCI() bool {
 	return t.CreatedBy.Repo != "" && t.CreatedBy.Commit != "" && t.CreatedBy.Branch != ""
 }
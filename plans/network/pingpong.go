@@ -55,11 +55,13 @@ func pingpong(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 
 	runenv.RecordMessage("I am %d", seq)
 
-	ipC := byte((seq >> 8) + 1)
+	// derive the address from the start of the subnet, which is a block of
+	// the data network of their own for runs attached to another.
+	ipC := runenv.TestSubnet.IP.To4()[2] + byte((seq>>8)+1)
 	ipD := byte(seq)
 
 	config.IPv4 = runenv.TestSubnet
-	config.IPv4.IP = append(config.IPv4.IP[0:2:2], ipC, ipD)
+	config.IPv4.IP = append(config.IPv4.IP.To4()[0:2:2], ipC, ipD)
 	// the mask should match the data network IP range (e.g. for EKS it is /12)
 	config.IPv4.Mask = []byte{255, 240, 0, 0}
 	config.CallbackState = "ip-changed"